@@ -28,6 +28,7 @@ import (
 	"github.com/worldopennetwork/go-won/accounts/abi/bind"
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/common/math"
+	"github.com/worldopennetwork/go-won/consensus"
 	"github.com/worldopennetwork/go-won/consensus/ethash"
 	"github.com/worldopennetwork/go-won/core"
 	"github.com/worldopennetwork/go-won/core/bloombits"
@@ -52,6 +53,7 @@ var errGasEstimationFailed = errors.New("gas required exceeds allowance or alway
 type SimulatedBackend struct {
 	database   wondb.Database   // In memory database to store our testing data
 	blockchain *core.BlockChain // WorldOpenNetwork blockchain to handle the consensus
+	engine     *simulatedEngine // Consensus engine applying the direct state changes
 
 	mu           sync.Mutex
 	pendingBlock *types.Block   // Currently pending block that will be imported on request
@@ -70,11 +72,13 @@ func NewSimulatedBackend(alloc core.GenesisAlloc) *SimulatedBackend {
 	genesis := core.Genesis{Config: params.DevChainConfig, Alloc: alloc}
 
 	genesis.MustCommit(database)
-	blockchain, _ := core.NewBlockChain(database, nil, genesis.Config, ethash.NewFaker(), vm.Config{})
+	engine := &simulatedEngine{Engine: ethash.NewFaker(), changes: make(map[uint64][]func(*state.StateDB))}
+	blockchain, _ := core.NewBlockChain(database, nil, genesis.Config, engine, vm.Config{})
 
 	backend := &SimulatedBackend{
 		database:   database,
 		blockchain: blockchain,
+		engine:     engine,
 		config:     genesis.Config,
 		events:     filters.NewEventSystem(new(event.TypeMux), &filterBackend{database, blockchain}, false),
 	}
@@ -91,6 +95,7 @@ func (b *SimulatedBackend) Commit() {
 	if _, err := b.blockchain.InsertChain([]*types.Block{b.pendingBlock}); err != nil {
 		panic(err) // This cannot happen unless the simulator is wrong, fail in that case
 	}
+	delete(b.engine.changes, b.pendingBlock.NumberU64())
 	b.rollback()
 }
 
@@ -98,11 +103,13 @@ func (b *SimulatedBackend) Commit() {
 func (b *SimulatedBackend) Rollback() {
 	b.mu.Lock()
 	defer b.mu.Unlock()
+
+	delete(b.engine.changes, b.pendingBlock.NumberU64())
 	b.rollback()
 }
 
 func (b *SimulatedBackend) rollback() {
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), ethash.NewFaker(), b.database, 1, func(int, *core.BlockGen) {})
+	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), b.engine, b.database, 1, func(int, *core.BlockGen) {})
 	statedb, _ := b.blockchain.State()
 
 	b.pendingBlock = blocks[0]
@@ -310,7 +317,7 @@ func (b *SimulatedBackend) SendTransaction(ctx context.Context, tx *types.Transa
 		panic(fmt.Errorf("invalid transaction nonce: got %d, want %d", tx.Nonce(), nonce))
 	}
 
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), ethash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
+	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), b.engine, b.database, 1, func(number int, block *core.BlockGen) {
 		for _, tx := range b.pendingBlock.Transactions() {
 			block.AddTxWithChain(b.blockchain, tx)
 		}
@@ -389,7 +396,7 @@ func (b *SimulatedBackend) SubscribeFilterLogs(ctx context.Context, query ethere
 func (b *SimulatedBackend) AdjustTime(adjustment time.Duration) error {
 	b.mu.Lock()
 	defer b.mu.Unlock()
-	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), ethash.NewFaker(), b.database, 1, func(number int, block *core.BlockGen) {
+	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), b.engine, b.database, 1, func(number int, block *core.BlockGen) {
 		for _, tx := range b.pendingBlock.Transactions() {
 			block.AddTx(tx)
 		}
@@ -403,6 +410,83 @@ func (b *SimulatedBackend) AdjustTime(adjustment time.Duration) error {
 	return nil
 }
 
+// AddKycProvider registers provider as a KYC provider, taking effect once the
+// pending block is committed.
+func (b *SimulatedBackend) AddKycProvider(provider common.Address) {
+	b.modifyState(func(statedb *state.StateDB) {
+		statedb.AddKycProvider(provider)
+	})
+}
+
+// SetKyc attests the KYC level and zone of addr on behalf of provider, taking
+// effect once the pending block is committed.
+func (b *SimulatedBackend) SetKyc(addr common.Address, provider common.Address, level uint32, zone uint32) {
+	b.modifyState(func(statedb *state.StateDB) {
+		statedb.SetKycProvider(addr, provider)
+		statedb.SetKycLevel(addr, level)
+		statedb.SetKycZone(addr, zone)
+	})
+}
+
+// RegisterProducer registers producer as a DPoS block producer with the given
+// URL, taking effect once the pending block is committed.
+func (b *SimulatedBackend) RegisterProducer(producer common.Address, url string) {
+	b.modifyState(func(statedb *state.StateDB) {
+		statedb.RegisterProducer(&producer, url)
+	})
+}
+
+// AddStake stakes amount out of the balance of voter, taking effect once the
+// pending block is committed. The stake isn't voted with.
+func (b *SimulatedBackend) AddStake(voter common.Address, amount *big.Int) {
+	b.modifyState(func(statedb *state.StateDB) {
+		stake := statedb.GetVoterStaking(&voter)
+		if stake.Sign() == 0 {
+			statedb.SetDposTotalActivatedStake(new(big.Int).Add(statedb.GetDposTotalActivatedStake(), amount))
+		}
+		statedb.SubBalance(voter, amount)
+		statedb.AddBalance(vm.KycContractAddress, amount)
+		statedb.SetVoterStaking(&voter, new(big.Int).Add(stake, amount))
+	})
+}
+
+// modifyState schedules a direct state change at the end of the pending block,
+// regenerating the block on top of the pending transactions.
+func (b *SimulatedBackend) modifyState(change func(*state.StateDB)) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	number := b.pendingBlock.NumberU64()
+	b.engine.changes[number] = append(b.engine.changes[number], change)
+
+	blocks, _ := core.GenerateChain(b.config, b.blockchain.CurrentBlock(), b.engine, b.database, 1, func(number int, block *core.BlockGen) {
+		for _, tx := range b.pendingBlock.Transactions() {
+			block.AddTxWithChain(b.blockchain, tx)
+		}
+	})
+	statedb, _ := b.blockchain.State()
+
+	b.pendingBlock = blocks[0]
+	b.pendingState, _ = state.New(b.pendingBlock.Root(), statedb.Database())
+}
+
+// simulatedEngine is the consensus engine of the simulated blockchain, applying
+// the state changes made through the backend when finalizing the block they are
+// scheduled in, both when generating and when importing it.
+type simulatedEngine struct {
+	consensus.Engine
+	changes map[uint64][]func(*state.StateDB) // Direct state changes by block number
+}
+
+// Finalize implements consensus.Engine, applying the scheduled state changes
+// ahead of the block rewards.
+func (e *simulatedEngine) Finalize(chain consensus.ChainReader, header *types.Header, statedb *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	for _, change := range e.changes[header.Number.Uint64()] {
+		change(statedb)
+	}
+	return e.Engine.Finalize(chain, header, statedb, txs, uncles, receipts)
+}
+
 // callmsg implements core.Message to allow passing it as a transaction simulator.
 type callmsg struct {
 	ethereum.CallMsg
@@ -424,8 +508,9 @@ type filterBackend struct {
 	bc *core.BlockChain
 }
 
-func (fb *filterBackend) ChainDb() wondb.Database  { return fb.db }
-func (fb *filterBackend) EventMux() *event.TypeMux { panic("not supported") }
+func (fb *filterBackend) ChainDb() wondb.Database          { return fb.db }
+func (fb *filterBackend) ChainConfig() *params.ChainConfig { return fb.bc.Config() }
+func (fb *filterBackend) EventMux() *event.TypeMux         { panic("not supported") }
 
 func (fb *filterBackend) HeaderByNumber(ctx context.Context, block rpc.BlockNumber) (*types.Header, error) {
 	if block == rpc.LatestBlockNumber {
@@ -459,6 +544,9 @@ func (fb *filterBackend) SubscribeTxPreEvent(ch chan<- core.TxPreEvent) event.Su
 func (fb *filterBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription {
 	return fb.bc.SubscribeChainEvent(ch)
 }
+func (fb *filterBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return fb.bc.SubscribeChainHeadEvent(ch)
+}
 func (fb *filterBackend) SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription {
 	return fb.bc.SubscribeRemovedLogsEvent(ch)
 }
@@ -0,0 +1,128 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package backends
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/common/hexutil"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/params"
+)
+
+// forwarderCode deploys a contract transferring the value it is called with to
+// the address in the first word of its input, reverting if the transfer fails.
+var forwarderCode = hexutil.MustDecode("0x601980600b6000396000f3" + "6000600060006000346000356000f115601457005b600080fd")
+
+// Tests that a transfer made by a contract is subject to the KYC state set up
+// through the backend, failing for an unverified recipient until it's verified.
+func TestSimulatedBackendKycTransfer(t *testing.T) {
+	var (
+		key, _    = crypto.GenerateKey()
+		sender    = crypto.PubkeyToAddress(key.PublicKey)
+		provider  = common.Address{0xff}
+		recipient = common.Address{0x01}
+		ctx       = context.Background()
+	)
+	sim := NewSimulatedBackend(core.GenesisAlloc{sender: {Balance: big.NewInt(params.WON)}})
+
+	sim.AddKycProvider(provider)
+	sim.SetKyc(sender, provider, 1, 0)
+	sim.Commit()
+
+	send := func(tx *types.Transaction) *types.Receipt {
+		signed, _ := types.SignTx(tx, types.HomesteadSigner{}, key)
+		if err := sim.SendTransaction(ctx, signed); err != nil {
+			t.Fatalf("failed to send transaction: %v", err)
+		}
+		sim.Commit()
+		receipt, _ := sim.TransactionReceipt(ctx, signed.Hash())
+		return receipt
+	}
+	nonce := uint64(0)
+	deploy := send(types.NewContractCreation(nonce, new(big.Int), 100000, new(big.Int), forwarderCode))
+	if deploy.Status != types.ReceiptStatusSuccessful {
+		t.Fatalf("failed to deploy forwarder")
+	}
+	transfer := func() *types.Receipt {
+		nonce++
+		return send(types.NewTransaction(nonce, deploy.ContractAddress, big.NewInt(1000), 100000, new(big.Int), recipient.Hash().Bytes()))
+	}
+	if receipt := transfer(); receipt.Status != types.ReceiptStatusFailed {
+		t.Errorf("transfer to unverified recipient succeeded")
+	}
+	if balance, _ := sim.BalanceAt(ctx, recipient, nil); balance.Sign() != 0 {
+		t.Errorf("unverified recipient balance mismatch: have %v, want 0", balance)
+	}
+	sim.SetKyc(recipient, provider, 1, 0)
+	sim.Commit()
+
+	if receipt := transfer(); receipt.Status != types.ReceiptStatusSuccessful {
+		t.Errorf("transfer to verified recipient failed")
+	}
+	if balance, _ := sim.BalanceAt(ctx, recipient, nil); balance.Cmp(big.NewInt(1000)) != 0 {
+		t.Errorf("verified recipient balance mismatch: have %v, want 1000", balance)
+	}
+}
+
+// Tests that stakes added through the backend move the balance of the voter into
+// the KYC contract, registering producers along the way, and that rolled back
+// changes are dropped.
+func TestSimulatedBackendStake(t *testing.T) {
+	var (
+		voter    = common.Address{0x01}
+		producer = common.Address{0x02}
+		stake    = big.NewInt(params.WON)
+		ctx      = context.Background()
+	)
+	sim := NewSimulatedBackend(core.GenesisAlloc{voter: {Balance: new(big.Int).Mul(stake, big.NewInt(2))}})
+
+	sim.RegisterProducer(producer, "http://producer")
+	sim.AddStake(voter, stake)
+	if balance, _ := sim.BalanceAt(ctx, voter, nil); balance.Cmp(new(big.Int).Mul(stake, big.NewInt(2))) != 0 {
+		t.Errorf("voter balance changed before commit: have %v", balance)
+	}
+	sim.Commit()
+
+	if balance, _ := sim.BalanceAt(ctx, voter, nil); balance.Cmp(stake) != 0 {
+		t.Errorf("voter balance mismatch: have %v, want %v", balance, stake)
+	}
+	if balance, _ := sim.BalanceAt(ctx, vm.KycContractAddress, nil); balance.Cmp(stake) != 0 {
+		t.Errorf("staked balance mismatch: have %v, want %v", balance, stake)
+	}
+	statedb, _ := sim.blockchain.State()
+	if have := statedb.GetVoterStaking(&voter); have.Cmp(stake) != 0 {
+		t.Errorf("voter stake mismatch: have %v, want %v", have, stake)
+	}
+	if list := statedb.GetProducerList(0, 1); len(list) != 1 || list[0] != producer {
+		t.Errorf("producer list mismatch: have %x, want [%x]", list, producer)
+	}
+	// Changes rolled back never make it into the chain
+	sim.AddStake(voter, stake)
+	sim.Rollback()
+	sim.Commit()
+
+	if balance, _ := sim.BalanceAt(ctx, voter, nil); balance.Cmp(stake) != 0 {
+		t.Errorf("voter balance mismatch after rollback: have %v, want %v", balance, stake)
+	}
+}
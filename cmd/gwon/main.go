@@ -78,6 +78,8 @@ var (
 		utils.TxPoolGlobalSlotsFlag,
 		utils.TxPoolAccountQueueFlag,
 		utils.TxPoolGlobalQueueFlag,
+		utils.TxPoolGovernanceSlotsFlag,
+		utils.TxPoolStakingReplaceFlag,
 		utils.TxPoolLifetimeFlag,
 		utils.FastSyncFlag,
 		utils.LightModeFlag,
@@ -98,6 +100,8 @@ var (
 		utils.MinerThreadsFlag,
 		utils.MiningEnabledFlag,
 		utils.TargetGasLimitFlag,
+		utils.StrictProducerFlag,
+		utils.SealerFlag,
 		utils.NATFlag,
 		utils.NoDiscoverFlag,
 		utils.DiscoveryV5Flag,
@@ -119,6 +123,7 @@ var (
 		utils.GpoBlocksFlag,
 		utils.GpoPercentileFlag,
 		utils.GpoFixedGasPrice,
+		utils.GpoGovernanceFlag,
 		utils.ExtraDataFlag,
 		configFileFlag,
 	}
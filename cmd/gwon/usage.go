@@ -122,6 +122,8 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.TxPoolGlobalSlotsFlag,
 			utils.TxPoolAccountQueueFlag,
 			utils.TxPoolGlobalQueueFlag,
+			utils.TxPoolGovernanceSlotsFlag,
+			utils.TxPoolStakingReplaceFlag,
 			utils.TxPoolLifetimeFlag,
 		},
 	},
@@ -188,6 +190,8 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.TargetGasLimitFlag,
 			utils.GasPriceFlag,
 			utils.ExtraDataFlag,
+			utils.StrictProducerFlag,
+			utils.SealerFlag,
 		},
 	},
 	{
@@ -196,6 +200,7 @@ var AppHelpFlagGroups = []flagGroup{
 			utils.GpoBlocksFlag,
 			utils.GpoPercentileFlag,
 			utils.GpoFixedGasPrice,
+			utils.GpoGovernanceFlag,
 		},
 	},
 	{
@@ -108,6 +108,28 @@ func (w *wizard) makeGenesis() {
 			MaxDposConfirm:    1024,
 			ProducerRepetions: 12,
 		}
+		genesis.Config.DposCheckpointBlock = big.NewInt(0)
+		genesis.Config.DposSlotAlignmentBlock = big.NewInt(0)
+		genesis.Config.KycProposalQueueBlock = big.NewInt(0)
+		genesis.Config.KycCallRestrictionBlock = big.NewInt(0)
+		genesis.Config.DposVoteLimitBlock = big.NewInt(0)
+		genesis.Config.KycProposalCancelBlock = big.NewInt(0)
+		genesis.Config.KycHistoryBlock = big.NewInt(0)
+		genesis.Config.KycExpiryBlock = big.NewInt(0)
+		genesis.Config.KycSetBatchBlock = big.NewInt(0)
+		genesis.Config.KycContractCreatorBlock = big.NewInt(0)
+		genesis.Config.KycZoneProposalBlock = big.NewInt(0)
+		genesis.Config.KycThresholdQueryBlock = big.NewInt(0)
+		genesis.Config.KycProviderInfoBlock = big.NewInt(0)
+		genesis.Config.KycMinProvidersBlock = big.NewInt(0)
+		genesis.Config.DposStakeLogBlock = big.NewInt(0)
+		genesis.Config.DposGasLimitBlock = big.NewInt(0)
+		genesis.Config.DposElectionOrderBlock = big.NewInt(0)
+		genesis.Config.DposVoteChangeBlock = big.NewInt(0)
+		genesis.Config.DposProxyBlock = big.NewInt(0)
+		genesis.Config.DposLocationBlock = big.NewInt(0)
+		genesis.Config.DposAutoRefundBlock = big.NewInt(0)
+		genesis.Config.DposSigningKeyBlock = big.NewInt(0)
 		fmt.Println()
 
 		// We also need the initial list of signers
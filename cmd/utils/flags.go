@@ -286,6 +286,15 @@ var (
 		Usage: "Maximum number of non-executable transaction slots for all accounts",
 		Value: won.DefaultConfig.TxPool.GlobalQueue,
 	}
+	TxPoolGovernanceSlotsFlag = cli.Uint64Flag{
+		Name:  "txpool.governanceslots",
+		Usage: "Number of transaction slots reserved for KYC providers and producers",
+		Value: won.DefaultConfig.TxPool.GovernanceSlots,
+	}
+	TxPoolStakingReplaceFlag = cli.BoolFlag{
+		Name:  "txpool.stakingreplace",
+		Usage: "Allow staking transactions to be corrected by a same priced replacement",
+	}
 	TxPoolLifetimeFlag = cli.DurationFlag{
 		Name:  "txpool.lifetime",
 		Usage: "Maximum amount of time non-executable transaction are queued",
@@ -341,6 +350,14 @@ var (
 		Name:  "extradata",
 		Usage: "Block extra data set by the miner (default = client version)",
 	}
+	StrictProducerFlag = cli.BoolFlag{
+		Name:  "strictproducer",
+		Usage: "Refuse to start mining if the wonbase is not an elected dpos producer",
+	}
+	SealerFlag = cli.StringFlag{
+		Name:  "sealer",
+		Usage: "Public address of the signing key sealing the dpos blocks of the wonbase (default = wonbase)",
+	}
 	// Account settings
 	UnlockedAccountFlag = cli.StringFlag{
 		Name:  "unlock",
@@ -525,6 +542,11 @@ var (
 		Usage: "Set mandatory use of fixed gas price",
 		Value: won.DefaultConfig.GPO.FixedGasPrice,
 	}
+	GpoGovernanceFlag = cli.StringFlag{
+		Name:  "gpogovernance",
+		Usage: "Gas price suggested for KYC governance transactions (market, fixed or free)",
+		Value: won.DefaultConfig.GPO.Governance,
+	}
 	WhisperEnabledFlag = cli.BoolFlag{
 		Name:  "shh",
 		Usage: "Enable Whisper",
@@ -778,8 +800,8 @@ func MakeAddress(ks *keystore.KeyStore, account string) (accounts.Account, error
 	return accs[index], nil
 }
 
-// setWonbase retrieves the wonbase either from the directly specified
-// command line flags or from the keystore if CLI indexed.
+// setWonbase retrieves the wonbase and the key sealing for it either from the
+// directly specified command line flags or from the keystore if CLI indexed.
 func setWonbase(ctx *cli.Context, ks *keystore.KeyStore, cfg *won.Config) {
 	if ctx.GlobalIsSet(WonbaseFlag.Name) {
 		account, err := MakeAddress(ks, ctx.GlobalString(WonbaseFlag.Name))
@@ -788,6 +810,13 @@ func setWonbase(ctx *cli.Context, ks *keystore.KeyStore, cfg *won.Config) {
 		}
 		cfg.Wonbase = account.Address
 	}
+	if ctx.GlobalIsSet(SealerFlag.Name) {
+		account, err := MakeAddress(ks, ctx.GlobalString(SealerFlag.Name))
+		if err != nil {
+			Fatalf("Option %q: %v", SealerFlag.Name, err)
+		}
+		cfg.Sealer = account.Address
+	}
 }
 
 // MakePasswordList reads password lines from the file specified by the global --password flag.
@@ -916,6 +945,9 @@ func setGPO(ctx *cli.Context, cfg *gasprice.Config) {
 	if ctx.GlobalIsSet(GpoFixedGasPrice.Name) {
 		cfg.FixedGasPrice = ctx.GlobalInt(GpoFixedGasPrice.Name)
 	}
+	if ctx.GlobalIsSet(GpoGovernanceFlag.Name) {
+		cfg.Governance = ctx.GlobalString(GpoGovernanceFlag.Name)
+	}
 }
 
 func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
@@ -946,6 +978,12 @@ func setTxPool(ctx *cli.Context, cfg *core.TxPoolConfig) {
 	if ctx.GlobalIsSet(TxPoolGlobalQueueFlag.Name) {
 		cfg.GlobalQueue = ctx.GlobalUint64(TxPoolGlobalQueueFlag.Name)
 	}
+	if ctx.GlobalIsSet(TxPoolGovernanceSlotsFlag.Name) {
+		cfg.GovernanceSlots = ctx.GlobalUint64(TxPoolGovernanceSlotsFlag.Name)
+	}
+	if ctx.GlobalIsSet(TxPoolStakingReplaceFlag.Name) {
+		cfg.StakingReplace = ctx.GlobalBool(TxPoolStakingReplaceFlag.Name)
+	}
 	if ctx.GlobalIsSet(TxPoolLifetimeFlag.Name) {
 		cfg.Lifetime = ctx.GlobalDuration(TxPoolLifetimeFlag.Name)
 	}
@@ -1077,6 +1115,9 @@ func SetEthConfig(ctx *cli.Context, stack *node.Node, cfg *won.Config) {
 	if ctx.GlobalIsSet(GasPriceFlag.Name) {
 		cfg.GasPrice = GlobalBig(ctx, GasPriceFlag.Name)
 	}
+	if ctx.GlobalIsSet(StrictProducerFlag.Name) {
+		cfg.StrictProducer = ctx.GlobalBool(StrictProducerFlag.Name)
+	}
 	if ctx.GlobalIsSet(VMEnableDebugFlag.Name) {
 		// TODO(fjl): force-enable this in --dev mode
 		cfg.EnablePreimageRecording = ctx.GlobalBool(VMEnableDebugFlag.Name)
@@ -251,19 +251,66 @@ func BytesToInt64(buf []byte) int64 {
 }
 
 func AddressToHashWithPrefix(addr *Address, prefix int64) Hash {
-	a := addr.Bytes()
-	b := make([]byte, HashLength)
-	copy(b[HashLength-AddressLength:], a)
-	c := Int64ToBytes(prefix)
-	copy(b[0:], c)
+	return PrefixedAddressHash(*addr, prefix)
+}
+
+// PrefixedAddressHash returns the key of addr under prefix, the prefix taking
+// the leading 8 bytes in big endian and the address the trailing 20. Unlike
+// AddressToHashWithPrefix it takes the address by value and builds the key in
+// place, without allocating.
+func PrefixedAddressHash(addr Address, prefix int64) (h Hash) {
+	binary.BigEndian.PutUint64(h[:8], uint64(prefix))
+	copy(h[HashLength-AddressLength:], addr[:])
+	return h
+}
+
+// KycProviderInfo is the metadata a KYC provider is registered with.
+type KycProviderInfo struct {
+	Address      Address `json:"address" rlp:"-"`
+	Name         string  `json:"name"`
+	Jurisdiction string  `json:"jurisdiction"`
+	URL          string  `json:"url"`
+}
 
-	return BytesToHash(b)
+// KycHistoryEntry is a single change of the KYC level and zone of an address.
+type KycHistoryEntry struct {
+	Time     uint64  `json:"time"`
+	Provider Address `json:"provider"`
+	OldLevel uint32  `json:"oldLevel"`
+	NewLevel uint32  `json:"newLevel"`
+	OldZone  uint32  `json:"oldZone"`
+	NewZone  uint32  `json:"newZone"`
 }
 
+// KycAttestation is a KYC attestation awaiting its confirmation by a second
+// provider, which has to happen before Deadline. Epoch is the attestation epoch
+// of the provider it was made in.
+type KycAttestation struct {
+	Provider  Address `json:"provider"`
+	Level     uint32  `json:"level"`
+	Zone      uint32  `json:"zone"`
+	ExpiresAt uint64  `json:"expiresAt"`
+	Deadline  uint64  `json:"deadline"`
+	Epoch     uint64  `json:"epoch"`
+}
+
+// ProducerLocation is the ISO 3166-1 numeric code of the country or region a
+// block producer operates from, zero if unknown.
+type ProducerLocation uint16
+
+// MaxProducerLocation is the largest ISO 3166-1 numeric code.
+const MaxProducerLocation = ProducerLocation(999)
+
+// Known reports whether the location is set.
+func (l ProducerLocation) Known() bool { return l != 0 }
+
+// String formats the location as the three digits of its ISO 3166-1 code.
+func (l ProducerLocation) String() string { return fmt.Sprintf("%03d", uint16(l)) }
+
 type ProducerInfo struct {
-	Owner      *Address
-	Url        string
-	TotalVotes *big.Int
-	IsActive   bool
-	Location   *big.Int
+	Owner      *Address         `json:"address"`
+	Url        string           `json:"url"`
+	TotalVotes *big.Int         `json:"totalVotes"`
+	IsActive   bool             `json:"isActive"`
+	Location   ProducerLocation `json:"location"`
 }
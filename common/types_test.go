@@ -149,3 +149,48 @@ func BenchmarkAddressHex(b *testing.B) {
 		testAddr.Hex()
 	}
 }
+
+// legacyAddressToHashWithPrefix is the original key derivation the storage of
+// the KYC contract is laid out with.
+func legacyAddressToHashWithPrefix(addr *Address, prefix int64) Hash {
+	b := make([]byte, HashLength)
+	copy(b[HashLength-AddressLength:], addr.Bytes())
+	copy(b[0:], Int64ToBytes(prefix))
+	return BytesToHash(b)
+}
+
+func TestPrefixedAddressHash(t *testing.T) {
+	addrs := []Address{{}, HexToAddress("0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed"), HexToAddress("0xffffffffffffffffffffffffffffffffffffffff")}
+	prefixes := []int64{0, 1, 0x70, 0x100, 0x1ffff, -1, 1 << 62}
+	for _, addr := range addrs {
+		for _, prefix := range prefixes {
+			want := legacyAddressToHashWithPrefix(&addr, prefix)
+			if have := PrefixedAddressHash(addr, prefix); have != want {
+				t.Errorf("address %x, prefix %d: key mismatch: have %x, want %x", addr, prefix, have, want)
+			}
+			if have := AddressToHashWithPrefix(&addr, prefix); have != want {
+				t.Errorf("address %x, prefix %d: pointer key mismatch: have %x, want %x", addr, prefix, have, want)
+			}
+		}
+	}
+	addr := addrs[1]
+	if allocs := testing.AllocsPerRun(100, func() { PrefixedAddressHash(addr, 0x70) }); allocs != 0 {
+		t.Errorf("key derivation allocates: %v allocations per run", allocs)
+	}
+}
+
+func BenchmarkAddressToHashWithPrefix(b *testing.B) {
+	addr := HexToAddress("0x5aaeb6053f3e94c9b9a09f33669435e7ef1beaed")
+	b.Run("legacy", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			legacyAddressToHashWithPrefix(&addr, int64(n))
+		}
+	})
+	b.Run("inplace", func(b *testing.B) {
+		b.ReportAllocs()
+		for n := 0; n < b.N; n++ {
+			PrefixedAddressHash(addr, int64(n))
+		}
+	})
+}
@@ -110,3 +110,14 @@ type PoW interface {
 	// Hashrate returns the current mining hashrate of a PoW consensus engine.
 	Hashrate() float64
 }
+
+// ElectionVerifier is a consensus engine whose signer set is elected from the
+// chain state rather than carried by the headers alone.
+type ElectionVerifier interface {
+	Engine
+
+	// VerifyElection checks that the signer list carried by a header matches the
+	// one elected in the given state of its parent. Headers not rotating the
+	// signer set are always accepted.
+	VerifyElection(chain ChainReader, header *types.Header, parent *state.StateDB) error
+}
@@ -18,9 +18,11 @@ package dpos
 
 import (
 	"bytes"
+	"encoding/json"
 	"errors"
 	"math/big"
-	//"math/rand"
+	"math/rand"
+	"sort"
 	"sync"
 	"time"
 
@@ -31,6 +33,7 @@ import (
 	"github.com/worldopennetwork/go-won/consensus/misc"
 	"github.com/worldopennetwork/go-won/core/state"
 	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
 	"github.com/worldopennetwork/go-won/crypto"
 	"github.com/worldopennetwork/go-won/crypto/sha3"
 	"github.com/worldopennetwork/go-won/log"
@@ -44,20 +47,26 @@ const (
 	checkpointInterval = 60   // Number of blocks after which to save the vote snapshot to the database
 	inmemorySnapshots  = 128  // Number of recent vote snapshots to keep in memory
 	inmemorySignatures = 4096 // Number of recent block signatures to keep in memory
+	inmemoryElections  = 16   // Number of recent epoch elections to keep in memory
 
 	wiggleTime = 500 * time.Millisecond // Random delay (per signer) to allow concurrent signers
 )
 
 // Dpos proof-of-authority protocol constants.
 var (
-	epochLength = uint64(30000) // Default number of blocks after which to checkpoint and reset the pending votes
-	blockPeriod = uint64(15)    // Default minimum difference between two consecutive block's timestamps
+	epochLength         = uint64(params.DefaultDposEpoch) // Default number of blocks after which to checkpoint and reset the pending votes
+	blockPeriod         = uint64(15)                      // Default minimum difference between two consecutive block's timestamps
+	producerRepetitions = uint64(1)                       // Default number of consecutive slots assigned to a producer per turn
+	evidenceRetention   = uint64(90000)                   // Default number of blocks to retain double-sign evidence for
+	snapshotRetention   = uint64(90000)                   // Default number of blocks to retain persisted snapshots for
 
 	extraVanity = 32 // Fixed number of extra-data prefix bytes reserved for signer vanity
 	extraSeal   = 65 // Fixed number of extra-data suffix bytes reserved for signer seal
 
 	uncleHash = types.CalcUncleHash(nil) // Always Keccak256(RLP([])) as uncles are meaningless outside of PoW.
 
+	diffInTurn = big.NewInt(2) // Block difficulty for in-turn signatures
+	diffNoTurn = big.NewInt(1) // Block difficulty for out-of-turn signatures
 )
 
 // Various error messages to mark blocks invalid. These should be private to
@@ -104,6 +113,10 @@ var (
 	// errInvalidUncleHash is returned if a block contains an non-empty uncle list.
 	errInvalidUncleHash = errors.New("non empty uncle hash")
 
+	// errInvalidGasLimit is returned if the gas limit of a block doesn't follow the
+	// gas limit policy of the network.
+	errInvalidGasLimit = errors.New("invalid gas limit")
+
 	// errInvalidDifficulty is returned if the difficulty of a block is not either
 	// of 1 or 2, or if the value does not match the turn of the signer.
 	errInvalidDifficulty = errors.New("invalid difficulty")
@@ -112,6 +125,10 @@ var (
 	// the previous block's timestamp + the minimum block period.
 	ErrInvalidTimestamp = errors.New("invalid timestamp")
 
+	// errMisalignedTimestamp is returned if the timestamp of a block doesn't fall
+	// on the start of a slot, a whole number of block periods after its parent.
+	errMisalignedTimestamp = errors.New("timestamp off the slot boundaries")
+
 	// errInvalidVotingChain is returned if an authorization list is attempted to
 	// be modified via out-of-range or non-contiguous headers.
 	errInvalidVotingChain = errors.New("invalid voting chain")
@@ -119,6 +136,11 @@ var (
 	// errUnauthorized is returned if a header is signed by a non-authorized entity.
 	errUnauthorized = errors.New("unauthorized")
 
+	// errRecentlySigned is returned if a header is signed by an authorized entity
+	// that already signed its share of the recent blocks, thus is temporarily not
+	// allowed to.
+	errRecentlySigned = errors.New("recently signed")
+
 	// errWaitTransactions is returned if an empty block is attempted to be sealed
 	// on an instant chain (0 second period). It's important to refuse these as the
 	// block reward is zero, so an empty block just bloats the chain... fast.
@@ -185,23 +207,79 @@ func ecrecover(header *types.Header, sigcache *lru.ARCCache) (common.Address, er
 	return signer, nil
 }
 
+// extractSigners retrieves the producer list carried in the extra-data section
+// of a header, between the vanity prefix and the seal suffix.
+func extractSigners(header *types.Header) []common.Address {
+	signers, _, _ := extractCheckpoint(header)
+	return signers
+}
+
+// extractCheckpoint retrieves the producer list carried in the extra-data section
+// of a header along with their signing keys, which are nil unless some producer
+// has one, and the signing keys they replace, which are nil unless some producer
+// rotated its key.
+func extractCheckpoint(header *types.Header) (signers []common.Address, keys []common.Address, previous []common.Address) {
+	if len(header.Extra) < extraVanity+extraSeal {
+		return nil, nil, nil
+	}
+	return splitCheckpoint(header.Extra[extraVanity-1], header.Extra[extraVanity:len(header.Extra)-extraSeal])
+}
+
+// legacySigners retrieves the producer list every header carries in its
+// extra-data section before the checkpoint fork, which has no layout version.
+func legacySigners(header *types.Header) []common.Address {
+	if len(header.Extra) < extraVanity+extraSeal {
+		return nil
+	}
+	signers, _, _ := splitCheckpoint(extraVersion0, header.Extra[extraVanity:len(header.Extra)-extraSeal])
+	return signers
+}
+
+// CheckpointSigners returns the producer schedule checkpointed in the extra-data
+// of an epoch header, in signing order. It is empty for all other headers.
+func CheckpointSigners(header *types.Header) []common.Address {
+	return extractSigners(header)
+}
+
 // Dpos is the proof-of-authority consensus engine proposed to support the
 // WorldOpenNetwork testnet following the Ropsten attacks.
 type Dpos struct {
 	config *params.DposConfig // Consensus engine configuration parameters
 	db     wondb.Database     // Database to store and retrieve snapshot checkpoints
 
-	//	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
+	recents    *lru.ARCCache // Snapshots for recent block to speed up reorgs
 	signatures *lru.ARCCache // Signatures of recent blocks to speed up mining
+	sealed     *lru.ARCCache // Headers recently sealed by each producer to detect double signing
+	elections  *lru.ARCCache // Producer lists elected on top of recent epoch parents
+
+	evidenceLock sync.Mutex // Protects the double-sign evidence index
+	snapshotLock sync.Mutex // Protects the persisted snapshot index
 
 	//proposals map[common.Address]bool // Current list of proposals we are pushing
 
-	signer common.Address // WorldOpenNetwork address of the signing key
-	signFn SignerFn       // Signer function to authorize hashes with
-	lock   sync.RWMutex   // Protects the signer fields
-	chain  consensus.ChainReader
+	producer common.Address // WorldOpenNetwork address of the producer sealing for
+	signer   common.Address // WorldOpenNetwork address of the signing key
+	signFn   SignerFn       // Signer function to authorize hashes with
+	stopping chan struct{}  // Closed when a graceful stop of the signer is requested
+	stopped  chan struct{}  // Closed once the turn of the signer passed during a graceful stop
+	lock     sync.RWMutex   // Protects the signer fields
+	chain    consensus.ChainReader
+
+	clock sealClock // Source of time for the sealing delays, replaceable in tests
+}
+
+// sealClock abstracts the passing of time while waiting to seal a block.
+type sealClock interface {
+	Now() time.Time
+	After(d time.Duration) <-chan time.Time
 }
 
+// systemClock is the sealClock backed by the system time.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time                         { return time.Now() }
+func (systemClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
 // New creates a Dpos proof-of-authority consensus engine with the initial
 // signers set to the ones provided by the user.
 func New(config *params.DposConfig, db wondb.Database) *Dpos {
@@ -210,23 +288,53 @@ func New(config *params.DposConfig, db wondb.Database) *Dpos {
 	if conf.Epoch == 0 {
 		conf.Epoch = epochLength
 	}
+	if conf.ProducerRepetions == 0 {
+		conf.ProducerRepetions = producerRepetitions
+	}
+	if conf.EvidenceRetention == 0 {
+		conf.EvidenceRetention = evidenceRetention
+	}
+	if conf.SnapshotRetention == 0 {
+		conf.SnapshotRetention = snapshotRetention
+	}
+	// The grace window of rotated signing keys closes before the next checkpoint
+	if conf.KeyRotationGrace >= conf.Epoch {
+		conf.KeyRotationGrace = conf.Epoch - 1
+	}
 	// Allocate the snapshot caches and create the engine
-	//	recents, _ := lru.NewARC(inmemorySnapshots)
+	recents, _ := lru.NewARC(inmemorySnapshots)
 	signatures, _ := lru.NewARC(inmemorySignatures)
+	sealed, _ := lru.NewARC(inmemorySignatures)
+	elections, _ := lru.NewARC(inmemoryElections)
 
 	return &Dpos{
-		config: &conf,
-		db:     db,
-		//	recents:    recents,
+		config:     &conf,
+		db:         db,
+		recents:    recents,
 		signatures: signatures,
+		sealed:     sealed,
+		elections:  elections,
+		clock:      systemClock{},
+		stopping:   make(chan struct{}),
+		stopped:    make(chan struct{}),
 		//proposals:  make(map[common.Address]bool),
 	}
 }
 
-// Author implements consensus.Engine, returning the WorldOpenNetwork address recovered
-// from the signature in the header's extra-data section.
+// Author implements consensus.Engine, returning the producer of the block: its
+// coinbase, which the key recovered from the signature in the header's extra-data
+// section is verified to seal for.
 func (c *Dpos) Author(header *types.Header) (common.Address, error) {
-	return ecrecover(header, c.signatures)
+	if _, err := ecrecover(header, c.signatures); err != nil {
+		return common.Address{}, err
+	}
+	return header.Coinbase, nil
+}
+
+// checkpointing reports whether the block number is past the checkpoint fork of
+// the chain, from which on only epoch headers carry the producer list.
+func (c *Dpos) checkpointing(chain consensus.ChainReader, number uint64) bool {
+	return chain.Config().IsDposCheckpoint(new(big.Int).SetUint64(number))
 }
 
 // VerifyHeader checks whether a header conforms to the consensus rules.
@@ -259,7 +367,15 @@ func (c *Dpos) VerifyHeaders(chain consensus.ChainReader, headers []*types.Heade
 // caller may optionally pass in a batch of parents (ascending order) to avoid
 // looking those up from the database. This is useful for concurrently verifying
 // a batch of new headers.
-func (c *Dpos) verifyHeader(chain consensus.ChainReader, header *types.Header, parents []*types.Header) error {
+func (c *Dpos) verifyHeader(chain consensus.ChainReader, header *types.Header, parents []*types.Header) (err error) {
+	// Any snapshot checkpointed or evidence recorded along the way is written
+	// out at once when done
+	batch := c.newStoreBatch()
+	defer func() {
+		if werr := batch.write(); err == nil {
+			err = werr
+		}
+	}()
 
 	if header == nil {
 		return errUnknownBlock
@@ -268,10 +384,11 @@ func (c *Dpos) verifyHeader(chain consensus.ChainReader, header *types.Header, p
 	if header.Number == nil {
 		return errUnknownBlock
 	}
-	//number := header.Number.Uint64()
+	number := header.Number.Uint64()
 
-	// Don't waste time checking blocks from the future
-	if header.Time.Cmp(big.NewInt(time.Now().Unix())) > 0 {
+	// Don't waste time checking blocks from the future, beyond the clock skew
+	// tolerated between producers
+	if header.Time.Uint64() > uint64(c.clock.Now().Unix())+c.config.ClockSkew {
 		return consensus.ErrFutureBlock
 	}
 	// Checkpoint blocks need to enforce zero beneficiary
@@ -288,21 +405,16 @@ func (c *Dpos) verifyHeader(chain consensus.ChainReader, header *types.Header, p
 	//	return errInvalidCheckpointVote
 	//}
 
-	// Check that the extra-data contains both the vanity and signature
-	if len(header.Extra) < extraVanity {
-		return errMissingVanity
-	}
-	if len(header.Extra) < extraVanity+extraSeal {
-		return errMissingSignature
-	}
-	// Ensure that the extra-data contains a signer list on checkpoint, but none otherwise
-	signersBytes := len(header.Extra) - extraVanity - extraSeal
-	if signersBytes <= 0 {
-		return errExtraSigners
-	}
-
-	if signersBytes%common.AddressLength != 0 {
-		return errInvalidCheckpointSigners
+	// Check that the extra-data follows a known layout, containing the vanity, the
+	// signature and a signer list on checkpoints, but none otherwise. Before the
+	// checkpoint fork every header carries the signer list.
+	checkpointing := c.checkpointing(chain, number)
+	if checkpointing {
+		if _, err := parseExtra(header.Extra, number%c.config.Epoch == 0); err != nil {
+			return err
+		}
+	} else if err := verifyLegacyExtra(header.Extra); err != nil {
+		return err
 	}
 	// Ensure that the mix digest is zero as we don't have fork protection currently
 	if header.MixDigest != (common.Hash{}) {
@@ -312,20 +424,28 @@ func (c *Dpos) verifyHeader(chain consensus.ChainReader, header *types.Header, p
 	if header.UncleHash != uncleHash {
 		return errInvalidUncleHash
 	}
+	// Ensure that the block's difficulty is meaningful (may not be correct at this point),
+	// any difficulty being accepted before the checkpoint fork
+	if number > 0 && checkpointing {
+		if header.Difficulty == nil || (header.Difficulty.Cmp(diffInTurn) != 0 && header.Difficulty.Cmp(diffNoTurn) != 0) {
+			return errInvalidDifficulty
+		}
+	}
 
 	// If all checks passed, validate any special fields for hard forks
 	if err := misc.VerifyForkHashes(chain.Config(), header, false); err != nil {
 		return err
 	}
 	// All basic checks passed, verify cascading fields
-	return c.verifyCascadingFields(chain, header, parents)
+	return c.verifyCascadingFields(chain, header, parents, batch)
 }
 
 // verifyCascadingFields verifies all the header fields that are not standalone,
 // rather depend on a batch of previous headers. The caller may optionally pass
 // in a batch of parents (ascending order) to avoid looking those up from the
 // database. This is useful for concurrently verifying a batch of new headers.
-func (c *Dpos) verifyCascadingFields(chain consensus.ChainReader, header *types.Header, parents []*types.Header) error {
+// Any snapshot checkpointed is persisted through batch.
+func (c *Dpos) verifyCascadingFields(chain consensus.ChainReader, header *types.Header, parents []*types.Header, batch *storeBatch) error {
 	// The genesis block is the always valid dead-end
 	number := header.Number.Uint64()
 	if number == 0 {
@@ -345,27 +465,81 @@ func (c *Dpos) verifyCascadingFields(chain consensus.ChainReader, header *types.
 	if parent.Time.Uint64()+c.config.Period > header.Time.Uint64() {
 		return ErrInvalidTimestamp
 	}
+	// Blocks are stamped with the start of their slot, skipped slots included,
+	// from the slot alignment fork on
+	if chain.Config().IsDposSlotAlignment(header.Number) && (header.Time.Uint64()-parent.Time.Uint64())%slotPeriod(c.config) != 0 {
+		return errMisalignedTimestamp
+	}
+	// The gas limit policy is enforced from the gas limit fork on
+	if chain.Config().IsDposGasLimit(header.Number) {
+		if err := c.verifyGasLimit(header, parent); err != nil {
+			return err
+		}
+	}
+	// If we're at an epoch block and have the parent state (i.e. not a light client
+	// or a batch import), ensure the carried producer list is the elected one
+	if number%c.config.Epoch == 0 && c.checkpointing(chain, number) {
+		if statedb, err := chain.StateAt(parent.Root); err == nil && statedb != nil {
+			snap, err := c.batchSnapshot(chain, number-1, header.ParentHash, parents, batch)
+			if err != nil {
+				return err
+			}
+			if err := c.verifyCheckpoint(chain, snap, statedb, header); err != nil {
+				return err
+			}
+		}
+	}
 
 	//if !c.verifySignersElecting(chain, header, parent) {
 	//	return errInvalidVotingChain;
 	//}
 
 	// All basic checks passed, verify the seal and return
-	return c.verifySeal(chain, header, parents)
+	return c.verifySeal(chain, header, parents, batch)
 }
 
 // snapshot retrieves the authorization snapshot at a given point in time.
 func (c *Dpos) snapshot(chain consensus.ChainReader, number uint64, hash common.Hash, parents []*types.Header) (*DposSnapshot, error) {
-	// Search for a snapshot in memory or on disk for checkpoints
+	batch := c.newStoreBatch()
+	snap, err := c.batchSnapshot(chain, number, hash, parents, batch)
+	if werr := batch.write(); err == nil && werr != nil {
+		return nil, werr
+	}
+	return snap, err
+}
+
+// batchSnapshot is snapshot, persisting any new checkpoint snapshot through the
+// batch instead of on its own.
+func (c *Dpos) batchSnapshot(chain consensus.ChainReader, number uint64, hash common.Hash, parents []*types.Header, batch *storeBatch) (*DposSnapshot, error) {
+	// Search for a snapshot in memory or at the last checkpoint
 	var (
-		//headers []*types.Header
-		snap   *DposSnapshot
-		header *types.Header
+		headers []*types.Header
+		snap    *DposSnapshot
+		built   bool // Whether the snapshot was built from a header rather than retrieved
 	)
-
 	for snap == nil {
-
-		if number == 0 {
+		// If an in-memory snapshot was found, use that
+		if s, ok := c.recents.Get(hash); ok {
+			snap = s.(*DposSnapshot)
+			break
+		}
+		// If an on-disk checkpoint snapshot can be found, use that
+		if number%checkpointInterval == 0 {
+			if s, err := loadSnapshot(c.config, c.signatures, c.db, number, hash); err == nil {
+				log.Trace("Loaded voting snapshot from disk", "number", number, "hash", hash)
+				snap = s
+				break
+			}
+		}
+		// Retrieve the header, preferring any explicit parents (enforced)
+		var header *types.Header
+		if len(parents) > 0 {
+			header = parents[len(parents)-1]
+			if header.Hash() != hash || header.Number.Uint64() != number {
+				return nil, consensus.ErrUnknownAncestor
+			}
+			parents = parents[:len(parents)-1]
+		} else if number == 0 {
 			header = chain.GetHeaderByNumber(0)
 			if err := c.VerifyHeader(chain, header, false); err != nil {
 				return nil, err
@@ -373,38 +547,143 @@ func (c *Dpos) snapshot(chain consensus.ChainReader, number uint64, hash common.
 		} else {
 			header = chain.GetHeader(hash, number)
 		}
-
-		//if err := c.VerifyHeader(chain, genesis, false); err != nil {
-		//	return nil, err
-		//}
-
 		if header == nil {
-			if len(parents) > 0 {
-				// If we have explicit parents, pick from there (enforced)
-				header = parents[len(parents)-1]
-				if header.Hash() != hash || header.Number.Uint64() != number {
-					return nil, consensus.ErrUnknownAncestor
+			return nil, consensus.ErrUnknownAncestor
+		}
+		// Before the checkpoint fork every header carries the producer list in
+		// effect for its children
+		if !c.checkpointing(chain, number) {
+			snap, built = newSnapshot(c.config, c.signatures, number, header.Hash(), legacySigners(header)), true
+			break
+		}
+		// If we're at the genesis or an epoch block, the producer list is carried
+		// in the header itself
+		if number == 0 || number%c.config.Epoch == 0 {
+			signers, keys, previous := extractCheckpoint(header)
+			snap = newSnapshot(c.config, c.signatures, number, header.Hash(), signers)
+			snap.setSigningKeys(signers, keys, previous)
+			if number > 0 {
+				// The seal of the epoch block was verified against its coinbase
+				if _, err := ecrecover(header, c.signatures); err != nil {
+					return nil, err
 				}
-			} else {
-				return nil, consensus.ErrUnknownAncestor
+				snap.Recents[number] = header.Coinbase
 			}
-
+			built = true
+			break
 		}
+		// No snapshot for this header, gather the header and move backward
+		headers = append(headers, header)
+		number, hash = number-1, header.ParentHash
+	}
+	// Previous snapshot found, apply any pending headers on top of it
+	for i := 0; i < len(headers)/2; i++ {
+		headers[i], headers[len(headers)-1-i] = headers[len(headers)-1-i], headers[i]
+	}
+	snap, err := snap.apply(headers)
+	if err != nil {
+		return nil, err
+	}
+	c.recents.Add(snap.Hash, snap)
 
-		signers := make([]common.Address, (len(header.Extra)-extraVanity-extraSeal)/common.AddressLength)
-		for i := 0; i < len(signers); i++ {
-			copy(signers[i][:], header.Extra[extraVanity+i*common.AddressLength:])
+	// If we've generated a new checkpoint snapshot, save to disk
+	if snap.Number%checkpointInterval == 0 && (built || len(headers) > 0) {
+		if err = c.storeSnapshot(batch, snap); err != nil {
+			return nil, err
 		}
-		snap = newSnapshot(c.config, c.signatures, number, header.Hash(), signers)
+		log.Trace("Stored voting snapshot to disk", "number", snap.Number, "hash", snap.Hash)
+	}
+	return snap, nil
+}
 
-		//	log.Debug("newSnapshot ", "signers", snap.Signers, "number",number, "hash", hash, "signers_input", signers)
-		break
+// snapshotEntry is the position of a single persisted snapshot within the index.
+type snapshotEntry struct {
+	Number uint64      `json:"number"`
+	Hash   common.Hash `json:"hash"`
+}
+
+// snapshotIndexKey tracks the positions of all the persisted snapshots.
+var snapshotIndexKey = []byte("dpos-snapshot-index")
+
+// storeBatch accumulates the snapshots and evidence persisted while verifying a
+// header, so that they hit the database in a single write, either all or none
+// of them. The indexes updated through the batch stay locked until it is
+// written, keeping concurrent verifications from overwriting each other.
+type storeBatch struct {
+	wondb.Batch
+	locked []*sync.Mutex
+}
+
+// newStoreBatch creates an empty batch on top of the database of the engine.
+func (c *Dpos) newStoreBatch() *storeBatch {
+	return &storeBatch{Batch: c.db.NewBatch()}
+}
+
+// lock acquires mu until the batch is written, unless already held.
+func (b *storeBatch) lock(mu *sync.Mutex) {
+	for _, held := range b.locked {
+		if held == mu {
+			return
+		}
+	}
+	mu.Lock()
+	b.locked = append(b.locked, mu)
+}
 
+// write flushes the accumulated changes into the database, if any, and
+// releases the indexes locked.
+func (b *storeBatch) write() error {
+	defer func() {
+		for _, mu := range b.locked {
+			mu.Unlock()
+		}
+		b.locked = nil
+	}()
+	if len(b.locked) == 0 {
+		return nil
 	}
+	return b.Write()
+}
 
-	//c.recents.Add(snap.Hash, snap)
+// storeSnapshot persists a checkpoint snapshot through the batch, deleting any
+// previously persisted ones that fell out of the retention window.
+func (c *Dpos) storeSnapshot(batch *storeBatch, snap *DposSnapshot) error {
+	batch.lock(&c.snapshotLock)
 
-	return snap, nil
+	var index []snapshotEntry
+	if ok, _ := c.db.Has(snapshotIndexKey); ok {
+		blob, err := c.db.Get(snapshotIndexKey)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(blob, &index); err != nil {
+			return err
+		}
+	}
+	retained := index[:0]
+	for _, entry := range index {
+		if entry.Hash == snap.Hash {
+			continue
+		}
+		if entry.Number+c.config.SnapshotRetention < snap.Number {
+			if err := batch.Delete(snapshotKey(entry.Number, entry.Hash)); err != nil {
+				return err
+			}
+			if err := batch.Delete(legacySnapshotKey(entry.Hash)); err != nil {
+				return err
+			}
+			continue
+		}
+		retained = append(retained, entry)
+	}
+	if err := snap.store(batch); err != nil {
+		return err
+	}
+	blob, err := json.Marshal(append(retained, snapshotEntry{snap.Number, snap.Hash}))
+	if err != nil {
+		return err
+	}
+	return batch.Put(snapshotIndexKey, blob)
 }
 
 // VerifyUncles implements consensus.Engine, always returning an error for any
@@ -419,37 +698,60 @@ func (c *Dpos) VerifyUncles(chain consensus.ChainReader, block *types.Block) err
 // VerifySeal implements consensus.Engine, checking whether the signature contained
 // in the header satisfies the consensus protocol requirements.
 func (c *Dpos) VerifySeal(chain consensus.ChainReader, header *types.Header) error {
-	return c.verifySeal(chain, header, nil)
+	batch := c.newStoreBatch()
+	err := c.verifySeal(chain, header, nil, batch)
+	if werr := batch.write(); err == nil {
+		err = werr
+	}
+	return err
 }
 
 // verifySeal checks whether the signature contained in the header satisfies the
 // consensus protocol requirements. The method accepts an optional list of parent
 // headers that aren't yet part of the local blockchain to generate the snapshots
-// from.
-func (c *Dpos) verifySeal(chain consensus.ChainReader, header *types.Header, parents []*types.Header) error {
+// from. Any snapshot checkpointed or evidence recorded is persisted through batch.
+func (c *Dpos) verifySeal(chain consensus.ChainReader, header *types.Header, parents []*types.Header, batch *storeBatch) error {
 	// Verifying the genesis block is not supported
 	number := header.Number.Uint64()
 	if number == 0 {
 		return errUnknownBlock
 	}
 	// Retrieve the snapshot needed to verify this header and cache it
-	snap, err := c.snapshot(chain, number-1, header.ParentHash, parents)
+	snap, err := c.batchSnapshot(chain, number-1, header.ParentHash, parents, batch)
 	if err != nil {
 		return err
 	}
 
-	// Resolve the authorization key and check against signers
-	signer, err := ecrecover(header, c.signatures)
+	// Resolve the authorization key to the producer it seals for and check it
+	// against the signers and the coinbase
+	sealer, err := ecrecover(header, c.signatures)
 	if err != nil {
 		return err
 	}
-	if _, ok := snap.Signers[signer]; !ok {
+	signer, ok := snap.producer(sealer, number)
+	if !ok {
 		return errUnauthorized
 	}
-
 	if signer != header.Coinbase {
 		return errUnauthorized
 	}
+	// Ensure the signer didn't already seal its share of the recent blocks and
+	// that the difficulty corresponds to the turn-ness of the signer, neither of
+	// which is enforced before the checkpoint fork
+	if c.checkpointing(chain, number) {
+		if snap.recentlySigned(number, signer) {
+			return errRecentlySigned
+		}
+		inturn := snap.inturn(header.Time.Uint64(), signer)
+		if inturn && header.Difficulty.Cmp(diffInTurn) != 0 {
+			return errInvalidDifficulty
+		}
+		if !inturn && header.Difficulty.Cmp(diffNoTurn) != 0 {
+			return errInvalidDifficulty
+		}
+	}
+	// The seal is valid, make sure the producer didn't seal another block too
+	c.detectDoubleSign(chain, batch, header, signer)
 
 	return nil
 }
@@ -459,7 +761,9 @@ func (c *Dpos) verifySeal(chain consensus.ChainReader, header *types.Header, par
 func (c *Dpos) Prepare(chain consensus.ChainReader, header *types.Header) error {
 	// If the block isn't a checkpoint, cast a random vote (good enough for now)
 
-	header.Coinbase = c.signer
+	c.lock.RLock()
+	header.Coinbase = c.producer
+	c.lock.RUnlock()
 
 	header.Nonce = types.BlockNonce{}
 
@@ -470,83 +774,262 @@ func (c *Dpos) Prepare(chain consensus.ChainReader, header *types.Header) error
 		return err
 	}
 
-	// Ensure the timestamp has the correct delay
+	// Stamp the block with the start of the slot it is due in, which Seal waits
+	// for if the local clock hasn't reached it yet
 	parent := chain.GetHeader(header.ParentHash, number-1)
 	if parent == nil {
 		return consensus.ErrUnknownAncestor
 	}
-	tnow := time.Now().Unix()
-
-	header.Time = new(big.Int).Add(parent.Time, new(big.Int).SetUint64(c.config.Period))
-	if header.Time.Int64() < tnow {
-		header.Time = big.NewInt(tnow)
-	}
+	header.Time = new(big.Int).SetUint64(c.slotTime(parent))
 
 	if _, authorized := snap.Signers[header.Coinbase]; !authorized {
 		return errUnauthorized
 	}
 
-	scheduledSigner := c.getScheduledProducer(header.Time, snap)
-
-	if scheduledSigner != header.Coinbase {
-		//	log.Debug("getScheduledProducer", "scheduledSigner", scheduledSigner.String(), "My", header.Coinbase.String())
+	// If we already sealed our share of the recent blocks, report it as such so
+	// that the worker retries on the next period
+	if snap.recentlySigned(number, header.Coinbase) {
 		return errInvalidDifficulty
 	}
 
-	// Ensure the extra data has all it's components
-	if len(header.Extra) < extraVanity {
-		header.Extra = append(header.Extra, bytes.Repeat([]byte{0x00}, extraVanity-len(header.Extra))...)
+	// Lay out the extra data with all it's components, checkpointing the elected
+	// producer list on epoch blocks, along with their signing keys if any
+	extra := &headerExtra{Version: extraVersion, Vanity: header.Extra}
+	if !c.checkpointing(chain, number) {
+		// Before the checkpoint fork every header carries the producer list, the
+		// elected one taking over on epoch blocks
+		extra.Signers = snap.signers()
+		if number%c.config.Epoch == 0 {
+			if statedb, err := chain.StateAt(parent.Root); err == nil && statedb != nil {
+				extra.Signers = c.checkpointSigners(chain, snap, statedb, header)
+			}
+		}
+	} else if number%c.config.Epoch == 0 {
+		extra.Signers = snap.schedule()
+		extra.Version, extra.Keys, extra.Previous = c.checkpointKeys(snap, extra.Signers, snap.signingKey)
+		if statedb, err := chain.StateAt(parent.Root); err == nil && statedb != nil {
+			extra.Signers = c.checkpointSigners(chain, snap, statedb, header)
+			extra.Version, extra.Keys, extra.Previous = c.checkpointKeys(snap, extra.Signers, stateSigningKey(statedb))
+		}
+	}
+	header.Extra = extra.encode()
+
+	// Mix digest is reserved for now, set to empty
+	header.MixDigest = common.Hash{}
+
+	if c.config.GasLimit != 0 && chain.Config().IsDposGasLimit(header.Number) {
+		header.GasLimit = c.calcGasLimit(parent)
 	}
-	header.Extra = header.Extra[:extraVanity]
 
-	signerChanged := false
-	signersParent := parent.Extra[extraVanity : len(parent.Extra)-extraSeal]
-	signersMe := make([]byte, 0)
-	if number > 1 {
-		state, err := chain.StateAt(parent.Root)
+	header.Difficulty = CalcDifficulty(snap, header.Time.Uint64(), header.Coinbase)
 
-		if err == nil && state != nil && (state.GetDposLastProducerScheduleUpdateTime().Int64()+60) < parent.Time.Int64() {
-			signersNew := state.GetProducerTopList()
-			if len(signersNew) > 0 {
+	header.Nonce = types.EncodeNonce(c.CalcNonce(snap, chain, header.Time.Uint64(), parent))
 
-				//sort it
-				for i := 0; i < len(signersNew); i++ {
-					for j := i + 1; j < len(signersNew); j++ {
-						if bytes.Compare(signersNew[i][:], signersNew[j][:]) > 0 {
-							signersNew[i], signersNew[j] = signersNew[j], signersNew[i]
-						}
-					}
-				}
+	return nil
+}
 
-				for _, signer := range signersNew {
-					signersMe = append(signersMe, signer[:]...)
-				}
+// calcGasLimit computes the gas limit of a child of parent under the configured
+// gas limit policy. Without voting it's the configured limit, otherwise producers
+// move the parent's limit towards the configured one as far as the bound divisor
+// allows.
+func (c *Dpos) calcGasLimit(parent *types.Header) uint64 {
+	target := c.config.GasLimit
+	if !c.config.GasLimitVoting {
+		return target
+	}
+	step := parent.GasLimit / params.GasLimitBoundDivisor
+	if step > 0 {
+		step--
+	}
+	switch {
+	case target > parent.GasLimit+step:
+		return parent.GasLimit + step
+	case target+step < parent.GasLimit:
+		return parent.GasLimit - step
+	}
+	return target
+}
 
-				if bytes.Compare(signersMe, signersParent) != 0 {
-					signerChanged = true
-					state.SetDposLastProducerScheduleUpdateTime(parent.Time)
-				}
-			}
+// verifyGasLimit checks the gas limit of header against the configured gas limit
+// policy: either the configured limit, or if voting is enabled, any limit within
+// the bound divisor of the parent's one.
+func (c *Dpos) verifyGasLimit(header, parent *types.Header) error {
+	if c.config.GasLimit == 0 {
+		return nil
+	}
+	if !c.config.GasLimitVoting {
+		if header.GasLimit != c.config.GasLimit {
+			return errInvalidGasLimit
 		}
+		return nil
+	}
+	diff := int64(parent.GasLimit) - int64(header.GasLimit)
+	if diff < 0 {
+		diff *= -1
+	}
+	if uint64(diff) >= parent.GasLimit/params.GasLimitBoundDivisor && diff != 0 {
+		return errInvalidGasLimit
+	}
+	if header.GasLimit < params.MinGasLimit {
+		return errInvalidGasLimit
 	}
+	return nil
+}
 
-	if !signerChanged {
-		header.Extra = append(header.Extra, signersParent[:]...)
-	} else {
-		header.Extra = append(header.Extra, signersMe[:]...)
+// electedSigners retrieves the sorted list of top producers elected by the
+// staking votes committed in the given state, for the block number. The election
+// may update the state, so callers need to pass a copy if it is to be reused.
+func electedSigners(statedb *state.StateDB, config *params.ChainConfig, number *big.Int) []common.Address {
+	signers := statedb.GetProducerTopList(number, config)
+	sort.Slice(signers, func(i, j int) bool {
+		return bytes.Compare(signers[i][:], signers[j][:]) < 0
+	})
+	return signers
+}
+
+// checkpointSigners computes the producer list an epoch block needs to carry on
+// top of the given parent snapshot and state: the elected producers, or the
+// current signers if no producers are elected yet. If region shuffling is on,
+// the elected producers are ordered by shuffleSchedule, seeded with the hash of
+// the parent of the epoch block. The outcome is cached by that hash along with
+// the root of the state, the snapshot being the one of the parent.
+func (c *Dpos) checkpointSigners(chain consensus.ChainReader, snap *DposSnapshot, parent *state.StateDB, header *types.Header) []common.Address {
+	statedb := parent.Copy()
+	key := electionKey{parent: header.ParentHash, root: statedb.IntermediateRoot(false)}
+
+	if cached, ok := c.elections.Get(key); ok {
+		return append([]common.Address(nil), cached.([]common.Address)...)
 	}
+	elected := c.electCheckpointSigners(chain, snap, parent, statedb, header)
+	c.elections.Add(key, elected)
 
-	header.Extra = append(header.Extra, make([]byte, extraSeal)...)
+	return append([]common.Address(nil), elected...)
+}
 
-	// Mix digest is reserved for now, set to empty
-	header.MixDigest = common.Hash{}
+// electionKey identifies an election cached by checkpointSigners.
+type electionKey struct {
+	parent common.Hash // Hash of the parent of the epoch block
+	root   common.Hash // Root of the state the election ran in
+}
+
+// electCheckpointSigners runs the election behind checkpointSigners in statedb,
+// a copy of the parent state.
+func (c *Dpos) electCheckpointSigners(chain consensus.ChainReader, snap *DposSnapshot, parent, statedb *state.StateDB, header *types.Header) []common.Address {
+	elected := electedSigners(statedb, chain.Config(), header.Number)
+	if len(elected) == 0 {
+		return snap.schedule()
+	}
+	if c.config.RegionShuffle {
+		locations := make(map[common.Address]common.ProducerLocation)
+		for _, producer := range elected {
+			if info := parent.GetProducerInfo(&producer); info != nil {
+				locations[producer] = info.Location
+			}
+		}
+		elected = shuffleSchedule(elected, locations, header.ParentHash)
+	}
+	return elected
+}
 
-	header.Difficulty = c.CalcDifficultyInternal(snap, chain, header.Time.Uint64(), parent) //CalcDifficulty(snap,c.signer);
+// checkpointSigningKeys looks up the signing keys of the producers of a checkpoint
+// with key, returning nil if all of them seal with their own key.
+func checkpointSigningKeys(signers []common.Address, key func(common.Address) common.Address) []common.Address {
+	keys := make([]common.Address, len(signers))
+	delegated := false
+	for i, signer := range signers {
+		keys[i] = key(signer)
+		delegated = delegated || keys[i] != signer
+	}
+	if !delegated {
+		return nil
+	}
+	return keys
+}
 
-	header.Nonce = types.EncodeNonce(c.CalcNonce(snap, chain, header.Time.Uint64(), parent))
+// checkpointKeys lays out the signing keys of the producers of a checkpoint, as
+// looked up with key, along with the keys they sealed with in the snapshot of its
+// parent if rotated and the chain has a grace window for them. The layout version
+// returned is the first one carrying them all.
+func (c *Dpos) checkpointKeys(snap *DposSnapshot, signers []common.Address, key func(common.Address) common.Address) (version byte, keys []common.Address, previous []common.Address) {
+	keys = checkpointSigningKeys(signers, key)
+	if c.config.KeyRotationGrace > 0 {
+		rotated := false
+		previous = make([]common.Address, len(signers))
+		for i, signer := range signers {
+			previous[i] = key(signer)
+			if _, ok := snap.Signers[signer]; ok {
+				previous[i] = snap.signingKey(signer)
+			}
+			rotated = rotated || previous[i] != key(signer)
+		}
+		if rotated {
+			if keys == nil {
+				keys = append([]common.Address{}, signers...)
+			}
+			return extraVersion2, keys, previous
+		}
+	}
+	if keys != nil {
+		return extraVersion1, keys, nil
+	}
+	return extraVersion, nil, nil
+}
+
+// stateSigningKey returns a lookup of the signing keys of the producers registered
+// in the given state.
+func stateSigningKey(statedb *state.StateDB) func(common.Address) common.Address {
+	return func(producer common.Address) common.Address {
+		if key := statedb.GetProducerSigningKey(&producer); key != (common.Address{}) {
+			return key
+		}
+		return producer
+	}
+}
 
+// verifyCheckpoint checks that the producer list and signing keys checkpointed
+// in an epoch header are the ones elected in the state of its parent, and that
+// the signing keys they replace are the ones of the snapshot of its parent.
+func (c *Dpos) verifyCheckpoint(chain consensus.ChainReader, snap *DposSnapshot, parent *state.StateDB, header *types.Header) error {
+	signers, keys, previous := extractCheckpoint(header)
+	elected := c.checkpointSigners(chain, snap, parent, header)
+	if !signersEqual(signers, elected) {
+		return errInvalidCheckpointSigners
+	}
+	_, wantKeys, wantPrevious := c.checkpointKeys(snap, elected, stateSigningKey(parent))
+	if !signersEqual(keys, wantKeys) || !signersEqual(previous, wantPrevious) {
+		return errInvalidCheckpointSigners
+	}
 	return nil
 }
+
+// signersEqual reports whether two signer lists are identical, order included.
+func signersEqual(a, b []common.Address) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// VerifyElection implements consensus.ElectionVerifier, checking that the
+// producer list checkpointed in an epoch header, along with their signing keys,
+// is the one elected in the state of its parent.
+func (c *Dpos) VerifyElection(chain consensus.ChainReader, header *types.Header, parent *state.StateDB) error {
+	number := header.Number.Uint64()
+	if number == 0 || number%c.config.Epoch != 0 || !c.checkpointing(chain, number) {
+		return nil
+	}
+	snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
+	if err != nil {
+		return err
+	}
+	return c.verifyCheckpoint(chain, snap, parent, header)
+}
+
 func (c *Dpos) CalcNonce(snap *DposSnapshot, chain consensus.ChainReader, time uint64, parent *types.Header) uint64 {
 
 	//use as last irreversible block using bft, 从最新的块开始，直到最近一个lib, 如果在到达cclib之前的话，就更新，否则使用原来了的
@@ -597,8 +1080,16 @@ func (c *Dpos) CalcNonce(snap *DposSnapshot, chain consensus.ChainReader, time u
 }
 
 // Finalize implements consensus.Engine, ensuring no uncles are set, nor block
-// rewards given, and returns the final block.
+// rewards given, paying out the matured refunds of the voters that opted in from
+// the auto refund fork on, and returns the final block. The logs of the payouts
+// belong to no transaction.
 func (c *Dpos) Finalize(chain consensus.ChainReader, header *types.Header, state *state.StateDB, txs []*types.Transaction, uncles []*types.Header, receipts []*types.Receipt) (*types.Block, error) {
+	if chain.Config().IsDposAutoRefund(header.Number) {
+		// The block hash isn't known before sealing, the importer and the miner
+		// stamp it on the logs of the payouts once it is
+		state.Prepare(common.Hash{}, common.Hash{}, len(txs))
+		vm.DposPayoutRefunds(state, chain.Config(), header)
+	}
 
 	// No block rewards in PoA, so the state remains as is and uncles are dropped
 	header.Root = state.IntermediateRoot(true /*chain.Config().IsEIP158(header.Number)*/)
@@ -608,24 +1099,83 @@ func (c *Dpos) Finalize(chain consensus.ChainReader, header *types.Header, state
 	return types.NewBlock(header, txs, nil, receipts), nil
 }
 
+// Epoch returns the number of blocks between two producer list checkpoints.
+func (c *Dpos) Epoch() uint64 {
+	return c.config.Epoch
+}
+
+// Reorged drops the snapshot of a block moved off the canonical chain by a reorg,
+// along with the election cached on top of it. The caches are keyed by hash, so
+// they never mix branches up, but an election that differs between two branches
+// is redone from the state of the branch when it becomes canonical again.
+func (c *Dpos) Reorged(hash common.Hash) {
+	c.recents.Remove(hash)
+	for _, key := range c.elections.Keys() {
+		if key.(electionKey).parent == hash {
+			c.elections.Remove(key)
+		}
+	}
+}
+
 // Authorize injects a private key into the consensus engine to mint new blocks
-// with.
+// with, resuming sealing after any previous graceful stop.
 func (c *Dpos) Authorize(signer common.Address, signFn SignerFn) {
+	c.AuthorizeSealer(signer, signer, signFn)
+}
+
+// AuthorizeSealer injects the signing key of a producer into the consensus engine
+// to mint new blocks of the producer with, resuming sealing after any previous
+// graceful stop. The key needs to be the one registered for the producer as of
+// the last producer list checkpoint, or the producer itself if none.
+func (c *Dpos) AuthorizeSealer(producer common.Address, signer common.Address, signFn SignerFn) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 
+	c.producer = producer
 	c.signer = signer
 	c.signFn = signFn
+	c.stopping, c.stopped = make(chan struct{}), make(chan struct{})
 }
 
-func (c *Dpos) getScheduledProducer(ht *big.Int, snap *DposSnapshot) common.Address {
-	signers := snap.signers()
-	if len(signers) == 0 {
-		return common.Address{}
+// StopSealingGracefully makes the engine keep sealing the blocks of the current
+// turn of the signer, but abort and refuse any block out of its turn. The returned
+// channel is closed once the turn passed, after which sealing can be stopped
+// without the signer missing any of its slots.
+func (c *Dpos) StopSealingGracefully() <-chan struct{} {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	select {
+	case <-c.stopping:
+	default:
+		close(c.stopping)
 	}
-	index := ht.Uint64() % (uint64(len(signers)) * c.config.ProducerRepetions)
-	index /= c.config.ProducerRepetions
-	return signers[index]
+	return c.stopped
+}
+
+// endTurn signals the end of the turn of the signer to a graceful stop, unless
+// the signer was authorized anew since stopped was retrieved.
+func (c *Dpos) endTurn(stopped chan struct{}) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	if stopped == c.stopped {
+		select {
+		case <-stopped:
+		default:
+			close(stopped)
+		}
+	}
+}
+
+// Signers retrieves the producers scheduled to seal the blocks following header,
+// sorted in ascending address order.
+func (c *Dpos) Signers(chain consensus.ChainReader, header *types.Header) ([]common.Address, error) {
+	snap, err := c.snapshot(chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		return nil, err
+	}
+	return snap.signers(), nil
 }
 
 // Seal implements consensus.Engine, attempting to create a sealed block using
@@ -638,40 +1188,75 @@ func (c *Dpos) Seal(chain consensus.ChainReader, block *types.Block, stop <-chan
 	if number == 0 {
 		return nil, errUnknownBlock
 	}
+	// Refuse to sign extra data not laid out by Prepare
+	if c.checkpointing(chain, number) {
+		if _, err := parseExtra(header.Extra, number%c.config.Epoch == 0); err != nil {
+			return nil, err
+		}
+	} else if err := verifyLegacyExtra(header.Extra); err != nil {
+		return nil, err
+	}
 
 	// Don't hold the signer fields for the entire sealing procedure
 	c.lock.RLock()
-	signer, signFn := c.signer, c.signFn
+	signer, sealer, signFn, stopping, stopped := c.producer, c.signer, c.signFn, c.stopping, c.stopped
 	c.lock.RUnlock()
 
 	snap, err := c.snapshot(chain, number-1, header.ParentHash, nil)
 	if err != nil {
 		return nil, err
 	}
-
-	scheduledSigner := c.getScheduledProducer(header.Time, snap)
-
-	if scheduledSigner != signer {
-		return nil, errInvalidDifficulty
+	// The key needs to be the one sealing for the producer as of the snapshot, or
+	// the one it replaced during the grace window
+	if _, authorized := snap.Signers[signer]; !authorized {
+		return nil, errUnauthorized
+	}
+	if producer, ok := snap.producer(sealer, number); !ok || producer != signer {
+		return nil, errUnauthorized
+	}
+	// If we're amongst the recent signers, wait for the others to take their turn
+	if snap.recentlySigned(number, signer) {
+		log.Info("Signed recently, must wait for others")
+		select {
+		case <-stop:
+		case <-stopping:
+			c.endTurn(stopped)
+		}
+		return nil, nil
 	}
 
-	tn := time.Now()
-	hst := time.Unix(header.Time.Int64(), 0)
+	// Sweet, the protocol permits us to sign the block, wait for our slot
+	slot, scheduled, deadline := snap.slotAt(header.Time.Uint64())
+	inturn := scheduled == signer
 
-	//log.Debug("cale time wait:", "tn",tn.Unix(), "hst",hst.Unix())
-	// Sweet, the protocol permits us to sign the block, wait for our time
-	delay := hst.Sub(tn) // nolint: gosimple
+	delay := time.Unix(header.Time.Int64(), 0).Sub(c.clock.Now()) // nolint: gosimple
+	if inturn && c.clock.Now().Unix() >= int64(deadline) {
+		log.Warn("Sealing past the end of the slot", "slot", slot, "deadline", deadline, "signer", signer)
+	}
+	if !inturn {
+		// It's not our turn explicitly to sign, delay it a bit
+		wiggle := time.Duration(len(snap.Signers)/2+1) * wiggleTime
+		delay += time.Duration(rand.Int63n(int64(wiggle)))
 
+		log.Trace("Out-of-turn signing requested", "wiggle", common.PrettyDuration(wiggle))
+	} else {
+		// Our slots are sealed whether stopping gracefully or not
+		stopping = nil
+	}
 	log.Debug("Waiting for slot to sign and propagate", "delay", common.PrettyDuration(delay), "signer", signer)
 
 	select {
 	case <-stop:
 		return nil, nil
-	case <-time.After(delay):
+	case <-stopping:
+		log.Info("Turn over, stopped sealing", "signer", signer)
+		c.endTurn(stopped)
+		return nil, nil
+	case <-c.clock.After(delay):
 	}
 
 	// Sign all the things!
-	sighash, err := signFn(accounts.Account{Address: signer}, sigHash(header).Bytes())
+	sighash, err := signFn(accounts.Account{Address: sealer}, sigHash(header).Bytes())
 	if err != nil {
 		return nil, err
 	}
@@ -688,60 +1273,21 @@ func (c *Dpos) CalcDifficulty(chain consensus.ChainReader, time uint64, parent *
 	if err != nil {
 		return nil
 	}
-	return c.CalcDifficultyInternal(snap, chain, time, parent)
+	c.lock.RLock()
+	signer := c.producer
+	c.lock.RUnlock()
 
-	//return CalcDifficulty(snap, c.signer)
+	return CalcDifficulty(snap, time, signer)
 }
 
 // CalcDifficulty is the difficulty adjustment algorithm. It returns the difficulty
-// that a new block should have based on the previous blocks in the chain and the
-// current signer.
-func (c *Dpos) CalcDifficultyInternal(snap *DposSnapshot, chain consensus.ChainReader, time uint64, parent *types.Header) *big.Int {
-
-	if parent.Coinbase == c.signer || parent.Number.Uint64() == 1 || parent.Number.Uint64() == 0 {
-		//if we are in continual producing confirm parent.
-		return common.Big1
+// that a new block sealed at the given time should have based on the producer
+// schedule and the current signer.
+func CalcDifficulty(snap *DposSnapshot, time uint64, signer common.Address) *big.Int {
+	if snap.inturn(time, signer) {
+		return new(big.Int).Set(diffInTurn)
 	}
-
-	signerLen := len(snap.Signers)
-	signhistory := make(map[common.Address]bool)
-	signhistory[parent.Coinbase] = true
-
-	confirm := 1
-	num := parent.Number.Uint64() - 1
-	hash := parent.ParentHash
-
-	cclib := parent.Nonce.Uint64()
-
-	for true {
-
-		if num < 1 {
-			break
-		}
-
-		confirm = confirm + 1
-		pp := chain.GetHeader(hash, num)
-		if pp.Coinbase == c.signer {
-			break
-		}
-
-		if num <= cclib {
-			break
-		}
-
-		signhistory[pp.Coinbase] = true
-
-		cclen := len(signhistory)
-
-		if (signerLen <= 3 && cclen > signerLen/2) || (signerLen > 3 && cclen > signerLen*2/3) {
-			break
-		}
-
-		num = num - 1
-		hash = pp.ParentHash
-	}
-
-	return big.NewInt(int64(confirm))
+	return new(big.Int).Set(diffNoTurn)
 }
 
 // APIs implements consensus.Engine, returning the user facing RPC API to allow
@@ -0,0 +1,712 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-ethereum library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package dpos
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"errors"
+	"math/big"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/worldopennetwork/go-won/accounts"
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/consensus"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// testerAccountPool is a pool to maintain currently active tester accounts,
+// mapped from textual names used in the tests below to actual WorldOpenNetwork private
+// keys capable of signing transactions.
+type testerAccountPool struct {
+	accounts map[string]*ecdsa.PrivateKey
+}
+
+func newTesterAccountPool() *testerAccountPool {
+	return &testerAccountPool{
+		accounts: make(map[string]*ecdsa.PrivateKey),
+	}
+}
+
+func (ap *testerAccountPool) sign(header *types.Header, signer string) {
+	// Ensure we have a persistent key for the signer
+	if ap.accounts[signer] == nil {
+		ap.accounts[signer], _ = crypto.GenerateKey()
+	}
+	// Sign the header and embed the signature in extra data
+	sig, _ := crypto.Sign(sigHash(header).Bytes(), ap.accounts[signer])
+	copy(header.Extra[len(header.Extra)-extraSeal:], sig)
+}
+
+func (ap *testerAccountPool) address(account string) common.Address {
+	// Ensure we have a persistent key for the account
+	if ap.accounts[account] == nil {
+		ap.accounts[account], _ = crypto.GenerateKey()
+	}
+	// Resolve and return the WorldOpenNetwork address
+	return crypto.PubkeyToAddress(ap.accounts[account].PublicKey)
+}
+
+// seal sets the difficulty of the header according to the signer's turn in the
+// snapshot of its parent and signs it with the named account.
+func (ap *testerAccountPool) seal(engine *Dpos, chain consensus.ChainReader, header *types.Header, signer string) {
+	if snap, err := engine.snapshot(chain, header.Number.Uint64()-1, header.ParentHash, nil); err == nil {
+		header.Difficulty = CalcDifficulty(snap, header.Time.Uint64(), ap.address(signer))
+	}
+	ap.sign(header, signer)
+}
+
+// signers resolves the named accounts into a sorted list of addresses.
+func (ap *testerAccountPool) signers(accounts ...string) []common.Address {
+	signers := make([]common.Address, len(accounts))
+	for i, account := range accounts {
+		signers[i] = ap.address(account)
+	}
+	sort.Slice(signers, func(i, j int) bool {
+		return bytes.Compare(signers[i][:], signers[j][:]) < 0
+	})
+	return signers
+}
+
+// signFn returns a signer callback authorizing hashes with the named account.
+func (ap *testerAccountPool) signFn(signer string) SignerFn {
+	key := ap.accounts[signer]
+	return func(account accounts.Account, hash []byte) ([]byte, error) {
+		return crypto.Sign(hash, key)
+	}
+}
+
+// testerClock is a sealClock frozen at a given time, reporting the requested
+// delays and firing them only when told to.
+type testerClock struct {
+	now    time.Time
+	delays chan time.Duration
+	fire   chan time.Time
+}
+
+func newTesterClock(now time.Time) *testerClock {
+	return &testerClock{now: now, delays: make(chan time.Duration, 1), fire: make(chan time.Time, 1)}
+}
+
+func (c *testerClock) Now() time.Time { return c.now }
+
+func (c *testerClock) After(d time.Duration) <-chan time.Time {
+	c.delays <- d
+	return c.fire
+}
+
+// testerChain implements consensus.ChainReader on top of a simple in-memory
+// header store, allowing the engine to be exercised without a full blockchain.
+type testerChain struct {
+	config  *params.ChainConfig
+	headers map[common.Hash]*types.Header
+	canon   []*types.Header
+	states  map[common.Hash]*state.StateDB
+}
+
+func newTesterChain(config *params.DposConfig, genesis *types.Header) *testerChain {
+	chain := &testerChain{
+		config:  &params.ChainConfig{ChainId: big.NewInt(1), DposCheckpointBlock: big.NewInt(0), DposSlotAlignmentBlock: big.NewInt(0), Dpos: config},
+		headers: make(map[common.Hash]*types.Header),
+		states:  make(map[common.Hash]*state.StateDB),
+	}
+	chain.insert(genesis)
+	return chain
+}
+
+// insert adds a header to the store, making it canonical if it extends the
+// current head.
+func (c *testerChain) insert(header *types.Header) {
+	c.headers[header.Hash()] = header
+	if number := header.Number.Uint64(); number == uint64(len(c.canon)) {
+		c.canon = append(c.canon, header)
+	}
+}
+
+func (c *testerChain) Config() *params.ChainConfig  { return c.config }
+func (c *testerChain) CurrentHeader() *types.Header { return c.canon[len(c.canon)-1] }
+
+func (c *testerChain) GetHeader(hash common.Hash, number uint64) *types.Header {
+	if header := c.headers[hash]; header != nil && header.Number.Uint64() == number {
+		return header
+	}
+	return nil
+}
+
+func (c *testerChain) GetHeaderByNumber(number uint64) *types.Header {
+	if number < uint64(len(c.canon)) {
+		return c.canon[number]
+	}
+	return nil
+}
+
+func (c *testerChain) GetHeaderByHash(hash common.Hash) *types.Header { return c.headers[hash] }
+func (c *testerChain) GetBlock(common.Hash, uint64) *types.Block      { panic("not supported") }
+func (c *testerChain) State() (*state.StateDB, error)                 { return c.StateAt(c.CurrentHeader().Root) }
+
+func (c *testerChain) StateAt(root common.Hash) (*state.StateDB, error) {
+	if statedb, ok := c.states[root]; ok {
+		return statedb.Copy(), nil
+	}
+	return nil, errors.New("state not available")
+}
+
+// testerExtra assembles a header extra-data field carrying the given signer
+// list between the vanity prefix and the (empty) seal suffix.
+func testerExtra(signers []common.Address) []byte {
+	extra := make([]byte, extraVanity)
+	for _, signer := range signers {
+		extra = append(extra, signer[:]...)
+	}
+	return append(extra, make([]byte, extraSeal)...)
+}
+
+// newTesterGenesis creates a genesis header authorizing the given signers,
+// backdated far enough that every block built on top is in the past.
+func newTesterGenesis(signers []common.Address) *types.Header {
+	return &types.Header{
+		Number:     common.Big0,
+		Time:       big.NewInt(time.Now().Add(-24 * time.Hour).Unix()),
+		Difficulty: common.Big1,
+		Extra:      testerExtra(signers),
+		UncleHash:  uncleHash,
+	}
+}
+
+// newTesterHeader creates an unsigned child of parent carrying the given signer
+// list (nil for non-epoch blocks), timestamped the configured period after its
+// parent.
+func newTesterHeader(config *params.DposConfig, parent *types.Header, coinbase common.Address, signers []common.Address) *types.Header {
+	return &types.Header{
+		ParentHash: parent.Hash(),
+		Number:     new(big.Int).Add(parent.Number, common.Big1),
+		Time:       new(big.Int).Add(parent.Time, new(big.Int).SetUint64(config.Period)),
+		Coinbase:   coinbase,
+		Difficulty: common.Big1,
+		Extra:      testerExtra(signers),
+		UncleHash:  uncleHash,
+	}
+}
+
+// newTesterDatabase creates a fresh in-memory database.
+func newTesterDatabase() wondb.Database {
+	db, _ := wondb.NewMemDatabase()
+	return db
+}
+
+// newTesterEngine creates a dpos engine backed by a fresh in-memory database.
+func newTesterEngine(config *params.DposConfig) *Dpos {
+	return New(config, newTesterDatabase())
+}
+
+// Tests that headers sealed out-of-turn are rejected unless marked with the
+// out-of-turn difficulty, and vice versa, from the checkpoint fork on.
+func TestVerifyDifficulty(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(accounts.signers("A", "B")))
+	snap, _ := engine.snapshot(chain, 0, chain.CurrentHeader().Hash(), nil)
+
+	for _, name := range []string{"A", "B"} {
+		header := newTesterHeader(config, chain.CurrentHeader(), accounts.address(name), nil)
+		inturn := snap.inturn(header.Time.Uint64(), accounts.address(name))
+
+		for _, diff := range []*big.Int{diffInTurn, diffNoTurn, big.NewInt(3)} {
+			header.Difficulty = diff
+			accounts.sign(header, name)
+
+			err := engine.VerifyHeader(chain, header, true)
+			if valid := (inturn && diff == diffInTurn) || (!inturn && diff == diffNoTurn); valid && err != nil {
+				t.Errorf("signer %s, inturn %v, difficulty %v: failed to verify header: %v", name, inturn, diff, err)
+			} else if !valid && err != errInvalidDifficulty {
+				t.Errorf("signer %s, inturn %v, difficulty %v: error mismatch: have %v, want %v", name, inturn, diff, err, errInvalidDifficulty)
+			}
+		}
+	}
+	// Before the checkpoint fork any difficulty is accepted
+	chain.config.DposCheckpointBlock = big.NewInt(2)
+	for _, name := range []string{"A", "B"} {
+		header := newTesterHeader(config, chain.CurrentHeader(), accounts.address(name), accounts.signers("A", "B"))
+		header.Difficulty = big.NewInt(3)
+		accounts.sign(header, name)
+
+		if err := engine.VerifyHeader(chain, header, true); err != nil {
+			t.Errorf("signer %s: failed to verify legacy header: %v", name, err)
+		}
+	}
+}
+
+// Tests that headers are only accepted if stamped with the start of a slot after
+// their parent, exactly a block period after it or later if slots were skipped,
+// and no further ahead of the local clock than the tolerated skew. Alignment is
+// only enforced from the slot alignment fork on.
+func TestVerifyTimestamp(t *testing.T) {
+	config := &params.DposConfig{Period: 3, Epoch: 30000, ProducerRepetions: 1, ClockSkew: 2}
+	accounts := newTesterAccountPool()
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(accounts.signers("A", "B")))
+
+	genesis := chain.CurrentHeader().Time.Uint64()
+	engine.clock = newTesterClock(time.Unix(int64(genesis+10), 0))
+
+	tests := []struct {
+		offset uint64 // Timestamp of the header after the genesis
+		err    error
+	}{
+		{0, ErrInvalidTimestamp},     // same slot as the parent
+		{2, ErrInvalidTimestamp},     // early
+		{3, nil},                     // exact
+		{4, errMisalignedTimestamp},  // within the slot
+		{9, nil},                     // skipped slots
+		{11, errMisalignedTimestamp}, // within a skipped slot
+		{12, nil},                    // ahead within the skew
+		{15, consensus.ErrFutureBlock},
+	}
+	for _, tt := range tests {
+		header := newTesterHeader(config, chain.CurrentHeader(), accounts.address("A"), nil)
+		header.Time = new(big.Int).SetUint64(genesis + tt.offset)
+		accounts.seal(engine, chain, header, "A")
+
+		if err := engine.VerifyHeader(chain, header, true); err != tt.err {
+			t.Errorf("offset %d: error mismatch: have %v, want %v", tt.offset, err, tt.err)
+		}
+	}
+	// Before the slot alignment fork timestamps may fall within a slot
+	chain.config.DposSlotAlignmentBlock = big.NewInt(2)
+	for _, offset := range []uint64{4, 11} {
+		header := newTesterHeader(config, chain.CurrentHeader(), accounts.address("A"), nil)
+		header.Time = new(big.Int).SetUint64(genesis + offset)
+		accounts.seal(engine, chain, header, "A")
+
+		if err := engine.VerifyHeader(chain, header, true); err != nil {
+			t.Errorf("offset %d: failed to verify unaligned header before the fork: %v", offset, err)
+		}
+	}
+}
+
+// Tests that Prepare stamps blocks with the slot they are due in as of the local
+// clock, skipped slots handing the turn over to the producers scheduled in them.
+func TestPrepareSkippedSlots(t *testing.T) {
+	config := &params.DposConfig{Period: 3, Epoch: 30000, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+	signers := accounts.signers("A", "B", "C")
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(signers))
+	parent := chain.CurrentHeader()
+
+	snap, err := engine.snapshot(chain, 0, parent.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	name := func(producer common.Address) string {
+		for _, name := range []string{"A", "B", "C"} {
+			if accounts.address(name) == producer {
+				return name
+			}
+		}
+		return ""
+	}
+	for skipped := uint64(0); skipped < 4; skipped++ {
+		// Let the clock run into the slot, if not at its very start
+		due := parent.Time.Uint64() + (skipped+1)*config.Period
+		for _, now := range []uint64{due, due + config.Period - 1} {
+			engine.clock = newTesterClock(time.Unix(int64(now), 0))
+
+			expected := snap.scheduled(due)
+			if want := snap.schedule()[(slotOf(config, parent.Time.Uint64())+skipped+1)%uint64(len(signers))]; expected != want {
+				t.Fatalf("skipped %d: scheduled producer mismatch: have %x, want %x", skipped, expected, want)
+			}
+			engine.Authorize(expected, accounts.signFn(name(expected)))
+
+			header := &types.Header{ParentHash: parent.Hash(), Number: big.NewInt(1), UncleHash: uncleHash}
+			if err := engine.Prepare(chain, header); err != nil {
+				t.Fatalf("skipped %d, clock %d: failed to prepare header: %v", skipped, now, err)
+			}
+			if header.Time.Uint64() != due {
+				t.Errorf("skipped %d, clock %d: timestamp mismatch: have %d, want %d", skipped, now, header.Time, due)
+			}
+			if header.Difficulty.Cmp(diffInTurn) != 0 {
+				t.Errorf("skipped %d, clock %d: scheduled producer not in turn", skipped, now)
+			}
+			accounts.sign(header, name(expected))
+			if err := engine.VerifyHeader(chain, header, true); err != nil {
+				t.Errorf("skipped %d, clock %d: failed to verify header: %v", skipped, now, err)
+			}
+		}
+	}
+}
+
+// Tests that headers are rejected unless their gas limit follows the configured
+// gas limit policy, either fixed or voted within the bound divisor, from the gas
+// limit fork on.
+func TestVerifyGasLimit(t *testing.T) {
+	accounts := newTesterAccountPool()
+	parentLimit := uint64(4000000)
+	bound := parentLimit / params.GasLimitBoundDivisor
+
+	tests := []struct {
+		voting bool
+		limit  uint64
+		fork   int64
+		valid  bool
+	}{
+		{false, 8000000, 1, true},
+		{false, 8000001, 1, false},
+		{false, parentLimit, 1, false},
+		{true, parentLimit, 1, true},
+		{true, parentLimit + bound - 1, 1, true},
+		{true, parentLimit + bound, 1, false},
+		{true, parentLimit - bound + 1, 1, true},
+		{true, parentLimit - bound, 1, false},
+		{true, 8000000, 1, false},
+		{false, 8000001, 2, true},
+		{true, 8000000, 2, true},
+	}
+	for i, tt := range tests {
+		config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: 1, GasLimit: 8000000, GasLimitVoting: tt.voting}
+		engine := newTesterEngine(config)
+
+		genesis := newTesterGenesis(accounts.signers("A"))
+		genesis.GasLimit = parentLimit
+		chain := newTesterChain(config, genesis)
+		chain.config.DposGasLimitBlock = big.NewInt(tt.fork)
+		snap, _ := engine.snapshot(chain, 0, genesis.Hash(), nil)
+
+		header := newTesterHeader(config, genesis, accounts.address("A"), nil)
+		header.Difficulty = CalcDifficulty(snap, header.Time.Uint64(), header.Coinbase)
+		header.GasLimit = tt.limit
+		accounts.sign(header, "A")
+
+		err := engine.VerifyHeader(chain, header, true)
+		if tt.valid && err != nil {
+			t.Errorf("test %d: failed to verify header: %v", i, err)
+		} else if !tt.valid && err != errInvalidGasLimit {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, errInvalidGasLimit)
+		}
+		// Producers propose a gas limit conforming to the policy
+		want := config.GasLimit
+		if tt.voting {
+			want = parentLimit + bound - 1
+		}
+		if have := engine.calcGasLimit(genesis); have != want {
+			t.Errorf("test %d: proposed gas limit mismatch: have %d, want %d", i, have, want)
+		}
+	}
+}
+
+// Tests that total difficulty based fork choice prefers a shorter chain sealed
+// in-turn over a longer one sealed out-of-turn by a minority producer.
+func TestReorgPrefersInturn(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+	signers := accounts.signers("A", "B", "C")
+
+	genesis := &core.Genesis{
+		Config:     &params.ChainConfig{ChainId: big.NewInt(1), DposCheckpointBlock: big.NewInt(0), DposSlotAlignmentBlock: big.NewInt(0), Dpos: config},
+		Timestamp:  uint64(time.Now().Add(-time.Hour).Unix()),
+		ExtraData:  testerExtra(signers),
+		GasLimit:   params.GenesisGasLimit,
+		Difficulty: common.Big1,
+	}
+	db := newTesterDatabase()
+	genesis.MustCommit(db)
+
+	engine := New(config, db)
+	chain, err := core.NewBlockChain(db, nil, genesis.Config, engine, vm.Config{})
+	if err != nil {
+		t.Fatalf("failed to create blockchain: %v", err)
+	}
+	defer chain.Stop()
+
+	// makeBranch extends the genesis block with headers sealed by the given
+	// producers in rotation, delaying each until the producer's turn-ness matches
+	makeBranch := func(n int, names []string, inturn bool) []*types.Header {
+		headers := make([]*types.Header, n)
+		parent := chain.Genesis().Header()
+		snap, _ := engine.snapshot(chain, 0, parent.Hash(), nil)
+		for i := range headers {
+			name := names[i%len(names)]
+
+			header := newTesterHeader(config, parent, accounts.address(name), nil)
+			header.Root = parent.Root
+			header.GasLimit = parent.GasLimit
+			for snap.inturn(header.Time.Uint64(), header.Coinbase) != inturn {
+				header.Time.Add(header.Time, common.Big1)
+			}
+			header.Difficulty = CalcDifficulty(snap, header.Time.Uint64(), header.Coinbase)
+			accounts.sign(header, name)
+
+			headers[i], parent = header, header
+		}
+		return headers
+	}
+	// The minority branch is sealed out-of-turn, the honest one in-turn
+	minority := makeBranch(4, []string{"A", "B"}, false)
+	honest := makeBranch(3, []string{"A", "B", "C"}, true)
+
+	if _, err := chain.InsertHeaderChain(minority, 1); err != nil {
+		t.Fatalf("failed to insert minority branch: %v", err)
+	}
+	if head := chain.CurrentHeader(); head.Hash() != minority[len(minority)-1].Hash() {
+		t.Fatalf("minority branch not imported as head: have #%d [%x]", head.Number, head.Hash())
+	}
+	if _, err := chain.InsertHeaderChain(honest, 1); err != nil {
+		t.Fatalf("failed to insert honest branch: %v", err)
+	}
+	if head := chain.CurrentHeader(); head.Hash() != honest[len(honest)-1].Hash() {
+		t.Fatalf("in-turn branch not chosen: have #%d [%x], want #%d [%x]", head.Number, head.Hash(), len(honest), honest[len(honest)-1].Hash())
+	}
+}
+
+// Tests that in-turn producers seal right at their slot, while out-of-turn ones
+// wait for a random wiggle proportional to the number of producers, and that a
+// pending seal can be aborted.
+func TestSealWiggle(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+	signers := accounts.signers("A", "B", "C", "D")
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(signers))
+	snap, _ := engine.snapshot(chain, 0, chain.CurrentHeader().Hash(), nil)
+
+	header := newTesterHeader(config, chain.CurrentHeader(), common.Address{}, nil)
+	slot := time.Unix(header.Time.Int64(), 0)
+
+	// seal runs the sealer as the named producer, returning the requested delay
+	// and a channel delivering the result once the delay fires
+	seal := func(name string, stop chan struct{}) (time.Duration, chan *types.Block) {
+		clock := newTesterClock(slot)
+		engine.clock = clock
+		engine.Authorize(accounts.address(name), accounts.signFn(name))
+
+		header := types.CopyHeader(header)
+		header.Coinbase = accounts.address(name)
+		header.Difficulty = CalcDifficulty(snap, header.Time.Uint64(), header.Coinbase)
+
+		result := make(chan *types.Block, 1)
+		go func() {
+			block, err := engine.Seal(chain, types.NewBlockWithHeader(header), stop)
+			if err != nil {
+				t.Errorf("producer %s: failed to seal block: %v", name, err)
+			}
+			result <- block
+		}()
+		delay := <-clock.delays
+		clock.fire <- slot.Add(delay)
+		return delay, result
+	}
+	var inturn, noturn string
+	for _, name := range []string{"A", "B", "C", "D"} {
+		if snap.inturn(header.Time.Uint64(), accounts.address(name)) {
+			inturn = name
+		} else {
+			noturn = name
+		}
+	}
+	// The in-turn producer seals a valid block without delay
+	delay, result := seal(inturn, make(chan struct{}))
+	if delay != 0 {
+		t.Errorf("in-turn delay mismatch: have %v, want 0", delay)
+	}
+	if block := <-result; block == nil {
+		t.Fatalf("in-turn producer failed to seal")
+	} else if err := engine.VerifyHeader(chain, block.Header(), true); err != nil {
+		t.Fatalf("failed to verify in-turn block: %v", err)
+	}
+	// Out-of-turn producers spread over the full wiggle window
+	wiggle := time.Duration(len(signers)/2+1) * wiggleTime
+
+	var min, max, sum time.Duration = wiggle, 0, 0
+	for i := 0; i < 256; i++ {
+		delay, result := seal(noturn, make(chan struct{}))
+		if delay < 0 || delay >= wiggle {
+			t.Fatalf("out-of-turn delay out of range: have %v, want [0, %v)", delay, wiggle)
+		}
+		if block := <-result; block == nil || block.Difficulty().Cmp(diffNoTurn) != 0 {
+			t.Fatalf("out-of-turn producer failed to seal")
+		}
+		if delay < min {
+			min = delay
+		}
+		if delay > max {
+			max = delay
+		}
+		sum += delay
+	}
+	if min > wiggle/4 || max < wiggle*3/4 {
+		t.Errorf("out-of-turn delays not spread: min %v, max %v, window %v", min, max, wiggle)
+	}
+	if mean := sum / 256; mean < wiggle*3/8 || mean > wiggle*5/8 {
+		t.Errorf("out-of-turn mean delay mismatch: have %v, want ~%v", mean, wiggle/2)
+	}
+	// A pending out-of-turn seal is aborted when stopped
+	clock := newTesterClock(slot)
+	engine.clock = clock
+	engine.Authorize(accounts.address(noturn), accounts.signFn(noturn))
+
+	stop := make(chan struct{})
+	result = make(chan *types.Block, 1)
+	go func() {
+		block, _ := engine.Seal(chain, types.NewBlockWithHeader(header), stop)
+		result <- block
+	}()
+	<-clock.delays
+	close(stop)
+
+	select {
+	case block := <-result:
+		if block != nil {
+			t.Errorf("aborted seal produced a block")
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("pending seal not aborted")
+	}
+}
+
+// Tests that a graceful stop lets the in-turn producer seal all the slots of its
+// turn, reporting the turn over only once they are, and that it aborts pending
+// out-of-turn seals right away.
+func TestSealGracefulStop(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: 2}
+	accounts := newTesterAccountPool()
+	signers := accounts.signers("A", "B", "C", "D")
+
+	// Start the chain right before the first slot of a turn
+	genesis := newTesterGenesis(signers)
+	if genesis.Time.Uint64()%config.ProducerRepetions == 0 {
+		genesis.Time.Add(genesis.Time, common.Big1)
+	}
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, genesis)
+
+	// seal starts sealing a child of the chain head as the named producer with the
+	// clock frozen at its slot, returning a channel delivering the result
+	seal := func(name string) (*testerClock, chan *types.Block) {
+		parent := chain.CurrentHeader()
+		snap, err := engine.snapshot(chain, parent.Number.Uint64(), parent.Hash(), nil)
+		if err != nil {
+			t.Fatalf("failed to retrieve snapshot: %v", err)
+		}
+		header := newTesterHeader(config, parent, accounts.address(name), nil)
+		header.Difficulty = CalcDifficulty(snap, header.Time.Uint64(), header.Coinbase)
+
+		clock := newTesterClock(time.Unix(header.Time.Int64(), 0))
+		engine.clock = clock
+
+		result := make(chan *types.Block, 1)
+		go func() {
+			block, err := engine.Seal(chain, types.NewBlockWithHeader(header), make(chan struct{}))
+			if err != nil {
+				t.Errorf("producer %s: failed to seal block: %v", name, err)
+			}
+			result <- block
+		}()
+		return clock, result
+	}
+	// receive waits for a sealing result, failing if none arrives
+	receive := func(result chan *types.Block) *types.Block {
+		select {
+		case block := <-result:
+			return block
+		case <-time.After(time.Second):
+			t.Fatalf("sealing result not delivered")
+			return nil
+		}
+	}
+	snap, _ := engine.snapshot(chain, 0, genesis.Hash(), nil)
+	slot := genesis.Time.Uint64() + config.Period
+
+	var producer, other string
+	for _, name := range []string{"A", "B", "C", "D"} {
+		switch {
+		case snap.inturn(slot, accounts.address(name)):
+			producer = name
+		case !snap.inturn(slot+2*config.Period, accounts.address(name)):
+			other = name
+		}
+	}
+	engine.Authorize(accounts.address(producer), accounts.signFn(producer))
+
+	// Request a graceful stop while the first slot of the turn is being sealed
+	clock, result := seal(producer)
+	<-clock.delays
+
+	stopped := engine.StopSealingGracefully()
+	for i := 0; i < int(config.ProducerRepetions); i++ {
+		if i > 0 {
+			clock, result = seal(producer)
+			<-clock.delays
+		}
+		clock.fire <- clock.now
+
+		block := receive(result)
+		if block == nil {
+			t.Fatalf("slot %d: in-turn block not sealed", i)
+		}
+		if block.Difficulty().Cmp(diffInTurn) != 0 {
+			t.Fatalf("slot %d: sealed block out of turn", i)
+		}
+		if err := engine.VerifyHeader(chain, block.Header(), true); err != nil {
+			t.Fatalf("slot %d: failed to verify block: %v", i, err)
+		}
+		chain.insert(block.Header())
+
+		select {
+		case <-stopped:
+			t.Fatalf("slot %d: turn reported over with slots left", i)
+		default:
+		}
+	}
+	// The first block past the turn is refused, ending the turn
+	_, result = seal(producer)
+	if block := receive(result); block != nil {
+		t.Fatalf("block sealed past the turn")
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("turn not reported over")
+	}
+	// Authorizing resumes sealing, and a pending out-of-turn seal is aborted
+	engine.Authorize(accounts.address(other), accounts.signFn(other))
+
+	clock, result = seal(other)
+	<-clock.delays
+
+	stopped = engine.StopSealingGracefully()
+	if block := receive(result); block != nil {
+		t.Fatalf("out-of-turn block sealed while stopping")
+	}
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatalf("out-of-turn producer not stopped")
+	}
+}
@@ -30,15 +30,19 @@ type API struct {
 	dpos  *Dpos
 }
 
+// header resolves the requested block number into a header, falling back to the
+// current head for latest and pending as no pending header exists under dpos.
+func (api *API) header(number *rpc.BlockNumber) *types.Header {
+	if number == nil || *number == rpc.LatestBlockNumber || *number == rpc.PendingBlockNumber {
+		return api.chain.CurrentHeader()
+	}
+	return api.chain.GetHeaderByNumber(uint64(number.Int64()))
+}
+
 // GetSnapshot retrieves the state snapshot at a given block.
 func (api *API) GetSnapshot(number *rpc.BlockNumber) (*DposSnapshot, error) {
 	// Retrieve the requested block number (or current if none requested)
-	var header *types.Header
-	if number == nil || *number == rpc.LatestBlockNumber {
-		header = api.chain.CurrentHeader()
-	} else {
-		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
-	}
+	header := api.header(number)
 	// Ensure we have an actually valid block and return its snapshot
 	if header == nil {
 		return nil, errUnknownBlock
@@ -58,12 +62,7 @@ func (api *API) GetSnapshotAtHash(hash common.Hash) (*DposSnapshot, error) {
 // GetSigners retrieves the list of authorized signers at the specified block.
 func (api *API) GetSigners(number *rpc.BlockNumber) ([]common.Address, error) {
 	// Retrieve the requested block number (or current if none requested)
-	var header *types.Header
-	if number == nil || *number == rpc.LatestBlockNumber {
-		header = api.chain.CurrentHeader()
-	} else {
-		header = api.chain.GetHeaderByNumber(uint64(number.Int64()))
-	}
+	header := api.header(number)
 	// Ensure we have an actually valid block and return the signers from its snapshot
 	if header == nil {
 		return nil, errUnknownBlock
@@ -75,7 +74,7 @@ func (api *API) GetSigners(number *rpc.BlockNumber) ([]common.Address, error) {
 	return snap.signers(), nil
 }
 
-// GetSignersAtHash retrieves the state snapshot at a given block.
+// GetSignersAtHash retrieves the list of authorized signers at the specified block.
 func (api *API) GetSignersAtHash(hash common.Hash) ([]common.Address, error) {
 	header := api.chain.GetHeaderByHash(hash)
 	if header == nil {
@@ -87,3 +86,29 @@ func (api *API) GetSignersAtHash(hash common.Hash) ([]common.Address, error) {
 	}
 	return snap.signers(), nil
 }
+
+// GetSlotInfo retrieves the sealing slot the block after the specified one is
+// due in as of the local clock, the current head if none is specified.
+func (api *API) GetSlotInfo(number *rpc.BlockNumber) (*SlotInfo, error) {
+	header := api.header(number)
+	if header == nil {
+		return nil, errUnknownBlock
+	}
+	slot, signer, deadline, err := api.dpos.ScheduleAt(api.chain, header)
+	if err != nil {
+		return nil, err
+	}
+	return &SlotInfo{
+		Number:   header.Number.Uint64() + 1,
+		Slot:     slot,
+		Signer:   signer,
+		Start:    deadline - slotPeriod(api.dpos.config),
+		Deadline: deadline,
+	}, nil
+}
+
+// GetEvidence retrieves the retained double signing evidence, optionally only the
+// ones against the specified producer.
+func (api *API) GetEvidence(signer *common.Address) ([]*Evidence, error) {
+	return api.dpos.evidence(signer)
+}
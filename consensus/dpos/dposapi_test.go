@@ -0,0 +1,163 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-ethereum library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package dpos
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rpc"
+)
+
+// newTesterAPI creates a small signed dpos chain and exposes the engine's API
+// over an in-process RPC client.
+func newTesterAPI(t *testing.T, blocks int) (*testerChain, *rpc.Client, []common.Address) {
+	config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+	signers := accounts.signers("A", "B")
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(signers))
+	for i := 0; i < blocks; i++ {
+		parent := chain.CurrentHeader()
+		name := []string{"A", "B"}[i%2]
+
+		header := newTesterHeader(config, parent, accounts.address(name), nil)
+		accounts.seal(engine, chain, header, name)
+		if err := engine.VerifyHeader(chain, header, true); err != nil {
+			t.Fatalf("block %d: failed to verify header: %v", i+1, err)
+		}
+		chain.insert(header)
+	}
+	server := rpc.NewServer()
+	for _, api := range engine.APIs(chain) {
+		if err := server.RegisterName(api.Namespace, api.Service); err != nil {
+			t.Fatalf("failed to register %s API: %v", api.Namespace, err)
+		}
+	}
+	return chain, rpc.DialInProc(server), signers
+}
+
+// Tests that the signer list can be retrieved over RPC by number and by hash,
+// and that it matches the snapshot used for header verification.
+func TestAPIGetSigners(t *testing.T) {
+	chain, client, signers := newTesterAPI(t, 4)
+	defer client.Close()
+
+	for _, number := range []string{"latest", "pending", "0x0", "0x2"} {
+		var have []common.Address
+		if err := client.Call(&have, "dpos_getSigners", number); err != nil {
+			t.Fatalf("%s: failed to retrieve signers: %v", number, err)
+		}
+		if !reflect.DeepEqual(have, signers) {
+			t.Errorf("%s: signer mismatch: have %x, want %x", number, have, signers)
+		}
+	}
+	var have []common.Address
+	if err := client.Call(&have, "dpos_getSignersAtHash", chain.GetHeaderByNumber(3).Hash()); err != nil {
+		t.Fatalf("failed to retrieve signers by hash: %v", err)
+	}
+	if !reflect.DeepEqual(have, signers) {
+		t.Errorf("signer mismatch: have %x, want %x", have, signers)
+	}
+	if err := client.Call(&have, "dpos_getSigners", "0x10"); err == nil {
+		t.Errorf("signers retrieved for unknown block")
+	}
+	if err := client.Call(&have, "dpos_getSignersAtHash", common.Hash{0x01}); err == nil {
+		t.Errorf("signers retrieved for unknown hash")
+	}
+}
+
+// Tests that snapshots are returned over RPC with their signer and recent
+// signer sets encoded as JSON maps.
+func TestAPIGetSnapshot(t *testing.T) {
+	chain, client, signers := newTesterAPI(t, 4)
+	defer client.Close()
+
+	var latest json.RawMessage
+	if err := client.Call(&latest, "dpos_getSnapshot", "latest"); err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(latest, &fields); err != nil {
+		t.Fatalf("failed to decode snapshot: %v", err)
+	}
+	for _, field := range []string{"number", "hash", "signers", "recents"} {
+		if _, ok := fields[field]; !ok {
+			t.Errorf("snapshot field %q missing: %s", field, latest)
+		}
+	}
+	var snap DposSnapshot
+	if err := json.Unmarshal(latest, &snap); err != nil {
+		t.Fatalf("failed to decode snapshot: %v", err)
+	}
+	head := chain.CurrentHeader()
+	if snap.Number != head.Number.Uint64() || snap.Hash != head.Hash() {
+		t.Errorf("snapshot position mismatch: have #%d [%x], want #%d [%x]", snap.Number, snap.Hash, head.Number, head.Hash())
+	}
+	if len(snap.Signers) != len(signers) {
+		t.Errorf("snapshot signer count mismatch: have %d, want %d", len(snap.Signers), len(signers))
+	}
+	for _, signer := range signers {
+		if _, ok := snap.Signers[signer]; !ok {
+			t.Errorf("signer %x missing from snapshot", signer)
+		}
+	}
+	header := chain.GetHeaderByNumber(2)
+	if err := client.Call(&snap, "dpos_getSnapshotAtHash", header.Hash()); err != nil {
+		t.Fatalf("failed to retrieve snapshot by hash: %v", err)
+	}
+	if snap.Number != 2 || snap.Hash != header.Hash() {
+		t.Errorf("snapshot position mismatch: have #%d [%x], want #2 [%x]", snap.Number, snap.Hash, header.Hash())
+	}
+}
+
+// Tests that the slot the next block is due in is returned over RPC, a slot
+// lasting a block period and falling to the producers in turn.
+func TestAPIGetSlotInfo(t *testing.T) {
+	_, client, signers := newTesterAPI(t, 4)
+	defer client.Close()
+
+	for _, tt := range []struct {
+		number string
+		due    uint64
+	}{
+		{"latest", 5},
+		{"0x2", 3},
+	} {
+		var info SlotInfo
+		if err := client.Call(&info, "dpos_getSlotInfo", tt.number); err != nil {
+			t.Fatalf("%s: failed to retrieve slot: %v", tt.number, err)
+		}
+		if info.Number != tt.due {
+			t.Errorf("%s: block number mismatch: have %d, want %d", tt.number, info.Number, tt.due)
+		}
+		if info.Start != info.Slot || info.Deadline != info.Slot+1 {
+			t.Errorf("%s: slot bounds mismatch: slot %d, start %d, deadline %d", tt.number, info.Slot, info.Start, info.Deadline)
+		}
+		if want := signers[info.Slot%uint64(len(signers))]; info.Signer != want {
+			t.Errorf("%s: signer mismatch: have %x, want %x", tt.number, info.Signer, want)
+		}
+	}
+	var info SlotInfo
+	if err := client.Call(&info, "dpos_getSlotInfo", "0x10"); err == nil {
+		t.Errorf("slot retrieved for unknown block")
+	}
+}
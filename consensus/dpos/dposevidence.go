@@ -0,0 +1,176 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-ethereum library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package dpos
+
+import (
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/consensus"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/log"
+	"github.com/worldopennetwork/go-won/rlp"
+)
+
+var (
+	evidencePrefix   = []byte("dpos-evidence-")      // evidencePrefix + num (uint64 big endian) + signer -> evidence
+	evidenceIndexKey = []byte("dpos-evidence-index") // Positions of all the retained evidence
+)
+
+// Evidence is the proof of a producer sealing two different blocks at the same
+// height, consisting of both sealed headers.
+type Evidence struct {
+	Signer common.Address `json:"signer"` // Producer that sealed both headers
+	Number uint64         `json:"number"` // Block number both headers were sealed at
+	First  *types.Header  `json:"first"`  // Header seen first by the local node
+	Second *types.Header  `json:"second"` // Conflicting header seen afterwards
+}
+
+// evidenceEntry is the position of a single evidence within the index.
+type evidenceEntry struct {
+	Number uint64         `json:"number"`
+	Signer common.Address `json:"signer"`
+}
+
+// sealedKey identifies the header a producer sealed at a given height.
+type sealedKey struct {
+	number uint64
+	signer common.Address
+}
+
+// evidenceKey = evidencePrefix + num (uint64 big endian) + signer
+func evidenceKey(number uint64, signer common.Address) []byte {
+	key := make([]byte, len(evidencePrefix)+8+common.AddressLength)
+	copy(key, evidencePrefix)
+	binary.BigEndian.PutUint64(key[len(evidencePrefix):], number)
+	copy(key[len(evidencePrefix)+8:], signer[:])
+	return key
+}
+
+// detectDoubleSign checks whether the signer already sealed a different header
+// at the same height, either one verified recently or the canonical one, and if
+// so records the evidence through batch. The header is expected to have a valid
+// seal.
+func (c *Dpos) detectDoubleSign(chain consensus.ChainReader, batch *storeBatch, header *types.Header, signer common.Address) {
+	number := header.Number.Uint64()
+	key := sealedKey{number, signer}
+
+	var first *types.Header
+	if known, ok := c.sealed.Get(key); ok {
+		first = known.(*types.Header)
+	} else {
+		c.sealed.Add(key, header)
+	}
+	if first == nil || first.Hash() == header.Hash() {
+		if canon := chain.GetHeaderByNumber(number); canon != nil && canon.Hash() != header.Hash() {
+			if canon.Coinbase == signer {
+				first = canon
+			}
+		}
+	}
+	if first == nil || first.Hash() == header.Hash() {
+		return
+	}
+	log.Warn("Detected double signing producer", "signer", signer, "number", number, "first", first.Hash(), "second", header.Hash())
+
+	evidence := &Evidence{Signer: signer, Number: number, First: first, Second: header}
+	if err := c.storeEvidence(batch, evidence); err != nil {
+		log.Error("Failed to store double signing evidence", "signer", signer, "number", number, "err", err)
+	}
+}
+
+// storeEvidence inserts the evidence into the batch, unless some is already
+// known for the same producer and height, and prunes any evidence that fell out
+// of the retention window.
+func (c *Dpos) storeEvidence(batch *storeBatch, evidence *Evidence) error {
+	batch.lock(&c.evidenceLock)
+
+	index, err := c.evidenceIndex()
+	if err != nil {
+		return err
+	}
+	retained := index[:0]
+	for _, entry := range index {
+		if entry.Number == evidence.Number && entry.Signer == evidence.Signer {
+			return nil
+		}
+		if entry.Number+c.config.EvidenceRetention < evidence.Number {
+			if err := batch.Delete(evidenceKey(entry.Number, entry.Signer)); err != nil {
+				return err
+			}
+			continue
+		}
+		retained = append(retained, entry)
+	}
+	blob, err := rlp.EncodeToBytes(evidence)
+	if err != nil {
+		return err
+	}
+	if err := batch.Put(evidenceKey(evidence.Number, evidence.Signer), blob); err != nil {
+		return err
+	}
+	blob, err = json.Marshal(append(retained, evidenceEntry{evidence.Number, evidence.Signer}))
+	if err != nil {
+		return err
+	}
+	return batch.Put(evidenceIndexKey, blob)
+}
+
+// evidenceIndex retrieves the positions of all the retained evidence.
+func (c *Dpos) evidenceIndex() ([]evidenceEntry, error) {
+	var index []evidenceEntry
+	if ok, _ := c.db.Has(evidenceIndexKey); !ok {
+		return index, nil
+	}
+	blob, err := c.db.Get(evidenceIndexKey)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(blob, &index); err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// evidence retrieves all the retained evidence, optionally only the ones against
+// a specific producer, ordered as recorded.
+func (c *Dpos) evidence(signer *common.Address) ([]*Evidence, error) {
+	c.evidenceLock.Lock()
+	defer c.evidenceLock.Unlock()
+
+	index, err := c.evidenceIndex()
+	if err != nil {
+		return nil, err
+	}
+	evidences := make([]*Evidence, 0, len(index))
+	for _, entry := range index {
+		if signer != nil && entry.Signer != *signer {
+			continue
+		}
+		blob, err := c.db.Get(evidenceKey(entry.Number, entry.Signer))
+		if err != nil {
+			return nil, err
+		}
+		evidence := new(Evidence)
+		if err := rlp.DecodeBytes(blob, evidence); err != nil {
+			return nil, err
+		}
+		evidences = append(evidences, evidence)
+	}
+	return evidences, nil
+}
@@ -0,0 +1,147 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-ethereum library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package dpos
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rpc"
+)
+
+// newTesterConflict forges a header conflicting with the given one, sealed by
+// the same producer at the same height.
+func newTesterConflict(engine *Dpos, chain *testerChain, accounts *testerAccountPool, header *types.Header, name string) *types.Header {
+	conflict := types.CopyHeader(header)
+	conflict.Extra[0] ^= 0xff
+	accounts.seal(engine, chain, conflict, name)
+	return conflict
+}
+
+// Tests that a producer sealing two different headers at the same height gets
+// caught, whether the first one is canonical or was only verified before, and
+// that the evidence can be retrieved over RPC.
+func TestEvidenceDoubleSign(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(accounts.signers("A", "B")))
+
+	server := rpc.NewServer()
+	for _, api := range engine.APIs(chain) {
+		if err := server.RegisterName(api.Namespace, api.Service); err != nil {
+			t.Fatalf("failed to register %s API: %v", api.Namespace, err)
+		}
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	// Seal a canonical block and a conflicting side block
+	header := newTesterTurn(engine, chain, accounts, chain.CurrentHeader(), "A", nil)
+	if err := engine.VerifyHeader(chain, header, true); err != nil {
+		t.Fatalf("failed to verify header: %v", err)
+	}
+	chain.insert(header)
+
+	if evidences, _ := engine.evidence(nil); len(evidences) != 0 {
+		t.Fatalf("evidence recorded for honest producer: %v", evidences)
+	}
+	conflict := newTesterConflict(engine, chain, accounts, header, "A")
+	if err := engine.VerifyHeader(chain, conflict, true); err != nil {
+		t.Fatalf("failed to verify conflicting header: %v", err)
+	}
+	// Seal two conflicting side blocks on top, neither of which is canonical
+	parent := chain.CurrentHeader()
+	first := newTesterTurn(engine, chain, accounts, parent, "B", nil)
+	second := newTesterConflict(engine, chain, accounts, first, "B")
+	for _, header := range []*types.Header{first, second} {
+		if err := engine.VerifyHeader(chain, header, true); err != nil {
+			t.Fatalf("failed to verify header: %v", err)
+		}
+	}
+	// Ensure both double signs were recorded and are retrievable
+	var evidences []*Evidence
+	if err := client.Call(&evidences, "dpos_getEvidence", nil); err != nil {
+		t.Fatalf("failed to retrieve evidence: %v", err)
+	}
+	want := []*Evidence{
+		{Signer: accounts.address("A"), Number: 1, First: header, Second: conflict},
+		{Signer: accounts.address("B"), Number: 2, First: first, Second: second},
+	}
+	if len(evidences) != len(want) {
+		t.Fatalf("evidence count mismatch: have %d, want %d", len(evidences), len(want))
+	}
+	for i, evidence := range evidences {
+		if evidence.Signer != want[i].Signer || evidence.Number != want[i].Number {
+			t.Errorf("evidence %d: position mismatch: have %x #%d, want %x #%d", i, evidence.Signer, evidence.Number, want[i].Signer, want[i].Number)
+		}
+		if evidence.First.Hash() != want[i].First.Hash() || evidence.Second.Hash() != want[i].Second.Hash() {
+			t.Errorf("evidence %d: header mismatch: have %x/%x, want %x/%x", i, evidence.First.Hash(), evidence.Second.Hash(), want[i].First.Hash(), want[i].Second.Hash())
+		}
+	}
+	signer := accounts.address("B")
+	if err := client.Call(&evidences, "dpos_getEvidence", signer); err != nil {
+		t.Fatalf("failed to retrieve evidence: %v", err)
+	}
+	if len(evidences) != 1 || evidences[0].Signer != signer {
+		t.Errorf("filtered evidence mismatch: have %v, want evidence against %x", evidences, signer)
+	}
+}
+
+// Tests that evidence is only recorded once per producer and height, and that
+// the store is pruned beyond the retention window.
+func TestEvidenceRetention(t *testing.T) {
+	engine := newTesterEngine(&params.DposConfig{Period: 1, Epoch: 30000, EvidenceRetention: 10})
+	signer := common.Address{0x01}
+
+	for _, number := range []uint64{1, 1, 5, 11, 16} {
+		evidence := &Evidence{
+			Signer: signer,
+			Number: number,
+			First:  &types.Header{Number: new(big.Int).SetUint64(number), Extra: []byte{0x01}},
+			Second: &types.Header{Number: new(big.Int).SetUint64(number), Extra: []byte{0x02}},
+		}
+		batch := engine.newStoreBatch()
+		if err := engine.storeEvidence(batch, evidence); err != nil {
+			t.Fatalf("failed to store evidence #%d: %v", number, err)
+		}
+		if err := batch.write(); err != nil {
+			t.Fatalf("failed to write evidence #%d: %v", number, err)
+		}
+	}
+	evidences, err := engine.evidence(nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve evidence: %v", err)
+	}
+	var have []uint64
+	for _, evidence := range evidences {
+		have = append(have, evidence.Number)
+	}
+	if want := []uint64{11, 16}; !reflect.DeepEqual(have, want) {
+		t.Errorf("retained evidence mismatch: have %v, want %v", have, want)
+	}
+	for _, number := range []uint64{1, 5} {
+		if ok, _ := engine.db.Has(evidenceKey(number, signer)); ok {
+			t.Errorf("pruned evidence #%d still in database", number)
+		}
+	}
+}
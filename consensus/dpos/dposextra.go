@@ -0,0 +1,181 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package dpos
+
+import (
+	"errors"
+
+	"github.com/worldopennetwork/go-won/common"
+)
+
+// Layout versions of the extra-data section of dpos headers. The version is
+// carried in the last byte of the vanity prefix.
+const (
+	// extraVersion0 is laid out as vanity | checkpoint producer list | seal, with
+	// the producer list present on epoch blocks only.
+	extraVersion0 = 0x00
+
+	// extraVersion1 is laid out as vanity | checkpoint producer list | signing
+	// key list | seal, the signing keys being those of the producers in the same
+	// position, or the producers themselves if they seal with their own key. It
+	// is only used on epoch blocks, when some producer has a signing key.
+	extraVersion1 = 0x01
+
+	// extraVersion2 is laid out as vanity | checkpoint producer list | signing
+	// key list | previous signing key list | seal, the previous signing keys being
+	// the ones the producers in the same position sealed with up to the epoch
+	// block, still accepted during the key rotation grace window. It is only used
+	// on epoch blocks, when some producer rotated its signing key.
+	extraVersion2 = 0x02
+
+	extraVersion = extraVersion0 // Layout of the headers produced locally
+)
+
+var (
+	// errUnknownExtraVersion is returned if the extra-data section of a header is
+	// laid out in a version unknown to the local node.
+	errUnknownExtraVersion = errors.New("unknown extra-data layout version")
+
+	// errExtraSigningKeys is returned if a non-checkpoint block carries signing
+	// keys in its extra-data section.
+	errExtraSigningKeys = errors.New("non-checkpoint block contains extra signing key list")
+)
+
+// headerExtra is the decoded extra-data section of a dpos header.
+type headerExtra struct {
+	Version  byte             // Layout version of the extra-data
+	Vanity   []byte           // Free-form signer vanity, version byte excluded
+	Signers  []common.Address // Producer list checkpointed on epoch blocks
+	Keys     []common.Address // Signing keys of the checkpointed producers, version 1 and 2 only
+	Previous []common.Address // Signing keys replaced by the checkpoint, version 2 only
+	Seal     []byte           // Signature of the producer sealing the header
+}
+
+// parseExtra decodes the extra-data section of a dpos header, enforcing the
+// exact length of its layout. Checkpoint is whether the header is an epoch
+// block, which needs to carry a non-empty producer list.
+func parseExtra(extra []byte, checkpoint bool) (*headerExtra, error) {
+	if len(extra) < extraVanity {
+		return nil, errMissingVanity
+	}
+	if len(extra) < extraVanity+extraSeal {
+		return nil, errMissingSignature
+	}
+	version := extra[extraVanity-1]
+	if version != extraVersion0 && version != extraVersion1 && version != extraVersion2 {
+		return nil, errUnknownExtraVersion
+	}
+	if !checkpoint && version != extraVersion0 {
+		return nil, errExtraSigningKeys
+	}
+	// The producer list is followed by as many signing keys in version 1, and as
+	// many previous signing keys on top in version 2
+	entry := common.AddressLength * checkpointLists(version)
+	signersBytes := len(extra) - extraVanity - extraSeal
+	if !checkpoint && signersBytes != 0 {
+		return nil, errExtraSigners
+	}
+	if checkpoint && (signersBytes == 0 || signersBytes%entry != 0) {
+		return nil, errInvalidCheckpointSigners
+	}
+	signers, keys, previous := splitCheckpoint(version, extra[extraVanity:len(extra)-extraSeal])
+
+	return &headerExtra{
+		Version:  version,
+		Vanity:   common.CopyBytes(extra[:extraVanity-1]),
+		Signers:  signers,
+		Keys:     keys,
+		Previous: previous,
+		Seal:     common.CopyBytes(extra[len(extra)-extraSeal:]),
+	}, nil
+}
+
+// verifyLegacyExtra checks the extra-data section of a header predating the
+// checkpoint fork, laid out as vanity | producer list | seal on every block.
+func verifyLegacyExtra(extra []byte) error {
+	if len(extra) < extraVanity {
+		return errMissingVanity
+	}
+	if len(extra) < extraVanity+extraSeal {
+		return errMissingSignature
+	}
+	signersBytes := len(extra) - extraVanity - extraSeal
+	if signersBytes == 0 || signersBytes%common.AddressLength != 0 {
+		return errInvalidCheckpointSigners
+	}
+	return nil
+}
+
+// checkpointLists returns the number of address lists the checkpoint section of
+// the extra-data is made of in the given layout version.
+func checkpointLists(version byte) int {
+	switch version {
+	case extraVersion1:
+		return 2
+	case extraVersion2:
+		return 3
+	default:
+		return 1
+	}
+}
+
+// splitCheckpoint splits the checkpoint section of the extra-data, laid out in
+// the given version, into the producer list, their signing keys, which are nil
+// in version 0, and their previous signing keys, which are nil below version 2.
+// Any trailing partial address is ignored.
+func splitCheckpoint(version byte, checkpoint []byte) (signers []common.Address, keys []common.Address, previous []common.Address) {
+	lists := checkpointLists(version)
+	count := len(checkpoint) / common.AddressLength / lists
+
+	split := func(list int) []common.Address {
+		addrs := make([]common.Address, count)
+		for i := range addrs {
+			copy(addrs[i][:], checkpoint[(list*count+i)*common.AddressLength:])
+		}
+		return addrs
+	}
+	signers = split(0)
+	if lists > 1 {
+		keys = split(1)
+	}
+	if lists > 2 {
+		previous = split(2)
+	}
+	return signers, keys, previous
+}
+
+// encode assembles the extra-data section in the layout of its version, padding
+// or truncating the vanity and the seal to their fixed lengths.
+func (e *headerExtra) encode() []byte {
+	extra := make([]byte, extraVanity, extraVanity+(len(e.Signers)+len(e.Keys)+len(e.Previous))*common.AddressLength+extraSeal)
+	copy(extra[:extraVanity-1], e.Vanity)
+	extra[extraVanity-1] = e.Version
+
+	for _, signer := range e.Signers {
+		extra = append(extra, signer[:]...)
+	}
+	for _, key := range e.Keys {
+		extra = append(extra, key[:]...)
+	}
+	for _, key := range e.Previous {
+		extra = append(extra, key[:]...)
+	}
+	seal := make([]byte, extraSeal)
+	copy(seal, e.Seal)
+
+	return append(extra, seal...)
+}
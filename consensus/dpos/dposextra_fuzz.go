@@ -0,0 +1,37 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+// +build gofuzz
+
+package dpos
+
+import "bytes"
+
+// Fuzz implements a go-fuzz fuzzer method to test the parsing of the extra-data
+// section of headers, the first byte selecting whether it's a checkpoint.
+func Fuzz(data []byte) int {
+	if len(data) == 0 {
+		return -1
+	}
+	extra, err := parseExtra(data[1:], data[0]%2 == 0)
+	if err != nil {
+		return 0
+	}
+	if enc := extra.encode(); !bytes.Equal(enc, data[1:]) {
+		panic("content mismatch")
+	}
+	return 1
+}
@@ -0,0 +1,170 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package dpos
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/params"
+)
+
+// Tests that extra-data sections are only accepted in the exact layout of a known
+// version, and that accepted ones encode back to themselves.
+func TestParseExtra(t *testing.T) {
+	signers := []common.Address{{0x01}, {0x02}}
+
+	keys := []common.Address{{0x01}, {0x03}}
+	previous := []common.Address{{0x04}, {0x03}}
+
+	versioned := testerExtra(nil)
+	versioned[extraVanity-1] = 0x03
+
+	delegated := testerExtra(append(append([]common.Address{}, signers...), keys...))
+	delegated[extraVanity-1] = extraVersion1
+
+	undelegated := testerExtra(nil)
+	undelegated[extraVanity-1] = extraVersion1
+
+	odd := testerExtra(append(append([]common.Address{}, signers...), keys[0]))
+	odd[extraVanity-1] = extraVersion1
+
+	rotated := testerExtra(append(append(append([]common.Address{}, signers...), keys...), previous...))
+	rotated[extraVanity-1] = extraVersion2
+
+	unrotated := testerExtra(append(append([]common.Address{}, signers...), keys...))
+	unrotated[extraVanity-1] = extraVersion2
+
+	tests := []struct {
+		extra      []byte
+		checkpoint bool
+		err        error
+	}{
+		{nil, false, errMissingVanity},
+		{make([]byte, extraVanity-1), false, errMissingVanity},
+		{make([]byte, extraVanity+extraSeal-1), false, errMissingSignature},
+		{testerExtra(nil), false, nil},
+		{testerExtra(nil), true, errInvalidCheckpointSigners},
+		{testerExtra(signers), true, nil},
+		{testerExtra(signers), false, errExtraSigners},
+		{append(testerExtra(signers), 0x00), true, errInvalidCheckpointSigners},
+		{versioned, false, errUnknownExtraVersion},
+		{delegated, true, nil},
+		{delegated, false, errExtraSigningKeys},
+		{undelegated, false, errExtraSigningKeys},
+		{odd, true, errInvalidCheckpointSigners},
+		{rotated, true, nil},
+		{rotated, false, errExtraSigningKeys},
+		{unrotated, true, errInvalidCheckpointSigners},
+	}
+	for i, tt := range tests {
+		extra, err := parseExtra(tt.extra, tt.checkpoint)
+		if err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+			continue
+		}
+		if err != nil {
+			continue
+		}
+		if tt.checkpoint && !reflect.DeepEqual(extra.Signers, signers) {
+			t.Errorf("test %d: signers mismatch: have %x, want %x", i, extra.Signers, signers)
+		}
+		if extra.Version != extraVersion0 && !reflect.DeepEqual(extra.Keys, keys) {
+			t.Errorf("test %d: signing keys mismatch: have %x, want %x", i, extra.Keys, keys)
+		}
+		if extra.Version == extraVersion2 && !reflect.DeepEqual(extra.Previous, previous) {
+			t.Errorf("test %d: previous signing keys mismatch: have %x, want %x", i, extra.Previous, previous)
+		}
+		if enc := extra.encode(); !bytes.Equal(enc, tt.extra) {
+			t.Errorf("test %d: encoding mismatch: have %x, want %x", i, enc, tt.extra)
+		}
+	}
+}
+
+// Tests that headers prepared locally are laid out in the current version,
+// keeping as much of the requested vanity as fits.
+func TestPrepareExtra(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 2, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+
+	engine := newTesterEngine(config)
+	engine.Authorize(accounts.address("A"), accounts.signFn("A"))
+	chain := newTesterChain(config, newTesterGenesis(accounts.signers("A")))
+
+	vanity := bytes.Repeat([]byte{0xff}, 2*extraVanity)
+	for number := 1; number <= 2; number++ {
+		header := newTesterHeader(config, chain.CurrentHeader(), common.Address{}, nil)
+		header.Extra = vanity
+		if err := engine.Prepare(chain, header); err != nil {
+			t.Fatalf("block %d: failed to prepare header: %v", number, err)
+		}
+		extra, err := parseExtra(header.Extra, number%2 == 0)
+		if err != nil {
+			t.Fatalf("block %d: failed to parse prepared extra-data: %v", number, err)
+		}
+		if extra.Version != extraVersion || !bytes.Equal(extra.Vanity, vanity[:extraVanity-1]) {
+			t.Errorf("block %d: layout mismatch: have version %d vanity %x", number, extra.Version, extra.Vanity)
+		}
+		if want := number%2 == 0; (len(extra.Signers) > 0) != want {
+			t.Errorf("block %d: checkpoint mismatch: have %d signers", number, len(extra.Signers))
+		}
+		accounts.sign(header, "A")
+		chain.insert(header)
+	}
+}
+
+// Tests that random extra-data sections, including truncated and extended valid
+// ones, are deterministically accepted or rejected by both the parser and the
+// header verification, without panicking.
+func TestParseExtraRandom(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(accounts.signers("A")))
+
+	rand := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		var extra []byte
+		switch i % 3 {
+		case 0:
+			extra = make([]byte, rand.Intn(3*(extraVanity+extraSeal)))
+			rand.Read(extra)
+		case 1:
+			extra = testerExtra(accounts.signers("A", "B"))[:rand.Intn(extraVanity+2*common.AddressLength+extraSeal)]
+		case 2:
+			extra = append(testerExtra(nil), make([]byte, rand.Intn(2*common.AddressLength))...)
+		}
+		checkpoint := rand.Intn(2) == 0
+
+		parsed, err := parseExtra(extra, checkpoint)
+		if again, err2 := parseExtra(extra, checkpoint); err != err2 || !reflect.DeepEqual(parsed, again) {
+			t.Fatalf("test %d: non-deterministic parse of %x: %v, %v", i, extra, err, err2)
+		}
+		if err == nil && !bytes.Equal(parsed.encode(), extra) {
+			t.Fatalf("test %d: encoding mismatch: have %x, want %x", i, parsed.encode(), extra)
+		}
+		header := newTesterHeader(config, chain.CurrentHeader(), accounts.address("A"), nil)
+		header.Extra = extra
+		if err := engine.VerifyHeader(chain, header, true); err == nil {
+			t.Fatalf("test %d: unsigned header with extra-data %x accepted", i, extra)
+		}
+	}
+}
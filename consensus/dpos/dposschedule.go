@@ -0,0 +1,143 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-ethereum library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package dpos
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sort"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/consensus"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/params"
+)
+
+// SlotInfo is the sealing slot the next block on top of a header is due in.
+type SlotInfo struct {
+	Number   uint64         `json:"number"`   // Number of the block due
+	Slot     uint64         `json:"slot"`     // Number of the slot, counted from the unix epoch
+	Signer   common.Address `json:"signer"`   // Producer scheduled to seal in the slot
+	Start    uint64         `json:"start"`    // Timestamp the slot starts at, the one of the block
+	Deadline uint64         `json:"deadline"` // Timestamp the slot ends at
+}
+
+// slotPeriod returns the duration of the sealing slots in seconds, the block
+// period, or a second if blocks may follow each other immediately.
+func slotPeriod(config *params.DposConfig) uint64 {
+	if config.Period == 0 {
+		return 1
+	}
+	return config.Period
+}
+
+// slotOf returns the number of the sealing slot covering the given timestamp.
+func slotOf(config *params.DposConfig, time uint64) uint64 {
+	return time / slotPeriod(config)
+}
+
+// slotTime returns the timestamp a child of parent is due at as of the local
+// clock. Slots start a whole number of block periods after the parent: the child
+// is due a block period after it, or at the start of the slot the clock is in if
+// the slots in between were skipped.
+func (c *Dpos) slotTime(parent *types.Header) uint64 {
+	time := parent.Time.Uint64() + c.config.Period
+	if now := uint64(c.clock.Now().Unix()); time < now {
+		period := slotPeriod(c.config)
+		time += (now - time) / period * period
+	}
+	return time
+}
+
+// ScheduleAt returns the slot the child of parent is due in as of the local
+// clock, along with the producer scheduled to seal in it and the timestamp the
+// slot ends at.
+func (c *Dpos) ScheduleAt(chain consensus.ChainReader, parent *types.Header) (slot uint64, signer common.Address, deadline uint64, err error) {
+	snap, err := c.snapshot(chain, parent.Number.Uint64(), parent.Hash(), nil)
+	if err != nil {
+		return 0, common.Address{}, 0, err
+	}
+	slot, signer, deadline = snap.slotAt(c.slotTime(parent))
+	return slot, signer, deadline, nil
+}
+
+// shuffleSchedule orders the producers of an epoch so that producers of the same
+// region don't take consecutive turns, keeping the chain live if a region goes
+// down. The order is a deterministic function of the set of producers, their
+// locations and seed.
+//
+// The producers are shuffled with randomness drawn from seed, then laid out one
+// by one, each time taking the first producer of the region with the most
+// producers left, skipping the region of the previous turn. This avoids adjacent
+// turns whenever no region holds more than half of the producers. Producers of
+// unknown location are never considered to share a region.
+func shuffleSchedule(producers []common.Address, locations map[common.Address]common.ProducerLocation, seed common.Hash) []common.Address {
+	shuffled := make([]common.Address, len(producers))
+	copy(shuffled, producers)
+	sort.Slice(shuffled, func(i, j int) bool {
+		return bytes.Compare(shuffled[i][:], shuffled[j][:]) < 0
+	})
+	// Fisher-Yates shuffle, drawing every swap from the hash chain of the seed
+	rnd := seed
+	for i := len(shuffled) - 1; i > 0; i-- {
+		rnd = crypto.Keccak256Hash(rnd[:])
+		j := binary.BigEndian.Uint64(rnd[common.HashLength-8:]) % uint64(i+1)
+		shuffled[i], shuffled[j] = shuffled[j], shuffled[i]
+	}
+	// Lay out the turns, keeping the largest regions from piling up at the end
+	left := make(map[common.ProducerLocation]int)
+	for _, producer := range shuffled {
+		if loc := locations[producer]; loc.Known() {
+			left[loc]++
+		}
+	}
+	weight := func(loc common.ProducerLocation) int {
+		if loc.Known() {
+			return left[loc]
+		}
+		return 1
+	}
+	schedule := make([]common.Address, 0, len(shuffled))
+
+	var last common.ProducerLocation
+	for len(shuffled) > 0 {
+		pick := -1
+		for i, producer := range shuffled {
+			loc := locations[producer]
+			if loc.Known() && loc == last {
+				continue
+			}
+			if pick < 0 || weight(loc) > weight(locations[shuffled[pick]]) {
+				pick = i
+			}
+		}
+		// Only producers of the previous region left, they can't be kept apart
+		if pick < 0 {
+			pick = 0
+		}
+		producer := shuffled[pick]
+		shuffled = append(shuffled[:pick], shuffled[pick+1:]...)
+
+		last = locations[producer]
+		if last.Known() {
+			left[last]--
+		}
+		schedule = append(schedule, producer)
+	}
+	return schedule
+}
@@ -0,0 +1,266 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-ethereum library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package dpos
+
+import (
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/params"
+)
+
+// newTesterLocations creates count producers, the i-th located in the region
+// regions(i).
+func newTesterLocations(count int, regions func(i int) common.ProducerLocation) ([]common.Address, map[common.Address]common.ProducerLocation) {
+	producers := make([]common.Address, count)
+	locations := make(map[common.Address]common.ProducerLocation)
+	for i := range producers {
+		producers[i] = common.BigToAddress(big.NewInt(int64(0x0100 + i)))
+		locations[producers[i]] = regions(i)
+	}
+	return producers, locations
+}
+
+// adjacentTurns counts the consecutive turns taken by producers of the same
+// known region.
+func adjacentTurns(schedule []common.Address, locations map[common.Address]common.ProducerLocation) int {
+	adjacent := 0
+	for i := 1; i < len(schedule); i++ {
+		if loc := locations[schedule[i]]; loc.Known() && loc == locations[schedule[i-1]] {
+			adjacent++
+		}
+	}
+	return adjacent
+}
+
+// Tests that the shuffled schedule only depends on the set of producers, their
+// locations and the seed, and that it's a permutation of the producers.
+func TestShuffleScheduleDeterministic(t *testing.T) {
+	producers, locations := newTesterLocations(21, func(i int) common.ProducerLocation {
+		return common.ProducerLocation(i % 4)
+	})
+	reversed := make([]common.Address, len(producers))
+	for i, producer := range producers {
+		reversed[len(producers)-1-i] = producer
+	}
+	orders := make(map[string]bool)
+	for i := 0; i < 8; i++ {
+		seed := crypto.Keccak256Hash([]byte{byte(i)})
+
+		schedule := shuffleSchedule(producers, locations, seed)
+		if again := shuffleSchedule(producers, locations, seed); !reflect.DeepEqual(schedule, again) {
+			t.Fatalf("seed %d: schedule not deterministic: %x != %x", i, schedule, again)
+		}
+		if again := shuffleSchedule(reversed, locations, seed); !reflect.DeepEqual(schedule, again) {
+			t.Fatalf("seed %d: schedule depends on the input order: %x != %x", i, schedule, again)
+		}
+		seen := make(map[common.Address]bool)
+		for _, producer := range schedule {
+			if _, ok := locations[producer]; !ok || seen[producer] {
+				t.Fatalf("seed %d: schedule is not a permutation: %x", i, schedule)
+			}
+			seen[producer] = true
+		}
+		if len(seen) != len(producers) {
+			t.Fatalf("seed %d: schedule length mismatch: have %d, want %d", i, len(seen), len(producers))
+		}
+		orders[fmt.Sprintf("%x", schedule)] = true
+	}
+	if len(orders) < 2 {
+		t.Errorf("schedule doesn't depend on the seed")
+	}
+}
+
+// Tests that producers of the same region are kept from taking consecutive turns
+// whenever no region holds more than half of them, and that they are otherwise
+// kept apart as much as possible.
+func TestShuffleScheduleAdjacency(t *testing.T) {
+	tests := []struct {
+		regions func(i int) common.ProducerLocation
+		want    int
+	}{
+		// Evenly spread over a few regions
+		{func(i int) common.ProducerLocation { return common.ProducerLocation(1 + i%3) }, 0},
+		// A region holding the largest share that can still be kept apart
+		{func(i int) common.ProducerLocation {
+			if i < 11 {
+				return 250
+			}
+			return common.ProducerLocation(1 + i%2)
+		}, 0},
+		// Producers of unknown location never clash, even with each other
+		{func(i int) common.ProducerLocation {
+			if i%2 == 0 {
+				return 840
+			}
+			return 0
+		}, 0},
+		// A dominating region can't be kept apart, 15 turns need 14 separators
+		{func(i int) common.ProducerLocation {
+			if i < 15 {
+				return 156
+			}
+			return 392
+		}, 15 - 6 - 1},
+	}
+	for i, tt := range tests {
+		producers, locations := newTesterLocations(21, tt.regions)
+		for j := 0; j < 16; j++ {
+			schedule := shuffleSchedule(producers, locations, crypto.Keccak256Hash([]byte{byte(i), byte(j)}))
+			if have := adjacentTurns(schedule, locations); have != tt.want {
+				t.Errorf("test %d, seed %d: adjacent turns mismatch: have %d, want %d", i, j, have, tt.want)
+			}
+		}
+	}
+}
+
+// Tests that with region shuffling enabled, epoch blocks have to checkpoint the
+// elected producers in the shuffled order, and that producers then take their
+// turns in the checkpointed order.
+func TestRegionShuffleCheckpoint(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 2, ProducerRepetions: 1, RegionShuffle: true}
+	accounts := newTesterAccountPool()
+	initial := accounts.signers("A", "B")
+	elected := accounts.signers("A", "B", "C", "D")
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(initial))
+
+	// Elect producers in two regions, two of them in each
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(newTesterDatabase()))
+	locations := make(map[common.Address]common.ProducerLocation)
+	for i, producer := range elected {
+		statedb.RegisterProducer(&producer, "http://producer")
+		statedb.UpdateProducerTotalVotes(&producer, big.NewInt(int64(len(elected)-i)))
+
+		locations[producer] = common.ProducerLocation(276 + i%2)
+		statedb.UpdateProducerLocation(&producer, locations[producer])
+	}
+	statedb.SetDposTotalActivatedStake(vm.DposActivatedStakeThreshold)
+	root, err := statedb.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit election state: %v", err)
+	}
+	chain.states[root] = statedb
+
+	header := newTesterHeader(config, chain.CurrentHeader(), accounts.address("A"), nil)
+	header.Root = root
+	accounts.seal(engine, chain, header, "A")
+	if err := engine.VerifyHeader(chain, header, true); err != nil {
+		t.Fatalf("failed to verify header: %v", err)
+	}
+	chain.insert(header)
+
+	// The checkpoint must carry the shuffled schedule, not the sorted one
+	schedule := shuffleSchedule(elected, locations, header.Hash())
+	if adjacent := adjacentTurns(schedule, locations); adjacent != 0 {
+		t.Fatalf("shuffled schedule has %d adjacent turns: %x", adjacent, schedule)
+	}
+	if !reflect.DeepEqual(schedule, elected) {
+		sorted := newTesterHeader(config, chain.CurrentHeader(), accounts.address("B"), elected)
+		accounts.seal(engine, chain, sorted, "B")
+		if err := engine.VerifyHeader(chain, sorted, true); err != errInvalidCheckpointSigners {
+			t.Fatalf("unshuffled checkpoint error mismatch: have %v, want %v", err, errInvalidCheckpointSigners)
+		}
+	}
+	checkpoint := newTesterHeader(config, chain.CurrentHeader(), accounts.address("B"), schedule)
+	checkpoint.Root = root
+	accounts.seal(engine, chain, checkpoint, "B")
+	if err := engine.VerifyHeader(chain, checkpoint, true); err != nil {
+		t.Fatalf("failed to verify shuffled checkpoint: %v", err)
+	}
+	chain.insert(checkpoint)
+
+	snap, err := engine.snapshot(chain, checkpoint.Number.Uint64(), checkpoint.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	for time := uint64(1000); time < 1000+2*uint64(len(schedule)); time++ {
+		if have, want := snap.scheduled(time), schedule[time%uint64(len(schedule))]; have != want {
+			t.Fatalf("time %d: scheduled producer mismatch: have %x, want %x", time, have, want)
+		}
+	}
+	// The order survives applying headers on top of the checkpoint
+	next := newTesterHeader(config, checkpoint, accounts.address("C"), nil)
+	accounts.seal(engine, chain, next, "C")
+	applied, err := snap.apply([]*types.Header{next})
+	if err != nil {
+		t.Fatalf("failed to apply header: %v", err)
+	}
+	if !reflect.DeepEqual(applied.schedule(), schedule) {
+		t.Errorf("applied schedule mismatch: have %x, want %x", applied.schedule(), schedule)
+	}
+}
+
+// Tests that the slots of a synthetic schedule follow each other a block period
+// apart in the schedule order, the block after a header being due in the slot of
+// the earliest timestamp it may carry as of the local clock.
+func TestScheduleAt(t *testing.T) {
+	config := &params.DposConfig{Period: 3, Epoch: 30000, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+
+	engine := newTesterEngine(config)
+	genesis := newTesterGenesis(accounts.signers("A", "B", "C"))
+	genesis.Time.SetUint64(genesis.Time.Uint64() / config.Period * config.Period)
+	chain := newTesterChain(config, genesis)
+
+	snap, err := engine.snapshot(chain, 0, genesis.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	signers := snap.schedule()
+	first := genesis.Time.Uint64() / config.Period
+
+	tests := []struct {
+		now  uint64 // Local clock after the genesis
+		slot uint64 // Slot the next block is due in after the one of the genesis
+	}{
+		{0, 1},
+		{2, 1},
+		{3, 1},
+		{5, 1},
+		{6, 2},
+		{10, 3},
+		{30, 10},
+	}
+	for _, tt := range tests {
+		engine.clock = newTesterClock(time.Unix(int64(genesis.Time.Uint64()+tt.now), 0))
+
+		slot, signer, deadline, err := engine.ScheduleAt(chain, genesis)
+		if err != nil {
+			t.Fatalf("clock +%d: failed to schedule: %v", tt.now, err)
+		}
+		want := first + tt.slot
+		if slot != want {
+			t.Errorf("clock +%d: slot mismatch: have %d, want %d", tt.now, slot, want)
+		}
+		if want := signers[want%uint64(len(signers))]; signer != want {
+			t.Errorf("clock +%d: signer mismatch: have %x, want %x", tt.now, signer, want)
+		}
+		if want := (want + 1) * config.Period; deadline != want {
+			t.Errorf("clock +%d: deadline mismatch: have %d, want %d", tt.now, deadline, want)
+		}
+	}
+}
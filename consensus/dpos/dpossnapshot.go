@@ -17,11 +17,13 @@
 package dpos
 
 import (
+	"encoding/binary"
 	"encoding/json"
 
 	"bytes"
 	lru "github.com/hashicorp/golang-lru"
 	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/types"
 	"github.com/worldopennetwork/go-won/params"
 	"github.com/worldopennetwork/go-won/wondb"
 )
@@ -52,6 +54,10 @@ type DposSnapshot struct {
 	Signers map[common.Address]struct{} `json:"signers"` // Set of authorized signers at this moment
 	Recents map[uint64]common.Address   `json:"recents"` // Set of recent signers for spam protections
 
+	Schedule []common.Address `json:"schedule,omitempty"` // Order of the turns of the signers if shuffled, sorted otherwise
+
+	SigningKeys  map[common.Address]common.Address `json:"signingKeys,omitempty"`  // Keys sealing for the signers not sealing with their own
+	PreviousKeys map[common.Address]common.Address `json:"previousKeys,omitempty"` // Keys replaced at the last checkpoint, sealing during the grace window
 }
 
 // newSnapshot creates a new snapshot with the specified startup parameters. This
@@ -70,15 +76,65 @@ func newSnapshot(config *params.DposConfig, sigcache *lru.ARCCache, number uint6
 	for _, signer := range signers {
 		snap.Signers[signer] = struct{}{}
 	}
-
+	if config.RegionShuffle {
+		snap.Schedule = signers
+	}
 	return snap
 }
 
+// setSigningKeys replaces the signing keys of the snapshot with the ones of a
+// checkpoint, keys being those of signers in the same position, or nil if all
+// of them seal with their own key, and previous the keys they replace, or nil
+// if none was rotated.
+func (s *DposSnapshot) setSigningKeys(signers []common.Address, keys []common.Address, previous []common.Address) {
+	s.SigningKeys, s.PreviousKeys = nil, nil
+	for i, key := range keys {
+		if i >= len(signers) || key == signers[i] {
+			continue
+		}
+		if s.SigningKeys == nil {
+			s.SigningKeys = make(map[common.Address]common.Address)
+		}
+		s.SigningKeys[signers[i]] = key
+	}
+	for i, key := range previous {
+		if i >= len(signers) || key == s.signingKey(signers[i]) {
+			continue
+		}
+		if s.PreviousKeys == nil {
+			s.PreviousKeys = make(map[common.Address]common.Address)
+		}
+		s.PreviousKeys[signers[i]] = key
+	}
+}
+
+// snapshotPrefix + num (uint64 big endian) + hash -> snapshot. Leading with the
+// number keeps the snapshots ordered by age on disk, so the ones falling out of
+// the retention window form a single range to delete and compact.
+var snapshotPrefix = []byte("dpos-snap-")
+
+// snapshotKey = snapshotPrefix + num (uint64 big endian) + hash
+func snapshotKey(number uint64, hash common.Hash) []byte {
+	key := make([]byte, len(snapshotPrefix)+8+common.HashLength)
+	copy(key, snapshotPrefix)
+	binary.BigEndian.PutUint64(key[len(snapshotPrefix):], number)
+	copy(key[len(snapshotPrefix)+8:], hash[:])
+	return key
+}
+
+// legacySnapshotKey is the key snapshots were persisted under before being
+// ordered by number.
+func legacySnapshotKey(hash common.Hash) []byte {
+	return append([]byte("dpos-"), hash[:]...)
+}
+
 // loadSnapshot loads an existing snapshot from the database.
-func loadSnapshot(config *params.DposConfig, sigcache *lru.ARCCache, db wondb.Database, hash common.Hash) (*DposSnapshot, error) {
-	blob, err := db.Get(append([]byte("dpos-"), hash[:]...))
+func loadSnapshot(config *params.DposConfig, sigcache *lru.ARCCache, db wondb.Database, number uint64, hash common.Hash) (*DposSnapshot, error) {
+	blob, err := db.Get(snapshotKey(number, hash))
 	if err != nil {
-		return nil, err
+		if blob, err = db.Get(legacySnapshotKey(hash)); err != nil {
+			return nil, err
+		}
 	}
 	snap := new(DposSnapshot)
 	if err := json.Unmarshal(blob, snap); err != nil {
@@ -89,13 +145,13 @@ func loadSnapshot(config *params.DposConfig, sigcache *lru.ARCCache, db wondb.Da
 	return snap, nil
 }
 
-// store inserts the snapshot into the database.
-func (s *DposSnapshot) store(db wondb.Database) error {
+// store inserts the snapshot into the database, or a batch writing into it.
+func (s *DposSnapshot) store(db wondb.Putter) error {
 	blob, err := json.Marshal(s)
 	if err != nil {
 		return err
 	}
-	return db.Put(append([]byte("dpos-"), s.Hash[:]...), blob)
+	return db.Put(snapshotKey(s.Number, s.Hash), blob)
 }
 
 // copy creates a deep copy of the snapshot, though not the individual votes.
@@ -116,6 +172,22 @@ func (s *DposSnapshot) copy() *DposSnapshot {
 	for block, signer := range s.Recents {
 		cpy.Recents[block] = signer
 	}
+	if s.Schedule != nil {
+		cpy.Schedule = make([]common.Address, len(s.Schedule))
+		copy(cpy.Schedule, s.Schedule)
+	}
+	if s.SigningKeys != nil {
+		cpy.SigningKeys = make(map[common.Address]common.Address, len(s.SigningKeys))
+		for signer, key := range s.SigningKeys {
+			cpy.SigningKeys[signer] = key
+		}
+	}
+	if s.PreviousKeys != nil {
+		cpy.PreviousKeys = make(map[common.Address]common.Address, len(s.PreviousKeys))
+		for signer, key := range s.PreviousKeys {
+			cpy.PreviousKeys[signer] = key
+		}
+	}
 
 	//for address, tally := range s.Tally {
 	//	cpy.Tally[address] = tally
@@ -125,6 +197,77 @@ func (s *DposSnapshot) copy() *DposSnapshot {
 	return cpy
 }
 
+// apply creates a new authorization snapshot by applying the given headers to
+// the original one. The signer set is only ever rotated on epoch blocks, where
+// it is replaced by the elected producer list carried in the header, along with
+// their signing keys.
+func (s *DposSnapshot) apply(headers []*types.Header) (*DposSnapshot, error) {
+	// Allow passing in no headers for cleaner code
+	if len(headers) == 0 {
+		return s, nil
+	}
+	// Sanity check that the headers can be applied
+	for i := 0; i < len(headers)-1; i++ {
+		if headers[i+1].Number.Uint64() != headers[i].Number.Uint64()+1 {
+			return nil, errInvalidVotingChain
+		}
+	}
+	if headers[0].Number.Uint64() != s.Number+1 {
+		return nil, errInvalidVotingChain
+	}
+	// Iterate through the headers and create a new snapshot
+	snap := s.copy()
+
+	for _, header := range headers {
+		number := header.Number.Uint64()
+
+		// Resolve the producer of the block with the keys it was sealed under,
+		// which an epoch block rotates for the blocks after it only
+		sealer, err := ecrecover(header, s.sigcache)
+		if err != nil {
+			return nil, err
+		}
+		producer, ok := snap.producer(sealer, number)
+		if !ok {
+			producer = sealer
+		}
+		// Rotate the signer set on epoch blocks, restarting the recent signer
+		// window so that it only ever spans the current producer set
+		if number%s.config.Epoch == 0 {
+			signers, keys, previous := extractCheckpoint(header)
+			if len(signers) == 0 {
+				return nil, errInvalidCheckpointSigners
+			}
+			snap.Signers = make(map[common.Address]struct{})
+			for _, signer := range signers {
+				snap.Signers[signer] = struct{}{}
+			}
+			snap.Recents = make(map[uint64]common.Address)
+
+			// Shuffled schedules are taken in the checkpointed order
+			snap.Schedule = nil
+			if s.config.RegionShuffle {
+				snap.Schedule = signers
+			}
+			snap.setSigningKeys(signers, keys, previous)
+		}
+		// Track the producer of the block, dropping any that fell out of the window
+		snap.Recents[number] = producer
+
+		if limit := snap.recentLimit(); number >= limit {
+			for block := range snap.Recents {
+				if block <= number-limit {
+					delete(snap.Recents, block)
+				}
+			}
+		}
+	}
+	snap.Number += uint64(len(headers))
+	snap.Hash = headers[len(headers)-1].Hash()
+
+	return snap, nil
+}
+
 // signers retrieves the list of authorized signers in ascending order.
 func (s *DposSnapshot) signers() []common.Address {
 	signers := make([]common.Address, 0, len(s.Signers))
@@ -143,11 +286,96 @@ func (s *DposSnapshot) signers() []common.Address {
 	return signers
 }
 
-//// inturn returns if a signer at a given block height is in-turn or not.
-func (s *DposSnapshot) inturn(number uint64, signer common.Address) bool {
-	signers, offset := s.signers(), 0
-	for offset < len(signers) && signers[offset] != signer {
-		offset++
+// producer resolves the key that sealed the block number to the signer it sealed
+// for. A signer with a signing key can't seal with its own key, though the key a
+// signer sealed with before the last checkpoint still does during the grace
+// window following it.
+func (s *DposSnapshot) producer(sealer common.Address, number uint64) (common.Address, bool) {
+	if _, ok := s.Signers[sealer]; ok {
+		if _, delegated := s.SigningKeys[sealer]; !delegated {
+			return sealer, true
+		}
+	}
+	for signer, key := range s.SigningKeys {
+		if key == sealer {
+			return signer, true
+		}
+	}
+	if s.inGrace(number) {
+		for signer, key := range s.PreviousKeys {
+			if key == sealer {
+				return signer, true
+			}
+		}
+	}
+	return common.Address{}, false
+}
+
+// inGrace reports whether the block number falls within the grace window of the
+// key rotations of the last checkpoint, the epoch block itself excluded as it is
+// still sealed under the keys it replaces.
+func (s *DposSnapshot) inGrace(number uint64) bool {
+	offset := number % s.config.Epoch
+	return offset != 0 && offset <= s.config.KeyRotationGrace
+}
+
+// signingKey returns the key sealing the blocks of signer.
+func (s *DposSnapshot) signingKey(signer common.Address) common.Address {
+	if key, ok := s.SigningKeys[signer]; ok {
+		return key
+	}
+	return signer
+}
+
+// schedule retrieves the list of authorized signers in the order they take their
+// turns in: the checkpointed order if the schedule is shuffled, ascending order
+// otherwise.
+func (s *DposSnapshot) schedule() []common.Address {
+	if len(s.Schedule) > 0 {
+		return s.Schedule
+	}
+	return s.signers()
+}
+
+// scheduled returns the producer scheduled to seal in the slot covering the
+// given timestamp. Each producer holds ProducerRepetions consecutive slots per
+// turn, following the schedule order.
+func (s *DposSnapshot) scheduled(time uint64) common.Address {
+	signers := s.schedule()
+	if len(signers) == 0 {
+		return common.Address{}
+	}
+	index := slotOf(s.config, time) % (uint64(len(signers)) * s.config.ProducerRepetions)
+	return signers[index/s.config.ProducerRepetions]
+}
+
+// slotAt returns the slot starting at the given timestamp, the producer scheduled
+// to seal in it and the timestamp the slot ends at.
+func (s *DposSnapshot) slotAt(time uint64) (slot uint64, signer common.Address, deadline uint64) {
+	return slotOf(s.config, time), s.scheduled(time), time + slotPeriod(s.config)
+}
+
+// inturn returns if a signer at a given block timestamp is in-turn or not.
+func (s *DposSnapshot) inturn(time uint64, signer common.Address) bool {
+	return len(s.Signers) > 0 && s.scheduled(time) == signer
+}
+
+// recentLimit returns the number of most recent blocks tracked for spam
+// protection. A producer is expected to seal ProducerRepetions consecutive blocks
+// per turn, and then wait for at least half of the other producers to take theirs.
+func (s *DposSnapshot) recentLimit() uint64 {
+	return (uint64(len(s.Signers))/2+1)*s.config.ProducerRepetions - 1
+}
+
+// recentlySigned returns whether a signer has already sealed its share of the
+// recent blocks, and thus is not allowed to seal the given block number on top
+// of the snapshot.
+func (s *DposSnapshot) recentlySigned(number uint64, signer common.Address) bool {
+	limit, seen := s.recentLimit(), uint64(0)
+	for block, recent := range s.Recents {
+		if recent == signer && block < number && (number <= limit || block >= number-limit) {
+			seen++
+		}
 	}
-	return (number % uint64(len(signers))) == uint64(offset)
+	return seen >= s.config.ProducerRepetions
 }
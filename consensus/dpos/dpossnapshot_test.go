@@ -0,0 +1,964 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-ethereum library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package dpos
+
+import (
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/consensus"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/params"
+)
+
+// newTesterElection creates a committed state in which the given producers are
+// registered and elected, returning its root after attaching it to the chain.
+func newTesterElection(t *testing.T, chain *testerChain, producers []common.Address) common.Hash {
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(newTesterDatabase()))
+
+	for i, producer := range producers {
+		statedb.RegisterProducer(&producer, "http://producer")
+		statedb.UpdateProducerTotalVotes(&producer, big.NewInt(int64(len(producers)-i)))
+	}
+	statedb.SetDposTotalActivatedStake(vm.DposActivatedStakeThreshold)
+
+	root, err := statedb.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit election state: %v", err)
+	}
+	chain.states[root] = statedb
+	return root
+}
+
+// Tests that the signer set of a snapshot is rotated to the elected producer
+// list at epoch boundaries, and only there.
+func TestSnapshotEpochRotation(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 4, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+	initial := accounts.signers("A", "B")
+	elected := accounts.signers("A", "B", "C")
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(initial))
+
+	// Vote a new producer into the top set, committed in every block's state
+	root := newTesterElection(t, chain, elected)
+	statedb, _ := chain.StateAt(root)
+	if have := electedSigners(statedb, chain.Config(), big.NewInt(4)); !reflect.DeepEqual(have, elected) {
+		t.Fatalf("elected producer mismatch: have %x, want %x", have, elected)
+	}
+	// Import blocks up to the epoch boundary, the new producer may not seal yet
+	for i, name := range []string{"A", "B", "A"} {
+		header := newTesterHeader(config, chain.CurrentHeader(), accounts.address(name), nil)
+		header.Root = root
+		accounts.seal(engine, chain, header, name)
+		if err := engine.VerifyHeader(chain, header, true); err != nil {
+			t.Fatalf("block %d: failed to verify header: %v", i+1, err)
+		}
+		chain.insert(header)
+	}
+	header := newTesterHeader(config, chain.CurrentHeader(), accounts.address("C"), elected)
+	accounts.seal(engine, chain, header, "C")
+	if err := engine.VerifyHeader(chain, header, true); err != errUnauthorized {
+		t.Fatalf("unelected producer error mismatch: have %v, want %v", err, errUnauthorized)
+	}
+	// Non-epoch blocks may not carry a producer list at all
+	header = newTesterHeader(config, chain.GetHeaderByNumber(2), accounts.address("B"), elected)
+	accounts.seal(engine, chain, header, "B")
+	if err := engine.VerifyHeader(chain, header, true); err != errExtraSigners {
+		t.Fatalf("non-epoch rotation error mismatch: have %v, want %v", err, errExtraSigners)
+	}
+	// Import the epoch block carrying the elected list and check the rotation
+	header = newTesterHeader(config, chain.CurrentHeader(), accounts.address("B"), elected)
+	header.Root = root
+	accounts.seal(engine, chain, header, "B")
+	if err := engine.VerifyHeader(chain, header, true); err != nil {
+		t.Fatalf("failed to verify epoch header: %v", err)
+	}
+	chain.insert(header)
+
+	snap, err := engine.snapshot(chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if signers := snap.signers(); !reflect.DeepEqual(signers, elected) {
+		t.Fatalf("rotated signer mismatch: have %x, want %x", signers, elected)
+	}
+	header = newTesterHeader(config, chain.CurrentHeader(), accounts.address("C"), nil)
+	accounts.seal(engine, chain, header, "C")
+	if err := engine.VerifyHeader(chain, header, true); err != nil {
+		t.Fatalf("failed to verify header from elected producer: %v", err)
+	}
+}
+
+// Tests that the producer list checkpointed on top of a reorged chain is the one
+// elected on the new head's branch, when two branches elect different producers.
+func TestSnapshotElectionReorg(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 4, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+	genesis := newTesterGenesis(accounts.signers("A", "B"))
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, genesis)
+
+	// Build two branches up to the epoch boundary voting in different producers
+	branch := func(elected []common.Address) []*types.Header {
+		root := newTesterElection(t, chain, elected)
+
+		var headers []*types.Header
+		parent := genesis
+		for _, name := range []string{"A", "B", "A"} {
+			header := newTesterHeader(config, parent, accounts.address(name), nil)
+			header.Root = root
+			accounts.seal(engine, chain, header, name)
+			if err := engine.VerifyHeader(chain, header, true); err != nil {
+				t.Fatalf("block %d: failed to verify header: %v", header.Number, err)
+			}
+			chain.headers[header.Hash()] = header
+			headers, parent = append(headers, header), header
+		}
+		return headers
+	}
+	reorg := func(headers []*types.Header) {
+		chain.canon = chain.canon[:1]
+		for _, header := range headers {
+			chain.insert(header)
+		}
+	}
+	engine.Authorize(accounts.address("B"), accounts.signFn("B"))
+	prepare := func() *types.Header {
+		header := &types.Header{ParentHash: chain.CurrentHeader().Hash(), Number: big.NewInt(4), UncleHash: uncleHash}
+		if err := engine.Prepare(chain, header); err != nil {
+			t.Fatalf("failed to prepare epoch header: %v", err)
+		}
+		return header
+	}
+	var (
+		firstElected  = accounts.signers("A", "B", "C")
+		secondElected = accounts.signers("A", "B", "D")
+		first         = branch(firstElected)
+		second        = branch(secondElected)
+	)
+	reorg(first)
+	if signers := CheckpointSigners(prepare()); !reflect.DeepEqual(signers, firstElected) {
+		t.Fatalf("first branch checkpoint mismatch: have %x, want %x", signers, firstElected)
+	}
+	// Reorg onto the second branch, dropping the first one as the side events do
+	reorg(second)
+	for _, header := range first {
+		engine.Reorged(header.Hash())
+	}
+	for _, key := range engine.elections.Keys() {
+		if key.(electionKey).parent == first[len(first)-1].Hash() {
+			t.Errorf("election of reorged branch still cached")
+		}
+	}
+	checkpoint := prepare()
+	if signers := CheckpointSigners(checkpoint); !reflect.DeepEqual(signers, secondElected) {
+		t.Fatalf("second branch checkpoint mismatch: have %x, want %x", signers, secondElected)
+	}
+	parent, _ := chain.StateAt(second[len(second)-1].Root)
+	if err := engine.VerifyElection(chain, checkpoint, parent); err != nil {
+		t.Errorf("failed to verify second branch election: %v", err)
+	}
+	// Reorg back, the first branch's election being redone from its state
+	reorg(first)
+	for _, header := range second {
+		engine.Reorged(header.Hash())
+	}
+	if signers := CheckpointSigners(prepare()); !reflect.DeepEqual(signers, firstElected) {
+		t.Fatalf("restored branch checkpoint mismatch: have %x, want %x", signers, firstElected)
+	}
+}
+
+// Tests that an epoch header checkpointing a producer list other than the one
+// elected in its parent state is rejected by full nodes, while header-only
+// verification trusts the checkpoint and rotates onto it.
+func TestSnapshotMaliciousCheckpoint(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 2, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+	initial := accounts.signers("A", "B")
+	forged := accounts.signers("A", "D")
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(initial))
+	root := newTesterElection(t, chain, accounts.signers("A", "B", "C"))
+
+	header := newTesterHeader(config, chain.CurrentHeader(), accounts.address("A"), nil)
+	header.Root = root
+	accounts.seal(engine, chain, header, "A")
+	if err := engine.VerifyHeader(chain, header, true); err != nil {
+		t.Fatalf("failed to verify header: %v", err)
+	}
+	chain.insert(header)
+
+	checkpoint := newTesterHeader(config, chain.CurrentHeader(), accounts.address("B"), forged)
+	checkpoint.Root = root
+	accounts.seal(engine, chain, checkpoint, "B")
+
+	// Full nodes have the parent state and must reject the forged list
+	if err := engine.VerifyHeader(chain, checkpoint, true); err != errInvalidCheckpointSigners {
+		t.Fatalf("forged checkpoint error mismatch: have %v, want %v", err, errInvalidCheckpointSigners)
+	}
+	statedb, _ := chain.StateAt(root)
+	if err := engine.VerifyElection(chain, checkpoint, statedb); err != errInvalidCheckpointSigners {
+		t.Fatalf("forged election error mismatch: have %v, want %v", err, errInvalidCheckpointSigners)
+	}
+	// Headers without any elected producers must carry over the current set
+	empty, _ := state.New(common.Hash{}, state.NewDatabase(newTesterDatabase()))
+	if err := engine.VerifyElection(chain, checkpoint, empty); err != errInvalidCheckpointSigners {
+		t.Fatalf("unelected checkpoint error mismatch: have %v, want %v", err, errInvalidCheckpointSigners)
+	}
+	carried := newTesterHeader(config, chain.CurrentHeader(), accounts.address("B"), initial)
+	if err := engine.VerifyElection(chain, carried, empty); err != nil {
+		t.Fatalf("failed to verify carried over checkpoint: %v", err)
+	}
+	// Light clients lack the state, verify purely from headers and rotate
+	delete(chain.states, root)
+	if err := engine.VerifyHeader(chain, checkpoint, true); err != nil {
+		t.Fatalf("failed to verify checkpoint without state: %v", err)
+	}
+	chain.insert(checkpoint)
+
+	snap, err := engine.snapshot(chain, checkpoint.Number.Uint64(), checkpoint.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if signers := snap.signers(); !reflect.DeepEqual(signers, forged) {
+		t.Fatalf("checkpointed signer mismatch: have %x, want %x", signers, forged)
+	}
+}
+
+// Tests that a producer handing its sealing over to a signing key keeps sealing
+// with its own key until the next checkpoint, which carries the key, and only
+// with the key from then on, through a rotation onto another key.
+func TestSnapshotSigningKeyRotation(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 2, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+	producers := accounts.signers("A", "B")
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(producers))
+
+	// Register a signing key for A, rotated onto another one in a later state
+	delegate := func(parent common.Hash, key string) common.Hash {
+		statedb, _ := chain.StateAt(parent)
+		producer := accounts.address("A")
+		statedb.SetProducerSigningKey(&producer, accounts.address(key), 0, config.Epoch)
+
+		root, err := statedb.Commit(true)
+		if err != nil {
+			t.Fatalf("failed to commit signing key state: %v", err)
+		}
+		chain.states[root] = statedb
+		return root
+	}
+	first := delegate(newTesterElection(t, chain, producers), "K1")
+	second := delegate(first, "K2")
+
+	// seal signs the header with the named key, at the difficulty of its producer
+	seal := func(header *types.Header, key string) {
+		if snap, err := engine.snapshot(chain, header.Number.Uint64()-1, header.ParentHash, nil); err == nil {
+			header.Difficulty = CalcDifficulty(snap, header.Time.Uint64(), header.Coinbase)
+		}
+		accounts.sign(header, key)
+	}
+	// checkpoint assembles an epoch header delegating the sealing of A to key
+	keys := func(key string) []common.Address {
+		keys := make([]common.Address, len(producers))
+		for i, producer := range producers {
+			keys[i] = producer
+			if producer == accounts.address("A") {
+				keys[i] = accounts.address(key)
+			}
+		}
+		return keys
+	}
+	checkpoint := func(root common.Hash, key string) *types.Header {
+		header := newTesterHeader(config, chain.CurrentHeader(), accounts.address("B"), nil)
+		header.Root = root
+		header.Extra = (&headerExtra{Version: extraVersion1, Signers: producers, Keys: keys(key)}).encode()
+		seal(header, "B")
+		return header
+	}
+	// The signing key only takes over from the checkpoint on
+	header := newTesterHeader(config, chain.CurrentHeader(), accounts.address("A"), nil)
+	header.Root = first
+	seal(header, "K1")
+	if err := engine.VerifyHeader(chain, header, true); err != errUnauthorized {
+		t.Fatalf("early signing key error mismatch: have %v, want %v", err, errUnauthorized)
+	}
+	seal(header, "A")
+	if err := engine.VerifyHeader(chain, header, true); err != nil {
+		t.Fatalf("failed to verify header sealed by own key: %v", err)
+	}
+	chain.insert(header)
+
+	// The checkpoint needs to carry the registered key, which Prepare lays out
+	plain := newTesterHeader(config, chain.CurrentHeader(), accounts.address("B"), producers)
+	plain.Root = first
+	seal(plain, "B")
+	if err := engine.VerifyHeader(chain, plain, true); err != errInvalidCheckpointSigners {
+		t.Fatalf("missing signing key error mismatch: have %v, want %v", err, errInvalidCheckpointSigners)
+	}
+	if err := engine.VerifyHeader(chain, checkpoint(first, "K2"), true); err != errInvalidCheckpointSigners {
+		t.Fatalf("wrong signing key error mismatch: have %v, want %v", err, errInvalidCheckpointSigners)
+	}
+	preparer := newTesterEngine(config)
+	preparer.Authorize(accounts.address("B"), accounts.signFn("B"))
+
+	prepared := &types.Header{ParentHash: chain.CurrentHeader().Hash(), Number: big.NewInt(2)}
+	if err := preparer.Prepare(chain, prepared); err != nil {
+		t.Fatalf("failed to prepare checkpoint: %v", err)
+	}
+	extra, err := parseExtra(prepared.Extra, true)
+	if err != nil || extra.Version != extraVersion1 {
+		t.Fatalf("prepared checkpoint layout mismatch: %v", err)
+	}
+	if !reflect.DeepEqual(extra.Keys, keys("K1")) {
+		t.Fatalf("prepared signing key mismatch: have %x, want %x", extra.Keys, keys("K1"))
+	}
+	header = checkpoint(first, "K1")
+	if err := engine.VerifyHeader(chain, header, true); err != nil {
+		t.Fatalf("failed to verify checkpoint: %v", err)
+	}
+	chain.insert(header)
+
+	// From then on only the signing key seals for A, and only for A
+	for _, tt := range []struct {
+		coinbase, key string
+		err           error
+	}{
+		{"A", "A", errUnauthorized},
+		{"K1", "K1", errUnauthorized},
+		{"B", "K1", errUnauthorized},
+		{"A", "K2", errUnauthorized},
+		{"A", "K1", nil},
+	} {
+		header = newTesterHeader(config, chain.CurrentHeader(), accounts.address(tt.coinbase), nil)
+		header.Root = second
+		seal(header, tt.key)
+		if err := engine.VerifyHeader(chain, header, true); err != tt.err {
+			t.Fatalf("coinbase %s sealed by %s: error mismatch: have %v, want %v", tt.coinbase, tt.key, err, tt.err)
+		}
+	}
+	chain.insert(header)
+
+	if author, err := engine.Author(header); err != nil || author != accounts.address("A") {
+		t.Fatalf("author mismatch: have %x (%v), want %x", author, err, accounts.address("A"))
+	}
+	// The local sealer is refused for the blocks of A unless holding the key
+	sealer := newTesterEngine(config)
+	sealer.Authorize(accounts.address("A"), accounts.signFn("A"))
+
+	block := types.NewBlockWithHeader(newTesterHeader(config, chain.CurrentHeader(), accounts.address("A"), producers))
+	if _, err := sealer.Seal(chain, block, nil); err != errUnauthorized {
+		t.Fatalf("own key seal error mismatch: have %v, want %v", err, errUnauthorized)
+	}
+	// Rotate onto the second key at the next checkpoint
+	header = checkpoint(second, "K2")
+	if err := engine.VerifyHeader(chain, header, true); err != nil {
+		t.Fatalf("failed to verify rotating checkpoint: %v", err)
+	}
+	chain.insert(header)
+
+	for _, tt := range []struct {
+		key string
+		err error
+	}{
+		{"K1", errUnauthorized},
+		{"A", errUnauthorized},
+		{"K2", nil},
+	} {
+		header = newTesterHeader(config, chain.CurrentHeader(), accounts.address("A"), nil)
+		header.Root = second
+		seal(header, tt.key)
+		if err := engine.VerifyHeader(chain, header, true); err != tt.err {
+			t.Fatalf("rotated key sealed by %s: error mismatch: have %v, want %v", tt.key, err, tt.err)
+		}
+	}
+	chain.insert(header)
+
+	// The snapshot tracks the producer, both fresh and reloaded
+	snap, err := engine.snapshot(chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if recent := snap.Recents[header.Number.Uint64()]; recent != accounts.address("A") {
+		t.Errorf("recent signer mismatch: have %x, want %x", recent, accounts.address("A"))
+	}
+	if key := snap.signingKey(accounts.address("A")); key != accounts.address("K2") {
+		t.Errorf("signing key mismatch: have %x, want %x", key, accounts.address("K2"))
+	}
+	blob, _ := json.Marshal(snap)
+	reloaded := new(DposSnapshot)
+	if err := json.Unmarshal(blob, reloaded); err != nil {
+		t.Fatalf("failed to decode snapshot: %v", err)
+	}
+	if !reflect.DeepEqual(reloaded.SigningKeys, snap.SigningKeys) {
+		t.Errorf("reloaded signing keys mismatch: have %x, want %x", reloaded.SigningKeys, snap.SigningKeys)
+	}
+}
+
+// Tests that the key a producer sealed with before rotating onto a signing key
+// keeps sealing for it alongside the new key up to the last block of the grace
+// window following the checkpoint, and no longer from the block after it.
+func TestSnapshotSigningKeyGrace(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 4, ProducerRepetions: 1, KeyRotationGrace: 2}
+	accounts := newTesterAccountPool()
+	producers := accounts.signers("A", "B", "C")
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(producers))
+
+	// Register a signing key for A ahead of the first checkpoint
+	statedb, _ := chain.StateAt(newTesterElection(t, chain, producers))
+	producer := accounts.address("A")
+	statedb.SetProducerSigningKey(&producer, accounts.address("K1"), 1, config.Epoch)
+
+	root, err := statedb.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit signing key state: %v", err)
+	}
+	chain.states[root] = statedb
+
+	// extend creates a child of the chain head for coinbase, sealed with key at the
+	// difficulty of its producer
+	extend := func(coinbase, key string, signers []common.Address) *types.Header {
+		header := newTesterHeader(config, chain.CurrentHeader(), accounts.address(coinbase), signers)
+		header.Root = root
+		if snap, err := engine.snapshot(chain, header.Number.Uint64()-1, header.ParentHash, nil); err == nil {
+			header.Difficulty = CalcDifficulty(snap, header.Time.Uint64(), header.Coinbase)
+		}
+		accounts.sign(header, key)
+		return header
+	}
+	for _, name := range []string{"A", "B", "C"} {
+		header := extend(name, name, nil)
+		if err := engine.VerifyHeader(chain, header, true); err != nil {
+			t.Fatalf("failed to verify header sealed by %s: %v", name, err)
+		}
+		chain.insert(header)
+	}
+	// The checkpoint needs to carry the replaced key along, which Prepare lays out
+	keys := make([]common.Address, len(producers))
+	for i, signer := range producers {
+		keys[i] = signer
+		if signer == producer {
+			keys[i] = accounts.address("K1")
+		}
+	}
+	checkpoint := extend("B", "B", nil)
+	checkpoint.Extra = (&headerExtra{Version: extraVersion1, Signers: producers, Keys: keys}).encode()
+	accounts.sign(checkpoint, "B")
+	if err := engine.VerifyHeader(chain, checkpoint, true); err != errInvalidCheckpointSigners {
+		t.Fatalf("missing previous key error mismatch: have %v, want %v", err, errInvalidCheckpointSigners)
+	}
+	preparer := newTesterEngine(config)
+	preparer.Authorize(accounts.address("B"), accounts.signFn("B"))
+
+	prepared := &types.Header{ParentHash: chain.CurrentHeader().Hash(), Number: big.NewInt(4)}
+	if err := preparer.Prepare(chain, prepared); err != nil {
+		t.Fatalf("failed to prepare checkpoint: %v", err)
+	}
+	extra, err := parseExtra(prepared.Extra, true)
+	if err != nil || extra.Version != extraVersion2 {
+		t.Fatalf("prepared checkpoint layout mismatch: %v", err)
+	}
+	if !reflect.DeepEqual(extra.Keys, keys) || !reflect.DeepEqual(extra.Previous, producers) {
+		t.Fatalf("prepared signing keys mismatch: have %x and %x, want %x and %x", extra.Keys, extra.Previous, keys, producers)
+	}
+	checkpoint.Extra = (&headerExtra{Version: extraVersion2, Signers: producers, Keys: keys, Previous: producers}).encode()
+	accounts.sign(checkpoint, "B")
+	if err := engine.VerifyHeader(chain, checkpoint, true); err != nil {
+		t.Fatalf("failed to verify checkpoint: %v", err)
+	}
+	chain.insert(checkpoint)
+	chain.insert(extend("C", "C", nil))
+
+	// seal seals a child of the chain head for A with its own key through the engine
+	seal := func() (*types.Block, error) {
+		sealer := newTesterEngine(config)
+		sealer.Authorize(producer, accounts.signFn("A"))
+
+		header := extend("A", "A", nil)
+		clock := newTesterClock(time.Unix(header.Time.Int64(), 0))
+		clock.fire <- clock.now
+		sealer.clock = clock
+
+		return sealer.Seal(chain, types.NewBlockWithHeader(header), make(chan struct{}))
+	}
+	// Both keys seal the last block of the grace window
+	for _, key := range []string{"A", "K1"} {
+		if err := engine.VerifyHeader(chain, extend("A", key, nil), true); err != nil {
+			t.Fatalf("boundary block sealed by %s: failed to verify: %v", key, err)
+		}
+	}
+	block, err := seal()
+	if err != nil {
+		t.Fatalf("failed to seal boundary block with replaced key: %v", err)
+	}
+	if err := engine.VerifyHeader(chain, block.Header(), true); err != nil {
+		t.Fatalf("failed to verify boundary block sealed by the engine: %v", err)
+	}
+	chain.insert(extend("B", "B", nil))
+
+	// Only the new key seals the block after it
+	for _, tt := range []struct {
+		key string
+		err error
+	}{
+		{"A", errUnauthorized},
+		{"K1", nil},
+	} {
+		if err := engine.VerifyHeader(chain, extend("A", tt.key, nil), true); err != tt.err {
+			t.Fatalf("block after grace sealed by %s: error mismatch: have %v, want %v", tt.key, err, tt.err)
+		}
+	}
+	if _, err := seal(); err != errUnauthorized {
+		t.Fatalf("replaced key seal after grace error mismatch: have %v, want %v", err, errUnauthorized)
+	}
+	// The snapshot tracks the replaced key, both fresh and reloaded
+	snap, err := engine.snapshot(chain, chain.CurrentHeader().Number.Uint64(), chain.CurrentHeader().Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if key := snap.PreviousKeys[producer]; key != producer {
+		t.Errorf("previous key mismatch: have %x, want %x", key, producer)
+	}
+	blob, _ := json.Marshal(snap)
+	reloaded := new(DposSnapshot)
+	if err := json.Unmarshal(blob, reloaded); err != nil {
+		t.Fatalf("failed to decode snapshot: %v", err)
+	}
+	if !reflect.DeepEqual(reloaded.PreviousKeys, snap.PreviousKeys) {
+		t.Errorf("reloaded previous keys mismatch: have %x, want %x", reloaded.PreviousKeys, snap.PreviousKeys)
+	}
+}
+
+// Tests that applying a non-contiguous batch of headers is rejected.
+func TestSnapshotApplyNonContiguous(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 4, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+	signers := accounts.signers("A")
+
+	genesis := newTesterGenesis(signers)
+	snap := newSnapshot(config, nil, 0, genesis.Hash(), signers)
+
+	first := newTesterHeader(config, genesis, accounts.address("A"), nil)
+	third := newTesterHeader(config, newTesterHeader(config, first, accounts.address("A"), nil), accounts.address("A"), nil)
+	if _, err := snap.apply([]*types.Header{first, third}); err != errInvalidVotingChain {
+		t.Fatalf("gapped batch error mismatch: have %v, want %v", err, errInvalidVotingChain)
+	}
+	if _, err := snap.apply([]*types.Header{third}); err != errInvalidVotingChain {
+		t.Fatalf("detached batch error mismatch: have %v, want %v", err, errInvalidVotingChain)
+	}
+}
+
+// Tests that producers are scheduled in sorted order, each holding the configured
+// number of consecutive slots, and that exactly one producer is in-turn per slot.
+func TestSnapshotInturn(t *testing.T) {
+	accounts := newTesterAccountPool()
+	signers := accounts.signers("A", "B", "C", "D")
+	outsider := accounts.address("E")
+
+	for _, repetitions := range []uint64{1, 3} {
+		config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: repetitions}
+		snap := newSnapshot(config, nil, 0, common.Hash{}, signers)
+
+		for time := uint64(1000); time < 1000+2*uint64(len(signers))*repetitions; time++ {
+			want := signers[(time/repetitions)%uint64(len(signers))]
+			if have := snap.scheduled(time); have != want {
+				t.Fatalf("repetitions %d, time %d: scheduled producer mismatch: have %x, want %x", repetitions, time, have, want)
+			}
+			inturn := 0
+			for _, signer := range signers {
+				if snap.inturn(time, signer) {
+					inturn++
+					if diff := CalcDifficulty(snap, time, signer); diff.Cmp(diffInTurn) != 0 {
+						t.Errorf("repetitions %d, time %d: in-turn difficulty mismatch: have %v, want %v", repetitions, time, diff, diffInTurn)
+					}
+				} else if diff := CalcDifficulty(snap, time, signer); diff.Cmp(diffNoTurn) != 0 {
+					t.Errorf("repetitions %d, time %d: out-of-turn difficulty mismatch: have %v, want %v", repetitions, time, diff, diffNoTurn)
+				}
+			}
+			if inturn != 1 {
+				t.Errorf("repetitions %d, time %d: in-turn producer count mismatch: have %d, want 1", repetitions, time, inturn)
+			}
+			if snap.inturn(time, outsider) {
+				t.Errorf("repetitions %d, time %d: unauthorized producer in-turn", repetitions, time)
+			}
+		}
+	}
+	if snap := newSnapshot(&params.DposConfig{ProducerRepetions: 1}, nil, 0, common.Hash{}, nil); snap.inturn(0, common.Address{}) {
+		t.Errorf("empty signer set has an in-turn producer")
+	}
+}
+
+// newTesterTurn creates a header carrying the given signer list, sealed by the
+// named producer on top of parent and delayed until the producer is in-turn.
+func newTesterTurn(engine *Dpos, chain *testerChain, accounts *testerAccountPool, parent *types.Header, name string, signers []common.Address) *types.Header {
+	config := chain.Config().Dpos
+	snap, _ := engine.snapshot(chain, parent.Number.Uint64(), parent.Hash(), nil)
+
+	header := newTesterHeader(config, parent, accounts.address(name), signers)
+	for !snap.inturn(header.Time.Uint64(), header.Coinbase) {
+		header.Time.Add(header.Time, common.Big1)
+	}
+	accounts.seal(engine, chain, header, name)
+	return header
+}
+
+// Tests that a producer sealing more than its share of consecutive blocks gets
+// rejected from the checkpoint fork on, even when the schedule would otherwise
+// put it in-turn.
+func TestSnapshotRecentlySigned(t *testing.T) {
+	tests := []struct {
+		repetitions uint64
+		producers   []string
+		sealers     []string
+		failure     error
+	}{
+		// Single producer is allowed to seal every block
+		{1, []string{"A"}, []string{"A", "A", "A"}, nil},
+		// Producers taking turns is allowed
+		{1, []string{"A", "B", "C"}, []string{"A", "B", "C", "A", "B", "C"}, nil},
+		// Two producers taking turns out of three is allowed
+		{1, []string{"A", "B", "C"}, []string{"A", "B", "A", "B"}, nil},
+		// Same producer sealing consecutive blocks is rejected
+		{1, []string{"A", "B", "C"}, []string{"A", "B", "B"}, errRecentlySigned},
+		// Producers may seal up to the configured repetitions in a row
+		{2, []string{"A", "B", "C"}, []string{"A", "A", "B", "B", "C", "C", "A", "A"}, nil},
+		// But not more
+		{2, []string{"A", "B", "C"}, []string{"A", "A", "A"}, errRecentlySigned},
+		// Nor return before half of the others had their turn
+		{2, []string{"A", "B", "C"}, []string{"A", "A", "B", "A"}, errRecentlySigned},
+	}
+	for i, tt := range tests {
+		config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: tt.repetitions}
+		accounts := newTesterAccountPool()
+
+		engine := newTesterEngine(config)
+		chain := newTesterChain(config, newTesterGenesis(accounts.signers(tt.producers...)))
+
+		var err error
+		for j, name := range tt.sealers {
+			header := newTesterTurn(engine, chain, accounts, chain.CurrentHeader(), name, nil)
+			if err = engine.VerifyHeader(chain, header, true); err != nil {
+				if j != len(tt.sealers)-1 {
+					t.Errorf("test %d: block %d: failed to verify header: %v", i, j+1, err)
+				}
+				break
+			}
+			chain.insert(header)
+		}
+		if err != tt.failure {
+			t.Errorf("test %d: failure mismatch: have %v, want %v", i, err, tt.failure)
+		}
+	}
+	// Before the checkpoint fork a producer may seal any number of blocks in a row
+	config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+	signers := accounts.signers("A", "B", "C")
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(signers))
+	chain.config.DposCheckpointBlock = nil
+
+	for i := 0; i < 3; i++ {
+		header := newTesterHeader(config, chain.CurrentHeader(), accounts.address("A"), signers)
+		accounts.sign(header, "A")
+		if err := engine.VerifyHeader(chain, header, true); err != nil {
+			t.Fatalf("legacy block %d: failed to verify header: %v", i+1, err)
+		}
+		chain.insert(header)
+	}
+}
+
+// Tests that the recent signer window only retains the most recent blocks and
+// is restarted on epoch transitions.
+func TestSnapshotRecents(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 6, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+	signers := accounts.signers("A", "B", "C", "D", "E")
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(signers))
+	for i, name := range []string{"A", "B", "C", "D", "E", "A"} {
+		var checkpoint []common.Address
+		if uint64(i+1)%config.Epoch == 0 {
+			checkpoint = signers
+		}
+		chain.insert(newTesterTurn(engine, chain, accounts, chain.CurrentHeader(), name, checkpoint))
+	}
+	// Five producers can't seal twice within three blocks, so only the last two
+	// blocks need to be tracked
+	head := chain.GetHeaderByNumber(5)
+	snap, err := engine.snapshot(chain, 5, head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	want := map[uint64]common.Address{4: accounts.address("D"), 5: accounts.address("E")}
+	if !reflect.DeepEqual(snap.Recents, want) {
+		t.Errorf("recents mismatch: have %v, want %v", snap.Recents, want)
+	}
+	// The epoch block restarts the window, whether the snapshot is cached or not
+	head = chain.CurrentHeader()
+	want = map[uint64]common.Address{6: accounts.address("A")}
+
+	snap, err = engine.snapshot(chain, 6, head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	if !reflect.DeepEqual(snap.Recents, want) {
+		t.Errorf("cached recents mismatch: have %v, want %v", snap.Recents, want)
+	}
+	snap, err = newTesterEngine(config).snapshot(chain, 6, head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to create snapshot: %v", err)
+	}
+	if !reflect.DeepEqual(snap.Recents, want) {
+		t.Errorf("fresh recents mismatch: have %v, want %v", snap.Recents, want)
+	}
+}
+
+// Tests that snapshots are served from memory when cached, persisted on every
+// checkpoint interval, reconstructed from the nearest persisted ancestor when
+// evicted, and garbage collected beyond the retention window.
+func TestSnapshotPersistence(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: 1, SnapshotRetention: 2 * checkpointInterval}
+	accounts := newTesterAccountPool()
+
+	db := newTesterDatabase()
+	engine := New(config, db)
+	chain := newTesterChain(config, newTesterGenesis(accounts.signers("A", "B", "C")))
+
+	// Import a chain long enough to persist a few snapshots, verifying each
+	// block as an importing node would
+	blocks := 3*checkpointInterval + checkpointInterval/2
+	for i := 0; i < blocks; i++ {
+		header := newTesterTurn(engine, chain, accounts, chain.CurrentHeader(), []string{"A", "B", "C"}[i%3], nil)
+		if err := engine.VerifyHeader(chain, header, true); err != nil {
+			t.Fatalf("block %d: failed to verify header: %v", i+1, err)
+		}
+		chain.insert(header)
+	}
+	// Cached snapshots are served as is
+	head := chain.CurrentHeader()
+	cached, err := engine.snapshot(chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve head snapshot: %v", err)
+	}
+	if snap, _ := engine.snapshot(chain, head.Number.Uint64(), head.Hash(), nil); snap != cached {
+		t.Errorf("cached snapshot not reused")
+	}
+	// Only the checkpoint snapshots within the retention window are persisted
+	for number := uint64(1); number <= uint64(blocks); number++ {
+		hash := chain.GetHeaderByNumber(number).Hash()
+		stored, _ := db.Has(snapshotKey(number, hash))
+
+		want := number%checkpointInterval == 0 && number+config.SnapshotRetention >= 3*checkpointInterval
+		if stored != want {
+			t.Errorf("block %d: persistence mismatch: have %v, want %v", number, stored, want)
+		}
+	}
+	// Drop everything before the last persisted snapshot from the chain and the
+	// caches, ensuring that the head snapshot is reconstructed from disk
+	for number := uint64(1); number < 3*checkpointInterval; number++ {
+		delete(chain.headers, chain.GetHeaderByNumber(number).Hash())
+	}
+	fresh := New(config, db)
+	snap, err := fresh.snapshot(chain, head.Number.Uint64(), head.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to reconstruct snapshot from disk: %v", err)
+	}
+	if !reflect.DeepEqual(snap.Signers, cached.Signers) || !reflect.DeepEqual(snap.Recents, cached.Recents) {
+		t.Errorf("reconstructed snapshot mismatch: have %v/%v, want %v/%v", snap.Signers, snap.Recents, cached.Signers, cached.Recents)
+	}
+	if snap.Number != cached.Number || snap.Hash != cached.Hash {
+		t.Errorf("reconstructed snapshot position mismatch: have #%d [%x], want #%d [%x]", snap.Number, snap.Hash, cached.Number, cached.Hash)
+	}
+	// Without the persisted snapshot, the pruned chain can't be walked anymore
+	if _, err := New(config, newTesterDatabase()).snapshot(chain, head.Number.Uint64(), head.Hash(), nil); err != consensus.ErrUnknownAncestor {
+		t.Errorf("snapshot reconstruction error mismatch: have %v, want %v", err, consensus.ErrUnknownAncestor)
+	}
+}
+
+// Tests that the snapshots and evidence persisted while verifying a header only
+// become visible once the batch is written, a crash before leaving the previous
+// snapshots, evidence and their indexes intact.
+func TestSnapshotBatchAtomicity(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: 1, SnapshotRetention: checkpointInterval / 2}
+	signers := []common.Address{{0x01}, {0x02}}
+
+	db := newTesterDatabase()
+	engine := New(config, db)
+
+	first := newSnapshot(config, nil, checkpointInterval, common.Hash{0x01}, signers)
+	batch := engine.newStoreBatch()
+	if err := engine.storeSnapshot(batch, first); err != nil {
+		t.Fatalf("failed to store snapshot: %v", err)
+	}
+	if err := batch.write(); err != nil {
+		t.Fatalf("failed to write snapshot: %v", err)
+	}
+	// Persist a snapshot pruning the first one along with some evidence, but
+	// crash before writing the batch out
+	second := newSnapshot(config, nil, 2*checkpointInterval, common.Hash{0x02}, signers)
+	evidence := &Evidence{
+		Signer: signers[0],
+		Number: second.Number,
+		First:  &types.Header{Number: new(big.Int).SetUint64(second.Number), Extra: []byte{0x01}},
+		Second: &types.Header{Number: new(big.Int).SetUint64(second.Number), Extra: []byte{0x02}},
+	}
+	batch = engine.newStoreBatch()
+	if err := engine.storeSnapshot(batch, second); err != nil {
+		t.Fatalf("failed to store snapshot: %v", err)
+	}
+	if err := engine.storeEvidence(batch, evidence); err != nil {
+		t.Fatalf("failed to store evidence: %v", err)
+	}
+	restarted := New(config, db)
+	if _, err := loadSnapshot(config, nil, db, second.Number, second.Hash); err == nil {
+		t.Errorf("unwritten snapshot readable")
+	}
+	if _, err := loadSnapshot(config, nil, db, first.Number, first.Hash); err != nil {
+		t.Errorf("pruned snapshot lost before writing: %v", err)
+	}
+	if evidences, err := restarted.evidence(nil); err != nil || len(evidences) != 0 {
+		t.Errorf("unwritten evidence readable: %v, %v", evidences, err)
+	}
+	if ok, _ := db.Has(evidenceKey(evidence.Number, evidence.Signer)); ok {
+		t.Errorf("unwritten evidence in database")
+	}
+	// Once written, everything shows up at once
+	if err := batch.write(); err != nil {
+		t.Fatalf("failed to write batch: %v", err)
+	}
+	if _, err := loadSnapshot(config, nil, db, second.Number, second.Hash); err != nil {
+		t.Errorf("written snapshot not readable: %v", err)
+	}
+	if _, err := loadSnapshot(config, nil, db, first.Number, first.Hash); err == nil {
+		t.Errorf("pruned snapshot still readable")
+	}
+	if evidences, err := restarted.evidence(nil); err != nil || len(evidences) != 1 {
+		t.Errorf("written evidence not readable: %v, %v", evidences, err)
+	}
+}
+
+// Tests that checkpoint snapshots built straight from an epoch header, without
+// any headers applied on top, are persisted too.
+func TestSnapshotPersistenceAtEpoch(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: checkpointInterval, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+	signers := accounts.signers("A", "B", "C")
+
+	db := newTesterDatabase()
+	engine := New(config, db)
+	chain := newTesterChain(config, newTesterGenesis(signers))
+
+	for i := 0; i < checkpointInterval+1; i++ {
+		var checkpoint []common.Address
+		if uint64(i+1)%config.Epoch == 0 {
+			checkpoint = signers
+		}
+		header := newTesterTurn(engine, chain, accounts, chain.CurrentHeader(), []string{"A", "B", "C"}[i%3], checkpoint)
+		if err := engine.VerifyHeader(chain, header, true); err != nil {
+			t.Fatalf("block %d: failed to verify header: %v", i+1, err)
+		}
+		chain.insert(header)
+	}
+	epoch := chain.GetHeaderByNumber(checkpointInterval)
+	if stored, _ := db.Has(snapshotKey(epoch.Number.Uint64(), epoch.Hash())); !stored {
+		t.Errorf("epoch snapshot not persisted")
+	}
+}
+
+// Tests that snapshots persisted under the legacy keys are still loaded.
+func TestLegacySnapshotLoad(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: 1}
+	snap := newSnapshot(config, nil, checkpointInterval, common.Hash{0x01}, []common.Address{{0x01}})
+
+	db := newTesterDatabase()
+	blob, _ := json.Marshal(snap)
+	db.Put(legacySnapshotKey(snap.Hash), blob)
+
+	loaded, err := loadSnapshot(config, nil, db, snap.Number, snap.Hash)
+	if err != nil {
+		t.Fatalf("failed to load legacy snapshot: %v", err)
+	}
+	if loaded.Number != snap.Number || !reflect.DeepEqual(loaded.Signers, snap.Signers) {
+		t.Errorf("legacy snapshot mismatch: have #%d %v, want #%d %v", loaded.Number, loaded.Signers, snap.Number, snap.Signers)
+	}
+}
+
+// Tests that headers before the checkpoint fork carry the producer list in
+// effect for their children, any of them rotating it, and that only epoch
+// headers carry it from the fork on.
+func TestSnapshotCheckpointFork(t *testing.T) {
+	config := &params.DposConfig{Period: 1, Epoch: 4, ProducerRepetions: 1}
+	accounts := newTesterAccountPool()
+	initial := accounts.signers("A", "B")
+	rotated := accounts.signers("A", "B", "C")
+
+	engine := newTesterEngine(config)
+	chain := newTesterChain(config, newTesterGenesis(initial))
+	chain.config.DposCheckpointBlock = big.NewInt(3)
+
+	// Legacy headers need to carry a producer list, which may differ from the
+	// one of their parent
+	header := newTesterTurn(engine, chain, accounts, chain.CurrentHeader(), "A", nil)
+	if err := engine.VerifyHeader(chain, header, true); err != errInvalidCheckpointSigners {
+		t.Fatalf("legacy header without signers error mismatch: have %v, want %v", err, errInvalidCheckpointSigners)
+	}
+	header = newTesterTurn(engine, chain, accounts, chain.CurrentHeader(), "A", rotated)
+	if err := engine.VerifyHeader(chain, header, true); err != nil {
+		t.Fatalf("failed to verify rotating legacy header: %v", err)
+	}
+	chain.insert(header)
+
+	header = newTesterTurn(engine, chain, accounts, chain.CurrentHeader(), "C", rotated)
+	if err := engine.VerifyHeader(chain, header, true); err != nil {
+		t.Fatalf("failed to verify legacy header from rotated producer: %v", err)
+	}
+	chain.insert(header)
+
+	// From the fork on non-epoch headers may not carry the list anymore
+	header = newTesterTurn(engine, chain, accounts, chain.CurrentHeader(), "B", rotated)
+	if err := engine.VerifyHeader(chain, header, true); err != errExtraSigners {
+		t.Fatalf("forked header with signers error mismatch: have %v, want %v", err, errExtraSigners)
+	}
+	header = newTesterTurn(engine, chain, accounts, chain.CurrentHeader(), "B", nil)
+	if err := engine.VerifyHeader(chain, header, true); err != nil {
+		t.Fatalf("failed to verify forked header: %v", err)
+	}
+	chain.insert(header)
+
+	snap, err := engine.snapshot(chain, header.Number.Uint64(), header.Hash(), nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve snapshot: %v", err)
+	}
+	if signers := snap.signers(); !reflect.DeepEqual(signers, rotated) {
+		t.Errorf("signer mismatch across the fork: have %x, want %x", signers, rotated)
+	}
+}
@@ -0,0 +1,190 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package kyc is a Go binding of the KYC and DPoS precompile, usable with any
+// bind.ContractBackend such as wonclient or the simulated backend.
+//
+// The precompile doesn't speak the contract ABI but the packed inputs of the
+// kycabi package, so the binding is written against those instead of being
+// generated by abigen.
+package kyc
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"math/big"
+
+	"github.com/worldopennetwork/go-won"
+	"github.com/worldopennetwork/go-won/accounts/abi"
+	"github.com/worldopennetwork/go-won/accounts/abi/bind"
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/core/vm/kycabi"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rlp"
+)
+
+// callGas is the gas allowed for executing a transaction of the precompile on
+// top of its intrinsic gas, enough for its largest calls. Unused gas is refunded.
+const callGas = 1000000
+
+// errInvalidThresholds is returned when the level thresholds returned by the
+// precompile don't decode.
+var errInvalidThresholds = errors.New("invalid level thresholds")
+
+// Kyc is a binding of the KYC and DPoS precompile at vm.KycContractAddress.
+type Kyc struct {
+	contract *bind.BoundContract
+	backend  bind.ContractBackend
+}
+
+// NewKyc creates a binding of the precompile transacting and calling through
+// backend.
+func NewKyc(backend bind.ContractBackend) *Kyc {
+	return &Kyc{
+		contract: bind.NewBoundContract(vm.KycContractAddress, abi.ABI{}, backend, backend, backend),
+		backend:  backend,
+	}
+}
+
+// Transact sends a transaction making the given call of the precompile. If the
+// gas limit is left zero in opts, the intrinsic gas of the call plus callGas is
+// allowed, as the precompile can't be gas estimated: it silently skips calls it
+// isn't given enough gas for instead of failing them.
+func (k *Kyc) Transact(opts *bind.TransactOpts, call kycabi.Call) (*types.Transaction, error) {
+	input := call.Pack()
+	if opts.GasLimit == 0 {
+		gas, err := core.IntrinsicGas(input, false, params.GasTableEIP158)
+		if err != nil {
+			return nil, err
+		}
+		limited := *opts
+		limited.GasLimit = gas + callGas
+		opts = &limited
+	}
+	return k.contract.RawTransact(opts, input)
+}
+
+// SetKyc sets the KYC level and zone of addr, as a provider.
+func (k *Kyc) SetKyc(opts *bind.TransactOpts, addr common.Address, level uint32, zone uint32) (*types.Transaction, error) {
+	return k.Transact(opts, &kycabi.SetKyc{Address: addr, Level: level, Zone: zone})
+}
+
+// RegisterProducer registers the sender as a block producer reachable at url.
+func (k *Kyc) RegisterProducer(opts *bind.TransactOpts, url string) (*types.Transaction, error) {
+	return k.Transact(opts, &kycabi.RegisterProducer{URL: url})
+}
+
+// UnregisterProducer unregisters the sender as a block producer.
+func (k *Kyc) UnregisterProducer(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return k.Transact(opts, &kycabi.UnregisterProducer{})
+}
+
+// AddStake locks up amount of the balance of the sender as voting stake.
+func (k *Kyc) AddStake(opts *bind.TransactOpts, amount *big.Int) (*types.Transaction, error) {
+	return k.Transact(opts, &kycabi.AddStake{Value: amount})
+}
+
+// SubStake requests a refund of amount of the stake of the sender.
+func (k *Kyc) SubStake(opts *bind.TransactOpts, amount *big.Int) (*types.Transaction, error) {
+	return k.Transact(opts, &kycabi.SubStake{Value: amount})
+}
+
+// VoteProducers votes for producers with the stake of the sender, replacing its
+// previous votes.
+func (k *Kyc) VoteProducers(opts *bind.TransactOpts, producers []common.Address) (*types.Transaction, error) {
+	return k.Transact(opts, &kycabi.VoteProducers{Producers: producers})
+}
+
+// Refund pays out the stake refund requested by the sender once it's due.
+func (k *Kyc) Refund(opts *bind.TransactOpts) (*types.Transaction, error) {
+	return k.Transact(opts, &kycabi.Refund{})
+}
+
+// call makes a read only call of the precompile. Unlike bound contract calls,
+// an empty output is a valid answer of the precompile rather than a sign of a
+// missing contract.
+func (k *Kyc) call(opts *bind.CallOpts, input []byte) ([]byte, error) {
+	if opts == nil {
+		opts = new(bind.CallOpts)
+	}
+	msg := ethereum.CallMsg{From: opts.From, To: &vm.KycContractAddress, Data: input}
+	ctx := ensureContext(opts.Context)
+
+	if opts.Pending {
+		pb, ok := k.backend.(bind.PendingContractCaller)
+		if !ok {
+			return nil, bind.ErrNoPendingState
+		}
+		return pb.PendingCallContract(ctx, msg)
+	}
+	return k.backend.CallContract(ctx, msg, nil)
+}
+
+// LevelThresholds returns the KYC levels required for transfers of at least the
+// given amounts, ordered by amount.
+func (k *Kyc) LevelThresholds(opts *bind.CallOpts) ([]params.KycLevelThreshold, error) {
+	output, err := k.call(opts, packMethod(vm.KycMethodGetLevelThresholds, nil))
+	if err != nil {
+		return nil, err
+	}
+	if len(output)%64 != 0 {
+		return nil, errInvalidThresholds
+	}
+	thresholds := make([]params.KycLevelThreshold, 0, len(output)/64)
+	for i := 0; i < len(output); i += 64 {
+		thresholds = append(thresholds, params.KycLevelThreshold{
+			Amount: new(big.Int).SetBytes(output[i : i+32]),
+			Level:  uint32(new(big.Int).SetBytes(output[i+32 : i+64]).Uint64()),
+		})
+	}
+	return thresholds, nil
+}
+
+// ProviderInfo returns the metadata provider registered with, left empty if it
+// registered none.
+func (k *Kyc) ProviderInfo(opts *bind.CallOpts, provider common.Address) (*common.KycProviderInfo, error) {
+	output, err := k.call(opts, packMethod(vm.KycMethodGetProviderInfo, provider.Bytes()))
+	if err != nil {
+		return nil, err
+	}
+	info := new(common.KycProviderInfo)
+	if len(output) > 0 {
+		if err := rlp.DecodeBytes(output, info); err != nil {
+			return nil, err
+		}
+	}
+	info.Address = provider
+	return info, nil
+}
+
+// packMethod returns the input of a call of the precompile method id with args.
+func packMethod(id uint32, args []byte) []byte {
+	input := make([]byte, 4, 4+len(args))
+	binary.BigEndian.PutUint32(input, id)
+	return append(input, args...)
+}
+
+// ensureContext returns ctx, or an empty context if nil.
+func ensureContext(ctx context.Context) context.Context {
+	if ctx == nil {
+		return context.TODO()
+	}
+	return ctx
+}
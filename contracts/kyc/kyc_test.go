@@ -0,0 +1,101 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package kyc
+
+import (
+	"context"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/worldopennetwork/go-won/accounts/abi/bind"
+	"github.com/worldopennetwork/go-won/accounts/abi/bind/backends"
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/params"
+)
+
+// Tests a full stake, vote and refund cycle through the binding, along with the
+// read calls of the precompile answering with empty outputs.
+func TestStakeVoteRefund(t *testing.T) {
+	var (
+		voterKey, _    = crypto.GenerateKey()
+		producerKey, _ = crypto.GenerateKey()
+		voter          = bind.NewKeyedTransactor(voterKey)
+		producer       = bind.NewKeyedTransactor(producerKey)
+		stake          = vm.DposActivatedStakeThreshold
+		ctx            = context.Background()
+	)
+	// Calls of a missing precompile account are skipped, so create it the way
+	// the genesis stakes of live networks do
+	sim := backends.NewSimulatedBackend(core.GenesisAlloc{
+		voter.From:            {Balance: new(big.Int).Mul(stake, big.NewInt(2))},
+		producer.From:         {Balance: big.NewInt(params.WON)},
+		vm.KycContractAddress: {Balance: big.NewInt(1)},
+	})
+	kyc := NewKyc(sim)
+
+	// Executes a transaction through the binding, expecting it to succeed
+	execute := func(name string, send func() (*types.Transaction, error)) {
+		tx, err := send()
+		if err != nil {
+			t.Fatalf("%s: failed to send transaction: %v", name, err)
+		}
+		sim.Commit()
+		if receipt, _ := sim.TransactionReceipt(ctx, tx.Hash()); receipt == nil || receipt.Status != types.ReceiptStatusSuccessful {
+			t.Fatalf("%s: transaction failed", name)
+		}
+	}
+	balance := func() *big.Int {
+		balance, _ := sim.BalanceAt(ctx, voter.From, nil)
+		return balance
+	}
+	execute("register", func() (*types.Transaction, error) { return kyc.RegisterProducer(producer, "http://producer") })
+
+	before := balance()
+	execute("stake", func() (*types.Transaction, error) { return kyc.AddStake(voter, stake) })
+	if staked, _ := sim.BalanceAt(ctx, vm.KycContractAddress, nil); staked.Cmp(stake) < 0 {
+		t.Fatalf("staked balance mismatch: have %v, want at least %v", staked, stake)
+	}
+	execute("vote", func() (*types.Transaction, error) { return kyc.VoteProducers(voter, []common.Address{producer.From}) })
+	execute("unstake", func() (*types.Transaction, error) { return kyc.SubStake(voter, stake) })
+
+	// The refund is locked for a while, fails early and gets paid out after
+	if tx, err := kyc.Refund(voter); err == nil {
+		sim.Commit()
+		if receipt, _ := sim.TransactionReceipt(ctx, tx.Hash()); receipt.Status != types.ReceiptStatusFailed {
+			t.Fatalf("early refund succeeded")
+		}
+	}
+	sim.AdjustTime(vm.DposRefundDelay * time.Second)
+	sim.Commit()
+
+	execute("refund", func() (*types.Transaction, error) { return kyc.Refund(voter) })
+	if have, fees := balance(), new(big.Int).Sub(before, balance()); have.Cmp(before) > 0 || fees.Cmp(big.NewInt(params.WON)) > 0 {
+		t.Errorf("refunded balance mismatch: have %v, want %v less fees", have, before)
+	}
+	// Reads answered with empty outputs are not mistaken for a missing contract
+	if thresholds, err := kyc.LevelThresholds(nil); err != nil || len(thresholds) != 0 {
+		t.Errorf("level thresholds mismatch: have %v (%v), want none", thresholds, err)
+	}
+	if info, err := kyc.ProviderInfo(nil, producer.From); err != nil || info.Address != producer.From || info.Name != "" {
+		t.Errorf("provider info mismatch: have %+v (%v), want empty", info, err)
+	}
+}
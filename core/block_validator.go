@@ -93,8 +93,13 @@ func (v *BlockValidator) ValidateState(block, parent *types.Block, statedb *stat
 		return fmt.Errorf("invalid receipt root hash (remote: %x local: %x)", header.ReceiptHash, receiptSha)
 	}
 	// Validate the state root against the received state root and throw
-	// an error if they don't match.
-	if root := statedb.IntermediateRoot(true /*v.config.IsEIP158(header.Number)*/); header.Root != root {
+	// an error if they don't match. A root computed after a failed database
+	// read can't be trusted, even if it happens to match.
+	root := statedb.IntermediateRoot(true /*v.config.IsEIP158(header.Number)*/)
+	if err := statedb.Error(); err != nil {
+		return fmt.Errorf("state database error: %v", err)
+	}
+	if header.Root != root {
 		return fmt.Errorf("invalid merkle root (remote: %x local: %x)", header.Root, root)
 	}
 	return nil
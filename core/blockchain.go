@@ -18,7 +18,6 @@
 package core
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
 	"io"
@@ -70,6 +69,10 @@ type CacheConfig struct {
 	Disabled      bool          // whether to disable trie write caching (archive node)
 	TrieNodeLimit int           // Memory limit (MB) at which to flush the current in-memory trie to disk
 	TrieTimeLimit time.Duration // Time limit after which to flush the current in-memory trie to disk
+	KycFlat       bool          // Whether to keep a flat copy of the KYC contract storage in the database
+
+	EpochLength    uint64 // Number of blocks per epoch of the chain indexers (0 = no retention)
+	EpochRetention uint64 // Number of recent epochs whose boundary states are kept from pruning
 }
 
 // BlockChain represents the canonical chain given a database with a genesis
@@ -90,9 +93,10 @@ type BlockChain struct {
 	chainConfig *params.ChainConfig // Chain & network configuration
 	cacheConfig *CacheConfig        // Cache configuration for pruning
 
-	db     wondb.Database // Low level persistent database to store final content in
-	triegc *prque.Prque   // Priority queue mapping block numbers to tries to gc
-	gcproc time.Duration  // Accumulates canonical block processing for trie dumping
+	db      wondb.Database // Low level persistent database to store final content in
+	triegc  *prque.Prque   // Priority queue mapping block numbers to tries to gc
+	epochgc *prque.Prque   // Priority queue mapping block numbers to retained epoch boundary tries to gc
+	gcproc  time.Duration  // Accumulates canonical block processing for trie dumping
 
 	hc            *HeaderChain
 	rmLogsFeed    event.Feed
@@ -152,6 +156,7 @@ func NewBlockChain(db wondb.Database, cacheConfig *CacheConfig, chainConfig *par
 		cacheConfig:  cacheConfig,
 		db:           db,
 		triegc:       prque.New(),
+		epochgc:      prque.New(),
 		stateCache:   state.NewDatabase(db),
 		quit:         make(chan struct{}),
 		bodyCache:    bodyCache,
@@ -162,6 +167,9 @@ func NewBlockChain(db wondb.Database, cacheConfig *CacheConfig, chainConfig *par
 		vmConfig:     vmConfig,
 		badBlocks:    badBlocks,
 	}
+	if cacheConfig.KycFlat {
+		bc.stateCache = state.NewDatabaseWithKycFlat(db)
+	}
 	bc.SetValidator(NewBlockValidator(chainConfig, bc, engine))
 	bc.SetProcessor(NewStateProcessor(chainConfig, bc, engine))
 
@@ -664,6 +672,14 @@ func (bc *BlockChain) Stop() {
 		for !bc.triegc.Empty() {
 			triedb.Dereference(bc.triegc.PopItem().(common.Hash), common.Hash{})
 		}
+		// Keep the retained epoch boundary states across restarts too
+		for !bc.epochgc.Empty() {
+			root, number := bc.epochgc.Pop()
+			if err := triedb.Commit(root.(common.Hash), false); err != nil {
+				log.Error("Failed to commit retained epoch state trie", "number", uint64(-number), "err", err)
+			}
+			triedb.Dereference(root.(common.Hash), common.Hash{})
+		}
 		if size := triedb.Size(); size != 0 {
 			log.Error("Dangling trie nodes after full cleanup")
 		}
@@ -671,6 +687,28 @@ func (bc *BlockChain) Stop() {
 	log.Info("Blockchain manager stopped")
 }
 
+// retainsEpochs reports whether the states of recent epoch boundaries are kept
+// from pruning.
+func (bc *BlockChain) retainsEpochs() bool {
+	return bc.cacheConfig.EpochLength > 0 && bc.cacheConfig.EpochRetention > 0
+}
+
+// gcEpochs releases the retained epoch boundary states which fell behind the
+// retention depth as of block number current.
+func (bc *BlockChain) gcEpochs(current uint64) {
+	triedb := bc.stateCache.TrieDB()
+	horizon := bc.cacheConfig.EpochLength * bc.cacheConfig.EpochRetention
+
+	for !bc.epochgc.Empty() {
+		root, number := bc.epochgc.Pop()
+		if uint64(-number)+horizon > current {
+			bc.epochgc.Push(root, number)
+			break
+		}
+		triedb.Dereference(root.(common.Hash), common.Hash{})
+	}
+}
+
 func (bc *BlockChain) procFutureBlocks() {
 	blocks := make([]*types.Block, 0, bc.futureBlocks.Len())
 	for _, hash := range bc.futureBlocks.Keys() {
@@ -914,6 +952,14 @@ func (bc *BlockChain) WriteBlockWithState(block *types.Block, receipts []*types.
 		triedb.Reference(root, common.Hash{}) // metadata reference to keep trie alive
 		bc.triegc.Push(root, -float32(block.NumberU64()))
 
+		// The indexers read the KYC contract storage at the epoch boundaries, which
+		// is only reachable through the account trie, keep the whole state around
+		if bc.retainsEpochs() && block.NumberU64()%bc.cacheConfig.EpochLength == 0 {
+			triedb.Reference(root, common.Hash{})
+			bc.epochgc.Push(root, -float32(block.NumberU64()))
+		}
+		bc.gcEpochs(block.NumberU64())
+
 		if current := block.NumberU64(); current > triesInMemory {
 			// Find the next state trie we need to commit
 			header := bc.GetHeaderByNumber(current - triesInMemory)
@@ -1012,49 +1058,6 @@ func (bc *BlockChain) InsertChain(chain types.Blocks) (int, error) {
 	return n, err
 }
 
-func (c *BlockChain) verifySignersElecting(chain consensus.ChainReader, header *types.Header, parent *types.Header) bool {
-
-	extraVanity := 32 // Fixed number of extra-data prefix bytes reserved for signer vanity
-	extraSeal := 65   // Fixed number of extra-data suffix bytes reserved for signer seal
-
-	signersMe := header.Extra[extraVanity : len(header.Extra)-extraSeal]
-	signersParent := parent.Extra[extraVanity : len(parent.Extra)-extraSeal]
-
-	if true || bytes.Compare(signersMe, signersParent) == 0 {
-		return true
-	}
-
-	state, err := c.StateAt(parent.Hash())
-	signersMeLocal := make([]byte, 0)
-	if err == nil && state != nil && (state.GetDposLastProducerScheduleUpdateTime().Int64()+60) < parent.Time.Int64() {
-		signersNew := state.GetProducerTopList()
-		if len(signersNew) > 0 {
-
-			//sort it
-			for i := 0; i < len(signersNew); i++ {
-				for j := i + 1; j < len(signersNew); j++ {
-					if bytes.Compare(signersNew[i][:], signersNew[j][:]) > 0 {
-						signersNew[i], signersNew[j] = signersNew[j], signersNew[i]
-					}
-				}
-			}
-
-			for _, signer := range signersNew {
-				signersMeLocal = append(signersMeLocal, signer[:]...)
-			}
-
-			if bytes.Compare(signersMe, signersParent) == 0 {
-
-				state.SetDposLastProducerScheduleUpdateTime(parent.Time)
-				return true
-			}
-
-		}
-	}
-	return false
-
-}
-
 // insertChain will execute the actual chain insertion and event aggregation. The
 // only reason this method exists as a separate one is to make locking cleaner
 // with deferred statements.
@@ -1188,16 +1191,22 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 			parent = chain[i-1]
 		}
 
-		if bc.chainConfig.Dpos != nil && !bc.verifySignersElecting(bc, block.Header(), parent.Header()) {
-			return i, events, coalescedLogs, fmt.Errorf("verifySignersElecting failed")
-		}
-
 		state, err := state.New(parent.Root(), bc.stateCache)
 		if err != nil {
 			return i, events, coalescedLogs, err
 		}
-		// Process block using the parent state as reference point.
+		// Ensure any signer set rotation matches the election in the parent state
+		if verifier, ok := bc.engine.(consensus.ElectionVerifier); ok {
+			if err := verifier.VerifyElection(bc, block.Header(), state); err != nil {
+				bc.reportBlock(block, nil, err)
+				return i, events, coalescedLogs, err
+			}
+		}
+		// Process block using the parent state as reference point, warming the
+		// caches with what it's going to touch in the background
+		interrupt := bc.prefetch(block, parent.Root())
 		receipts, logs, usedGas, err := bc.processor.Process(block, state, bc.vmConfig)
+		close(interrupt)
 		if err != nil {
 			bc.reportBlock(block, receipts, err)
 			return i, events, coalescedLogs, err
@@ -1247,6 +1256,15 @@ func (bc *BlockChain) insertChain(chain types.Blocks) (int, []interface{}, []*ty
 	return 0, events, coalescedLogs, nil
 }
 
+// prefetch warms the caches with the state processing block on top of root is
+// going to touch in the background, see state.Prefetch. The returned channel
+// stops it once closed.
+func (bc *BlockChain) prefetch(block *types.Block, root common.Hash) chan struct{} {
+	interrupt := make(chan struct{})
+	go state.Prefetch(bc.stateCache, root, block.Transactions(), types.MakeSigner(bc.chainConfig, block.Number()), interrupt)
+	return interrupt
+}
+
 // insertStats tracks and reports on block insertion.
 type insertStats struct {
 	queued, processed, ignored int
@@ -17,6 +17,7 @@
 package core
 
 import (
+	"errors"
 	"fmt"
 	"math/big"
 	"math/rand"
@@ -1336,6 +1337,147 @@ func TestLargeReorgTrieGC(t *testing.T) {
 	}
 }
 
+// Tests that with pruning enabled, the states of the recent epoch boundaries are
+// kept around along with the KYC contract storage, and released once they fall
+// behind the retention depth.
+func TestEpochStateRetention(t *testing.T) {
+	const (
+		epoch     = 64
+		providers = 8
+	)
+	// Create a genesis with a few KYC providers and a chain touching the state
+	// in every block
+	storage := map[common.Hash]common.Hash{
+		common.BigToHash(common.Big1): common.BigToHash(big.NewInt(providers)),
+	}
+	for i := 0; i < providers; i++ {
+		storage[common.BigToHash(big.NewInt(10000000000+int64(i)))] = common.BigToHash(big.NewInt(int64(0xff00 + i)))
+	}
+	gspec := &Genesis{
+		Config: params.TestChainConfig,
+		Alloc:  GenesisAlloc{vm.KycContractAddress: {Balance: new(big.Int), Storage: storage}},
+	}
+	engine := ethash.NewFaker()
+
+	db, _ := wondb.NewMemDatabase()
+	genesis := gspec.MustCommit(db)
+	blocks, _ := GenerateChain(params.TestChainConfig, genesis, engine, db, 3*triesInMemory, func(i int, b *BlockGen) {
+		b.SetCoinbase(common.BigToAddress(big.NewInt(int64(i + 1))))
+	})
+	for _, retention := range []uint64{0, 4} {
+		diskdb, _ := wondb.NewMemDatabase()
+		gspec.MustCommit(diskdb)
+
+		// Never flush on our own, pruning everything behind the in-memory tries
+		chain, err := NewBlockChain(diskdb, &CacheConfig{
+			TrieNodeLimit:  256 * 1024 * 1024,
+			TrieTimeLimit:  time.Hour,
+			EpochLength:    epoch,
+			EpochRetention: retention,
+		}, params.TestChainConfig, engine, vm.Config{})
+		if err != nil {
+			t.Fatalf("failed to create tester chain: %v", err)
+		}
+		if _, err := chain.InsertChain(blocks); err != nil {
+			t.Fatalf("failed to insert chain: %v", err)
+		}
+		head := uint64(len(blocks))
+		for number := uint64(epoch); number <= head; number += epoch {
+			var (
+				recent   = number+triesInMemory > head
+				retained = number+retention*epoch > head
+			)
+			statedb, err := state.New(blocks[number-1].Root(), chain.stateCache)
+			if available := err == nil; available != (recent || retained) {
+				t.Errorf("retention %d, epoch boundary %d: availability mismatch: have %v, want %v", retention, number, available, recent || retained)
+				continue
+			}
+			if err != nil {
+				continue
+			}
+			if have := statedb.GetKycProviderCount(); have != providers {
+				t.Errorf("retention %d, epoch boundary %d: provider count mismatch: have %d, want %d", retention, number, have, providers)
+			}
+			if !statedb.KycProviderExists(common.BigToAddress(big.NewInt(0xff00 + providers - 1))) {
+				t.Errorf("retention %d, epoch boundary %d: provider missing", retention, number)
+			}
+		}
+		// The retained states are flushed on shutdown, the rest being released
+		chain.Stop()
+		if size := chain.stateCache.TrieDB().Size(); size != 0 {
+			t.Errorf("retention %d: dangling trie nodes after shutdown: %v", retention, size)
+		}
+		for number := head - (retention-1)*epoch; retention > 0 && number <= head; number += epoch {
+			if _, err := state.New(blocks[number-1].Root(), state.NewDatabase(diskdb)); err != nil {
+				t.Errorf("retention %d, epoch boundary %d: state not flushed: %v", retention, number, err)
+			}
+		}
+	}
+}
+
+// failingStateDatabase fails to open the storage trie of a single account.
+type failingStateDatabase struct {
+	state.Database
+	addrHash common.Hash
+}
+
+func (db *failingStateDatabase) OpenStorageTrie(addrHash, root common.Hash) (state.Trie, error) {
+	if addrHash == db.addrHash && root != (common.Hash{}) {
+		return nil, errors.New("injected read failure")
+	}
+	return db.Database.OpenStorageTrie(addrHash, root)
+}
+
+// Tests that a block whose processing hits a state database read error is
+// rejected, even though the root computed from the partial state matches.
+func TestInsertChainStateReadError(t *testing.T) {
+	var (
+		key, _  = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		address = crypto.PubkeyToAddress(key.PublicKey)
+		gspec   = &Genesis{
+			Config: params.TestChainConfig,
+			Alloc: GenesisAlloc{
+				address: {Balance: big.NewInt(1000000000)},
+				// Transfers consult the KYC contract storage, which holds no providers
+				vm.KycContractAddress: {Balance: new(big.Int), Storage: map[common.Hash]common.Hash{common.BigToHash(big.NewInt(7)): common.BigToHash(common.Big1)}},
+			},
+		}
+		engine = ethash.NewFaker()
+		signer = types.NewEIP155Signer(gspec.Config.ChainId)
+	)
+	gendb, _ := wondb.NewMemDatabase()
+	blocks, _ := GenerateChain(gspec.Config, gspec.MustCommit(gendb), engine, gendb, 1, func(i int, block *BlockGen) {
+		tx, err := types.SignTx(types.NewTransaction(block.TxNonce(address), common.Address{0x01}, big.NewInt(1000), params.TxGas, nil, nil), signer, key)
+		if err != nil {
+			panic(err)
+		}
+		block.AddTx(tx)
+	})
+	for _, fail := range []bool{false, true} {
+		db, _ := wondb.NewMemDatabase()
+		gspec.MustCommit(db)
+
+		chain, err := NewBlockChain(db, nil, gspec.Config, engine, vm.Config{})
+		if err != nil {
+			t.Fatalf("failed to create tester chain: %v", err)
+		}
+		if fail {
+			chain.stateCache = &failingStateDatabase{Database: chain.stateCache, addrHash: crypto.Keccak256Hash(vm.KycContractAddress[:])}
+		}
+		_, err = chain.InsertChain(blocks)
+		if fail && err == nil {
+			t.Errorf("block imported despite state read failure")
+		}
+		if !fail && err != nil {
+			t.Errorf("failed to import block: %v", err)
+		}
+		if have, want := chain.CurrentBlock().NumberU64(), uint64(len(blocks)); (have == want) == fail {
+			t.Errorf("fail %v: head mismatch: have %d", fail, have)
+		}
+		chain.Stop()
+	}
+}
+
 // Benchmarks large blocks with value transfers to non-existing accounts
 func benchmarkLargeNumberOfValueToNonexisting(b *testing.B, numTxs, numBlocks int, recipientFn func(uint64) common.Address, dataFn func(uint64) []byte) {
 	var (
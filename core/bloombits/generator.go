@@ -23,9 +23,13 @@ import (
 )
 
 // errSectionOutOfBounds is returned if the user tried to add more bloom filters
-// to the batch than available space, or if tries to retrieve above the capacity,
+// to the batch than available space.
 var errSectionOutOfBounds = errors.New("section out of bounds")
 
+// errBloomBitOutOfBounds is returned if the user tried to retrieve the bit vector
+// of a bit beyond the bloom filter length.
+var errBloomBitOutOfBounds = errors.New("bloom bit out of bounds")
+
 // Generator takes a number of bloom filters and generates the rotated bloom bits
 // to be used for batched filtering.
 type Generator struct {
@@ -80,8 +84,8 @@ func (b *Generator) Bitset(idx uint) ([]byte, error) {
 	if b.nextBit != b.sections {
 		return nil, errors.New("bloom not fully generated yet")
 	}
-	if idx >= b.sections {
-		return nil, errSectionOutOfBounds
+	if idx >= types.BloomBitLength {
+		return nil, errBloomBitOutOfBounds
 	}
 	return b.blooms[idx], nil
 }
@@ -58,12 +58,14 @@ var (
 	blockReceiptsPrefix = []byte("r") // blockReceiptsPrefix + num (uint64 big endian) + hash -> block receipts
 	lookupPrefix        = []byte("l") // lookupPrefix + hash -> transaction/receipt lookup metadata
 	bloomBitsPrefix     = []byte("B") // bloomBitsPrefix + bit (uint16 big endian) + section (uint64 big endian) + hash -> bloom bits
+	schedulePrefix      = []byte("S") // schedulePrefix + section (uint64 big endian) + hash -> producer schedule
 
 	preimagePrefix = "secure-key-"              // preimagePrefix + hash -> preimage
 	configPrefix   = []byte("ethereum-config-") // config prefix for the db
 
 	// Chain index prefixes (use `i` + single byte to avoid mixing data types).
 	BloomBitsIndexPrefix = []byte("iB") // BloomBitsIndexPrefix is the data table of a chain indexer to track its progress
+	ScheduleIndexPrefix  = []byte("iS") // ScheduleIndexPrefix is the data table of the producer schedule indexer to track its progress
 
 	// used by old db, now only used for conversion
 	oldReceiptsPrefix = []byte("receipts-")
@@ -352,6 +354,23 @@ func GetBloomBits(db DatabaseReader, bit uint, section uint64, head common.Hash)
 	return db.Get(key)
 }
 
+// GetProducerSchedule retrieves the producer schedule checkpointed in the given
+// section, with head being the hash of the last header of the section.
+func GetProducerSchedule(db DatabaseReader, section uint64, head common.Hash) ([]common.Address, error) {
+	key := append(append(schedulePrefix, make([]byte, 8)...), head.Bytes()...)
+	binary.BigEndian.PutUint64(key[1:], section)
+
+	data, err := db.Get(key)
+	if err != nil {
+		return nil, err
+	}
+	var schedule []common.Address
+	if err := rlp.DecodeBytes(data, &schedule); err != nil {
+		return nil, err
+	}
+	return schedule, nil
+}
+
 // WriteCanonicalHash stores the canonical hash for the given block number.
 func WriteCanonicalHash(db wondb.Putter, hash common.Hash, number uint64) error {
 	key := append(append(headerPrefix, encodeBlockNumber(number)...), numSuffix...)
@@ -517,6 +536,21 @@ func WriteBloomBits(db wondb.Putter, bit uint, section uint64, head common.Hash,
 	}
 }
 
+// WriteProducerSchedule writes the producer schedule checkpointed in the given
+// section.
+func WriteProducerSchedule(db wondb.Putter, section uint64, head common.Hash, schedule []common.Address) {
+	key := append(append(schedulePrefix, make([]byte, 8)...), head.Bytes()...)
+	binary.BigEndian.PutUint64(key[1:], section)
+
+	data, err := rlp.EncodeToBytes(schedule)
+	if err != nil {
+		log.Crit("Failed to RLP encode producer schedule", "err", err)
+	}
+	if err := db.Put(key, data); err != nil {
+		log.Crit("Failed to store producer schedule", "err", err)
+	}
+}
+
 // DeleteCanonicalHash removes the number to hash canonical mapping.
 func DeleteCanonicalHash(db DatabaseDeleter, number uint64) {
 	db.Delete(append(append(headerPrefix, encodeBlockNumber(number)...), numSuffix...))
@@ -551,6 +585,15 @@ func DeleteBlockReceipts(db DatabaseDeleter, hash common.Hash, number uint64) {
 	db.Delete(append(append(blockReceiptsPrefix, encodeBlockNumber(number)...), hash.Bytes()...))
 }
 
+// DeleteProducerSchedule removes the producer schedule checkpointed in the given
+// section with the given head.
+func DeleteProducerSchedule(db DatabaseDeleter, section uint64, head common.Hash) {
+	key := append(append(schedulePrefix, make([]byte, 8)...), head.Bytes()...)
+	binary.BigEndian.PutUint64(key[1:], section)
+
+	db.Delete(key)
+}
+
 // DeleteTxLookupEntry removes all transaction data associated with a hash.
 func DeleteTxLookupEntry(db DatabaseDeleter, hash common.Hash) {
 	db.Delete(append(lookupPrefix, hash.Bytes()...))
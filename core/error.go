@@ -16,7 +16,12 @@
 
 package core
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+
+	"github.com/worldopennetwork/go-won/common"
+)
 
 var (
 	// ErrKnownBlock is returned when a block to import is already known locally.
@@ -32,4 +37,26 @@ var (
 	// ErrNonceTooHigh is returned if the nonce of a transaction is higher than the
 	// next one expected based on the local chain.
 	ErrNonceTooHigh = errors.New("nonce too high")
+
+	// ErrKycValidationFailed is returned if a message was rejected by the KYC checks
+	// of a nested call, where the offending party can't be pinpointed.
+	ErrKycValidationFailed = errors.New("KYC validation failed")
+
+	// ErrKycZoneRestricted is returned if a message was rejected because the zone
+	// policy forbids its sender to transact with its recipient.
+	ErrKycZoneRestricted = errors.New("KYC zone restricted")
 )
+
+// KycError is returned if a message transfers value from or to an account that is
+// not KYC verified, while KYC providers are registered.
+type KycError struct {
+	Address   common.Address // Account lacking the KYC verification
+	Recipient bool           // Whether the account is the recipient or the sender
+}
+
+func (e *KycError) Error() string {
+	if e.Recipient {
+		return fmt.Sprintf("recipient %x is not KYC verified", e.Address)
+	}
+	return fmt.Sprintf("sender %x is not KYC verified", e.Address)
+}
@@ -21,8 +21,10 @@ import (
 
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/consensus"
+	"github.com/worldopennetwork/go-won/core/state"
 	"github.com/worldopennetwork/go-won/core/types"
 	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/params"
 )
 
 // ChainContext supports retrieving headers and consensus parameters from the
@@ -84,18 +86,10 @@ func GetHashFn(ref *types.Header, chain ChainContext) func(n uint64) common.Hash
 	}
 }
 
-func IsPrecompiledAddress(addr common.Address) bool {
-
-	if addr == vm.KycContractAddress || (addr == common.Address{}) {
-		return true
-	}
-
-	precompiles := vm.PrecompiledContractsByzantium
-	if p := precompiles[addr]; p != nil {
-		return true
-	}
-
-	return false
+// IsPrecompiledAddress reports whether addr is the zero address, the KYC
+// contract or one of the precompiles active at block number under config.
+func IsPrecompiledAddress(addr common.Address, number *big.Int, config *params.ChainConfig) bool {
+	return addr == (common.Address{}) || state.IsPrecompiledAddress(addr, number, config)
 }
 
 // CanTransfer checks wwon there are enough funds in the address' account to make a transfer.
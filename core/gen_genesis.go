@@ -10,6 +10,7 @@ import (
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/common/hexutil"
 	"github.com/worldopennetwork/go-won/common/math"
+	"github.com/worldopennetwork/go-won/core/state"
 	"github.com/worldopennetwork/go-won/params"
 )
 
@@ -17,18 +18,21 @@ var _ = (*genesisSpecMarshaling)(nil)
 
 func (g Genesis) MarshalJSON() ([]byte, error) {
 	type Genesis struct {
-		Config     *params.ChainConfig                         `json:"config"`
-		Nonce      math.HexOrDecimal64                         `json:"nonce"`
-		Timestamp  math.HexOrDecimal64                         `json:"timestamp"`
-		ExtraData  hexutil.Bytes                               `json:"extraData"`
-		GasLimit   math.HexOrDecimal64                         `json:"gasLimit"   gencodec:"required"`
-		Difficulty *math.HexOrDecimal256                       `json:"difficulty" gencodec:"required"`
-		Mixhash    common.Hash                                 `json:"mixHash"`
-		Coinbase   common.Address                              `json:"coinbase"`
-		Alloc      map[common.UnprefixedAddress]GenesisAccount `json:"alloc"      gencodec:"required"`
-		Number     math.HexOrDecimal64                         `json:"number"`
-		GasUsed    math.HexOrDecimal64                         `json:"gasUsed"`
-		ParentHash common.Hash                                 `json:"parentHash"`
+		Config       *params.ChainConfig                         `json:"config"`
+		Nonce        math.HexOrDecimal64                         `json:"nonce"`
+		Timestamp    math.HexOrDecimal64                         `json:"timestamp"`
+		ExtraData    hexutil.Bytes                               `json:"extraData"`
+		GasLimit     math.HexOrDecimal64                         `json:"gasLimit"   gencodec:"required"`
+		Difficulty   *math.HexOrDecimal256                       `json:"difficulty" gencodec:"required"`
+		Mixhash      common.Hash                                 `json:"mixHash"`
+		Coinbase     common.Address                              `json:"coinbase"`
+		Alloc        map[common.UnprefixedAddress]GenesisAccount `json:"alloc"      gencodec:"required"`
+		KycProviders []common.Address                            `json:"kycProviders,omitempty"`
+		Producers    []GenesisProducer                           `json:"producers,omitempty"`
+		KycDpos      *state.KycDposRegistry                      `json:"kycDpos,omitempty"`
+		Number       math.HexOrDecimal64                         `json:"number"`
+		GasUsed      math.HexOrDecimal64                         `json:"gasUsed"`
+		ParentHash   common.Hash                                 `json:"parentHash"`
 	}
 	var enc Genesis
 	enc.Config = g.Config
@@ -45,6 +49,9 @@ func (g Genesis) MarshalJSON() ([]byte, error) {
 			enc.Alloc[common.UnprefixedAddress(k)] = v
 		}
 	}
+	enc.KycProviders = g.KycProviders
+	enc.Producers = g.Producers
+	enc.KycDpos = g.KycDpos
 	enc.Number = math.HexOrDecimal64(g.Number)
 	enc.GasUsed = math.HexOrDecimal64(g.GasUsed)
 	enc.ParentHash = g.ParentHash
@@ -53,18 +60,21 @@ func (g Genesis) MarshalJSON() ([]byte, error) {
 
 func (g *Genesis) UnmarshalJSON(input []byte) error {
 	type Genesis struct {
-		Config     *params.ChainConfig                         `json:"config"`
-		Nonce      *math.HexOrDecimal64                        `json:"nonce"`
-		Timestamp  *math.HexOrDecimal64                        `json:"timestamp"`
-		ExtraData  *hexutil.Bytes                              `json:"extraData"`
-		GasLimit   *math.HexOrDecimal64                        `json:"gasLimit"   gencodec:"required"`
-		Difficulty *math.HexOrDecimal256                       `json:"difficulty" gencodec:"required"`
-		Mixhash    *common.Hash                                `json:"mixHash"`
-		Coinbase   *common.Address                             `json:"coinbase"`
-		Alloc      map[common.UnprefixedAddress]GenesisAccount `json:"alloc"      gencodec:"required"`
-		Number     *math.HexOrDecimal64                        `json:"number"`
-		GasUsed    *math.HexOrDecimal64                        `json:"gasUsed"`
-		ParentHash *common.Hash                                `json:"parentHash"`
+		Config       *params.ChainConfig                         `json:"config"`
+		Nonce        *math.HexOrDecimal64                        `json:"nonce"`
+		Timestamp    *math.HexOrDecimal64                        `json:"timestamp"`
+		ExtraData    *hexutil.Bytes                              `json:"extraData"`
+		GasLimit     *math.HexOrDecimal64                        `json:"gasLimit"   gencodec:"required"`
+		Difficulty   *math.HexOrDecimal256                       `json:"difficulty" gencodec:"required"`
+		Mixhash      *common.Hash                                `json:"mixHash"`
+		Coinbase     *common.Address                             `json:"coinbase"`
+		Alloc        map[common.UnprefixedAddress]GenesisAccount `json:"alloc"      gencodec:"required"`
+		KycProviders []common.Address                            `json:"kycProviders,omitempty"`
+		Producers    []GenesisProducer                           `json:"producers,omitempty"`
+		KycDpos      *state.KycDposRegistry                      `json:"kycDpos,omitempty"`
+		Number       *math.HexOrDecimal64                        `json:"number"`
+		GasUsed      *math.HexOrDecimal64                        `json:"gasUsed"`
+		ParentHash   *common.Hash                                `json:"parentHash"`
 	}
 	var dec Genesis
 	if err := json.Unmarshal(input, &dec); err != nil {
@@ -103,6 +113,15 @@ func (g *Genesis) UnmarshalJSON(input []byte) error {
 	for k, v := range dec.Alloc {
 		g.Alloc[common.Address(k)] = v
 	}
+	if dec.KycProviders != nil {
+		g.KycProviders = dec.KycProviders
+	}
+	if dec.Producers != nil {
+		g.Producers = dec.Producers
+	}
+	if dec.KycDpos != nil {
+		g.KycDpos = dec.KycDpos
+	}
 	if dec.Number != nil {
 		g.Number = uint64(*dec.Number)
 	}
@@ -30,6 +30,7 @@ import (
 	"github.com/worldopennetwork/go-won/common/math"
 	"github.com/worldopennetwork/go-won/core/state"
 	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
 	"github.com/worldopennetwork/go-won/log"
 	"github.com/worldopennetwork/go-won/params"
 	"github.com/worldopennetwork/go-won/rlp"
@@ -38,6 +39,7 @@ import (
 
 //go:generate gencodec -type Genesis -field-override genesisSpecMarshaling -out gen_genesis.go
 //go:generate gencodec -type GenesisAccount -field-override genesisAccountMarshaling -out gen_genesis_account.go
+//go:generate gencodec -type GenesisProducer -field-override genesisProducerMarshaling -out gen_genesis_producer.go
 
 var errGenesisNoConfig = errors.New("genesis has no chain configuration")
 
@@ -54,6 +56,14 @@ type Genesis struct {
 	Coinbase   common.Address      `json:"coinbase"`
 	Alloc      GenesisAlloc        `json:"alloc"      gencodec:"required"`
 
+	// These fields bootstrap the KYC and dpos bookkeeping of the network.
+	KycProviders []common.Address  `json:"kycProviders,omitempty"`
+	Producers    []GenesisProducer `json:"producers,omitempty"`
+
+	// KycDpos is a KYC/dpos registry exported from another network, replayed
+	// before the providers and producers above.
+	KycDpos *state.KycDposRegistry `json:"kycDpos,omitempty"`
+
 	// These fields are used for consensus tests. Please don't use them
 	// in actual genesis blocks.
 	Number     uint64      `json:"number"`
@@ -85,6 +95,14 @@ type GenesisAccount struct {
 	PrivateKey []byte                      `json:"secretKey,omitempty"` // for tests
 }
 
+// GenesisProducer is a block producer registered in the genesis block, voting
+// for itself with the given stake, which is taken from its allocation.
+type GenesisProducer struct {
+	Address common.Address `json:"address" gencodec:"required"`
+	URL     string         `json:"url"`
+	Stake   *big.Int       `json:"stake"   gencodec:"required"`
+}
+
 // field type overrides for gencodec
 type genesisSpecMarshaling struct {
 	Nonce      math.HexOrDecimal64
@@ -97,6 +115,10 @@ type genesisSpecMarshaling struct {
 	Alloc      map[common.UnprefixedAddress]GenesisAccount
 }
 
+type genesisProducerMarshaling struct {
+	Stake *math.HexOrDecimal256
+}
+
 type genesisAccountMarshaling struct {
 	Code       hexutil.Bytes
 	Balance    *math.HexOrDecimal256
@@ -136,6 +158,17 @@ func (e *GenesisMismatchError) Error() string {
 	return fmt.Sprintf("database already contains an incompatible genesis block (have %x, new %x)", e.Stored[:8], e.New[:8])
 }
 
+// ConfigMismatchError is raised when trying to change the chain configuration of
+// a database in a way that reaches back to the genesis block, which rewinding the
+// chain can't correct.
+type ConfigMismatchError struct {
+	Err *params.ConfigCompatError
+}
+
+func (e *ConfigMismatchError) Error() string {
+	return fmt.Sprintf("database already contains an incompatible chain configuration: %v", e.Err)
+}
+
 // SetupGenesisBlock writes or updates the genesis block in db.
 // The block that will be used is:
 //
@@ -147,6 +180,8 @@ func (e *GenesisMismatchError) Error() string {
 // The stored chain configuration will be updated if it is compatible (i.e. does not
 // specify a fork block below the local head block). In case of a conflict, the
 // error is a *params.ConfigCompatError and the new, unwritten config is returned.
+// Conflicts that can't be rewound, such as changed KYC or dpos parameters, are
+// reported as a *ConfigMismatchError instead.
 //
 // The returned chain configuration is never nil.
 func SetupGenesisBlock(db wondb.Database, genesis *Genesis) (*params.ChainConfig, common.Hash, error) {
@@ -165,13 +200,19 @@ func SetupGenesisBlock(db wondb.Database, genesis *Genesis) (*params.ChainConfig
 			log.Info("Writing custom genesis block")
 		}
 		block, err := genesis.Commit(db)
-		return genesis.Config, block.Hash(), err
+		if err != nil {
+			return genesis.Config, common.Hash{}, err
+		}
+		return genesis.Config, block.Hash(), nil
 	}
 
 	// Check whether the genesis block is already written.
 	if genesis != nil {
-		hash := genesis.ToBlock(nil).Hash()
-		if hash != stored {
+		block, err := genesis.toBlock(nil)
+		if err != nil {
+			return genesis.Config, common.Hash{}, err
+		}
+		if hash := block.Hash(); hash != stored {
 			return genesis.Config, hash, &GenesisMismatchError{stored, hash}
 		}
 	}
@@ -195,13 +236,17 @@ func SetupGenesisBlock(db wondb.Database, genesis *Genesis) (*params.ChainConfig
 	}
 
 	// Check config compatibility and write the config. Compatibility errors
-	// are returned to the caller unless we're already at block zero.
+	// are returned to the caller unless we're already at block zero. Those that
+	// reach back to genesis can't be fixed by rewinding the chain.
 	height := GetBlockNumber(db, GetHeadHeaderHash(db))
 	if height == missingNumber {
 		return newcfg, stored, fmt.Errorf("missing block number for head header hash")
 	}
 	compatErr := storedcfg.CheckCompatible(newcfg, height)
-	if compatErr != nil && height != 0 && compatErr.RewindTo != 0 {
+	if compatErr != nil && height != 0 {
+		if compatErr.RewindTo == 0 {
+			return newcfg, stored, &ConfigMismatchError{compatErr}
+		}
 		return newcfg, stored, compatErr
 	}
 	return newcfg, stored, WriteChainConfig(db, stored, newcfg)
@@ -222,8 +267,27 @@ func (g *Genesis) configOrDefault(ghash common.Hash) *params.ChainConfig {
 }
 
 // ToBlock creates the genesis block and writes state of a genesis specification
-// to the given database (or discards it if nil).
+// to the given database (or discards it if nil). Invalid KYC and dpos entries,
+// which Commit and SetupGenesisBlock reject, are skipped with a warning.
 func (g *Genesis) ToBlock(db wondb.Database) *types.Block {
+	block, err := g.toBlock(db)
+	if err != nil {
+		log.Warn("Skipped invalid genesis entries", "err", err)
+	}
+	return block
+}
+
+// toBlock creates the genesis block like ToBlock, additionally returning the
+// first problem found with the specification.
+func (g *Genesis) toBlock(db wondb.Database) (*types.Block, error) {
+	var err error
+	fail := func(e error) {
+		if err == nil {
+			err = e
+		}
+	}
+	fail(g.Config.CheckConfig())
+
 	if db == nil {
 		db, _ = wondb.NewMemDatabase()
 	}
@@ -236,9 +300,47 @@ func (g *Genesis) ToBlock(db wondb.Database) *types.Block {
 			statedb.SetState(addr, key, value)
 		}
 	}
+	if g.KycDpos != nil {
+		if e := statedb.ImportKycDpos(g.KycDpos); e != nil {
+			fail(fmt.Errorf("invalid genesis KYC/dpos registry: %v", e))
+		}
+	}
+	number := new(big.Int).SetUint64(g.Number)
+	for _, provider := range g.KycProviders {
+		if !statedb.AddKycProvider(provider) {
+			fail(fmt.Errorf("duplicate genesis KYC provider %x", provider))
+			continue
+		}
+		vm.SetKycProviderDefaults(statedb, g.Config, number, provider)
+	}
+	for _, producer := range g.Producers {
+		addr := producer.Address
+
+		// Register the producer and have it vote for itself, locking up its stake
+		// in the KYC contract same as the staking precompile would
+		if statedb.GetProducerInfo(&addr) != nil {
+			fail(fmt.Errorf("duplicate genesis producer %x", addr))
+			continue
+		}
+		if producer.Stake == nil || producer.Stake.Sign() < 0 || statedb.GetBalance(addr).Cmp(producer.Stake) < 0 {
+			fail(fmt.Errorf("genesis producer %x can't cover its stake of %v", addr, producer.Stake))
+			continue
+		}
+		statedb.RegisterProducer(&addr, producer.URL)
+		statedb.SetVoterStaking(&addr, producer.Stake)
+		statedb.SetVoterProducers(&addr, []common.Address{addr})
+
+		weight := vm.CalcVoteWeight(producer.Stake, new(big.Int).SetUint64(g.Timestamp))
+		statedb.UpdateProducerTotalVotes(&addr, weight)
+		statedb.SetDposVoterLastVoteWeight(&addr, weight)
+
+		statedb.SubBalance(addr, producer.Stake)
+		statedb.AddBalance(vm.KycContractAddress, producer.Stake)
+		statedb.SetDposTotalActivatedStake(new(big.Int).Add(statedb.GetDposTotalActivatedStake(), producer.Stake))
+	}
 	root := statedb.IntermediateRoot(false)
 	head := &types.Header{
-		Number:     new(big.Int).SetUint64(g.Number),
+		Number:     number,
 		Nonce:      types.EncodeNonce(g.Nonce),
 		Time:       new(big.Int).SetUint64(g.Timestamp),
 		ParentHash: g.ParentHash,
@@ -259,13 +361,16 @@ func (g *Genesis) ToBlock(db wondb.Database) *types.Block {
 	statedb.Commit(false)
 	statedb.Database().TrieDB().Commit(root, true)
 
-	return types.NewBlock(head, nil, nil, nil)
+	return types.NewBlock(head, nil, nil, nil), err
 }
 
 // Commit writes the block and state of a genesis specification to the database.
 // The block is committed as the canonical head block.
 func (g *Genesis) Commit(db wondb.Database) (*types.Block, error) {
-	block := g.ToBlock(db)
+	block, err := g.toBlock(db)
+	if err != nil {
+		return nil, err
+	}
 	if block.Number().Sign() != 0 {
 		return nil, fmt.Errorf("can't commit genesis block with number > 0")
 	}
@@ -350,7 +455,7 @@ func DefaultTestnetGenesisBlock() *Genesis {
 //}
 
 // DeveloperGenesisBlock returns the 'gwon --dev' genesis block. Note, this must
-// be seeded with the
+// be seeded with the developer account, which is also the initial KYC provider.
 func DeveloperGenesisBlock(period uint64, faucet common.Address) *Genesis {
 	// Override the default period to the user requested one
 	config := *params.DevChainConfig
@@ -373,6 +478,7 @@ func DeveloperGenesisBlock(period uint64, faucet common.Address) *Genesis {
 			common.BytesToAddress([]byte{8}): {Balance: big.NewInt(1)}, // ECPairing
 			faucet: {Balance: new(big.Int).Sub(new(big.Int).Lsh(big.NewInt(1), 256), big.NewInt(9))},
 		},
+		KycProviders: []common.Address{faucet},
 	}
 }
 
@@ -17,6 +17,7 @@
 package core
 
 import (
+	"encoding/json"
 	"math/big"
 	"reflect"
 	"testing"
@@ -24,6 +25,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/consensus/ethash"
+	"github.com/worldopennetwork/go-won/core/state"
 	"github.com/worldopennetwork/go-won/core/vm"
 	"github.com/worldopennetwork/go-won/params"
 	"github.com/worldopennetwork/go-won/wondb"
@@ -161,3 +163,199 @@ func TestSetupGenesis(t *testing.T) {
 		}
 	}
 }
+
+// Tests that parameters applying since genesis can't be changed on a chain past
+// it, since the chain can't be rewound to before them.
+func TestSetupGenesisParamChange(t *testing.T) {
+	var (
+		db, _   = wondb.NewMemDatabase()
+		genesis = &Genesis{Config: &params.ChainConfig{Kyc: &params.KycConfig{QuorumNumerator: 1, QuorumDenominator: 2}}}
+		block   = genesis.MustCommit(db)
+	)
+	bc, _ := NewBlockChain(db, nil, genesis.Config, ethash.NewFullFaker(), vm.Config{})
+	defer bc.Stop()
+
+	blocks, _ := GenerateChain(genesis.Config, block, ethash.NewFaker(), db, 4, nil)
+	if _, err := bc.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	changed := *genesis
+	changed.Config = &params.ChainConfig{Kyc: &params.KycConfig{QuorumNumerator: 2, QuorumDenominator: 3}}
+
+	_, _, err := SetupGenesisBlock(db, &changed)
+	if _, ok := err.(*ConfigMismatchError); !ok {
+		t.Fatalf("error mismatch: have %v, want config mismatch", err)
+	}
+	if stored, _ := GetChainConfig(db, block.Hash()); !reflect.DeepEqual(stored, genesis.Config) {
+		t.Errorf("stored config changed: have %v, want %v", stored, genesis.Config)
+	}
+}
+
+const dposGenesisJSON = `{
+	"config": {"chainId": 1, "dpos": {"period": 3, "epoch": 300}},
+	"gasLimit": "0x47b760",
+	"difficulty": "0x1",
+	"alloc": {
+		"0x0000000000000000000000000000000000000201": {"balance": "0x27b46536c66c8e3000000"},
+		"0x0000000000000000000000000000000000000202": {"balance": "0x27b46536c66c8e3000000"},
+		"0x0000000000000000000000000000000000000203": {"balance": "0x27b46536c66c8e3000000"},
+		"0x0000000000000000000000000000000000000204": {"balance": "0x27b46536c66c8e3000000"},
+		"0x0000000000000000000000000000000000000205": {"balance": "0x27b46536c66c8e3001000"}
+	},
+	"kycProviders": [
+		"0x0000000000000000000000000000000000000101",
+		"0x0000000000000000000000000000000000000102",
+		"0x0000000000000000000000000000000000000103"
+	],
+	"producers": [
+		{"address": "0x0000000000000000000000000000000000000201", "url": "https://p1.example.org", "stake": "3000000000000000000000000"},
+		{"address": "0x0000000000000000000000000000000000000202", "url": "https://p2.example.org", "stake": "3000000000000000000000000"},
+		{"address": "0x0000000000000000000000000000000000000203", "url": "https://p3.example.org", "stake": "3000000000000000000000000"},
+		{"address": "0x0000000000000000000000000000000000000204", "url": "https://p4.example.org", "stake": "3000000000000000000000000"},
+		{"address": "0x0000000000000000000000000000000000000205", "url": "https://p5.example.org", "stake": "0x27b46536c66c8e3000000"}
+	]
+}`
+
+// Tests that KYC providers and producers listed in the genesis spec are
+// registered in the genesis state, with enough stake to activate dpos.
+func TestGenesisKycProvidersAndProducers(t *testing.T) {
+	genesis := new(Genesis)
+	if err := json.Unmarshal([]byte(dposGenesisJSON), genesis); err != nil {
+		t.Fatalf("failed to decode genesis: %v", err)
+	}
+	if len(genesis.KycProviders) != 3 || len(genesis.Producers) != 5 {
+		t.Fatalf("decoded genesis mismatch: have %d providers and %d producers, want 3 and 5", len(genesis.KycProviders), len(genesis.Producers))
+	}
+	db, _ := wondb.NewMemDatabase()
+	block := genesis.MustCommit(db)
+
+	statedb, err := state.New(block.Root(), state.NewDatabase(db))
+	if err != nil {
+		t.Fatalf("failed to open genesis state: %v", err)
+	}
+	if count := statedb.GetKycProviderCount(); count != 3 {
+		t.Errorf("kyc provider count mismatch: have %d, want 3", count)
+	}
+	for _, provider := range genesis.KycProviders {
+		if !statedb.KycProviderExists(provider) {
+			t.Errorf("kyc provider %x not registered", provider)
+		}
+		if level := statedb.GetKycLevel(provider, 0); level != 99999999 {
+			t.Errorf("kyc provider %x level mismatch: have %d, want 99999999", provider, level)
+		}
+	}
+	// The stakes are taken from the allocations of the producers
+	for i, producer := range genesis.Producers {
+		want := new(big.Int)
+		if i == len(genesis.Producers)-1 {
+			want.SetUint64(0x1000)
+		}
+		if balance := statedb.GetBalance(producer.Address); balance.Cmp(want) != 0 {
+			t.Errorf("producer %x balance mismatch: have %v, want %v", producer.Address, balance, want)
+		}
+	}
+	if stake := statedb.GetDposTotalActivatedStake(); stake.Cmp(vm.DposActivatedStakeThreshold) < 0 {
+		t.Errorf("activated stake below threshold: have %v, want at least %v", stake, vm.DposActivatedStakeThreshold)
+	}
+	if balance := statedb.GetBalance(vm.KycContractAddress); balance.Cmp(statedb.GetDposTotalActivatedStake()) != 0 {
+		t.Errorf("locked stake mismatch: have %v, want %v", balance, statedb.GetDposTotalActivatedStake())
+	}
+	if top := statedb.GetProducerTopList(nil, nil); len(top) != 5 {
+		t.Errorf("top producer count mismatch: have %d, want 5", len(top))
+	}
+	// Stakes beyond the allocation, duplicate entries and parameters out of
+	// range are rejected, while ToBlock skips them
+	for name, broken := range map[string]func(g *Genesis){
+		"uncovered stake":    func(g *Genesis) { g.Producers[0].Stake = new(big.Int).Add(g.Producers[0].Stake, big.NewInt(1)) },
+		"duplicate producer": func(g *Genesis) { g.Producers = append(g.Producers, g.Producers[0]) },
+		"duplicate provider": func(g *Genesis) { g.KycProviders = append(g.KycProviders, g.KycProviders[0]) },
+		"history depth":      func(g *Genesis) { g.Config.Kyc = &params.KycConfig{HistoryDepth: params.MaxKycHistoryDepth + 1} },
+	} {
+		invalid := new(Genesis)
+		json.Unmarshal([]byte(dposGenesisJSON), invalid)
+		broken(invalid)
+
+		empty, _ := wondb.NewMemDatabase()
+		if _, _, err := SetupGenesisBlock(empty, invalid); err == nil {
+			t.Errorf("%s: genesis set up", name)
+		}
+		if _, err := invalid.Commit(empty); err == nil {
+			t.Errorf("%s: genesis committed", name)
+		}
+		if block := invalid.ToBlock(nil); block == nil {
+			t.Errorf("%s: no genesis block", name)
+		}
+	}
+	// Changing the registered set must yield a different genesis block
+	genesis.Producers = genesis.Producers[:4]
+	if _, _, err := SetupGenesisBlock(db, genesis); err == nil {
+		t.Errorf("expected genesis mismatch error")
+	} else if _, ok := err.(*GenesisMismatchError); !ok {
+		t.Errorf("unexpected error: %v", err)
+	}
+}
+
+// Tests that the KYC/dpos registry of a populated chain carries over into the
+// genesis of a new network through its JSON snapshot.
+func TestGenesisKycDposRegistry(t *testing.T) {
+	genesis := new(Genesis)
+	if err := json.Unmarshal([]byte(dposGenesisJSON), genesis); err != nil {
+		t.Fatalf("failed to decode genesis: %v", err)
+	}
+	genesis.Config = params.TestChainConfig
+
+	db, _ := wondb.NewMemDatabase()
+	blocks, _ := GenerateChain(genesis.Config, genesis.MustCommit(db), ethash.NewFaker(), db, 8, func(i int, b *BlockGen) {
+		user := common.BigToAddress(big.NewInt(int64(0x1000 + i)))
+		b.statedb.SetKycLevel(user, uint32(i%3+1))
+		b.statedb.SetKycZone(user, uint32(i))
+		b.statedb.SetKycProvider(user, genesis.KycProviders[i%len(genesis.KycProviders)])
+		if i == 4 {
+			b.statedb.AddKycProvider(common.BigToAddress(big.NewInt(0x2000)))
+		}
+	})
+	statedb, _ := state.New(blocks[len(blocks)-1].Root(), state.NewDatabase(db))
+	registry, err := statedb.ExportKycDpos()
+	if err != nil {
+		t.Fatalf("failed to export registry: %v", err)
+	}
+	// The genesis providers attest themselves
+	if len(registry.Attestations) != 11 || len(registry.Providers) != 4 || len(registry.Dpos.ProducerList) != 5 {
+		t.Fatalf("exported registry mismatch: have %d attestations, %d providers and %d producers, want 11, 4 and 5",
+			len(registry.Attestations), len(registry.Providers), len(registry.Dpos.ProducerList))
+	}
+	// Start a new network off the registry and export it again
+	spec, _ := json.Marshal(&Genesis{Config: params.TestChainConfig, GasLimit: genesis.GasLimit, Difficulty: genesis.Difficulty, Alloc: GenesisAlloc{}, KycDpos: registry})
+
+	forked := new(Genesis)
+	if err := json.Unmarshal(spec, forked); err != nil {
+		t.Fatalf("failed to decode forked genesis: %v", err)
+	}
+	db, _ = wondb.NewMemDatabase()
+	block := forked.MustCommit(db)
+
+	statedb, _ = state.New(block.Root(), state.NewDatabase(db))
+	reexported, err := statedb.ExportKycDpos()
+	if err != nil {
+		t.Fatalf("failed to re-export registry: %v", err)
+	}
+	have, _ := json.Marshal(reexported)
+	want, _ := json.Marshal(registry)
+	if string(have) != string(want) {
+		t.Errorf("registry mismatch:\nhave %s\nwant %s", have, want)
+	}
+	// Registries breaking the invariants may not make it into a genesis
+	forked.KycDpos.Providers = append(forked.KycDpos.Providers, forked.KycDpos.Providers[0])
+	if _, err := forked.Commit(db); err == nil {
+		t.Errorf("genesis with duplicate providers committed")
+	}
+	if _, _, err := SetupGenesisBlock(db, forked); err == nil {
+		t.Errorf("genesis with duplicate providers set up over a stored one")
+	} else if _, ok := err.(*GenesisMismatchError); ok {
+		t.Errorf("unexpected error: %v", err)
+	}
+	empty, _ := wondb.NewMemDatabase()
+	if _, hash, err := SetupGenesisBlock(empty, forked); err == nil || hash != (common.Hash{}) {
+		t.Errorf("genesis with duplicate providers set up: hash %x, err %v", hash, err)
+	}
+}
@@ -18,6 +18,7 @@ package state
 
 import (
 	"fmt"
+	"math/big"
 	"sync"
 
 	"github.com/worldopennetwork/go-won/common"
@@ -36,6 +37,9 @@ const (
 
 	// Number of codehash->size associations to keep.
 	codeSizeCacheSize = 100000
+
+	// Number of decoded accounts to keep.
+	accountCacheSize = 16384
 )
 
 // Database wraps access to tries and contract code.
@@ -77,17 +81,85 @@ type Trie interface {
 // high level trie abstraction.
 func NewDatabase(db wondb.Database) Database {
 	csc, _ := lru.New(codeSizeCacheSize)
+	ac, _ := lru.New(accountCacheSize)
 	return &cachingDB{
 		db:            trie.NewDatabase(db),
 		codeSizeCache: csc,
+		accountCache:  ac,
 	}
 }
 
+// NewDatabaseWithKycFlat creates a backing store for state like NewDatabase,
+// keeping a flat copy of the storage of the KYC contract in db along.
+func NewDatabaseWithKycFlat(db wondb.Database) Database {
+	cdb := NewDatabase(db).(*cachingDB)
+	cdb.kycFlat = NewKycFlat(db)
+	return cdb
+}
+
 type cachingDB struct {
 	db            *trie.Database
 	mu            sync.Mutex
 	pastTries     []*trie.SecureTrie
 	codeSizeCache *lru.Cache
+	accountCache  *lru.Cache
+	kycFlat       *KycFlat
+}
+
+// kycFlatOf returns the flat storage of the KYC contract kept by db, if any.
+func kycFlatOf(db Database) *KycFlat {
+	if cdb, ok := db.(*cachingDB); ok {
+		return cdb.kycFlat
+	}
+	return nil
+}
+
+// accountCacher is implemented by databases keeping the accounts decoded from
+// the account tries around, sparing the trie lookup and the decoding when the
+// same account is loaded again on top of the same state root.
+type accountCacher interface {
+	// cachedAccount retrieves the account addr has in the state with the given
+	// root, if it is known. The returned account may be modified by the caller.
+	cachedAccount(root common.Hash, addr common.Address) (Account, bool)
+
+	// cacheAccount records the account addr has in the state with the given root.
+	cacheAccount(root common.Hash, addr common.Address, data Account)
+}
+
+// accountCacheKey identifies an account in a particular state. Accounts never
+// change within a state, so entries don't need to be invalidated: a changed
+// account is stored under the root of the state it was committed to.
+type accountCacheKey struct {
+	root common.Hash
+	addr common.Address
+}
+
+func (db *cachingDB) cachedAccount(root common.Hash, addr common.Address) (Account, bool) {
+	if db.accountCache == nil {
+		return Account{}, false
+	}
+	if cached, ok := db.accountCache.Get(accountCacheKey{root, addr}); ok {
+		return copyAccount(cached.(Account)), true
+	}
+	return Account{}, false
+}
+
+func (db *cachingDB) cacheAccount(root common.Hash, addr common.Address, data Account) {
+	if db.accountCache != nil {
+		db.accountCache.Add(accountCacheKey{root, addr}, copyAccount(data))
+	}
+}
+
+// copyAccount returns a copy of data sharing no memory with it.
+func copyAccount(data Account) Account {
+	if data.Balance != nil {
+		data.Balance = new(big.Int).Set(data.Balance)
+	}
+	if data.SpentToday != nil {
+		data.SpentToday = new(big.Int).Set(data.SpentToday)
+	}
+	data.CodeHash = common.CopyBytes(data.CodeHash)
+	return data
 }
 
 // OpenTrie opens the main account trie.
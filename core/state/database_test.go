@@ -0,0 +1,132 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// Tests that accounts served from the account cache follow the state they are
+// loaded on, across updates, deletions and reverted re-creations.
+func TestAccountCache(t *testing.T) {
+	var (
+		addrA = common.BytesToAddress([]byte{0xa})
+		addrB = common.BytesToAddress([]byte{0xb})
+		addrC = common.BytesToAddress([]byte{0xc})
+	)
+	diskdb, _ := wondb.NewMemDatabase()
+	db := NewDatabase(diskdb)
+
+	state, _ := New(common.Hash{}, db)
+	state.AddBalance(addrA, big.NewInt(1))
+	state.AddBalance(addrB, big.NewInt(2))
+	state.AddBalance(addrC, big.NewInt(3))
+	root1, _ := state.Commit(false)
+
+	// Load everything to fill the cache, then update A and delete B
+	state, _ = New(root1, db)
+	for _, addr := range []common.Address{addrA, addrB, addrC} {
+		state.GetBalance(addr)
+	}
+	state.AddBalance(addrA, big.NewInt(10))
+	state.Suicide(addrB)
+	state.Finalise(true)
+
+	// Re-creating a deleted account and reverting it must not bring it back
+	snap := state.Snapshot()
+	state.CreateAccount(addrB)
+	state.RevertToSnapshot(snap)
+	if state.Exist(addrB) {
+		t.Fatalf("deleted account revived by reverted re-creation")
+	}
+	root2, err := state.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	// The uncached database agrees on the resulting root
+	uncached := &cachingDB{db: db.TrieDB()}
+	state, _ = New(root1, uncached)
+	state.AddBalance(addrA, big.NewInt(10))
+	state.Suicide(addrB)
+	if root, _ := state.Commit(true); root != root2 {
+		t.Fatalf("root mismatch: have %x, want %x", root2, root)
+	}
+	// Both states are served correctly, cached or not
+	for i, tt := range []struct {
+		root    common.Hash
+		balance [3]int64
+		exist   [3]bool
+	}{
+		{root1, [3]int64{1, 2, 3}, [3]bool{true, true, true}},
+		{root2, [3]int64{11, 0, 3}, [3]bool{true, false, true}},
+	} {
+		for _, db := range []Database{db, uncached} {
+			state, _ := New(tt.root, db)
+			for j, addr := range []common.Address{addrA, addrB, addrC} {
+				if have := state.GetBalance(addr); have.Int64() != tt.balance[j] {
+					t.Errorf("test %d, account %x: balance mismatch: have %v, want %d", i, addr, have, tt.balance[j])
+				}
+				if have := state.Exist(addr); have != tt.exist[j] {
+					t.Errorf("test %d, account %x: existence mismatch: have %v, want %v", i, addr, have, tt.exist[j])
+				}
+			}
+		}
+	}
+	// Modifying a loaded account doesn't leak into the cache
+	state, _ = New(root2, db)
+	state.GetBalance(addrC).SetInt64(100)
+	state, _ = New(root2, db)
+	if have := state.GetBalance(addrC); have.Int64() != 3 {
+		t.Errorf("cached account modified: have balance %v, want 3", have)
+	}
+}
+
+// Benchmarks reading the balances of 10k accounts from a fresh state on top of
+// the same root, as every block does, with and without the account cache.
+func BenchmarkGetBalance(b *testing.B) {
+	diskdb, _ := wondb.NewMemDatabase()
+	db := NewDatabase(diskdb)
+
+	state, _ := New(common.Hash{}, db)
+	addrs := make([]common.Address, 10000)
+	for i := range addrs {
+		addrs[i] = common.BigToAddress(big.NewInt(int64(i + 1)))
+		state.AddBalance(addrs[i], big.NewInt(int64(i+1)))
+	}
+	root, _ := state.Commit(false)
+
+	for _, bench := range []struct {
+		name string
+		db   Database
+	}{
+		{"uncached", &cachingDB{db: db.TrieDB()}},
+		{"cached", db},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				state, _ := New(root, bench.db)
+				for _, addr := range addrs {
+					state.GetBalance(addr)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,547 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math/big"
+	"sort"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/common/hexutil"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/rlp"
+	"github.com/worldopennetwork/go-won/trie"
+)
+
+// maxVoterProducers is the number of producers a single voter may vote for.
+const maxVoterProducers = 30
+
+// KycDposDump is the decoded storage of the KYC/dpos pseudo-contract.
+type KycDposDump struct {
+	Root    string            `json:"root"`
+	Kyc     KycDump           `json:"kyc"`
+	Dpos    DposDump          `json:"dpos"`
+	Unknown []DumpKycDposSlot `json:"unknown,omitempty"`
+}
+
+// KycDump is the KYC provider registry along with the provider metadata, the
+// pending provider proposals, the zone policy, the attestation expiry times, the
+// contract creators and the retained KYC changes of every address.
+type KycDump struct {
+	Providers        []common.Address                            `json:"providers"`
+	ProviderInfo     map[common.Address]*common.KycProviderInfo  `json:"providerInfo,omitempty"`
+	Proposals        []*KycProposalDump                          `json:"proposals,omitempty"`
+	ZoneRestrictions []KycZonePairDump                           `json:"zoneRestrictions,omitempty"`
+	Expiry           map[common.Address]uint64                   `json:"expiry,omitempty"`
+	Creators         map[common.Address]common.Address           `json:"creators,omitempty"`
+	History          map[common.Address][]common.KycHistoryEntry `json:"history,omitempty"`
+}
+
+// KycZonePairDump is a pair of zones whose addresses may not transact.
+type KycZonePairDump struct {
+	From uint32 `json:"from"`
+	To   uint32 `json:"to"`
+}
+
+// KycProposalDump is a KYC provider proposal along with the votes cast on it.
+type KycProposalDump struct {
+	ID        uint64                  `json:"id"`
+	Address   common.Address          `json:"address"`
+	StartTime *hexutil.Big            `json:"startTime"`
+	VoteTotal uint64                  `json:"voteTotal"`
+	Type      *hexutil.Big            `json:"type"`
+	Info      *common.KycProviderInfo `json:"info,omitempty"`
+	Votes     []KycVoteDump           `json:"votes"`
+}
+
+// KycVoteDump is a single vote on a KYC provider proposal.
+type KycVoteDump struct {
+	Voter common.Address `json:"voter"`
+	Nay   bool           `json:"nay"`
+}
+
+// DposDump is the dpos staking and producer election state.
+type DposDump struct {
+	TotalActivatedStake      *hexutil.Big `json:"totalActivatedStake"`
+	ThreshActivatedStakeTime *hexutil.Big `json:"threshActivatedStakeTime"`
+	TotalProducerWeight      *hexutil.Big `json:"totalProducerWeight"`
+	LastScheduleUpdateTime   *hexutil.Big `json:"lastScheduleUpdateTime"`
+	TopProducerElectedDone   bool         `json:"topProducerElectedDone"`
+
+	ProducerList []common.Address                 `json:"producerList"`
+	RefundQueue  []common.Address                 `json:"refundQueue,omitempty"` // Voters awaiting the payout of their refund
+	Producers    map[common.Address]*ProducerDump `json:"producers"`
+	Voters       map[common.Address]*VoterDump    `json:"voters"`
+}
+
+// ProducerDump is the registration record of a block producer.
+type ProducerDump struct {
+	URL             string          `json:"url"`
+	TotalVotes      *hexutil.Big    `json:"totalVotes"`
+	Active          bool            `json:"active"`
+	Location        *hexutil.Big    `json:"location"`
+	RegistrationFee *hexutil.Big    `json:"registrationFee,omitempty"` // Fee escrowed until deregistration
+	SigningKey      *common.Address `json:"signingKey,omitempty"`      // Key sealing the blocks, if not its own
+	PrevSigningKey  *common.Address `json:"prevSigningKey,omitempty"`  // Key replaced by the signing key, if not its own
+	SigningKeyBlock *hexutil.Uint64 `json:"signingKeyBlock,omitempty"` // Block the signing key was last changed in
+}
+
+// VoterDump is the staking record of a voter, including any pending refund.
+type VoterDump struct {
+	Staking           *hexutil.Big     `json:"staking"`
+	LastVoteWeight    *hexutil.Big     `json:"lastVoteWeight"`
+	Producers         []common.Address `json:"producers"`
+	RefundAmount      *hexutil.Big     `json:"refundAmount"`
+	RefundRequestTime *hexutil.Big     `json:"refundRequestTime"`
+	AutoRefund        bool             `json:"autoRefund,omitempty"`      // Whether matured refunds are paid out without a claim
+	Proxy             *common.Address  `json:"proxy,omitempty"`           // Proxy the votes are delegated to
+	IsProxy           bool             `json:"isProxy,omitempty"`         // Whether the voter is a registered proxy
+	DelegatedWeight   *hexutil.Big     `json:"delegatedWeight,omitempty"` // Weight delegated to the proxy
+}
+
+// DumpKycDposSlot is a storage slot of the pseudo-contract that could not be
+// decoded, along with the reason why.
+type DumpKycDposSlot struct {
+	Key    common.Hash `json:"key"`
+	Value  common.Hash `json:"value"`
+	Reason string      `json:"reason"`
+}
+
+// DumpKycDpos decodes the committed storage of the KYC/dpos pseudo-contract.
+// Slots that don't fit the known layout are reported rather than skipped.
+func (self *StateDB) DumpKycDpos() KycDposDump {
+	dump := KycDposDump{
+		Root: fmt.Sprintf("%x", self.trie.Hash()),
+		Dpos: DposDump{
+			Producers: make(map[common.Address]*ProducerDump),
+			Voters:    make(map[common.Address]*VoterDump),
+		},
+	}
+	obj := self.getStateObject(vm.KycContractAddress)
+	if obj == nil {
+		return dump
+	}
+	// Gather all the slots, resolving their keys via the preimage store
+	slots := make(map[common.Hash]common.Hash)
+
+	tr := obj.getTrie(self.db)
+	it := trie.NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			dump.Unknown = append(dump.Unknown, DumpKycDposSlot{common.BytesToHash(it.Key), common.BytesToHash(it.Value), "undecodable value"})
+			continue
+		}
+		key := tr.GetKey(it.Key)
+		if key == nil {
+			dump.Unknown = append(dump.Unknown, DumpKycDposSlot{common.BytesToHash(it.Key), common.BytesToHash(content), "missing preimage"})
+			continue
+		}
+		slots[common.BytesToHash(key)] = common.BytesToHash(content)
+	}
+	take := func(key common.Hash) common.Hash {
+		value := slots[key]
+		delete(slots, key)
+		return value
+	}
+	indexed := func(i int64) common.Hash {
+		return take(common.BigToHash(big.NewInt(i)))
+	}
+	// counter reads a list length, rejecting values no storage could back
+	counter := func(key common.Hash) int64 {
+		value := take(key)
+		if count := value.Big(); count.Cmp(big.NewInt(int64(len(slots)))) > 0 {
+			dump.Unknown = append(dump.Unknown, DumpKycDposSlot{key, value, "count out of range"})
+			return 0
+		}
+		return value.Big().Int64()
+	}
+	// info reassembles provider metadata stored as a length and 32 byte chunks
+	info := func(addr common.Address, slot func(i int64) common.Hash, read func(i int64) common.Hash) *common.KycProviderInfo {
+		length := read(0)
+		if length == (common.Hash{}) {
+			return nil
+		}
+		if length.Big().Cmp(big.NewInt(vm.KycProviderInfoMaxSize)) > 0 {
+			dump.Unknown = append(dump.Unknown, DumpKycDposSlot{slot(0), length, "invalid value"})
+			return nil
+		}
+		blob := make([]byte, 0, length.Big().Int64()+common.HashLength)
+		for i := int64(1); int64(len(blob)) < length.Big().Int64(); i++ {
+			chunk := read(i)
+			blob = append(blob, chunk[:]...)
+		}
+		decoded := &common.KycProviderInfo{Address: addr}
+		if err := rlp.DecodeBytes(blob[:length.Big().Int64()], decoded); err != nil {
+			dump.Unknown = append(dump.Unknown, DumpKycDposSlot{slot(0), length, "undecodable provider info"})
+			return nil
+		}
+		return decoded
+	}
+	// Decode the KYC provider registry and the pending proposal
+	count := counter(kycProviderNumberKey)
+	dump.Kyc.Providers = make([]common.Address, 0, count)
+	for i := int64(0); i < count; i++ {
+		dump.Kyc.Providers = append(dump.Kyc.Providers, common.BytesToAddress(indexed(kycProviderStartHash+i).Bytes()))
+	}
+	head, tail := take(kycProposalHeadKey).Big().Uint64(), take(kycProposalTailKey).Big().Uint64()
+	if _, ok := slots[kycProposalVoteTotalKey]; ok && tail == 0 {
+		tail = 1 // made before the queue existed
+	}
+	if tail-head > vm.KycMaxProposals {
+		dump.Unknown = append(dump.Unknown, DumpKycDposSlot{kycProposalTailKey, common.BigToHash(new(big.Int).SetUint64(tail)), "count out of range"})
+		tail = head
+	}
+	for id := head; id < tail; id++ {
+		s := kycProposalSlot(id)
+		if _, ok := slots[kycProposalKey(s, kycProposalVoteTotalField)]; !ok {
+			continue
+		}
+		proposal := &KycProposalDump{
+			ID:        id,
+			Address:   common.BytesToAddress(take(kycProposalKey(s, kycProposalAddressField)).Bytes()),
+			StartTime: (*hexutil.Big)(take(kycProposalKey(s, kycProposalStartTimeField)).Big()),
+			VoteTotal: uint64(counter(kycProposalKey(s, kycProposalVoteTotalField))),
+			Type:      (*hexutil.Big)(take(kycProposalKey(s, kycProposalTypeField)).Big()),
+			Votes:     []KycVoteDump{},
+		}
+		for i := int64(0); i < int64(proposal.VoteTotal); i++ {
+			voter, result := take(kycProposalVoterKey(s, i)), take(kycProposalResultKey(s, i))
+			if voter == (common.Hash{}) {
+				continue
+			}
+			proposal.Votes = append(proposal.Votes, KycVoteDump{
+				Voter: common.BytesToAddress(voter.Bytes()),
+				Nay:   result == common.BigToHash(common.Big2),
+			})
+		}
+		proposal.Info = info(proposal.Address, kycProposalInfoSlot(s), func(i int64) common.Hash {
+			return take(kycProposalInfoSlot(s)(i))
+		})
+		dump.Kyc.Proposals = append(dump.Kyc.Proposals, proposal)
+	}
+	counter(kycZoneRestrictionCountKey)
+
+	// Decode the dpos globals and the producer list
+	dump.Dpos.TotalActivatedStake = (*hexutil.Big)(take(dposTotalActivatedStakeKey).Big())
+	dump.Dpos.ThreshActivatedStakeTime = (*hexutil.Big)(take(dposThreshActivatedStakeTimeKey).Big())
+	dump.Dpos.TotalProducerWeight = (*hexutil.Big)(take(dposTotalProducerVoteWeightKey).Big())
+	dump.Dpos.LastScheduleUpdateTime = (*hexutil.Big)(take(dposLastProducerScheduleUpdateTimeKey).Big())
+	dump.Dpos.TopProducerElectedDone = take(dposTopProducerElectedDoneKey) != (common.Hash{})
+
+	count = counter(dposProducerCountKey)
+	dump.Dpos.ProducerList = make([]common.Address, 0, count)
+	for i := int64(0); i < count; i++ {
+		dump.Dpos.ProducerList = append(dump.Dpos.ProducerList, common.BytesToAddress(indexed(dposProducerAllStartKey+i).Bytes()))
+	}
+	head, tail = take(dposRefundQueueHeadKey).Big().Uint64(), take(dposRefundQueueTailKey).Big().Uint64()
+	if tail < head || tail-head > uint64(len(slots)) {
+		dump.Unknown = append(dump.Unknown, DumpKycDposSlot{dposRefundQueueTailKey, common.BigToHash(new(big.Int).SetUint64(tail)), "count out of range"})
+		tail = head
+	}
+	for i := int64(head); i < int64(tail); i++ {
+		// entries of voters that left the queue are skipped when reaching the head
+		addr := common.BytesToAddress(indexed(dposRefundQueueStartKey + i).Bytes())
+		if slots[common.AddressToHashWithPrefix(&addr, dposVoterRefundQueueKey)] == common.BigToHash(big.NewInt(i+1)) {
+			dump.Dpos.RefundQueue = append(dump.Dpos.RefundQueue, addr)
+		}
+	}
+	// Decode the per-address producer and voter records
+	producer := func(addr common.Address) *ProducerDump {
+		if dump.Dpos.Producers[addr] == nil {
+			dump.Dpos.Producers[addr] = &ProducerDump{TotalVotes: new(hexutil.Big), Location: new(hexutil.Big)}
+		}
+		return dump.Dpos.Producers[addr]
+	}
+	voter := func(addr common.Address) *VoterDump {
+		if dump.Dpos.Voters[addr] == nil {
+			dump.Dpos.Voters[addr] = &VoterDump{
+				Staking:           new(hexutil.Big),
+				LastVoteWeight:    new(hexutil.Big),
+				Producers:         []common.Address{},
+				RefundAmount:      new(hexutil.Big),
+				RefundRequestTime: new(hexutil.Big),
+			}
+		}
+		return dump.Dpos.Voters[addr]
+	}
+	var (
+		urls    = make(map[common.Address][2]common.Hash)
+		counts  = make(map[common.Address]int64)
+		votes   = make(map[common.Address][maxVoterProducers]common.Hash)
+		history = make(map[common.Address]common.Hash)
+		records = make(map[common.Address]map[int64]common.Hash)
+		infos   = make(map[common.Address]map[int64]common.Hash)
+	)
+	for key, value := range slots {
+		prefix, addr, ok := splitAddressKey(key)
+		if !ok {
+			continue
+		}
+		switch {
+		case prefix == dposProducerURLKey:
+			url := urls[addr]
+			url[0] = value
+			urls[addr] = url
+			producer(addr)
+
+		case prefix == dposProducerURLKeyHigh:
+			url := urls[addr]
+			url[1] = value
+			urls[addr] = url
+			producer(addr)
+
+		case prefix == dposProducerTotalVotesKey:
+			producer(addr).TotalVotes = (*hexutil.Big)(value.Big())
+
+		case prefix == dposProducerActiveKey:
+			if value != common.BigToHash(common.Big1) {
+				continue
+			}
+			producer(addr).Active = true
+
+		case prefix == dposProducerLocationKey:
+			producer(addr).Location = (*hexutil.Big)(value.Big())
+
+		case prefix == dposProducerFeeKey:
+			producer(addr).RegistrationFee = (*hexutil.Big)(value.Big())
+
+		case prefix == dposProducerSigningKeyKey:
+			signingKey := common.BytesToAddress(value.Bytes())
+			producer(addr).SigningKey = &signingKey
+
+		case prefix == dposProducerPrevSigningKeyKey:
+			prevSigningKey := common.BytesToAddress(value.Bytes())
+			producer(addr).PrevSigningKey = &prevSigningKey
+
+		case prefix == dposProducerSigningKeyBlockKey:
+			signingKeyBlock := hexutil.Uint64(value.Big().Uint64())
+			producer(addr).SigningKeyBlock = &signingKeyBlock
+
+		case prefix == dposSigningKeyProducerKey:
+			// the producers of the signing keys are implied by their keys
+
+		case prefix == dposVoterStakingKey:
+			voter(addr).Staking = (*hexutil.Big)(value.Big())
+
+		case prefix == dposVoterLastVoteWeightKey:
+			voter(addr).LastVoteWeight = (*hexutil.Big)(value.Big())
+
+		case prefix == dposVoterRefundAmountBeginKey:
+			voter(addr).RefundAmount = (*hexutil.Big)(value.Big())
+
+		case prefix == dposVoterRefundReqestTimeBeginKey:
+			voter(addr).RefundRequestTime = (*hexutil.Big)(value.Big())
+
+		case prefix == dposVoterAutoRefundKey:
+			if value != common.BigToHash(common.Big1) {
+				continue
+			}
+			voter(addr).AutoRefund = true
+
+		case prefix == dposVoterRefundQueueKey:
+			// the position of the voter is implied by the refund queue
+			voter(addr)
+
+		case prefix == dposVoterCountKey:
+			if value.Big().Cmp(big.NewInt(maxVoterProducers)) > 0 {
+				continue
+			}
+			counts[addr] = value.Big().Int64()
+			voter(addr)
+
+		case prefix >= dposVoterBpAddressBeginKey && prefix < dposVoterBpAddressBeginKey+maxVoterProducers:
+			vote := votes[addr]
+			vote[prefix-dposVoterBpAddressBeginKey] = value
+			votes[addr] = vote
+			voter(addr)
+
+		case prefix == dposProxyKey:
+			if value != common.BigToHash(common.Big1) {
+				continue
+			}
+			voter(addr).IsProxy = true
+
+		case prefix == dposProxyWeightKey:
+			voter(addr).DelegatedWeight = (*hexutil.Big)(value.Big())
+
+		case prefix == dposVoterProxyKey:
+			proxy := common.BytesToAddress(value.Bytes())
+			voter(addr).Proxy = &proxy
+
+		case prefix == dposProxyFirstDelegatorKey || prefix == dposVoterProxyNextKey || prefix == dposVoterProxyPrevKey:
+			// the delegator lists of the proxies are implied by the proxies of the voters
+			voter(addr)
+
+		case prefix == kycExpiryKey:
+			if !value.Big().IsUint64() {
+				continue
+			}
+			if dump.Kyc.Expiry == nil {
+				dump.Kyc.Expiry = make(map[common.Address]uint64)
+			}
+			dump.Kyc.Expiry[addr] = value.Big().Uint64()
+
+		case prefix == kycContractCreatorKey:
+			if dump.Kyc.Creators == nil {
+				dump.Kyc.Creators = make(map[common.Address]common.Address)
+			}
+			dump.Kyc.Creators[addr] = common.BytesToAddress(value.Bytes())
+
+		case prefix == kycZoneRestrictionKey:
+			if value != common.BigToHash(common.Big1) {
+				continue
+			}
+			dump.Kyc.ZoneRestrictions = append(dump.Kyc.ZoneRestrictions, KycZonePairDump{
+				From: binary.BigEndian.Uint32(addr[12:16]),
+				To:   binary.BigEndian.Uint32(addr[16:20]),
+			})
+
+		case prefix >= kycProviderInfoKey && prefix <= kycProviderInfoKey+(vm.KycProviderInfoMaxSize+common.HashLength-1)/common.HashLength:
+			if infos[addr] == nil {
+				infos[addr] = make(map[int64]common.Hash)
+			}
+			infos[addr][prefix-kycProviderInfoKey] = value
+
+		case prefix == kycHistoryCountKey:
+			history[addr] = value
+
+		case prefix >= kycHistoryEntryBeginKey:
+			if records[addr] == nil {
+				records[addr] = make(map[int64]common.Hash)
+			}
+			records[addr][prefix] = value
+
+		default:
+			continue
+		}
+		delete(slots, key)
+	}
+	for addr, url := range urls {
+		dump.Dpos.Producers[addr].URL = string(append(bytes.Trim(url[0].Bytes(), "\x00"), bytes.Trim(url[1].Bytes(), "\x00")...))
+	}
+	for addr, record := range dump.Dpos.Voters {
+		count, vote := counts[addr], votes[addr]
+		for i := int64(0); i < maxVoterProducers; i++ {
+			switch {
+			case i < count:
+				record.Producers = append(record.Producers, common.BytesToAddress(vote[i].Bytes()))
+			case vote[i] != (common.Hash{}):
+				key := common.AddressToHashWithPrefix(&addr, dposVoterBpAddressBeginKey+i)
+				dump.Unknown = append(dump.Unknown, DumpKycDposSlot{key, vote[i], "stale voter producer"})
+			}
+		}
+	}
+	for addr, counter := range history {
+		total, depth := binary.BigEndian.Uint64(counter[24:]), binary.BigEndian.Uint64(counter[16:24])
+		if depth == 0 || total == 0 {
+			key := common.AddressToHashWithPrefix(&addr, kycHistoryCountKey)
+			dump.Unknown = append(dump.Unknown, DumpKycDposSlot{key, counter, "invalid value"})
+			continue
+		}
+		retained := total
+		if retained > depth {
+			retained = depth
+		}
+		if dump.Kyc.History == nil {
+			dump.Kyc.History = make(map[common.Address][]common.KycHistoryEntry)
+		}
+		entries := make([]common.KycHistoryEntry, 0, retained)
+		for i := uint64(0); i < retained; i++ {
+			pos := kycHistoryEntryBeginKey + 2*int64((total-retained+i)%depth)
+			entries = append(entries, decodeKycHistoryEntry(records[addr][pos], records[addr][pos+1]))
+			delete(records[addr], pos)
+			delete(records[addr], pos+1)
+		}
+		dump.Kyc.History[addr] = entries
+	}
+	for addr, slots := range infos {
+		decoded := info(addr, kycProviderInfoSlot(addr), func(i int64) common.Hash {
+			value := slots[i]
+			delete(slots, i)
+			return value
+		})
+		if decoded != nil {
+			if dump.Kyc.ProviderInfo == nil {
+				dump.Kyc.ProviderInfo = make(map[common.Address]*common.KycProviderInfo)
+			}
+			dump.Kyc.ProviderInfo[addr] = decoded
+		}
+		for i, value := range slots {
+			dump.Unknown = append(dump.Unknown, DumpKycDposSlot{kycProviderInfoSlot(addr)(i), value, "stale provider info"})
+		}
+	}
+	for addr, slots := range records {
+		for prefix, value := range slots {
+			key := common.AddressToHashWithPrefix(&addr, prefix)
+			dump.Unknown = append(dump.Unknown, DumpKycDposSlot{key, value, "stale history entry"})
+		}
+	}
+	sort.Slice(dump.Kyc.ZoneRestrictions, func(i, j int) bool {
+		a, b := dump.Kyc.ZoneRestrictions[i], dump.Kyc.ZoneRestrictions[j]
+		return a.From < b.From || (a.From == b.From && a.To < b.To)
+	})
+	// Anything left over doesn't match the known layout
+	for key, value := range slots {
+		dump.Unknown = append(dump.Unknown, DumpKycDposSlot{key, value, classifySlot(key)})
+	}
+	sort.Slice(dump.Unknown, func(i, j int) bool {
+		return bytes.Compare(dump.Unknown[i].Key[:], dump.Unknown[j].Key[:]) < 0
+	})
+	return dump
+}
+
+// splitAddressKey splits a storage key built by common.AddressToHashWithPrefix
+// into its prefix and address.
+func splitAddressKey(key common.Hash) (int64, common.Address, bool) {
+	prefix := common.BytesToInt64(key[:8])
+	if prefix == 0 || !bytes.Equal(key[8:common.HashLength-common.AddressLength], make([]byte, common.HashLength-common.AddressLength-8)) {
+		return 0, common.Address{}, false
+	}
+	return prefix, common.BytesToAddress(key[common.HashLength-common.AddressLength:]), true
+}
+
+// classifySlot explains why a slot left over after decoding wasn't accounted for.
+func classifySlot(key common.Hash) string {
+	if prefix, _, ok := splitAddressKey(key); ok {
+		if prefix == dposProducerActiveKey || prefix == dposVoterCountKey || prefix == dposProxyKey || prefix == dposVoterAutoRefundKey || prefix == kycExpiryKey || prefix == kycZoneRestrictionKey {
+			return "invalid value"
+		}
+		return "unknown slot"
+	}
+	n := key.Big()
+	switch {
+	case n.Cmp(big.NewInt(dposRefundQueueStartKey)) >= 0:
+		return "stale refund queue entry"
+	case n.Cmp(big.NewInt(dposProducerAllStartKey)) >= 0:
+		return "stale producer list entry"
+	case n.Cmp(big.NewInt(kycProposalStartHash)) >= 0:
+		return "stale proposal"
+	case n.Cmp(big.NewInt(kycProposalInfoStartHash)) >= 0:
+		return "stale proposal info"
+	case n.Cmp(big.NewInt(kycVoteResultStartHash)) >= 0:
+		return "stale proposal vote result"
+	case n.Cmp(big.NewInt(kycVoterStartHash)) >= 0:
+		return "stale proposal voter"
+	case n.Cmp(big.NewInt(kycProviderStartHash)) >= 0:
+		return "stale provider entry"
+	}
+	return "unknown slot"
+}
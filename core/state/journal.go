@@ -131,6 +131,11 @@ type (
 		prev    *common.Address
 	}
 
+	kycSlotWriteChange struct {
+		txIndex int
+		key     common.Hash
+	}
+
 	// Changes to other state values.
 	refundChange struct {
 		prev uint64
@@ -229,7 +234,10 @@ func (ch refundChange) dirtied() *common.Address {
 func (ch addLogChange) revert(s *StateDB) {
 	logs := s.logs[ch.txhash]
 	if len(logs) == 1 {
+		// the log reverted is the last one emitted, so the transaction is the
+		// last one to have logged first too
 		delete(s.logs, ch.txhash)
+		s.logOrder = s.logOrder[:len(s.logOrder)-1]
 	} else {
 		s.logs[ch.txhash] = logs[:len(logs)-1]
 	}
@@ -271,3 +279,11 @@ func (ch kycProviderChange) revert(s *StateDB) {
 func (ch kycProviderChange) dirtied() *common.Address {
 	return ch.account
 }
+
+func (ch kycSlotWriteChange) revert(s *StateDB) {
+	delete(s.kycSlots[ch.txIndex].writes, ch.key)
+}
+
+func (ch kycSlotWriteChange) dirtied() *common.Address {
+	return nil
+}
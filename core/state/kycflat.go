@@ -0,0 +1,222 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/log"
+	"github.com/worldopennetwork/go-won/rlp"
+	"github.com/worldopennetwork/go-won/trie"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+var (
+	kycFlatPrefix    = []byte("kycflat-")       // kycFlatPrefix + slot hash -> generation + value
+	kycFlatMarkerKey = []byte("kycflat-marker") // Storage root and generation of the flat storage
+)
+
+// kycFlatVerifyInterval is how often a value served by the flat storage is
+// checked against the trie, one in every that many.
+var kycFlatVerifyInterval = uint64(256)
+
+// kycFlatMarker is the position of the flat storage.
+type kycFlatMarker struct {
+	Root common.Hash // Storage root of the KYC contract the entries match
+	Gen  uint64      // Generation of the entries, older ones being ignored
+}
+
+// KycFlat is a flat copy of the storage of the KYC contract kept in the key-value
+// store, sparing the trie lookups of the provider and producer checks, most of
+// all on a cold start.
+//
+// It is tagged with the storage root it matches, and only serves states whose
+// KYC contract storage is at that very root. Every commit of the contract storage
+// moves it along, regenerating it from the trie first if it was at a different
+// root, as happens on reorgs. Entries are stamped with a generation, bumped on
+// every regeneration, so that the stale ones never need to be deleted.
+type KycFlat struct {
+	db wondb.Database
+
+	lock   sync.RWMutex
+	marker kycFlatMarker
+
+	reads uint64 // Number of values served, for picking the ones to verify
+}
+
+// NewKycFlat opens the flat storage kept in db, at the root it was last left at.
+func NewKycFlat(db wondb.Database) *KycFlat {
+	f := &KycFlat{db: db}
+	if blob, err := db.Get(kycFlatMarkerKey); err == nil {
+		if err := rlp.DecodeBytes(blob, &f.marker); err != nil {
+			log.Warn("Failed to decode KYC flat storage marker", "err", err)
+			f.marker = kycFlatMarker{}
+		}
+	}
+	return f
+}
+
+// Root returns the storage root of the KYC contract the flat storage matches.
+func (f *KycFlat) Root() common.Hash {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	return f.marker.Root
+}
+
+// kycFlatKey = kycFlatPrefix + slot hash
+func kycFlatKey(slotHash common.Hash) []byte {
+	return append(append([]byte{}, kycFlatPrefix...), slotHash[:]...)
+}
+
+// get retrieves the value of the slot key under the storage root, if the flat
+// storage matches it. The value is flagged if it should be verified against
+// the trie.
+func (f *KycFlat) get(root common.Hash, key common.Hash) (value common.Hash, verify bool, ok bool) {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+
+	if f.marker.Root != root {
+		return common.Hash{}, false, false
+	}
+	if enc, err := f.db.Get(kycFlatKey(crypto.Keccak256Hash(key[:]))); err == nil && len(enc) >= 8 {
+		if binary.BigEndian.Uint64(enc) == f.marker.Gen {
+			value.SetBytes(enc[8:])
+		}
+	}
+	return value, atomic.AddUint64(&f.reads, 1)%kycFlatVerifyInterval == 0, true
+}
+
+// invalidate drops the content of the flat storage, leaving it empty.
+func (f *KycFlat) invalidate() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if err := f.reset(); err != nil {
+		log.Error("Failed to invalidate KYC flat storage", "err", err)
+	}
+}
+
+// reset moves the flat storage to a new generation, leaving it empty. The lock
+// must be held.
+func (f *KycFlat) reset() error {
+	f.marker = kycFlatMarker{Gen: f.marker.Gen + 1}
+	blob, err := rlp.EncodeToBytes(f.marker)
+	if err != nil {
+		return err
+	}
+	return f.db.Put(kycFlatMarkerKey, blob)
+}
+
+// update moves the flat storage from the storage root parent of the KYC contract
+// to root by applying the changed slots, regenerating it at parent from the trie
+// first if it's somewhere else.
+func (f *KycFlat) update(db Database, addrHash, parent, root common.Hash, changes Storage) error {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	if f.marker.Root != parent {
+		if err := f.regenerate(db, addrHash, parent); err != nil {
+			return err
+		}
+	}
+	batch := f.db.NewBatch()
+	for key, value := range changes {
+		if (value == common.Hash{}) {
+			batch.Delete(kycFlatKey(crypto.Keccak256Hash(key[:])))
+			continue
+		}
+		batch.Put(kycFlatKey(crypto.Keccak256Hash(key[:])), kycFlatEntry(f.marker.Gen, value[:]))
+	}
+	marker := kycFlatMarker{Root: root, Gen: f.marker.Gen}
+	blob, err := rlp.EncodeToBytes(marker)
+	if err != nil {
+		return err
+	}
+	batch.Put(kycFlatMarkerKey, blob)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	f.marker = marker
+	return nil
+}
+
+// regenerate rebuilds the flat storage from the storage trie of the KYC contract
+// at root. The lock must be held.
+//
+// The flat storage is emptied first, so that being interrupted halfway leaves
+// it unusable rather than inconsistent, and the entries written in the next
+// generation up.
+func (f *KycFlat) regenerate(db Database, addrHash, root common.Hash) error {
+	if err := f.reset(); err != nil {
+		return err
+	}
+	// An empty storage is exactly what the flat storage is now
+	if root == (common.Hash{}) || root == types.EmptyRootHash {
+		return nil
+	}
+	log.Info("Regenerating KYC flat storage", "root", root)
+
+	tr, err := db.OpenStorageTrie(addrHash, root)
+	if err != nil {
+		return err
+	}
+	gen := f.marker.Gen + 1
+
+	batch := f.db.NewBatch()
+	it := trie.NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			return err
+		}
+		batch.Put(kycFlatKey(common.BytesToHash(it.Key)), kycFlatEntry(gen, content))
+		if batch.ValueSize() >= wondb.IdealBatchSize {
+			if err := batch.Write(); err != nil {
+				return err
+			}
+			batch.Reset()
+		}
+	}
+	if it.Err != nil {
+		return it.Err
+	}
+	marker := kycFlatMarker{Root: root, Gen: gen}
+	blob, err := rlp.EncodeToBytes(marker)
+	if err != nil {
+		return err
+	}
+	batch.Put(kycFlatMarkerKey, blob)
+	if err := batch.Write(); err != nil {
+		return err
+	}
+	f.marker = marker
+	return nil
+}
+
+// kycFlatEntry encodes the value of a slot stamped with the generation.
+func kycFlatEntry(gen uint64, value []byte) []byte {
+	enc := make([]byte, 8, 8+len(value))
+	binary.BigEndian.PutUint64(enc, gen)
+	return append(enc, bytes.TrimLeft(value, "\x00")...)
+}
@@ -0,0 +1,155 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// kycFlatRoot returns the storage root of the KYC contract in the state root.
+func kycFlatRoot(t testing.TB, db Database, root common.Hash) common.Hash {
+	statedb, err := New(root, db)
+	if err != nil {
+		t.Fatalf("failed to open state %x: %v", root, err)
+	}
+	return statedb.getStateObject(vm.KycContractAddress).data.Root
+}
+
+// Tests that the flat storage of the KYC contract follows the commits on top of
+// it, is regenerated when a commit forks off elsewhere, and is only ever used
+// for the state it matches.
+func TestKycFlatReorg(t *testing.T) {
+	var (
+		p1 = common.Address{0x01}
+		p2 = common.Address{0x02}
+		p3 = common.Address{0x03}
+		p4 = common.Address{0x04}
+	)
+	diskdb, _ := wondb.NewMemDatabase()
+	db := NewDatabaseWithKycFlat(diskdb)
+	flat := kycFlatOf(db)
+
+	state, _ := New(common.Hash{}, db)
+	state.AddKycProvider(p1)
+	state.AddKycProvider(p2)
+	rootA, _ := state.Commit(false)
+	if have, want := flat.Root(), kycFlatRoot(t, db, rootA); have != want {
+		t.Fatalf("flat storage not following the commit: have %x, want %x", have, want)
+	}
+	// Extend the state on two branches, the second one forcing a regeneration
+	state, _ = New(rootA, db)
+	state.AddKycProvider(p3)
+	rootB, _ := state.Commit(false)
+
+	state, _ = New(rootA, db)
+	state.RemoveKycProvider(p1)
+	state.AddKycProvider(p4)
+	rootC, _ := state.Commit(false)
+	if have, want := flat.Root(), kycFlatRoot(t, db, rootC); have != want {
+		t.Fatalf("flat storage not regenerated: have %x, want %x", have, want)
+	}
+	// Both branches read the same through the flat storage or the trie, a cold
+	// restart picking the flat storage up where it was
+	plain := &cachingDB{db: db.TrieDB()}
+	restarted := NewDatabaseWithKycFlat(diskdb).(*cachingDB)
+	restarted.db = db.TrieDB()
+
+	for _, root := range []common.Hash{rootA, rootB, rootC} {
+		for _, db := range []Database{db, restarted} {
+			want, _ := New(root, plain)
+			have, _ := New(root, db)
+			for _, addr := range []common.Address{p1, p2, p3, p4} {
+				if have, want := have.KycProviderExists(addr), want.KycProviderExists(addr); have != want {
+					t.Errorf("root %x, provider %x: existence mismatch: have %v, want %v", root, addr, have, want)
+				}
+			}
+		}
+	}
+	if have, want := kycFlatOf(restarted).Root(), flat.Root(); have != want {
+		t.Errorf("restarted flat storage root mismatch: have %x, want %x", have, want)
+	}
+}
+
+// Tests that a corrupted flat storage is caught when verifying the values it
+// serves, falling back to the trie and dropping the flat storage.
+func TestKycFlatMismatch(t *testing.T) {
+	defer func(interval uint64) { kycFlatVerifyInterval = interval }(kycFlatVerifyInterval)
+	kycFlatVerifyInterval = 1
+
+	provider := common.Address{0x01}
+
+	diskdb, _ := wondb.NewMemDatabase()
+	db := NewDatabaseWithKycFlat(diskdb)
+	flat := kycFlatOf(db)
+
+	state, _ := New(common.Hash{}, db)
+	state.AddKycProvider(provider)
+	root, _ := state.Commit(false)
+
+	// Point the only provider slot somewhere else
+	slot := common.BigToHash(big.NewInt(kycProviderStartHash))
+	diskdb.Put(kycFlatKey(crypto.Keccak256Hash(slot[:])), kycFlatEntry(flat.marker.Gen, common.Address{0xff}.Bytes()))
+
+	state, _ = New(root, db)
+	if !state.KycProviderExists(provider) {
+		t.Errorf("corrupted flat storage served")
+	}
+	if flat.Root() != (common.Hash{}) {
+		t.Errorf("corrupted flat storage not dropped")
+	}
+}
+
+// Benchmarks checking a KYC provider on a cold start, with and without the flat
+// storage of the KYC contract.
+func BenchmarkKycProviderExistsColdStart(b *testing.B) {
+	diskdb, _ := wondb.NewMemDatabase()
+	db := NewDatabaseWithKycFlat(diskdb)
+
+	state, _ := New(common.Hash{}, db)
+	for i := 0; i < 64; i++ {
+		state.AddKycProvider(common.BigToAddress(big.NewInt(int64(0xff00 + i))))
+	}
+	root, _ := state.Commit(false)
+	if err := db.TrieDB().Commit(root, false); err != nil {
+		b.Fatalf("failed to flush state: %v", err)
+	}
+	last := common.BigToAddress(big.NewInt(0xff00 + 63))
+
+	for _, bench := range []struct {
+		name string
+		open func(wondb.Database) Database
+	}{
+		{"trie", NewDatabase},
+		{"flat", NewDatabaseWithKycFlat},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				state, _ := New(root, bench.open(newColdDatabase(diskdb, 20*time.Microsecond)))
+				if !state.KycProviderExists(last) {
+					b.Fatalf("provider missing")
+				}
+			}
+		})
+	}
+}
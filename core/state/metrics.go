@@ -0,0 +1,28 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+// Contains the metrics collected by the KYC contract state accessors.
+
+package state
+
+import (
+	"github.com/worldopennetwork/go-won/metrics"
+)
+
+var (
+	kycProviderScanMeter = metrics.NewRegisteredMeter("won/vm/kyc/provider_scans", nil)
+	dposElectionMeter    = metrics.NewRegisteredMeter("won/vm/dpos/elections", nil)
+)
@@ -0,0 +1,95 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"math/big"
+	"sync"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+)
+
+// prefetchKycProviders is the number of KYC providers whose slots are loaded
+// ahead of a block, the provider checks of every transfer scanning them.
+const prefetchKycProviders = 64
+
+// prefetchWorkers is the number of goroutines loading the accounts of a block,
+// keeping ahead of the transactions being processed.
+const prefetchWorkers = 4
+
+// Prefetch loads the trie nodes the transactions txs of a block on top of root
+// are bound to touch, so that processing the block finds them in the caches of
+// the database rather than on disk: the storage of the KYC contract read by
+// every transfer and the accounts of the senders and recipients, along with
+// their KYC records. The senders are recovered with signer on the way.
+//
+// It works on its own views of the state, so it never affects the state the
+// block is processed on, and is meant to run alongside it, giving up once
+// interrupt is closed. Any error is ignored, processing the block will run into
+// it again.
+func Prefetch(db Database, root common.Hash, txs types.Transactions, signer types.Signer, interrupt <-chan struct{}) {
+	interrupted := func() bool {
+		select {
+		case <-interrupt:
+			return true
+		default:
+			return false
+		}
+	}
+	var wg sync.WaitGroup
+	for w := 0; w < prefetchWorkers; w++ {
+		statedb, err := New(root, db)
+		if err != nil {
+			return
+		}
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+
+			// The provider list is shared by all transactions, warm it first
+			if w == 0 {
+				count := statedb.GetKycProviderCount()
+				statedb.GetKycZoneRestrictionCount()
+				for i := int64(0); i < count && i < prefetchKycProviders; i++ {
+					if interrupted() {
+						return
+					}
+					statedb.GetState(vm.KycContractAddress, common.BigToHash(big.NewInt(kycProviderStartHash+i)))
+				}
+			}
+			for i := w; i < len(txs); i += prefetchWorkers {
+				if interrupted() {
+					return
+				}
+				accounts := make([]common.Address, 0, 2)
+				if from, err := types.Sender(signer, txs[i]); err == nil {
+					accounts = append(accounts, from)
+				}
+				if to := txs[i].To(); to != nil {
+					accounts = append(accounts, *to)
+				}
+				for _, addr := range accounts {
+					statedb.GetBalance(addr)
+					statedb.GetKycLevel(addr, 0)
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+}
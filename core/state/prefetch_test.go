@@ -0,0 +1,156 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"crypto/ecdsa"
+	"math/big"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// coldDatabase is a database charging latency for the first read of every key,
+// like a disk behind a page cache.
+type coldDatabase struct {
+	*wondb.MemDatabase
+	latency time.Duration
+
+	lock sync.Mutex
+	warm map[string]bool
+}
+
+func newColdDatabase(db *wondb.MemDatabase, latency time.Duration) *coldDatabase {
+	return &coldDatabase{MemDatabase: db, latency: latency, warm: make(map[string]bool)}
+}
+
+func (db *coldDatabase) Get(key []byte) ([]byte, error) {
+	db.lock.Lock()
+	warm := db.warm[string(key)]
+	db.warm[string(key)] = true
+	db.lock.Unlock()
+
+	if !warm {
+		time.Sleep(db.latency)
+	}
+	return db.MemDatabase.Get(key)
+}
+
+// newPrefetchTester creates a state with KYC verified accounts and providers,
+// flushed to disk, along with a block of transfers between the accounts.
+func newPrefetchTester(t testing.TB, accounts int, transfers int) (*wondb.MemDatabase, common.Hash, types.Transactions, types.Signer) {
+	diskdb, _ := wondb.NewMemDatabase()
+	db := NewDatabase(diskdb)
+	statedb, _ := New(common.Hash{}, db)
+
+	for i := 0; i < 8; i++ {
+		statedb.AddKycProvider(common.BigToAddress(big.NewInt(int64(0xff00 + i))))
+	}
+	keys := make([]*ecdsa.PrivateKey, accounts)
+	addrs := make([]common.Address, accounts)
+	for i := range keys {
+		keys[i], _ = crypto.GenerateKey()
+		addrs[i] = crypto.PubkeyToAddress(keys[i].PublicKey)
+
+		statedb.AddBalance(addrs[i], big.NewInt(1000000))
+		statedb.SetKycLevel(addrs[i], 1)
+		statedb.SetKycProvider(addrs[i], common.BigToAddress(big.NewInt(0xff00)))
+	}
+	root, err := statedb.Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	if err := db.TrieDB().Commit(root, false); err != nil {
+		t.Fatalf("failed to flush state: %v", err)
+	}
+	signer := types.HomesteadSigner{}
+	txs := make(types.Transactions, transfers)
+	for i := range txs {
+		tx := types.NewTransaction(uint64(i/accounts), addrs[(i*7+1)%accounts], big.NewInt(1), params.TxGas, big.NewInt(1), nil)
+		txs[i], _ = types.SignTx(tx, signer, keys[i%accounts])
+	}
+	return diskdb, root, txs, signer
+}
+
+// processTransfers applies the transfers of txs on top of root the way the
+// state transition would touch the state, returning the resulting root.
+func processTransfers(db Database, root common.Hash, txs types.Transactions, signer types.Signer) common.Hash {
+	statedb, _ := New(root, db)
+	for _, tx := range txs {
+		from, _ := types.Sender(signer, tx)
+		if statedb.TxKycValidate(from, *tx.To(), tx.Value(), nil, 0, params.TestChainConfig) {
+			statedb.SubBalance(from, tx.Value())
+			statedb.AddBalance(*tx.To(), tx.Value())
+		}
+	}
+	return statedb.IntermediateRoot(true)
+}
+
+// Tests that prefetching alongside processing a block, or giving up halfway,
+// doesn't change the outcome.
+func TestPrefetch(t *testing.T) {
+	diskdb, root, txs, signer := newPrefetchTester(t, 64, 256)
+	want := processTransfers(NewDatabase(diskdb), root, txs, signer)
+
+	for _, stop := range []bool{false, true} {
+		db := NewDatabase(diskdb)
+
+		interrupt := make(chan struct{})
+		if stop {
+			close(interrupt)
+		}
+		done := make(chan struct{})
+		go func() {
+			Prefetch(db, root, txs, signer, interrupt)
+			close(done)
+		}()
+		if have := processTransfers(db, root, txs, signer); have != want {
+			t.Errorf("interrupted %v: root mismatch: have %x, want %x", stop, have, want)
+		}
+		<-done
+	}
+}
+
+// Benchmarks processing a block of 500 transfers on a cold cache, with and
+// without prefetching the state it touches alongside.
+func BenchmarkPrefetch(b *testing.B) {
+	diskdb, root, txs, signer := newPrefetchTester(b, 1000, 500)
+	for _, tx := range txs {
+		types.Sender(signer, tx) // only measure the state access
+	}
+	b.Run("cold", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			processTransfers(NewDatabase(newColdDatabase(diskdb, 20*time.Microsecond)), root, txs, signer)
+		}
+	})
+	b.Run("prefetch", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			db := NewDatabase(newColdDatabase(diskdb, 20*time.Microsecond))
+
+			interrupt := make(chan struct{})
+			go Prefetch(db, root, txs, signer, interrupt)
+			processTransfers(db, root, txs, signer)
+			close(interrupt)
+		}
+	})
+}
@@ -0,0 +1,126 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/crypto"
+)
+
+// proofList collects the nodes of a Merkle proof in order.
+type proofList [][]byte
+
+func (n *proofList) Put(key []byte, value []byte) error {
+	*n = append(*n, value)
+	return nil
+}
+
+// GetProof returns the Merkle proof of the account of addr in the state trie,
+// proving its absence if it doesn't exist.
+func (self *StateDB) GetProof(addr common.Address) ([][]byte, error) {
+	var proof proofList
+	err := self.trie.Prove(crypto.Keccak256(addr.Bytes()), 0, &proof)
+	return [][]byte(proof), err
+}
+
+// GetStorageProof returns the Merkle proof of the storage slot key of addr in
+// its storage trie.
+func (self *StateDB) GetStorageProof(addr common.Address, key common.Hash) ([][]byte, error) {
+	var proof proofList
+	trie := self.StorageTrie(addr)
+	if trie == nil {
+		return proof, errors.New("storage trie for requested address does not exist")
+	}
+	err := trie.Prove(crypto.Keccak256(key.Bytes()), 0, &proof)
+	return [][]byte(proof), err
+}
+
+// KycProviderCountKey returns the slot of the KYC contract storing the number of
+// KYC providers.
+func KycProviderCountKey() common.Hash {
+	return kycProviderNumberKey
+}
+
+// KycProviderKey returns the slot of the KYC contract storing the KYC provider
+// at index of the provider list.
+func KycProviderKey(index int64) common.Hash {
+	return common.BigToHash(big.NewInt(kycProviderStartHash + index))
+}
+
+// KycExpiryKey returns the slot of the KYC contract storing the time the KYC
+// attestation of addr lapses at.
+func KycExpiryKey(addr common.Address) common.Hash {
+	return common.AddressToHashWithPrefix(&addr, kycExpiryKey)
+}
+
+// KycContractCreatorKey returns the slot of the KYC contract storing the creator
+// of the contract at addr, whose KYC info the contract inherits.
+func KycContractCreatorKey(addr common.Address) common.Hash {
+	return common.AddressToHashWithPrefix(&addr, kycContractCreatorKey)
+}
+
+// DposProducerCountKey returns the slot of the KYC contract storing the number
+// of registered block producers.
+func DposProducerCountKey() common.Hash {
+	return dposProducerCountKey
+}
+
+// DposProducerKey returns the slot of the KYC contract storing the producer at
+// index of the producer list.
+func DposProducerKey(index int64) common.Hash {
+	return common.BigToHash(big.NewInt(dposProducerAllStartKey + index))
+}
+
+// DposProducerInfoKeys returns the slots of the KYC contract storing the record
+// of the block producer pb.
+func DposProducerInfoKeys(pb common.Address) []common.Hash {
+	return []common.Hash{
+		common.AddressToHashWithPrefix(&pb, dposProducerURLKey),
+		common.AddressToHashWithPrefix(&pb, dposProducerURLKeyHigh),
+		common.AddressToHashWithPrefix(&pb, dposProducerTotalVotesKey),
+		common.AddressToHashWithPrefix(&pb, dposProducerActiveKey),
+		common.AddressToHashWithPrefix(&pb, dposProducerLocationKey),
+		common.AddressToHashWithPrefix(&pb, dposProducerFeeKey),
+		common.AddressToHashWithPrefix(&pb, dposProducerSigningKeyKey),
+		common.AddressToHashWithPrefix(&pb, dposProducerPrevSigningKeyKey),
+		common.AddressToHashWithPrefix(&pb, dposProducerSigningKeyBlockKey),
+	}
+}
+
+// DposVoterKeys returns the slots of the KYC contract storing the record of the
+// voter, including its delegation and every producer it may have voted for.
+func DposVoterKeys(voter common.Address) []common.Hash {
+	keys := []common.Hash{
+		common.AddressToHashWithPrefix(&voter, dposVoterStakingKey),
+		common.AddressToHashWithPrefix(&voter, dposVoterLastVoteWeightKey),
+		common.AddressToHashWithPrefix(&voter, dposVoterRefundAmountBeginKey),
+		common.AddressToHashWithPrefix(&voter, dposVoterRefundReqestTimeBeginKey),
+		common.AddressToHashWithPrefix(&voter, dposVoterAutoRefundKey),
+		common.AddressToHashWithPrefix(&voter, dposVoterRefundQueueKey),
+		common.AddressToHashWithPrefix(&voter, dposVoterCountKey),
+		common.AddressToHashWithPrefix(&voter, dposVoterProxyKey),
+		common.AddressToHashWithPrefix(&voter, dposProxyKey),
+		common.AddressToHashWithPrefix(&voter, dposProxyWeightKey),
+	}
+	for i := int64(0); i < dposMaxVotes; i++ {
+		keys = append(keys, common.AddressToHashWithPrefix(&voter, dposVoterBpAddressBeginKey+i))
+	}
+	return keys
+}
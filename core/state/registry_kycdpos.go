@@ -0,0 +1,296 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/common/hexutil"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/rlp"
+	"github.com/worldopennetwork/go-won/trie"
+)
+
+// KycDposRegistry is a portable snapshot of the KYC/dpos registry: the providers,
+// the attested addresses, the producers and the stakes, for carrying them over
+// into the genesis of a new network.
+//
+// The pending provider proposals and the retained KYC change history belong to
+// the chain they were made on and are left out.
+type KycDposRegistry struct {
+	Balance          *hexutil.Big                               `json:"balance"` // Stakes and fees escrowed by the pseudo-contract
+	Providers        []common.Address                           `json:"providers"`
+	ProviderInfo     map[common.Address]*common.KycProviderInfo `json:"providerInfo,omitempty"`
+	ZoneRestrictions []KycZonePairDump                          `json:"zoneRestrictions,omitempty"`
+	Attestations     map[common.Address]*KycAttestation         `json:"attestations,omitempty"`
+	Creators         map[common.Address]common.Address          `json:"creators,omitempty"`
+	Dpos             DposDump                                   `json:"dpos"`
+}
+
+// KycAttestation is the KYC record of an attested address.
+type KycAttestation struct {
+	Level    uint32         `json:"level"`
+	Zone     uint32         `json:"zone"`
+	Provider common.Address `json:"provider"`
+	Expiry   uint64         `json:"expiry,omitempty"`
+}
+
+// ExportKycDpos decodes the KYC/dpos registry out of the committed state. Like
+// DumpKycDpos, it needs the preimages of the storage keys, along with those of
+// the attested addresses.
+func (self *StateDB) ExportKycDpos() (*KycDposRegistry, error) {
+	dump := self.DumpKycDpos()
+	for _, slot := range dump.Unknown {
+		if slot.Reason == "missing preimage" || slot.Reason == "undecodable value" {
+			return nil, fmt.Errorf("kyc/dpos slot %x: %s", slot.Key, slot.Reason)
+		}
+	}
+	registry := &KycDposRegistry{
+		Balance:          (*hexutil.Big)(self.GetBalance(vm.KycContractAddress)),
+		Providers:        dump.Kyc.Providers,
+		ProviderInfo:     dump.Kyc.ProviderInfo,
+		ZoneRestrictions: dump.Kyc.ZoneRestrictions,
+		Attestations:     make(map[common.Address]*KycAttestation),
+		Creators:         dump.Kyc.Creators,
+		Dpos:             dump.Dpos,
+	}
+	// Gather the attested addresses out of the accounts
+	it := trie.NewIterator(self.trie.NodeIterator(nil))
+	for it.Next() {
+		var data Account
+		if err := rlp.DecodeBytes(it.Value, &data); err != nil {
+			return nil, err
+		}
+		if data.KycLevel == 0 && data.KycZone == 0 && data.KycProvider == (common.Address{}) {
+			continue
+		}
+		key := self.trie.GetKey(it.Key)
+		if key == nil {
+			return nil, fmt.Errorf("account %x: missing preimage", it.Key)
+		}
+		registry.Attestations[common.BytesToAddress(key)] = &KycAttestation{
+			Level:    data.KycLevel,
+			Zone:     data.KycZone,
+			Provider: data.KycProvider,
+		}
+	}
+	if it.Err != nil {
+		return nil, it.Err
+	}
+	for addr, expiry := range dump.Kyc.Expiry {
+		if registry.Attestations[addr] == nil {
+			registry.Attestations[addr] = new(KycAttestation)
+		}
+		registry.Attestations[addr].Expiry = expiry
+	}
+	return registry, nil
+}
+
+// Validate checks the invariants of the registry the storage layout relies on:
+// providers and producers are listed once, every producer listed is registered
+// and the other way around, current and previous signing keys are held by a
+// single producer and by no producer themselves, and the votes, proxies and
+// refunds only refer to known producers and voters.
+func (r *KycDposRegistry) Validate() error {
+	seen := make(map[common.Address]bool)
+	for _, provider := range r.Providers {
+		if provider == (common.Address{}) {
+			return errors.New("kyc provider with zero address")
+		}
+		if seen[provider] {
+			return fmt.Errorf("kyc provider %x listed twice", provider)
+		}
+		seen[provider] = true
+	}
+	for addr, info := range r.ProviderInfo {
+		blob, err := rlp.EncodeToBytes(info)
+		if err != nil {
+			return fmt.Errorf("kyc provider %x info: %v", addr, err)
+		}
+		if len(blob) > vm.KycProviderInfoMaxSize {
+			return fmt.Errorf("kyc provider %x info too large: %d bytes, limit %d", addr, len(blob), vm.KycProviderInfoMaxSize)
+		}
+	}
+	seen = make(map[common.Address]bool)
+	for _, producer := range r.Dpos.ProducerList {
+		if seen[producer] {
+			return fmt.Errorf("dpos producer %x listed twice", producer)
+		}
+		seen[producer] = true
+
+		record := r.Dpos.Producers[producer]
+		if record == nil || record.URL == "" {
+			return fmt.Errorf("dpos producer %x listed but not registered", producer)
+		}
+		if len(record.URL) > 2*common.HashLength {
+			return fmt.Errorf("dpos producer %x url too long: %d bytes, limit %d", producer, len(record.URL), 2*common.HashLength)
+		}
+		if record.Location != nil && (*big.Int)(record.Location).Cmp(big.NewInt(math.MaxUint16)) > 0 {
+			return fmt.Errorf("dpos producer %x location %v out of range", producer, record.Location)
+		}
+	}
+	keys := make(map[common.Address]common.Address)
+	for producer, record := range r.Dpos.Producers {
+		if !seen[producer] {
+			return fmt.Errorf("dpos producer %x registered but not listed", producer)
+		}
+		for _, key := range []*common.Address{record.SigningKey, record.PrevSigningKey} {
+			if key == nil || *key == (common.Address{}) {
+				continue
+			}
+			if owner, ok := keys[*key]; (ok && owner != producer) || r.Dpos.Producers[*key] != nil {
+				return fmt.Errorf("dpos producer %x signing key %x in use by another producer", producer, *key)
+			}
+			keys[*key] = producer
+		}
+	}
+	for addr, voter := range r.Dpos.Voters {
+		if int64(len(voter.Producers)) > dposMaxVotes {
+			return fmt.Errorf("dpos voter %x votes for %d producers, limit %d", addr, len(voter.Producers), dposMaxVotes)
+		}
+		for _, producer := range voter.Producers {
+			if !seen[producer] {
+				return fmt.Errorf("dpos voter %x votes for unregistered producer %x", addr, producer)
+			}
+		}
+		if voter.Proxy != nil && *voter.Proxy != (common.Address{}) {
+			if proxy := r.Dpos.Voters[*voter.Proxy]; proxy == nil || !proxy.IsProxy {
+				return fmt.Errorf("dpos voter %x delegates to %x, not a proxy", addr, *voter.Proxy)
+			}
+		}
+	}
+	queued := make(map[common.Address]bool)
+	for _, addr := range r.Dpos.RefundQueue {
+		if r.Dpos.Voters[addr] == nil {
+			return fmt.Errorf("dpos refund queued for unknown voter %x", addr)
+		}
+		if queued[addr] {
+			return fmt.Errorf("dpos refund of %x queued twice", addr)
+		}
+		queued[addr] = true
+	}
+	return nil
+}
+
+// ImportKycDpos replays the registry into a state with no KYC providers and no
+// dpos producers yet, as when constructing a genesis. The registry is validated
+// first, and the resulting storage checked with VerifyKycDpos.
+func (self *StateDB) ImportKycDpos(r *KycDposRegistry) error {
+	if err := r.Validate(); err != nil {
+		return err
+	}
+	if self.GetKycProviderCount() != 0 || self.GetDposProducerCount().Sign() != 0 {
+		return errors.New("kyc/dpos registry already populated")
+	}
+	if r.Balance != nil {
+		self.AddBalance(vm.KycContractAddress, (*big.Int)(r.Balance))
+	}
+	// Replay the KYC providers, policy and attestations
+	for _, provider := range r.Providers {
+		self.AddKycProvider(provider)
+	}
+	for addr, info := range r.ProviderInfo {
+		blob, _ := rlp.EncodeToBytes(info) // checked by Validate
+		self.SetKycProviderInfo(addr, blob)
+	}
+	for _, pair := range r.ZoneRestrictions {
+		self.SetKycZoneRestricted(pair.From, pair.To, true)
+	}
+	for addr, attestation := range r.Attestations {
+		self.SetKycLevel(addr, attestation.Level)
+		self.SetKycZone(addr, attestation.Zone)
+		self.SetKycProvider(addr, attestation.Provider)
+		if attestation.Expiry != 0 {
+			self.SetKycExpiry(addr, attestation.Expiry)
+		}
+	}
+	for addr, creator := range r.Creators {
+		self.SetContractCreator(addr, creator)
+	}
+	// Replay the dpos globals, producers and voters
+	bigOf := func(n *hexutil.Big) *big.Int {
+		if n == nil {
+			return new(big.Int)
+		}
+		return (*big.Int)(n)
+	}
+	self.SetDposTotalActivatedStake(bigOf(r.Dpos.TotalActivatedStake))
+	self.SetDposThreshActivatedStakeTime(bigOf(r.Dpos.ThreshActivatedStakeTime))
+	self.SetDposTotalProducerWeight(bigOf(r.Dpos.TotalProducerWeight))
+	self.SetDposLastProducerScheduleUpdateTime(bigOf(r.Dpos.LastScheduleUpdateTime))
+	if r.Dpos.TopProducerElectedDone {
+		self.SetDposTopProducerElectedDone(common.Big1)
+	}
+	for _, addr := range r.Dpos.ProducerList {
+		addr, record := addr, r.Dpos.Producers[addr]
+
+		self.RegisterProducer(&addr, record.URL)
+		self.UpdateProducerTotalVotes(&addr, bigOf(record.TotalVotes))
+		self.UpdateProducerActive(&addr, record.Active)
+		self.UpdateProducerLocation(&addr, common.ProducerLocation(bigOf(record.Location).Uint64()))
+		if record.RegistrationFee != nil {
+			self.SetProducerRegistrationFee(&addr, bigOf(record.RegistrationFee))
+		}
+		if record.SigningKey != nil || record.PrevSigningKey != nil || record.SigningKeyBlock != nil {
+			var key, previous common.Address
+			if record.SigningKey != nil {
+				key = *record.SigningKey
+			}
+			if record.PrevSigningKey != nil {
+				previous = *record.PrevSigningKey
+			}
+			var number uint64
+			if record.SigningKeyBlock != nil {
+				number = uint64(*record.SigningKeyBlock)
+			}
+			self.setProducerSigningKeys(&addr, key, previous, number)
+		}
+	}
+	for addr, voter := range r.Dpos.Voters {
+		addr := addr
+
+		self.SetVoterStaking(&addr, bigOf(voter.Staking))
+		self.SetDposVoterLastVoteWeight(&addr, bigOf(voter.LastVoteWeight))
+		if len(voter.Producers) > 0 {
+			self.SetVoterProducers(&addr, voter.Producers)
+		}
+		if voter.RefundAmount != nil && voter.RefundAmount.ToInt().Sign() > 0 {
+			self.SetRefundRequestInfo(&addr, bigOf(voter.RefundAmount), bigOf(voter.RefundRequestTime))
+		}
+		if voter.AutoRefund {
+			self.SetDposAutoRefund(&addr, true)
+		}
+		if voter.IsProxy {
+			self.SetDposProxy(&addr, true)
+		}
+		if voter.DelegatedWeight != nil && voter.DelegatedWeight.ToInt().Sign() > 0 {
+			self.SetDposProxyWeight(&addr, bigOf(voter.DelegatedWeight))
+		}
+		if voter.Proxy != nil && *voter.Proxy != (common.Address{}) {
+			self.SetVoterProxy(&addr, *voter.Proxy)
+		}
+	}
+	for _, addr := range r.Dpos.RefundQueue {
+		addr := addr
+		self.PushDposRefund(&addr)
+	}
+	return self.VerifyKycDpos()
+}
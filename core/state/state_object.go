@@ -79,9 +79,15 @@ type stateObject struct {
 	trie Trie // storage trie, which becomes non-nil on first access
 	code Code // contract bytecode, which gets set when code is loaded
 
-	cachedStorage Storage // Storage entry cache to avoid duplicate reads
+	originStorage Storage // Storage cache of original entries to dedup rewrites
 	dirtyStorage  Storage // Storage entries that need to be flushed to disk
 
+	// Storage root as last committed, holding the entries not in originStorage,
+	// and the entries changed on top of it, for the flat storage of the KYC
+	// contract to follow.
+	originRoot  common.Hash
+	flatChanges Storage
+
 	// Cache flags.
 	// When an object is marked suicided it will be delete from the trie
 	// during the "update" phase of the state transition.
@@ -124,8 +130,9 @@ func newObject(db *StateDB, address common.Address, data Account) *stateObject {
 		address:       address,
 		addrHash:      crypto.Keccak256Hash(address[:]),
 		data:          data,
-		cachedStorage: make(Storage),
+		originStorage: make(Storage),
 		dirtyStorage:  make(Storage),
+		originRoot:    data.Root,
 	}
 }
 
@@ -134,7 +141,9 @@ func (c *stateObject) EncodeRLP(w io.Writer) error {
 	return rlp.Encode(w, c.data)
 }
 
-// setError remembers the first non-nil error it is called with.
+// setError remembers the first non-nil error it is called with. Storage tries
+// are committed concurrently, so the error is only passed on to the state by
+// StateDB.collectErrors on the goroutine owning it.
 func (self *stateObject) setError(err error) {
 	if self.dbErr == nil {
 		self.dbErr = err
@@ -168,12 +177,44 @@ func (c *stateObject) getTrie(db Database) Trie {
 	return c.trie
 }
 
-// GetState returns a value in account storage.
+// GetState retrieves a value from the account storage trie.
 func (self *stateObject) GetState(db Database, key common.Hash) common.Hash {
-	value, exists := self.cachedStorage[key]
-	if exists {
+	if self.address == vm.KycContractAddress {
+		self.db.touchKycSlot(key, false)
+	}
+	return self.getState(db, key)
+}
+
+func (self *stateObject) getState(db Database, key common.Hash) common.Hash {
+	// If we have a dirty value for this state entry, return it
+	value, dirty := self.dirtyStorage[key]
+	if dirty {
 		return value
 	}
+	// Otherwise return the entry's original value
+	return self.GetCommittedState(db, key)
+}
+
+// GetCommittedState retrieves a value from the committed account storage trie,
+// ignoring any modifications made since the last Finalise.
+func (self *stateObject) GetCommittedState(db Database, key common.Hash) common.Hash {
+	value, cached := self.originStorage[key]
+	if cached {
+		return value
+	}
+	// Serve the storage of the KYC contract from its flat copy if it matches,
+	// every now and then verifying it against the trie
+	var (
+		flat   common.Hash
+		verify bool
+		served bool
+	)
+	if self.address == vm.KycContractAddress && self.db.kycFlat != nil {
+		if flat, verify, served = self.db.kycFlat.get(self.originRoot, key); served && !verify {
+			self.originStorage[key] = flat
+			return flat
+		}
+	}
 	// Load from DB in case it is missing.
 	enc, err := self.getTrie(db).TryGet(key[:])
 	if err != nil {
@@ -187,9 +228,11 @@ func (self *stateObject) GetState(db Database, key common.Hash) common.Hash {
 		}
 		value.SetBytes(content)
 	}
-	if (value != common.Hash{}) {
-		self.cachedStorage[key] = value
+	if served && flat != value {
+		log.Error("KYC flat storage mismatch, dropping it", "slot", key, "flat", flat, "trie", value)
+		self.db.kycFlat.invalidate()
 	}
+	self.originStorage[key] = value
 	return value
 }
 
@@ -198,15 +241,16 @@ func (self *stateObject) SetState(db Database, key, value common.Hash) {
 	self.db.journal.append(storageChange{
 		account:  &self.address,
 		key:      key,
-		prevalue: self.GetState(db, key),
+		prevalue: self.getState(db, key),
 	})
+	if self.address == vm.KycContractAddress {
+		self.db.touchKycSlot(key, true)
+	}
 	self.setState(key, value)
 }
 
 func (self *stateObject) setState(key, value common.Hash) {
-	self.cachedStorage[key] = value
 	self.dirtyStorage[key] = value
-
 }
 
 // updateTrie writes cached storage modifications into the object's storage trie.
@@ -214,6 +258,19 @@ func (self *stateObject) updateTrie(db Database) Trie {
 	tr := self.getTrie(db)
 	for key, value := range self.dirtyStorage {
 		delete(self.dirtyStorage, key)
+
+		// Skip noop changes, persist actual changes
+		if value == self.originStorage[key] {
+			continue
+		}
+		self.originStorage[key] = value
+
+		if self.address == vm.KycContractAddress && self.db.kycFlat != nil {
+			if self.flatChanges == nil {
+				self.flatChanges = make(Storage)
+			}
+			self.flatChanges[key] = value
+		}
 		if (value == common.Hash{}) {
 			self.setError(tr.TryDelete(key[:]))
 			continue
@@ -295,7 +352,11 @@ func (self *stateObject) deepCopy(db *StateDB) *stateObject {
 	}
 	stateObject.code = self.code
 	stateObject.dirtyStorage = self.dirtyStorage.Copy()
-	stateObject.cachedStorage = self.dirtyStorage.Copy()
+	stateObject.originStorage = self.originStorage.Copy()
+	stateObject.originRoot = self.originRoot
+	if self.flatChanges != nil {
+		stateObject.flatChanges = self.flatChanges.Copy()
+	}
 	stateObject.suicided = self.suicided
 	stateObject.dirtyCode = self.dirtyCode
 	stateObject.deleted = self.deleted
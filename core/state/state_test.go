@@ -18,11 +18,15 @@ package state
 
 import (
 	"bytes"
+	"encoding/json"
 	"math/big"
 	"testing"
 
 	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/common/hexutil"
+	"github.com/worldopennetwork/go-won/core/vm"
 	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/rlp"
 	"github.com/worldopennetwork/go-won/wondb"
 	checker "gopkg.in/check.v1"
 )
@@ -209,16 +213,16 @@ func compareStateObjects(so0, so1 *stateObject, t *testing.T) {
 		t.Fatalf("Code mismatch: have %v, want %v", so0.code, so1.code)
 	}
 
-	if len(so1.cachedStorage) != len(so0.cachedStorage) {
-		t.Errorf("Storage size mismatch: have %d, want %d", len(so1.cachedStorage), len(so0.cachedStorage))
+	if len(so1.originStorage) != len(so0.originStorage) {
+		t.Errorf("Storage size mismatch: have %d, want %d", len(so1.originStorage), len(so0.originStorage))
 	}
-	for k, v := range so1.cachedStorage {
-		if so0.cachedStorage[k] != v {
-			t.Errorf("Storage key %x mismatch: have %v, want %v", k, so0.cachedStorage[k], v)
+	for k, v := range so1.originStorage {
+		if so0.originStorage[k] != v {
+			t.Errorf("Storage key %x mismatch: have %v, want %v", k, so0.originStorage[k], v)
 		}
 	}
-	for k, v := range so0.cachedStorage {
-		if so1.cachedStorage[k] != v {
+	for k, v := range so0.originStorage {
+		if so1.originStorage[k] != v {
 			t.Errorf("Storage key %x mismatch: have %v, want none.", k, v)
 		}
 	}
@@ -230,3 +234,348 @@ func compareStateObjects(so0, so1 *stateObject, t *testing.T) {
 		t.Fatalf("Deleted mismatch: have %v, want %v", so0.deleted, so1.deleted)
 	}
 }
+
+// Tests that the KYC/dpos pseudo-contract storage round-trips through the
+// structured dump, and that slots outside the known layout are reported.
+func TestDumpKycDpos(t *testing.T) {
+	memdb, _ := wondb.NewMemDatabase()
+	db := NewDatabase(memdb)
+	state, _ := New(common.Hash{}, db)
+
+	var (
+		provider1 = toAddr([]byte{0x01})
+		provider2 = toAddr([]byte{0x02})
+		candidate = toAddr([]byte{0x03})
+		removal   = toAddr([]byte{0x04})
+		producer1 = toAddr([]byte{0x11})
+		producer2 = toAddr([]byte{0x12})
+		voter     = toAddr([]byte{0x21})
+		delegator = toAddr([]byte{0x22})
+		sealer    = toAddr([]byte{0x31})
+		retired   = toAddr([]byte{0x32})
+		garbage   = common.HexToHash("0xdeadbeef00000000000000000000000000000000000000000000000000000000")
+		longURL   = "https://a-rather-long-producer-url.example.org"
+	)
+	state.AddKycProvider(provider1)
+	state.AddKycProvider(provider2)
+	state.SetKycProviderProposol(candidate, big.NewInt(1000), big.NewInt(1))
+	state.SetVoteForKycProviderProposol(0, provider2, 1)
+	state.SetKycProviderProposol(removal, big.NewInt(1100), big.NewInt(2))
+	state.SetVoteForKycProviderProposol(1, provider1, 0)
+
+	state.SetDposTotalActivatedStake(big.NewInt(300))
+	state.SetDposThreshActivatedStakeTime(big.NewInt(2000))
+	state.SetDposTotalProducerWeight(big.NewInt(400))
+	state.SetDposLastProducerScheduleUpdateTime(big.NewInt(3000))
+	state.SetDposTopProducerElectedDone(common.Big1)
+
+	state.RegisterProducer(&producer1, longURL)
+	state.UpdateProducerTotalVotes(&producer1, big.NewInt(500))
+	state.UpdateProducerLocation(&producer1, 86)
+	state.SetProducerRegistrationFee(&producer1, big.NewInt(1100))
+	state.SetProducerSigningKey(&producer1, retired, 5, 100)
+	state.SetProducerSigningKey(&producer1, sealer, 150, 100)
+	state.RegisterProducer(&producer2, "p2")
+	state.UpdateProducerActive(&producer2, false)
+
+	state.SetVoterStaking(&voter, big.NewInt(600))
+	state.SetDposVoterLastVoteWeight(&voter, big.NewInt(700))
+	state.SetVoterProducers(&voter, []common.Address{producer1, producer2})
+	state.SetVoterProducers(&voter, []common.Address{producer1})
+	state.SetRefundRequestInfo(&voter, big.NewInt(800), big.NewInt(4000))
+	state.SetDposAutoRefund(&voter, true)
+	state.PushDposRefund(&voter)
+	state.PushDposRefund(&delegator)
+	state.PushDposRefund(&voter)
+	state.CancelDposRefund(&delegator)
+
+	state.SetDposProxy(&voter, true)
+	state.SetDposProxyWeight(&voter, big.NewInt(1000))
+	state.SetVoterStaking(&delegator, big.NewInt(900))
+	state.SetDposVoterLastVoteWeight(&delegator, big.NewInt(1000))
+	state.SetVoterProxy(&delegator, voter)
+
+	state.SetState(vm.KycContractAddress, garbage, common.BigToHash(common.Big3))
+
+	root, _ := state.Commit(false)
+	state, _ = New(root, db)
+
+	big := func(n int64) *hexutil.Big { return (*hexutil.Big)(new(big.Int).SetInt64(n)) }
+	rotation := hexutil.Uint64(150)
+	want := KycDposDump{
+		Root: common.Bytes2Hex(root[:]),
+		Kyc: KycDump{
+			Providers: []common.Address{provider1, provider2},
+			Proposals: []*KycProposalDump{
+				{
+					ID:        0,
+					Address:   candidate,
+					StartTime: big(1000),
+					VoteTotal: 2,
+					Type:      big(1),
+					Votes:     []KycVoteDump{{Voter: provider2, Nay: true}},
+				},
+				{
+					ID:        1,
+					Address:   removal,
+					StartTime: big(1100),
+					VoteTotal: 2,
+					Type:      big(2),
+					Votes:     []KycVoteDump{{Voter: provider1, Nay: false}},
+				},
+			},
+		},
+		Dpos: DposDump{
+			TotalActivatedStake:      big(300),
+			ThreshActivatedStakeTime: big(2000),
+			TotalProducerWeight:      big(400),
+			LastScheduleUpdateTime:   big(3000),
+			TopProducerElectedDone:   true,
+			ProducerList:             []common.Address{producer1, producer2},
+			RefundQueue:              []common.Address{voter},
+			Producers: map[common.Address]*ProducerDump{
+				producer1: {URL: longURL, TotalVotes: big(500), Active: true, Location: big(86), RegistrationFee: big(1100), SigningKey: &sealer, PrevSigningKey: &retired, SigningKeyBlock: &rotation},
+				producer2: {URL: "p2", TotalVotes: big(0), Active: false, Location: big(0)},
+			},
+			Voters: map[common.Address]*VoterDump{
+				voter: {
+					Staking:           big(600),
+					LastVoteWeight:    big(700),
+					Producers:         []common.Address{producer1},
+					RefundAmount:      big(800),
+					RefundRequestTime: big(4000),
+					AutoRefund:        true,
+					IsProxy:           true,
+					DelegatedWeight:   big(1000),
+				},
+				delegator: {
+					Staking:           big(900),
+					LastVoteWeight:    big(1000),
+					Producers:         []common.Address{},
+					RefundAmount:      big(0),
+					RefundRequestTime: big(0),
+					Proxy:             &voter,
+				},
+			},
+		},
+		Unknown: []DumpKycDposSlot{
+			{Key: common.AddressToHashWithPrefix(&voter, 0x92), Value: producer2.Hash(), Reason: "stale voter producer"},
+			{Key: garbage, Value: common.BigToHash(common.Big3), Reason: "unknown slot"},
+		},
+	}
+	have, _ := json.MarshalIndent(state.DumpKycDpos(), "", "  ")
+	if want, _ := json.MarshalIndent(want, "", "  "); !bytes.Equal(have, want) {
+		t.Errorf("dump mismatch:\nhave %s\nwant %s", have, want)
+	}
+}
+
+// Tests that the KYC/dpos registry round-trips through its JSON snapshot into
+// a fresh state, yielding the same pseudo-contract storage.
+func TestKycDposRegistryRoundTrip(t *testing.T) {
+	memdb, _ := wondb.NewMemDatabase()
+	db := NewDatabase(memdb)
+	state, _ := New(common.Hash{}, db)
+
+	var (
+		provider1 = toAddr([]byte{0x01})
+		provider2 = toAddr([]byte{0x02})
+		user1     = toAddr([]byte{0x05})
+		user2     = toAddr([]byte{0x06})
+		contract  = toAddr([]byte{0x07})
+		producer1 = toAddr([]byte{0x11})
+		producer2 = toAddr([]byte{0x12})
+		voter     = toAddr([]byte{0x21})
+		delegator = toAddr([]byte{0x22})
+		sealer    = toAddr([]byte{0x31})
+		retired   = toAddr([]byte{0x32})
+	)
+	state.AddBalance(vm.KycContractAddress, big.NewInt(5000))
+	state.AddKycProvider(provider1)
+	state.AddKycProvider(provider2)
+	info, _ := rlp.EncodeToBytes(&common.KycProviderInfo{Name: "provider", Jurisdiction: "SG", URL: "https://provider.example.org"})
+	state.SetKycProviderInfo(provider1, info)
+	state.SetKycZoneRestricted(86, 1, true)
+
+	state.SetKycLevel(user1, 2)
+	state.SetKycZone(user1, 86)
+	state.SetKycProvider(user1, provider1)
+	state.SetKycExpiry(user1, 10000)
+	state.SetKycLevel(user2, 1)
+	state.SetKycProvider(user2, provider2)
+	state.SetContractCreator(contract, user1)
+
+	state.SetDposTotalActivatedStake(big.NewInt(1500))
+	state.SetDposTotalProducerWeight(big.NewInt(400))
+	state.SetDposTopProducerElectedDone(common.Big1)
+
+	state.RegisterProducer(&producer1, "https://a-rather-long-producer-url.example.org")
+	state.UpdateProducerTotalVotes(&producer1, big.NewInt(400))
+	state.UpdateProducerLocation(&producer1, 86)
+	state.SetProducerRegistrationFee(&producer1, big.NewInt(100))
+	state.SetProducerSigningKey(&producer1, retired, 5, 100)
+	state.SetProducerSigningKey(&producer1, sealer, 150, 100)
+	state.RegisterProducer(&producer2, "p2")
+	state.UpdateProducerActive(&producer2, false)
+
+	state.SetVoterStaking(&voter, big.NewInt(600))
+	state.SetDposVoterLastVoteWeight(&voter, big.NewInt(400))
+	state.SetVoterProducers(&voter, []common.Address{producer1})
+	state.SetRefundRequestInfo(&voter, big.NewInt(800), big.NewInt(4000))
+	state.PushDposRefund(&voter)
+	state.SetDposProxy(&voter, true)
+	state.SetDposProxyWeight(&voter, big.NewInt(900))
+	state.SetVoterStaking(&delegator, big.NewInt(900))
+	state.SetVoterProxy(&delegator, voter)
+
+	root, _ := state.Commit(false)
+	state, _ = New(root, db)
+
+	registry, err := state.ExportKycDpos()
+	if err != nil {
+		t.Fatalf("failed to export registry: %v", err)
+	}
+	if have := registry.Attestations[user1]; have == nil || *have != (KycAttestation{Level: 2, Zone: 86, Provider: provider1, Expiry: 10000}) {
+		t.Errorf("attestation mismatch: have %+v", have)
+	}
+	blob, _ := json.Marshal(registry)
+
+	// Replay the snapshot into a fresh state and compare the outcome
+	imported := new(KycDposRegistry)
+	if err := json.Unmarshal(blob, imported); err != nil {
+		t.Fatalf("failed to parse registry: %v", err)
+	}
+	memdb, _ = wondb.NewMemDatabase()
+	db = NewDatabase(memdb)
+	replayed, _ := New(common.Hash{}, db)
+	if err := replayed.ImportKycDpos(imported); err != nil {
+		t.Fatalf("failed to import registry: %v", err)
+	}
+	root, _ = replayed.Commit(false)
+	replayed, _ = New(root, db)
+
+	haveDump, wantDump := replayed.DumpKycDpos(), state.DumpKycDpos()
+	haveDump.Root, wantDump.Root = "", ""
+
+	have, _ := json.MarshalIndent(haveDump, "", "  ")
+	want, _ := json.MarshalIndent(wantDump, "", "  ")
+	if !bytes.Equal(have, want) {
+		t.Errorf("storage mismatch:\nhave %s\nwant %s", have, want)
+	}
+	reexported, err := replayed.ExportKycDpos()
+	if err != nil {
+		t.Fatalf("failed to re-export registry: %v", err)
+	}
+	if have, _ := json.Marshal(reexported); !bytes.Equal(have, blob) {
+		t.Errorf("registry mismatch:\nhave %s\nwant %s", have, blob)
+	}
+	if have := replayed.GetKycLevel(contract, 0); have != 2 {
+		t.Errorf("contract KYC level mismatch: have %d, want 2", have)
+	}
+}
+
+// Tests that rotating the signing key of a producer keeps the key in effect as of
+// the last checkpoint as the previous key, reserved for the producer until the
+// next rotation taking effect.
+func TestProducerSigningKeyRotation(t *testing.T) {
+	var (
+		producer = toAddr([]byte{0x11})
+		k1       = toAddr([]byte{0x31})
+		k2       = toAddr([]byte{0x32})
+		k3       = toAddr([]byte{0x33})
+	)
+	memdb, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(memdb))
+	state.RegisterProducer(&producer, "p")
+
+	tests := []struct {
+		key      common.Address
+		number   uint64
+		previous common.Address
+		released []common.Address
+	}{
+		{key: k1, number: 110},
+		{key: k2, number: 150, released: []common.Address{k1}}, // never took effect
+		{key: k3, number: 200, previous: k2},
+		{key: common.Address{}, number: 320, previous: k3, released: []common.Address{k2}},
+		{key: k1, number: 399, previous: k3},
+	}
+	for i, tt := range tests {
+		state.SetProducerSigningKey(&producer, tt.key, tt.number, 100)
+
+		if have := state.GetProducerSigningKey(&producer); have != tt.key {
+			t.Errorf("test %d: signing key mismatch: have %x, want %x", i, have, tt.key)
+		}
+		if have := state.GetProducerPrevSigningKey(&producer); have != tt.previous {
+			t.Errorf("test %d: previous signing key mismatch: have %x, want %x", i, have, tt.previous)
+		}
+		if have := state.GetProducerSigningKeyBlock(&producer); have != tt.number {
+			t.Errorf("test %d: signing key block mismatch: have %d, want %d", i, have, tt.number)
+		}
+		for _, key := range []common.Address{tt.key, tt.previous} {
+			if have := state.GetSigningKeyProducer(key); key != (common.Address{}) && have != producer {
+				t.Errorf("test %d: key %x not reserved: have producer %x", i, key, have)
+			}
+		}
+		for _, key := range tt.released {
+			if have := state.GetSigningKeyProducer(key); have != (common.Address{}) {
+				t.Errorf("test %d: key %x not released: have producer %x", i, key, have)
+			}
+		}
+	}
+}
+
+// Tests that registries breaking the invariants of the storage layout, or
+// imported on top of a populated one, are rejected.
+func TestKycDposRegistryValidate(t *testing.T) {
+	var (
+		provider = toAddr([]byte{0x01})
+		producer = toAddr([]byte{0x11})
+		voter    = toAddr([]byte{0x21})
+	)
+	valid := func() *KycDposRegistry {
+		return &KycDposRegistry{
+			Providers: []common.Address{provider},
+			Dpos: DposDump{
+				ProducerList: []common.Address{producer},
+				Producers:    map[common.Address]*ProducerDump{producer: {URL: "p"}},
+				Voters:       map[common.Address]*VoterDump{voter: {Producers: []common.Address{producer}}},
+			},
+		}
+	}
+	tests := []struct {
+		name   string
+		mutate func(r *KycDposRegistry)
+	}{
+		{"duplicate provider", func(r *KycDposRegistry) { r.Providers = append(r.Providers, provider) }},
+		{"zero provider", func(r *KycDposRegistry) { r.Providers = append(r.Providers, common.Address{}) }},
+		{"duplicate producer", func(r *KycDposRegistry) { r.Dpos.ProducerList = append(r.Dpos.ProducerList, producer) }},
+		{"unregistered producer", func(r *KycDposRegistry) { r.Dpos.ProducerList = append(r.Dpos.ProducerList, voter) }},
+		{"unlisted producer", func(r *KycDposRegistry) { r.Dpos.Producers[voter] = &ProducerDump{URL: "v"} }},
+		{"producer as signing key", func(r *KycDposRegistry) { r.Dpos.Producers[producer].SigningKey = &producer }},
+		{"producer as previous signing key", func(r *KycDposRegistry) { r.Dpos.Producers[producer].PrevSigningKey = &producer }},
+		{"vote for unregistered", func(r *KycDposRegistry) { r.Dpos.Voters[voter].Producers = []common.Address{provider} }},
+		{"proxy not registered", func(r *KycDposRegistry) { r.Dpos.Voters[voter].Proxy = &producer }},
+		{"refund of unknown voter", func(r *KycDposRegistry) { r.Dpos.RefundQueue = []common.Address{producer} }},
+	}
+	for _, tt := range tests {
+		r := valid()
+		tt.mutate(r)
+		if err := r.Validate(); err == nil {
+			t.Errorf("%s: registry accepted", tt.name)
+		}
+		memdb, _ := wondb.NewMemDatabase()
+		state, _ := New(common.Hash{}, NewDatabase(memdb))
+		if err := state.ImportKycDpos(r); err == nil {
+			t.Errorf("%s: registry imported", tt.name)
+		}
+	}
+	// A valid registry may only be imported once
+	memdb, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(memdb))
+	if err := state.ImportKycDpos(valid()); err != nil {
+		t.Fatalf("failed to import valid registry: %v", err)
+	}
+	if err := state.ImportKycDpos(valid()); err == nil {
+		t.Errorf("registry imported on top of a populated one")
+	}
+}
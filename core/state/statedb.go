@@ -19,8 +19,10 @@ package state
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"math/big"
+	"runtime"
 	"sort"
 	"sync"
 
@@ -29,6 +31,7 @@ import (
 	"github.com/worldopennetwork/go-won/core/vm"
 	"github.com/worldopennetwork/go-won/crypto"
 	"github.com/worldopennetwork/go-won/log"
+	"github.com/worldopennetwork/go-won/params"
 	"github.com/worldopennetwork/go-won/rlp"
 	"github.com/worldopennetwork/go-won/trie"
 )
@@ -45,18 +48,25 @@ var (
 	// emptyCode is the known hash of the empty EVM bytecode.
 	emptyCode = crypto.Keccak256Hash(nil)
 
-	kycProviderStartHash   = int64(10000000000)
-	kycVoterStartHash      = int64(20000000000)
-	kycVoteResultStartHash = int64(21000000000)
-	maxKycProviderCount    = int64(10000000000)
+	kycProviderStartHash     = int64(10000000000)
+	kycVoterStartHash        = int64(20000000000)
+	kycVoteResultStartHash   = int64(21000000000)
+	kycProposalInfoStartHash = int64(22000000000)
+	kycProposalStartHash     = int64(23000000000) // headers of the queued proposals past the first
+	kycProposalSlotSize      = int64(100000000)   // voters, votes and metadata of each queued proposal
+	maxKycProviderCount      = int64(10000000000)
 
 	dposProducerAllStartKey = int64(30000000000)
+	dposRefundQueueStartKey = int64(31000000000) // voters awaiting the automatic payout of their refund
 
 	kycProviderNumberKey       = common.BigToHash(common.Big1)
 	kycProposalAddressKey      = common.BigToHash(common.Big2)
 	kycProposalStartTimeKey    = common.BigToHash(common.Big3)
 	kycProposalVoteTotalKey    = common.BigToHash(big.NewInt(4))
 	kycProposalAlreadyVotedKey = common.BigToHash(big.NewInt(5))
+	kycZoneRestrictionCountKey = common.BigToHash(big.NewInt(6))
+	kycProposalHeadKey         = common.BigToHash(big.NewInt(7))
+	kycProposalTailKey         = common.BigToHash(big.NewInt(8))
 
 	//to active and meet the minimium vote for starting
 	dposTotalActivatedStakeKey            = common.BigToHash(big.NewInt(100))
@@ -65,21 +75,59 @@ var (
 	dposTotalProducerVoteWeightKey        = common.BigToHash(big.NewInt(103))
 	dposLastProducerScheduleUpdateTimeKey = common.BigToHash(big.NewInt(104))
 	dposTopProducerElectedDoneKey         = common.BigToHash(big.NewInt(105))
+	dposRefundQueueHeadKey                = common.BigToHash(big.NewInt(106))
+	dposRefundQueueTailKey                = common.BigToHash(big.NewInt(107))
 
 	dposProducerURLKey        = int64(0x1)
 	dposProducerURLKeyHigh    = int64(0x5)
 	dposProducerTotalVotesKey = int64(0x2)
 	dposProducerActiveKey     = int64(0x3)
 	dposProducerLocationKey   = int64(0x4)
+	dposProducerFeeKey        = int64(0x6) // registration fee escrowed until deregistration
+	dposProducerSigningKeyKey = int64(0x7) // key sealing the blocks of the producer, if not its own
+	dposSigningKeyProducerKey = int64(0x8) // producer a signing key seals for, keyed by the key
+
+	dposProducerPrevSigningKeyKey  = int64(0x9) // key replaced by the signing key, if not the producer's own
+	dposProducerSigningKeyBlockKey = int64(0xa) // block the signing key was last changed in
 
 	dposVoterStakingKey        = int64(0x70)
 	dposVoterLastVoteWeightKey = int64(0x71)
 
 	dposVoterRefundAmountBeginKey     = int64(0x80)
 	dposVoterRefundReqestTimeBeginKey = int64(0x81)
+	dposVoterAutoRefundKey            = int64(0x82) // whether matured refunds are paid out without a claim
+	dposVoterRefundQueueKey           = int64(0x83) // one past the position of the voter in the refund queue
 
 	dposVoterCountKey          = int64(0x90)
 	dposVoterBpAddressBeginKey = int64(0x91)
+	dposMaxVotes               = int64(vm.DposMaxVotes) // producers a voter may vote for at once
+
+	dposProxyKey               = int64(0xb0) // whether the address is a registered vote proxy
+	dposProxyWeightKey         = int64(0xb1) // sum of the vote weights delegated to the proxy
+	dposProxyFirstDelegatorKey = int64(0xb2)
+	dposVoterProxyKey          = int64(0xb3)
+	dposVoterProxyNextKey      = int64(0xb4) // the delegators of a proxy form a doubly linked list
+	dposVoterProxyPrevKey      = int64(0xb5)
+
+	kycHistoryCountKey      = int64(0xc0)
+	kycExpiryKey            = int64(0xc1)
+	kycContractCreatorKey   = int64(0xc2)
+	kycZoneRestrictionKey   = int64(0xc3)  // keyed by the zone pair instead of an address
+	kycPendingProviderKey   = int64(0xc4)  // provider of the attestation awaiting confirmation
+	kycPendingInfoKey       = int64(0xc5)  // epoch, level, zone, expiry and deadline of the pending attestation
+	kycProviderEpochKey     = int64(0xc6)  // keyed by the provider, bumped whenever its attestations are revoked
+	kycAttestationEpochKey  = int64(0xc7)  // epoch of the provider the attestation of the address was issued in
+	kycProviderInfoKey      = int64(0xd0)  // length, followed by the metadata in 32 byte chunks
+	kycHistoryEntryBeginKey = int64(0x100) // two slots per entry
+)
+
+// Header fields of a queued KYC provider proposal.
+const (
+	kycProposalAddressField = iota
+	kycProposalStartTimeField
+	kycProposalVoteTotalField
+	kycProposalTypeField
+	kycProposalFields // number of header fields
 )
 
 // StateDBs within the ethereum protocol are used to store anything
@@ -91,6 +139,10 @@ type StateDB struct {
 	db   Database
 	trie Trie
 
+	// Root of the state last opened or committed. Accounts not in the live set
+	// are the same as in that state, so they may be served from its cache.
+	originRoot common.Hash
+
 	// This map holds 'live' objects, which will get modified while processing a state transition.
 	stateObjects      map[common.Address]*stateObject
 	stateObjectsDirty map[common.Address]struct{}
@@ -108,10 +160,17 @@ type StateDB struct {
 	thash, bhash common.Hash
 	txIndex      int
 	logs         map[common.Hash][]*types.Log
+	logOrder     []common.Hash // transactions with logs, in the order they logged first
 	logSize      uint
 
 	preimages map[common.Hash][]byte
 
+	// Slots of the KYC contract accessed by each transaction, by index
+	kycSlots map[int]*kycSlotAccess
+
+	// Flat copy of the storage of the KYC contract, if the database keeps one
+	kycFlat *KycFlat
+
 	// Journal of state modifications. This is the backbone of
 	// Snapshot and RevertToSnapshot.
 	journal        *journal
@@ -130,10 +189,13 @@ func New(root common.Hash, db Database) (*StateDB, error) {
 	return &StateDB{
 		db:                db,
 		trie:              tr,
+		originRoot:        root,
 		stateObjects:      make(map[common.Address]*stateObject),
 		stateObjectsDirty: make(map[common.Address]struct{}),
 		logs:              make(map[common.Hash][]*types.Log),
 		preimages:         make(map[common.Hash][]byte),
+		kycSlots:          make(map[int]*kycSlotAccess),
+		kycFlat:           kycFlatOf(db),
 		journal:           newJournal(),
 	}, nil
 }
@@ -146,9 +208,21 @@ func (self *StateDB) setError(err error) {
 }
 
 func (self *StateDB) Error() error {
+	self.collectErrors()
 	return self.dbErr
 }
 
+// collectErrors passes the first error memoized by any live state object on to
+// the state, so that read failures surface whether the object is committed or
+// only read from.
+func (self *StateDB) collectErrors() {
+	for _, stateObject := range self.stateObjects {
+		if stateObject.dbErr != nil {
+			self.setError(stateObject.dbErr)
+		}
+	}
+}
+
 // Reset clears out all ephemeral state objects from the state db, but keeps
 // the underlying state trie to avoid reloading data for the next operations.
 func (self *StateDB) Reset(root common.Hash) error {
@@ -157,14 +231,17 @@ func (self *StateDB) Reset(root common.Hash) error {
 		return err
 	}
 	self.trie = tr
+	self.originRoot = root
 	self.stateObjects = make(map[common.Address]*stateObject)
 	self.stateObjectsDirty = make(map[common.Address]struct{})
 	self.thash = common.Hash{}
 	self.bhash = common.Hash{}
 	self.txIndex = 0
 	self.logs = make(map[common.Hash][]*types.Log)
+	self.logOrder = nil
 	self.logSize = 0
 	self.preimages = make(map[common.Hash][]byte)
+	self.kycSlots = make(map[int]*kycSlotAccess)
 	self.clearJournalAndRefund()
 	return nil
 }
@@ -176,6 +253,9 @@ func (self *StateDB) AddLog(log *types.Log) {
 	log.BlockHash = self.bhash
 	log.TxIndex = uint(self.txIndex)
 	log.Index = self.logSize
+	if len(self.logs[self.thash]) == 0 {
+		self.logOrder = append(self.logOrder, self.thash)
+	}
 	self.logs[self.thash] = append(self.logs[self.thash], log)
 	self.logSize++
 }
@@ -184,10 +264,11 @@ func (self *StateDB) GetLogs(hash common.Hash) []*types.Log {
 	return self.logs[hash]
 }
 
+// Logs returns the logs of all transactions in the order they were emitted.
 func (self *StateDB) Logs() []*types.Log {
 	var logs []*types.Log
-	for _, lgs := range self.logs {
-		logs = append(logs, lgs...)
+	for _, hash := range self.logOrder {
+		logs = append(logs, self.logs[hash]...)
 	}
 	return logs
 }
@@ -262,6 +343,9 @@ func (self *StateDB) GetCodeSize(addr common.Address) int {
 	if stateObject.code != nil {
 		return len(stateObject.code)
 	}
+	if bytes.Equal(stateObject.CodeHash(), emptyCodeHash) {
+		return 0
+	}
 	size, err := self.db.ContractCodeSize(stateObject.addrHash, common.BytesToHash(stateObject.CodeHash()))
 	if err != nil {
 		self.setError(err)
@@ -282,6 +366,19 @@ func (self *StateDB) GetState(addr common.Address, bhash common.Hash) common.Has
 	if stateObject != nil {
 		return stateObject.GetState(self.db, bhash)
 	}
+	if addr == vm.KycContractAddress {
+		self.touchKycSlot(bhash, false)
+	}
+	return common.Hash{}
+}
+
+// GetCommittedState retrieves a value from the given account's committed
+// storage trie, as of the beginning of the current transaction.
+func (self *StateDB) GetCommittedState(addr common.Address, hash common.Hash) common.Hash {
+	stateObject := self.getStateObject(addr)
+	if stateObject != nil {
+		return stateObject.GetCommittedState(self.db, hash)
+	}
 	return common.Hash{}
 }
 
@@ -409,16 +506,25 @@ func (self *StateDB) getStateObject(addr common.Address) (stateObject *stateObje
 		return obj
 	}
 
-	// Load the object from the database.
-	enc, err := self.trie.TryGet(addr[:])
-	if len(enc) == 0 {
-		self.setError(err)
-		return nil
+	// Load the object from the account cache or the database.
+	cacher, _ := self.db.(accountCacher)
+	data, ok := Account{}, false
+	if cacher != nil {
+		data, ok = cacher.cachedAccount(self.originRoot, addr)
 	}
-	var data Account
-	if err := rlp.DecodeBytes(enc, &data); err != nil {
-		log.Error("Failed to decode state object", "addr", addr, "err", err)
-		return nil
+	if !ok {
+		enc, err := self.trie.TryGet(addr[:])
+		if len(enc) == 0 {
+			self.setError(err)
+			return nil
+		}
+		if err := rlp.DecodeBytes(enc, &data); err != nil {
+			log.Error("Failed to decode state object", "addr", addr, "err", err)
+			return nil
+		}
+		if cacher != nil {
+			cacher.cacheAccount(self.originRoot, addr, data)
+		}
 	}
 	// Insert into the live set.
 	obj := newObject(self, addr, data)
@@ -446,7 +552,13 @@ func (self *StateDB) createObject(addr common.Address) (newobj, prev *stateObjec
 	newobj = newObject(self, addr, Account{})
 	newobj.setNonce(0) // sets the object to dirty
 	if prev == nil {
-		self.journal.append(createObjectChange{account: &addr})
+		if deleted := self.stateObjects[addr]; deleted != nil {
+			// Keep the deletion around on revert, the account trie and cache
+			// of the origin state may still hold the account.
+			self.journal.append(resetObjectChange{prev: deleted})
+		} else {
+			self.journal.append(createObjectChange{account: &addr})
+		}
 	} else {
 		self.journal.append(resetObjectChange{prev: prev})
 	}
@@ -471,23 +583,47 @@ func (self *StateDB) CreateAccount(addr common.Address) {
 	}
 }
 
+// ForEachStorage calls cb with every non-empty storage slot of addr until cb
+// returns false. Values cached in the state, changed or not, take precedence
+// over those in the storage trie, and slots cleared in the state are skipped.
 func (db *StateDB) ForEachStorage(addr common.Address, cb func(key, value common.Hash) bool) {
 	so := db.getStateObject(addr)
 	if so == nil {
 		return
 	}
 
-	// When iterating over the storage check the cache first
-	for h, value := range so.cachedStorage {
-		cb(h, value)
+	// When iterating over the storage check the caches first
+	for h, value := range so.dirtyStorage {
+		if value != (common.Hash{}) && !cb(h, value) {
+			return
+		}
 	}
-
-	it := trie.NewIterator(so.getTrie(db.db).NodeIterator(nil))
+	for h, value := range so.originStorage {
+		if _, dirty := so.dirtyStorage[h]; dirty || value == (common.Hash{}) {
+			continue
+		}
+		if !cb(h, value) {
+			return
+		}
+	}
+	tr := so.getTrie(db.db)
+	it := trie.NewIterator(tr.NodeIterator(nil))
 	for it.Next() {
 		// ignore cached values
-		key := common.BytesToHash(db.trie.GetKey(it.Key))
-		if _, ok := so.cachedStorage[key]; !ok {
-			cb(key, common.BytesToHash(it.Value))
+		key := common.BytesToHash(tr.GetKey(it.Key))
+		if _, dirty := so.dirtyStorage[key]; dirty {
+			continue
+		}
+		if _, cached := so.originStorage[key]; cached {
+			continue
+		}
+		_, content, _, err := rlp.Split(it.Value)
+		if err != nil {
+			db.setError(err)
+			return
+		}
+		if !cb(key, common.BytesToHash(content)) {
+			return
 		}
 	}
 }
@@ -502,12 +638,19 @@ func (self *StateDB) Copy() *StateDB {
 	state := &StateDB{
 		db:                self.db,
 		trie:              self.db.CopyTrie(self.trie),
+		originRoot:        self.originRoot,
 		stateObjects:      make(map[common.Address]*stateObject, len(self.journal.dirties)),
 		stateObjectsDirty: make(map[common.Address]struct{}, len(self.journal.dirties)),
 		refund:            self.refund,
+		thash:             self.thash,
+		bhash:             self.bhash,
+		txIndex:           self.txIndex,
 		logs:              make(map[common.Hash][]*types.Log, len(self.logs)),
+		logOrder:          append([]common.Hash(nil), self.logOrder...),
 		logSize:           self.logSize,
 		preimages:         make(map[common.Hash][]byte),
+		kycSlots:          make(map[int]*kycSlotAccess, len(self.kycSlots)),
+		kycFlat:           self.kycFlat,
 		journal:           newJournal(),
 	}
 	// Copy the dirty states, logs, and preimages
@@ -531,12 +674,21 @@ func (self *StateDB) Copy() *StateDB {
 		}
 	}
 
+	// The logs get their block hash filled in once the block is sealed, and the
+	// preimages are handed out by Preimages, so neither may be shared
 	for hash, logs := range self.logs {
-		state.logs[hash] = make([]*types.Log, len(logs))
-		copy(state.logs[hash], logs)
+		cpy := make([]*types.Log, len(logs))
+		for i, l := range logs {
+			cpy[i] = new(types.Log)
+			*cpy[i] = *l
+		}
+		state.logs[hash] = cpy
 	}
 	for hash, preimage := range self.preimages {
-		state.preimages[hash] = preimage
+		state.preimages[hash] = common.CopyBytes(preimage)
+	}
+	for txIndex, access := range self.kycSlots {
+		state.kycSlots[txIndex] = access.copy()
 	}
 	return state
 }
@@ -565,6 +717,24 @@ func (self *StateDB) RevertToSnapshot(revid int) {
 	self.validRevisions = self.validRevisions[:idx]
 }
 
+// StorageChanges returns the storage slots of the given account written since
+// the given revision, along with their current values.
+func (self *StateDB) StorageChanges(addr common.Address, revid int) map[common.Hash]common.Hash {
+	idx := sort.Search(len(self.validRevisions), func(i int) bool {
+		return self.validRevisions[i].id >= revid
+	})
+	if idx == len(self.validRevisions) || self.validRevisions[idx].id != revid {
+		return nil
+	}
+	changes := make(map[common.Hash]common.Hash)
+	for _, entry := range self.journal.entries[self.validRevisions[idx].journalIndex:] {
+		if change, ok := entry.(storageChange); ok && *change.account == addr {
+			changes[change.key] = self.GetState(addr, change.key)
+		}
+	}
+	return changes
+}
+
 // GetRefund returns the current value of the refund counter.
 func (self *StateDB) GetRefund() uint64 {
 	return self.refund
@@ -573,6 +743,9 @@ func (self *StateDB) GetRefund() uint64 {
 // Finalise finalises the state by removing the self destructed objects
 // and clears the journal as well as the refunds.
 func (s *StateDB) Finalise(deleteEmptyObjects bool) {
+	// Remember failed reads of the transaction, Commit refuses to persist them
+	s.collectErrors()
+
 	for addr := range s.journal.dirties {
 		stateObject, exist := s.stateObjects[addr]
 		if !exist {
@@ -604,18 +777,22 @@ func (self *StateDB) SetKycLevel(addr common.Address, level uint32) {
 	}
 }
 
-func (self *StateDB) GetKycLevel(addr common.Address) uint32 {
+// GetKycLevel returns the KYC level of addr, or of the creator if addr is a
+// contract. Addresses whose attestation expired by time have level 0.
+func (self *StateDB) GetKycLevel(addr common.Address, time uint64) uint32 {
 
-	if self.IsContractAddress(addr) {
-		//should be human
-		addr = self.GetContractCreator(addr)
-	}
+	//should be human
+	addr = self.GetContractCreator(addr)
 
 	//check is has valid provider
 	if pd := self.GetKycProvider(addr); pd == (common.Address{}) || addr == (common.Address{}) {
 		return 0
 	}
 
+	if expiry := self.GetKycExpiry(addr); expiry != 0 && time >= expiry {
+		return 0
+	}
+
 	stateObject := self.getStateObject(addr)
 	if stateObject != nil {
 		return stateObject.GetKycLevel()
@@ -623,6 +800,84 @@ func (self *StateDB) GetKycLevel(addr common.Address) uint32 {
 	return 0
 }
 
+// SetKycExpiry sets the time the KYC attestation of addr expires at, zero
+// meaning never.
+func (self *StateDB) SetKycExpiry(addr common.Address, expiresAt uint64) {
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+	stateObject.SetState(self.db, common.PrefixedAddressHash(addr, kycExpiryKey), common.BigToHash(new(big.Int).SetUint64(expiresAt)))
+}
+
+// GetKycExpiry returns the time the KYC attestation of addr expires at, zero
+// meaning never.
+func (self *StateDB) GetKycExpiry(addr common.Address) uint64 {
+	return self.GetState(vm.KycContractAddress, common.PrefixedAddressHash(addr, kycExpiryKey)).Big().Uint64()
+}
+
+// SetKycPendingAttestation records the attestation of addr awaiting its
+// confirmation by a second provider, replacing any pending one. A nil
+// attestation clears it.
+func (self *StateDB) SetKycPendingAttestation(addr common.Address, attestation *common.KycAttestation) {
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+
+	var provider, info common.Hash
+	if attestation != nil {
+		provider = attestation.Provider.Hash()
+		binary.BigEndian.PutUint64(info[0:], attestation.Epoch)
+		binary.BigEndian.PutUint32(info[8:], attestation.Level)
+		binary.BigEndian.PutUint32(info[12:], attestation.Zone)
+		binary.BigEndian.PutUint64(info[16:], attestation.ExpiresAt)
+		binary.BigEndian.PutUint64(info[24:], attestation.Deadline)
+	}
+	stateObject.SetState(self.db, common.PrefixedAddressHash(addr, kycPendingProviderKey), provider)
+	stateObject.SetState(self.db, common.PrefixedAddressHash(addr, kycPendingInfoKey), info)
+}
+
+// GetKycPendingAttestation returns the attestation of addr awaiting its
+// confirmation by a second provider, lapsed or not, or nil if there is none.
+func (self *StateDB) GetKycPendingAttestation(addr common.Address) *common.KycAttestation {
+	provider := self.GetState(vm.KycContractAddress, common.PrefixedAddressHash(addr, kycPendingProviderKey))
+	if provider == (common.Hash{}) {
+		return nil
+	}
+	info := self.GetState(vm.KycContractAddress, common.PrefixedAddressHash(addr, kycPendingInfoKey))
+	return &common.KycAttestation{
+		Provider:  common.BytesToAddress(provider[:]),
+		Level:     binary.BigEndian.Uint32(info[8:]),
+		Zone:      binary.BigEndian.Uint32(info[12:]),
+		ExpiresAt: binary.BigEndian.Uint64(info[16:]),
+		Deadline:  binary.BigEndian.Uint64(info[24:]),
+		Epoch:     binary.BigEndian.Uint64(info[0:]),
+	}
+}
+
+// GetKycProviderEpoch returns the attestation epoch of provider, the number of
+// times its attestations were revoked.
+func (self *StateDB) GetKycProviderEpoch(provider common.Address) uint64 {
+	return self.GetState(vm.KycContractAddress, common.PrefixedAddressHash(provider, kycProviderEpochKey)).Big().Uint64()
+}
+
+// RevokeKycAttestations invalidates every attestation provider issued so far by
+// moving it on to the next attestation epoch.
+func (self *StateDB) RevokeKycAttestations(provider common.Address) {
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+	epoch := self.GetKycProviderEpoch(provider) + 1
+	stateObject.SetState(self.db, common.PrefixedAddressHash(provider, kycProviderEpochKey), common.BigToHash(new(big.Int).SetUint64(epoch)))
+}
+
+// SetKycAttestationEpoch records the attestation epoch of its provider the KYC
+// info of addr was issued in.
+func (self *StateDB) SetKycAttestationEpoch(addr common.Address, epoch uint64) {
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+	stateObject.SetState(self.db, common.PrefixedAddressHash(addr, kycAttestationEpochKey), common.BigToHash(new(big.Int).SetUint64(epoch)))
+}
+
+// GetKycAttestationEpoch returns the attestation epoch of its provider the KYC
+// info of addr was issued in. Attestations issued before epochs were recorded
+// count as issued in the first one.
+func (self *StateDB) GetKycAttestationEpoch(addr common.Address) uint64 {
+	return self.GetState(vm.KycContractAddress, common.PrefixedAddressHash(addr, kycAttestationEpochKey)).Big().Uint64()
+}
+
 func (self *StateDB) SetKycZone(addr common.Address, zone uint32) {
 
 	stateObject := self.GetOrNewStateObject(addr)
@@ -633,10 +888,8 @@ func (self *StateDB) SetKycZone(addr common.Address, zone uint32) {
 
 func (self *StateDB) GetKycZone(addr common.Address) uint32 {
 
-	if self.IsContractAddress(addr) {
-		//should be human
-		addr = self.GetContractCreator(addr)
-	}
+	//should be human
+	addr = self.GetContractCreator(addr)
 
 	//check is has valid provider
 	if pd := self.GetKycProvider(addr); pd == (common.Address{}) || addr == (common.Address{}) {
@@ -658,14 +911,15 @@ func (self *StateDB) SetKycProvider(addr common.Address, provider common.Address
 	}
 }
 
+// GetKycProvider returns the provider of the KYC info of addr, or of the creator
+// if addr is a contract. It returns the zero address if the provider was removed
+// or revoked its attestations since.
 func (self *StateDB) GetKycProvider(addr common.Address) common.Address {
-	if self.IsContractAddress(addr) {
-		addr = self.GetContractCreator(addr)
-	}
+	addr = self.GetContractCreator(addr)
 	stateObject := self.getStateObject(addr)
 	if stateObject != nil {
 		pdr := stateObject.GetKycProvider()
-		if self.KycProviderExists(pdr) {
+		if self.KycProviderExists(pdr) && self.GetKycAttestationEpoch(addr) >= self.GetKycProviderEpoch(pdr) {
 			return pdr
 		}
 	}
@@ -684,6 +938,7 @@ func (self *StateDB) KycProviderExists(addr common.Address) bool {
 
 	//loop and look ,  kyc provider should be a very little number, so no worries.
 	//we can add a cache here if kycNum becomes large.
+	kycProviderScanMeter.Mark(1)
 	for i := int64(kycProviderStartHash); i < (kycProviderStartHash + kycNum); i++ {
 		haveV := self.GetState(vm.KycContractAddress, common.BigToHash(big.NewInt(int64(i))))
 		if common.BytesToAddress(haveV.Bytes()) == addr {
@@ -695,9 +950,7 @@ func (self *StateDB) KycProviderExists(addr common.Address) bool {
 }
 
 func (self *StateDB) GetKycProviderCount() int64 {
-	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
-
-	haveV := stateObject.GetState(self.db, kycProviderNumberKey)
+	haveV := self.GetState(vm.KycContractAddress, kycProviderNumberKey)
 	return haveV.Big().Int64()
 }
 
@@ -707,26 +960,36 @@ func (self *StateDB) SetKycProviderCount(c int64) {
 	stateObject.SetState(self.db, kycProviderNumberKey, common.BigToHash(big.NewInt(c)))
 }
 
-func (self *StateDB) AddKycProvider(addr common.Address) {
+// AddKycProvider appends addr to the KYC providers. It reports false without
+// touching the list if addr is a provider already or the list is full.
+func (self *StateDB) AddKycProvider(addr common.Address) bool {
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
 
 	kycNum := self.GetKycProviderCount()
 
 	//can not work more
 	if kycNum >= maxKycProviderCount {
-		return
+		return false
+	}
+	// KycProviderExists accepts anyone while there are no providers, so only
+	// ask it once there are some
+	if kycNum > 0 && self.KycProviderExists(addr) {
+		return false
 	}
 
 	stateObject.SetState(self.db, common.BigToHash(big.NewInt(int64(kycProviderStartHash+kycNum))), addr.Hash())
 	self.SetKycProviderCount(kycNum + 1)
+	return true
 }
 
-func (self *StateDB) RemoveKycProvider(addr common.Address) {
+// RemoveKycProvider drops addr from the KYC providers, reporting whether it was
+// one. Note that removing the last provider lets anyone act as a provider.
+func (self *StateDB) RemoveKycProvider(addr common.Address) bool {
 	kycNum := self.GetKycProviderCount()
 
 	//anyone could be a provider is not provider at all.
 	if kycNum == 0 {
-		return
+		return false
 	}
 
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
@@ -753,44 +1016,280 @@ func (self *StateDB) RemoveKycProvider(addr common.Address) {
 	}
 	if found {
 		self.SetKycProviderCount(kycNum - 1)
+		self.SetKycProviderInfo(addr, nil)
 	}
+	return found
 }
 
-func (self *StateDB) SetKycProviderProposol(addr common.Address, st *big.Int, pt *big.Int) {
+// setKycBlob stores data as its length followed by 32 byte chunks in the slots
+// returned by key, clearing the chunks of any longer data stored before.
+func (self *StateDB) setKycBlob(key func(i int64) common.Hash, data []byte) {
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
 
+	oldLen := self.GetState(vm.KycContractAddress, key(0)).Big().Int64()
+	stateObject.SetState(self.db, key(0), common.BigToHash(big.NewInt(int64(len(data)))))
+
+	chunks := int64((len(data) + common.HashLength - 1) / common.HashLength)
+	for i := int64(0); i < chunks; i++ {
+		var hv common.Hash
+		copy(hv[:], data[i*common.HashLength:])
+		stateObject.SetState(self.db, key(i+1), hv)
+	}
+	for i := chunks; i < (oldLen+common.HashLength-1)/common.HashLength; i++ {
+		stateObject.SetState(self.db, key(i+1), common.Hash{})
+	}
+}
+
+// getKycBlob returns the data stored by setKycBlob in the slots returned by key.
+func (self *StateDB) getKycBlob(key func(i int64) common.Hash) []byte {
+	length := self.GetState(vm.KycContractAddress, key(0)).Big()
+	if length.Sign() == 0 || length.Cmp(big.NewInt(vm.KycProviderInfoMaxSize)) > 0 {
+		return nil
+	}
+	data := make([]byte, 0, length.Int64()+common.HashLength)
+	for i := int64(0); int64(len(data)) < length.Int64(); i++ {
+		hv := self.GetState(vm.KycContractAddress, key(i+1))
+		data = append(data, hv[:]...)
+	}
+	return data[:length.Int64()]
+}
+
+// kycProviderInfoSlot returns the i-th metadata slot of the provider addr.
+func kycProviderInfoSlot(addr common.Address) func(i int64) common.Hash {
+	return func(i int64) common.Hash {
+		return common.PrefixedAddressHash(addr, kycProviderInfoKey+i)
+	}
+}
+
+// kycProposalSlot returns the queue slot of the proposal id.
+func kycProposalSlot(id uint64) int64 {
+	return int64(id % vm.KycMaxProposals)
+}
+
+// kycProposalKey returns the key of a header field of the proposal in queue
+// slot s. The first slot keeps the keys of the single proposal predating the
+// queue.
+func kycProposalKey(s int64, field int64) common.Hash {
+	if s == 0 {
+		return []common.Hash{kycProposalAddressKey, kycProposalStartTimeKey, kycProposalVoteTotalKey, kycProposalAlreadyVotedKey}[field]
+	}
+	return common.BigToHash(big.NewInt(kycProposalStartHash + kycProposalFields*s + field))
+}
+
+// kycProposalVoterKey returns the key of the i-th voter of the proposal in
+// queue slot s.
+func kycProposalVoterKey(s int64, i int64) common.Hash {
+	return common.BigToHash(big.NewInt(kycVoterStartHash + s*kycProposalSlotSize + i))
+}
+
+// kycProposalResultKey returns the key of the i-th vote of the proposal in
+// queue slot s.
+func kycProposalResultKey(s int64, i int64) common.Hash {
+	return common.BigToHash(big.NewInt(kycVoteResultStartHash + s*kycProposalSlotSize + i))
+}
+
+// kycProposalInfoSlot returns the metadata slots of the proposal in queue slot s.
+func kycProposalInfoSlot(s int64) func(i int64) common.Hash {
+	return func(i int64) common.Hash {
+		return common.BigToHash(big.NewInt(kycProposalInfoStartHash + s*kycProposalSlotSize + i))
+	}
+}
+
+// SetKycProviderInfo stores the RLP encoded metadata of the provider addr,
+// clearing it if info is empty.
+func (self *StateDB) SetKycProviderInfo(addr common.Address, info []byte) {
+	if len(info) > vm.KycProviderInfoMaxSize {
+		return
+	}
+	self.setKycBlob(kycProviderInfoSlot(addr), info)
+}
+
+// GetKycProviderInfoBlob returns the RLP encoded metadata of the provider addr.
+func (self *StateDB) GetKycProviderInfoBlob(addr common.Address) []byte {
+	return self.getKycBlob(kycProviderInfoSlot(addr))
+}
+
+// GetKycProviderInfo returns the metadata of the provider addr, which is left
+// empty if none or no valid one was registered.
+func (self *StateDB) GetKycProviderInfo(addr common.Address) *common.KycProviderInfo {
+	info := new(common.KycProviderInfo)
+	if blob := self.GetKycProviderInfoBlob(addr); blob != nil {
+		if err := rlp.DecodeBytes(blob, info); err != nil {
+			info = new(common.KycProviderInfo)
+		}
+	}
+	info.Address = addr
+	return info
+}
+
+// SetKycProviderProposolInfo stores the RLP encoded metadata of the provider
+// proposed by the pending proposal id.
+func (self *StateDB) SetKycProviderProposolInfo(id uint64, info []byte) {
+	if len(info) > vm.KycProviderInfoMaxSize || !self.kycProposalPending(id) {
+		return
+	}
+	self.setKycBlob(kycProposalInfoSlot(kycProposalSlot(id)), info)
+}
+
+// GetKycProviderProposolInfo returns the RLP encoded metadata of the provider
+// proposed by the pending proposal id.
+func (self *StateDB) GetKycProviderProposolInfo(id uint64) []byte {
+	if !self.kycProposalPending(id) {
+		return nil
+	}
+	return self.getKycBlob(kycProposalInfoSlot(kycProposalSlot(id)))
+}
+
+// GetKycProviderProposolRange returns the id of the oldest proposal that may
+// still be pending and the id the next proposal will get.
+func (self *StateDB) GetKycProviderProposolRange() (uint64, uint64) {
+	head := self.GetState(vm.KycContractAddress, kycProposalHeadKey).Big().Uint64()
+	tail := self.GetState(vm.KycContractAddress, kycProposalTailKey).Big().Uint64()
+
+	// a proposal made before the queue existed is the first one, unless it
+	// was cleared by resetting its subject
+	if tail == 0 && self.GetState(vm.KycContractAddress, kycProposalVoteTotalKey) != (common.Hash{}) &&
+		self.GetState(vm.KycContractAddress, kycProposalAddressKey) != (common.Hash{}) {
+		tail = 1
+	}
+	return head, tail
+}
+
+// kycProposalPending reports whether the proposal id was made and not cleared yet.
+func (self *StateDB) kycProposalPending(id uint64) bool {
+	head, tail := self.GetKycProviderProposolRange()
+	if id < head || id >= tail {
+		return false
+	}
+	return self.GetState(vm.KycContractAddress, kycProposalKey(kycProposalSlot(id), kycProposalVoteTotalField)) != (common.Hash{})
+}
+
+// GetKycProviderProposolIds returns the ids of the pending proposals, oldest
+// first.
+func (self *StateDB) GetKycProviderProposolIds() []uint64 {
+	ids := make([]uint64, 0)
+
+	head, tail := self.GetKycProviderProposolRange()
+	for id := head; id < tail; id++ {
+		if self.kycProposalPending(id) {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+// SetKycProviderProposol queues a new provider proposal, resetting the vote
+// slots of every current provider, and returns its id. It returns false
+// without touching the state if vm.KycMaxProposals proposals are queued.
+func (self *StateDB) SetKycProviderProposol(addr common.Address, st *big.Int, pt *big.Int) (uint64, bool) {
+	head, tail := self.GetKycProviderProposolRange()
+	if tail-head >= vm.KycMaxProposals {
+		return 0, false
+	}
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+
+	s := kycProposalSlot(tail)
 	kycNum := self.GetKycProviderCount()
+	oldNum := self.GetState(vm.KycContractAddress, kycProposalKey(s, kycProposalVoteTotalField)).Big().Int64()
 
-	self.SetState(vm.KycContractAddress, kycProposalAddressKey, addr.Hash())
-	self.SetState(vm.KycContractAddress, kycProposalStartTimeKey, common.BigToHash(st))
-	self.SetState(vm.KycContractAddress, kycProposalVoteTotalKey, common.BigToHash(big.NewInt(int64(kycNum))))
-	self.SetState(vm.KycContractAddress, kycProposalAlreadyVotedKey, common.BigToHash(pt))
+	stateObject.SetState(self.db, kycProposalKey(s, kycProposalAddressField), addr.Hash())
+	stateObject.SetState(self.db, kycProposalKey(s, kycProposalStartTimeField), common.BigToHash(st))
+	stateObject.SetState(self.db, kycProposalKey(s, kycProposalVoteTotalField), common.BigToHash(big.NewInt(int64(kycNum))))
+	stateObject.SetState(self.db, kycProposalKey(s, kycProposalTypeField), common.BigToHash(pt))
 
-	// initial vote list
-	for i := kycVoterStartHash; i < kycVoterStartHash+kycNum; i++ {
-		stateObject.SetState(self.db, common.BigToHash(big.NewInt(int64(i))), common.BigToHash(common.Big0))
+	// initial vote list and vote result list
+	for i := int64(0); i < kycNum; i++ {
+		stateObject.SetState(self.db, kycProposalVoterKey(s, i), common.BigToHash(common.Big0))
+		stateObject.SetState(self.db, kycProposalResultKey(s, i), common.BigToHash(common.Big0))
 	}
-	// initial vote result list
-	for i := kycVoteResultStartHash; i < kycVoteResultStartHash+kycNum; i++ {
-		stateObject.SetState(self.db, common.BigToHash(big.NewInt(int64(i))), common.BigToHash(common.Big0))
+	// clear the votes of an earlier proposal made with more providers
+	for i := kycNum; i < oldNum; i++ {
+		stateObject.SetState(self.db, kycProposalVoterKey(s, i), common.Hash{})
+		stateObject.SetState(self.db, kycProposalResultKey(s, i), common.Hash{})
 	}
+	self.setKycBlob(kycProposalInfoSlot(s), nil)
+
+	stateObject.SetState(self.db, kycProposalHeadKey, common.BigToHash(new(big.Int).SetUint64(head)))
+	stateObject.SetState(self.db, kycProposalTailKey, common.BigToHash(new(big.Int).SetUint64(tail+1)))
+	return tail, true
 }
 
-func (self *StateDB) GetKycProviderProposol() (common.Address, *big.Int, *big.Int, *big.Int, *big.Int, *big.Int) {
+// SetKycLegacyProviderProposol replaces the single provider proposal chains
+// keep before the proposal queue fork, resetting the vote slots of every
+// current provider. The proposal is stored in the slot of the first queued one
+// without touching the queue, and a zero addr marks it as cleared.
+func (self *StateDB) SetKycLegacyProviderProposol(addr common.Address, st *big.Int, pt *big.Int) {
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+
+	kycNum := self.GetKycProviderCount()
+	stateObject.SetState(self.db, kycProposalAddressKey, addr.Hash())
+	stateObject.SetState(self.db, kycProposalStartTimeKey, common.BigToHash(st))
+	stateObject.SetState(self.db, kycProposalVoteTotalKey, common.BigToHash(big.NewInt(int64(kycNum))))
+	stateObject.SetState(self.db, kycProposalAlreadyVotedKey, common.BigToHash(pt))
+
+	// initial vote list and vote result list
+	for i := int64(0); i < kycNum; i++ {
+		stateObject.SetState(self.db, kycProposalVoterKey(0, i), common.BigToHash(common.Big0))
+		stateObject.SetState(self.db, kycProposalResultKey(0, i), common.BigToHash(common.Big0))
+	}
+}
 
+// ClearKycProviderProposol drops the proposal id along with all the votes cast
+// on it, moving the queue past any cleared proposals at its front.
+func (self *StateDB) ClearKycProviderProposol(id uint64) {
+	if !self.kycProposalPending(id) {
+		return
+	}
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
 
-	hvAddr := stateObject.GetState(self.db, kycProposalAddressKey)
-	hvTime := stateObject.GetState(self.db, kycProposalStartTimeKey)
-	hvVoteTotal := stateObject.GetState(self.db, kycProposalVoteTotalKey)
-	hvType := stateObject.GetState(self.db, kycProposalAlreadyVotedKey)
+	s := kycProposalSlot(id)
+	voteTotal := self.GetState(vm.KycContractAddress, kycProposalKey(s, kycProposalVoteTotalField)).Big().Int64()
+	for i := int64(0); i < voteTotal; i++ {
+		stateObject.SetState(self.db, kycProposalVoterKey(s, i), common.Hash{})
+		stateObject.SetState(self.db, kycProposalResultKey(s, i), common.Hash{})
+	}
+	for field := int64(0); field < kycProposalFields; field++ {
+		stateObject.SetState(self.db, kycProposalKey(s, field), common.Hash{})
+	}
+	self.setKycBlob(kycProposalInfoSlot(s), nil)
+
+	head, tail := self.GetKycProviderProposolRange()
+	for head < tail && !self.kycProposalPending(head) {
+		head++
+	}
+	stateObject.SetState(self.db, kycProposalHeadKey, common.BigToHash(new(big.Int).SetUint64(head)))
+	stateObject.SetState(self.db, kycProposalTailKey, common.BigToHash(new(big.Int).SetUint64(tail)))
+}
+
+// GetKycProviderProposolProposer returns the provider that started the
+// proposal id, which always casts the first vote on it.
+func (self *StateDB) GetKycProviderProposolProposer(id uint64) common.Address {
+	if !self.kycProposalPending(id) {
+		return common.Address{}
+	}
+	return common.BytesToAddress(self.GetState(vm.KycContractAddress, kycProposalVoterKey(kycProposalSlot(id), 0)).Bytes())
+}
+
+// GetKycProviderProposol returns the subject, start time, number of providers
+// voting, type and the yes and no votes of the proposal id. The subject is the
+// zero address if the proposal isn't pending.
+func (self *StateDB) GetKycProviderProposol(id uint64) (common.Address, *big.Int, *big.Int, *big.Int, *big.Int, *big.Int) {
+	if !self.kycProposalPending(id) {
+		return common.Address{}, new(big.Int), new(big.Int), new(big.Int), new(big.Int), new(big.Int)
+	}
+	s := kycProposalSlot(id)
+
+	hvAddr := self.GetState(vm.KycContractAddress, kycProposalKey(s, kycProposalAddressField))
+	hvTime := self.GetState(vm.KycContractAddress, kycProposalKey(s, kycProposalStartTimeField))
+	hvVoteTotal := self.GetState(vm.KycContractAddress, kycProposalKey(s, kycProposalVoteTotalField))
+	hvType := self.GetState(vm.KycContractAddress, kycProposalKey(s, kycProposalTypeField))
 	// get number of vote yes
 	iVotedYes := int64(0)
 	iVotedNo := int64(0)
 	yesHash := common.BigToHash(common.Big1)
 	noHash := common.BigToHash(common.Big2)
-	for i := kycVoteResultStartHash; i < kycVoteResultStartHash+hvVoteTotal.Big().Int64(); i++ {
-		hvVoted := stateObject.GetState(self.db, common.BigToHash(big.NewInt(i)))
+	for i := int64(0); i < hvVoteTotal.Big().Int64(); i++ {
+		hvVoted := self.GetState(vm.KycContractAddress, kycProposalResultKey(s, i))
 		if hvVoted == yesHash {
 			iVotedYes++
 		} else if hvVoted == noHash {
@@ -803,14 +1302,20 @@ func (self *StateDB) GetKycProviderProposol() (common.Address, *big.Int, *big.In
 
 }
 
-func (self *StateDB) SetVoteForKycProviderProposol(addr common.Address, nay uint16) bool {
-
+// SetVoteForKycProviderProposol records the vote of addr on the proposal id in
+// the first free vote slot. It returns false without touching the state if the
+// proposal isn't pending, addr already voted or all slots are taken.
+func (self *StateDB) SetVoteForKycProviderProposol(id uint64, addr common.Address, nay uint16) bool {
+	if !self.kycProposalPending(id) {
+		return false
+	}
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
 
-	hvVoteTotal := stateObject.GetState(self.db, kycProposalVoteTotalKey)
+	s := kycProposalSlot(id)
+	hvVoteTotal := stateObject.GetState(self.db, kycProposalKey(s, kycProposalVoteTotalField))
 
 	for i := int64(0); i < hvVoteTotal.Big().Int64(); i++ {
-		hvVoted := stateObject.GetState(self.db, common.BigToHash(big.NewInt(kycVoterStartHash+i)))
+		hvVoted := stateObject.GetState(self.db, kycProposalVoterKey(s, i))
 		if hvVoted != (common.Hash{}) {
 			// check if the address has been voted
 			if hvVoted == addr.Hash() {
@@ -818,11 +1323,11 @@ func (self *StateDB) SetVoteForKycProviderProposol(addr common.Address, nay uint
 			}
 			continue
 		} else {
-			stateObject.SetState(self.db, common.BigToHash(big.NewInt(kycVoterStartHash+i)), addr.Hash())
+			stateObject.SetState(self.db, kycProposalVoterKey(s, i), addr.Hash())
 			if nay == 0 { // vote yes
-				stateObject.SetState(self.db, common.BigToHash(big.NewInt(kycVoteResultStartHash+i)), common.BigToHash(common.Big1))
+				stateObject.SetState(self.db, kycProposalResultKey(s, i), common.BigToHash(common.Big1))
 			} else { // vote no
-				stateObject.SetState(self.db, common.BigToHash(big.NewInt(kycVoteResultStartHash+i)), common.BigToHash(common.Big2))
+				stateObject.SetState(self.db, kycProposalResultKey(s, i), common.BigToHash(common.Big2))
 			}
 			return true
 		}
@@ -835,12 +1340,11 @@ func (self *StateDB) GetKycProviderList() []common.Address {
 	kycNum := self.GetKycProviderCount()
 
 	addresses := make([]common.Address, 0)
-	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
 
 	//loop and look ,  kyc provider should be a very little number, so no worries.
 	// we can add a cache here if kycNum becomes large.
 	for i := kycProviderStartHash; i < (kycProviderStartHash + kycNum); i++ {
-		haveV := stateObject.GetState(self.db, common.BigToHash(big.NewInt(int64(i))))
+		haveV := self.GetState(vm.KycContractAddress, common.BigToHash(big.NewInt(int64(i))))
 		addresses = append(addresses, common.BytesToAddress(haveV.Bytes()))
 
 	}
@@ -864,6 +1368,66 @@ func (self *StateDB) Prepare(thash, bhash common.Hash, ti int) {
 	self.txIndex = ti
 }
 
+// kycSlotAccess is the set of slots of the KYC contract a transaction read and
+// the set it wrote.
+type kycSlotAccess struct {
+	reads, writes map[common.Hash]struct{}
+}
+
+func (a *kycSlotAccess) copy() *kycSlotAccess {
+	cpy := &kycSlotAccess{
+		reads:  make(map[common.Hash]struct{}, len(a.reads)),
+		writes: make(map[common.Hash]struct{}, len(a.writes)),
+	}
+	for key := range a.reads {
+		cpy.reads[key] = struct{}{}
+	}
+	for key := range a.writes {
+		cpy.writes[key] = struct{}{}
+	}
+	return cpy
+}
+
+// touchKycSlot records an access to a slot of the KYC contract by the current
+// transaction. Writes are journaled so that reverted ones are forgotten, reads
+// are kept since they affected the execution either way.
+func (self *StateDB) touchKycSlot(key common.Hash, write bool) {
+	access := self.kycSlots[self.txIndex]
+	if access == nil {
+		access = &kycSlotAccess{reads: make(map[common.Hash]struct{}), writes: make(map[common.Hash]struct{})}
+		self.kycSlots[self.txIndex] = access
+	}
+	if !write {
+		access.reads[key] = struct{}{}
+		return
+	}
+	if _, ok := access.writes[key]; !ok {
+		self.journal.append(kycSlotWriteChange{txIndex: self.txIndex, key: key})
+		access.writes[key] = struct{}{}
+	}
+}
+
+// TouchedKycSlots returns the slots of the KYC contract the transaction at the
+// given index read and the ones it wrote, both sorted. Two transactions of a
+// block conflict if either wrote a slot the other one touched.
+func (self *StateDB) TouchedKycSlots(txIndex int) (reads, writes []common.Hash) {
+	access := self.kycSlots[txIndex]
+	if access == nil {
+		return nil, nil
+	}
+	sorted := func(set map[common.Hash]struct{}) []common.Hash {
+		keys := make([]common.Hash, 0, len(set))
+		for key := range set {
+			keys = append(keys, key)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return bytes.Compare(keys[i][:], keys[j][:]) < 0
+		})
+		return keys
+	}
+	return sorted(access.reads), sorted(access.writes)
+}
+
 // DeleteSuicides flags the suicided objects for deletion so that it
 // won't be referenced again when called / queried up on.
 //
@@ -895,10 +1459,17 @@ func (s *StateDB) clearJournalAndRefund() {
 func (s *StateDB) Commit(deleteEmptyObjects bool) (root common.Hash, err error) {
 	defer s.clearJournalAndRefund()
 
+	// A failed read leaves the state computed from partial data, never persist it
+	s.collectErrors()
+	if s.dbErr != nil {
+		return common.Hash{}, s.dbErr
+	}
+
 	for addr := range s.journal.dirties {
 		s.stateObjectsDirty[addr] = struct{}{}
 	}
 	// Commit objects to the trie.
+	var committed []*stateObject
 	for addr, stateObject := range s.stateObjects {
 		_, isDirty := s.stateObjectsDirty[addr]
 		switch {
@@ -906,20 +1477,38 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (root common.Hash, err error)
 			// If the object has been removed, don't bother syncing it
 			// and just mark it for deletion in the trie.
 			s.deleteStateObject(stateObject)
+			delete(s.stateObjectsDirty, addr)
 		case isDirty:
 			// Write any contract code associated with the state object
 			if stateObject.code != nil && stateObject.dirtyCode {
 				s.db.TrieDB().Insert(common.BytesToHash(stateObject.CodeHash()), stateObject.code)
 				stateObject.dirtyCode = false
 			}
-			// Write any storage changes in the state object to its storage trie.
-			if err := stateObject.CommitTrie(s.db); err != nil {
-				return common.Hash{}, err
+			committed = append(committed, stateObject)
+		default:
+			delete(s.stateObjectsDirty, addr)
+		}
+	}
+	// Write any storage changes in the state objects to their storage tries.
+	if err := commitStorageTries(s.db, committed); err != nil {
+		return common.Hash{}, err
+	}
+	// Update the objects in the main account trie, moving the flat storage of
+	// the KYC contract along.
+	for _, stateObject := range committed {
+		if stateObject.address == vm.KycContractAddress && s.kycFlat != nil && stateObject.data.Root != stateObject.originRoot {
+			if err := s.kycFlat.update(s.db, stateObject.addrHash, stateObject.originRoot, stateObject.data.Root, stateObject.flatChanges); err != nil {
+				log.Error("Failed to update KYC flat storage", "root", stateObject.data.Root, "err", err)
 			}
-			// Update the object in the main account trie.
-			s.updateStateObject(stateObject)
 		}
-		delete(s.stateObjectsDirty, addr)
+		stateObject.originRoot, stateObject.flatChanges = stateObject.data.Root, nil
+
+		s.updateStateObject(stateObject)
+		delete(s.stateObjectsDirty, stateObject.address)
+	}
+	s.collectErrors()
+	if s.dbErr != nil {
+		return common.Hash{}, s.dbErr
 	}
 	// Write trie changes.
 	root, err = s.trie.Commit(func(leaf []byte, parent common.Hash) error {
@@ -937,16 +1526,83 @@ func (s *StateDB) Commit(deleteEmptyObjects bool) (root common.Hash, err error)
 		return nil
 	})
 	log.Debug("Trie cache stats after commit", "misses", trie.CacheMisses(), "unloads", trie.CacheUnloads())
-	return root, err
+	if err != nil {
+		return root, err
+	}
+	// The committed accounts are the ones the next block is likely to touch,
+	// cache them for the new state. Deleted ones are simply left out of it.
+	if cacher, ok := s.db.(accountCacher); ok {
+		for _, stateObject := range committed {
+			cacher.cacheAccount(root, stateObject.address, stateObject.data)
+		}
+	}
+	s.originRoot = root
+	return root, nil
 }
 
-func IsPrecompiledAddress(addr common.Address) bool {
+// storageCommitWorkers is the number of storage tries committed concurrently.
+var storageCommitWorkers = runtime.NumCPU()
+
+// commitStorageTries commits the storage tries of the given state objects with
+// up to storageCommitWorkers at once, each object touching only its own trie
+// and the trie database serializing the insertion of the nodes. If any of them
+// fails, the first error reported is returned.
+func commitStorageTries(db Database, objects []*stateObject) error {
+	workers := storageCommitWorkers
+	if workers > len(objects) {
+		workers = len(objects)
+	}
+	if workers <= 1 {
+		for _, object := range objects {
+			if err := object.CommitTrie(db); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	var (
+		tasks = make(chan *stateObject, len(objects))
+		errc  = make(chan error, 1)
+		wg    sync.WaitGroup
+	)
+	for _, object := range objects {
+		tasks <- object
+	}
+	close(tasks)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for object := range tasks {
+				if err := object.CommitTrie(db); err != nil {
+					select {
+					case errc <- err:
+					default:
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	select {
+	case err := <-errc:
+		return err
+	default:
+		return nil
+	}
+}
+
+// IsPrecompiledAddress reports whether addr is the KYC contract or one of the
+// precompiles active at block number under the rules of config.
+func IsPrecompiledAddress(addr common.Address, number *big.Int, config *params.ChainConfig) bool {
 
 	if addr == vm.KycContractAddress {
 		return true
 	}
 
-	precompiles := vm.PrecompiledContractsByzantium
+	precompiles := vm.ActivePrecompiles(number, config)
 	if p := precompiles[addr]; p != nil {
 		return true
 	}
@@ -954,7 +1610,35 @@ func IsPrecompiledAddress(addr common.Address) bool {
 	return false
 }
 
-func (db *StateDB) TxKycValidate(addr common.Address, dst common.Address, amount *big.Int) bool {
+// IsKycExemptAddress reports whether transfers from and to addr skip the KYC
+// checks at block number. Before the precompile whitelist fork that holds for
+// the KYC contract and every active precompile, letting unverified accounts park
+// funds at pure function precompiles. From the fork on it only holds for the KYC
+// contract, which staking and fees pay into and refunds pay out of, and for the
+// active precompiles the chain config lists explicitly.
+func IsKycExemptAddress(addr common.Address, number *big.Int, config *params.ChainConfig) bool {
+	if addr == vm.KycContractAddress {
+		return true
+	}
+	if !IsPrecompiledAddress(addr, number, config) {
+		return false
+	}
+	if config == nil || !config.IsKycPrecompileWhitelist(number) {
+		return true
+	}
+	for _, exempt := range config.KycExemptPrecompiles() {
+		if exempt == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// TxKycValidate reports whether addr may transfer amount to dst in block number
+// at time: both need the KYC level the chain config requires for the amount,
+// unless they are providers or exempt precompiles, and the zone policy must
+// allow the transfer.
+func (db *StateDB) TxKycValidate(addr common.Address, dst common.Address, amount *big.Int, number *big.Int, time uint64, config *params.ChainConfig) bool {
 
 	if amount.Cmp(common.Big0) == 0 {
 		return true
@@ -964,14 +1648,69 @@ func (db *StateDB) TxKycValidate(addr common.Address, dst common.Address, amount
 		return true
 	}
 
-	if (db.KycProviderExists(addr) || IsPrecompiledAddress(addr) || db.GetKycLevel(addr) > 0) &&
-		(db.KycProviderExists(dst) || IsPrecompiledAddress(dst) || db.GetKycLevel(dst) > 0 || (dst == common.Address{})) {
-		return true
+	level := config.KycRequiredLevel(amount)
+	if (db.KycProviderExists(addr) || IsKycExemptAddress(addr, number, config) || db.GetKycLevel(addr, time) >= level) &&
+		(db.KycProviderExists(dst) || IsKycExemptAddress(dst, number, config) || db.GetKycLevel(dst, time) >= level || (dst == common.Address{})) {
+		return !db.kycZoneRestricted(addr, dst, number, config)
 	}
 
 	return false
 }
 
+// kycZoneRestricted reports whether the zone policy forbids addr to transact
+// with dst. Providers, exempt precompiles and the zero address are exempt.
+func (db *StateDB) kycZoneRestricted(addr common.Address, dst common.Address, number *big.Int, config *params.ChainConfig) bool {
+	if db.GetKycZoneRestrictionCount() == 0 {
+		return false
+	}
+	for _, party := range []common.Address{addr, dst} {
+		if party == (common.Address{}) || IsKycExemptAddress(party, number, config) || db.KycProviderExists(party) {
+			return false
+		}
+	}
+	return db.IsKycZoneRestricted(db.GetKycZone(addr), db.GetKycZone(dst))
+}
+
+// kycZonePairKey returns the storage key of the restriction of transfers
+// from zone from to zone to.
+func kycZonePairKey(from uint32, to uint32) common.Hash {
+	var pair common.Address
+	binary.BigEndian.PutUint32(pair[12:16], from)
+	binary.BigEndian.PutUint32(pair[16:20], to)
+	return common.PrefixedAddressHash(pair, kycZoneRestrictionKey)
+}
+
+// SetKycZoneRestricted forbids or allows addresses in zone from to transact
+// with addresses in zone to.
+func (self *StateDB) SetKycZoneRestricted(from uint32, to uint32, restricted bool) {
+	if self.IsKycZoneRestricted(from, to) == restricted {
+		return
+	}
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+
+	count := self.GetKycZoneRestrictionCount()
+	hv := common.Hash{}
+	if restricted {
+		hv = common.BigToHash(common.Big1)
+		count++
+	} else {
+		count--
+	}
+	stateObject.SetState(self.db, kycZonePairKey(from, to), hv)
+	stateObject.SetState(self.db, kycZoneRestrictionCountKey, common.BigToHash(big.NewInt(count)))
+}
+
+// IsKycZoneRestricted reports whether addresses in zone from are forbidden to
+// transact with addresses in zone to.
+func (self *StateDB) IsKycZoneRestricted(from uint32, to uint32) bool {
+	return self.GetState(vm.KycContractAddress, kycZonePairKey(from, to)) != (common.Hash{})
+}
+
+// GetKycZoneRestrictionCount returns the number of restricted zone pairs.
+func (self *StateDB) GetKycZoneRestrictionCount() int64 {
+	return self.GetState(vm.KycContractAddress, kycZoneRestrictionCountKey).Big().Int64()
+}
+
 func (db *StateDB) IsContractAddress(address common.Address) bool {
 
 	return db.GetCodeSize(address) > 0
@@ -1021,18 +1760,18 @@ func (self *StateDB) GetDposProducerCount() *big.Int {
 
 func (self *StateDB) SetDposProducerCount(val *big.Int) {
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
-	stateObject.setState(dposProducerCountKey, common.BigToHash(val))
+	stateObject.SetState(self.db, dposProducerCountKey, common.BigToHash(val))
 }
 
 func (self *StateDB) RegisterProducer(pb *common.Address, url string) {
-	hk := common.AddressToHashWithPrefix(pb, dposProducerURLKey)
+	hk := common.PrefixedAddressHash(*pb, dposProducerURLKey)
 	vb := []byte(url)
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
 	oldhv := stateObject.GetState(self.db, hk)
 
 	if len(vb) > common.HashLength {
 		stateObject.SetState(self.db, hk, common.BytesToHash(vb[:common.HashLength]))
-		hk2 := common.AddressToHashWithPrefix(pb, dposProducerURLKeyHigh)
+		hk2 := common.PrefixedAddressHash(*pb, dposProducerURLKeyHigh)
 		stateObject.SetState(self.db, hk2, common.BytesToHash(vb[common.HashLength:]))
 	} else {
 		stateObject.SetState(self.db, hk, common.BytesToHash(vb))
@@ -1044,7 +1783,7 @@ func (self *StateDB) RegisterProducer(pb *common.Address, url string) {
 
 		hk := common.BigToHash(big.NewInt(pbCount.Int64() + dposProducerAllStartKey))
 		hv := pb.Hash()
-		stateObject.setState(hk, hv)
+		stateObject.SetState(self.db, hk, hv)
 
 		pbCount = big.NewInt(pbCount.Int64() + 1)
 		self.SetDposProducerCount(pbCount)
@@ -1056,14 +1795,14 @@ func (self *StateDB) RegisterProducer(pb *common.Address, url string) {
 }
 
 func (self *StateDB) UpdateProducerTotalVotes(pb *common.Address, stake *big.Int) {
-	hk := common.AddressToHashWithPrefix(pb, dposProducerTotalVotesKey)
+	hk := common.PrefixedAddressHash(*pb, dposProducerTotalVotesKey)
 	hv := common.BigToHash(stake)
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
 	stateObject.SetState(self.db, hk, hv)
 }
 
 func (self *StateDB) UpdateProducerActive(pb *common.Address, val bool) {
-	hk := common.AddressToHashWithPrefix(pb, dposProducerActiveKey)
+	hk := common.PrefixedAddressHash(*pb, dposProducerActiveKey)
 	bv := common.Big0
 	if val {
 		bv = common.Big1
@@ -1073,18 +1812,94 @@ func (self *StateDB) UpdateProducerActive(pb *common.Address, val bool) {
 	stateObject.SetState(self.db, hk, hv)
 }
 
-func (self *StateDB) UpdateProducerLocation(pb *common.Address, val *big.Int) {
-	hk := common.AddressToHashWithPrefix(pb, dposProducerLocationKey)
-	hv := common.BigToHash(val)
+// UpdateProducerLocation sets the country or region the producer pb operates
+// from.
+func (self *StateDB) UpdateProducerLocation(pb *common.Address, loc common.ProducerLocation) {
+	hk := common.PrefixedAddressHash(*pb, dposProducerLocationKey)
+	hv := common.BigToHash(new(big.Int).SetUint64(uint64(loc)))
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
 	stateObject.SetState(self.db, hk, hv)
 }
 
-func (self *StateDB) GetProducerInfo(pb *common.Address) *common.ProducerInfo {
+// SetProducerRegistrationFee sets the registration fee escrowed for producer pb.
+func (self *StateDB) SetProducerRegistrationFee(pb *common.Address, fee *big.Int) {
+	hk := common.PrefixedAddressHash(*pb, dposProducerFeeKey)
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+	stateObject.SetState(self.db, hk, common.BigToHash(fee))
+}
+
+// GetProducerRegistrationFee returns the registration fee escrowed for producer
+// pb, refunded when it deregisters.
+func (self *StateDB) GetProducerRegistrationFee(pb *common.Address) *big.Int {
+	hk := common.PrefixedAddressHash(*pb, dposProducerFeeKey)
+	return self.GetState(vm.KycContractAddress, hk).Big()
+}
+
+// SetProducerSigningKey sets the key sealing the blocks of producer pb from the
+// checkpoint after the block number on, the zero address restoring its own key.
+// The key it replaces becomes the previous key, unless it was itself set since
+// the last checkpoint and never took effect, checkpoints being epoch blocks
+// apart. The producer the current and previous keys seal for is tracked along.
+func (self *StateDB) SetProducerSigningKey(pb *common.Address, key common.Address, number uint64, epoch uint64) {
+	previous := self.GetProducerPrevSigningKey(pb)
+	if self.GetProducerSigningKeyBlock(pb)/epoch != number/epoch {
+		previous = self.GetProducerSigningKey(pb)
+	}
+	self.setProducerSigningKeys(pb, key, previous, number)
+}
+
+// setProducerSigningKeys sets the current and previous signing keys of producer
+// pb along with the block they were changed in, moving the producer they seal
+// for over from the keys they replace.
+func (self *StateDB) setProducerSigningKeys(pb *common.Address, key common.Address, previous common.Address, number uint64) {
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
-	hk := common.AddressToHashWithPrefix(pb, dposProducerURLKey)
-	hv := stateObject.GetState(self.db, hk)
-	hv2 := stateObject.GetState(self.db, common.AddressToHashWithPrefix(pb, dposProducerURLKeyHigh))
+	for _, old := range []common.Address{self.GetProducerSigningKey(pb), self.GetProducerPrevSigningKey(pb)} {
+		if old != (common.Address{}) {
+			stateObject.SetState(self.db, common.PrefixedAddressHash(old, dposSigningKeyProducerKey), common.Hash{})
+		}
+	}
+	stateObject.SetState(self.db, common.PrefixedAddressHash(*pb, dposProducerSigningKeyKey), key.Hash())
+	stateObject.SetState(self.db, common.PrefixedAddressHash(*pb, dposProducerPrevSigningKeyKey), previous.Hash())
+	stateObject.SetState(self.db, common.PrefixedAddressHash(*pb, dposProducerSigningKeyBlockKey), common.BigToHash(new(big.Int).SetUint64(number)))
+	for _, k := range []common.Address{key, previous} {
+		if k != (common.Address{}) {
+			stateObject.SetState(self.db, common.PrefixedAddressHash(k, dposSigningKeyProducerKey), pb.Hash())
+		}
+	}
+}
+
+// GetProducerSigningKey returns the key sealing the blocks of producer pb, or the
+// zero address if it seals with its own key.
+func (self *StateDB) GetProducerSigningKey(pb *common.Address) common.Address {
+	hk := common.PrefixedAddressHash(*pb, dposProducerSigningKeyKey)
+	return common.BytesToAddress(self.GetState(vm.KycContractAddress, hk).Bytes())
+}
+
+// GetProducerPrevSigningKey returns the key the signing key of producer pb took
+// over from, or the zero address if it sealed with its own key.
+func (self *StateDB) GetProducerPrevSigningKey(pb *common.Address) common.Address {
+	hk := common.PrefixedAddressHash(*pb, dposProducerPrevSigningKeyKey)
+	return common.BytesToAddress(self.GetState(vm.KycContractAddress, hk).Bytes())
+}
+
+// GetProducerSigningKeyBlock returns the block the signing key of producer pb was
+// last changed in.
+func (self *StateDB) GetProducerSigningKeyBlock(pb *common.Address) uint64 {
+	hk := common.PrefixedAddressHash(*pb, dposProducerSigningKeyBlockKey)
+	return self.GetState(vm.KycContractAddress, hk).Big().Uint64()
+}
+
+// GetSigningKeyProducer returns the producer key seals the blocks of, currently
+// or as its previous key, or the zero address if none.
+func (self *StateDB) GetSigningKeyProducer(key common.Address) common.Address {
+	hk := common.PrefixedAddressHash(key, dposSigningKeyProducerKey)
+	return common.BytesToAddress(self.GetState(vm.KycContractAddress, hk).Bytes())
+}
+
+func (self *StateDB) GetProducerInfo(pb *common.Address) *common.ProducerInfo {
+	hk := common.PrefixedAddressHash(*pb, dposProducerURLKey)
+	hv := self.GetState(vm.KycContractAddress, hk)
+	hv2 := self.GetState(vm.KycContractAddress, common.PrefixedAddressHash(*pb, dposProducerURLKeyHigh))
 	if hv != common.BytesToHash([]byte{0}) {
 		ret := common.ProducerInfo{}
 		cpaddr := common.BytesToAddress(pb.Bytes())
@@ -1093,29 +1908,37 @@ func (self *StateDB) GetProducerInfo(pb *common.Address) *common.ProducerInfo {
 		urlbytes := append(bytes.Trim(hv.Bytes(), "\x00"), bytes.Trim(hv2.Bytes(), "\x00")...)
 		ret.Url = string(urlbytes)
 
-		hk = common.AddressToHashWithPrefix(pb, dposProducerTotalVotesKey)
-		hv = stateObject.GetState(self.db, hk)
+		hk = common.PrefixedAddressHash(*pb, dposProducerTotalVotesKey)
+		hv = self.GetState(vm.KycContractAddress, hk)
 
 		ret.TotalVotes = hv.Big()
 
-		hk = common.AddressToHashWithPrefix(pb, dposProducerActiveKey)
-		hv = stateObject.GetState(self.db, hk)
+		hk = common.PrefixedAddressHash(*pb, dposProducerActiveKey)
+		hv = self.GetState(vm.KycContractAddress, hk)
 
 		ret.IsActive = false
 		if hv != common.BytesToHash([]byte{0}) {
 			ret.IsActive = true
 		}
 
-		hk = common.AddressToHashWithPrefix(pb, dposProducerLocationKey)
-		hv = stateObject.GetState(self.db, hk)
-		ret.Location = hv.Big()
+		hk = common.PrefixedAddressHash(*pb, dposProducerLocationKey)
+		hv = self.GetState(vm.KycContractAddress, hk)
+		if loc := hv.Big(); loc.IsUint64() && loc.Uint64() <= uint64(common.MaxProducerLocation) {
+			ret.Location = common.ProducerLocation(loc.Uint64())
+		}
 		return &ret
 	}
 	return nil
 }
 
+// ProducerInfoSorter orders producers for the election of the top producers, by
+// descending total votes and, if byOwner is set, among equal votes by ascending
+// owner address. The order is consensus critical: it decides which producers make
+// the schedule, and from the election order fork on it doesn't depend on the
+// order the producers are stored in.
 type ProducerInfoSorter struct {
-	infos []*common.ProducerInfo
+	infos   []*common.ProducerInfo
+	byOwner bool
 }
 
 func (s *ProducerInfoSorter) Len() int {
@@ -1127,10 +1950,16 @@ func (s *ProducerInfoSorter) Swap(i, j int) {
 }
 
 func (s *ProducerInfoSorter) Less(i, j int) bool {
-	return s.infos[i].TotalVotes.Cmp(s.infos[j].TotalVotes) > 0
+	if cmp := s.infos[i].TotalVotes.Cmp(s.infos[j].TotalVotes); cmp != 0 || !s.byOwner {
+		return cmp > 0
+	}
+	return bytes.Compare(s.infos[i].Owner[:], s.infos[j].Owner[:]) < 0
 }
 
-func (self *StateDB) GetProducerTopList() []common.Address {
+// GetProducerTopList returns the top producers, electing them anew if the votes
+// changed since the last election. Elections in block number order the producers
+// the way the chain config requires at that block.
+func (self *StateDB) GetProducerTopList(number *big.Int, config *params.ChainConfig) []common.Address {
 	addresses := make([]common.Address, 0)
 	producerCount := self.GetDposProducerCount().Int64()
 
@@ -1142,9 +1971,8 @@ func (self *StateDB) GetProducerTopList() []common.Address {
 
 	isElectedDone := self.GetDposTopProducerElectedDone().Int64()
 
-	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
-
 	if isElectedDone == 0 {
+		stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
 
 		oldproducerCount := producerCount
 		//sort firstly
@@ -1161,14 +1989,19 @@ func (self *StateDB) GetProducerTopList() []common.Address {
 			}
 		}
 
-		ssi := &ProducerInfoSorter{infos: infolist}
+		ssi := &ProducerInfoSorter{infos: infolist, byOwner: config != nil && config.IsDposElectionOrder(number)}
 
-		sort.Sort(ssi)
+		if ssi.byOwner {
+			sort.Stable(ssi)
+		} else {
+			sort.Sort(ssi)
+		}
+		dposElectionMeter.Mark(1)
 
 		for k, pb := range ssi.infos {
 			hk := common.BigToHash(big.NewInt(int64(k) + dposProducerAllStartKey))
 			hv := pb.Owner.Hash()
-			stateObject.setState(hk, hv)
+			stateObject.SetState(self.db, hk, hv)
 		}
 
 		//updated it
@@ -1182,7 +2015,7 @@ func (self *StateDB) GetProducerTopList() []common.Address {
 
 	for i := dposProducerAllStartKey; i < producerCount+dposProducerAllStartKey && i < 21+dposProducerAllStartKey; i++ {
 		hk := common.BigToHash(big.NewInt(int64(i)))
-		hv := stateObject.GetState(self.db, hk)
+		hv := self.GetState(vm.KycContractAddress, hk)
 		if hv != common.BytesToHash([]byte{0}) {
 			addresses = append(addresses, common.BytesToAddress(hv.Bytes()))
 		}
@@ -1225,35 +2058,104 @@ func (self *StateDB) GetProducerList(startPos int64, number int64) []common.Addr
 	return addresses
 }
 
+// getKycHistoryCounter returns the number of KYC changes ever recorded for
+// addr and the depth of its history ring, fixed when the first one was written.
+func (self *StateDB) getKycHistoryCounter(addr *common.Address) (total uint64, depth uint64) {
+	hv := self.GetState(vm.KycContractAddress, common.PrefixedAddressHash(*addr, kycHistoryCountKey))
+	return binary.BigEndian.Uint64(hv[24:]), binary.BigEndian.Uint64(hv[16:24])
+}
+
+// AddKycHistory appends a KYC change of addr to its history, overwriting the
+// oldest entry once depth entries are retained.
+func (self *StateDB) AddKycHistory(addr common.Address, entry *common.KycHistoryEntry, depth uint64) {
+	total, stored := self.getKycHistoryCounter(&addr)
+	if stored != 0 {
+		depth = stored
+	}
+	if depth == 0 {
+		return
+	}
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+
+	var hv common.Hash
+	binary.BigEndian.PutUint64(hv[8:16], entry.Time)
+	binary.BigEndian.PutUint32(hv[16:20], entry.OldLevel)
+	binary.BigEndian.PutUint32(hv[20:24], entry.NewLevel)
+	binary.BigEndian.PutUint32(hv[24:28], entry.OldZone)
+	binary.BigEndian.PutUint32(hv[28:32], entry.NewZone)
+
+	pos := kycHistoryEntryBeginKey + 2*int64(total%depth)
+	stateObject.SetState(self.db, common.PrefixedAddressHash(addr, pos), hv)
+	stateObject.SetState(self.db, common.PrefixedAddressHash(addr, pos+1), entry.Provider.Hash())
+
+	var counter common.Hash
+	binary.BigEndian.PutUint64(counter[16:24], depth)
+	binary.BigEndian.PutUint64(counter[24:], total+1)
+	stateObject.SetState(self.db, common.PrefixedAddressHash(addr, kycHistoryCountKey), counter)
+}
+
+// GetKycHistory returns up to count retained KYC changes of addr, oldest
+// first, skipping the first start of them.
+func (self *StateDB) GetKycHistory(addr common.Address, start uint64, count uint64) []common.KycHistoryEntry {
+	entries := make([]common.KycHistoryEntry, 0)
+
+	total, depth := self.getKycHistoryCounter(&addr)
+	retained := total
+	if retained > depth {
+		retained = depth
+	}
+	for i := start; i < retained && uint64(len(entries)) < count; i++ {
+		pos := kycHistoryEntryBeginKey + 2*int64((total-retained+i)%depth)
+		hv := self.GetState(vm.KycContractAddress, common.PrefixedAddressHash(addr, pos))
+		hp := self.GetState(vm.KycContractAddress, common.PrefixedAddressHash(addr, pos+1))
+		entries = append(entries, decodeKycHistoryEntry(hv, hp))
+	}
+	return entries
+}
+
+// decodeKycHistoryEntry unpacks the two storage slots of a KYC history entry.
+func decodeKycHistoryEntry(hv common.Hash, hp common.Hash) common.KycHistoryEntry {
+	return common.KycHistoryEntry{
+		Time:     binary.BigEndian.Uint64(hv[8:16]),
+		Provider: common.BytesToAddress(hp.Bytes()),
+		OldLevel: binary.BigEndian.Uint32(hv[16:20]),
+		NewLevel: binary.BigEndian.Uint32(hv[20:24]),
+		OldZone:  binary.BigEndian.Uint32(hv[24:28]),
+		NewZone:  binary.BigEndian.Uint32(hv[28:32]),
+	}
+}
+
 func (self *StateDB) SetVoterStaking(myAddr *common.Address, stake *big.Int) {
-	hk := common.AddressToHashWithPrefix(myAddr, dposVoterStakingKey)
+	hk := common.PrefixedAddressHash(*myAddr, dposVoterStakingKey)
 	hv := common.BigToHash(stake)
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
 	stateObject.SetState(self.db, hk, hv)
 }
 
 func (self *StateDB) GetVoterStaking(myAddr *common.Address) (stake *big.Int) {
-	hk := common.AddressToHashWithPrefix(myAddr, dposVoterStakingKey)
-	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
-	hv := stateObject.GetState(self.db, hk)
+	hk := common.PrefixedAddressHash(*myAddr, dposVoterStakingKey)
+	hv := self.GetState(vm.KycContractAddress, hk)
 	return hv.Big()
 }
 
 func (self *StateDB) SetVoterProducers(myAddr *common.Address, pbs []common.Address) {
 	vcount := len(pbs)
 
-	if vcount > 30 {
+	// The contract rejects lists longer than the configured limit up front
+	// since the vote limit fork, which never exceeds the slots guarded here.
+	// Before it, longer lists were dropped right here.
+	if int64(vcount) > dposMaxVotes {
 		return
 	}
 
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
 
-	hk := common.AddressToHashWithPrefix(myAddr, dposVoterCountKey)
+	hk := common.PrefixedAddressHash(*myAddr, dposVoterCountKey)
 	hv := common.BigToHash(big.NewInt(int64(vcount)))
 	stateObject.SetState(self.db, hk, hv)
 
 	for i := 0; i < vcount; i++ {
-		hk = common.AddressToHashWithPrefix(myAddr, dposVoterBpAddressBeginKey+int64(i))
+		hk = common.PrefixedAddressHash(*myAddr, dposVoterBpAddressBeginKey+int64(i))
 		hv = pbs[i].Hash()
 		stateObject.SetState(self.db, hk, hv)
 	}
@@ -1263,12 +2165,12 @@ func (self *StateDB) GetVoterProducers(myAddr *common.Address) (pbs []common.Add
 
 	addresses := make([]common.Address, 0)
 
-	hk := common.AddressToHashWithPrefix(myAddr, dposVoterCountKey)
+	hk := common.PrefixedAddressHash(*myAddr, dposVoterCountKey)
 	hv := self.GetState(vm.KycContractAddress, hk)
 	vcount := hv.Big()
 
 	for i := int64(0); i < vcount.Int64(); i++ {
-		hk := common.AddressToHashWithPrefix(myAddr, dposVoterBpAddressBeginKey+int64(i))
+		hk := common.PrefixedAddressHash(*myAddr, dposVoterBpAddressBeginKey+int64(i))
 		hv := self.GetState(vm.KycContractAddress, hk)
 		addresses = append(addresses, common.BytesToAddress(hv.Bytes()))
 	}
@@ -1278,41 +2180,218 @@ func (self *StateDB) GetVoterProducers(myAddr *common.Address) (pbs []common.Add
 
 func (self *StateDB) SetRefundRequestInfo(myAddr *common.Address, stake *big.Int, requestTime *big.Int) {
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
-	hk := common.AddressToHashWithPrefix(myAddr, dposVoterRefundAmountBeginKey)
+	hk := common.PrefixedAddressHash(*myAddr, dposVoterRefundAmountBeginKey)
 	hv := common.BigToHash(stake)
 	stateObject.SetState(self.db, hk, hv)
 
-	hk = common.AddressToHashWithPrefix(myAddr, dposVoterRefundReqestTimeBeginKey)
+	hk = common.PrefixedAddressHash(*myAddr, dposVoterRefundReqestTimeBeginKey)
 	hv = common.BigToHash(requestTime)
 	stateObject.SetState(self.db, hk, hv)
 }
 
 func (self *StateDB) GetRefundRequestInfo(myAddr *common.Address) (stake *big.Int, requestTime *big.Int) {
-	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
-	hk := common.AddressToHashWithPrefix(myAddr, dposVoterRefundAmountBeginKey)
-	hv := stateObject.GetState(self.db, hk)
+	hk := common.PrefixedAddressHash(*myAddr, dposVoterRefundAmountBeginKey)
+	hv := self.GetState(vm.KycContractAddress, hk)
 	stake = hv.Big()
 
-	hk = common.AddressToHashWithPrefix(myAddr, dposVoterRefundReqestTimeBeginKey)
-	hv = stateObject.GetState(self.db, hk)
+	hk = common.PrefixedAddressHash(*myAddr, dposVoterRefundReqestTimeBeginKey)
+	hv = self.GetState(vm.KycContractAddress, hk)
 	requestTime = hv.Big()
 
 	return stake, requestTime
 }
 
+// SetDposAutoRefund opts myAddr in or out of having its matured refunds paid
+// out automatically.
+func (self *StateDB) SetDposAutoRefund(myAddr *common.Address, val bool) {
+	hk := common.PrefixedAddressHash(*myAddr, dposVoterAutoRefundKey)
+	bv := common.Big0
+	if val {
+		bv = common.Big1
+	}
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+	stateObject.SetState(self.db, hk, common.BigToHash(bv))
+}
+
+// GetDposAutoRefund reports whether the matured refunds of myAddr are paid out
+// automatically.
+func (self *StateDB) GetDposAutoRefund(myAddr *common.Address) bool {
+	hk := common.PrefixedAddressHash(*myAddr, dposVoterAutoRefundKey)
+	return self.GetState(vm.KycContractAddress, hk) == common.BigToHash(common.Big1)
+}
+
+// getDposRefundQueue returns the position of the first and one past the last
+// entry of the refund queue.
+func (self *StateDB) getDposRefundQueue() (head, tail int64) {
+	head = self.GetState(vm.KycContractAddress, dposRefundQueueHeadKey).Big().Int64()
+	tail = self.GetState(vm.KycContractAddress, dposRefundQueueTailKey).Big().Int64()
+	return head, tail
+}
+
+// PushDposRefund appends myAddr to the end of the refund queue, superseding any
+// entry it already had.
+func (self *StateDB) PushDposRefund(myAddr *common.Address) {
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+	_, tail := self.getDposRefundQueue()
+
+	stateObject.SetState(self.db, common.BigToHash(big.NewInt(tail+dposRefundQueueStartKey)), myAddr.Hash())
+	stateObject.SetState(self.db, common.PrefixedAddressHash(*myAddr, dposVoterRefundQueueKey), common.BigToHash(big.NewInt(tail+1)))
+	stateObject.SetState(self.db, dposRefundQueueTailKey, common.BigToHash(big.NewInt(tail+1)))
+}
+
+// CancelDposRefund withdraws myAddr from the refund queue. Its entry is left in
+// place and skipped once it reaches the head.
+func (self *StateDB) CancelDposRefund(myAddr *common.Address) {
+	hk := common.PrefixedAddressHash(*myAddr, dposVoterRefundQueueKey)
+	if self.GetState(vm.KycContractAddress, hk) != (common.Hash{}) {
+		self.GetOrNewStateObject(vm.KycContractAddress).SetState(self.db, hk, common.Hash{})
+	}
+}
+
+// PeekDposRefund returns the voter at the head of the refund queue and whether
+// the entry is still live, or false if the queue is empty.
+func (self *StateDB) PeekDposRefund() (addr common.Address, live bool, ok bool) {
+	head, tail := self.getDposRefundQueue()
+	if head >= tail {
+		return common.Address{}, false, false
+	}
+	addr = common.BytesToAddress(self.GetState(vm.KycContractAddress, common.BigToHash(big.NewInt(head+dposRefundQueueStartKey))).Bytes())
+	pos := self.GetState(vm.KycContractAddress, common.PrefixedAddressHash(addr, dposVoterRefundQueueKey)).Big()
+
+	return addr, pos.Int64() == head+1, true
+}
+
+// PopDposRefund removes the head of the refund queue, withdrawing its voter
+// from the queue if the entry was live.
+func (self *StateDB) PopDposRefund() {
+	addr, live, ok := self.PeekDposRefund()
+	if !ok {
+		return
+	}
+	if live {
+		self.CancelDposRefund(&addr)
+	}
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+	head, _ := self.getDposRefundQueue()
+
+	stateObject.SetState(self.db, common.BigToHash(big.NewInt(head+dposRefundQueueStartKey)), common.Hash{})
+	stateObject.SetState(self.db, dposRefundQueueHeadKey, common.BigToHash(big.NewInt(head+1)))
+}
+
+// GetDposRefundQueue returns the voters awaiting the automatic payout of their
+// refunds, in the order they will be paid out.
+func (self *StateDB) GetDposRefundQueue() []common.Address {
+	queue := make([]common.Address, 0)
+
+	head, tail := self.getDposRefundQueue()
+	for i := head; i < tail; i++ {
+		addr := common.BytesToAddress(self.GetState(vm.KycContractAddress, common.BigToHash(big.NewInt(i+dposRefundQueueStartKey))).Bytes())
+		if self.GetState(vm.KycContractAddress, common.PrefixedAddressHash(addr, dposVoterRefundQueueKey)).Big().Int64() == i+1 {
+			queue = append(queue, addr)
+		}
+	}
+	return queue
+}
+
 func (self *StateDB) SetDposVoterLastVoteWeight(myAddr *common.Address, weight *big.Int) {
 	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
-	hk := common.AddressToHashWithPrefix(myAddr, dposVoterLastVoteWeightKey)
+	hk := common.PrefixedAddressHash(*myAddr, dposVoterLastVoteWeightKey)
 	hv := common.BigToHash(weight)
 	stateObject.SetState(self.db, hk, hv)
 }
 
 func (self *StateDB) GetDposVoterLastVoteWeight(myAddr *common.Address) (weight *big.Int) {
-	hk := common.AddressToHashWithPrefix(myAddr, dposVoterLastVoteWeightKey)
+	hk := common.PrefixedAddressHash(*myAddr, dposVoterLastVoteWeightKey)
 	hv := self.GetState(vm.KycContractAddress, hk)
 	return hv.Big()
 }
 
+// SetDposProxy registers proxy as a vote proxy others may delegate their votes
+// to, or unregisters it.
+func (self *StateDB) SetDposProxy(proxy *common.Address, val bool) {
+	hk := common.PrefixedAddressHash(*proxy, dposProxyKey)
+	bv := common.Big0
+	if val {
+		bv = common.Big1
+	}
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+	stateObject.SetState(self.db, hk, common.BigToHash(bv))
+}
+
+// IsDposProxy reports whether proxy is a registered vote proxy.
+func (self *StateDB) IsDposProxy(proxy *common.Address) bool {
+	hk := common.PrefixedAddressHash(*proxy, dposProxyKey)
+	return self.GetState(vm.KycContractAddress, hk) == common.BigToHash(common.Big1)
+}
+
+func (self *StateDB) SetDposProxyWeight(proxy *common.Address, weight *big.Int) {
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+	hk := common.PrefixedAddressHash(*proxy, dposProxyWeightKey)
+	stateObject.SetState(self.db, hk, common.BigToHash(weight))
+}
+
+func (self *StateDB) GetDposProxyWeight(proxy *common.Address) *big.Int {
+	hk := common.PrefixedAddressHash(*proxy, dposProxyWeightKey)
+	return self.GetState(vm.KycContractAddress, hk).Big()
+}
+
+// GetVoterProxy returns the proxy myAddr delegated its votes to, or the zero
+// address if it votes by itself.
+func (self *StateDB) GetVoterProxy(myAddr *common.Address) common.Address {
+	hk := common.PrefixedAddressHash(*myAddr, dposVoterProxyKey)
+	return common.BytesToAddress(self.GetState(vm.KycContractAddress, hk).Bytes())
+}
+
+// SetVoterProxy delegates the votes of myAddr to proxy, moving it from the
+// delegator list of its previous proxy to the one of the new. A zero proxy
+// revokes the delegation.
+func (self *StateDB) SetVoterProxy(myAddr *common.Address, proxy common.Address) {
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+	link := func(addr *common.Address, prefix int64) common.Hash {
+		return common.PrefixedAddressHash(*addr, prefix)
+	}
+	// Unlink the delegator from the list of its current proxy
+	if old := self.GetVoterProxy(myAddr); old != (common.Address{}) {
+		next := common.BytesToAddress(self.GetState(vm.KycContractAddress, link(myAddr, dposVoterProxyNextKey)).Bytes())
+		prev := common.BytesToAddress(self.GetState(vm.KycContractAddress, link(myAddr, dposVoterProxyPrevKey)).Bytes())
+		if prev == (common.Address{}) {
+			stateObject.SetState(self.db, link(&old, dposProxyFirstDelegatorKey), next.Hash())
+		} else {
+			stateObject.SetState(self.db, link(&prev, dposVoterProxyNextKey), next.Hash())
+		}
+		if next != (common.Address{}) {
+			stateObject.SetState(self.db, link(&next, dposVoterProxyPrevKey), prev.Hash())
+		}
+		stateObject.SetState(self.db, link(myAddr, dposVoterProxyNextKey), common.Hash{})
+		stateObject.SetState(self.db, link(myAddr, dposVoterProxyPrevKey), common.Hash{})
+	}
+	stateObject.SetState(self.db, link(myAddr, dposVoterProxyKey), proxy.Hash())
+	if proxy == (common.Address{}) {
+		return
+	}
+	// Push the delegator in front of the list of its new proxy
+	first := common.BytesToAddress(self.GetState(vm.KycContractAddress, link(&proxy, dposProxyFirstDelegatorKey)).Bytes())
+	if first != (common.Address{}) {
+		stateObject.SetState(self.db, link(&first, dposVoterProxyPrevKey), myAddr.Hash())
+		stateObject.SetState(self.db, link(myAddr, dposVoterProxyNextKey), first.Hash())
+	}
+	stateObject.SetState(self.db, link(&proxy, dposProxyFirstDelegatorKey), myAddr.Hash())
+}
+
+// GetDposProxyDelegators returns the addresses that delegated their votes to
+// proxy, the most recent delegation first.
+func (self *StateDB) GetDposProxyDelegators(proxy *common.Address) []common.Address {
+	delegators := make([]common.Address, 0)
+
+	hk := common.PrefixedAddressHash(*proxy, dposProxyFirstDelegatorKey)
+	for next := common.BytesToAddress(self.GetState(vm.KycContractAddress, hk).Bytes()); next != (common.Address{}); {
+		delegators = append(delegators, next)
+		hk = common.PrefixedAddressHash(next, dposVoterProxyNextKey)
+		next = common.BytesToAddress(self.GetState(vm.KycContractAddress, hk).Bytes())
+	}
+	return delegators
+}
+
 func (self *StateDB) GetDposLastProducerScheduleUpdateTime() *big.Int {
 	hv := self.GetState(vm.KycContractAddress, dposLastProducerScheduleUpdateTimeKey)
 	return hv.Big()
@@ -1337,7 +2416,21 @@ func (self *StateDB) SetDposTopProducerElectedDone(val *big.Int) {
 	stateObject.SetState(self.db, hk, hv)
 }
 
+// SetContractCreator records the human account that created the contract at addr.
+func (self *StateDB) SetContractCreator(addr common.Address, creator common.Address) {
+	stateObject := self.GetOrNewStateObject(vm.KycContractAddress)
+	stateObject.SetState(self.db, common.PrefixedAddressHash(addr, kycContractCreatorKey), creator.Hash())
+}
+
+// GetContractCreator returns the human account that created the contract at
+// addr, or addr itself if it isn't a contract.
 func (self *StateDB) GetContractCreator(addr common.Address) common.Address {
+	// contracts created by a constructor record the contract under construction,
+	// whose own creator is only recorded once its code is stored
+	if hv := self.GetState(vm.KycContractAddress, common.PrefixedAddressHash(addr, kycContractCreatorKey)); hv != (common.Hash{}) {
+		return self.GetContractCreator(common.BytesToAddress(hv.Bytes()))
+	}
+	// contracts created before the creator was recorded keep it as their provider
 	if self.IsContractAddress(addr) {
 		stateObject := self.getStateObject(addr)
 		if stateObject != nil {
@@ -19,12 +19,14 @@ package state
 import (
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"github.com/worldopennetwork/go-won/params"
 	"math"
 	"math/big"
 	"math/rand"
 	"reflect"
+	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -36,6 +38,9 @@ import (
 
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/rlp"
 	"github.com/worldopennetwork/go-won/wondb"
 )
 
@@ -66,6 +71,104 @@ func TestUpdateLeaks(t *testing.T) {
 	}
 }
 
+// newStorageCommitTester creates a state with count contracts, each with a few
+// dirty storage slots.
+func newStorageCommitTester(count int) *StateDB {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	for i := 0; i < count; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(i + 1)))
+		state.SetNonce(addr, 1)
+		for j := 0; j < 16; j++ {
+			state.SetState(addr, common.BigToHash(big.NewInt(int64(j))), common.BigToHash(big.NewInt(int64(i*j+1))))
+		}
+	}
+	return state
+}
+
+// Tests that committing the storage tries concurrently yields the same state
+// as committing them one by one, and that a failing storage trie fails the
+// commit without producing a root.
+func TestConcurrentStorageCommit(t *testing.T) {
+	defer func(workers int) { storageCommitWorkers = workers }(storageCommitWorkers)
+
+	storageCommitWorkers = 1
+	want, err := newStorageCommitTester(100).Commit(false)
+	if err != nil {
+		t.Fatalf("failed to commit serially: %v", err)
+	}
+	storageCommitWorkers = 8
+	if have, err := newStorageCommitTester(100).Commit(false); err != nil || have != want {
+		t.Fatalf("concurrent commit mismatch: have %x, %v, want %x", have, err, want)
+	}
+	// Fail a single storage trie
+	state := newStorageCommitTester(100)
+	failure := errors.New("storage failure")
+	state.getStateObject(common.BigToAddress(big.NewInt(42))).setError(failure)
+
+	if root, err := state.Commit(false); err != failure || root != (common.Hash{}) {
+		t.Errorf("failed commit mismatch: have %x, %v, want empty root, %v", root, err, failure)
+	}
+}
+
+// failingStorageDatabase fails to open any non-empty storage trie.
+type failingStorageDatabase struct {
+	Database
+}
+
+func (db failingStorageDatabase) OpenStorageTrie(addrHash, root common.Hash) (Trie, error) {
+	if root != (common.Hash{}) {
+		return nil, errors.New("storage read failure")
+	}
+	return db.Database.OpenStorageTrie(addrHash, root)
+}
+
+// Tests that a storage read failing on an account that's never written to
+// still fails the commit, instead of persisting a root computed without it.
+func TestCommitReadError(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+	state.SetState(common.Address{0x01}, common.Hash{0x01}, common.Hash{0x01})
+	root, _ := state.Commit(false)
+
+	state, _ = New(root, failingStorageDatabase{state.Database()})
+	if value := state.GetState(common.Address{0x01}, common.Hash{0x01}); value != (common.Hash{}) {
+		t.Fatalf("unreadable slot mismatch: have %x, want empty", value)
+	}
+	state.AddBalance(common.Address{0x02}, big.NewInt(1))
+	if state.Error() == nil {
+		t.Fatalf("read failure not recorded")
+	}
+	if root, err := state.Commit(false); err != state.Error() || root != (common.Hash{}) {
+		t.Errorf("commit mismatch: have %x, %v, want empty root, %v", root, err, state.Error())
+	}
+}
+
+// Benchmarks committing a state with 1000 dirty contracts, one storage trie at
+// a time and concurrently.
+func BenchmarkStorageCommit(b *testing.B) {
+	defer func(workers int) { storageCommitWorkers = workers }(storageCommitWorkers)
+
+	for _, bench := range []struct {
+		name    string
+		workers int
+	}{{"serial", 1}, {"parallel", runtime.NumCPU()}} {
+		b.Run(bench.name, func(b *testing.B) {
+			storageCommitWorkers = bench.workers
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				state := newStorageCommitTester(1000)
+				b.StartTimer()
+
+				if _, err := state.Commit(false); err != nil {
+					b.Fatalf("failed to commit: %v", err)
+				}
+			}
+		})
+	}
+}
+
 // Tests that no intermediate state of an object is stored into the database,
 // only the one right before the commit.
 func TestIntermediateLeaks(t *testing.T) {
@@ -121,6 +224,50 @@ func TestIntermediateLeaks(t *testing.T) {
 	}
 }
 
+// Tests that logs are returned in the order they were emitted across several
+// transactions, reverted ones left out, and that copies keep that order while
+// logging on independently.
+func TestLogsOrder(t *testing.T) {
+	for run := 0; run < 10; run++ {
+		db, _ := wondb.NewMemDatabase()
+		state, _ := New(common.Hash{}, NewDatabase(db))
+
+		var want [][]byte
+		for i := 0; i < 16; i++ {
+			state.Prepare(crypto.Keccak256Hash([]byte{byte(run), byte(i)}), common.Hash{}, i)
+			for j := 0; j < 2; j++ {
+				state.AddLog(&types.Log{Data: []byte{byte(i), byte(j)}})
+				want = append(want, []byte{byte(i), byte(j)})
+			}
+			// Every other transaction only logs what gets reverted
+			if i%2 == 1 {
+				state.Prepare(crypto.Keccak256Hash([]byte{byte(run), byte(i), 1}), common.Hash{}, i)
+				snap := state.Snapshot()
+				state.AddLog(&types.Log{Data: []byte{byte(i), 0xff}})
+				state.RevertToSnapshot(snap)
+			}
+		}
+		copy := state.Copy()
+		state.Prepare(common.Hash{0x01}, common.Hash{}, 16)
+		state.AddLog(&types.Log{Data: []byte{16, 0}})
+		copy.Prepare(common.Hash{0x02}, common.Hash{}, 16)
+		copy.AddLog(&types.Log{Data: []byte{16, 1}})
+
+		for i, db := range []*StateDB{state, copy} {
+			var have [][]byte
+			for j, log := range db.Logs() {
+				if log.Index != uint(j) {
+					t.Errorf("run %d, state %d: log %d index mismatch: have %d", run, i, j, log.Index)
+				}
+				have = append(have, log.Data)
+			}
+			if expect := append(want[:len(want):len(want)], []byte{16, byte(i)}); !reflect.DeepEqual(have, expect) {
+				t.Errorf("run %d, state %d: logs mismatch:\nhave %x\nwant %x", run, i, have, expect)
+			}
+		}
+	}
+}
+
 // TestCopy tests that copying a statedb object indeed makes the original and
 // the copy independent of each other. This test is a regression test against
 // https://github.com/worldopennetwork/go-won/pull/15549.
@@ -136,6 +283,11 @@ func TestCopy(t *testing.T) {
 	}
 	orig.Finalise(false)
 
+	preimage := crypto.Keccak256Hash([]byte{0x01})
+	orig.AddPreimage(preimage, []byte{0x01})
+	orig.Prepare(common.Hash{0x02}, common.Hash{}, 0)
+	orig.AddLog(&types.Log{Address: common.BytesToAddress([]byte{0x03})})
+
 	// Copy the state, modify both in-memory
 	copy := orig.Copy()
 
@@ -149,15 +301,32 @@ func TestCopy(t *testing.T) {
 		orig.updateStateObject(origObj)
 		copy.updateStateObject(copyObj)
 	}
-	// Finalise the changes on both concurrently
+	// Finalise the changes on both concurrently, sealing the logs of the copy
 	done := make(chan struct{})
 	go func() {
 		orig.Finalise(true)
+		for _, log := range orig.Logs() {
+			if log.BlockHash != (common.Hash{}) {
+				t.Errorf("orig log: block hash set by copy: %x", log.BlockHash)
+			}
+		}
 		close(done)
 	}()
 	copy.Finalise(true)
+	for _, log := range copy.Logs() {
+		log.BlockHash = common.Hash{0x04}
+	}
+	copy.Preimages()[preimage][0] = 0xff
 	<-done
 
+	// Verify that the logs and preimages haven't been shared
+	if logs := copy.GetLogs(common.Hash{0x02}); len(logs) != 1 || logs[0].BlockHash != (common.Hash{0x04}) {
+		t.Errorf("copy logs mismatch: %v", logs)
+	}
+	if have := orig.Preimages()[preimage]; !bytes.Equal(have, []byte{0x01}) {
+		t.Errorf("orig preimage modified by copy: have %x, want 01", have)
+	}
+
 	// Verify that the two states have been updated independently
 	for i := byte(0); i < 255; i++ {
 		origObj := orig.GetOrNewStateObject(common.BytesToAddress([]byte{i}))
@@ -172,6 +341,48 @@ func TestCopy(t *testing.T) {
 	}
 }
 
+// Tests that the KYC contract slots touched by a transaction are tracked per
+// transaction index, forgetting reverted writes but not reads, and that copies
+// track them independently.
+func TestTouchedKycSlots(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	read, written, reverted := common.Hash{0x01}, common.Hash{0x02}, common.Hash{0x03}
+
+	state.Prepare(common.Hash{0x10}, common.Hash{}, 1)
+	state.GetState(vm.KycContractAddress, read)
+	state.SetState(vm.KycContractAddress, written, common.Hash{0xff})
+	state.SetState(common.Address{0x01}, reverted, common.Hash{0xff})
+
+	snapshot := state.Snapshot()
+	state.GetState(vm.KycContractAddress, reverted)
+	state.SetState(vm.KycContractAddress, reverted, common.Hash{0xff})
+	state.SetState(vm.KycContractAddress, written, common.Hash{0xfe})
+	state.RevertToSnapshot(snapshot)
+
+	reads, writes := state.TouchedKycSlots(1)
+	if want := []common.Hash{read, reverted}; !reflect.DeepEqual(reads, want) {
+		t.Errorf("reads mismatch: have %x, want %x", reads, want)
+	}
+	if want := []common.Hash{written}; !reflect.DeepEqual(writes, want) {
+		t.Errorf("writes mismatch: have %x, want %x", writes, want)
+	}
+	if reads, writes := state.TouchedKycSlots(0); reads != nil || writes != nil {
+		t.Errorf("other transaction touched slots: reads %x, writes %x", reads, writes)
+	}
+	// Slots touched by a copy aren't attributed to the original
+	copy := state.Copy()
+	copy.SetState(vm.KycContractAddress, read, common.Hash{0xff})
+
+	if _, writes := state.TouchedKycSlots(1); len(writes) != 1 {
+		t.Errorf("original writes modified by copy: %x", writes)
+	}
+	if _, writes := copy.TouchedKycSlots(1); len(writes) != 2 {
+		t.Errorf("copy writes mismatch: have %x, want 2 slots", writes)
+	}
+}
+
 func TestSnapshotRandom(t *testing.T) {
 	config := &quick.Config{MaxCount: 1000}
 	err := quick.Check((*snapshotTest).run, config)
@@ -469,13 +680,13 @@ func TestKycInfo(t *testing.T) {
 		}
 		return true
 	}
-	checkEq("KycLevel", transState.GetKycLevel(addr), uint32(32))
+	checkEq("KycLevel", transState.GetKycLevel(addr, 0), uint32(32))
 	checkEq("KycZone", transState.GetKycZone(addr), uint32(86))
 	checkEq("KycProvider", transState.GetKycProvider(addr), common.BytesToAddress([]byte{101}))
 	checkEq("KycProviderCount", transState.GetKycProviderCount(), int64(5))
 
 	transState.RemoveKycProvider(common.BytesToAddress([]byte{101}))
-	checkEq("KycLevel", transState.GetKycLevel(addr), uint32(0))
+	checkEq("KycLevel", transState.GetKycLevel(addr, 0), uint32(0))
 	checkEq("KycZone", transState.GetKycZone(addr), uint32(0))
 	checkEq("KycProvider", transState.GetKycProvider(addr), common.BytesToAddress([]byte{0}))
 }
@@ -501,12 +712,12 @@ func TestKycProposal(t *testing.T) {
 	// vote for additional provider
 	transState.SetKycProviderProposol(addr2, big.NewInt(time.Now().Unix()), big.NewInt(1))
 
-	candidateAddr, startTime, votesTotal, proposalType, votesYes, votesNo := transState.GetKycProviderProposol()
+	candidateAddr, startTime, votesTotal, proposalType, votesYes, votesNo := transState.GetKycProviderProposol(0)
 	t.Logf("The type %d proposal info is: candidate address=%s, start time=%v, total votes=%d, yes=%d, no=%d.",
 		proposalType, candidateAddr.String(), startTime, votesTotal, votesYes, votesNo)
 
-	transState.SetVoteForKycProviderProposol(addr1, 0)
-	_, _, _, _, votesYes, votesNo = transState.GetKycProviderProposol()
+	transState.SetVoteForKycProviderProposol(0, addr1, 0)
+	_, _, _, _, votesYes, votesNo = transState.GetKycProviderProposol(0)
 	t.Logf("The type %d proposal info is: candidate address=%s, start time=%v, total votes=%d, yes=%d, no=%d.",
 		proposalType, candidateAddr.String(), startTime, votesTotal, votesYes, votesNo)
 
@@ -520,9 +731,9 @@ func TestKycProposal(t *testing.T) {
 	// vote for removal provider
 	transState.SetKycProviderProposol(addr2, big.NewInt(time.Now().Unix()), big.NewInt(2))
 
-	transState.SetVoteForKycProviderProposol(addr1, 0)
-	transState.SetVoteForKycProviderProposol(addr2, 0)
-	candidateAddr, startTime, votesTotal, proposalType, votesYes, votesNo = transState.GetKycProviderProposol()
+	transState.SetVoteForKycProviderProposol(1, addr1, 0)
+	transState.SetVoteForKycProviderProposol(1, addr2, 0)
+	candidateAddr, startTime, votesTotal, proposalType, votesYes, votesNo = transState.GetKycProviderProposol(1)
 	t.Logf("The type %d proposal info is: candidate address=%s, start time=%v, total votes=%d, yes=%d, no=%d.",
 		proposalType, candidateAddr.String(), startTime, votesTotal, votesYes, votesNo)
 
@@ -583,7 +794,7 @@ func TestDposProducerInfo(t *testing.T) {
 
 	state.UpdateProducerTotalVotes(&addr, big.NewInt(10))
 	state.UpdateProducerActive(&addr, false)
-	state.UpdateProducerLocation(&addr, big.NewInt(658685))
+	state.UpdateProducerLocation(&addr, common.ProducerLocation(156))
 
 	t.Logf("The producer info is: %v", state.GetProducerInfo(&addr))
 }
@@ -611,13 +822,67 @@ func TestDposProducerList(t *testing.T) {
 	t.Logf("Votes rank is : %v", votesList[:21])
 
 	state.SetDposTotalActivatedStake(big.NewInt(0).Mul(big.NewInt(25000000), big.NewInt(params.WON)))
-	topList := state.GetProducerTopList()
+	topList := state.GetProducerTopList(nil, nil)
 	for _, val := range topList {
 		t.Logf("The producer info is: %v", state.GetProducerInfo(&val))
 	}
 
 }
 
+// Tests that producers with equal votes are elected by ascending address from the
+// election order fork on, so that every node derives the same top producers
+// whatever order they registered in, and by votes alone before it.
+func TestDposProducerListTieBreak(t *testing.T) {
+	producers := make([]common.Address, 40)
+	for i := range producers {
+		producers[i] = common.BytesToAddress([]byte{byte(i*37%251) + 1, byte(i)})
+	}
+	votes := func(producer common.Address) *big.Int {
+		if producer[common.AddressLength-1]%10 == 0 {
+			return big.NewInt(200) // a few producers lead, the others tie
+		}
+		return big.NewInt(100)
+	}
+	want := make([]common.Address, len(producers))
+	copy(want, producers)
+	sort.Slice(want, func(i, j int) bool {
+		if cmp := votes(want[i]).Cmp(votes(want[j])); cmp != 0 {
+			return cmp > 0
+		}
+		return bytes.Compare(want[i][:], want[j][:]) < 0
+	})
+	want = want[:21]
+
+	config := &params.ChainConfig{DposElectionOrderBlock: big.NewInt(2)}
+
+	for seed := int64(0); seed < 8; seed++ {
+		db, _ := wondb.NewMemDatabase()
+		state, _ := New(common.Hash{}, NewDatabase(db))
+
+		for _, i := range rand.New(rand.NewSource(seed)).Perm(len(producers)) {
+			producer := producers[i]
+			state.RegisterProducer(&producer, "https://node.woncoin.net")
+			state.UpdateProducerTotalVotes(&producer, votes(producer))
+		}
+		state.SetDposTotalActivatedStake(new(big.Int).Mul(big.NewInt(25000000), big.NewInt(params.WON)))
+
+		legacy := state.Copy()
+		if have := legacy.GetProducerTopList(big.NewInt(1), config); len(have) != len(want) {
+			t.Errorf("seed %d: legacy top producer count mismatch: have %d, want %d", seed, len(have), len(want))
+		} else {
+			for i := 1; i < len(have); i++ {
+				if votes(have[i-1]).Cmp(votes(have[i])) < 0 {
+					t.Errorf("seed %d: legacy top producers out of order: %x", seed, have)
+					break
+				}
+			}
+		}
+		if have := state.GetProducerTopList(big.NewInt(2), config); !reflect.DeepEqual(have, want) {
+			t.Errorf("seed %d: top producers mismatch:\nhave %x\nwant %x", seed, have, want)
+		}
+	}
+}
+
 func TestRefundRequestInfo(t *testing.T) {
 	db, _ := wondb.NewMemDatabase()
 	state, _ := New(common.Hash{}, NewDatabase(db))
@@ -636,3 +901,619 @@ func TestRefundRequestInfo(t *testing.T) {
 	checkEq("RefundStake", stake, big.NewInt(399))
 	checkEq("RefundTime", reqTime, big.NewInt(time.Now().Unix()))
 }
+
+// Tests that moving delegators between proxies keeps the delegator lists of the
+// proxies consistent, whichever position the moved delegator had in its list.
+func TestDposProxyDelegators(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	proxy1, proxy2 := common.HexToAddress("0x01"), common.HexToAddress("0x02")
+	delegators := make([]common.Address, 4)
+	for i := range delegators {
+		delegators[i] = common.BigToAddress(big.NewInt(int64(0x10 + i)))
+		state.SetVoterProxy(&delegators[i], proxy1)
+	}
+	check := func(step string, proxy common.Address, want ...common.Address) {
+		if have := state.GetDposProxyDelegators(&proxy); !reflect.DeepEqual(have, append([]common.Address{}, want...)) {
+			t.Errorf("%s: delegators of %x mismatch: have %x, want %x", step, proxy, have, want)
+		}
+	}
+	check("delegation", proxy1, delegators[3], delegators[2], delegators[1], delegators[0])
+
+	state.SetVoterProxy(&delegators[2], proxy2) // middle
+	check("middle moved", proxy1, delegators[3], delegators[1], delegators[0])
+	state.SetVoterProxy(&delegators[3], proxy2) // head
+	check("head moved", proxy1, delegators[1], delegators[0])
+	state.SetVoterProxy(&delegators[0], common.Address{}) // tail
+	check("tail revoked", proxy1, delegators[1])
+	check("moves", proxy2, delegators[3], delegators[2])
+
+	if proxy := state.GetVoterProxy(&delegators[0]); proxy != (common.Address{}) {
+		t.Errorf("revoked delegation left: %x", proxy)
+	}
+	if proxy := state.GetVoterProxy(&delegators[2]); proxy != proxy2 {
+		t.Errorf("proxy mismatch: have %x, want %x", proxy, proxy2)
+	}
+	state.SetVoterProxy(&delegators[1], common.Address{})
+	check("emptied", proxy1)
+}
+
+// Tests that the KYC and dpos getters don't touch the state, so that serving
+// read-only calls can't change the root of the next block.
+func TestKycDposGettersReadOnly(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	state.GetKycLevel(addr, 0)
+	state.GetKycExpiry(addr)
+	state.GetKycZone(addr)
+	state.GetKycProvider(addr)
+	state.KycProviderExists(addr)
+	state.GetKycProviderCount()
+	state.GetKycProviderProposol(0)
+	state.GetKycProviderProposolIds()
+	state.GetKycProviderList()
+	state.GetKycHistory(addr, 0, 10)
+	state.TxKycValidate(addr, addr, big.NewInt(1), nil, 0, nil)
+	state.GetContractCreator(addr)
+
+	state.GetDposTotalActivatedStake()
+	state.GetDposThreshActivatedStakeTime()
+	state.GetDposTotalProducerWeight()
+	state.GetDposProducerCount()
+	state.GetProducerInfo(&addr)
+	state.GetProducerRegistrationFee(&addr)
+	state.GetProducerTopList(nil, nil)
+	state.GetProducerList(0, 21)
+	state.GetVoterStaking(&addr)
+	state.GetVoterProducers(&addr)
+	state.GetRefundRequestInfo(&addr)
+	state.GetDposVoterLastVoteWeight(&addr)
+	state.IsDposProxy(&addr)
+	state.GetDposProxyWeight(&addr)
+	state.GetVoterProxy(&addr)
+	state.GetDposProxyDelegators(&addr)
+	state.GetDposLastProducerScheduleUpdateTime()
+	state.GetDposTopProducerElectedDone()
+
+	if dirties := len(state.journal.dirties); dirties != 0 {
+		t.Errorf("getters dirtied %d accounts", dirties)
+	}
+	if root := state.IntermediateRoot(false); root != types.EmptyRootHash {
+		t.Errorf("root mismatch: have %x, want %x", root, types.EmptyRootHash)
+	}
+}
+
+// Tests that reverting a snapshot undoes composite KYC and dpos mutations,
+// including the list counts and the resulting state root.
+func TestKycDposRevert(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	var (
+		provider = common.HexToAddress("0x0101")
+		producer = common.HexToAddress("0x0201")
+		voter    = common.HexToAddress("0x0301")
+	)
+	state.AddKycProvider(provider)
+	state.RegisterProducer(&producer, "https://producer.example.org")
+	state.SetVoterProducers(&voter, []common.Address{producer})
+	root := state.IntermediateRoot(false)
+
+	snapshot := state.Snapshot()
+	for i := 0; i < 3; i++ {
+		addr := common.BigToAddress(big.NewInt(int64(0x1000 + i)))
+		state.AddKycProvider(addr)
+		state.RegisterProducer(&addr, "https://node"+strconv.Itoa(i)+".example.org")
+		state.SetVoterProducers(&voter, []common.Address{producer, addr})
+	}
+	state.RemoveKycProvider(provider)
+	state.RevertToSnapshot(snapshot)
+
+	if count := state.GetKycProviderCount(); count != 1 {
+		t.Errorf("kyc provider count mismatch: have %d, want 1", count)
+	}
+	if providers := state.GetKycProviderList(); !reflect.DeepEqual(providers, []common.Address{provider}) {
+		t.Errorf("kyc provider list mismatch: have %x, want %x", providers, []common.Address{provider})
+	}
+	if count := state.GetDposProducerCount(); count.Cmp(common.Big1) != 0 {
+		t.Errorf("producer count mismatch: have %v, want 1", count)
+	}
+	if producers := state.GetProducerList(0, 21); !reflect.DeepEqual(producers, []common.Address{producer}) {
+		t.Errorf("producer list mismatch: have %x, want %x", producers, []common.Address{producer})
+	}
+	if producers := state.GetVoterProducers(&voter); !reflect.DeepEqual(producers, []common.Address{producer}) {
+		t.Errorf("voter producers mismatch: have %x, want %x", producers, []common.Address{producer})
+	}
+	if have, _ := state.Commit(false); have != root {
+		t.Errorf("root mismatch: have %x, want %x", have, root)
+	}
+}
+
+// Tests that the committed storage value stays at what it was at the beginning
+// of the transaction while the slot is rewritten, and advances on Finalise.
+func TestCommittedState(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	var (
+		key  = common.HexToHash("0x01")
+		val1 = common.HexToHash("0x11")
+		val2 = common.HexToHash("0x22")
+		val3 = common.HexToHash("0x33")
+	)
+	check := func(stage string, current, committed common.Hash) {
+		if have := state.GetState(addr, key); have != current {
+			t.Errorf("%s: current value mismatch: have %x, want %x", stage, have, current)
+		}
+		if have := state.GetCommittedState(addr, key); have != committed {
+			t.Errorf("%s: committed value mismatch: have %x, want %x", stage, have, committed)
+		}
+	}
+	// Rewrite the same slot multiple times within the first transaction
+	state.SetState(addr, key, val1)
+	check("first write", val1, common.Hash{})
+	state.SetState(addr, key, val2)
+	check("second write", val2, common.Hash{})
+
+	state.Finalise(false)
+	check("first finalise", val2, val2)
+
+	// Revert a rewrite within the second transaction
+	snapshot := state.Snapshot()
+	state.SetState(addr, key, val3)
+	state.SetState(addr, key, val1)
+	check("rewrite", val1, val2)
+	state.RevertToSnapshot(snapshot)
+	check("revert", val2, val2)
+
+	// Clear the slot and ensure it only becomes committed on Finalise
+	state.SetState(addr, key, common.Hash{})
+	check("clear", common.Hash{}, val2)
+	state.Finalise(false)
+	check("second finalise", common.Hash{}, common.Hash{})
+
+	state.SetState(addr, key, val3)
+	root, _ := state.Commit(false)
+	state, _ = New(root, state.Database())
+	check("commit", val3, val3)
+}
+
+// Tests that the votes of a proposal made with more providers don't leak into
+// the next one reusing its queue slot, and that clearing a proposal drops all
+// of its slots.
+func TestKycProposalStaleVotes(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	providers := make([]common.Address, 5)
+	for i := range providers {
+		providers[i] = common.BigToAddress(big.NewInt(int64(0x100 + i)))
+		state.AddKycProvider(providers[i])
+	}
+	state.SetKycProviderProposol(common.HexToAddress("0x0201"), big.NewInt(1000), common.Big1)
+	for i, provider := range providers {
+		state.SetVoteForKycProviderProposol(0, provider, uint16(i%2))
+	}
+	for i := 1; i < vm.KycMaxProposals; i++ {
+		state.SetKycProviderProposol(common.BigToAddress(big.NewInt(int64(0x0300+i))), big.NewInt(1000), common.Big1)
+	}
+	state.RemoveKycProvider(providers[3])
+	state.RemoveKycProvider(providers[4])
+	state.ClearKycProviderProposol(0)
+
+	id, ok := state.SetKycProviderProposol(common.HexToAddress("0x0202"), big.NewInt(2000), common.Big1)
+	if !ok || id != vm.KycMaxProposals {
+		t.Fatalf("proposal id mismatch: have %d/%v, want %d/true", id, ok, vm.KycMaxProposals)
+	}
+	if _, _, total, _, yes, no := state.GetKycProviderProposol(id); total.Int64() != 3 || yes.Sign() != 0 || no.Sign() != 0 {
+		t.Fatalf("fresh proposal mismatch: total %v, yes %v, no %v, want 3, 0, 0", total, yes, no)
+	}
+	for i := int64(0); i < 5; i++ {
+		voter := state.GetState(vm.KycContractAddress, kycProposalVoterKey(0, i))
+		result := state.GetState(vm.KycContractAddress, kycProposalResultKey(0, i))
+		if voter != (common.Hash{}) || result != (common.Hash{}) {
+			t.Errorf("vote slot %d leaked: voter %x, result %x", i, voter, result)
+		}
+	}
+	// Vote on the new proposal and make sure clearing it leaves nothing behind
+	root := state.IntermediateRoot(false)
+	snapshot := state.Snapshot()
+
+	state.SetVoteForKycProviderProposol(id, providers[0], 0)
+	if proposer := state.GetKycProviderProposolProposer(id); proposer != providers[0] {
+		t.Errorf("proposer mismatch: have %x, want %x", proposer, providers[0])
+	}
+	state.ClearKycProviderProposol(id)
+	if addr, start, total, pt, _, _ := state.GetKycProviderProposol(id); addr != (common.Address{}) || start.Sign() != 0 || total.Sign() != 0 || pt.Sign() != 0 {
+		t.Errorf("proposal not cleared: %x, %v, %v, %v", addr, start, total, pt)
+	}
+	for field := int64(0); field < kycProposalFields; field++ {
+		if value := state.GetState(vm.KycContractAddress, kycProposalKey(0, field)); value != (common.Hash{}) {
+			t.Errorf("proposal field %d left after clearing: %x", field, value)
+		}
+	}
+	state.RevertToSnapshot(snapshot)
+	if have := state.IntermediateRoot(false); have != root {
+		t.Errorf("root mismatch after revert: have %x, want %x", have, root)
+	}
+}
+
+// Tests that the proposal queue hands out increasing ids, refuses proposals
+// beyond its capacity and only moves past proposals once they're cleared.
+func TestKycProposalQueue(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	state.AddKycProvider(common.HexToAddress("0x0101"))
+	state.AddKycProvider(common.HexToAddress("0x0102"))
+
+	for i := uint64(0); i < vm.KycMaxProposals; i++ {
+		if id, ok := state.SetKycProviderProposol(common.BigToAddress(new(big.Int).SetUint64(0x0200+i)), big.NewInt(1000), common.Big1); !ok || id != i {
+			t.Fatalf("proposal %d: id mismatch: have %d/%v, want %d/true", i, id, ok, i)
+		}
+	}
+	if _, ok := state.SetKycProviderProposol(common.HexToAddress("0x0300"), big.NewInt(1000), common.Big1); ok {
+		t.Fatalf("queued proposal beyond the capacity")
+	}
+	// Clearing out of order leaves the queue where it is until the front goes
+	state.ClearKycProviderProposol(2)
+	state.ClearKycProviderProposol(1)
+	if head, tail := state.GetKycProviderProposolRange(); head != 0 || tail != vm.KycMaxProposals {
+		t.Fatalf("queue range mismatch: have %d-%d, want 0-%d", head, tail, vm.KycMaxProposals)
+	}
+	state.ClearKycProviderProposol(0)
+	if head, tail := state.GetKycProviderProposolRange(); head != 3 || tail != vm.KycMaxProposals {
+		t.Fatalf("queue range mismatch: have %d-%d, want 3-%d", head, tail, vm.KycMaxProposals)
+	}
+	for i := uint64(0); i < 3; i++ {
+		if id, ok := state.SetKycProviderProposol(common.BigToAddress(new(big.Int).SetUint64(0x0300+i)), big.NewInt(2000), common.Big2); !ok || id != vm.KycMaxProposals+i {
+			t.Fatalf("refill %d: id mismatch: have %d/%v, want %d/true", i, id, ok, vm.KycMaxProposals+i)
+		}
+	}
+	if _, ok := state.SetKycProviderProposol(common.HexToAddress("0x0400"), big.NewInt(1000), common.Big1); ok {
+		t.Fatalf("queued proposal beyond the capacity after refill")
+	}
+	// Proposals sharing a slot must not be mistaken for each other
+	if addr, _, _, _, _, _ := state.GetKycProviderProposol(0); addr != (common.Address{}) {
+		t.Errorf("cleared proposal still visible through its slot: %x", addr)
+	}
+	if addr, _, _, pt, _, _ := state.GetKycProviderProposol(vm.KycMaxProposals); addr != common.HexToAddress("0x0300") || pt.Cmp(common.Big2) != 0 {
+		t.Errorf("refilled proposal mismatch: have %x/%v, want %x/2", addr, pt, common.HexToAddress("0x0300"))
+	}
+	ids := state.GetKycProviderProposolIds()
+	if len(ids) != vm.KycMaxProposals || ids[0] != 3 || ids[len(ids)-1] != vm.KycMaxProposals+2 {
+		t.Errorf("pending ids mismatch: have %v", ids)
+	}
+}
+
+// Tests that the KYC history of an address is returned oldest first and that
+// the oldest entries are overwritten once the history is full.
+func TestKycHistory(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	provider := common.HexToAddress("0x0101")
+	entry := func(i uint32) common.KycHistoryEntry {
+		return common.KycHistoryEntry{Time: uint64(1000 + i), Provider: provider, OldLevel: i, NewLevel: i + 1, OldZone: 10 * i, NewZone: 10 * (i + 1)}
+	}
+	for i := uint32(0); i < 2; i++ {
+		e := entry(i)
+		state.AddKycHistory(addr, &e, 3)
+	}
+	if have, want := state.GetKycHistory(addr, 0, 10), []common.KycHistoryEntry{entry(0), entry(1)}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("history mismatch: have %v, want %v", have, want)
+	}
+	// Overflow the history, the depth fixed on the first write must be kept
+	for i := uint32(2); i < 5; i++ {
+		e := entry(i)
+		state.AddKycHistory(addr, &e, 10)
+	}
+	if have, want := state.GetKycHistory(addr, 0, 10), []common.KycHistoryEntry{entry(2), entry(3), entry(4)}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("truncated history mismatch: have %v, want %v", have, want)
+	}
+	if have, want := state.GetKycHistory(addr, 1, 1), []common.KycHistoryEntry{entry(3)}; !reflect.DeepEqual(have, want) {
+		t.Errorf("paged history mismatch: have %v, want %v", have, want)
+	}
+	if have := state.GetKycHistory(addr, 3, 10); len(have) != 0 {
+		t.Errorf("history past the end: have %v, want none", have)
+	}
+	if have := state.GetKycHistory(common.HexToAddress("0x0202"), 0, 10); len(have) != 0 {
+		t.Errorf("history of untouched address: have %v, want none", have)
+	}
+}
+
+// Tests that transfers need the KYC level the chain config requires for their
+// amount, and that the checks are bypassed without any provider.
+func TestKycLevelThresholds(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	config := &params.ChainConfig{Kyc: &params.KycConfig{
+		LevelThresholds: []params.KycLevelThreshold{
+			{Amount: big.NewInt(5000), Level: 3},
+			{Amount: big.NewInt(1000), Level: 2},
+		},
+	}}
+	var (
+		provider = common.HexToAddress("0x0101")
+		low      = common.HexToAddress("0x0201")
+		mid      = common.HexToAddress("0x0202")
+		high     = common.HexToAddress("0x0203")
+	)
+	// Without providers, any transfer is allowed
+	if !state.TxKycValidate(low, high, big.NewInt(1000000), nil, 0, config) {
+		t.Fatalf("transfer rejected without providers")
+	}
+	state.AddKycProvider(provider)
+	for addr, level := range map[common.Address]uint32{low: 1, mid: 2, high: 3} {
+		state.SetKycProvider(addr, provider)
+		state.SetKycLevel(addr, level)
+	}
+	tests := []struct {
+		from, to common.Address
+		amount   int64
+		want     bool
+	}{
+		{low, mid, 999, true},
+		{low, mid, 1000, false},
+		{mid, low, 1000, false},
+		{mid, high, 1000, true},
+		{mid, high, 4999, true},
+		{mid, high, 5000, false},
+		{high, high, 5000, true},
+		{high, provider, 1000000, true},
+		{low, common.Address{}, 1000000, false},
+		{high, common.Address{}, 1000000, true},
+	}
+	for i, tt := range tests {
+		if have := state.TxKycValidate(tt.from, tt.to, big.NewInt(tt.amount), nil, 0, config); have != tt.want {
+			t.Errorf("test %d: validation mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+	// Without thresholds any verified level is enough
+	if !state.TxKycValidate(low, mid, big.NewInt(1000000), nil, 0, nil) {
+		t.Errorf("transfer rejected without thresholds")
+	}
+}
+
+// Tests that precompiles are only exempt from the KYC checks once the fork that
+// activates them is reached.
+func TestKycPrecompileActivation(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	var (
+		provider = common.HexToAddress("0x0101")
+		user     = common.HexToAddress("0x0201")
+		config   = &params.ChainConfig{Blake2FBlock: big.NewInt(10)}
+	)
+	state.AddKycProvider(provider)
+	state.SetKycProvider(user, provider)
+	state.SetKycLevel(user, 1)
+
+	tests := []struct {
+		number int64
+		want   bool
+	}{
+		{9, false},
+		{10, true},
+		{11, true},
+	}
+	for _, tt := range tests {
+		if have := state.TxKycValidate(user, vm.Blake2FContractAddress, big.NewInt(1), big.NewInt(tt.number), 0, config); have != tt.want {
+			t.Errorf("block %d: validation mismatch: have %v, want %v", tt.number, have, tt.want)
+		}
+	}
+	// Precompiles active since Byzantium are exempt regardless of forks
+	if !state.TxKycValidate(user, common.BytesToAddress([]byte{8}), big.NewInt(1), nil, 0, nil) {
+		t.Errorf("transfer to byzantium precompile rejected")
+	}
+}
+
+// Tests that ForEachStorage visits committed, cached and newly set slots once
+// each with their current value, skips cleared ones and stops as soon as the
+// callback asks it to.
+func TestForEachStorage(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	addr := common.Address{0x01}
+	for i := byte(1); i <= 4; i++ {
+		state.SetState(addr, common.Hash{i}, common.Hash{0x10, i})
+	}
+	root, _ := state.Commit(false)
+	state, _ = New(root, state.Database())
+
+	state.GetState(addr, common.Hash{1})                    // cached, unchanged
+	state.SetState(addr, common.Hash{2}, common.Hash{0x20}) // changed
+	state.SetState(addr, common.Hash{3}, common.Hash{})     // cleared
+	state.SetState(addr, common.Hash{5}, common.Hash{0x50}) // new
+	state.GetState(addr, common.Hash{6})                    // cached, empty
+
+	want := map[common.Hash]common.Hash{
+		{1}: {0x10, 1},
+		{2}: {0x20},
+		{4}: {0x10, 4},
+		{5}: {0x50},
+	}
+	have := make(map[common.Hash]common.Hash)
+	state.ForEachStorage(addr, func(key, value common.Hash) bool {
+		if _, dup := have[key]; dup {
+			t.Errorf("slot %x visited twice", key)
+		}
+		have[key] = value
+		return true
+	})
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("storage mismatch: have %x, want %x", have, want)
+	}
+	// Stopping at any slot must end the iteration, whichever source it came from
+	for stop := 1; stop <= len(want); stop++ {
+		calls := 0
+		state.ForEachStorage(addr, func(key, value common.Hash) bool {
+			calls++
+			return calls < stop
+		})
+		if calls != stop {
+			t.Errorf("stop at %d: callback called %d times", stop, calls)
+		}
+	}
+}
+
+// Tests that transfers to every precompile skip the KYC checks before the
+// precompile whitelist fork, while from the fork on only the KYC contract and
+// the active precompiles the chain lists do.
+func TestKycPrecompileWhitelist(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	var (
+		provider = common.HexToAddress("0x0101")
+		user     = common.HexToAddress("0x0201")
+		identity = common.BytesToAddress([]byte{4})
+		config   = &params.ChainConfig{
+			KycPrecompileWhitelistBlock: big.NewInt(10),
+			Kyc: &params.KycConfig{
+				// blake2F is listed but never activated, so stays unexempted
+				ExemptPrecompiles: []common.Address{identity, vm.Blake2FContractAddress},
+			},
+		}
+	)
+	state.AddKycProvider(provider)
+	state.SetKycProvider(user, provider)
+	state.SetKycLevel(user, 1)
+
+	for i := byte(1); i <= 13; i++ {
+		addr := common.BytesToAddress([]byte{i})
+		_, precompile := vm.PrecompiledContractsByzantium[addr]
+		precompile = precompile || addr == vm.KycContractAddress
+
+		if have := state.TxKycValidate(user, addr, big.NewInt(1), big.NewInt(9), 0, config); have != precompile {
+			t.Errorf("%x before fork: validation mismatch: have %v, want %v", addr, have, precompile)
+		}
+		want := addr == vm.KycContractAddress || addr == identity
+		if have := state.TxKycValidate(user, addr, big.NewInt(1), big.NewInt(10), 0, config); have != want {
+			t.Errorf("%x after fork: validation mismatch: have %v, want %v", addr, have, want)
+		}
+		if have := state.TxKycValidate(addr, user, big.NewInt(1), big.NewInt(10), 0, config); have != want {
+			t.Errorf("%x after fork: reverse validation mismatch: have %v, want %v", addr, have, want)
+		}
+	}
+	// Chains without a KYC config exempt only the KYC contract after the fork
+	bare := &params.ChainConfig{KycPrecompileWhitelistBlock: big.NewInt(0)}
+	if state.TxKycValidate(user, identity, big.NewInt(1), big.NewInt(1), 0, bare) {
+		t.Errorf("transfer to unlisted precompile accepted")
+	}
+	if !state.TxKycValidate(user, vm.KycContractAddress, big.NewInt(1), big.NewInt(1), 0, bare) {
+		t.Errorf("transfer to KYC contract rejected")
+	}
+}
+
+// Tests that provider metadata survives a round trip through the state, non
+// ASCII text included, and that it's cleared along with the provider.
+func TestKycProviderInfo(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	state, _ := New(common.Hash{}, NewDatabase(db))
+
+	provider := common.HexToAddress("0x0101")
+	info := &common.KycProviderInfo{
+		Address:      provider,
+		Name:         "Acme Compliance GmbH ✓",
+		Jurisdiction: "Zürich/日本",
+		URL:          "https://acme.example/kyc?lang=de-CH",
+	}
+	blob, _ := rlp.EncodeToBytes(info)
+
+	state.AddKycProvider(provider)
+	state.SetKycProviderInfo(provider, blob)
+	state.Commit(false)
+
+	if have := state.GetKycProviderInfo(provider); !reflect.DeepEqual(have, info) {
+		t.Fatalf("provider info mismatch: have %+v, want %+v", have, info)
+	}
+	// Shorter metadata must not leave any trace of the longer one
+	short := &common.KycProviderInfo{Address: provider, Name: "Ω"}
+	blob, _ = rlp.EncodeToBytes(short)
+	state.SetKycProviderInfo(provider, blob)
+
+	if have := state.GetKycProviderInfoBlob(provider); !bytes.Equal(have, blob) {
+		t.Fatalf("shrunk provider info mismatch: have %x, want %x", have, blob)
+	}
+	if have := state.GetKycProviderInfo(provider); !reflect.DeepEqual(have, short) {
+		t.Fatalf("shrunk provider info mismatch: have %+v, want %+v", have, short)
+	}
+	// Removing the provider drops its metadata altogether
+	state.RemoveKycProvider(provider)
+	if have := state.GetKycProviderInfoBlob(provider); have != nil {
+		t.Errorf("provider info left after removal: %x", have)
+	}
+	if have, want := state.GetKycProviderInfo(provider), (&common.KycProviderInfo{Address: provider}); !reflect.DeepEqual(have, want) {
+		t.Errorf("removed provider info mismatch: have %+v, want %+v", have, want)
+	}
+	state.IntermediateRoot(false)
+	state.ForEachStorage(vm.KycContractAddress, func(key, value common.Hash) bool {
+		if prefix, addr, ok := splitAddressKey(key); ok && addr == provider && prefix >= kycProviderInfoKey && value != (common.Hash{}) {
+			t.Errorf("provider info slot %x left after removal: %x", key, value)
+		}
+		return true
+	})
+}
+
+// Tests that the KYC/DPoS invariant checks accept a consistent committed state
+// and reject one whose counters disagree with the slots they index.
+func TestVerifyKycDpos(t *testing.T) {
+	var (
+		providers = []common.Address{{0x01}, {0x02}, {0x03}}
+		producers = []common.Address{{0x11}, {0x12}}
+	)
+	tests := []struct {
+		name    string
+		corrupt func(*StateDB)
+		fail    bool
+	}{
+		{"consistent", func(*StateDB) {}, false},
+		{"provider count too high", func(s *StateDB) { s.SetKycProviderCount(int64(len(providers) + 1)) }, true},
+		{"provider count beyond slots", func(s *StateDB) { s.SetKycProviderCount(1 << 40) }, true},
+		{"provider count too low", func(s *StateDB) { s.SetKycProviderCount(int64(len(providers) - 1)) }, false},
+		{"provider listed twice", func(s *StateDB) {
+			s.SetState(vm.KycContractAddress, KycProviderKey(2), providers[0].Hash())
+		}, true},
+		{"producer count too high", func(s *StateDB) { s.SetDposProducerCount(big.NewInt(int64(len(producers) + 1))) }, true},
+		{"producer not registered", func(s *StateDB) {
+			s.SetState(vm.KycContractAddress, DposProducerKey(1), common.Address{0x13}.Hash())
+		}, true},
+		{"proposal queue reversed", func(s *StateDB) {
+			s.SetState(vm.KycContractAddress, kycProposalHeadKey, common.BigToHash(big.NewInt(2)))
+		}, true},
+		{"proposal queue overfull", func(s *StateDB) {
+			s.SetState(vm.KycContractAddress, kycProposalTailKey, common.BigToHash(big.NewInt(vm.KycMaxProposals+2)))
+		}, true},
+	}
+	for _, tt := range tests {
+		db, _ := wondb.NewMemDatabase()
+		state, _ := New(common.Hash{}, NewDatabase(db))
+
+		for _, provider := range providers {
+			state.AddKycProvider(provider)
+		}
+		for i := range producers {
+			state.RegisterProducer(&producers[i], "won://producer")
+		}
+		state.SetKycProviderProposol(common.Address{0x04}, big.NewInt(1), big.NewInt(1))
+		tt.corrupt(state)
+
+		root, _ := state.Commit(false)
+		state.Database().TrieDB().Commit(root, false)
+
+		// Verify a fresh copy of the committed state, as fast sync would
+		synced, err := New(root, NewDatabase(db))
+		if err != nil {
+			t.Fatalf("%s: failed to open state: %v", tt.name, err)
+		}
+		if err := synced.VerifyKycDpos(); (err != nil) != tt.fail {
+			t.Errorf("%s: verification mismatch: have %v, want failure %v", tt.name, err, tt.fail)
+		}
+	}
+}
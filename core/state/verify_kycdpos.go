@@ -0,0 +1,96 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package state
+
+import (
+	"fmt"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/trie"
+)
+
+// VerifyKycDpos checks the consistency of the counters of the KYC contract
+// storage with the slots they index: every provider and producer counted must
+// be stored, listed once and, for producers, registered, and the proposal queue
+// must be well formed.
+//
+// Unlike DumpKycDpos, it reads known slots only and needs no preimages, so it
+// can be run on a fast synced state.
+func (self *StateDB) VerifyKycDpos() error {
+	tr := self.StorageTrie(vm.KycContractAddress)
+	if tr == nil {
+		return nil
+	}
+	// Count the stored slots, none of the counters may exceed them
+	slots := int64(0)
+	it := trie.NewIterator(tr.NodeIterator(nil))
+	for it.Next() {
+		slots++
+	}
+	if it.Err != nil {
+		return it.Err
+	}
+	// Every provider counted must be stored exactly once
+	providers := self.GetKycProviderCount()
+	if providers < 0 || providers > slots {
+		return fmt.Errorf("kyc provider count %d exceeds the %d stored slots", providers, slots)
+	}
+	seen := make(map[common.Hash]int64)
+	for i := int64(0); i < providers; i++ {
+		provider := self.GetState(vm.KycContractAddress, KycProviderKey(i))
+		if provider == (common.Hash{}) {
+			return fmt.Errorf("kyc provider %d of %d missing", i, providers)
+		}
+		if j, ok := seen[provider]; ok {
+			return fmt.Errorf("kyc provider %x listed at both %d and %d", common.BytesToAddress(provider.Bytes()), j, i)
+		}
+		seen[provider] = i
+	}
+	// Every producer counted must be stored exactly once, and be registered
+	producerCount := self.GetDposProducerCount()
+	if !producerCount.IsInt64() || producerCount.Int64() > slots {
+		return fmt.Errorf("dpos producer count %v exceeds the %d stored slots", producerCount, slots)
+	}
+	producers := producerCount.Int64()
+
+	seen = make(map[common.Hash]int64)
+	for i := int64(0); i < producers; i++ {
+		producer := self.GetState(vm.KycContractAddress, DposProducerKey(i))
+		if producer == (common.Hash{}) {
+			return fmt.Errorf("dpos producer %d of %d missing", i, producers)
+		}
+		if j, ok := seen[producer]; ok {
+			return fmt.Errorf("dpos producer %x listed at both %d and %d", common.BytesToAddress(producer.Bytes()), j, i)
+		}
+		seen[producer] = i
+
+		addr := common.BytesToAddress(producer.Bytes())
+		if self.GetState(vm.KycContractAddress, common.AddressToHashWithPrefix(&addr, dposProducerURLKey)) == (common.Hash{}) {
+			return fmt.Errorf("dpos producer %x listed at %d but not registered", addr, i)
+		}
+	}
+	// The proposal queue may not run backwards nor hold more than the limit
+	head, tail := self.GetKycProviderProposolRange()
+	if head > tail {
+		return fmt.Errorf("kyc proposal queue head %d past its tail %d", head, tail)
+	}
+	if tail-head > vm.KycMaxProposals {
+		return fmt.Errorf("kyc proposal queue holds %d proposals, limit %d", tail-head, vm.KycMaxProposals)
+	}
+	return nil
+}
@@ -24,6 +24,7 @@ import (
 	"github.com/worldopennetwork/go-won/core/types"
 	"github.com/worldopennetwork/go-won/core/vm"
 	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/log"
 	"github.com/worldopennetwork/go-won/params"
 )
 
@@ -79,6 +80,13 @@ func (p *StateProcessor) Process(block *types.Block, statedb *state.StateDB, cfg
 	// Finalize the block, applying any consensus engine specific extras (e.g. block rewards)
 	p.engine.Finalize(p.bc, header, statedb, block.Transactions(), block.Uncles(), receipts)
 
+	// Collect the logs the engine emitted outside of any transaction. These are
+	// in no receipt, so they only reach the subscribers of the chain events.
+	for _, l := range statedb.GetLogs(common.Hash{}) {
+		l.BlockHash = block.Hash()
+		allLogs = append(allLogs, l)
+	}
+
 	return receipts, allLogs, *usedGas, nil
 }
 
@@ -97,10 +105,14 @@ func ApplyTransaction(config *params.ChainConfig, bc *BlockChain, author *common
 	// about the transaction and calling mechanisms.
 	vmenv := vm.NewEVM(context, statedb, config, cfg)
 	// Apply the transaction to the current state (included in the env)
-	_, gas, failed, err := ApplyMessage(vmenv, msg, gp)
+	_, gas, reason, err := ApplyMessageWithReason(vmenv, msg, gp)
 	if err != nil {
 		return nil, 0, err
 	}
+	failed := reason != nil
+	if failed {
+		log.Debug("Transaction execution failed", "hash", tx.Hash(), "err", reason)
+	}
 	// Update the state with pending changes
 	var root []byte
 	//	if config.IsByzantium(header.Number) {
@@ -115,6 +127,9 @@ func ApplyTransaction(config *params.ChainConfig, bc *BlockChain, author *common
 	receipt := types.NewReceipt(root, failed, *usedGas)
 	receipt.TxHash = tx.Hash()
 	receipt.GasUsed = gas
+	if config.IsKycReceipt(header.Number) {
+		receipt.KycError = kycErrorCode(reason)
+	}
 	// if the transaction created a contract, store the creation address in the receipt.
 	if msg.To() == nil {
 		receipt.ContractAddress = crypto.CreateAddress(vmenv.Context.Origin, tx.Nonce())
@@ -125,3 +140,21 @@ func ApplyTransaction(config *params.ChainConfig, bc *BlockChain, author *common
 
 	return receipt, gas, err
 }
+
+// kycErrorCode returns the KYC failure code receipts carry for a transaction
+// that failed with reason.
+func kycErrorCode(reason error) uint {
+	if err, ok := reason.(*KycError); ok {
+		if err.Recipient {
+			return types.KycErrorRecipient
+		}
+		return types.KycErrorSender
+	}
+	switch reason {
+	case ErrKycZoneRestricted:
+		return types.KycErrorZone
+	case ErrKycValidationFailed:
+		return types.KycErrorNested
+	}
+	return types.KycErrorNone
+}
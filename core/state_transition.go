@@ -17,6 +17,7 @@
 package core
 
 import (
+	"bytes"
 	"errors"
 	"math"
 	"math/big"
@@ -75,14 +76,15 @@ type Message interface {
 	Data() []byte
 }
 
-// IntrinsicGas computes the 'intrinsic gas' for a message with the given data.
-func IntrinsicGas(data []byte, contractCreation, homestead bool) (uint64, error) {
+// IntrinsicGas computes the 'intrinsic gas' for a message with the given data,
+// priced by the gas table in effect.
+func IntrinsicGas(data []byte, contractCreation bool, gt params.GasTable) (uint64, error) {
 	// Set the starting gas for the raw transaction
 	var gas uint64
-	if contractCreation && homestead {
-		gas = params.TxGasContractCreation
+	if contractCreation {
+		gas = gt.TxContractCreation
 	} else {
-		gas = params.TxGas
+		gas = gt.Tx
 	}
 	// Bump the required gas by the amount of transactional data
 	if len(data) > 0 {
@@ -94,16 +96,16 @@ func IntrinsicGas(data []byte, contractCreation, homestead bool) (uint64, error)
 			}
 		}
 		// Make sure we don't exceed uint64 for all data combinations
-		if (math.MaxUint64-gas)/params.TxDataNonZeroGas < nz {
+		if (math.MaxUint64-gas)/gt.TxDataNonZero < nz {
 			return 0, vm.ErrOutOfGas
 		}
-		gas += nz * params.TxDataNonZeroGas
+		gas += nz * gt.TxDataNonZero
 
 		z := uint64(len(data)) - nz
-		if (math.MaxUint64-gas)/params.TxDataZeroGas < z {
+		if (math.MaxUint64-gas)/gt.TxDataZero < z {
 			return 0, vm.ErrOutOfGas
 		}
-		gas += z * params.TxDataZeroGas
+		gas += z * gt.TxDataZero
 	}
 	return gas, nil
 }
@@ -132,6 +134,14 @@ func ApplyMessage(evm *vm.EVM, msg Message, gp *GasPool) ([]byte, uint64, bool,
 	return NewStateTransition(evm, msg, gp).TransitionDb()
 }
 
+// ApplyMessageWithReason is like ApplyMessage, but instead of only flagging a
+// failed execution it returns the reason of the failure. KYC rejections of the
+// message are reported as a *KycError (or ErrKycZoneRestricted and
+// ErrKycValidationFailed).
+func ApplyMessageWithReason(evm *vm.EVM, msg Message, gp *GasPool) ([]byte, uint64, error, error) {
+	return NewStateTransition(evm, msg, gp).transitionDb()
+}
+
 // to returns the recipient of the message.
 func (st *StateTransition) to() common.Address {
 	if st.msg == nil || st.msg.To() == nil /* contract creation */ {
@@ -181,30 +191,33 @@ func (st *StateTransition) preCheck() error {
 // returning the result including the the used gas. It returns an error if it
 // failed. An error indicates a consensus issue.
 func (st *StateTransition) TransitionDb() (ret []byte, usedGas uint64, failed bool, err error) {
+	ret, usedGas, vmerr, err := st.transitionDb()
+	return ret, usedGas, vmerr != nil, err
+}
+
+// transitionDb is the implementation of TransitionDb, returning the error the VM
+// failed with instead of a failure flag.
+func (st *StateTransition) transitionDb() (ret []byte, usedGas uint64, vmerr error, err error) {
 	if err = st.preCheck(); err != nil {
 		return
 	}
 	msg := st.msg
 	sender := vm.AccountRef(msg.From())
-	//homestead := st.evm.ChainConfig().IsHomestead(st.evm.BlockNumber)
 	contractCreation := msg.To() == nil
 
 	// Pay intrinsic gas
-	gas, err := IntrinsicGas(st.data, contractCreation, true /*homestead*/)
+	gas, err := IntrinsicGas(st.data, contractCreation, st.evm.ChainConfig().GasTable(st.evm.BlockNumber))
 	if err != nil {
-		return nil, 0, false, err
+		return nil, 0, nil, err
 	}
 	if err = st.useGas(gas); err != nil {
-		return nil, 0, false, err
+		return nil, 0, nil, err
 	}
 
-	var (
-		evm = st.evm
-		// vm errors do not effect consensus and are therefor
-		// not assigned to err, except for insufficient balance
-		// error.
-		vmerr error
-	)
+	// vm errors do not effect consensus and are therefor
+	// not assigned to err, except for insufficient balance
+	// error.
+	evm := st.evm
 	if contractCreation {
 		ret, _, st.gas, vmerr = evm.Create(sender, st.data, st.gas, st.value)
 	} else {
@@ -218,13 +231,53 @@ func (st *StateTransition) TransitionDb() (ret []byte, usedGas uint64, failed bo
 		// sufficient balance to make the transfer happen. The first
 		// balance transfer may never fail.
 		if vmerr == vm.ErrInsufficientBalance {
-			return nil, 0, false, vmerr
+			return nil, 0, nil, vmerr
+		}
+		if vmerr == vm.ErrTxKycValidateFailed {
+			vmerr = kycError(st.state, msg, st.evm.BlockNumber, st.evm.Time.Uint64(), st.evm.ChainConfig())
 		}
 	}
 	st.refundGas()
 	st.state.AddBalance(st.evm.Coinbase, new(big.Int).Mul(new(big.Int).SetUint64(st.gasUsed()), st.gasPrice))
 
-	return ret, st.gasUsed(), vmerr != nil, err
+	return ret, st.gasUsed(), vmerr, err
+}
+
+// kycError pinpoints the party of a message rejected by the KYC checks, or the
+// zone policy if both parties are verified on their own, falling back to
+// ErrKycValidationFailed if it was a nested call that got rejected.
+func kycError(statedb vm.StateDB, msg Message, number *big.Int, time uint64, config *params.ChainConfig) error {
+	// The zero address and the precompiles are always accepted, so use them as
+	// counterparties to check each side on its own
+	from, value := msg.From(), msg.Value()
+	if !statedb.TxKycValidate(from, common.Address{}, value, number, time, config) {
+		return &KycError{Address: from}
+	}
+	if msg.To() == nil {
+		return ErrKycValidationFailed
+	}
+	to := *msg.To()
+	if !statedb.TxKycValidate(vm.KycContractAddress, to, value, number, time, config) {
+		return &KycError{Address: to, Recipient: true}
+	}
+	if !statedb.TxKycValidate(from, to, value, number, time, config) {
+		return ErrKycZoneRestricted
+	}
+	// Token transfers are checked against the token recipient and amount too
+	data := msg.Data()
+	if len(data) == 68 && statedb.GetCodeSize(to) != 0 && bytes.Equal(data[:16], []byte{0xa9, 0x05, 0x9c, 0xbb, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}) {
+		recipient, amount := common.BytesToAddress(data[16:36]), common.BytesToHash(data[36:]).Big()
+		if !statedb.TxKycValidate(from, common.Address{}, amount, number, time, config) {
+			return &KycError{Address: from}
+		}
+		if !statedb.TxKycValidate(vm.KycContractAddress, recipient, amount, number, time, config) {
+			return &KycError{Address: recipient, Recipient: true}
+		}
+		if !statedb.TxKycValidate(from, recipient, amount, number, time, config) {
+			return ErrKycZoneRestricted
+		}
+	}
+	return ErrKycValidationFailed
 }
 
 func (st *StateTransition) refundGas() {
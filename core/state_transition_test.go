@@ -0,0 +1,221 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package core
+
+import (
+	"math/big"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// Tests that transfers between a restricted pair of zones are rejected by both
+// the state transition and the transaction pool, in the restricted direction
+// only, while an empty zone policy doesn't restrict anything.
+func TestKycZoneRestriction(t *testing.T) {
+	var (
+		provider = common.Address{0xff}
+		from     = common.Address{0x01}
+		to       = common.Address{0x02}
+	)
+	setup := func(statedb *state.StateDB) {
+		statedb.AddKycProvider(provider)
+		for addr, zone := range map[common.Address]uint32{from: 10, to: 20} {
+			statedb.SetKycProvider(addr, provider)
+			statedb.SetKycLevel(addr, 1)
+			statedb.SetKycZone(addr, zone)
+			statedb.AddBalance(addr, big.NewInt(1000000000))
+		}
+	}
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	setup(statedb)
+
+	transfer := func(sender, recipient common.Address) error {
+		msg := types.NewMessage(sender, &recipient, statedb.GetNonce(sender), big.NewInt(100), 100000, new(big.Int), nil, true)
+		context := vm.Context{
+			CanTransfer: CanTransfer,
+			Transfer:    Transfer,
+			Origin:      sender,
+			BlockNumber: big.NewInt(1),
+			Time:        big.NewInt(1000),
+			Difficulty:  new(big.Int),
+			GasLimit:    1000000,
+			GasPrice:    new(big.Int),
+		}
+		evm := vm.NewEVM(context, statedb, params.TestChainConfig, vm.Config{})
+		_, _, vmerr, err := ApplyMessageWithReason(evm, msg, new(GasPool).AddGas(1000000))
+		if err != nil {
+			t.Fatalf("failed to apply message: %v", err)
+		}
+		return vmerr
+	}
+	if err := transfer(from, to); err != nil {
+		t.Fatalf("transfer without zone policy failed: %v", err)
+	}
+	statedb.SetKycZoneRestricted(10, 20, true)
+	if err := transfer(from, to); err != ErrKycZoneRestricted {
+		t.Errorf("restricted transfer error mismatch: have %v, want %v", err, ErrKycZoneRestricted)
+	}
+	if err := transfer(to, from); err != nil {
+		t.Errorf("transfer in the unrestricted direction failed: %v", err)
+	}
+	if err := transfer(from, provider); err != nil {
+		t.Errorf("transfer to provider failed: %v", err)
+	}
+	statedb.SetKycZoneRestricted(10, 20, false)
+	if err := transfer(from, to); err != nil {
+		t.Errorf("transfer after lifting the restriction failed: %v", err)
+	}
+	// The pool rejects restricted transfers up front
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	from = crypto.PubkeyToAddress(key.PublicKey)
+	setup(pool.currentState)
+	pool.currentState.SetKycZoneRestricted(10, 20, true)
+
+	tx, _ := types.SignTx(types.NewTransaction(0, to, big.NewInt(100), 100000, big.NewInt(int64(params.GasPrice)), nil), types.HomesteadSigner{}, key)
+	if err := pool.AddRemote(tx); err != ErrKycRequired {
+		t.Errorf("pool error mismatch: have %v, want %v", err, ErrKycRequired)
+	}
+	pool.currentState.SetKycZoneRestricted(10, 20, false)
+	if err := pool.AddRemote(tx); err != nil {
+		t.Errorf("failed to add transaction after lifting the restriction: %v", err)
+	}
+}
+
+// Tests that receipts carry the KYC failure code of transactions rejected by the
+// KYC checks from the KYC receipt fork on only.
+func TestKycErrorReceipt(t *testing.T) {
+	var (
+		key, _    = crypto.GenerateKey()
+		sender    = crypto.PubkeyToAddress(key.PublicKey)
+		provider  = common.Address{0xff}
+		verified  = common.Address{0x01}
+		forked    = *params.TestChainConfig
+		unforked  = *params.TestChainConfig
+		forkBlock = big.NewInt(2)
+	)
+	forked.KycReceiptBlock, unforked.KycReceiptBlock = forkBlock, nil
+
+	tests := []struct {
+		config   *params.ChainConfig
+		number   int64
+		verify   bool
+		to       common.Address
+		kycError uint
+	}{
+		{&forked, 2, false, verified, types.KycErrorSender},
+		{&forked, 3, true, common.Address{0x02}, types.KycErrorRecipient},
+		{&forked, 3, true, verified, types.KycErrorNone},
+		{&forked, 1, false, verified, types.KycErrorNone},
+		{&unforked, 3, false, verified, types.KycErrorNone},
+	}
+	for i, tt := range tests {
+		db, _ := wondb.NewMemDatabase()
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+		statedb.AddKycProvider(provider)
+		statedb.SetKycProvider(verified, provider)
+		statedb.SetKycLevel(verified, 1)
+		if tt.verify {
+			statedb.SetKycProvider(sender, provider)
+			statedb.SetKycLevel(sender, 1)
+		}
+		statedb.AddBalance(sender, big.NewInt(1000000000))
+
+		header := &types.Header{Number: big.NewInt(tt.number), Time: big.NewInt(1000), Difficulty: new(big.Int), GasLimit: 1000000}
+		tx, _ := types.SignTx(types.NewTransaction(0, tt.to, big.NewInt(100), 100000, big.NewInt(int64(params.GasPrice)), nil), types.HomesteadSigner{}, key)
+
+		receipt, _, err := ApplyTransaction(tt.config, nil, &common.Address{}, new(GasPool).AddGas(1000000), statedb, header, tx, new(uint64), vm.Config{})
+		if err != nil {
+			t.Fatalf("test %d: failed to apply transaction: %v", i, err)
+		}
+		if receipt.KycError != tt.kycError {
+			t.Errorf("test %d: KYC failure code mismatch: have %d, want %d", i, receipt.KycError, tt.kycError)
+		}
+		if failed := receipt.Status == types.ReceiptStatusFailed; failed != (!tt.verify || tt.to != verified) {
+			t.Errorf("test %d: receipt status mismatch: have %d", i, receipt.Status)
+		}
+	}
+}
+
+// Tests that the intrinsic gas of transactions is priced by the gas table of the
+// repricing in effect, on either side of the repricing block.
+func TestIntrinsicGasRepricing(t *testing.T) {
+	repriced := params.GasTableHomestead
+	repriced.Tx, repriced.TxContractCreation = 30000, 60000
+	repriced.TxDataZero, repriced.TxDataNonZero = 2, 100
+
+	config := *params.TestChainConfig
+	config.GasRepricings = []params.GasRepricing{{Block: big.NewInt(5), Table: repriced}}
+
+	data := []byte{0x00, 0x01, 0x02}
+	tests := []struct {
+		number   int64
+		creation bool
+		want     uint64
+	}{
+		{4, false, params.TxGas + params.TxDataZeroGas + 2*params.TxDataNonZeroGas},
+		{4, true, params.TxGasContractCreation + params.TxDataZeroGas + 2*params.TxDataNonZeroGas},
+		{5, false, 30000 + 2 + 2*100},
+		{5, true, 60000 + 2 + 2*100},
+		{6, false, 30000 + 2 + 2*100},
+	}
+	for i, tt := range tests {
+		gas, err := IntrinsicGas(data, tt.creation, config.GasTable(big.NewInt(tt.number)))
+		if err != nil {
+			t.Fatalf("test %d: failed to compute intrinsic gas: %v", i, err)
+		}
+		if gas != tt.want {
+			t.Errorf("test %d: intrinsic gas mismatch: have %d, want %d", i, gas, tt.want)
+		}
+		if tt.creation {
+			continue
+		}
+		// The state transition charges the same intrinsic gas for a plain transfer
+		db, _ := wondb.NewMemDatabase()
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+		statedb.AddBalance(common.Address{0x01}, big.NewInt(1000000000))
+
+		to := common.Address{0x02}
+		msg := types.NewMessage(common.Address{0x01}, &to, 0, new(big.Int), 100000, new(big.Int), data, false)
+		context := vm.Context{
+			CanTransfer: CanTransfer,
+			Transfer:    Transfer,
+			BlockNumber: big.NewInt(tt.number),
+			Time:        big.NewInt(1000),
+			Difficulty:  new(big.Int),
+			GasLimit:    1000000,
+			GasPrice:    new(big.Int),
+		}
+		evm := vm.NewEVM(context, statedb, &config, vm.Config{})
+		_, used, _, err := ApplyMessage(evm, msg, new(GasPool).AddGas(1000000))
+		if err != nil {
+			t.Fatalf("test %d: failed to apply message: %v", i, err)
+		}
+		if used != tt.want {
+			t.Errorf("test %d: used gas mismatch: have %d, want %d", i, used, tt.want)
+		}
+	}
+}
@@ -243,15 +243,20 @@ func (l *txList) Overlaps(tx *types.Transaction) bool {
 	return l.txs.Get(tx.Nonce()) != nil
 }
 
+// replacePolicy reports whether tx may replace old, both having the same nonce,
+// even though it doesn't meet the price bump required otherwise.
+type replacePolicy func(old, tx *types.Transaction) bool
+
 // Add tries to insert a new transaction into the list, returning whether the
 // transaction was accepted, and if yes, any previous transaction it replaced.
+// An optional replace policy may allow replacements short of the price bump.
 //
 // If the new transaction is accepted into the list, the lists' cost and gas
 // thresholds are also potentially updated.
-func (l *txList) Add(tx *types.Transaction, priceBump uint64) (bool, *types.Transaction) {
+func (l *txList) Add(tx *types.Transaction, priceBump uint64, replace replacePolicy) (bool, *types.Transaction) {
 	// If there's an older better transaction, abort
 	old := l.txs.Get(tx.Nonce())
-	if old != nil {
+	if old != nil && (replace == nil || !replace(old, tx)) {
 		threshold := new(big.Int).Div(new(big.Int).Mul(old.GasPrice(), big.NewInt(100+int64(priceBump))), big.NewInt(100))
 		// Have to ensure that the new gas price is higher than the old gas
 		// price as well as checking the percentage threshold to ensure that
@@ -298,19 +303,32 @@ func (l *txList) Filter(costLimit *big.Int, gasLimit uint64) (types.Transactions
 	// Filter out all the transactions above the account's funds
 	removed := l.txs.Filter(func(tx *types.Transaction) bool { return tx.Cost().Cmp(costLimit) > 0 || tx.Gas() > gasLimit })
 
-	// If the list was strict, filter anything above the lowest nonce
-	var invalids types.Transactions
+	return removed, l.invalidate(removed)
+}
+
+// Reject removes all transactions from the list matching the given filter, such
+// as ones no longer permitted by the current state, irrespective of the caps.
+// Every removed transaction is returned, together with any follow-up ones that
+// became unexecutable in a strict list (same as with Filter).
+func (l *txList) Reject(filter func(*types.Transaction) bool) (types.Transactions, types.Transactions) {
+	removed := l.txs.Filter(filter)
 
-	if l.strict && len(removed) > 0 {
-		lowest := uint64(math.MaxUint64)
-		for _, tx := range removed {
-			if nonce := tx.Nonce(); lowest > nonce {
-				lowest = nonce
-			}
+	return removed, l.invalidate(removed)
+}
+
+// invalidate removes and returns all the transactions above the lowest nonce of
+// a removed batch if the list is strict, as those can't be executed anymore.
+func (l *txList) invalidate(removed types.Transactions) types.Transactions {
+	if !l.strict || len(removed) == 0 {
+		return nil
+	}
+	lowest := uint64(math.MaxUint64)
+	for _, tx := range removed {
+		if nonce := tx.Nonce(); lowest > nonce {
+			lowest = nonce
 		}
-		invalids = l.txs.Filter(func(tx *types.Transaction) bool { return tx.Nonce() > lowest })
 	}
-	return removed, invalids
+	return l.txs.Filter(func(tx *types.Transaction) bool { return tx.Nonce() > lowest })
 }
 
 // Cap places a hard limit on the number of items, returning all transactions
@@ -397,17 +415,28 @@ func (h *priceHeap) Pop() interface{} {
 // txPricedList is a price-sorted heap to allow operating on transactions pool
 // contents in a price-incrementing way.
 type txPricedList struct {
-	all    *map[common.Hash]*types.Transaction // Pointer to the map of all transactions
-	items  *priceHeap                          // Heap of prices of all the stored transactions
-	stales int                                 // Number of stale price points to (re-heap trigger)
+	all      *map[common.Hash]*types.Transaction // Pointer to the map of all transactions
+	reserved *map[common.Hash]*types.Transaction // Pointer to the map of transactions exempt from pricing
+	items    *priceHeap                          // Heap of prices of all the stored transactions
+	stales   int                                 // Number of stale price points to (re-heap trigger)
 }
 
 // newTxPricedList creates a new price-sorted transaction heap.
-func newTxPricedList(all *map[common.Hash]*types.Transaction) *txPricedList {
+func newTxPricedList(all, reserved *map[common.Hash]*types.Transaction) *txPricedList {
 	return &txPricedList{
-		all:   all,
-		items: new(priceHeap),
+		all:      all,
+		reserved: reserved,
+		items:    new(priceHeap),
+	}
+}
+
+// exempt reports whether a transaction is kept regardless of its price, being
+// local or holding a reserved slot.
+func (l *txPricedList) exempt(tx *types.Transaction, local *accountSet) bool {
+	if _, ok := (*l.reserved)[tx.Hash()]; ok {
+		return true
 	}
+	return local.containsTx(tx)
 }
 
 // Put inserts a new transaction into the heap.
@@ -452,8 +481,8 @@ func (l *txPricedList) Cap(threshold *big.Int, local *accountSet) types.Transact
 			save = append(save, tx)
 			break
 		}
-		// Non stale transaction found, discard unless local
-		if local.containsTx(tx) {
+		// Non stale transaction found, discard unless local or reserved
+		if l.exempt(tx, local) {
 			save = append(save, tx)
 		} else {
 			drop = append(drop, tx)
@@ -504,8 +533,8 @@ func (l *txPricedList) Discard(count int, local *accountSet) types.Transactions
 			l.stales--
 			continue
 		}
-		// Non stale transaction found, discard unless local
-		if local.containsTx(tx) {
+		// Non stale transaction found, discard unless local or reserved
+		if l.exempt(tx, local) {
 			save = append(save, tx)
 		} else {
 			drop = append(drop, tx)
@@ -85,7 +85,9 @@ var (
 	// making the transaction invalid, rather a DOS protection.
 	ErrOversizedData = errors.New("oversized data")
 
-	ErrTxKycValidateFailed = errors.New("Tx KYC validate failed")
+	// ErrKycRequired is returned if KYC providers are registered, and either the
+	// sender or a recipient of the transaction is not KYC verified by any of them.
+	ErrKycRequired = errors.New("sender or recipient not KYC verified")
 
 	ErrKycConflict    = errors.New("this address had do kyc by another provider")
 	ErrKycForContract = errors.New("can not call from and for contract address")
@@ -148,6 +150,9 @@ type TxPoolConfig struct {
 	AccountQueue uint64 // Maximum number of non-executable transaction slots permitted per account
 	GlobalQueue  uint64 // Maximum number of non-executable transaction slots for all accounts
 
+	GovernanceSlots uint64 // Number of slots reserved for KYC governance transactions of providers and producers
+	StakingReplace  bool   // Whether staking transactions may be corrected by a same priced replacement
+
 	Lifetime time.Duration // Maximum amount of time non-executable transaction are queued
 }
 
@@ -165,6 +170,8 @@ var DefaultTxPoolConfig = TxPoolConfig{
 	AccountQueue: 64,
 	GlobalQueue:  1024,
 
+	GovernanceSlots: 64,
+
 	Lifetime: 3 * time.Hour,
 }
 
@@ -209,6 +216,8 @@ type TxPool struct {
 	currentState  *state.StateDB      // Current state in the blockchain head
 	pendingState  *state.ManagedState // Pending state tracking virtual nonces
 	currentMaxGas uint64              // Current gas limit for transaction caps
+	currentTime   uint64              // Current head time for KYC expiry checks
+	pendingNumber *big.Int            // Number of the next block for fork dependent checks
 
 	locals  *accountSet // Set of local transaction to exempt from eviction rules
 	journal *txJournal  // Journal of local transaction to back up to disk
@@ -219,9 +228,12 @@ type TxPool struct {
 	all     map[common.Hash]*types.Transaction // All transactions to allow lookups
 	priced  *txPricedList                      // All transactions sorted by price
 
+	reserved map[common.Hash]*types.Transaction // Governance transactions holding a reserved slot
+	replace  replacePolicy                      // Replacements allowed short of the price bump, if any
+
 	wg sync.WaitGroup // for shutdown sync
 
-	homestead bool
+	gasTable params.GasTable // Gas prices of the next block
 }
 
 // NewTxPool creates a new transaction pool to gather, sort and filter inbound
@@ -240,11 +252,15 @@ func NewTxPool(config TxPoolConfig, chainconfig *params.ChainConfig, chain block
 		queue:       make(map[common.Address]*txList),
 		beats:       make(map[common.Address]time.Time),
 		all:         make(map[common.Hash]*types.Transaction),
+		reserved:    make(map[common.Hash]*types.Transaction),
 		chainHeadCh: make(chan ChainHeadEvent, chainHeadChanSize),
 		gasPrice:    new(big.Int).SetUint64(config.PriceLimit),
 	}
+	if config.StakingReplace {
+		pool.replace = stakingReplace
+	}
 	pool.locals = newAccountSet(pool.signer)
-	pool.priced = newTxPricedList(&pool.all)
+	pool.priced = newTxPricedList(&pool.all, &pool.reserved)
 	pool.reset(nil, chain.CurrentBlock().Header())
 
 	// If local transactions and journaling is enabled, load from disk
@@ -296,9 +312,6 @@ func (pool *TxPool) loop() {
 		case ev := <-pool.chainHeadCh:
 			if ev.Block != nil {
 				pool.mu.Lock()
-				//if pool.chainconfig.IsHomestead(ev.Block.Number()) {
-				pool.homestead = true
-				//}
 				pool.reset(head.Header(), ev.Block.Header())
 				head = ev.Block
 
@@ -421,6 +434,9 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	pool.currentState = statedb
 	pool.pendingState = state.ManageState(statedb)
 	pool.currentMaxGas = newHead.GasLimit
+	pool.pendingNumber = new(big.Int).Add(newHead.Number, big.NewInt(1))
+	pool.gasTable = pool.chainconfig.GasTable(pool.pendingNumber)
+	pool.currentTime = newHead.Time.Uint64()
 
 	// Inject any transactions discarded due to reorgs
 	log.Debug("Reinjecting stale transactions", "count", len(reinject))
@@ -432,6 +448,10 @@ func (pool *TxPool) reset(oldHead, newHead *types.Header) {
 	// higher gas price)
 	pool.demoteUnexecutables()
 
+	// Release the reserved slots of transactions gone or whose sender lost its
+	// provider or producer role
+	pool.pruneReserved(true)
+
 	// Update all accounts to the latest known pending nonce
 	for addr, list := range pool.pending {
 		txs := list.Flatten() // Heavy but will be cached and is needed by the miner anyway
@@ -562,6 +582,38 @@ func (pool *TxPool) local() map[common.Address]types.Transactions {
 	return txs
 }
 
+// validateKyc checks whether the sender and the recipients of a transaction are
+// KYC verified in the current state, if any KYC provider is registered at all.
+// As providers and levels can change, the check is redone on every new head.
+func (pool *TxPool) validateKyc(from common.Address, tx *types.Transaction) error {
+	to := common.Address{}
+	if tx.To() != nil {
+		to = *tx.To()
+	}
+	if !pool.currentState.TxKycValidate(from, to, tx.Cost(), pool.pendingNumber, pool.currentTime, pool.chainconfig) {
+		return ErrKycRequired
+	}
+
+	//for transfer
+	//"0xa9059cbb000000000000000000000000827a30031717ba622f9b01d5e3a24c6b9f3133310000000000000000000000000000000000000000000000000000000000000001"
+	//a9059cbb000000000000000000000000      :16
+	//827a30031717ba622f9b01d5e3a24c6b9f313331  : 20
+	//0000000000000000000000000000000000000000000000000000000000000001 :32
+	if tx.To() != nil && len(tx.Data()) == 68 && pool.currentState.GetCodeSize(to) != 0 {
+		methdef := tx.Data()[0:16]
+		//check if a transfer to an address
+		if bytes.Compare(methdef, []byte{0xa9, 0x05, 0x9c, 0xbb, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}) == 0 {
+			addressTo := common.BytesToAddress(tx.Data()[16:36])
+			hs := common.BytesToHash(tx.Data()[36:])
+			tokenCost := hs.Big()
+			if !pool.currentState.TxKycValidate(from, addressTo, tokenCost, pool.pendingNumber, pool.currentTime, pool.chainconfig) {
+				return ErrKycRequired
+			}
+		}
+	}
+	return nil
+}
+
 // validateTx checks whether a transaction is valid according to the consensus
 // rules and adheres to some heuristic limits of the local node (price and size).
 func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
@@ -603,35 +655,11 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 		return ErrGasPriceLimit
 	}
 
-	pto := tx.To()
-	toAddr := common.Address{}
-	if pto != nil {
-		toAddr = *pto
-	}
-
-	if !pool.currentState.TxKycValidate(from, toAddr, tx.Cost()) {
-		return ErrTxKycValidateFailed
-	}
-
-	//for transfer
-	//"0xa9059cbb000000000000000000000000827a30031717ba622f9b01d5e3a24c6b9f3133310000000000000000000000000000000000000000000000000000000000000001"
-	//a9059cbb000000000000000000000000      :16
-	//827a30031717ba622f9b01d5e3a24c6b9f313331  : 20
-	//0000000000000000000000000000000000000000000000000000000000000001 :32
-	if tx.Data() != nil && len(tx.Data()) == 68 && pool.currentState.GetCodeSize(*tx.To()) != 0 {
-		methdef := tx.Data()[0:16]
-		//check if a transfer to an address
-		if bytes.Compare(methdef, []byte{0xa9, 0x05, 0x9c, 0xbb, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}) == 0 {
-			addressTo := common.BytesToAddress(tx.Data()[16:36])
-			hs := common.BytesToHash(tx.Data()[36:])
-			tokenCost := hs.Big()
-			if !pool.currentState.TxKycValidate(from, addressTo, tokenCost) {
-				return ErrTxKycValidateFailed
-			}
-		}
+	if err := pool.validateKyc(from, tx); err != nil {
+		return err
 	}
 
-	intrGas, err := IntrinsicGas(tx.Data(), tx.To() == nil, pool.homestead)
+	intrGas, err := IntrinsicGas(tx.Data(), tx.To() == nil, pool.gasTable)
 	if err != nil {
 		return err
 	}
@@ -639,9 +667,10 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 		return ErrIntrinsicGas
 	}
 
-	//check for dpos inc/dec stake the value is in input data
-	if tx.To() != nil && (*tx.To() == vm.KycContractAddress) && len(tx.Data()) == 36 {
-		input := tx.Data()
+	//check for dpos inc/dec stake the value is in input data, chain bound calls
+	//by their arguments alone
+	input, _ := vm.SplitKycInput(tx.Data())
+	if tx.To() != nil && (*tx.To() == vm.KycContractAddress) && len(input) == 36 {
 		funcid := binary.BigEndian.Uint32(input[0:4])
 		value := common.BytesToHash(input[4:]).Big()
 		if funcid == vm.DposMethodAddStake {
@@ -657,8 +686,7 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 			}
 		}
 
-	} else if tx.To() != nil && (*tx.To() == vm.KycContractAddress) && len(tx.Data()) == 32 {
-		input := tx.Data()
+	} else if tx.To() != nil && (*tx.To() == vm.KycContractAddress) && len(input) >= 32 {
 		funcid := binary.BigEndian.Uint32(input[0:4])
 		address := common.BytesToAddress(input[4:24])
 
@@ -671,8 +699,7 @@ func (pool *TxPool) validateTx(tx *types.Transaction, local bool) error {
 		if pd := pool.currentState.GetKycProvider(address); funcid == vm.KycMethodSet && pd != (common.Address{}) && pd != from {
 			return ErrKycConflict
 		}
-	} else if tx.To() != nil && (*tx.To() == vm.KycContractAddress) && len(tx.Data()) == 6 {
-		input := tx.Data()
+	} else if tx.To() != nil && (*tx.To() == vm.KycContractAddress) && len(input) >= 6 {
 		funcid := binary.BigEndian.Uint32(input[0:4])
 
 		if funcid == vm.KycMethodVote && pool.currentState.IsContractAddress(from) {
@@ -704,8 +731,15 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 		invalidTxCounter.Inc(1)
 		return false, err
 	}
+	from, _ := types.Sender(pool.signer, tx) // already validated
+
+	// Governance transactions take a reserved slot while any is free, others
+	// share the rest of the pool
+	pool.pruneReserved(false)
+	reserved := uint64(len(pool.reserved)) < pool.config.GovernanceSlots && pool.isGovernanceTx(from, tx)
+
 	// If the transaction pool is full, discard underpriced transactions
-	if uint64(len(pool.all)) >= pool.config.GlobalSlots+pool.config.GlobalQueue {
+	if size := len(pool.all) - len(pool.reserved); !reserved && uint64(size) >= pool.config.GlobalSlots+pool.config.GlobalQueue {
 		// If the new transaction is underpriced, don't accept it
 		if pool.priced.Underpriced(tx, pool.locals) {
 			log.Trace("Discarding underpriced transaction", "hash", hash, "price", tx.GasPrice())
@@ -713,7 +747,7 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 			return false, ErrUnderpriced
 		}
 		// New transaction is better than our worse ones, make room for it
-		drop := pool.priced.Discard(len(pool.all)-int(pool.config.GlobalSlots+pool.config.GlobalQueue-1), pool.locals)
+		drop := pool.priced.Discard(size-int(pool.config.GlobalSlots+pool.config.GlobalQueue-1), pool.locals)
 		for _, tx := range drop {
 			log.Trace("Discarding freshly underpriced transaction", "hash", tx.Hash(), "price", tx.GasPrice())
 			underpricedTxCounter.Inc(1)
@@ -721,10 +755,9 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 		}
 	}
 	// If the transaction is replacing an already pending one, do directly
-	from, _ := types.Sender(pool.signer, tx) // already validated
 	if list := pool.pending[from]; list != nil && list.Overlaps(tx) {
 		// Nonce already pending, check if required price bump is met
-		inserted, old := list.Add(tx, pool.config.PriceBump)
+		inserted, old := list.Add(tx, pool.config.PriceBump, pool.replace)
 		if !inserted {
 			pendingDiscardCounter.Inc(1)
 			return false, ErrReplaceUnderpriced
@@ -738,7 +771,9 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 		pool.all[tx.Hash()] = tx
 		pool.priced.Put(tx)
 		pool.journalTx(from, tx)
-
+		if reserved {
+			pool.reserved[hash] = tx
+		}
 		log.Trace("Pooled new executable transaction", "hash", hash, "from", from, "to", tx.To())
 
 		// We've directly injected a replacement transaction, notify subsystems
@@ -756,11 +791,82 @@ func (pool *TxPool) add(tx *types.Transaction, local bool) (bool, error) {
 		pool.locals.add(from)
 	}
 	pool.journalTx(from, tx)
-
+	if reserved {
+		pool.reserved[hash] = tx
+	}
 	log.Trace("Pooled new future transaction", "hash", hash, "from", from, "to", tx.To())
 	return replace, nil
 }
 
+// stakingMethods are the methods of the KYC precompile managing the stake and
+// votes of a voter, which may be corrected by a same priced replacement.
+var stakingMethods = map[uint32]bool{
+	vm.DposMethodAddStake:   true,
+	vm.DposMethodSubStake:   true,
+	vm.DposMethodProdsVote:  true,
+	vm.DposMethodAddVote:    true,
+	vm.DposMethodRemoveVote: true,
+	vm.DposMethodSetProxy:   true,
+}
+
+// stakingReplace allows a staking transaction to replace another one of the same
+// nonce and price, as long as both call the same staking method and only their
+// arguments differ, e.g. a corrected vote list. Wallets reuse the nonce and the
+// fixed price of the chain to amend a stake, which no price bump could allow.
+//
+// The policy is pool-only and consensus neutral: whichever of the two ends up in
+// a block, it is executed by the same rules as any other transaction.
+func stakingReplace(old, tx *types.Transaction) bool {
+	if old.To() == nil || *old.To() != vm.KycContractAddress || tx.To() == nil || *tx.To() != vm.KycContractAddress {
+		return false
+	}
+	oldInput, _ := vm.SplitKycInput(old.Data())
+	input, _ := vm.SplitKycInput(tx.Data())
+	if old.GasPrice().Cmp(tx.GasPrice()) != 0 || len(oldInput) < 4 || len(input) < 4 {
+		return false
+	}
+	funcid := binary.BigEndian.Uint32(oldInput[:4])
+	if !stakingMethods[funcid] || funcid != binary.BigEndian.Uint32(input[:4]) {
+		return false
+	}
+	return !bytes.Equal(old.Data(), tx.Data())
+}
+
+// isGovernanceTx reports whether tx is a KYC governance transaction entitled to
+// a reserved slot, being sent to the KYC precompile by a current KYC provider or
+// an active producer.
+func (pool *TxPool) isGovernanceTx(from common.Address, tx *types.Transaction) bool {
+	if tx.To() == nil || *tx.To() != vm.KycContractAddress {
+		return false
+	}
+	// Anyone is a provider while there are none, so only ask once there are some
+	if pool.currentState.GetKycProviderCount() > 0 && pool.currentState.KycProviderExists(from) {
+		return true
+	}
+	info := pool.currentState.GetProducerInfo(&from)
+	return info != nil && info.IsActive
+}
+
+// pruneReserved releases the reserved slots of the transactions no longer in the
+// pool and, if revalidate is set, of those no longer entitled to one. The latter
+// stay in the pool, competing for the shared slots from now on.
+//
+// Note, this method assumes the pool lock is held!
+func (pool *TxPool) pruneReserved(revalidate bool) {
+	for hash, tx := range pool.reserved {
+		if pool.all[hash] == nil {
+			delete(pool.reserved, hash)
+			continue
+		}
+		if revalidate {
+			if from, _ := types.Sender(pool.signer, tx); !pool.isGovernanceTx(from, tx) {
+				log.Trace("Released reserved slot of transaction", "hash", hash)
+				delete(pool.reserved, hash)
+			}
+		}
+	}
+}
+
 // enqueueTx inserts a new transaction into the non-executable transaction queue.
 //
 // Note, this method assumes the pool lock is held!
@@ -770,7 +876,7 @@ func (pool *TxPool) enqueueTx(hash common.Hash, tx *types.Transaction) (bool, er
 	if pool.queue[from] == nil {
 		pool.queue[from] = newTxList(false)
 	}
-	inserted, old := pool.queue[from].Add(tx, pool.config.PriceBump)
+	inserted, old := pool.queue[from].Add(tx, pool.config.PriceBump, pool.replace)
 	if !inserted {
 		// An older transaction was better, discard this
 		queuedDiscardCounter.Inc(1)
@@ -811,7 +917,7 @@ func (pool *TxPool) promoteTx(addr common.Address, hash common.Hash, tx *types.T
 	}
 	list := pool.pending[addr]
 
-	inserted, old := list.Add(tx, pool.config.PriceBump)
+	inserted, old := list.Add(tx, pool.config.PriceBump, pool.replace)
 	if !inserted {
 		// An older transaction was better, discard this
 		delete(pool.all, hash)
@@ -1025,6 +1131,14 @@ func (pool *TxPool) promoteExecutables(accounts []common.Address) {
 			pool.priced.Removed()
 			queuedNofundsCounter.Inc(1)
 		}
+		// Drop all transactions no longer passing the KYC checks
+		drops, _ = list.Reject(func(tx *types.Transaction) bool { return pool.validateKyc(addr, tx) != nil })
+		for _, tx := range drops {
+			hash := tx.Hash()
+			log.Trace("Removed non-KYC queued transaction", "hash", hash)
+			delete(pool.all, hash)
+			pool.priced.Removed()
+		}
 		// Gather all executable transactions and promote them
 		for _, tx := range list.Ready(pool.pendingState.GetNonce(addr)) {
 			hash := tx.Hash()
@@ -1188,6 +1302,19 @@ func (pool *TxPool) demoteUnexecutables() {
 			log.Trace("Demoting pending transaction", "hash", hash)
 			pool.enqueueTx(hash, tx)
 		}
+		// Drop all transactions no longer passing the KYC checks, and queue any invalids back for later
+		drops, invalids = list.Reject(func(tx *types.Transaction) bool { return pool.validateKyc(addr, tx) != nil })
+		for _, tx := range drops {
+			hash := tx.Hash()
+			log.Trace("Removed non-KYC pending transaction", "hash", hash)
+			delete(pool.all, hash)
+			pool.priced.Removed()
+		}
+		for _, tx := range invalids {
+			hash := tx.Hash()
+			log.Trace("Demoting pending transaction", "hash", hash)
+			pool.enqueueTx(hash, tx)
+		}
 		// If there's a gap in front, warn (should never happen) and postpone all transactions
 		if list.Len() > 0 && list.txs.Get(nonce) == nil {
 			for _, tx := range list.Cap(0) {
@@ -29,6 +29,8 @@ import (
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/core/state"
 	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/core/vm/kycabi"
 	"github.com/worldopennetwork/go-won/crypto"
 	"github.com/worldopennetwork/go-won/event"
 	"github.com/worldopennetwork/go-won/params"
@@ -1840,3 +1842,257 @@ func benchmarkPoolBatchInsert(b *testing.B, size int) {
 		pool.AddRemotes(batch)
 	}
 }
+
+// Tests that transactions are only admitted into the pool if both their sender
+// and recipient are KYC verified whenever KYC providers are registered, and that
+// pooled transactions are dropped once the verification is revoked.
+func TestTransactionKycRequired(t *testing.T) {
+	t.Parallel()
+
+	pool, key := setupTxPool()
+	defer pool.Stop()
+
+	from := crypto.PubkeyToAddress(key.PublicKey)
+	to := common.Address{0x01}
+	pool.currentState.AddBalance(from, big.NewInt(1000000000))
+
+	kycTransaction := func(nonce uint64) *types.Transaction {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, to, big.NewInt(100), 100000, big.NewInt(int64(params.GasPrice)), nil), types.HomesteadSigner{}, key)
+		return tx
+	}
+	// Without any registered provider, KYC is not enforced
+	if err := pool.AddRemote(kycTransaction(0)); err != nil {
+		t.Fatalf("failed to add transaction without KYC providers: %v", err)
+	}
+	// Once a provider is registered, both sides need to be verified by it
+	provider := common.Address{0xff}
+	pool.currentState.AddKycProvider(provider)
+	verify := func(addr common.Address) {
+		pool.currentState.SetKycProvider(addr, provider)
+		pool.currentState.SetKycLevel(addr, 1)
+	}
+
+	if err := pool.AddRemote(kycTransaction(1)); err != ErrKycRequired {
+		t.Errorf("unverified sender error mismatch: have %v, want %v", err, ErrKycRequired)
+	}
+	verify(from)
+	if err := pool.AddRemote(kycTransaction(1)); err != ErrKycRequired {
+		t.Errorf("unverified recipient error mismatch: have %v, want %v", err, ErrKycRequired)
+	}
+	verify(to)
+	if err := pool.AddRemote(kycTransaction(1)); err != nil {
+		t.Fatalf("failed to add verified transaction: %v", err)
+	}
+	if err := pool.AddRemote(kycTransaction(2)); err != nil {
+		t.Fatalf("failed to add verified transaction: %v", err)
+	}
+	if pending, queued := pool.Stats(); pending != 3 || queued != 0 {
+		t.Fatalf("pool stats mismatch: have %d pending, %d queued, want 3 pending, 0 queued", pending, queued)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	// Revoke the recipient's verification and ensure the pool drops everything
+	// on the next head
+	pool.currentState.SetKycLevel(to, 0)
+	pool.lockedReset(nil, nil)
+
+	if pending, queued := pool.Stats(); pending != 0 || queued != 0 {
+		t.Fatalf("pool stats mismatch: have %d pending, %d queued, want 0 pending, 0 queued", pending, queued)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that KYC governance transactions of providers and producers take the
+// reserved slots of a pool full of spam, and that the slots are released once
+// the transactions are mined or their senders lose their role.
+func TestTransactionGovernanceSlots(t *testing.T) {
+	t.Parallel()
+
+	diskdb, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(diskdb))
+	blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+	config := testTxPoolConfig
+	config.GlobalSlots = 4
+	config.GlobalQueue = 4
+	config.GovernanceSlots = 1
+
+	pool := NewTxPool(config, params.TestChainConfig, blockchain)
+	defer pool.Stop()
+
+	price := big.NewInt(int64(params.GasPrice))
+	send := func(nonce uint64, to common.Address, data []byte, key *ecdsa.PrivateKey) error {
+		tx, _ := types.SignTx(types.NewTransaction(nonce, to, new(big.Int), 100000, price, data), types.HomesteadSigner{}, key)
+		return pool.AddRemote(tx)
+	}
+	// Register a KYC provider and a producer, and verify a crowd of spammers
+	providerKey, _ := crypto.GenerateKey()
+	producerKey, _ := crypto.GenerateKey()
+	provider := crypto.PubkeyToAddress(providerKey.PublicKey)
+	producer := crypto.PubkeyToAddress(producerKey.PublicKey)
+
+	pool.currentState.AddKycProvider(provider)
+	pool.currentState.RegisterProducer(&producer, "won://producer")
+
+	spammers := make([]*ecdsa.PrivateKey, config.GlobalSlots+config.GlobalQueue+1)
+	for i := range spammers {
+		spammers[i], _ = crypto.GenerateKey()
+	}
+	accounts := []common.Address{provider, producer}
+	for _, key := range spammers {
+		accounts = append(accounts, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	for _, addr := range accounts {
+		pool.currentState.AddBalance(addr, big.NewInt(1000000000))
+		pool.currentState.SetKycProvider(addr, provider)
+		pool.currentState.SetKycLevel(addr, 1)
+	}
+	// Fill the pool with spam, after which anything else is underpriced
+	for i, key := range spammers[:len(spammers)-1] {
+		if err := send(0, provider, nil, key); err != nil {
+			t.Fatalf("spam %d: failed to add transaction: %v", i, err)
+		}
+	}
+	if err := send(0, provider, nil, spammers[len(spammers)-1]); err != ErrUnderpriced {
+		t.Fatalf("spam overflow error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+	if err := send(0, producer, nil, providerKey); err != ErrUnderpriced {
+		t.Fatalf("provider transfer error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+	// A vote of the provider takes the reserved slot, leaving none for the producer
+	vote, _ := types.SignTx(types.NewTransaction(0, vm.KycContractAddress, new(big.Int), 100000, price, kycabi.NewTx(0, 0, nil, &kycabi.ProposalVote{}).Data()), types.HomesteadSigner{}, providerKey)
+	if err := pool.AddRemote(vote); err != nil {
+		t.Fatalf("failed to add provider vote: %v", err)
+	}
+	register := kycabi.NewTx(0, 0, nil, &kycabi.RegisterProducer{URL: "won://producer"}).Data()
+	if err := send(0, vm.KycContractAddress, register, producerKey); err != ErrUnderpriced {
+		t.Fatalf("producer registration error mismatch: have %v, want %v", err, ErrUnderpriced)
+	}
+	pending, _ := pool.Pending()
+	if txs := pending[provider]; len(txs) != 1 || txs[0].Hash() != vote.Hash() {
+		t.Fatalf("provider vote not pending: %v", txs)
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+	// Once the vote is mined, its slot is free for the producer
+	pool.currentState.SetNonce(provider, 1)
+	pool.lockedReset(nil, nil)
+
+	if pool.Get(vote.Hash()) != nil {
+		t.Fatalf("mined vote still pooled")
+	}
+	if err := send(0, vm.KycContractAddress, register, producerKey); err != nil {
+		t.Fatalf("failed to add producer registration: %v", err)
+	}
+	if len(pool.reserved) != 1 {
+		t.Fatalf("reserved slot count mismatch: have %d, want 1", len(pool.reserved))
+	}
+	// A producer no longer active loses its slot, but not its transaction
+	pool.currentState.UpdateProducerActive(&producer, false)
+	pool.lockedReset(nil, nil)
+
+	if len(pool.reserved) != 0 {
+		t.Fatalf("reserved slot count mismatch: have %d, want 0", len(pool.reserved))
+	}
+	if pending, _ := pool.Pending(); len(pending[producer]) != 1 {
+		t.Fatalf("producer registration dropped with its slot")
+	}
+	if err := validateTxPoolInternals(pool); err != nil {
+		t.Fatalf("pool internal state corrupted: %v", err)
+	}
+}
+
+// Tests that staking transactions may be corrected by a same priced replacement
+// calling the same method with other arguments, if the pool is configured so,
+// both in the pending and in the future queue.
+func TestTransactionStakingReplacement(t *testing.T) {
+	t.Parallel()
+
+	var (
+		price = big.NewInt(int64(params.GasPrice))
+		stake = big.NewInt(params.WON)
+
+		addStake = func(nonce uint64, value *big.Int) *types.Transaction {
+			return kycabi.NewAddStakeTx(nonce, 100000, price, value)
+		}
+		vote = func(nonce uint64, producers ...common.Address) *types.Transaction {
+			return kycabi.NewVoteProducersTx(nonce, 100000, price, producers)
+		}
+		subStake = func(nonce uint64) *types.Transaction {
+			return kycabi.NewSubStakeTx(nonce, 100000, price, new(big.Int))
+		}
+		register = func(nonce uint64, url string) *types.Transaction {
+			return kycabi.NewRegisterProducerTx(nonce, 100000, price, url)
+		}
+		transfer = func(nonce uint64, to common.Address) *types.Transaction {
+			return types.NewTransaction(nonce, to, big.NewInt(1), 100000, price, addStake(0, stake).Data())
+		}
+	)
+	tests := []struct {
+		name    string
+		enabled bool
+		old     func(nonce uint64) *types.Transaction
+		tx      func(nonce uint64) *types.Transaction
+		want    error
+	}{
+		{"stake amended", true,
+			func(n uint64) *types.Transaction { return addStake(n, stake) },
+			func(n uint64) *types.Transaction { return addStake(n, new(big.Int).Add(stake, stake)) }, nil},
+		{"votes amended", true,
+			func(n uint64) *types.Transaction { return vote(n, common.Address{0x01}) },
+			func(n uint64) *types.Transaction { return vote(n, common.Address{0x01}, common.Address{0x02}) }, nil},
+		{"same arguments", true,
+			func(n uint64) *types.Transaction { return addStake(n, stake) },
+			func(n uint64) *types.Transaction { return kycabi.NewAddStakeTx(n, 200000, price, stake) }, ErrReplaceUnderpriced},
+		{"other method", true,
+			func(n uint64) *types.Transaction { return addStake(n, stake) },
+			func(n uint64) *types.Transaction { return subStake(n) }, ErrReplaceUnderpriced},
+		{"not staking", true,
+			func(n uint64) *types.Transaction { return register(n, "won://one") },
+			func(n uint64) *types.Transaction { return register(n, "won://two") }, ErrReplaceUnderpriced},
+		{"not precompile", true,
+			func(n uint64) *types.Transaction { return transfer(n, common.Address{0x01}) },
+			func(n uint64) *types.Transaction { return transfer(n, common.Address{0x02}) }, ErrReplaceUnderpriced},
+		{"disabled", false,
+			func(n uint64) *types.Transaction { return addStake(n, stake) },
+			func(n uint64) *types.Transaction { return addStake(n, new(big.Int).Add(stake, stake)) }, ErrReplaceUnderpriced},
+	}
+	for _, tt := range tests {
+		for _, nonce := range []uint64{0, 2} {
+			diskdb, _ := wondb.NewMemDatabase()
+			statedb, _ := state.New(common.Hash{}, state.NewDatabase(diskdb))
+			blockchain := &testBlockChain{statedb, 1000000, new(event.Feed)}
+
+			config := testTxPoolConfig
+			config.StakingReplace = tt.enabled
+			pool := NewTxPool(config, params.TestChainConfig, blockchain)
+
+			key, _ := crypto.GenerateKey()
+			pool.currentState.AddBalance(crypto.PubkeyToAddress(key.PublicKey), new(big.Int).Mul(stake, big.NewInt(10)))
+
+			old, _ := types.SignTx(tt.old(nonce), types.HomesteadSigner{}, key)
+			if err := pool.AddRemote(old); err != nil {
+				t.Fatalf("%s, nonce %d: failed to add original transaction: %v", tt.name, nonce, err)
+			}
+			tx, _ := types.SignTx(tt.tx(nonce), types.HomesteadSigner{}, key)
+			if err := pool.AddRemote(tx); err != tt.want {
+				t.Errorf("%s, nonce %d: replacement error mismatch: have %v, want %v", tt.name, nonce, err, tt.want)
+			}
+			want := old
+			if tt.want == nil {
+				want = tx
+			}
+			if len(pool.all) != 1 || pool.all[want.Hash()] == nil {
+				t.Errorf("%s, nonce %d: pooled transaction mismatch, want %x", tt.name, nonce, want.Hash())
+			}
+			if err := validateTxPoolInternals(pool); err != nil {
+				t.Errorf("%s, nonce %d: pool internal state corrupted: %v", tt.name, nonce, err)
+			}
+			pool.Stop()
+		}
+	}
+}
@@ -42,6 +42,28 @@ const (
 	ReceiptStatusSuccessful = uint(1)
 )
 
+const (
+	// KycErrorNone is the KYC failure code of a transaction not rejected by the
+	// KYC checks, or of one executed before the KYC receipt fork.
+	KycErrorNone = uint(0)
+
+	// KycErrorSender is the KYC failure code of a transaction whose sender is
+	// not KYC verified.
+	KycErrorSender = uint(1)
+
+	// KycErrorRecipient is the KYC failure code of a transaction whose recipient
+	// is not KYC verified.
+	KycErrorRecipient = uint(2)
+
+	// KycErrorZone is the KYC failure code of a transaction between two zones the
+	// zone policy forbids to transact.
+	KycErrorZone = uint(3)
+
+	// KycErrorNested is the KYC failure code of a transaction whose nested call
+	// got rejected by the KYC checks.
+	KycErrorNested = uint(4)
+)
+
 // Receipt represents the results of a transaction.
 type Receipt struct {
 	// Consensus fields
@@ -50,6 +72,7 @@ type Receipt struct {
 	CumulativeGasUsed uint64 `json:"cumulativeGasUsed" gencodec:"required"`
 	Bloom             Bloom  `json:"logsBloom"         gencodec:"required"`
 	Logs              []*Log `json:"logs"              gencodec:"required"`
+	KycError          uint   `json:"kycError,omitempty"`
 
 	// Implementation fields (don't reorder!)
 	TxHash          common.Hash    `json:"transactionHash" gencodec:"required"`
@@ -61,15 +84,19 @@ type receiptMarshaling struct {
 	PostState         hexutil.Bytes
 	Status            hexutil.Uint
 	CumulativeGasUsed hexutil.Uint64
+	KycError          hexutil.Uint
 	GasUsed           hexutil.Uint64
 }
 
-// receiptRLP is the consensus encoding of a receipt.
+// receiptRLP is the consensus encoding of a receipt. The KYC failure code is an
+// optional extension, left out unless the receipt carries one so that receipts
+// of transactions not rejected by the KYC checks encode as before.
 type receiptRLP struct {
 	PostStateOrStatus []byte
 	CumulativeGasUsed uint64
 	Bloom             Bloom
 	Logs              []*Log
+	KycError          []uint `rlp:"tail"`
 }
 
 type receiptStorageRLP struct {
@@ -80,6 +107,7 @@ type receiptStorageRLP struct {
 	ContractAddress   common.Address
 	Logs              []*LogForStorage
 	GasUsed           uint64
+	KycError          []uint `rlp:"tail"`
 }
 
 // NewReceipt creates a barebone transaction receipt, copying the init fields.
@@ -96,7 +124,7 @@ func NewReceipt(root []byte, failed bool, cumulativeGasUsed uint64) *Receipt {
 // EncodeRLP implements rlp.Encoder, and flattens the consensus fields of a receipt
 // into an RLP stream. If no post state is present, byzantium fork is assumed.
 func (r *Receipt) EncodeRLP(w io.Writer) error {
-	return rlp.Encode(w, &receiptRLP{r.statusEncoding(), r.CumulativeGasUsed, r.Bloom, r.Logs})
+	return rlp.Encode(w, &receiptRLP{r.statusEncoding(), r.CumulativeGasUsed, r.Bloom, r.Logs, r.kycErrorEncoding()})
 }
 
 // DecodeRLP implements rlp.Decoder, and loads the consensus fields of a receipt
@@ -109,6 +137,9 @@ func (r *Receipt) DecodeRLP(s *rlp.Stream) error {
 	if err := r.setStatus(dec.PostStateOrStatus); err != nil {
 		return err
 	}
+	if err := r.setKycError(dec.KycError); err != nil {
+		return err
+	}
 	r.CumulativeGasUsed, r.Bloom, r.Logs = dec.CumulativeGasUsed, dec.Bloom, dec.Logs
 	return nil
 }
@@ -137,6 +168,25 @@ func (r *Receipt) statusEncoding() []byte {
 	return r.PostState
 }
 
+func (r *Receipt) setKycError(extension []uint) error {
+	switch {
+	case len(extension) == 0:
+		r.KycError = KycErrorNone
+	case len(extension) == 1 && extension[0] != KycErrorNone:
+		r.KycError = extension[0]
+	default:
+		return fmt.Errorf("invalid receipt KYC error %v", extension)
+	}
+	return nil
+}
+
+func (r *Receipt) kycErrorEncoding() []uint {
+	if r.KycError == KycErrorNone {
+		return nil
+	}
+	return []uint{r.KycError}
+}
+
 // Size returns the approximate memory used by all internal contents. It is used
 // to approximate and limit the memory consumption of various caches.
 func (r *Receipt) Size() common.StorageSize {
@@ -164,6 +214,7 @@ func (r *ReceiptForStorage) EncodeRLP(w io.Writer) error {
 		ContractAddress:   r.ContractAddress,
 		Logs:              make([]*LogForStorage, len(r.Logs)),
 		GasUsed:           r.GasUsed,
+		KycError:          (*Receipt)(r).kycErrorEncoding(),
 	}
 	for i, log := range r.Logs {
 		enc.Logs[i] = (*LogForStorage)(log)
@@ -181,6 +232,9 @@ func (r *ReceiptForStorage) DecodeRLP(s *rlp.Stream) error {
 	if err := (*Receipt)(r).setStatus(dec.PostStateOrStatus); err != nil {
 		return err
 	}
+	if err := (*Receipt)(r).setKycError(dec.KycError); err != nil {
+		return err
+	}
 	// Assign the consensus fields
 	r.CumulativeGasUsed, r.Bloom = dec.CumulativeGasUsed, dec.Bloom
 	r.Logs = make([]*Log, len(dec.Logs))
@@ -0,0 +1,120 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package types
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/rlp"
+)
+
+// legacyReceiptRLP is the consensus encoding of receipts predating the KYC
+// failure codes.
+type legacyReceiptRLP struct {
+	PostStateOrStatus []byte
+	CumulativeGasUsed uint64
+	Bloom             Bloom
+	Logs              []*Log
+}
+
+// legacyReceiptStorageRLP is the storage encoding of receipts predating the KYC
+// failure codes.
+type legacyReceiptStorageRLP struct {
+	PostStateOrStatus []byte
+	CumulativeGasUsed uint64
+	Bloom             Bloom
+	TxHash            common.Hash
+	ContractAddress   common.Address
+	Logs              []*LogForStorage
+	GasUsed           uint64
+}
+
+// Tests that receipts encoded before the KYC failure codes existed decode and
+// re-encode unchanged, in both the consensus and the storage encoding.
+func TestLegacyReceiptRLP(t *testing.T) {
+	logs := []*Log{{Address: common.Address{0x11}, Topics: []common.Hash{{0x22}}, Data: []byte{0x33}}}
+
+	legacy, _ := rlp.EncodeToBytes(&legacyReceiptRLP{receiptStatusFailedRLP, 42000, Bloom{0x01}, logs})
+
+	var receipt Receipt
+	if err := rlp.DecodeBytes(legacy, &receipt); err != nil {
+		t.Fatalf("failed to decode legacy receipt: %v", err)
+	}
+	if receipt.Status != ReceiptStatusFailed || receipt.KycError != KycErrorNone || receipt.CumulativeGasUsed != 42000 {
+		t.Errorf("legacy receipt mismatch: %+v", receipt)
+	}
+	if enc, _ := rlp.EncodeToBytes(&receipt); !bytes.Equal(enc, legacy) {
+		t.Errorf("legacy receipt re-encoding mismatch: have %x, want %x", enc, legacy)
+	}
+	legacyStorage, _ := rlp.EncodeToBytes(&legacyReceiptStorageRLP{
+		PostStateOrStatus: receiptStatusSuccessfulRLP,
+		CumulativeGasUsed: 21000,
+		TxHash:            common.Hash{0x44},
+		ContractAddress:   common.Address{0x55},
+		Logs:              []*LogForStorage{(*LogForStorage)(logs[0])},
+		GasUsed:           21000,
+	})
+	var stored ReceiptForStorage
+	if err := rlp.DecodeBytes(legacyStorage, &stored); err != nil {
+		t.Fatalf("failed to decode legacy stored receipt: %v", err)
+	}
+	if stored.Status != ReceiptStatusSuccessful || stored.KycError != KycErrorNone || stored.TxHash != (common.Hash{0x44}) || stored.GasUsed != 21000 {
+		t.Errorf("legacy stored receipt mismatch: %+v", stored)
+	}
+	if enc, _ := rlp.EncodeToBytes(&stored); !bytes.Equal(enc, legacyStorage) {
+		t.Errorf("legacy stored receipt re-encoding mismatch: have %x, want %x", enc, legacyStorage)
+	}
+}
+
+// Tests that the KYC failure code of a receipt survives both encodings, and
+// changes the consensus encoding only if it is set.
+func TestKycErrorReceiptRLP(t *testing.T) {
+	receipt := &Receipt{Status: ReceiptStatusFailed, CumulativeGasUsed: 21000, Logs: []*Log{}, TxHash: common.Hash{0x01}, GasUsed: 21000}
+
+	plain, _ := rlp.EncodeToBytes(receipt)
+	receipt.KycError = KycErrorRecipient
+	tagged, _ := rlp.EncodeToBytes(receipt)
+	if bytes.Equal(plain, tagged) {
+		t.Fatalf("KYC failure code missing from the consensus encoding")
+	}
+	var dec Receipt
+	if err := rlp.DecodeBytes(tagged, &dec); err != nil {
+		t.Fatalf("failed to decode receipt: %v", err)
+	}
+	if dec.KycError != KycErrorRecipient {
+		t.Errorf("decoded KYC failure code mismatch: have %d, want %d", dec.KycError, KycErrorRecipient)
+	}
+	stored, _ := rlp.EncodeToBytes((*ReceiptForStorage)(receipt))
+
+	var decStored ReceiptForStorage
+	if err := rlp.DecodeBytes(stored, &decStored); err != nil {
+		t.Fatalf("failed to decode stored receipt: %v", err)
+	}
+	if !reflect.DeepEqual((*Receipt)(&decStored), receipt) {
+		t.Errorf("stored receipt mismatch: have %+v, want %+v", decStored, receipt)
+	}
+	// Extensions other than a single failure code are rejected
+	for _, ext := range [][]uint{{KycErrorNone}, {KycErrorSender, KycErrorZone}} {
+		enc, _ := rlp.EncodeToBytes(&receiptRLP{receiptStatusFailedRLP, 21000, Bloom{}, []*Log{}, ext})
+		if err := rlp.DecodeBytes(enc, new(Receipt)); err == nil {
+			t.Errorf("extension %v: receipt accepted", ext)
+		}
+	}
+}
@@ -20,13 +20,18 @@ import (
 	"crypto/sha256"
 	"errors"
 	"math/big"
+	"time"
 
 	"encoding/binary"
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/common/math"
+	"github.com/worldopennetwork/go-won/core/types"
 	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/crypto/blake2b"
 	"github.com/worldopennetwork/go-won/crypto/bn256"
+	"github.com/worldopennetwork/go-won/metrics"
 	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rlp"
 	"golang.org/x/crypto/ripemd160"
 )
 
@@ -60,9 +65,47 @@ var PrecompiledContractsByzantium = map[common.Address]PrecompiledContract{
 	common.BytesToAddress([]byte{8}): &bn256Pairing{},
 }
 
+// PrecompiledContractsWON contains the set of pre-compiled contracts active
+// from the Blake2F fork on, extending the Byzantium ones.
+var PrecompiledContractsWON = map[common.Address]PrecompiledContract{
+	common.BytesToAddress([]byte{1}): &ecrecover{},
+	common.BytesToAddress([]byte{2}): &sha256hash{},
+	common.BytesToAddress([]byte{3}): &ripemd160hash{},
+	common.BytesToAddress([]byte{4}): &dataCopy{},
+	common.BytesToAddress([]byte{5}): &bigModExp{},
+	common.BytesToAddress([]byte{6}): &bn256Add{},
+	common.BytesToAddress([]byte{7}): &bn256ScalarMul{},
+	common.BytesToAddress([]byte{8}): &bn256Pairing{},
+	Blake2FContractAddress:           &blake2F{},
+	EcrecoverBatchContractAddress:    &ecrecoverBatch{},
+}
+
+// ActivePrecompiles returns the set of pre-compiled contracts active at block
+// number under the rules of config. New precompiles are scheduled by adding a
+// set for the fork they are activated with.
+func ActivePrecompiles(number *big.Int, config *params.ChainConfig) map[common.Address]PrecompiledContract {
+	if config != nil && config.IsBlake2F(number) {
+		return PrecompiledContractsWON
+	}
+	return PrecompiledContractsByzantium
+}
+
 var KycContractAddress = common.BytesToAddress([]byte{9})
+
+// Blake2FContractAddress is the address of the EIP-152 blake2b compression
+// precompile. Its standard address 0x09 is taken by the KYC contract, and 0x0a
+// and 0x0b are left to later Ethereum precompiles, so it lives at 0x0c.
+var Blake2FContractAddress = common.BytesToAddress([]byte{12})
+
+// EcrecoverBatchContractAddress is the address of the precompile recovering the
+// signers of several signatures in one call.
+var EcrecoverBatchContractAddress = common.BytesToAddress([]byte{13})
 var DposActivatedStakeThreshold = big.NewInt(0).Mul(big.NewInt(15000000), big.NewInt(params.WON))
 
+// DposRefundDelay is the number of seconds a stake refund stays locked after it
+// was requested. It can be claimed once strictly more time passed.
+const DposRefundDelay = 3 * 86400
+
 const KycMethodSet = 1
 const KycMethodProviderVoteProposal = 2
 const KycMethodVote = 3
@@ -72,6 +115,64 @@ const DposMethodAddStake = 6
 const DposMethodSubStake = 7
 const DposMethodProdsVote = 8
 const DposMethodRefund = 9
+const KycMethodCancelProposal = 10
+const KycMethodSetBatch = 11
+const KycMethodGetLevelThresholds = 12
+const KycMethodGetProviderInfo = 13
+const DposMethodAddVote = 14
+const DposMethodRemoveVote = 15
+const DposMethodRegProxy = 16
+const DposMethodSetProxy = 17
+const DposMethodSetLocation = 18
+const DposMethodSetAutoRefund = 19
+const DposMethodSetSigningKey = 20
+const KycMethodConfirm = 21
+
+// DposMaxVotes is the maximum number of producers a voter may vote for at once,
+// chains may configure a lower limit.
+const DposMaxVotes = params.MaxDposVotes
+
+// Proposal types of KycMethodProviderVoteProposal.
+const (
+	KycProposalAddProvider    = 1
+	KycProposalRemoveProvider = 2
+	KycProposalRestrictZones  = 3 // forbid transfers between a pair of zones
+	KycProposalAllowZones     = 4 // lift the restriction of a pair of zones
+	KycProposalRevokeProvider = 5 // invalidate the attestations of a provider, keeping it
+)
+
+// KycProviderInfoMaxSize is the maximum size of the RLP encoded metadata a KYC
+// provider may be registered with.
+const KycProviderInfoMaxSize = 256
+
+// KycMaxProposals is the maximum number of provider proposals pending at once.
+const KycMaxProposals = 8
+
+// KycProposalLifetime is the number of seconds a provider proposal stays open.
+const KycProposalLifetime = 86400
+
+const (
+	kycSetBatchEntrySize  = 20 + 4 + 4 + 8 // address, level, zone, expiresAt
+	kycSetBatchEntryGas   = 3000           // gas charged for every entry of a batch
+	kycSetBatchMaxEntries = 256            // maximum number of entries of a batch
+
+	dposProxyDelegatorGas = 5000 // gas charged for every delegator released by an unregistering proxy
+
+	kycHistoryEntryGas = 3 * params.SstoreSetGas // gas charged for the storage slots a KYC history entry writes
+)
+
+// Topics of the logs emitted by the KYC precompile. The topic of the event is
+// followed by the address of the provider or voter that caused it, the data
+// being the number of entries set, the address attested or the amount of stake
+// moved.
+var (
+	KycSetBatchTopic             = crypto.Keccak256Hash([]byte("KycSetBatch(address,uint256)"))
+	KycAttestationPendingTopic   = crypto.Keccak256Hash([]byte("KycAttestationPending(address,address)"))
+	KycAttestationConfirmedTopic = crypto.Keccak256Hash([]byte("KycAttestationConfirmed(address,address)"))
+	DposStakeAddedTopic          = crypto.Keccak256Hash([]byte("StakeAdded(address,uint256)"))
+	DposStakeSubtractedTopic     = crypto.Keccak256Hash([]byte("StakeSubtracted(address,uint256)"))
+	DposStakeRefundedTopic       = crypto.Keccak256Hash([]byte("StakeRefunded(address,uint256)"))
+)
 
 // RunPrecompiledContract runs and evaluates the output of a precompiled contract.
 func RunPrecompiledContract(p PrecompiledContract, input []byte, contract *Contract) (ret []byte, err error) {
@@ -115,6 +216,34 @@ func (c *ecrecover) Run(input []byte) ([]byte, error) {
 	return common.LeftPadBytes(crypto.Keccak256(pubKey[1:])[12:], 32), nil
 }
 
+// errBadEcrecoverBatchInput is returned if the batch is not made of whole
+// (hash, v, r, s) tuples.
+var errBadEcrecoverBatchInput = errors.New("bad ecrecover batch size")
+
+// ecrecoverBatch implements a pre-compile recovering the signers of a batch of
+// (hash, v, r, s) tuples, 128 bytes each, into the packed 20 byte addresses of
+// the signers in order. Tuples ecrecover rejects yield the zero address.
+type ecrecoverBatch struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *ecrecoverBatch) RequiredGas(input []byte) uint64 {
+	return params.EcrecoverBatchBaseGas + uint64(len(input)/128)*params.EcrecoverBatchPerSigGas
+}
+
+func (c *ecrecoverBatch) Run(input []byte) ([]byte, error) {
+	if len(input)%128 > 0 {
+		return nil, errBadEcrecoverBatchInput
+	}
+	output := make([]byte, 0, len(input)/128*common.AddressLength)
+	for i := 0; i < len(input); i += 128 {
+		// Recover every signature exactly as a standalone ecrecover would, on a
+		// copy as it appends to its input in place, clobbering the next tuple
+		signer, _ := new(ecrecover).Run(common.CopyBytes(input[i : i+128]))
+		output = append(output, common.LeftPadBytes(signer, 32)[12:]...)
+	}
+	return output, nil
+}
+
 // SHA256 implemented as a native contract.
 type sha256hash struct{}
 
@@ -374,134 +503,656 @@ func (c *bn256Pairing) Run(input []byte) ([]byte, error) {
 	return false32Byte, nil
 }
 
+const blake2FInputLength = 213
+
+var (
+	// errBlake2FInvalidInputLength is returned if the blake2b input is not 213 bytes.
+	errBlake2FInvalidInputLength = errors.New("invalid input length")
+
+	// errBlake2FInvalidFinalFlag is returned if the final block flag is neither 0 nor 1.
+	errBlake2FInvalidFinalFlag = errors.New("invalid final flag")
+)
+
+// blake2F implements the EIP-152 blake2b compression pre-compile.
+type blake2F struct{}
+
+// RequiredGas returns the gas required to execute the pre-compiled contract.
+func (c *blake2F) RequiredGas(input []byte) uint64 {
+	// Malformed inputs are rejected by Run, no need to charge for them
+	if len(input) != blake2FInputLength {
+		return 0
+	}
+	rounds := uint64(binary.BigEndian.Uint32(input[0:4]))
+	return (rounds + params.Blake2FRoundsPerGas - 1) / params.Blake2FRoundsPerGas
+}
+
+func (c *blake2F) Run(input []byte) ([]byte, error) {
+	// Make sure the input is valid (correct length and final flag)
+	if len(input) != blake2FInputLength {
+		return nil, errBlake2FInvalidInputLength
+	}
+	if input[212] != 0 && input[212] != 1 {
+		return nil, errBlake2FInvalidFinalFlag
+	}
+	// Parse the input into the blake2b call parameters
+	var (
+		rounds = binary.BigEndian.Uint32(input[0:4])
+		final  = input[212] == 1
+
+		h [8]uint64
+		m [16]uint64
+		t [2]uint64
+	)
+	for i := 0; i < 8; i++ {
+		h[i] = binary.LittleEndian.Uint64(input[4+i*8:])
+	}
+	for i := 0; i < 16; i++ {
+		m[i] = binary.LittleEndian.Uint64(input[68+i*8:])
+	}
+	t[0] = binary.LittleEndian.Uint64(input[196:204])
+	t[1] = binary.LittleEndian.Uint64(input[204:212])
+
+	// Execute the compression function and encode the resulting state
+	blake2b.F(&h, m, t, final, rounds)
+
+	output := make([]byte, 64)
+	for i := 0; i < 8; i++ {
+		binary.LittleEndian.PutUint64(output[i*8:], h[i])
+	}
+	return output, nil
+}
+
+// setContractKycInfoAtCreate records the human account behind caller as the
+// creator of the contract at address, whose KYC info the contract then shares.
+// Before the contract creator fork the KYC info of caller is copied onto the
+// contract instead.
 func setContractKycInfoAtCreate(evm *EVM, caller common.Address, address common.Address) {
+	if evm.ChainConfig().IsKycContractCreator(evm.BlockNumber) {
+		evm.StateDB.SetContractCreator(address, evm.StateDB.GetContractCreator(caller))
+		return
+	}
 	humanCaller := caller
 	for evm.StateDB.IsContractAddress(humanCaller) {
 		humanCaller = evm.StateDB.GetContractCreator(humanCaller)
 	}
 	evm.StateDB.SetKycProvider(address, humanCaller)
 	evm.StateDB.SetKycZone(address, evm.StateDB.GetKycZone(caller))
-	evm.StateDB.SetKycLevel(address, evm.StateDB.GetKycLevel(caller))
+	evm.StateDB.SetKycLevel(address, evm.StateDB.GetKycLevel(caller, evm.Time.Uint64()))
 }
 
-func kycSetForAddress(evm *EVM, contract *Contract, address common.Address, level uint32, zone uint32) ([]byte, error) {
+// kycSetForAddress sets the KYC info of address as attested by provider. Since
+// the history fork the change is recorded in the history of address, charging
+// for the storage the entry takes before anything is set.
+func kycSetForAddress(evm *EVM, contract *Contract, provider common.Address, address common.Address, level uint32, zone uint32, expiresAt uint64) ([]byte, error) {
+	history := evm.ChainConfig().IsKycHistory(evm.BlockNumber)
+	if history && !contract.UseGas(kycHistoryEntryGas) {
+		return nil, ErrOutOfGas
+	}
+	oldLevel, oldZone := evm.StateDB.GetKycLevel(address, evm.Time.Uint64()), evm.StateDB.GetKycZone(address)
 
-	evm.StateDB.SetKycProvider(address, contract.caller.Address())
+	evm.StateDB.SetKycProvider(address, provider)
 	evm.StateDB.SetKycZone(address, zone)
 	evm.StateDB.SetKycLevel(address, level)
+	evm.StateDB.SetKycExpiry(address, expiresAt)
+	kycRecordAttestationEpoch(evm, address, provider)
+
+	if history {
+		evm.StateDB.AddKycHistory(address, &common.KycHistoryEntry{
+			Time:     evm.Time.Uint64(),
+			Provider: provider,
+			OldLevel: oldLevel,
+			NewLevel: level,
+			OldZone:  oldZone,
+			NewZone:  zone,
+		}, evm.ChainConfig().KycHistoryDepth())
+	}
 	return nil, nil
 }
 
+// kycAttest sets the KYC info of address as attested by the calling provider.
+// Once attestations need a second provider, it's recorded pending their
+// confirmation instead, the level in effect staying the last confirmed one.
+func kycAttest(evm *EVM, contract *Contract, address common.Address, level uint32, zone uint32, expiresAt uint64) ([]byte, error) {
+	provider := contract.caller.Address()
+	if !evm.ChainConfig().IsKycDualAttestation(evm.BlockNumber) {
+		return kycSetForAddress(evm, contract, provider, address, level, zone, expiresAt)
+	}
+	evm.StateDB.SetKycPendingAttestation(address, &common.KycAttestation{
+		Provider:  provider,
+		Level:     level,
+		Zone:      zone,
+		ExpiresAt: expiresAt,
+		Deadline:  evm.Time.Uint64() + evm.ChainConfig().KycPendingLifetime(),
+		Epoch:     evm.StateDB.GetKycProviderEpoch(provider),
+	})
+	kycAddLog(evm, KycAttestationPendingTopic, provider, address.Hash().Bytes())
+	return nil, nil
+}
+
+// kycConfirm puts the pending attestation of address into effect on behalf of
+// the provider that made it, once another provider confirmed the same info
+// before the attestation lapsed or the attestations of the provider got revoked.
+func kycConfirm(evm *EVM, contract *Contract, address common.Address, level uint32, zone uint32, expiresAt uint64) ([]byte, error) {
+	pending := evm.StateDB.GetKycPendingAttestation(address)
+	if pending == nil || evm.Time.Uint64() >= pending.Deadline || pending.Epoch < evm.StateDB.GetKycProviderEpoch(pending.Provider) {
+		return nil, ErrKycNoPendingAttestation
+	}
+	caller := contract.caller.Address()
+	if pending.Provider == caller {
+		return nil, ErrKycSameProvider
+	}
+	if pending.Level != level || pending.Zone != zone || pending.ExpiresAt != expiresAt {
+		return nil, ErrKycAttestationMismatch
+	}
+	evm.StateDB.SetKycPendingAttestation(address, nil)
+	kycAddLog(evm, KycAttestationConfirmedTopic, caller, address.Hash().Bytes())
+
+	return kycSetForAddress(evm, contract, pending.Provider, address, level, zone, expiresAt)
+}
+
+// kycAttestationArgs parses the address, level, zone and optional expiry of the
+// attestation made or confirmed by input.
+func kycAttestationArgs(evm *EVM, input []byte) (common.Address, uint32, uint32, uint64, error) {
+	if len(input) < 32 {
+		return common.Address{}, 0, 0, 0, ErrKycInvalidInput
+	}
+	address := common.BytesToAddress(input[4:24])
+	level := binary.BigEndian.Uint32(input[24:28])
+	zone := binary.BigEndian.Uint32(input[28:32])
+
+	// the expiry is optional, zero meaning the attestation never expires. Any
+	// bytes following the zone were ignored before the expiry fork.
+	var expiresAt uint64
+	if len(input) >= 40 && evm.ChainConfig().IsKycExpiry(evm.BlockNumber) {
+		expiresAt = binary.BigEndian.Uint64(input[32:40])
+	}
+	return address, level, zone, expiresAt, nil
+}
+
+// kycSetBatch sets the KYC info of every entry packed in input, charging
+// kycSetBatchEntryGas for each. It stops at the first entry that can't be paid
+// for or belongs to another provider, keeping the entries set before it, and
+// returns their number.
+func kycSetBatch(evm *EVM, contract *Contract, input []byte) ([]byte, error) {
+	if len(input) == 0 || len(input)%kycSetBatchEntrySize != 0 || len(input)/kycSetBatchEntrySize > kycSetBatchMaxEntries {
+		return nil, ErrKycInvalidInput
+	}
+	caller := contract.caller.Address()
+
+	count := 0
+	for ; count*kycSetBatchEntrySize < len(input); count++ {
+		entry := input[count*kycSetBatchEntrySize : (count+1)*kycSetBatchEntrySize]
+
+		address := common.BytesToAddress(entry[0:20])
+		if pd := evm.StateDB.GetKycProvider(address); pd != (common.Address{}) && pd != caller {
+			break
+		}
+		if !contract.UseGas(kycSetBatchEntryGas) {
+			break
+		}
+		level := binary.BigEndian.Uint32(entry[20:24])
+		zone := binary.BigEndian.Uint32(entry[24:28])
+		var expiresAt uint64
+		if evm.ChainConfig().IsKycExpiry(evm.BlockNumber) {
+			expiresAt = binary.BigEndian.Uint64(entry[28:36])
+		}
+		if _, err := kycAttest(evm, contract, address, level, zone, expiresAt); err != nil {
+			break
+		}
+	}
+	ret := common.BigToHash(big.NewInt(int64(count))).Bytes()
+
+	kycAddLog(evm, KycSetBatchTopic, caller, ret)
+	return ret, nil
+}
+
+// kycAddLog emits a log of the KYC precompile with the given event topic, on
+// behalf of addr.
+func kycAddLog(evm *EVM, topic common.Hash, addr common.Address, data []byte) {
+	evm.StateDB.AddLog(&types.Log{
+		Address:     KycContractAddress,
+		Topics:      []common.Hash{topic, addr.Hash()},
+		Data:        data,
+		BlockNumber: evm.BlockNumber.Uint64(),
+	})
+}
+
+// dposAddStakeLog emits a log of the staking change of addr by value, from the
+// dpos stake log fork on.
+func dposAddStakeLog(evm *EVM, topic common.Hash, addr common.Address, value *big.Int) {
+	if evm.ChainConfig().IsDposStakeLog(evm.BlockNumber) {
+		kycAddLog(evm, topic, addr, common.BigToHash(value).Bytes())
+	}
+}
+
+// kycGetLevelThresholds returns the KYC level thresholds of the chain ordered by
+// amount, each as a 32 byte amount followed by a 32 byte level.
+func kycGetLevelThresholds(evm *EVM) []byte {
+	thresholds := evm.ChainConfig().KycLevelThresholds()
+
+	ret := make([]byte, 0, 64*len(thresholds))
+	for _, threshold := range thresholds {
+		ret = append(ret, common.BigToHash(threshold.Amount).Bytes()...)
+		ret = append(ret, common.BigToHash(new(big.Int).SetUint64(uint64(threshold.Level))).Bytes()...)
+	}
+	return ret
+}
+
 func kycSetDefaultInfoForProvider(evm *EVM, addr common.Address) {
-	evm.StateDB.SetKycProvider(addr, addr)
-	evm.StateDB.SetKycZone(addr, 99999999)
-	evm.StateDB.SetKycLevel(addr, 99999999)
+	SetKycProviderDefaults(evm.StateDB, evm.ChainConfig(), evm.BlockNumber, addr)
+}
+
+// SetKycProviderDefaults has the new provider addr attest itself with the
+// highest level and zone at block number, the way providers added by the KYC
+// contract are.
+func SetKycProviderDefaults(db StateDB, config *params.ChainConfig, number *big.Int, addr common.Address) {
+	db.SetKycProvider(addr, addr)
+	db.SetKycZone(addr, 99999999)
+	db.SetKycLevel(addr, 99999999)
+	db.SetKycExpiry(addr, 0)
+	if config != nil && config.IsKycRevocation(number) {
+		db.SetKycAttestationEpoch(addr, db.GetKycProviderEpoch(addr))
+	}
+}
+
+// kycRecordAttestationEpoch records the attestation epoch of provider the KYC
+// info of address is issued in, so that revoking the attestations of provider
+// invalidates it. Before the revocation fork nothing is recorded, leaving those
+// attestations in the first epoch.
+func kycRecordAttestationEpoch(evm *EVM, address common.Address, provider common.Address) {
+	if evm.ChainConfig().IsKycRevocation(evm.BlockNumber) {
+		evm.StateDB.SetKycAttestationEpoch(address, evm.StateDB.GetKycProviderEpoch(provider))
+	}
+}
+
+// kycRemoveProvider drops addr from the KYC providers, revoking every
+// attestation it issued once the revocation fork is active.
+func kycRemoveProvider(evm *EVM, addr common.Address) bool {
+	if !evm.StateDB.RemoveKycProvider(addr) {
+		return false
+	}
+	if evm.ChainConfig().IsKycRevocation(evm.BlockNumber) {
+		evm.StateDB.RevokeKycAttestations(addr)
+	}
+	return true
+}
+
+// kycApplyRevokeProposal revokes every attestation issued by the provider addr
+// of an accepted revocation proposal. A provider still in office is attested
+// anew, keeping the info it holds of itself valid.
+func kycApplyRevokeProposal(evm *EVM, addr common.Address) {
+	evm.StateDB.RevokeKycAttestations(addr)
+	if evm.StateDB.GetKycProviderCount() > 0 && evm.StateDB.KycProviderExists(addr) {
+		kycSetDefaultInfoForProvider(evm, addr)
+	}
+}
+
+// kycValidProviderInfo reports whether info is empty or the RLP encoding of a
+// common.KycProviderInfo small enough to be stored.
+func kycValidProviderInfo(info []byte) bool {
+	if len(info) == 0 {
+		return true
+	}
+	if len(info) > KycProviderInfoMaxSize {
+		return false
+	}
+	return rlp.DecodeBytes(info, new(common.KycProviderInfo)) == nil
 }
 
-func kycStartProviderProposal(evm *EVM, contract *Contract, addr common.Address, pt uint64) ([]byte, error) {
+func kycStartProviderProposal(evm *EVM, contract *Contract, addr common.Address, pt uint64, info []byte) ([]byte, error) {
 
 	if evm.StateDB.IsContractAddress(addr) {
-		return nil, ErrOutOfGas
+		return nil, ErrKycInvalidProposal
 	}
 
 	curCount := evm.StateDB.GetKycProviderCount()
 
-	if pt != 1 && pt != 2 {
-		return nil, ErrOutOfGas
+	if pt < KycProposalAddProvider || pt > KycProposalRevokeProvider {
+		return nil, ErrKycInvalidProposal
+	}
+	if pt == KycProposalRevokeProvider && !evm.ChainConfig().IsKycRevocation(evm.BlockNumber) {
+		return nil, ErrKycInvalidProposal
+	}
+	if (pt == KycProposalRestrictZones || pt == KycProposalAllowZones) && !evm.ChainConfig().IsKycZoneProposal(evm.BlockNumber) {
+		return nil, ErrKycInvalidProposal
 	}
 
-	if curCount == 0 && pt == 2 {
-		return nil, ErrOutOfGas
+	if curCount == 0 && pt != KycProposalAddProvider {
+		return nil, ErrKycInvalidProposal
 	}
 
 	//must be a provider to do the proposal
 	if !evm.StateDB.KycProviderExists(contract.caller.Address()) {
-		return nil, ErrOutOfGas
+		return nil, ErrKycNotProvider
 	}
 
-	if pt == 1 && curCount > 0 && evm.StateDB.KycProviderExists(addr) {
-		return nil, ErrOutOfGas
+	if pt == KycProposalAddProvider && curCount > 0 && evm.StateDB.KycProviderExists(addr) {
+		return nil, ErrKycProviderExists
 	}
 
-	if pt == 2 && curCount <= 0 && !evm.StateDB.KycProviderExists(addr) {
-		return nil, ErrOutOfGas
+	if pt == KycProposalRemoveProvider {
+		if !evm.StateDB.KycProviderExists(addr) {
+			return nil, ErrKycInvalidProposal
+		}
+		if curCount <= evm.ChainConfig().KycMinProviders() && evm.ChainConfig().IsKycMinProviders(evm.BlockNumber) {
+			return nil, ErrKycProviderMinimum
+		}
+	}
+	if pt == KycProposalRevokeProvider && !evm.StateDB.KycProviderExists(addr) {
+		return nil, ErrKycInvalidProposal
+	}
+
+	// only new providers come with metadata
+	if (pt != KycProposalAddProvider && len(info) > 0) || !kycValidProviderInfo(info) {
+		return nil, ErrKycInvalidProposal
+	}
+
+	if pt == KycProposalRestrictZones || pt == KycProposalAllowZones {
+		from, to, ok := kycZonePair(addr)
+		if !ok || evm.StateDB.IsKycZoneRestricted(from, to) == (pt == KycProposalRestrictZones) {
+			return nil, ErrKycInvalidProposal
+		}
 	}
 
 	if curCount < 2 {
-		if pt == 1 {
-			evm.StateDB.AddKycProvider(addr)
+		if pt == KycProposalAddProvider {
+			if !evm.StateDB.AddKycProvider(addr) {
+				return nil, ErrKycProviderExists
+			}
 			kycSetDefaultInfoForProvider(evm, addr)
+			evm.StateDB.SetKycProviderInfo(addr, info)
 
-		} else if pt == 2 {
-			evm.StateDB.RemoveKycProvider(addr)
+		} else if pt == KycProposalRemoveProvider {
+			if !kycRemoveProvider(evm, addr) {
+				return nil, ErrKycInvalidProposal
+			}
+		} else if pt == KycProposalRevokeProvider {
+			kycApplyRevokeProposal(evm, addr)
+		} else {
+			kycApplyZoneProposal(evm, addr, pt)
 		}
 		return nil, nil
 	}
 
-	hvAddr, hvTime, hvVoteTotal, _, iVoted, _ := evm.StateDB.GetKycProviderProposol()
+	// before the queue a single proposal is open at a time
+	if !evm.ChainConfig().IsKycProposalQueue(evm.BlockNumber) {
+		if kycProposalOpen(evm, 0) {
+			return nil, ErrKycProposalPending
+		}
+		evm.StateDB.SetKycLegacyProviderProposol(addr, evm.Time, new(big.Int).SetUint64(pt))
+		if !evm.StateDB.SetVoteForKycProviderProposol(0, contract.caller.Address(), 0) {
+			return nil, ErrKycAlreadyVoted
+		}
+		evm.StateDB.SetKycProviderProposolInfo(0, info)
+		return nil, nil
+	}
 
-	//check if the last one is expired or finished .
-	if hvAddr != common.BytesToAddress([]byte{0}) && hvTime.Uint64()+86400 > evm.Time.Uint64() && iVoted.Uint64() <= hvVoteTotal.Uint64()/2 {
-		//still in voting, not expired
-		return nil, ErrOutOfGas
+	// make room for the proposal by dropping the expired ones
+	for _, id := range evm.StateDB.GetKycProviderProposolIds() {
+		if !kycProposalOpen(evm, id) {
+			evm.StateDB.ClearKycProviderProposol(id)
+			continue
+		}
+		//the subject is still in voting
+		if hvAddr, _, _, _, _, _ := evm.StateDB.GetKycProviderProposol(id); hvAddr == addr {
+			return nil, ErrKycProposalPending
+		}
 	}
 
 	ptv := big.NewInt(0)
 	ptv.SetUint64(pt)
-	evm.StateDB.SetKycProviderProposol(addr, evm.Time, ptv)
-	evm.StateDB.SetVoteForKycProviderProposol(contract.caller.Address(), 0)
-	return nil, nil
+	id, ok := evm.StateDB.SetKycProviderProposol(addr, evm.Time, ptv)
+	if !ok {
+		return nil, ErrKycProposalsFull
+	}
+
+	// The proposer always votes for its own proposal. If that can't be recorded,
+	// fail the call so the freshly written proposal is reverted along with it.
+	if !evm.StateDB.SetVoteForKycProviderProposol(id, contract.caller.Address(), 0) {
+		return nil, ErrKycAlreadyVoted
+	}
+	evm.StateDB.SetKycProviderProposolInfo(id, info)
+	return common.BigToHash(new(big.Int).SetUint64(id)).Bytes(), nil
 
 }
 
-func kycVoteForProvider(evm *EVM, contract *Contract, nay uint16) ([]byte, error) {
+// kycVoteForProvider votes on the proposal id, applying or rejecting it as soon
+// as the vote decides it.
+func kycVoteForProvider(evm *EVM, contract *Contract, id uint64, nay uint16) ([]byte, error) {
 
-	hvAddr, hvTime, hvVoteTotal, pt, iVoted, _ := evm.StateDB.GetKycProviderProposol()
-	//check if the last one is expired or finished .
-	if hvAddr != common.BytesToAddress([]byte{0}) && hvTime.Uint64()+86400 > evm.Time.Uint64() && iVoted.Uint64() <= hvVoteTotal.Uint64()/2 {
+	hvAddr, _, hvVoteTotal, pt, _, _ := evm.StateDB.GetKycProviderProposol(id)
+	//check if it is expired or finished .
+	if kycProposalOpen(evm, id) {
 		//still in voting, not expired
-		voteOk := evm.StateDB.SetVoteForKycProviderProposol(contract.caller.Address(), nay)
+		voteOk := evm.StateDB.SetVoteForKycProviderProposol(id, contract.caller.Address(), nay)
 		if !voteOk {
-			return nil, ErrOutOfGas
+			return nil, ErrKycAlreadyVoted
 		}
 
-		_, _, _, _, iVoted, _ := evm.StateDB.GetKycProviderProposol()
-
-		if iVoted.Uint64() > hvVoteTotal.Uint64()/2 {
-			if pt.Int64() == 1 && !evm.StateDB.KycProviderExists(hvAddr) {
-				evm.StateDB.AddKycProvider(hvAddr)
-				kycSetDefaultInfoForProvider(evm, hvAddr)
-			} else if pt.Int64() == 2 && evm.StateDB.KycProviderExists(hvAddr) {
-				evm.StateDB.RemoveKycProvider(hvAddr)
+		_, _, _, _, iVoted, iVotedNo := evm.StateDB.GetKycProviderProposol(id)
+
+		if kycProposalPassed(evm, iVoted.Uint64(), hvVoteTotal.Uint64()) {
+			if pt.Int64() == KycProposalAddProvider {
+				if evm.StateDB.AddKycProvider(hvAddr) {
+					kycSetDefaultInfoForProvider(evm, hvAddr)
+					evm.StateDB.SetKycProviderInfo(hvAddr, evm.StateDB.GetKycProviderProposolInfo(id))
+				}
+			} else if pt.Int64() == KycProposalRemoveProvider {
+				if evm.StateDB.GetKycProviderCount() > evm.ChainConfig().KycMinProviders() || !evm.ChainConfig().IsKycMinProviders(evm.BlockNumber) {
+					kycRemoveProvider(evm, hvAddr)
+				}
+			} else if pt.Int64() == KycProposalRevokeProvider {
+				kycApplyRevokeProposal(evm, hvAddr)
+			} else {
+				kycApplyZoneProposal(evm, hvAddr, pt.Uint64())
 			}
 
-			evm.StateDB.SetKycProviderProposol(common.BytesToAddress([]byte{0}), common.Big0, common.Big0)
+			kycClearProviderProposal(evm, id)
+		} else if evm.ChainConfig().IsKycProposalQueue(evm.BlockNumber) && !kycProposalPassed(evm, hvVoteTotal.Uint64()-iVotedNo.Uint64(), hvVoteTotal.Uint64()) {
+			// Not enough providers left to pass it, reject without waiting for
+			// expiry. The single proposal before the queue awaits its expiry.
+			kycClearProviderProposal(evm, id)
 		}
 
 		return nil, nil
 	}
 
-	return nil, ErrOutOfGas
+	return nil, ErrKycProposalClosed
 }
 
+// KycZonePairAddress packs a pair of zones into the subject of a zone proposal.
+// The leading marker byte keeps the subject from ever being the zero address.
+func KycZonePairAddress(from uint32, to uint32) common.Address {
+	var pair common.Address
+	pair[0] = 0x01
+	binary.BigEndian.PutUint32(pair[12:16], from)
+	binary.BigEndian.PutUint32(pair[16:20], to)
+	return pair
+}
+
+// kycZonePair unpacks the pair of zones of a zone proposal subject.
+func kycZonePair(addr common.Address) (uint32, uint32, bool) {
+	if addr != KycZonePairAddress(binary.BigEndian.Uint32(addr[12:16]), binary.BigEndian.Uint32(addr[16:20])) {
+		return 0, 0, false
+	}
+	return binary.BigEndian.Uint32(addr[12:16]), binary.BigEndian.Uint32(addr[16:20]), true
+}
+
+// kycApplyZoneProposal restricts or allows the pair of zones of an accepted
+// zone proposal.
+func kycApplyZoneProposal(evm *EVM, addr common.Address, pt uint64) {
+	from, to, ok := kycZonePair(addr)
+	if !ok || (pt != KycProposalRestrictZones && pt != KycProposalAllowZones) {
+		return
+	}
+	evm.StateDB.SetKycZoneRestricted(from, to, pt == KycProposalRestrictZones)
+}
+
+// kycProposalPassed reports whether the given number of yes votes out of all
+// providers exceeds the quorum configured for the chain.
+func kycProposalPassed(evm *EVM, yes uint64, total uint64) bool {
+	num, den := evm.ChainConfig().KycQuorum()
+	return yes*den > total*num
+}
+
+// kycProposalOpen reports whether the provider proposal id is still collecting
+// votes, i.e. it is neither expired nor decided.
+func kycProposalOpen(evm *EVM, id uint64) bool {
+	hvAddr, hvTime, hvVoteTotal, _, iVoted, _ := evm.StateDB.GetKycProviderProposol(id)
+	return hvAddr != common.BytesToAddress([]byte{0}) && hvTime.Uint64()+KycProposalLifetime > evm.Time.Uint64() && !kycProposalPassed(evm, iVoted.Uint64(), hvVoteTotal.Uint64())
+}
+
+// kycCancelProviderProposal drops the provider proposal id. An open proposal
+// may only be withdrawn by its proposer, an expired one may be cleaned up by
+// anyone.
+func kycCancelProviderProposal(evm *EVM, contract *Contract, id uint64) ([]byte, error) {
+	hvAddr, _, _, _, _, _ := evm.StateDB.GetKycProviderProposol(id)
+	if hvAddr == common.BytesToAddress([]byte{0}) {
+		return nil, ErrKycUnknownProposal
+	}
+	if kycProposalOpen(evm, id) && contract.caller.Address() != evm.StateDB.GetKycProviderProposolProposer(id) {
+		return nil, ErrKycNotProposer
+	}
+	kycClearProviderProposal(evm, id)
+	return nil, nil
+}
+
+// kycClearProviderProposal drops the provider proposal id. Before the proposal
+// queue fork the single proposal is reset to the zero subject instead.
+func kycClearProviderProposal(evm *EVM, id uint64) {
+	if !evm.ChainConfig().IsKycProposalQueue(evm.BlockNumber) {
+		evm.StateDB.SetKycProviderProposolInfo(id, nil)
+		evm.StateDB.SetKycLegacyProviderProposol(common.Address{}, new(big.Int), new(big.Int))
+		return
+	}
+	evm.StateDB.ClearKycProviderProposol(id)
+}
+
+// kycProposalId returns the proposal id following the other arguments of a
+// call, defaulting to the oldest proposal for callers predating the queue.
+// Before the proposal queue fork the id is ignored, there is only the first.
+func kycProposalId(evm *EVM, input []byte) uint64 {
+	if !evm.ChainConfig().IsKycProposalQueue(evm.BlockNumber) {
+		return 0
+	}
+	if len(input) < 8 {
+		head, _ := evm.StateDB.GetKycProviderProposolRange()
+		return head
+	}
+	return binary.BigEndian.Uint64(input[:8])
+}
+
+// dposRegisterProducer registers from as a block producer. If the chain requires
+// a minimum self-stake, from needs to hold it, and registering again reactivates
+// a producer deactivated for lack of it once topped up. Registrations activating
+// the producer are charged the registration fee.
 func dposRegisterProducer(evm *EVM, contract *Contract, from common.Address, url string) ([]byte, error) {
+	pi := evm.StateDB.GetProducerInfo(&from)
 
+	// a key sealing for another producer can't be a producer by itself
+	if owner := evm.StateDB.GetSigningKeyProducer(from); owner != (common.Address{}) {
+		return nil, ErrDposSigningKeyTaken
+	}
+
+	min := evm.ChainConfig().DposMinProducerStake()
+	if min.Sign() > 0 && evm.StateDB.GetVoterStaking(&from).Cmp(min) < 0 {
+		return nil, ErrDposProducerStake
+	}
+	if pi == nil || (!pi.IsActive && min.Sign() > 0) {
+		if err := dposChargeRegistrationFee(evm, from); err != nil {
+			return nil, err
+		}
+		if pi != nil {
+			evm.StateDB.UpdateProducerActive(&from, true)
+		}
+	}
 	evm.StateDB.RegisterProducer(&from, url)
 	evm.StateDB.SetDposTopProducerElectedDone(common.Big0)
 
 	return nil, nil
 }
 
+// dposSetProducerLocation sets the country or region the producer from operates
+// from, an ISO 3166-1 numeric code.
+func dposSetProducerLocation(evm *EVM, contract *Contract, from common.Address, loc common.ProducerLocation) ([]byte, error) {
+	if evm.StateDB.GetProducerInfo(&from) == nil {
+		return nil, ErrDposInvalidProducer
+	}
+	evm.StateDB.UpdateProducerLocation(&from, loc)
+	return nil, nil
+}
+
+// dposSetSigningKey sets the key sealing the blocks of the producer from, which
+// keeps its own key for its stake and rewards. The zero address, or from itself,
+// restores its own key. The key can't seal for any other producer, currently or
+// as its previous key, nor be one. The change takes effect from the next producer
+// list checkpoint on, the key replaced still sealing during the grace window.
+func dposSetSigningKey(evm *EVM, contract *Contract, from common.Address, key common.Address) ([]byte, error) {
+	if evm.StateDB.GetProducerInfo(&from) == nil {
+		return nil, ErrDposInvalidProducer
+	}
+	if key == from {
+		key = common.Address{}
+	}
+	if key != (common.Address{}) {
+		if owner := evm.StateDB.GetSigningKeyProducer(key); owner != (common.Address{}) && owner != from {
+			return nil, ErrDposSigningKeyTaken
+		}
+		if evm.StateDB.GetProducerInfo(&key) != nil {
+			return nil, ErrDposSigningKeyTaken
+		}
+	}
+	evm.StateDB.SetProducerSigningKey(&from, key, evm.BlockNumber.Uint64(), evm.ChainConfig().DposEpoch())
+	return nil, nil
+}
+
+// dposChargeRegistrationFee takes the registration fee from the balance of from,
+// burning it or escrowing it in the KYC contract until from deregisters. A fee
+// escrowed by an earlier registration covers it.
+func dposChargeRegistrationFee(evm *EVM, from common.Address) error {
+	fee := evm.ChainConfig().DposRegistrationFee()
+	if fee.Sign() <= 0 {
+		return nil
+	}
+	burn := evm.ChainConfig().DposBurnRegistrationFee()
+
+	escrow := evm.StateDB.GetProducerRegistrationFee(&from)
+	if !burn && escrow.Cmp(fee) >= 0 {
+		return nil
+	}
+	if !evm.CanTransfer(evm.StateDB, from, fee) {
+		return ErrDposProducerFee
+	}
+	if !evm.StateDB.TxKycValidate(from, KycContractAddress, fee, evm.BlockNumber, evm.Time.Uint64(), evm.ChainConfig()) {
+		return ErrTxKycValidateFailed
+	}
+	evm.StateDB.SubBalance(from, fee)
+	if !burn {
+		evm.StateDB.AddBalance(KycContractAddress, fee)
+		evm.StateDB.SetProducerRegistrationFee(&from, new(big.Int).Add(escrow, fee))
+	}
+	return nil
+}
+
+// dposUnregisterUnproducer deactivates the producer from, refunding the
+// registration fee escrowed for it.
 func dposUnregisterUnproducer(evm *EVM, contract *Contract, from common.Address) ([]byte, error) {
 	pi := evm.StateDB.GetProducerInfo(&from)
 	if pi != nil && pi.IsActive {
 		evm.StateDB.UpdateProducerActive(&from, false)
 		evm.StateDB.SetDposTopProducerElectedDone(common.Big0)
 	}
+	if fee := evm.StateDB.GetProducerRegistrationFee(&from); fee.Sign() > 0 {
+		evm.StateDB.SubBalance(KycContractAddress, fee)
+		evm.StateDB.AddBalance(from, fee)
+		evm.StateDB.SetProducerRegistrationFee(&from, common.Big0)
+	}
 	return nil, nil
 }
 
-func calcVoteWeight(value *big.Int, ct *big.Int) *big.Int {
+// CalcVoteWeight returns the voting weight of value staked at time ct, doubling
+// every 52 days since the dpos epoch.
+func CalcVoteWeight(value *big.Int, ct *big.Int) *big.Int {
 
 	block_timestamp_epoch := int64(1534154327)
 
@@ -515,25 +1166,59 @@ func calcVoteWeight(value *big.Int, ct *big.Int) *big.Int {
 }
 
 func doChangeProducerVoteingWeight(evm *EVM, from common.Address, newValue *big.Int, ct *big.Int) {
-	vw := calcVoteWeight(newValue, ct)
-	lastVw := evm.StateDB.GetDposVoterLastVoteWeight(&from)
-	pbs := evm.StateDB.GetVoterProducers(&from)
+	vw := CalcVoteWeight(newValue, ct)
+	delta := big.NewInt(0).Sub(vw, evm.StateDB.GetDposVoterLastVoteWeight(&from))
+
+	// the weight of a delegator is cast by its proxy, on the producers of the proxy
+	voter := from
+	if proxy := evm.StateDB.GetVoterProxy(&from); proxy != (common.Address{}) {
+		evm.StateDB.SetDposProxyWeight(&proxy, big.NewInt(0).Add(evm.StateDB.GetDposProxyWeight(&proxy), delta))
+		voter = proxy
+	}
+	dposShiftVotes(evm, evm.StateDB.GetVoterProducers(&voter), delta)
 
+	evm.StateDB.SetDposVoterLastVoteWeight(&from, vw)
+}
+
+// dposShiftVotes adds delta, which may be negative, to the total votes of the
+// producers pbs.
+func dposShiftVotes(evm *EVM, pbs []common.Address, delta *big.Int) {
+	if delta.Sign() == 0 {
+		return
+	}
 	for _, pb := range pbs {
 		pi := evm.StateDB.GetProducerInfo(&pb)
-		pi.TotalVotes = big.NewInt(0).Sub(pi.TotalVotes, lastVw)
-		pi.TotalVotes = big.NewInt(0).Add(pi.TotalVotes, vw)
-		evm.StateDB.UpdateProducerTotalVotes(&pb, pi.TotalVotes)
+		evm.StateDB.UpdateProducerTotalVotes(&pb, big.NewInt(0).Add(pi.TotalVotes, delta))
 	}
+}
 
-	evm.StateDB.SetDposVoterLastVoteWeight(&from, vw)
+// dposVotingPower returns the weight the votes of voter are cast with: its own
+// last vote weight, and the weight delegated to it if it is a proxy.
+func dposVotingPower(evm *EVM, voter common.Address) *big.Int {
+	return big.NewInt(0).Add(evm.StateDB.GetDposVoterLastVoteWeight(&voter), evm.StateDB.GetDposProxyWeight(&voter))
+}
+
+// dposUndelegate revokes the delegation of the votes of from to its proxy, if
+// any, withdrawing its weight from the producers of the proxy. It is left voting
+// for nobody.
+func dposUndelegate(evm *EVM, from common.Address) {
+	proxy := evm.StateDB.GetVoterProxy(&from)
+	if proxy == (common.Address{}) {
+		return
+	}
+	vw := evm.StateDB.GetDposVoterLastVoteWeight(&from)
+
+	evm.StateDB.SetDposProxyWeight(&proxy, big.NewInt(0).Sub(evm.StateDB.GetDposProxyWeight(&proxy), vw))
+	dposShiftVotes(evm, evm.StateDB.GetVoterProducers(&proxy), big.NewInt(0).Neg(vw))
+	evm.StateDB.SetVoterProxy(&from, common.Address{})
 }
 
 func dposIncStake(evm *EVM, contract *Contract, from common.Address, value *big.Int) ([]byte, error) {
 
 	if value.Cmp(common.Big0) <= 0 {
-		return nil, ErrOutOfGas
+		return nil, ErrDposInvalidStake
 	}
+	dposStakeOpsMeter.Mark(1)
 
 	lastVw := evm.StateDB.GetDposVoterLastVoteWeight(&from)
 
@@ -554,19 +1239,20 @@ func dposIncStake(evm *EVM, contract *Contract, from common.Address, value *big.
 
 		// Fail if we're trying to transfer more than the available balance
 		if !evm.CanTransfer(evm.StateDB, from, needValue) {
-			return nil, ErrOutOfGas
+			return nil, ErrDposInsufficientStake
 		}
 
-		if !evm.StateDB.TxKycValidate(from, KycContractAddress, needValue) {
+		if !evm.StateDB.TxKycValidate(from, KycContractAddress, needValue, evm.BlockNumber, evm.Time.Uint64(), evm.ChainConfig()) {
 
-			return nil, ErrOutOfGas
+			return nil, ErrTxKycValidateFailed
 		}
 
 		if needValue.Sign() < 0 {
-			return nil, ErrOutOfGas
+			return nil, ErrDposInvalidStake
 		}
 
 		evm.StateDB.SetRefundRequestInfo(&from, common.Big0, common.Big0)
+		evm.StateDB.CancelDposRefund(&from)
 		evm.StateDB.AddBalance(KycContractAddress, needValue)
 		evm.StateDB.SubBalance(from, needValue)
 
@@ -588,26 +1274,28 @@ func dposIncStake(evm *EVM, contract *Contract, from common.Address, value *big.
 	//evm.StateDB.get
 	evm.StateDB.SetDposTopProducerElectedDone(common.Big0)
 
+	dposAddStakeLog(evm, DposStakeAddedTopic, from, value)
 	return nil, nil
 }
 
 func dposDecStake(evm *EVM, contract *Contract, from common.Address, value *big.Int) ([]byte, error) {
 
 	if value.Cmp(common.Big0) <= 0 {
-		return nil, ErrOutOfGas
+		return nil, ErrDposInvalidStake
 	}
+	dposStakeOpsMeter.Mark(1)
 
 	//don't allow dec stake if not activated
 	//
 	totalActivatedState := evm.StateDB.GetDposTotalActivatedStake()
 	if totalActivatedState.Cmp(DposActivatedStakeThreshold) < 0 {
-		return nil, ErrOutOfGas
+		return nil, ErrDposStakeInactive
 	}
 
 	oldValue := evm.StateDB.GetVoterStaking(&from)
 	//import check .
 	if oldValue.Cmp(value) < 0 {
-		return nil, ErrOutOfGas
+		return nil, ErrDposStakeBelowRefund
 	}
 
 	newValue := big.NewInt(0).Sub(oldValue, value)
@@ -615,22 +1303,28 @@ func dposDecStake(evm *EVM, contract *Contract, from common.Address, value *big.
 
 	doChangeProducerVoteingWeight(evm, from, newValue, evm.Time)
 
+	// producers falling below the minimum self-stake are deactivated
+	if min := evm.ChainConfig().DposMinProducerStake(); min.Sign() > 0 && newValue.Cmp(min) < 0 {
+		if pi := evm.StateDB.GetProducerInfo(&from); pi != nil && pi.IsActive {
+			evm.StateDB.UpdateProducerActive(&from, false)
+		}
+	}
+
 	stake, _ := evm.StateDB.GetRefundRequestInfo(&from)
 	stake = big.NewInt(0).Add(stake, value)
 	evm.StateDB.SetRefundRequestInfo(&from, stake, evm.Time)
 
+	// the request restarted the lock, so the voter moves to the end of the queue
+	if evm.StateDB.GetDposAutoRefund(&from) {
+		evm.StateDB.PushDposRefund(&from)
+	}
 	evm.StateDB.SetDposTopProducerElectedDone(common.Big0)
 
+	dposAddStakeLog(evm, DposStakeSubtractedTopic, from, value)
 	return nil, nil
 }
 
 func dposVoteForProducer(evm *EVM, contract *Contract, from common.Address, tos []common.Address) ([]byte, error) {
-
-	evm.StateDB.SetDposTopProducerElectedDone(common.Big0)
-
-	//cancel the old voting for old producers
-	doChangeProducerVoteingWeight(evm, from, common.Big0, evm.Time)
-
 	validPbs := make([]common.Address, 0)
 
 	for _, pb := range tos {
@@ -639,12 +1333,144 @@ func dposVoteForProducer(evm *EVM, contract *Contract, from common.Address, tos
 			validPbs = append(validPbs, pb)
 		}
 	}
+	// Reject the vote before touching any weight, keeping the previous one intact
+	if len(validPbs) > evm.ChainConfig().DposMaxVotes() && evm.ChainConfig().IsDposVoteLimit(evm.BlockNumber) {
+		return nil, ErrDposTooManyVotes
+	}
+	evm.StateDB.SetDposTopProducerElectedDone(common.Big0)
+
+	// voting by itself revokes the delegation of the voter
+	dposUndelegate(evm, from)
+
+	// the weight delegated to a proxy moves along with its own
+	delegated := evm.StateDB.GetDposProxyWeight(&from)
+	dposShiftVotes(evm, evm.StateDB.GetVoterProducers(&from), big.NewInt(0).Neg(delegated))
+
+	//cancel the old voting for old producers
+	doChangeProducerVoteingWeight(evm, from, common.Big0, evm.Time)
 
 	evm.StateDB.SetVoterProducers(&from, validPbs)
 
 	newValue := evm.StateDB.GetVoterStaking(&from)
 
 	doChangeProducerVoteingWeight(evm, from, newValue, evm.Time)
+	dposShiftVotes(evm, evm.StateDB.GetVoterProducers(&from), delegated)
+
+	return nil, nil
+}
+
+// dposChangeVote adds producer to the producers voted for by from, or removes it,
+// leaving the other votes in place. The weight of the votes is brought up to date
+// first, so the outcome is the same as a full vote for the resulting list. Like
+// the latter, voting for a producer revokes the delegation of the voter.
+func dposChangeVote(evm *EVM, contract *Contract, from common.Address, producer common.Address, add bool) ([]byte, error) {
+	pbs := evm.StateDB.GetVoterProducers(&from)
+
+	index := -1
+	for i, pb := range pbs {
+		if pb == producer {
+			index = i
+			break
+		}
+	}
+	// Adding a vote twice or removing a missing one changes nothing
+	if add == (index >= 0) {
+		return nil, nil
+	}
+	if add {
+		if pi := evm.StateDB.GetProducerInfo(&producer); pi == nil || !pi.IsActive {
+			return nil, ErrDposInvalidProducer
+		}
+		if len(pbs) >= evm.ChainConfig().DposMaxVotes() {
+			return nil, ErrDposTooManyVotes
+		}
+	}
+	evm.StateDB.SetDposTopProducerElectedDone(common.Big0)
+
+	dposUndelegate(evm, from)
+	doChangeProducerVoteingWeight(evm, from, evm.StateDB.GetVoterStaking(&from), evm.Time)
+	vw := dposVotingPower(evm, from)
+
+	votes := new(big.Int)
+	if pi := evm.StateDB.GetProducerInfo(&producer); pi != nil {
+		votes = pi.TotalVotes
+	}
+	if add {
+		pbs = append(pbs, producer)
+		votes = new(big.Int).Add(votes, vw)
+	} else {
+		pbs = append(pbs[:index], pbs[index+1:]...)
+		votes = new(big.Int).Sub(votes, vw)
+	}
+	evm.StateDB.UpdateProducerTotalVotes(&producer, votes)
+	evm.StateDB.SetVoterProducers(&from, pbs)
+
+	return nil, nil
+}
+
+// dposRegisterProxy registers from as a vote proxy others may delegate their
+// votes to, or unregisters it. Unregistering releases every delegator, charging
+// dposProxyDelegatorGas for each, and leaves them voting for nobody.
+func dposRegisterProxy(evm *EVM, contract *Contract, from common.Address, register bool) ([]byte, error) {
+	if register == evm.StateDB.IsDposProxy(&from) {
+		return nil, nil
+	}
+	if register {
+		// a proxy can't delegate its votes, so delegators can't become proxies
+		if evm.StateDB.GetVoterProxy(&from) != (common.Address{}) {
+			return nil, ErrDposProxyChain
+		}
+		evm.StateDB.SetDposProxy(&from, true)
+		return nil, nil
+	}
+	for _, delegator := range evm.StateDB.GetDposProxyDelegators(&from) {
+		if !contract.UseGas(dposProxyDelegatorGas) {
+			return nil, ErrOutOfGas
+		}
+		evm.StateDB.SetVoterProxy(&delegator, common.Address{})
+	}
+	delegated := evm.StateDB.GetDposProxyWeight(&from)
+	dposShiftVotes(evm, evm.StateDB.GetVoterProducers(&from), big.NewInt(0).Neg(delegated))
+
+	evm.StateDB.SetDposProxyWeight(&from, common.Big0)
+	evm.StateDB.SetDposProxy(&from, false)
+	evm.StateDB.SetDposTopProducerElectedDone(common.Big0)
+
+	return nil, nil
+}
+
+// dposSetProxy delegates the votes of from to proxy, which has to be a registered
+// proxy, replacing the producers voted for by from. The zero address revokes the
+// delegation. Proxies can't delegate in turn, so delegations never form chains,
+// let alone cycles.
+func dposSetProxy(evm *EVM, contract *Contract, from common.Address, proxy common.Address) ([]byte, error) {
+	if proxy == evm.StateDB.GetVoterProxy(&from) {
+		return nil, nil
+	}
+	if proxy != (common.Address{}) {
+		if !evm.StateDB.IsDposProxy(&proxy) {
+			return nil, ErrDposNotProxy
+		}
+		if evm.StateDB.IsDposProxy(&from) {
+			return nil, ErrDposProxyChain
+		}
+	}
+	evm.StateDB.SetDposTopProducerElectedDone(common.Big0)
+
+	doChangeProducerVoteingWeight(evm, from, evm.StateDB.GetVoterStaking(&from), evm.Time)
+	dposUndelegate(evm, from)
+
+	// the delegation replaces the votes of the delegator
+	vw := evm.StateDB.GetDposVoterLastVoteWeight(&from)
+	dposShiftVotes(evm, evm.StateDB.GetVoterProducers(&from), big.NewInt(0).Neg(vw))
+	evm.StateDB.SetVoterProducers(&from, nil)
+
+	if proxy == (common.Address{}) {
+		return nil, nil
+	}
+	evm.StateDB.SetVoterProxy(&from, proxy)
+	evm.StateDB.SetDposProxyWeight(&proxy, big.NewInt(0).Add(evm.StateDB.GetDposProxyWeight(&proxy), vw))
+	dposShiftVotes(evm, evm.StateDB.GetVoterProducers(&proxy), vw)
 
 	return nil, nil
 }
@@ -653,67 +1479,316 @@ func dposRefund(evm *EVM, contract *Contract, from common.Address) ([]byte, erro
 
 	stake, st := evm.StateDB.GetRefundRequestInfo(&from)
 
-	if stake != common.Big0 && evm.Time.Uint64() > st.Uint64()+86400*3 {
+	if stake != common.Big0 && evm.Time.Uint64() > st.Uint64()+DposRefundDelay {
 
 		// Fail if we're trying to transfer more than the available balance
 		if !evm.CanTransfer(evm.StateDB, KycContractAddress, stake) {
-			return nil, ErrOutOfGas
+			return nil, ErrDposInsufficientRefund
 		}
 
-		if !evm.StateDB.TxKycValidate(KycContractAddress, from, stake) {
+		if !evm.StateDB.TxKycValidate(KycContractAddress, from, stake, evm.BlockNumber, evm.Time.Uint64(), evm.ChainConfig()) {
 
-			return nil, ErrOutOfGas
+			return nil, ErrTxKycValidateFailed
 		}
 
 		evm.StateDB.SetRefundRequestInfo(&from, common.Big0, common.Big0)
+		evm.StateDB.CancelDposRefund(&from)
 		evm.StateDB.AddBalance(from, stake)
 		evm.StateDB.SubBalance(KycContractAddress, stake)
+
+		dposAddStakeLog(evm, DposStakeRefundedTopic, from, stake)
 		return nil, nil
 	}
-	return nil, ErrOutOfGas
+	return nil, ErrDposRefundNotDue
+}
+
+// dposSetAutoRefund opts from in or out of having its matured refunds paid out
+// automatically. A refund already pending is queued right away, moving to the
+// end of the queue if it was queued before.
+func dposSetAutoRefund(evm *EVM, contract *Contract, from common.Address, enable bool) ([]byte, error) {
+	evm.StateDB.SetDposAutoRefund(&from, enable)
+
+	if !enable {
+		evm.StateDB.CancelDposRefund(&from)
+	} else if stake, _ := evm.StateDB.GetRefundRequestInfo(&from); stake.Sign() > 0 {
+		evm.StateDB.PushDposRefund(&from)
+	}
+	return nil, nil
+}
+
+// DposPayoutRefunds pays out the matured refunds at the head of the refund queue
+// at the end of a block, emitting the same log as a claim would, without a
+// transaction. At most DposAutoRefundsPerBlock entries are processed, skipped
+// ones included, keeping the work of a block bounded. Since refunds are queued
+// as they are requested, the first one not matured yet ends the payout. Refunds
+// that can't be paid out are left to be claimed.
+//
+// Not being part of any receipt, the logs of the payouts are only delivered as
+// chain events to log subscriptions, won_getLogs doesn't return them.
+func DposPayoutRefunds(statedb StateDB, config *params.ChainConfig, header *types.Header) {
+	for i := uint64(0); i < config.DposAutoRefundsPerBlock(); i++ {
+		addr, live, ok := statedb.PeekDposRefund()
+		if !ok {
+			return
+		}
+		if live {
+			stake, st := statedb.GetRefundRequestInfo(&addr)
+			if stake.Sign() > 0 {
+				if header.Time.Uint64() <= st.Uint64()+DposRefundDelay {
+					return
+				}
+				if statedb.GetBalance(KycContractAddress).Cmp(stake) >= 0 &&
+					statedb.TxKycValidate(KycContractAddress, addr, stake, header.Number, header.Time.Uint64(), config) {
+
+					statedb.SetRefundRequestInfo(&addr, common.Big0, common.Big0)
+					statedb.AddBalance(addr, stake)
+					statedb.SubBalance(KycContractAddress, stake)
+
+					if config.IsDposStakeLog(header.Number) {
+						statedb.AddLog(&types.Log{
+							Address:     KycContractAddress,
+							Topics:      []common.Hash{DposStakeRefundedTopic, addr.Hash()},
+							Data:        common.BigToHash(stake).Bytes(),
+							BlockNumber: header.Number.Uint64(),
+						})
+					}
+				}
+			}
+		}
+		statedb.PopDposRefund()
+	}
+}
+
+// kycMethodNames are the names the KYC precompile methods are traced by.
+var kycMethodNames = map[uint32]string{
+	KycMethodSet:                  "setKyc",
+	KycMethodProviderVoteProposal: "proposal",
+	KycMethodVote:                 "vote",
+	DposMethodRegProds:            "registerProducer",
+	DposMethodRmvProds:            "unregisterProducer",
+	DposMethodAddStake:            "addStake",
+	DposMethodSubStake:            "subStake",
+	DposMethodProdsVote:           "voteProducers",
+	DposMethodRefund:              "refund",
+	DposMethodSetAutoRefund:       "setAutoRefund",
+	KycMethodCancelProposal:       "cancelProposal",
+	KycMethodSetBatch:             "setKycBatch",
+	KycMethodGetLevelThresholds:   "getLevelThresholds",
+	KycMethodGetProviderInfo:      "getProviderInfo",
+	DposMethodAddVote:             "addVote",
+	DposMethodRemoveVote:          "removeVote",
+	DposMethodRegProxy:            "registerProxy",
+	DposMethodSetProxy:            "setProxy",
+	DposMethodSetLocation:         "setLocation",
+	DposMethodSetSigningKey:       "setSigningKey",
+	KycMethodConfirm:              "confirmKyc",
+}
+
+// KycChainBound is set in the method id of inputs of the KYC precompile bound to
+// a chain, which carry the id of the chain in a word after their arguments.
+const KycChainBound = 0x80000000
+
+// SplitKycInput splits the chain id off a chain bound input of the KYC
+// precompile, returning the input as if it were unbound along with the chain
+// id. Other inputs are returned as they are, without a chain id.
+func SplitKycInput(input []byte) ([]byte, *big.Int) {
+	if len(input) < 4+32 || binary.BigEndian.Uint32(input)&KycChainBound == 0 {
+		return input, nil
+	}
+	unbound := common.CopyBytes(input[:len(input)-32])
+	binary.BigEndian.PutUint32(unbound, binary.BigEndian.Uint32(input)&^KycChainBound)
+
+	return unbound, new(big.Int).SetBytes(input[len(input)-32:])
+}
+
+// BindKycInput binds an input of the KYC precompile to the chain chainID, so it
+// can't be replayed on other networks.
+func BindKycInput(input []byte, chainID *big.Int) []byte {
+	bound := append(common.CopyBytes(input), common.BigToHash(chainID).Bytes()...)
+	binary.BigEndian.PutUint32(bound, binary.BigEndian.Uint32(input)|KycChainBound)
+	return bound
+}
+
+// kycValueMethods are the KYC precompile methods value may be sent along with.
+var kycValueMethods = map[uint32]bool{
+	DposMethodAddStake: true,
+	DposMethodSubStake: true,
+}
+
+// kycMethodForks are the forks the KYC precompile methods added since its launch
+// are active from. Before its fork a method is unknown, as it always was. Every
+// new method goes in here, unless its dispatch below checks the fork itself, as
+// KycMethodConfirm does.
+var kycMethodForks = map[uint32]func(*params.ChainConfig, *big.Int) bool{
+	KycMethodCancelProposal:     (*params.ChainConfig).IsKycProposalCancel,
+	KycMethodSetBatch:           (*params.ChainConfig).IsKycSetBatch,
+	KycMethodGetLevelThresholds: (*params.ChainConfig).IsKycThresholdQuery,
+	KycMethodGetProviderInfo:    (*params.ChainConfig).IsKycProviderInfo,
+	DposMethodAddVote:           (*params.ChainConfig).IsDposVoteChange,
+	DposMethodRemoveVote:        (*params.ChainConfig).IsDposVoteChange,
+	DposMethodRegProxy:          (*params.ChainConfig).IsDposProxy,
+	DposMethodSetProxy:          (*params.ChainConfig).IsDposProxy,
+	DposMethodSetLocation:       (*params.ChainConfig).IsDposLocation,
+	DposMethodSetAutoRefund:     (*params.ChainConfig).IsDposAutoRefund,
+	DposMethodSetSigningKey:     (*params.ChainConfig).IsDposSigningKey,
+}
+
+// KycMethodName returns the name of the KYC precompile method id, or "unknown"
+// if the precompile has no such method.
+func KycMethodName(id uint32) string {
+	if name, ok := kycMethodNames[id]; ok {
+		return name
+	}
+	return "unknown"
 }
 
-func kycExecute(evm *EVM, contract *Contract, input []byte) ([]byte, error) {
+func kycExecute(evm *EVM, contract *Contract, input []byte) (ret []byte, err error) {
 
 	if input == nil || len(input) < 4 {
-		//for transfer value only
+		// The balance of the precompile backs the stakes and escrowed fees, so
+		// bare transfers, which nothing could ever pay out, are rejected
+		if contract.Value().Sign() > 0 && evm.ChainConfig().IsKycCallRestriction(evm.BlockNumber) {
+			return nil, ErrKycValueTransfer
+		}
 		return nil, nil
 	}
+	if metrics.Enabled {
+		defer kycExecTimer.UpdateSince(time.Now())
+	}
+
+	if tracer := evm.vmConfig.PrecompileTracer; tracer != nil {
+		snapshot := evm.StateDB.Snapshot()
+		defer func() {
+			tracer.CapturePrecompile(evm, &PrecompileLog{
+				Caller:  contract.caller.Address(),
+				Method:  KycMethodName(binary.BigEndian.Uint32(input[0:4])),
+				Input:   common.CopyBytes(input),
+				Storage: evm.StateDB.StorageChanges(KycContractAddress, snapshot),
+				Depth:   evm.depth + 1,
+				Err:     err,
+			})
+		}()
+	}
 
 	if contract.UseGas(3000) {
 
-		if evm.StateDB.IsContractAddress(contract.caller.Address()) {
-			return nil, ErrOutOfGas
+		// Calls bound to a chain are only valid on that one, once binding them
+		// is possible at all
+		if unbound, chainID := SplitKycInput(input); chainID != nil {
+			if !evm.ChainConfig().IsKycChainBinding(evm.BlockNumber) {
+				return nil, ErrKycUnknownMethod
+			}
+			if id := evm.ChainConfig().ChainId; id == nil || id.Cmp(chainID) != 0 {
+				return nil, ErrKycChainMismatch
+			}
+			input = unbound
 		}
-
 		funcid := binary.BigEndian.Uint32(input[0:4])
+		if active, ok := kycMethodForks[funcid]; ok && !active(evm.ChainConfig(), evm.BlockNumber) {
+			return nil, ErrKycUnknownMethod
+		}
+		if evm.ChainConfig().IsKycCallRestriction(evm.BlockNumber) {
+			if _, ok := kycMethodNames[funcid]; !ok {
+				return nil, ErrKycUnknownMethod
+			}
+			// only the staking methods move funds, taking them from the balance
+			// of the caller explicitly; value sent along any other call is
+			// rejected instead of being stranded in the precompile
+			if contract.Value().Sign() > 0 && !kycValueMethods[funcid] {
+				return nil, ErrKycValueTransfer
+			}
+		}
+
+		// the level thresholds are public, so contracts may read them too
+		if funcid == KycMethodGetLevelThresholds {
+			return kycGetLevelThresholds(evm), nil
+		}
+		// so is the metadata of the providers
+		if funcid == KycMethodGetProviderInfo {
+			if len(input) < 24 {
+				return nil, ErrKycInvalidInput
+			}
+			return evm.StateDB.GetKycProviderInfoBlob(common.BytesToAddress(input[4:24])), nil
+		}
+
+		// Everything else modifies the state, which read-only calls may not
+		if evm.interpreter.readOnly && evm.ChainConfig().IsKycCallRestriction(evm.BlockNumber) {
+			return nil, ErrWriteProtection
+		}
+		// It also governs or moves funds, so it's reserved to the sender
+		// of the transaction calling the precompile directly. Contracts calling
+		// in, delegating or running their constructors aren't the origin.
+		// Before the call restriction fork only callers with code are refused.
+		caller := contract.caller.Address()
+		if evm.StateDB.IsContractAddress(caller) {
+			return nil, ErrKycContractCaller
+		}
+		if caller != evm.Origin && evm.ChainConfig().IsKycCallRestriction(evm.BlockNumber) {
+			return nil, ErrKycContractCaller
+		}
+
 		if funcid == KycMethodSet {
 			if !evm.StateDB.KycProviderExists(contract.caller.Address()) {
-				return nil, ErrOutOfGas
+				return nil, ErrKycNotProvider
 			}
 
-			address := common.BytesToAddress(input[4:24])
-
+			address, level, zone, expiresAt, err := kycAttestationArgs(evm, input)
+			if err != nil {
+				return nil, err
+			}
 			if pd := evm.StateDB.GetKycProvider(address); pd != (common.Address{}) && pd != contract.caller.Address() {
-				return nil, ErrOutOfGas
+				return nil, ErrKycOtherProvider
 			}
-
-			level := binary.BigEndian.Uint32(input[24:28])
-			zone := binary.BigEndian.Uint32(input[28:32])
-			return kycSetForAddress(evm, contract, address, level, zone)
+			return kycAttest(evm, contract, address, level, zone, expiresAt)
+		} else if funcid == KycMethodConfirm {
+			// there is nothing to confirm unless attestations need a second provider
+			if !evm.ChainConfig().IsKycDualAttestation(evm.BlockNumber) {
+				return nil, ErrKycUnknownMethod
+			}
+			if !evm.StateDB.KycProviderExists(contract.caller.Address()) {
+				return nil, ErrKycNotProvider
+			}
+			address, level, zone, expiresAt, err := kycAttestationArgs(evm, input)
+			if err != nil {
+				return nil, err
+			}
+			return kycConfirm(evm, contract, address, level, zone, expiresAt)
 		} else if funcid == KycMethodProviderVoteProposal {
 			if !evm.StateDB.KycProviderExists(contract.caller.Address()) {
-				return nil, ErrOutOfGas
+				return nil, ErrKycNotProvider
+			}
+			if len(input) < 32 {
+				return nil, ErrKycInvalidInput
 			}
 			address := common.BytesToAddress(input[4:24])
-			pt := binary.BigEndian.Uint64(input[24:])
-			return kycStartProviderProposal(evm, contract, address, pt)
+			pt := binary.BigEndian.Uint64(input[24:32])
+
+			// the metadata of a new provider may follow the proposal type, any
+			// bytes there were ignored before the provider info fork
+			var info []byte
+			if evm.ChainConfig().IsKycProviderInfo(evm.BlockNumber) {
+				info = input[32:]
+			}
+			return kycStartProviderProposal(evm, contract, address, pt, info)
 		} else if funcid == KycMethodVote {
 			if !evm.StateDB.KycProviderExists(contract.caller.Address()) {
-				return nil, ErrOutOfGas
+				return nil, ErrKycNotProvider
 			}
-			nay := binary.BigEndian.Uint16(input[4:])
-			return kycVoteForProvider(evm, contract, nay)
+			if len(input) < 6 {
+				return nil, ErrKycInvalidInput
+			}
+			nay := binary.BigEndian.Uint16(input[4:6])
+			return kycVoteForProvider(evm, contract, kycProposalId(evm, input[6:]), nay)
+		} else if funcid == KycMethodCancelProposal {
+			if !evm.StateDB.KycProviderExists(contract.caller.Address()) {
+				return nil, ErrKycNotProvider
+			}
+			return kycCancelProviderProposal(evm, contract, kycProposalId(evm, input[4:]))
+		} else if funcid == KycMethodSetBatch {
+			if !evm.StateDB.KycProviderExists(contract.caller.Address()) {
+				return nil, ErrKycNotProvider
+			}
+			return kycSetBatch(evm, contract, input[4:])
 		} else if funcid == DposMethodRegProds {
 			url := string(input[4:])
 			return dposRegisterProducer(evm, contract, contract.caller.Address(), url)
@@ -738,8 +1813,51 @@ func kycExecute(evm *EVM, contract *Contract, input []byte) ([]byte, error) {
 			return dposVoteForProducer(evm, contract, contract.caller.Address(), tos)
 		} else if funcid == DposMethodRefund {
 			return dposRefund(evm, contract, contract.caller.Address())
+		} else if funcid == DposMethodAddVote || funcid == DposMethodRemoveVote {
+			if len(input) < 24 {
+				return nil, ErrKycInvalidInput
+			}
+			producer := common.BytesToAddress(input[4:24])
+			return dposChangeVote(evm, contract, contract.caller.Address(), producer, funcid == DposMethodAddVote)
+		} else if funcid == DposMethodRegProxy {
+			// a zero flag unregisters the proxy
+			register := len(input) < 5 || input[4] != 0
+			return dposRegisterProxy(evm, contract, contract.caller.Address(), register)
+		} else if funcid == DposMethodSetProxy {
+			// no proxy revokes the delegation
+			var proxy common.Address
+			if len(input) > 4 {
+				if len(input) < 24 {
+					return nil, ErrKycInvalidInput
+				}
+				proxy = common.BytesToAddress(input[4:24])
+			}
+			return dposSetProxy(evm, contract, contract.caller.Address(), proxy)
+		} else if funcid == DposMethodSetLocation {
+			if len(input) < 6 {
+				return nil, ErrKycInvalidInput
+			}
+			loc := common.ProducerLocation(binary.BigEndian.Uint16(input[4:6]))
+			if loc > common.MaxProducerLocation {
+				return nil, ErrKycInvalidInput
+			}
+			return dposSetProducerLocation(evm, contract, contract.caller.Address(), loc)
+		} else if funcid == DposMethodSetAutoRefund {
+			// a zero flag opts out
+			enable := len(input) < 5 || input[4] != 0
+			return dposSetAutoRefund(evm, contract, contract.caller.Address(), enable)
+		} else if funcid == DposMethodSetSigningKey {
+			// no key restores the own key of the producer
+			var key common.Address
+			if len(input) > 4 {
+				if len(input) < 24 {
+					return nil, ErrKycInvalidInput
+				}
+				key = common.BytesToAddress(input[4:24])
+			}
+			return dposSetSigningKey(evm, contract, contract.caller.Address(), key)
 		}
-
+		return nil, ErrKycUnknownMethod
 	}
 	return nil, ErrOutOfGas
 }
@@ -17,11 +17,15 @@
 package vm
 
 import (
+	"bytes"
 	"fmt"
 	"math/big"
+	"reflect"
 	"testing"
 
 	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/params"
 )
 
 // precompiledTest defines the input/output pairs for precompiled contract tests.
@@ -336,8 +340,113 @@ var bn256PairingTests = []precompiledTest{
 	},
 }
 
+// blake2FTests are the test and benchmark data for the blake2b compression
+// precompiled contract, being the valid test vectors of EIP 152. Vector 8 of
+// 2^32-1 rounds is left out for its running time, only its gas is checked.
+var blake2FTests = []precompiledTest{
+	{
+		input: "0000000048c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f" +
+			"3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e13" +
+			"19cde05b61626300000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"000000000300000000000000000000000000000001",
+		expected: "08c9bcf367e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f3af54fa5" +
+			"d282e6ad7f520e511f6c3e2b8c68059b9442be0454267ce079217e1319cde05b",
+		gas:  0,
+		name: "vector 4",
+	},
+	{
+		input: "0000000c48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f" +
+			"3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e13" +
+			"19cde05b61626300000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"000000000300000000000000000000000000000001",
+		expected: "ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d1" +
+			"7d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923",
+		gas:  1,
+		name: "vector 5",
+	},
+	{
+		input: "0000000c48c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f" +
+			"3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e13" +
+			"19cde05b61626300000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"000000000300000000000000000000000000000000",
+		expected: "75ab69d3190a562c51aef8d88f1c2775876944407270c42c9844252c26d28752" +
+			"98743e7f6d5ea2f2d3e8d226039cd31b4e426ac4f2d3d666a610c2116fde4735",
+		gas:  1,
+		name: "vector 6",
+	},
+	{
+		input: "0000000148c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f" +
+			"3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e13" +
+			"19cde05b61626300000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"000000000300000000000000000000000000000001",
+		expected: "b63a380cb2897d521994a85234ee2c181b5f844d2c624c002677e9703449d2fb" +
+			"a551b3a8333bcdf5f2f7e08993d53923de3d64fcc68c034e717b9293fed7a421",
+		gas:  1,
+		name: "vector 7",
+	},
+}
+
+// blake2FMalformedTests are the inputs of EIP 152 the blake2b compression
+// precompiled contract has to reject.
+var blake2FMalformedTests = []struct {
+	input string
+	err   error
+	name  string
+}{
+	{
+		input: "",
+		err:   errBlake2FInvalidInputLength,
+		name:  "vector 0: empty input",
+	},
+	{
+		input: "0000000048c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f" +
+			"3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e13" +
+			"19cde05b61626300000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000003000000000000000000000000000000",
+		err:  errBlake2FInvalidInputLength,
+		name: "vector 1: less than 213 bytes input",
+	},
+	{
+		input: "0000000048c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f" +
+			"3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e13" +
+			"19cde05b61626300000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"00000000030000000000000000000000000000000102",
+		err:  errBlake2FInvalidInputLength,
+		name: "vector 2: more than 213 bytes input",
+	},
+	{
+		input: "0000000048c9bdf267e6096a3ba7ca8485ae67bb2bf894fe72f36e3cf1361d5f" +
+			"3af54fa5d182e6ad7f520e511f6c3e2b8c68059b6bbd41fbabd9831f79217e13" +
+			"19cde05b61626300000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"0000000000000000000000000000000000000000000000000000000000000000" +
+			"000000000300000000000000000000000000000002",
+		err:  errBlake2FInvalidFinalFlag,
+		name: "vector 3: malformed final block indicator flag",
+	},
+}
+
 func testPrecompiled(addr string, test precompiledTest, t *testing.T) {
-	p := PrecompiledContractsByzantium[common.HexToAddress(addr)]
+	p := PrecompiledContractsWON[common.HexToAddress(addr)]
 	in := common.Hex2Bytes(test.input)
 	contract := NewContract(AccountRef(common.HexToAddress("1337")),
 		nil, new(big.Int), p.RequiredGas(in))
@@ -354,7 +463,7 @@ func benchmarkPrecompiled(addr string, test precompiledTest, bench *testing.B) {
 	if test.noBenchmark {
 		return
 	}
-	p := PrecompiledContractsByzantium[common.HexToAddress(addr)]
+	p := PrecompiledContractsWON[common.HexToAddress(addr)]
 	in := common.Hex2Bytes(test.input)
 	reqGas := p.RequiredGas(in)
 	contract := NewContract(AccountRef(common.HexToAddress("1337")),
@@ -481,3 +590,121 @@ func BenchmarkPrecompiledBn256Pairing(bench *testing.B) {
 		benchmarkPrecompiled("08", test, bench)
 	}
 }
+
+// Tests the sample inputs from the blake2b compression precompile EIP 152.
+func TestPrecompiledBlake2F(t *testing.T) {
+	p := PrecompiledContractsWON[Blake2FContractAddress]
+	for _, test := range blake2FTests {
+		testPrecompiled("0c", test, t)
+
+		if gas := p.RequiredGas(common.Hex2Bytes(test.input)); gas != test.gas {
+			t.Errorf("%s: gas mismatch: have %d, want %d", test.name, gas, test.gas)
+		}
+	}
+	// The gas of the maximum number of rounds is still priced per the spec
+	input := common.Hex2Bytes("ffffffff" + blake2FTests[0].input[8:])
+	if gas, want := p.RequiredGas(input), uint64(4294968); gas != want {
+		t.Errorf("vector 8: gas mismatch: have %d, want %d", gas, want)
+	}
+	for _, test := range blake2FMalformedTests {
+		if _, err := p.Run(common.Hex2Bytes(test.input)); err != test.err {
+			t.Errorf("%s: error mismatch: have %v, want %v", test.name, err, test.err)
+		}
+	}
+}
+
+// Benchmarks the sample inputs from the blake2b compression precompile EIP 152.
+func BenchmarkPrecompiledBlake2F(bench *testing.B) {
+	for _, test := range blake2FTests {
+		benchmarkPrecompiled("0c", test, bench)
+	}
+}
+
+// Tests that the precompiles of a fork are only active from its block on.
+func TestActivePrecompiles(t *testing.T) {
+	config := &params.ChainConfig{Blake2FBlock: big.NewInt(10)}
+
+	tests := []struct {
+		number *big.Int
+		config *params.ChainConfig
+		want   map[common.Address]PrecompiledContract
+	}{
+		{big.NewInt(10), nil, PrecompiledContractsByzantium},
+		{nil, config, PrecompiledContractsByzantium},
+		{big.NewInt(9), config, PrecompiledContractsByzantium},
+		{big.NewInt(10), config, PrecompiledContractsWON},
+		{big.NewInt(11), config, PrecompiledContractsWON},
+	}
+	for i, tt := range tests {
+		if have := ActivePrecompiles(tt.number, tt.config); reflect.ValueOf(have).Pointer() != reflect.ValueOf(tt.want).Pointer() {
+			t.Errorf("test %d: precompile set mismatch: have %d contracts, want %d", i, len(have), len(tt.want))
+		}
+	}
+}
+
+// Tests that the batch ecrecover precompile recovers every signer of a batch
+// the same as ecrecover does one by one, and prices the batch per signature.
+func TestPrecompiledEcrecoverBatch(t *testing.T) {
+	p := PrecompiledContractsWON[EcrecoverBatchContractAddress]
+
+	// Sign a hash with a few keys, encoding the signatures as ecrecover inputs
+	hash := crypto.Keccak256([]byte("attestation"))
+
+	var (
+		input   []byte
+		signers []common.Address
+	)
+	for i := 0; i < 3; i++ {
+		key, _ := crypto.GenerateKey()
+		sig, err := crypto.Sign(hash, key)
+		if err != nil {
+			t.Fatalf("failed to sign hash: %v", err)
+		}
+		input = append(input, hash...)
+		input = append(input, common.LeftPadBytes([]byte{sig[64] + 27}, 32)...)
+		input = append(input, sig[:64]...)
+		signers = append(signers, crypto.PubkeyToAddress(key.PublicKey))
+	}
+	// An invalid v of the second signature, and the high s twin of the third
+	invalid := common.CopyBytes(input[128:256])
+	invalid[63] = 29
+
+	malleable := common.CopyBytes(input[256:384])
+	malleable[63] ^= 1
+	s := new(big.Int).Sub(crypto.S256().Params().N, new(big.Int).SetBytes(malleable[96:128]))
+	copy(malleable[96:128], common.LeftPadBytes(s.Bytes(), 32))
+
+	tests := []struct {
+		input []byte
+		want  []common.Address
+	}{
+		{nil, nil},
+		{input, signers},
+		{append(common.CopyBytes(input[:128]), invalid...), []common.Address{signers[0], {}}},
+		{malleable, nil}, // filled in from ecrecover below
+	}
+	single, _ := new(ecrecover).Run(common.CopyBytes(malleable))
+	tests[3].want = []common.Address{common.BytesToAddress(single)}
+
+	for i, tt := range tests {
+		if gas, want := p.RequiredGas(tt.input), params.EcrecoverBatchBaseGas+uint64(len(tt.want))*params.EcrecoverBatchPerSigGas; gas != want {
+			t.Errorf("test %d: gas mismatch: have %d, want %d", i, gas, want)
+		}
+		output, err := p.Run(tt.input)
+		if err != nil {
+			t.Errorf("test %d: failed to recover batch: %v", i, err)
+			continue
+		}
+		var want []byte
+		for _, signer := range tt.want {
+			want = append(want, signer.Bytes()...)
+		}
+		if !bytes.Equal(output, want) {
+			t.Errorf("test %d: signers mismatch: have %x, want %x", i, output, want)
+		}
+	}
+	// Partial tuples are rejected rather than padded like ecrecover does
+	if _, err := p.Run(input[:200]); err != errBadEcrecoverBatchInput {
+		t.Errorf("partial tuple error mismatch: have %v, want %v", err, errBadEcrecoverBatchInput)
+	}
+}
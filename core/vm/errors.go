@@ -25,5 +25,42 @@ var (
 	ErrTraceLimitReached        = errors.New("the number of logs reached the specified limit")
 	ErrInsufficientBalance      = errors.New("insufficient balance for transfer")
 	ErrContractAddressCollision = errors.New("contract address collision")
+	ErrWriteProtection          = errors.New("evm: write protection")
 	ErrTxKycValidateFailed      = errors.New("Tx KYC validate failed")
+	ErrKycProviderExists        = errors.New("KYC provider already registered")
+	ErrKycProviderMinimum       = errors.New("KYC provider count at its minimum")
+	ErrKycProposalsFull         = errors.New("too many pending KYC proposals")
+)
+
+// Errors the KYC precompile fails calls with.
+var (
+	ErrKycUnknownMethod        = errors.New("unknown KYC method")
+	ErrKycValueTransfer        = errors.New("value sent to KYC method")
+	ErrKycChainMismatch        = errors.New("KYC call bound to another chain")
+	ErrKycInvalidInput         = errors.New("malformed KYC call input")
+	ErrKycContractCaller       = errors.New("KYC method called by a contract")
+	ErrKycNotProvider          = errors.New("caller is not a KYC provider")
+	ErrKycOtherProvider        = errors.New("address verified by another KYC provider")
+	ErrKycNoPendingAttestation = errors.New("no pending KYC attestation")
+	ErrKycSameProvider         = errors.New("KYC attestation confirmed by its own provider")
+	ErrKycAttestationMismatch  = errors.New("KYC confirmation differs from the pending attestation")
+	ErrKycInvalidProposal      = errors.New("invalid KYC proposal")
+	ErrKycProposalPending      = errors.New("KYC proposal for the subject already pending")
+	ErrKycUnknownProposal      = errors.New("unknown KYC proposal")
+	ErrKycProposalClosed       = errors.New("KYC proposal closed")
+	ErrKycAlreadyVoted         = errors.New("KYC proposal already voted on")
+	ErrKycNotProposer          = errors.New("KYC proposal made by another provider")
+	ErrDposInvalidStake        = errors.New("stake amount not positive")
+	ErrDposStakeInactive       = errors.New("staking not activated yet")
+	ErrDposStakeBelowRefund    = errors.New("stake below the requested refund")
+	ErrDposInsufficientStake   = errors.New("insufficient balance for stake")
+	ErrDposRefundNotDue        = errors.New("no stake refund due")
+	ErrDposInsufficientRefund  = errors.New("insufficient stake to refund")
+	ErrDposInvalidProducer     = errors.New("producer not registered or inactive")
+	ErrDposTooManyVotes        = errors.New("too many producers voted for")
+	ErrDposNotProxy            = errors.New("not a registered vote proxy")
+	ErrDposProxyChain          = errors.New("votes delegated to a proxy can't be delegated further")
+	ErrDposProducerStake       = errors.New("insufficient self-stake to register as producer")
+	ErrDposProducerFee         = errors.New("insufficient balance for the producer registration fee")
+	ErrDposSigningKeyTaken     = errors.New("signing key in use by another producer")
 )
@@ -47,10 +47,7 @@ func run(evm *EVM, contract *Contract, input []byte) ([]byte, error) {
 			return kycExecute(evm, contract, input)
 		}
 
-		precompiles := PrecompiledContractsHomestead
-		if true /*evm.ChainConfig().IsByzantium(evm.BlockNumber)*/ {
-			precompiles = PrecompiledContractsByzantium
-		}
+		precompiles := ActivePrecompiles(evm.BlockNumber, evm.ChainConfig())
 		if p := precompiles[*contract.CodeAddr]; p != nil {
 			return RunPrecompiledContract(p, input, contract)
 		}
@@ -162,7 +159,7 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 		return nil, gas, ErrInsufficientBalance
 	}
 
-	if !evm.StateDB.TxKycValidate(caller.Address(), addr, value) {
+	if !evm.StateDB.TxKycValidate(caller.Address(), addr, value, evm.BlockNumber, evm.Time.Uint64(), evm.ChainConfig()) {
 
 		return nil, gas, ErrTxKycValidateFailed
 	}
@@ -175,7 +172,7 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 				addressTo := common.BytesToAddress(input[16:36])
 				hs := common.BytesToHash(input[36:])
 				tokenCost := hs.Big();
-				if !evm.StateDB.TxKycValidate(caller.Address(), addressTo, tokenCost) {
+				if !evm.StateDB.TxKycValidate(caller.Address(), addressTo, tokenCost, evm.BlockNumber, evm.Time.Uint64(), evm.ChainConfig()) {
 					return nil, gas, ErrTxKycValidateFailed
 				}
 			}
@@ -184,10 +181,7 @@ func (evm *EVM) Call(caller ContractRef, addr common.Address, input []byte, gas
 
 
 	if !evm.StateDB.Exist(addr) {
-		precompiles := PrecompiledContractsHomestead
-		if true /*evm.ChainConfig().IsByzantium(evm.BlockNumber)*/ {
-			precompiles = PrecompiledContractsByzantium
-		}
+		precompiles := ActivePrecompiles(evm.BlockNumber, evm.ChainConfig())
 		if precompiles[addr] == nil && /*evm.ChainConfig().IsEIP158(evm.BlockNumber)*/ true && value.Sign() == 0 {
 			return nil, gas, nil
 		}
@@ -251,7 +245,7 @@ func (evm *EVM) CallCode(caller ContractRef, addr common.Address, input []byte,
 		return nil, gas, ErrInsufficientBalance
 	}
 
-	if !evm.StateDB.TxKycValidate(caller.Address(), to.Address(), value) {
+	if !evm.StateDB.TxKycValidate(caller.Address(), to.Address(), value, evm.BlockNumber, evm.Time.Uint64(), evm.ChainConfig()) {
 
 		return nil, gas, ErrTxKycValidateFailed
 	}
@@ -361,7 +355,7 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 		return nil, common.Address{}, gas, ErrInsufficientBalance
 	}
 
-	if !evm.StateDB.TxKycValidate(caller.Address(), common.Address{}, value) {
+	if !evm.StateDB.TxKycValidate(caller.Address(), common.Address{}, value, evm.BlockNumber, evm.Time.Uint64(), evm.ChainConfig()) {
 
 		return nil, common.Address{}, gas, ErrTxKycValidateFailed
 	}
@@ -409,7 +403,7 @@ func (evm *EVM) Create(caller ContractRef, code []byte, gas uint64, value *big.I
 	// be stored due to not enough gas set an error and let it be handled
 	// by the error checking condition below.
 	if err == nil && !maxCodeSizeExceeded {
-		createDataGas := uint64(len(ret)) * params.CreateDataGas
+		createDataGas := uint64(len(ret)) * evm.interpreter.gasTable.CreateData
 		if contract.UseGas(createDataGas) {
 			evm.StateDB.SetCode(contractAddr, ret)
 			//set contractAddr for owner.
@@ -25,14 +25,12 @@ import (
 	"github.com/worldopennetwork/go-won/common/math"
 	"github.com/worldopennetwork/go-won/core/types"
 	"github.com/worldopennetwork/go-won/crypto"
-	"github.com/worldopennetwork/go-won/params"
 )
 
 var (
 	bigZero                  = new(big.Int)
 	tt255                    = math.BigPow(2, 255)
 	tt256                    = math.BigPow(2, 256)
-	errWriteProtection       = errors.New("evm: write protection")
 	errReturnDataOutOfBounds = errors.New("evm: return data out of bounds")
 	errExecutionReverted     = errors.New("evm: execution reverted")
 	errMaxCodeSizeExceeded   = errors.New("evm: max code size exceeded")
@@ -678,7 +676,7 @@ func opCall(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack *Sta
 	args := memory.Get(inOffset.Int64(), inSize.Int64())
 
 	if value.Sign() != 0 {
-		gas += params.CallStipend
+		gas += evm.interpreter.gasTable.CallStipend
 	}
 	ret, returnGas, err := evm.Call(contract, toAddr, args, gas, value)
 	if err != nil {
@@ -707,7 +705,7 @@ func opCallCode(pc *uint64, evm *EVM, contract *Contract, memory *Memory, stack
 	args := memory.Get(inOffset.Int64(), inSize.Int64())
 
 	if value.Sign() != 0 {
-		gas += params.CallStipend
+		gas += evm.interpreter.gasTable.CallStipend
 	}
 	ret, returnGas, err := evm.CallCode(contract, toAddr, args, gas, value)
 	if err != nil {
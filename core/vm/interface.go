@@ -21,6 +21,7 @@ import (
 
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/params"
 )
 
 // StateDB is an EVM database for full state querying.
@@ -42,6 +43,7 @@ type StateDB interface {
 	AddRefund(uint64)
 	GetRefund() uint64
 
+	GetCommittedState(common.Address, common.Hash) common.Hash
 	GetState(common.Address, common.Hash) common.Hash
 	SetState(common.Address, common.Hash, common.Hash)
 
@@ -62,32 +64,61 @@ type StateDB interface {
 	AddPreimage(common.Hash, []byte)
 
 	ForEachStorage(common.Address, func(common.Hash, common.Hash) bool)
+	// StorageChanges returns the storage slots of the account written since the
+	// given snapshot, along with their current values.
+	StorageChanges(addr common.Address, revid int) map[common.Hash]common.Hash
 
 	SetKycLevel(addr common.Address, level uint32)
-	GetKycLevel(addr common.Address) uint32
+	GetKycLevel(addr common.Address, time uint64) uint32
+	SetKycExpiry(addr common.Address, expiresAt uint64)
+	GetKycExpiry(addr common.Address) uint64
+	SetKycPendingAttestation(addr common.Address, attestation *common.KycAttestation)
+	GetKycPendingAttestation(addr common.Address) *common.KycAttestation
 	SetKycZone(addr common.Address, zone uint32)
 	GetKycZone(addr common.Address) uint32
 	SetKycProvider(addr common.Address, provider common.Address)
 	GetKycProvider(addr common.Address) common.Address
+	SetKycAttestationEpoch(addr common.Address, epoch uint64)
+	GetKycAttestationEpoch(addr common.Address) uint64
+	SetContractCreator(addr common.Address, creator common.Address)
 	GetContractCreator(addr common.Address) common.Address
 
 	KycProviderExists(addr common.Address) bool
 	GetKycProviderCount() int64
-	AddKycProvider(addr common.Address)
-	RemoveKycProvider(addr common.Address)
-	SetKycProviderProposol(addr common.Address, st *big.Int, pt *big.Int)
-	SetVoteForKycProviderProposol(addr common.Address, nay uint16) bool
-	GetKycProviderProposol() (common.Address, *big.Int, *big.Int, *big.Int, *big.Int, *big.Int)
+	AddKycProvider(addr common.Address) bool
+	RemoveKycProvider(addr common.Address) bool
+	GetKycProviderEpoch(provider common.Address) uint64
+	RevokeKycAttestations(provider common.Address)
+	SetKycProviderInfo(addr common.Address, info []byte)
+	GetKycProviderInfoBlob(addr common.Address) []byte
+	SetKycProviderProposolInfo(id uint64, info []byte)
+	GetKycProviderProposolInfo(id uint64) []byte
+	GetKycProviderProposolRange() (uint64, uint64)
+	GetKycProviderProposolIds() []uint64
+	SetKycProviderProposol(addr common.Address, st *big.Int, pt *big.Int) (uint64, bool)
+	SetVoteForKycProviderProposol(id uint64, addr common.Address, nay uint16) bool
+	GetKycProviderProposol(id uint64) (common.Address, *big.Int, *big.Int, *big.Int, *big.Int, *big.Int)
+	GetKycProviderProposolProposer(id uint64) common.Address
+	ClearKycProviderProposol(id uint64)
+	SetKycLegacyProviderProposol(addr common.Address, st *big.Int, pt *big.Int)
 	GetKycProviderList() []common.Address
-	TxKycValidate(addr common.Address, dst common.Address, amount *big.Int) bool
+	TxKycValidate(addr common.Address, dst common.Address, amount *big.Int, number *big.Int, time uint64, config *params.ChainConfig) bool
+	SetKycZoneRestricted(from uint32, to uint32, restricted bool)
+	IsKycZoneRestricted(from uint32, to uint32) bool
+	GetKycZoneRestrictionCount() int64
 	IsContractAddress(address common.Address) bool
 	RegisterProducer(pb *common.Address, url string)
 
 	UpdateProducerTotalVotes(pb *common.Address, stake *big.Int)
 	UpdateProducerActive(pb *common.Address, val bool)
-	UpdateProducerLocation(pb *common.Address, val *big.Int)
+	UpdateProducerLocation(pb *common.Address, loc common.ProducerLocation)
+	SetProducerRegistrationFee(pb *common.Address, fee *big.Int)
+	GetProducerRegistrationFee(pb *common.Address) *big.Int
+	SetProducerSigningKey(pb *common.Address, key common.Address, number uint64, epoch uint64)
+	GetProducerSigningKey(pb *common.Address) common.Address
+	GetSigningKeyProducer(key common.Address) common.Address
 	GetProducerInfo(pb *common.Address) *common.ProducerInfo
-	GetProducerTopList() []common.Address
+	GetProducerTopList(number *big.Int, config *params.ChainConfig) []common.Address
 	GetProducerList(startPos int64, number int64) []common.Address
 	SetVoterStaking(myAddr *common.Address, stake *big.Int)
 	GetVoterStaking(myAddr *common.Address) (stake *big.Int)
@@ -95,8 +126,23 @@ type StateDB interface {
 	GetVoterProducers(myAddr *common.Address) (pbs []common.Address)
 	SetRefundRequestInfo(myAddr *common.Address, stake *big.Int, requestTime *big.Int)
 	GetRefundRequestInfo(myAddr *common.Address) (stake *big.Int, requestTime *big.Int)
+	SetDposAutoRefund(myAddr *common.Address, val bool)
+	GetDposAutoRefund(myAddr *common.Address) bool
+	PushDposRefund(myAddr *common.Address)
+	CancelDposRefund(myAddr *common.Address)
+	PeekDposRefund() (addr common.Address, live bool, ok bool)
+	PopDposRefund()
+	AddKycHistory(addr common.Address, entry *common.KycHistoryEntry, depth uint64)
+	GetKycHistory(addr common.Address, start uint64, count uint64) []common.KycHistoryEntry
 	SetDposVoterLastVoteWeight(myAddr *common.Address, weight *big.Int)
 	GetDposVoterLastVoteWeight(myAddr *common.Address) (weight *big.Int)
+	SetDposProxy(proxy *common.Address, val bool)
+	IsDposProxy(proxy *common.Address) bool
+	SetDposProxyWeight(proxy *common.Address, weight *big.Int)
+	GetDposProxyWeight(proxy *common.Address) *big.Int
+	SetVoterProxy(myAddr *common.Address, proxy common.Address)
+	GetVoterProxy(myAddr *common.Address) common.Address
+	GetDposProxyDelegators(proxy *common.Address) []common.Address
 	GetDposLastProducerScheduleUpdateTime() *big.Int
 	SetDposLastProducerScheduleUpdateTime(val *big.Int)
 	GetDposTopProducerElectedDone() *big.Int
@@ -30,6 +30,8 @@ type Config struct {
 	Debug bool
 	// Tracer is the op code logger
 	Tracer Tracer
+	// PrecompileTracer is the KYC precompile call logger
+	PrecompileTracer PrecompileTracer
 	// NoRecursion disabled Interpreter call, callcode,
 	// delegate call and create.
 	NoRecursion bool
@@ -90,7 +92,7 @@ func (in *Interpreter) enforceRestrictions(op OpCode, operation operation, stack
 			// account to the others means the state is modified and should also
 			// return with an error.
 			if operation.writes || (op == CALL && stack.Back(2).BitLen() > 0) {
-				return errWriteProtection
+				return ErrWriteProtection
 			}
 		}
 	}
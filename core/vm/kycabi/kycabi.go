@@ -0,0 +1,654 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+// Package kycabi packs and unpacks the calls of the KYC and DPoS precompile.
+//
+// The precompile at vm.KycContractAddress takes a 4 byte big endian method id
+// followed by the arguments of the method packed back to back. Every method
+// has a call type here which packs into the input the precompile parses, and
+// Decode turns such an input back into the call it was packed from.
+package kycabi
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/rlp"
+)
+
+// batchEntrySize is the size of an entry of a KYC batch: address, level, zone
+// and expiry.
+const batchEntrySize = 20 + 4 + 4 + 8
+
+var (
+	// ErrNotKycCall is returned when decoding a transaction that doesn't call
+	// the KYC precompile.
+	ErrNotKycCall = errors.New("not a KYC precompile call")
+
+	// ErrShortInput is returned when decoding an input too short to hold the
+	// arguments of its method.
+	ErrShortInput = errors.New("input too short")
+)
+
+// Call is a call of the KYC precompile.
+type Call interface {
+	// Method returns the method id the call is dispatched on.
+	Method() uint32
+
+	// Pack returns the input of the call, method id included.
+	Pack() []byte
+}
+
+// SetKyc sets the KYC level and zone of an address. A zero ExpiresAt keeps the
+// attestation from ever expiring.
+type SetKyc struct {
+	Address   common.Address `json:"address"`
+	Level     uint32         `json:"level"`
+	Zone      uint32         `json:"zone"`
+	ExpiresAt uint64         `json:"expiresAt"`
+}
+
+// ConfirmKyc confirms the attestation pending for an address, which must carry
+// the same info as the one made by the first provider.
+type ConfirmKyc SetKyc
+
+// SetKycBatch sets the KYC info of several addresses at once.
+type SetKycBatch struct {
+	Entries []SetKyc `json:"entries"`
+}
+
+// Proposal proposes a change of the KYC providers or zone policy. Only proposals
+// adding a provider may carry its metadata.
+type Proposal struct {
+	Subject common.Address          `json:"subject"`
+	Type    uint64                  `json:"type"`
+	Info    *common.KycProviderInfo `json:"info,omitempty"`
+}
+
+// ProposalVote votes on the proposal ID, or on the oldest pending proposal if
+// ID is nil.
+type ProposalVote struct {
+	Nay bool    `json:"nay"`
+	ID  *uint64 `json:"id"`
+}
+
+// CancelProposal withdraws the proposal ID, or the oldest pending proposal if
+// ID is nil.
+type CancelProposal struct {
+	ID *uint64 `json:"id"`
+}
+
+// RegisterProducer registers the sender as a block producer.
+type RegisterProducer struct {
+	URL string `json:"url"`
+}
+
+// UnregisterProducer unregisters the sender as a block producer.
+type UnregisterProducer struct{}
+
+// AddStake locks up Value of the balance of the sender as voting stake.
+type AddStake struct {
+	Value *big.Int `json:"value"`
+}
+
+// SubStake requests a refund of Value of the stake of the sender.
+type SubStake struct {
+	Value *big.Int `json:"value"`
+}
+
+// VoteProducers votes for the given block producers with the stake of the
+// sender, replacing its previous votes.
+type VoteProducers struct {
+	Producers []common.Address `json:"producers"`
+}
+
+// Refund pays out the stake refund requested by the sender.
+type Refund struct{}
+
+// AddVote adds Producer to the producers voted for by the sender, keeping its
+// other votes.
+type AddVote struct {
+	Producer common.Address `json:"producer"`
+}
+
+// RemoveVote withdraws the vote of the sender for Producer, keeping its other
+// votes.
+type RemoveVote struct {
+	Producer common.Address `json:"producer"`
+}
+
+// RegisterProxy registers the sender as a vote proxy others may delegate their
+// votes to, or unregisters it, releasing its delegators.
+type RegisterProxy struct {
+	Unregister bool `json:"unregister"`
+}
+
+// SetProxy delegates the votes of the sender to Proxy, replacing its own votes.
+// The zero address revokes the delegation.
+type SetProxy struct {
+	Proxy common.Address `json:"proxy"`
+}
+
+// SetLocation sets the country or region the sender, a block producer, operates
+// from.
+type SetLocation struct {
+	Location common.ProducerLocation `json:"location"`
+}
+
+// SetAutoRefund opts the sender in or out of having its matured refunds paid
+// out at the end of a block without claiming them.
+type SetAutoRefund struct {
+	Disable bool `json:"disable"`
+}
+
+// SetSigningKey hands the sealing of the blocks of the sender, a block producer,
+// over to Key. The zero address restores the own key of the producer.
+type SetSigningKey struct {
+	Key common.Address `json:"key"`
+}
+
+func (c *SetKyc) Method() uint32             { return vm.KycMethodSet }
+func (c *SetKycBatch) Method() uint32        { return vm.KycMethodSetBatch }
+func (c *ConfirmKyc) Method() uint32         { return vm.KycMethodConfirm }
+func (c *Proposal) Method() uint32           { return vm.KycMethodProviderVoteProposal }
+func (c *ProposalVote) Method() uint32       { return vm.KycMethodVote }
+func (c *CancelProposal) Method() uint32     { return vm.KycMethodCancelProposal }
+func (c *RegisterProducer) Method() uint32   { return vm.DposMethodRegProds }
+func (c *UnregisterProducer) Method() uint32 { return vm.DposMethodRmvProds }
+func (c *AddStake) Method() uint32           { return vm.DposMethodAddStake }
+func (c *SubStake) Method() uint32           { return vm.DposMethodSubStake }
+func (c *VoteProducers) Method() uint32      { return vm.DposMethodProdsVote }
+func (c *Refund) Method() uint32             { return vm.DposMethodRefund }
+func (c *AddVote) Method() uint32            { return vm.DposMethodAddVote }
+func (c *RemoveVote) Method() uint32         { return vm.DposMethodRemoveVote }
+func (c *RegisterProxy) Method() uint32      { return vm.DposMethodRegProxy }
+func (c *SetProxy) Method() uint32           { return vm.DposMethodSetProxy }
+func (c *SetLocation) Method() uint32        { return vm.DposMethodSetLocation }
+func (c *SetAutoRefund) Method() uint32      { return vm.DposMethodSetAutoRefund }
+func (c *SetSigningKey) Method() uint32      { return vm.DposMethodSetSigningKey }
+
+// method returns the method id of c followed by room for size bytes of
+// arguments.
+func method(c Call, size int) []byte {
+	input := make([]byte, 4, 4+size)
+	binary.BigEndian.PutUint32(input, c.Method())
+	return input
+}
+
+func (c *SetKyc) Pack() []byte {
+	return append(method(c, batchEntrySize), c.pack()...)
+}
+
+// pack packs the arguments of c, which double as an entry of a batch.
+func (c *SetKyc) pack() []byte {
+	entry := make([]byte, batchEntrySize)
+	copy(entry, c.Address.Bytes())
+	binary.BigEndian.PutUint32(entry[20:], c.Level)
+	binary.BigEndian.PutUint32(entry[24:], c.Zone)
+	binary.BigEndian.PutUint64(entry[28:], c.ExpiresAt)
+	return entry
+}
+
+func (c *ConfirmKyc) Pack() []byte {
+	return append(method(c, batchEntrySize), (*SetKyc)(c).pack()...)
+}
+
+func (c *SetKycBatch) Pack() []byte {
+	input := method(c, len(c.Entries)*batchEntrySize)
+	for i := range c.Entries {
+		input = append(input, c.Entries[i].pack()...)
+	}
+	return input
+}
+
+// Pack panics if the metadata can't be encoded, use PackProposal to check the
+// size of the metadata beforehand.
+func (c *Proposal) Pack() []byte {
+	input, err := PackProposal(c.Subject, c.Type, c.Info)
+	if err != nil {
+		panic(err)
+	}
+	return input
+}
+
+// PackProposal packs a provider proposal, failing if the metadata exceeds what
+// the precompile accepts.
+func PackProposal(subject common.Address, pt uint64, info *common.KycProviderInfo) ([]byte, error) {
+	var blob []byte
+	if info != nil {
+		var err error
+		if blob, err = rlp.EncodeToBytes(info); err != nil {
+			return nil, err
+		}
+		if len(blob) > vm.KycProviderInfoMaxSize {
+			return nil, fmt.Errorf("provider metadata too large: %d > %d bytes", len(blob), vm.KycProviderInfoMaxSize)
+		}
+	}
+	input := method(&Proposal{}, 20+8+len(blob))
+	input = append(input, subject.Bytes()...)
+	input = append(input, make([]byte, 8)...)
+	binary.BigEndian.PutUint64(input[24:], pt)
+	return append(input, blob...), nil
+}
+
+func (c *ProposalVote) Pack() []byte {
+	input := method(c, 2+8)
+	if c.Nay {
+		input = append(input, 0, 1)
+	} else {
+		input = append(input, 0, 0)
+	}
+	return appendID(input, c.ID)
+}
+
+func (c *CancelProposal) Pack() []byte {
+	return appendID(method(c, 8), c.ID)
+}
+
+// appendID appends the optional proposal id to input.
+func appendID(input []byte, id *uint64) []byte {
+	if id == nil {
+		return input
+	}
+	idb := make([]byte, 8)
+	binary.BigEndian.PutUint64(idb, *id)
+	return append(input, idb...)
+}
+
+func (c *RegisterProducer) Pack() []byte {
+	return append(method(c, len(c.URL)), c.URL...)
+}
+
+func (c *UnregisterProducer) Pack() []byte {
+	return method(c, 0)
+}
+
+func (c *AddStake) Pack() []byte {
+	return append(method(c, 32), common.BigToHash(c.Value).Bytes()...)
+}
+
+func (c *SubStake) Pack() []byte {
+	return append(method(c, 32), common.BigToHash(c.Value).Bytes()...)
+}
+
+func (c *VoteProducers) Pack() []byte {
+	input := method(c, 20*len(c.Producers))
+	for _, producer := range c.Producers {
+		input = append(input, producer.Bytes()...)
+	}
+	return input
+}
+
+func (c *Refund) Pack() []byte {
+	return method(c, 0)
+}
+
+func (c *AddVote) Pack() []byte {
+	return append(method(c, 20), c.Producer.Bytes()...)
+}
+
+func (c *RemoveVote) Pack() []byte {
+	return append(method(c, 20), c.Producer.Bytes()...)
+}
+
+func (c *RegisterProxy) Pack() []byte {
+	if c.Unregister {
+		return append(method(c, 1), 0)
+	}
+	return append(method(c, 1), 1)
+}
+
+func (c *SetProxy) Pack() []byte {
+	return append(method(c, 20), c.Proxy.Bytes()...)
+}
+
+func (c *SetLocation) Pack() []byte {
+	loc := make([]byte, 2)
+	binary.BigEndian.PutUint16(loc, uint16(c.Location))
+	return append(method(c, 2), loc...)
+}
+
+func (c *SetAutoRefund) Pack() []byte {
+	if c.Disable {
+		return append(method(c, 1), 0)
+	}
+	return append(method(c, 1), 1)
+}
+
+func (c *SetSigningKey) Pack() []byte {
+	return append(method(c, 20), c.Key.Bytes()...)
+}
+
+// Decode unpacks the input of a KYC precompile call the way the precompile
+// parses it.
+func Decode(input []byte) (Call, error) {
+	input, _ = vm.SplitKycInput(input)
+	if len(input) < 4 {
+		return nil, ErrShortInput
+	}
+	args := input[4:]
+
+	switch funcid := binary.BigEndian.Uint32(input); funcid {
+	case vm.KycMethodSet:
+		if len(args) < 28 {
+			return nil, ErrShortInput
+		}
+		// the expiry is optional, zero meaning the attestation never expires
+		if len(args) < batchEntrySize {
+			args = append(args[:28:28], make([]byte, 8)...)
+		}
+		return decodeSetKyc(args), nil
+
+	case vm.KycMethodConfirm:
+		if len(args) < 28 {
+			return nil, ErrShortInput
+		}
+		if len(args) < batchEntrySize {
+			args = append(args[:28:28], make([]byte, 8)...)
+		}
+		return (*ConfirmKyc)(decodeSetKyc(args)), nil
+
+	case vm.KycMethodSetBatch:
+		if len(args) == 0 || len(args)%batchEntrySize != 0 {
+			return nil, fmt.Errorf("invalid KYC batch size %d", len(args))
+		}
+		batch := &SetKycBatch{Entries: make([]SetKyc, len(args)/batchEntrySize)}
+		for i := range batch.Entries {
+			batch.Entries[i] = *decodeSetKyc(args[i*batchEntrySize : (i+1)*batchEntrySize])
+		}
+		return batch, nil
+
+	case vm.KycMethodProviderVoteProposal:
+		if len(args) < 28 {
+			return nil, ErrShortInput
+		}
+		proposal := &Proposal{
+			Subject: common.BytesToAddress(args[:20]),
+			Type:    binary.BigEndian.Uint64(args[20:28]),
+		}
+		if len(args) > 28 {
+			proposal.Info = new(common.KycProviderInfo)
+			if err := rlp.DecodeBytes(args[28:], proposal.Info); err != nil {
+				return nil, fmt.Errorf("invalid provider metadata: %v", err)
+			}
+		}
+		return proposal, nil
+
+	case vm.KycMethodVote:
+		if len(args) < 2 {
+			return nil, ErrShortInput
+		}
+		return &ProposalVote{Nay: binary.BigEndian.Uint16(args) != 0, ID: decodeID(args[2:])}, nil
+
+	case vm.KycMethodCancelProposal:
+		return &CancelProposal{ID: decodeID(args)}, nil
+
+	case vm.DposMethodRegProds:
+		return &RegisterProducer{URL: string(args)}, nil
+
+	case vm.DposMethodRmvProds:
+		return &UnregisterProducer{}, nil
+
+	case vm.DposMethodAddStake:
+		return &AddStake{Value: common.BytesToHash(args).Big()}, nil
+
+	case vm.DposMethodSubStake:
+		return &SubStake{Value: common.BytesToHash(args).Big()}, nil
+
+	case vm.DposMethodProdsVote:
+		vote := &VoteProducers{Producers: make([]common.Address, len(args)/20)}
+		for i := range vote.Producers {
+			vote.Producers[i] = common.BytesToAddress(args[i*20 : (i+1)*20])
+		}
+		return vote, nil
+
+	case vm.DposMethodRefund:
+		return &Refund{}, nil
+
+	case vm.DposMethodAddVote:
+		if len(args) < 20 {
+			return nil, ErrShortInput
+		}
+		return &AddVote{Producer: common.BytesToAddress(args[:20])}, nil
+
+	case vm.DposMethodRemoveVote:
+		if len(args) < 20 {
+			return nil, ErrShortInput
+		}
+		return &RemoveVote{Producer: common.BytesToAddress(args[:20])}, nil
+
+	case vm.DposMethodRegProxy:
+		return &RegisterProxy{Unregister: len(args) > 0 && args[0] == 0}, nil
+
+	case vm.DposMethodSetProxy:
+		if len(args) == 0 {
+			return &SetProxy{}, nil
+		}
+		if len(args) < 20 {
+			return nil, ErrShortInput
+		}
+		return &SetProxy{Proxy: common.BytesToAddress(args[:20])}, nil
+
+	case vm.DposMethodSetLocation:
+		if len(args) < 2 {
+			return nil, ErrShortInput
+		}
+		return &SetLocation{Location: common.ProducerLocation(binary.BigEndian.Uint16(args))}, nil
+
+	case vm.DposMethodSetAutoRefund:
+		return &SetAutoRefund{Disable: len(args) > 0 && args[0] == 0}, nil
+
+	case vm.DposMethodSetSigningKey:
+		if len(args) == 0 {
+			return &SetSigningKey{}, nil
+		}
+		if len(args) < 20 {
+			return nil, ErrShortInput
+		}
+		return &SetSigningKey{Key: common.BytesToAddress(args[:20])}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown KYC method %d", funcid)
+	}
+}
+
+// Bound is a call bound to the chain ChainID, which the precompile rejects on
+// other networks. Chains only accept bound calls once they enabled them.
+type Bound struct {
+	Call
+	ChainID *big.Int
+}
+
+// Bind binds call to the chain chainID.
+func Bind(call Call, chainID *big.Int) *Bound {
+	return &Bound{Call: call, ChainID: chainID}
+}
+
+func (c *Bound) Method() uint32 { return c.Call.Method() | vm.KycChainBound }
+
+func (c *Bound) Pack() []byte {
+	return vm.BindKycInput(c.Call.Pack(), c.ChainID)
+}
+
+// Decoded is the meaning of a KYC precompile input as shown to users: the name
+// of the method called and its arguments, if they decode.
+type Decoded struct {
+	Method string `json:"method"`
+	Params Call   `json:"params,omitempty"`
+}
+
+// Describe decodes input into the method it calls and its arguments. Methods
+// the precompile doesn't know are named "unknown".
+func Describe(input []byte) *Decoded {
+	var id uint32 // no method has the zero id
+	if input, _ := vm.SplitKycInput(input); len(input) >= 4 {
+		id = binary.BigEndian.Uint32(input)
+	}
+	decoded := &Decoded{Method: vm.KycMethodName(id)}
+	if call, err := Decode(input); err == nil {
+		decoded.Params = call
+	}
+	return decoded
+}
+
+// DecodeTx unpacks the KYC precompile call made by tx.
+func DecodeTx(tx *types.Transaction) (Call, error) {
+	if to := tx.To(); to == nil || *to != vm.KycContractAddress {
+		return nil, ErrNotKycCall
+	}
+	return Decode(tx.Data())
+}
+
+func decodeSetKyc(entry []byte) *SetKyc {
+	return &SetKyc{
+		Address:   common.BytesToAddress(entry[:20]),
+		Level:     binary.BigEndian.Uint32(entry[20:24]),
+		Zone:      binary.BigEndian.Uint32(entry[24:28]),
+		ExpiresAt: binary.BigEndian.Uint64(entry[28:36]),
+	}
+}
+
+// decodeID returns the optional proposal id at the start of args.
+func decodeID(args []byte) *uint64 {
+	if len(args) < 8 {
+		return nil
+	}
+	id := binary.BigEndian.Uint64(args)
+	return &id
+}
+
+// NewTx creates a transaction making the given precompile call.
+func NewTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, call Call) *types.Transaction {
+	return types.NewTransaction(nonce, vm.KycContractAddress, new(big.Int), gasLimit, gasPrice, call.Pack())
+}
+
+// NewSetKycTx creates a transaction setting the KYC info of address.
+func NewSetKycTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, address common.Address, level, zone uint32, expiresAt uint64) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &SetKyc{Address: address, Level: level, Zone: zone, ExpiresAt: expiresAt})
+}
+
+// NewConfirmKycTx creates a transaction confirming the attestation pending for
+// address.
+func NewConfirmKycTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, address common.Address, level, zone uint32, expiresAt uint64) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &ConfirmKyc{Address: address, Level: level, Zone: zone, ExpiresAt: expiresAt})
+}
+
+// NewSetKycBatchTx creates a transaction setting the KYC info of several
+// addresses at once.
+func NewSetKycBatchTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, entries []SetKyc) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &SetKycBatch{Entries: entries})
+}
+
+// NewProposalTx creates a transaction proposing a change of the KYC providers
+// or zone policy.
+func NewProposalTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, subject common.Address, pt uint64, info *common.KycProviderInfo) (*types.Transaction, error) {
+	input, err := PackProposal(subject, pt, info)
+	if err != nil {
+		return nil, err
+	}
+	return types.NewTransaction(nonce, vm.KycContractAddress, new(big.Int), gasLimit, gasPrice, input), nil
+}
+
+// NewProposalVoteTx creates a transaction voting on a provider proposal.
+func NewProposalVoteTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, nay bool, id *uint64) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &ProposalVote{Nay: nay, ID: id})
+}
+
+// NewCancelProposalTx creates a transaction withdrawing a provider proposal.
+func NewCancelProposalTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, id *uint64) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &CancelProposal{ID: id})
+}
+
+// NewRegisterProducerTx creates a transaction registering the sender as a block
+// producer.
+func NewRegisterProducerTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, url string) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &RegisterProducer{URL: url})
+}
+
+// NewUnregisterProducerTx creates a transaction unregistering the sender as a
+// block producer.
+func NewUnregisterProducerTx(nonce uint64, gasLimit uint64, gasPrice *big.Int) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &UnregisterProducer{})
+}
+
+// NewAddStakeTx creates a transaction staking value of the balance of the
+// sender.
+func NewAddStakeTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, value *big.Int) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &AddStake{Value: value})
+}
+
+// NewSubStakeTx creates a transaction requesting a refund of value of the stake
+// of the sender.
+func NewSubStakeTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, value *big.Int) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &SubStake{Value: value})
+}
+
+// NewVoteProducersTx creates a transaction voting for the given producers.
+func NewVoteProducersTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, producers []common.Address) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &VoteProducers{Producers: producers})
+}
+
+// NewRefundTx creates a transaction paying out the requested stake refund of
+// the sender.
+func NewRefundTx(nonce uint64, gasLimit uint64, gasPrice *big.Int) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &Refund{})
+}
+
+// NewAddVoteTx creates a transaction adding a vote for producer.
+func NewAddVoteTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, producer common.Address) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &AddVote{Producer: producer})
+}
+
+// NewRemoveVoteTx creates a transaction withdrawing the vote for producer.
+func NewRemoveVoteTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, producer common.Address) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &RemoveVote{Producer: producer})
+}
+
+// NewRegisterProxyTx creates a transaction registering the sender as a vote
+// proxy, or unregistering it.
+func NewRegisterProxyTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, unregister bool) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &RegisterProxy{Unregister: unregister})
+}
+
+// NewSetProxyTx creates a transaction delegating the votes of the sender to
+// proxy, or revoking the delegation if proxy is the zero address.
+func NewSetProxyTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, proxy common.Address) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &SetProxy{Proxy: proxy})
+}
+
+// NewSetLocationTx creates a transaction setting the country or region the
+// sender, a block producer, operates from.
+func NewSetLocationTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, location common.ProducerLocation) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &SetLocation{Location: location})
+}
+
+// NewSetAutoRefundTx creates a transaction opting the sender in or out of having
+// its matured refunds paid out automatically.
+func NewSetAutoRefundTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, enable bool) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &SetAutoRefund{Disable: !enable})
+}
+
+// NewSetSigningKeyTx creates a transaction handing the sealing of the blocks of
+// the sender, a block producer, over to key, or restoring its own key if key is
+// the zero address.
+func NewSetSigningKeyTx(nonce uint64, gasLimit uint64, gasPrice *big.Int, key common.Address) *types.Transaction {
+	return NewTx(nonce, gasLimit, gasPrice, &SetSigningKey{Key: key})
+}
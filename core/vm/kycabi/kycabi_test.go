@@ -0,0 +1,231 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package kycabi
+
+import (
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/core/vm/runtime"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// Tests that every call decodes back into the call it was packed from.
+func TestRoundTrip(t *testing.T) {
+	id := uint64(3)
+	calls := []Call{
+		&SetKyc{Address: common.Address{0x01}, Level: 2, Zone: 3, ExpiresAt: 4},
+		&ConfirmKyc{Address: common.Address{0x01}, Level: 2, Zone: 3, ExpiresAt: 4},
+		&SetKycBatch{Entries: []SetKyc{{Address: common.Address{0x01}, Level: 1}, {Address: common.Address{0x02}, Zone: 5, ExpiresAt: 6}}},
+		&Proposal{Subject: common.Address{0x01}, Type: vm.KycProposalRemoveProvider},
+		&Proposal{Subject: common.Address{0x01}, Type: vm.KycProposalAddProvider, Info: &common.KycProviderInfo{Name: "provider", Jurisdiction: "CH", URL: "https://provider.example"}},
+		&ProposalVote{Nay: true},
+		&ProposalVote{ID: &id},
+		&CancelProposal{},
+		&CancelProposal{ID: &id},
+		&RegisterProducer{URL: "https://producer.example"},
+		&UnregisterProducer{},
+		&AddStake{Value: big.NewInt(1000)},
+		&SubStake{Value: big.NewInt(1000)},
+		&VoteProducers{Producers: []common.Address{{0x01}, {0x02}}},
+		&Refund{},
+		&AddVote{Producer: common.Address{0x01}},
+		&RemoveVote{Producer: common.Address{0x02}},
+		&RegisterProxy{},
+		&RegisterProxy{Unregister: true},
+		&SetProxy{Proxy: common.Address{0x03}},
+		&SetProxy{},
+		&SetLocation{Location: 156},
+		&SetAutoRefund{},
+		&SetAutoRefund{Disable: true},
+		&SetSigningKey{Key: common.Address{0x04}},
+		&SetSigningKey{},
+	}
+	for i, call := range calls {
+		have, err := Decode(call.Pack())
+		if err != nil {
+			t.Errorf("call %d: failed to decode: %v", i, err)
+			continue
+		}
+		if !reflect.DeepEqual(have, call) {
+			t.Errorf("call %d: decoded call mismatch: have %+v, want %+v", i, have, call)
+		}
+		// Calls bound to a chain decode into the call they bind
+		if have, err := Decode(Bind(call, big.NewInt(7)).Pack()); err != nil || !reflect.DeepEqual(have, call) {
+			t.Errorf("call %d: decoded bound call mismatch: have %+v/%v, want %+v", i, have, err, call)
+		}
+	}
+	tx := NewAddStakeTx(0, 100000, big.NewInt(1), big.NewInt(1000))
+	if call, err := DecodeTx(tx); err != nil || !reflect.DeepEqual(call, &AddStake{Value: big.NewInt(1000)}) {
+		t.Errorf("transaction decode mismatch: have %+v/%v", call, err)
+	}
+	if _, err := DecodeTx(types.NewTransaction(0, common.Address{0x01}, new(big.Int), 100000, big.NewInt(1), tx.Data())); err != ErrNotKycCall {
+		t.Errorf("foreign transaction error mismatch: have %v, want %v", err, ErrNotKycCall)
+	}
+	// Inputs predating the optional arguments decode with their defaults
+	short := (&SetKyc{Address: common.Address{0x01}, Level: 2, Zone: 3}).Pack()[:32]
+	if call, err := Decode(short); err != nil || !reflect.DeepEqual(call, &SetKyc{Address: common.Address{0x01}, Level: 2, Zone: 3}) {
+		t.Errorf("expiry-less set decode mismatch: have %+v/%v", call, err)
+	}
+	if _, err := Decode(short[:20]); err != ErrShortInput {
+		t.Errorf("truncated set error mismatch: have %v, want %v", err, ErrShortInput)
+	}
+}
+
+// Tests that the packed calls have the effect on the state the precompile
+// gives them.
+func TestPrecompileParsing(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		p1, p2, p3 = common.HexToAddress("0x0101"), common.HexToAddress("0x0102"), common.HexToAddress("0x0103")
+		user       = common.HexToAddress("0x0201")
+		voter      = common.HexToAddress("0x0301")
+		candidate  = common.HexToAddress("0x0401")
+		stake      = new(big.Int).Mul(big.NewInt(100), big.NewInt(params.WON))
+	)
+	for _, provider := range []common.Address{p1, p2, p3} {
+		statedb.AddKycProvider(provider)
+	}
+	statedb.AddBalance(voter, new(big.Int).Mul(stake, big.NewInt(2)))
+
+	config := &params.ChainConfig{
+		ChainId:                big.NewInt(1),
+		KycProposalCancelBlock: big.NewInt(0),
+		KycExpiryBlock:         big.NewInt(0),
+		KycSetBatchBlock:       big.NewInt(0),
+		KycThresholdQueryBlock: big.NewInt(0),
+		KycProviderInfoBlock:   big.NewInt(0),
+	}
+	call := func(origin common.Address, call Call) []byte {
+		ret, _, err := runtime.Call(vm.KycContractAddress, call.Pack(), &runtime.Config{ChainConfig: config, State: statedb, Origin: origin, Time: big.NewInt(1000), GasLimit: 1000000})
+		if err != nil {
+			t.Fatalf("%T call failed: %v", call, err)
+		}
+		return ret
+	}
+	call(p1, &SetKyc{Address: user, Level: 2, Zone: 3, ExpiresAt: 5000})
+	if level, zone, expiry := statedb.GetKycLevel(user, 1000), statedb.GetKycZone(user), statedb.GetKycExpiry(user); level != 2 || zone != 3 || expiry != 5000 {
+		t.Errorf("set KYC info mismatch: have %d/%d/%d, want 2/3/5000", level, zone, expiry)
+	}
+	call(p1, &SetKycBatch{Entries: []SetKyc{{Address: user, Level: 4, Zone: 3}, {Address: voter, Level: 1, Zone: 3}}})
+	if level, expiry := statedb.GetKycLevel(user, 1000), statedb.GetKycExpiry(user); level != 4 || expiry != 0 {
+		t.Errorf("batch KYC info mismatch: have %d/%d, want 4/0", level, expiry)
+	}
+	if level := statedb.GetKycLevel(voter, 1000); level != 1 {
+		t.Errorf("second batch entry level mismatch: have %d, want 1", level)
+	}
+	info := &common.KycProviderInfo{Name: "candidate", Jurisdiction: "CH", URL: "https://candidate.example"}
+	id := new(big.Int).SetBytes(call(p1, &Proposal{Subject: candidate, Type: vm.KycProposalAddProvider, Info: info})).Uint64()
+	call(p2, &ProposalVote{ID: &id})
+	if !statedb.KycProviderExists(candidate) {
+		t.Fatalf("proposed provider not added")
+	}
+	if have := statedb.GetKycProviderInfo(candidate); have.Name != info.Name || have.Jurisdiction != info.Jurisdiction || have.URL != info.URL {
+		t.Errorf("provider metadata mismatch: have %+v, want %+v", have, info)
+	}
+	call(p1, &Proposal{Subject: candidate, Type: vm.KycProposalRemoveProvider})
+	if ids := statedb.GetKycProviderProposolIds(); len(ids) != 1 {
+		t.Fatalf("pending proposals mismatch: have %v, want one", ids)
+	}
+	call(p1, &CancelProposal{})
+	if ids := statedb.GetKycProviderProposolIds(); len(ids) != 0 {
+		t.Errorf("cancelled proposal left pending: %v", ids)
+	}
+	call(candidate, &RegisterProducer{URL: "https://candidate.example"})
+	if producer := statedb.GetProducerInfo(&candidate); producer == nil || producer.Url != "https://candidate.example" {
+		t.Fatalf("registered producer mismatch: have %+v", producer)
+	}
+	call(voter, &AddStake{Value: stake})
+	if staking := statedb.GetVoterStaking(&voter); staking.Cmp(stake) != 0 {
+		t.Errorf("stake mismatch: have %v, want %v", staking, stake)
+	}
+	call(voter, &VoteProducers{Producers: []common.Address{candidate}})
+	if producers := statedb.GetVoterProducers(&voter); !reflect.DeepEqual(producers, []common.Address{candidate}) {
+		t.Errorf("voted producers mismatch: have %x, want [%x]", producers, candidate)
+	}
+	call(candidate, &UnregisterProducer{})
+	if producer := statedb.GetProducerInfo(&candidate); producer != nil && producer.IsActive {
+		t.Errorf("unregistered producer still active")
+	}
+}
+
+// Tests that with dual attestation enabled a KYC level only takes effect once a
+// second provider confirms it before the pending attestation lapses.
+func TestDualAttestation(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		p1, p2 = common.HexToAddress("0x0101"), common.HexToAddress("0x0102")
+		user   = common.HexToAddress("0x0201")
+		late   = common.HexToAddress("0x0202")
+	)
+	statedb.AddKycProvider(p1)
+	statedb.AddKycProvider(p2)
+
+	call := func(config *params.ChainConfig, origin common.Address, time int64, call Call) error {
+		_, _, err := runtime.Call(vm.KycContractAddress, call.Pack(), &runtime.Config{ChainConfig: config, State: statedb, Origin: origin, Time: big.NewInt(time), GasLimit: 1000000})
+		return err
+	}
+	single := &params.ChainConfig{ChainId: big.NewInt(1)}
+	if err := call(single, p2, 1000, &ConfirmKyc{Address: user, Level: 2}); err != vm.ErrKycUnknownMethod {
+		t.Errorf("pre-fork confirm error mismatch: have %v, want %v", err, vm.ErrKycUnknownMethod)
+	}
+	dual := &params.ChainConfig{ChainId: big.NewInt(1), KycDualAttestationBlock: big.NewInt(0), Kyc: &params.KycConfig{PendingLifetime: 100}}
+	if err := call(dual, p1, 1000, &SetKyc{Address: user, Level: 2, Zone: 3}); err != nil {
+		t.Fatalf("attestation failed: %v", err)
+	}
+	if level := statedb.GetKycLevel(user, 1000); level != 0 {
+		t.Errorf("unconfirmed level took effect: have %d, want 0", level)
+	}
+	if pending := statedb.GetKycPendingAttestation(user); pending == nil || pending.Provider != p1 || pending.Deadline != 1100 {
+		t.Errorf("pending attestation mismatch: have %+v", pending)
+	}
+	if err := call(dual, p1, 1010, &ConfirmKyc{Address: user, Level: 2, Zone: 3}); err != vm.ErrKycSameProvider {
+		t.Errorf("self confirm error mismatch: have %v, want %v", err, vm.ErrKycSameProvider)
+	}
+	if err := call(dual, p2, 1010, &ConfirmKyc{Address: user, Level: 3, Zone: 3}); err != vm.ErrKycAttestationMismatch {
+		t.Errorf("mismatched confirm error mismatch: have %v, want %v", err, vm.ErrKycAttestationMismatch)
+	}
+	if err := call(dual, p2, 1010, &ConfirmKyc{Address: user, Level: 2, Zone: 3}); err != nil {
+		t.Fatalf("confirm failed: %v", err)
+	}
+	if level, zone := statedb.GetKycLevel(user, 1010), statedb.GetKycZone(user); level != 2 || zone != 3 {
+		t.Errorf("confirmed KYC info mismatch: have %d/%d, want 2/3", level, zone)
+	}
+	if provider := statedb.GetKycProvider(user); provider != p1 {
+		t.Errorf("attesting provider mismatch: have %x, want %x", provider, p1)
+	}
+	if pending := statedb.GetKycPendingAttestation(user); pending != nil {
+		t.Errorf("pending attestation not cleared: %+v", pending)
+	}
+	// an attestation left unconfirmed past its deadline can't be confirmed
+	if err := call(dual, p1, 1000, &SetKyc{Address: late, Level: 1}); err != nil {
+		t.Fatalf("attestation failed: %v", err)
+	}
+	if err := call(dual, p2, 1100, &ConfirmKyc{Address: late, Level: 1}); err != vm.ErrKycNoPendingAttestation {
+		t.Errorf("lapsed confirm error mismatch: have %v, want %v", err, vm.ErrKycNoPendingAttestation)
+	}
+}
@@ -99,7 +99,26 @@ type Tracer interface {
 	CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error
 }
 
-// StructLogger is an EVM state logger and implements Tracer.
+// PrecompileLog is emitted for each call into the KYC precompile and lists the
+// method called along with the storage slots of the precompile it wrote.
+type PrecompileLog struct {
+	Caller  common.Address
+	Method  string
+	Input   []byte
+	Storage map[common.Hash]common.Hash
+	Depth   int
+	Err     error
+}
+
+// PrecompileTracer is used to collect the calls into the KYC precompile, which
+// don't go through the interpreter and so aren't seen by a Tracer.
+// CapturePrecompile is called once the call returned, before any of its state
+// changes are reverted.
+type PrecompileTracer interface {
+	CapturePrecompile(env *EVM, log *PrecompileLog) error
+}
+
+// StructLogger is an EVM state logger and implements Tracer and PrecompileTracer.
 //
 // StructLogger can capture state based on the given Log configuration and also keeps
 // a track record of modified storage which is used in reporting snapshots of the
@@ -107,10 +126,11 @@ type Tracer interface {
 type StructLogger struct {
 	cfg LogConfig
 
-	logs          []StructLog
-	changedValues map[common.Address]Storage
-	output        []byte
-	err           error
+	logs           []StructLog
+	precompileLogs []PrecompileLog
+	changedValues  map[common.Address]Storage
+	output         []byte
+	err            error
 }
 
 // NewStructLogger returns a new logger
@@ -182,6 +202,12 @@ func (l *StructLogger) CaptureFault(env *EVM, pc uint64, op OpCode, gas, cost ui
 	return nil
 }
 
+// CapturePrecompile logs a call into the KYC precompile.
+func (l *StructLogger) CapturePrecompile(env *EVM, log *PrecompileLog) error {
+	l.precompileLogs = append(l.precompileLogs, *log)
+	return nil
+}
+
 func (l *StructLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration, err error) error {
 	l.output = output
 	l.err = err
@@ -197,6 +223,9 @@ func (l *StructLogger) CaptureEnd(output []byte, gasUsed uint64, t time.Duration
 // StructLogs returns the captured log entries.
 func (l *StructLogger) StructLogs() []StructLog { return l.logs }
 
+// PrecompileLogs returns the captured KYC precompile calls.
+func (l *StructLogger) PrecompileLogs() []PrecompileLog { return l.precompileLogs }
+
 // Error returns the VM error captured by the trace.
 func (l *StructLogger) Error() error { return l.err }
 
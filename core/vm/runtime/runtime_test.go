@@ -17,14 +17,27 @@
 package runtime
 
 import (
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"fmt"
 	"math/big"
+	"os"
+	"os/exec"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/worldopennetwork/go-won/accounts/abi"
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
 	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/crypto/blake2b"
+	"github.com/worldopennetwork/go-won/metrics"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rlp"
 	"github.com/worldopennetwork/go-won/wondb"
 )
 
@@ -117,6 +130,265 @@ func TestCall(t *testing.T) {
 	}
 }
 
+// kycInput packs a call to the KYC precompile method with the given arguments.
+func kycInput(method uint32, args ...[]byte) []byte {
+	input := make([]byte, 4)
+	binary.BigEndian.PutUint32(input, method)
+	for _, arg := range args {
+		input = append(input, arg...)
+	}
+	return input
+}
+
+// Tests that a KYC provider proposal survives unchanged when the frame around
+// the precompile call reverts, whether from a contract or an enclosing call.
+func TestKycProposalRevert(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		p1, p2, p3 = common.HexToAddress("0x0101"), common.HexToAddress("0x0102"), common.HexToAddress("0x0103")
+		candidate  = common.HexToAddress("0x0201")
+		blockTime  = big.NewInt(1000000)
+	)
+	for _, provider := range []common.Address{p1, p2, p3} {
+		statedb.AddKycProvider(provider)
+	}
+	config := func(origin common.Address) *Config {
+		return &Config{State: statedb, Origin: origin, Time: blockTime, GasLimit: 100000}
+	}
+	proposal := func() string {
+		return fmt.Sprint(statedb.GetKycProviderProposol(0))
+	}
+	pt := make([]byte, 8)
+	binary.BigEndian.PutUint64(pt, 1)
+	if _, _, err := Call(vm.KycContractAddress, kycInput(vm.KycMethodProviderVoteProposal, candidate.Bytes(), pt), config(p1)); err != nil {
+		t.Fatalf("failed to start proposal: %v", err)
+	}
+	want := proposal()
+	if addr, _, _, _, yes, _ := statedb.GetKycProviderProposol(0); addr != candidate || yes.Cmp(common.Big1) != 0 {
+		t.Fatalf("proposal mismatch: have %s, want %x with one vote", want, candidate)
+	}
+	// A contract voting through the precompile and then reverting
+	var (
+		vote = kycInput(vm.KycMethodVote, []byte{0, 0})
+		word = common.RightPadBytes(vote, 32)
+		code = append([]byte{byte(vm.PUSH32)}, word...)
+	)
+	code = append(code,
+		byte(vm.PUSH1), 0, byte(vm.MSTORE),
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), byte(len(vote)), byte(vm.PUSH1), 0,
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 9, byte(vm.GAS), byte(vm.CALL),
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.REVERT),
+	)
+	if _, _, err := Execute(code, nil, config(p2)); err == nil {
+		t.Errorf("reverting contract succeeded")
+	}
+	if have := proposal(); have != want {
+		t.Errorf("proposal changed by reverted contract: have %s, want %s", have, want)
+	}
+	// A deciding vote inside an enclosing frame that reverts afterwards
+	snapshot := statedb.Snapshot()
+	if _, _, err := Call(vm.KycContractAddress, vote, config(p2)); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	if !statedb.KycProviderExists(candidate) {
+		t.Fatalf("candidate not added by deciding vote")
+	}
+	statedb.RevertToSnapshot(snapshot)
+
+	if have := proposal(); have != want {
+		t.Errorf("proposal not restored by revert: have %s, want %s", have, want)
+	}
+	if count := statedb.GetKycProviderCount(); count != 3 {
+		t.Errorf("provider count mismatch: have %d, want 3", count)
+	}
+	if statedb.KycProviderExists(candidate) {
+		t.Errorf("candidate still a provider after revert")
+	}
+	// A competing proposal for the same candidate while this one is still open
+	if _, _, err := Call(vm.KycContractAddress, kycInput(vm.KycMethodProviderVoteProposal, candidate.Bytes(), pt), config(p3)); err == nil {
+		t.Errorf("competing proposal accepted")
+	}
+	if have := proposal(); have != want {
+		t.Errorf("proposal changed by competing proposal: have %s, want %s", have, want)
+	}
+}
+
+// Tests who may cancel a KYC provider proposal: the proposer at any time, any
+// provider once it expired, from the proposal cancel fork on.
+func TestKycProposalCancel(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		p1, p2, p3 = common.HexToAddress("0x0101"), common.HexToAddress("0x0102"), common.HexToAddress("0x0103")
+		candidate  = common.HexToAddress("0x0201")
+		blockTime  = big.NewInt(1000000)
+	)
+	for _, provider := range []common.Address{p1, p2, p3} {
+		statedb.AddKycProvider(provider)
+	}
+	chainConfig := &params.ChainConfig{ChainId: big.NewInt(1), KycProposalQueueBlock: big.NewInt(0), KycProposalCancelBlock: big.NewInt(1)}
+	call := func(origin common.Address, input []byte) error {
+		_, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: chainConfig, State: statedb, Origin: origin, BlockNumber: big.NewInt(1), Time: blockTime, GasLimit: 100000})
+		return err
+	}
+	pt := make([]byte, 8)
+	binary.BigEndian.PutUint64(pt, 1)
+
+	var (
+		propose = kycInput(vm.KycMethodProviderVoteProposal, candidate.Bytes(), pt)
+		nay     = kycInput(vm.KycMethodVote, []byte{0, 1})
+		cancel  = kycInput(vm.KycMethodCancelProposal)
+	)
+	pending := func() bool {
+		return len(statedb.GetKycProviderProposolIds()) != 0
+	}
+	// Before the fork there is no way to withdraw a proposal
+	if err := call(p1, propose); err != nil {
+		t.Fatalf("failed to start proposal: %v", err)
+	}
+	if _, _, err := Call(vm.KycContractAddress, cancel, &Config{ChainConfig: chainConfig, State: statedb, Origin: p1, BlockNumber: big.NewInt(0), Time: blockTime, GasLimit: 100000}); err != vm.ErrKycUnknownMethod || !pending() {
+		t.Errorf("pre-fork cancel error mismatch: have %v, want %v", err, vm.ErrKycUnknownMethod)
+	}
+	// Only the proposer may withdraw an open proposal
+	if err := call(p2, cancel); err == nil || !pending() {
+		t.Errorf("non-proposer cancelled open proposal")
+	}
+	if err := call(candidate, cancel); err == nil || !pending() {
+		t.Errorf("non-provider cancelled open proposal")
+	}
+	if err := call(p1, cancel); err != nil || pending() {
+		t.Errorf("proposer failed to cancel: %v", err)
+	}
+	if err := call(p1, cancel); err == nil {
+		t.Errorf("cancelled missing proposal")
+	}
+	// A proposal rejected by the majority is dropped right away
+	if err := call(p1, propose); err != nil {
+		t.Fatalf("failed to restart proposal: %v", err)
+	}
+	if err := call(p2, nay); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	if err := call(p2, cancel); err == nil || !pending() {
+		t.Errorf("minority cancelled open proposal")
+	}
+	if err := call(p3, nay); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	if pending() {
+		t.Errorf("rejected proposal still pending")
+	}
+	// Any provider may clean up an expired proposal
+	if err := call(p1, propose); err != nil {
+		t.Fatalf("failed to restart proposal: %v", err)
+	}
+	blockTime = new(big.Int).Add(blockTime, big.NewInt(86400))
+	if err := call(p2, nay); err == nil {
+		t.Errorf("voted on expired proposal")
+	}
+	if err := call(p3, cancel); err != nil || pending() {
+		t.Errorf("failed to cancel expired proposal: %v", err)
+	}
+}
+
+// Tests that provider proposals are decided according to the configured quorum,
+// passing once the yes votes exceed it and, from the proposal queue fork on,
+// failing once they no longer can.
+func TestKycProposalQuorum(t *testing.T) {
+	supermajority := &params.KycConfig{QuorumNumerator: 2, QuorumDenominator: 3}
+
+	tests := []struct {
+		quorum    *params.KycConfig
+		providers int
+		votes     string // votes cast after the proposer's own yes
+		want      string // passed, rejected or pending
+	}{
+		{supermajority, 3, "y", "pending"}, // 2 of 3 is a tie, not more than 2/3
+		{supermajority, 3, "yy", "passed"},
+		{supermajority, 3, "n", "rejected"},
+		{supermajority, 4, "y", "pending"},
+		{supermajority, 4, "yy", "passed"},
+		{supermajority, 4, "n", "pending"},
+		{supermajority, 4, "nn", "rejected"},
+		{supermajority, 4, "nyy", "passed"},
+		{supermajority, 7, "yyy", "pending"},
+		{supermajority, 7, "yyyy", "passed"},
+		{supermajority, 7, "nn", "pending"},
+		{supermajority, 7, "nnn", "rejected"},
+		{supermajority, 7, "nnyyyy", "passed"},
+		{nil, 4, "y", "pending"}, // 2 of 4 is a tie, not a majority
+		{nil, 4, "yy", "passed"},
+		{nil, 4, "nn", "rejected"},
+	}
+	for i, tt := range tests {
+		for _, queued := range []bool{false, true} {
+			testKycProposalQuorum(t, i, tt.quorum, tt.providers, tt.votes, tt.want, queued)
+		}
+	}
+}
+
+func testKycProposalQuorum(t *testing.T, i int, quorum *params.KycConfig, count int, votes string, want string, queued bool) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	candidate := common.HexToAddress("0x0201")
+	providers := make([]common.Address, count)
+	for j := range providers {
+		providers[j] = common.BigToAddress(big.NewInt(int64(0x100 + j)))
+		statedb.AddKycProvider(providers[j])
+	}
+	chainConfig := &params.ChainConfig{ChainId: big.NewInt(1), Kyc: quorum}
+	if queued {
+		chainConfig.KycProposalQueueBlock = big.NewInt(0)
+	} else if want == "rejected" {
+		// the single proposal before the queue is only dropped once expired
+		want = "pending"
+	}
+	config := &Config{
+		ChainConfig: chainConfig,
+		State:       statedb,
+		Time:        big.NewInt(1000000),
+		GasLimit:    100000,
+	}
+	call := func(origin common.Address, input []byte) ([]byte, error) {
+		config.Origin = origin
+		ret, _, err := Call(vm.KycContractAddress, input, config)
+		return ret, err
+	}
+	pt := make([]byte, 8)
+	binary.BigEndian.PutUint64(pt, 1)
+	ret, err := call(providers[0], kycInput(vm.KycMethodProviderVoteProposal, candidate.Bytes(), pt))
+	if err != nil {
+		t.Fatalf("test %d (queued %v): failed to start proposal: %v", i, queued, err)
+	}
+	id := new(big.Int).SetBytes(ret).Uint64()
+	for j, vote := range votes {
+		nay := []byte{0, 0}
+		if vote == 'n' {
+			nay[1] = 1
+		}
+		if _, err := call(providers[j+1], kycInput(vm.KycMethodVote, nay)); err != nil {
+			t.Fatalf("test %d (queued %v): vote %d failed: %v", i, queued, j, err)
+		}
+	}
+	addr, _, _, _, _, _ := statedb.GetKycProviderProposol(id)
+
+	have := "pending"
+	switch {
+	case statedb.KycProviderExists(candidate):
+		have = "passed"
+	case addr == (common.Address{}):
+		have = "rejected"
+	}
+	if have != want {
+		t.Errorf("test %d (queued %v): %d providers voting %q: have %s, want %s", i, queued, count, votes, have, want)
+	}
+}
+
+
 func BenchmarkCall(b *testing.B) {
 	var definition = `[{"constant":true,"inputs":[],"name":"seller","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"abort","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"value","outputs":[{"name":"","type":"uint256"}],"type":"function"},{"constant":false,"inputs":[],"name":"refund","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"buyer","outputs":[{"name":"","type":"address"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmReceived","outputs":[],"type":"function"},{"constant":true,"inputs":[],"name":"state","outputs":[{"name":"","type":"uint8"}],"type":"function"},{"constant":false,"inputs":[],"name":"confirmPurchase","outputs":[],"type":"function"},{"inputs":[],"type":"constructor"},{"anonymous":false,"inputs":[],"name":"Aborted","type":"event"},{"anonymous":false,"inputs":[],"name":"PurchaseConfirmed","type":"event"},{"anonymous":false,"inputs":[],"name":"ItemReceived","type":"event"},{"anonymous":false,"inputs":[],"name":"Refunded","type":"event"}]`
 
@@ -149,3 +421,2043 @@ func BenchmarkCall(b *testing.B) {
 		}
 	}
 }
+
+// Tests that setting the KYC info of an address records the change along with
+// the values it replaced, from the history fork on.
+func TestKycHistoryRecorded(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		provider    = common.HexToAddress("0x0101")
+		user        = common.HexToAddress("0x0201")
+		chainConfig = &params.ChainConfig{ChainId: big.NewInt(1), KycHistoryBlock: big.NewInt(1)}
+	)
+	statedb.AddKycProvider(provider)
+
+	set := func(level, zone uint32, time int64, number int64) {
+		info := make([]byte, 8)
+		binary.BigEndian.PutUint32(info[0:4], level)
+		binary.BigEndian.PutUint32(info[4:8], zone)
+		if _, _, err := Call(vm.KycContractAddress, kycInput(vm.KycMethodSet, user.Bytes(), info), &Config{ChainConfig: chainConfig, State: statedb, Origin: provider, Time: big.NewInt(time), BlockNumber: big.NewInt(number), GasLimit: 200000}); err != nil {
+			t.Fatalf("failed to set kyc info: %v", err)
+		}
+	}
+	// Changes before the fork are not recorded
+	set(1, 4, 500, 0)
+	if have := statedb.GetKycHistory(user, 0, 10); len(have) != 0 {
+		t.Fatalf("history recorded before the fork: %v", have)
+	}
+	set(2, 5, 1000, 1)
+	set(3, 6, 2000, 2)
+
+	want := []common.KycHistoryEntry{
+		{Time: 1000, Provider: provider, OldLevel: 1, NewLevel: 2, OldZone: 4, NewZone: 5},
+		{Time: 2000, Provider: provider, OldLevel: 2, NewLevel: 3, OldZone: 5, NewZone: 6},
+	}
+	if have := statedb.GetKycHistory(user, 0, 10); !reflect.DeepEqual(have, want) {
+		t.Errorf("history mismatch: have %v, want %v", have, want)
+	}
+}
+
+// Tests that recording a KYC change is charged for the slots its history entry
+// takes, and that the change fails as a whole if that gas runs short.
+func TestKycHistoryGas(t *testing.T) {
+	var (
+		provider = common.HexToAddress("0x0101")
+		user     = common.HexToAddress("0x0201")
+		legacy   = &params.ChainConfig{ChainId: big.NewInt(1)}
+		history  = &params.ChainConfig{ChainId: big.NewInt(1), KycHistoryBlock: big.NewInt(0)}
+		input    = kycInput(vm.KycMethodSet, user.Bytes(), []byte{0, 0, 0, 2, 0, 0, 0, 5})
+	)
+	set := func(chainConfig *params.ChainConfig, gas uint64) (*state.StateDB, uint64, error) {
+		db, _ := wondb.NewMemDatabase()
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+		statedb.AddKycProvider(provider)
+
+		_, left, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: chainConfig, State: statedb, Origin: provider, GasLimit: gas})
+		return statedb, gas - left, err
+	}
+	_, legacyUsed, err := set(legacy, 200000)
+	if err != nil {
+		t.Fatalf("failed to set kyc info before the fork: %v", err)
+	}
+	_, historyUsed, err := set(history, 200000)
+	if err != nil {
+		t.Fatalf("failed to set kyc info after the fork: %v", err)
+	}
+	if want := legacyUsed + 3*params.SstoreSetGas; historyUsed != want {
+		t.Errorf("gas used mismatch: have %d, want %d", historyUsed, want)
+	}
+	statedb, _, err := set(history, historyUsed-1)
+	if err != vm.ErrOutOfGas {
+		t.Fatalf("error mismatch: have %v, want %v", err, vm.ErrOutOfGas)
+	}
+	if level := statedb.GetKycLevel(user, 0); level != 0 {
+		t.Errorf("kyc level set without gas for the history: %d", level)
+	}
+	if have := statedb.GetKycHistory(user, 0, 10); len(have) != 0 {
+		t.Errorf("history recorded without gas for it: %v", have)
+	}
+}
+
+// Tests that transfers from and to an address are rejected once its KYC
+// attestation expired, until a provider renews it. Expiries are only read from
+// the expiry fork on.
+func TestKycExpiry(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		provider    = common.HexToAddress("0x0101")
+		user        = common.HexToAddress("0x0201")
+		peer        = common.HexToAddress("0x0202")
+		chainConfig = &params.ChainConfig{ChainId: big.NewInt(1), KycExpiryBlock: big.NewInt(1)}
+		number      = big.NewInt(0)
+	)
+	statedb.AddKycProvider(provider)
+	statedb.AddBalance(user, big.NewInt(1000))
+	statedb.AddBalance(peer, big.NewInt(1000))
+
+	set := func(addr common.Address, expiresAt uint64) {
+		info := make([]byte, 16)
+		binary.BigEndian.PutUint32(info[0:4], 1)
+		binary.BigEndian.PutUint32(info[4:8], 1)
+		binary.BigEndian.PutUint64(info[8:16], expiresAt)
+		if _, _, err := Call(vm.KycContractAddress, kycInput(vm.KycMethodSet, addr.Bytes(), info), &Config{ChainConfig: chainConfig, State: statedb, Origin: provider, BlockNumber: number, Time: big.NewInt(1000), GasLimit: 100000}); err != nil {
+			t.Fatalf("failed to set kyc info: %v", err)
+		}
+	}
+	transfer := func(from, to common.Address, time int64) error {
+		_, _, err := Call(to, nil, &Config{State: statedb, Origin: from, Time: big.NewInt(time), GasLimit: 100000, Value: common.Big1})
+		return err
+	}
+	// Before the fork the expiry is ignored
+	set(user, 2000)
+	if expiry := statedb.GetKycExpiry(user); expiry != 0 {
+		t.Fatalf("pre-fork expiry recorded: %d", expiry)
+	}
+	number = big.NewInt(1)
+	set(user, 2000)
+	set(peer, 0)
+	if expiry := statedb.GetKycExpiry(user); expiry != 2000 {
+		t.Fatalf("expiry mismatch: have %d, want 2000", expiry)
+	}
+	if err := transfer(user, peer, 1999); err != nil {
+		t.Errorf("transfer before expiry failed: %v", err)
+	}
+	if err := transfer(peer, user, 1999); err != nil {
+		t.Errorf("transfer to user before expiry failed: %v", err)
+	}
+	if err := transfer(user, peer, 2000); err != vm.ErrTxKycValidateFailed {
+		t.Errorf("transfer from expired user: have %v, want %v", err, vm.ErrTxKycValidateFailed)
+	}
+	if err := transfer(peer, user, 2000); err != vm.ErrTxKycValidateFailed {
+		t.Errorf("transfer to expired user: have %v, want %v", err, vm.ErrTxKycValidateFailed)
+	}
+	if err := transfer(peer, provider, 1000000); err != nil {
+		t.Errorf("transfer from non-expiring peer failed: %v", err)
+	}
+	// Renewing the attestation without an expiry lifts the restriction
+	set(user, 0)
+	if err := transfer(user, peer, 1000000); err != nil {
+		t.Errorf("transfer after renewal failed: %v", err)
+	}
+}
+
+// Tests that a KYC batch stops at the first entry it can't pay for or that
+// belongs to another provider, keeping the entries set before it.
+func TestKycSetBatch(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		p1, p2      = common.HexToAddress("0x0101"), common.HexToAddress("0x0102")
+		users       = []common.Address{common.HexToAddress("0x0201"), common.HexToAddress("0x0202"), common.HexToAddress("0x0203")}
+		chainConfig = &params.ChainConfig{ChainId: big.NewInt(1), KycSetBatchBlock: big.NewInt(1)}
+		number      = big.NewInt(1)
+	)
+	statedb.AddKycProvider(p1)
+	statedb.AddKycProvider(p2)
+
+	batch := func(addrs ...common.Address) []byte {
+		var input []byte
+		for i, addr := range addrs {
+			entry := make([]byte, 36)
+			copy(entry, addr.Bytes())
+			binary.BigEndian.PutUint32(entry[20:24], uint32(i+1))
+			binary.BigEndian.PutUint32(entry[24:28], 7)
+			input = append(input, entry...)
+		}
+		return kycInput(vm.KycMethodSetBatch, input)
+	}
+	call := func(origin common.Address, input []byte, gas uint64) (uint64, error) {
+		ret, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: chainConfig, State: statedb, Origin: origin, BlockNumber: number, Time: big.NewInt(1000), GasLimit: gas})
+		return new(big.Int).SetBytes(ret).Uint64(), err
+	}
+	// Before the fork there are no batches
+	number = big.NewInt(0)
+	if _, err := call(p1, batch(users...), 100000); err != vm.ErrKycUnknownMethod {
+		t.Fatalf("pre-fork batch error mismatch: have %v, want %v", err, vm.ErrKycUnknownMethod)
+	}
+	if level := statedb.GetKycLevel(users[0], 1000); level != 0 {
+		t.Fatalf("pre-fork batch set level %d", level)
+	}
+	number = big.NewInt(1)
+
+	// Run out of gas on the last entry, the first two must stick
+	done, err := call(p1, batch(users...), 3000+2*3000+2999)
+	if err != nil {
+		t.Fatalf("partially paid batch failed: %v", err)
+	}
+	if done != 2 {
+		t.Errorf("processed entries mismatch: have %d, want 2", done)
+	}
+	for i, user := range users {
+		want := uint32(i + 1)
+		if i == 2 {
+			want = 0
+		}
+		if level := statedb.GetKycLevel(user, 1000); level != want {
+			t.Errorf("user %d: level mismatch: have %d, want %d", i, level, want)
+		}
+	}
+	if logs := statedb.Logs(); len(logs) != 1 || new(big.Int).SetBytes(logs[0].Data).Uint64() != 2 {
+		t.Errorf("batch log mismatch: have %v", logs)
+	}
+	// A competing provider stops at the first address it doesn't own
+	if done, err := call(p2, batch(users[2], users[0], users[1]), 100000); err != nil || done != 1 {
+		t.Errorf("conflicting batch: have %d, %v, want 1, nil", done, err)
+	}
+	if provider := statedb.GetKycProvider(users[0]); provider != p1 {
+		t.Errorf("conflicting batch took over user: have %x, want %x", provider, p1)
+	}
+	// Malformed and oversized batches are rejected as a whole
+	if _, err := call(p1, append(batch(users[0]), 0), 100000); err == nil {
+		t.Errorf("malformed batch accepted")
+	}
+	oversized := make([]common.Address, 257)
+	for i := range oversized {
+		oversized[i] = common.BigToAddress(big.NewInt(int64(0x1000 + i)))
+	}
+	if _, err := call(p1, batch(oversized...), 10000000); err == nil {
+		t.Errorf("oversized batch accepted")
+	}
+	if _, err := call(users[0], batch(users[0]), 100000); err == nil {
+		t.Errorf("batch from non-provider accepted")
+	}
+}
+
+// contractCreatorInit returns the init code of a contract that creates a child
+// contract in its constructor and whenever it is called.
+func contractCreatorInit() []byte {
+	// child deploys a contract consisting of a single STOP
+	child := []byte{0x60, 0x00, 0x60, 0x00, 0x53, 0x60, 0x01, 0x60, 0x00, 0xf3}
+	// create stores child in memory and CREATEs it
+	create := append(append([]byte{0x69}, child...), 0x60, 0x00, 0x52, 0x60, byte(len(child)), 0x60, byte(32-len(child)), 0x60, 0x00, 0xf0)
+	// parent creates a child in its constructor and whenever called
+	code := append(append([]byte{}, create...), 0x00)
+	deploy := []byte{0x60, byte(len(code)), 0x60, 0x00, 0x60, 0x00, 0x39, 0x60, byte(len(code)), 0x60, 0x00, 0xf3}
+	init := append(append([]byte{}, create...), 0x50)
+	deploy[3] = byte(len(init) + len(deploy))
+	return append(append(init, deploy...), code...)
+}
+
+// Tests that contracts created by contracts, both from the constructor and
+// later on, resolve to the human creator, and that removing its KYC provider
+// doesn't change the creator.
+func TestContractCreator(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		p1, p2      = common.HexToAddress("0x0101"), common.HexToAddress("0x0102")
+		user        = common.HexToAddress("0x0201")
+		chainConfig = &params.ChainConfig{ChainId: big.NewInt(1), KycContractCreatorBlock: big.NewInt(0)}
+	)
+	statedb.AddKycProvider(p1)
+	statedb.AddKycProvider(p2)
+	statedb.SetKycProvider(user, p1)
+	statedb.SetKycLevel(user, 3)
+	statedb.SetKycZone(user, 5)
+
+	_, parent, _, err := Create(contractCreatorInit(), &Config{ChainConfig: chainConfig, State: statedb, Origin: user, GasLimit: 1000000})
+	if err != nil {
+		t.Fatalf("failed to create parent: %v", err)
+	}
+	if _, _, err := Call(parent, nil, &Config{ChainConfig: chainConfig, State: statedb, Origin: user, GasLimit: 1000000}); err != nil {
+		t.Fatalf("failed to call parent: %v", err)
+	}
+	contracts := []common.Address{parent, crypto.CreateAddress(parent, 1), crypto.CreateAddress(parent, 2)}
+	for i, contract := range contracts {
+		if !statedb.IsContractAddress(contract) {
+			t.Fatalf("contract %d: missing code", i)
+		}
+		if creator := statedb.GetContractCreator(contract); creator != user {
+			t.Errorf("contract %d: creator mismatch: have %x, want %x", i, creator, user)
+		}
+		if level, zone := statedb.GetKycLevel(contract, 0), statedb.GetKycZone(contract); level != 3 || zone != 5 {
+			t.Errorf("contract %d: kyc mismatch: have %d/%d, want 3/5", i, level, zone)
+		}
+	}
+	// Contracts whose code can't be paid for record no creator
+	init := []byte{0x60, 0x64, 0x60, 0x00, 0xf3} // return 100 bytes of code
+	if _, codeless, _, err := Create(init, &Config{ChainConfig: chainConfig, State: statedb, Origin: user, GasLimit: 100}); err != vm.ErrCodeStoreOutOfGas {
+		t.Errorf("codeless create error mismatch: have %v, want %v", err, vm.ErrCodeStoreOutOfGas)
+	} else if slot := statedb.GetState(vm.KycContractAddress, state.KycContractCreatorKey(codeless)); slot != (common.Hash{}) {
+		t.Errorf("codeless contract recorded creator %x", slot)
+	}
+	// Removing the provider revokes the KYC info but keeps the creator
+	statedb.RemoveKycProvider(p1)
+	for i, contract := range contracts {
+		if creator := statedb.GetContractCreator(contract); creator != user {
+			t.Errorf("contract %d: creator changed after provider removal: have %x, want %x", i, creator, user)
+		}
+		if level := statedb.GetKycLevel(contract, 0); level != 0 {
+			t.Errorf("contract %d: level after provider removal: have %d, want 0", i, level)
+		}
+	}
+	// Another provider's attestation of the creator carries over to its contracts
+	statedb.SetKycProvider(user, p2)
+	for i, contract := range contracts {
+		if provider := statedb.GetKycProvider(contract); provider != p2 {
+			t.Errorf("contract %d: provider mismatch: have %x, want %x", i, provider, p2)
+		}
+	}
+}
+
+// Tests that before the contract creator fork the KYC info of the creator is
+// copied onto new contracts, without recording their creator.
+func TestContractCreatorLegacy(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		provider = common.HexToAddress("0x0101")
+		user     = common.HexToAddress("0x0201")
+	)
+	statedb.AddKycProvider(provider)
+	statedb.SetKycProvider(user, provider)
+	statedb.SetKycLevel(user, 3)
+	statedb.SetKycZone(user, 5)
+
+	_, parent, _, err := Create(contractCreatorInit(), &Config{State: statedb, Origin: user, GasLimit: 1000000})
+	if err != nil {
+		t.Fatalf("failed to create parent: %v", err)
+	}
+	if _, _, err := Call(parent, nil, &Config{State: statedb, Origin: user, GasLimit: 1000000}); err != nil {
+		t.Fatalf("failed to call parent: %v", err)
+	}
+	// The constructor's child is created before its parent is a contract
+	tests := []struct {
+		contract common.Address
+		creator  common.Address
+	}{
+		{parent, user},
+		{crypto.CreateAddress(parent, 1), parent},
+		{crypto.CreateAddress(parent, 2), user},
+	}
+	for i, tt := range tests {
+		if slot := statedb.GetState(vm.KycContractAddress, state.KycContractCreatorKey(tt.contract)); slot != (common.Hash{}) {
+			t.Errorf("contract %d: creator recorded before the fork: %x", i, slot)
+		}
+		if creator := statedb.GetContractCreator(tt.contract); creator != tt.creator {
+			t.Errorf("contract %d: creator mismatch: have %x, want %x", i, creator, tt.creator)
+		}
+	}
+}
+
+// Tests that zone pairs are restricted and allowed again through provider
+// proposals from the zone proposal fork on, and that malformed or redundant zone
+// proposals are rejected.
+func TestKycZoneProposal(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	p1, p2, p3 := common.HexToAddress("0x0101"), common.HexToAddress("0x0102"), common.HexToAddress("0x0103")
+	for _, provider := range []common.Address{p1, p2, p3} {
+		statedb.AddKycProvider(provider)
+	}
+	var (
+		chainConfig = &params.ChainConfig{ChainId: big.NewInt(1), KycZoneProposalBlock: big.NewInt(1)}
+		number      = big.NewInt(1)
+	)
+	call := func(origin common.Address, input []byte) error {
+		_, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: chainConfig, State: statedb, Origin: origin, BlockNumber: number, Time: big.NewInt(1000), GasLimit: 100000})
+		return err
+	}
+	propose := func(subject common.Address, pt uint64) []byte {
+		ptb := make([]byte, 8)
+		binary.BigEndian.PutUint64(ptb, pt)
+		return kycInput(vm.KycMethodProviderVoteProposal, subject.Bytes(), ptb)
+	}
+	yea := kycInput(vm.KycMethodVote, []byte{0, 0})
+	pair := vm.KycZonePairAddress(10, 20)
+
+	number = big.NewInt(0)
+	if err := call(p1, propose(pair, vm.KycProposalRestrictZones)); err != vm.ErrKycInvalidProposal {
+		t.Errorf("pre-fork zone proposal error mismatch: have %v, want %v", err, vm.ErrKycInvalidProposal)
+	}
+	number = big.NewInt(1)
+
+	if err := call(p1, propose(pair, vm.KycProposalAllowZones)); err == nil {
+		t.Errorf("allowed unrestricted zone pair")
+	}
+	if err := call(p1, propose(common.HexToAddress("0x0201"), vm.KycProposalRestrictZones)); err == nil {
+		t.Errorf("accepted zone proposal for a non zone pair")
+	}
+	if err := call(p1, propose(pair, vm.KycProposalRestrictZones)); err != nil {
+		t.Fatalf("failed to propose restriction: %v", err)
+	}
+	if statedb.IsKycZoneRestricted(10, 20) {
+		t.Fatalf("zone pair restricted before the majority voted")
+	}
+	if err := call(p2, yea); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	if !statedb.IsKycZoneRestricted(10, 20) || statedb.IsKycZoneRestricted(20, 10) {
+		t.Fatalf("restriction mismatch: have %v/%v, want true/false", statedb.IsKycZoneRestricted(10, 20), statedb.IsKycZoneRestricted(20, 10))
+	}
+	if err := call(p1, propose(pair, vm.KycProposalRestrictZones)); err == nil {
+		t.Errorf("restricted zone pair twice")
+	}
+	if err := call(p3, propose(pair, vm.KycProposalAllowZones)); err != nil {
+		t.Fatalf("failed to propose lifting the restriction: %v", err)
+	}
+	if err := call(p1, yea); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	if statedb.IsKycZoneRestricted(10, 20) || statedb.GetKycZoneRestrictionCount() != 0 {
+		t.Errorf("restriction not lifted")
+	}
+}
+
+// Tests that the KYC level thresholds can be read through the precompile by
+// any caller, ordered by amount, from the threshold query fork on.
+func TestKycGetLevelThresholds(t *testing.T) {
+	config := &params.ChainConfig{
+		ChainId:                big.NewInt(1),
+		KycThresholdQueryBlock: big.NewInt(1),
+		Kyc: &params.KycConfig{
+			LevelThresholds: []params.KycLevelThreshold{
+				{Amount: big.NewInt(5000), Level: 3},
+				{Amount: big.NewInt(1000), Level: 2},
+			},
+		},
+	}
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	statedb.AddKycProvider(common.HexToAddress("0x0101"))
+
+	if _, _, err := Call(vm.KycContractAddress, kycInput(vm.KycMethodGetLevelThresholds), &Config{ChainConfig: config, State: statedb, Origin: common.HexToAddress("0x0201"), GasLimit: 100000}); err != vm.ErrKycUnknownMethod {
+		t.Errorf("pre-fork error mismatch: have %v, want %v", err, vm.ErrKycUnknownMethod)
+	}
+	ret, _, err := Call(vm.KycContractAddress, kycInput(vm.KycMethodGetLevelThresholds), &Config{ChainConfig: config, State: statedb, Origin: common.HexToAddress("0x0201"), BlockNumber: big.NewInt(1), GasLimit: 100000})
+	if err != nil {
+		t.Fatalf("failed to read thresholds: %v", err)
+	}
+	want := append(append(append(append([]byte{},
+		common.BigToHash(big.NewInt(1000)).Bytes()...),
+		common.BigToHash(big.NewInt(2)).Bytes()...),
+		common.BigToHash(big.NewInt(5000)).Bytes()...),
+		common.BigToHash(big.NewInt(3)).Bytes()...)
+	if !bytes.Equal(ret, want) {
+		t.Errorf("thresholds mismatch: have %x, want %x", ret, want)
+	}
+}
+
+// Tests that the metadata of new providers is stored both when they're added
+// right away and when they're voted in, and that it can be read back through
+// the precompile, from the provider info fork on.
+func TestKycProviderInfo(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	p1, p2, p3 := common.HexToAddress("0x0101"), common.HexToAddress("0x0102"), common.HexToAddress("0x0103")
+	statedb.AddKycProvider(p1)
+
+	chainConfig := &params.ChainConfig{ChainId: big.NewInt(1), KycProviderInfoBlock: big.NewInt(1)}
+	call := func(origin common.Address, input []byte) ([]byte, error) {
+		ret, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: chainConfig, State: statedb, Origin: origin, BlockNumber: big.NewInt(1), Time: big.NewInt(1000), GasLimit: 100000})
+		return ret, err
+	}
+	propose := func(subject common.Address, pt uint64, info []byte) []byte {
+		ptb := make([]byte, 8)
+		binary.BigEndian.PutUint64(ptb, pt)
+		return kycInput(vm.KycMethodProviderVoteProposal, subject.Bytes(), ptb, info)
+	}
+	encode := func(info *common.KycProviderInfo) []byte {
+		blob, err := rlp.EncodeToBytes(info)
+		if err != nil {
+			t.Fatalf("failed to encode provider info: %v", err)
+		}
+		return blob
+	}
+	info2 := &common.KycProviderInfo{Address: p2, Name: "Acme Compliance GmbH ✓", Jurisdiction: "Zürich", URL: "https://acme.example"}
+	info3 := &common.KycProviderInfo{Address: p3, Name: "日本認証株式会社", Jurisdiction: "日本", URL: "https://kyc.example.jp"}
+
+	// Before the fork trailing bytes are ignored and there is nothing to read
+	legacy := statedb.Copy()
+	legacyCall := func(input []byte) error {
+		_, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: chainConfig, State: legacy, Origin: p1, Time: big.NewInt(1000), GasLimit: 100000})
+		return err
+	}
+	if err := legacyCall(propose(p2, vm.KycProposalAddProvider, []byte{0xc8, 0x01})); err != nil {
+		t.Fatalf("pre-fork proposal with trailing bytes failed: %v", err)
+	}
+	if !legacy.KycProviderExists(p2) || legacy.GetKycProviderInfoBlob(p2) != nil {
+		t.Errorf("pre-fork proposal mismatch: provider %v, info %x", legacy.KycProviderExists(p2), legacy.GetKycProviderInfoBlob(p2))
+	}
+	if err := legacyCall(kycInput(vm.KycMethodGetProviderInfo, p2.Bytes())); err != vm.ErrKycUnknownMethod {
+		t.Errorf("pre-fork read error mismatch: have %v, want %v", err, vm.ErrKycUnknownMethod)
+	}
+	// Malformed or misplaced metadata is rejected
+	if _, err := call(p1, propose(p2, vm.KycProposalAddProvider, []byte{0xc8, 0x01})); err == nil {
+		t.Errorf("accepted undecodable provider info")
+	}
+	if _, err := call(p1, propose(p2, vm.KycProposalAddProvider, make([]byte, vm.KycProviderInfoMaxSize+1))); err == nil {
+		t.Errorf("accepted oversized provider info")
+	}
+	if _, err := call(p1, propose(p1, vm.KycProposalRemoveProvider, encode(info2))); err == nil {
+		t.Errorf("accepted provider info for a removal")
+	}
+	// Added right away while there's a single provider
+	if _, err := call(p1, propose(p2, vm.KycProposalAddProvider, encode(info2))); err != nil {
+		t.Fatalf("failed to add provider: %v", err)
+	}
+	if have := statedb.GetKycProviderInfo(p2); !reflect.DeepEqual(have, info2) {
+		t.Fatalf("provider info mismatch: have %+v, want %+v", have, info2)
+	}
+	// Voted in by the majority
+	if _, err := call(p1, propose(p3, vm.KycProposalAddProvider, encode(info3))); err != nil {
+		t.Fatalf("failed to propose provider: %v", err)
+	}
+	if !bytes.Equal(statedb.GetKycProviderProposolInfo(0), encode(info3)) || statedb.KycProviderExists(p3) {
+		t.Fatalf("provider added before the majority voted")
+	}
+	if _, err := call(p2, kycInput(vm.KycMethodVote, []byte{0, 0})); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	if have := statedb.GetKycProviderInfo(p3); !reflect.DeepEqual(have, info3) {
+		t.Fatalf("voted provider info mismatch: have %+v, want %+v", have, info3)
+	}
+	if have := statedb.GetKycProviderProposolInfo(0); have != nil {
+		t.Errorf("proposal info left after the vote: %x", have)
+	}
+	// Anyone may read the metadata back
+	ret, err := call(common.HexToAddress("0x0201"), kycInput(vm.KycMethodGetProviderInfo, p3.Bytes()))
+	if err != nil {
+		t.Fatalf("failed to read provider info: %v", err)
+	}
+	if !bytes.Equal(ret, encode(info3)) {
+		t.Errorf("read provider info mismatch: have %x, want %x", ret, encode(info3))
+	}
+}
+
+// Tests that repeated proposals can't add a provider twice and thereby skew the
+// vote totals, and that removals stop at the configured minimum of providers.
+func TestKycProviderDuplicates(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	p1, p2, p3, p4 := common.HexToAddress("0x0101"), common.HexToAddress("0x0102"), common.HexToAddress("0x0103"), common.HexToAddress("0x0104")
+	statedb.AddKycProvider(p1)
+
+	chainConfig := &params.ChainConfig{ChainId: big.NewInt(1), KycProposalQueueBlock: big.NewInt(0), KycMinProvidersBlock: big.NewInt(0), Kyc: &params.KycConfig{MinProviders: 2}}
+	call := func(config *params.ChainConfig, origin common.Address, input []byte) error {
+		_, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: config, State: statedb, Origin: origin, Time: big.NewInt(1000), GasLimit: 100000})
+		return err
+	}
+	propose := func(subject common.Address, pt uint64) []byte {
+		ptb := make([]byte, 8)
+		binary.BigEndian.PutUint64(ptb, pt)
+		return kycInput(vm.KycMethodProviderVoteProposal, subject.Bytes(), ptb)
+	}
+	yea := kycInput(vm.KycMethodVote, []byte{0, 0})
+
+	// Before the fork even the last provider may be voted out
+	legacy := statedb.Copy()
+	if _, _, err := Call(vm.KycContractAddress, propose(p1, vm.KycProposalRemoveProvider), &Config{State: legacy, Origin: p1, Time: big.NewInt(1000), GasLimit: 100000}); err != nil {
+		t.Fatalf("failed to remove last provider before the fork: %v", err)
+	}
+	if count := legacy.GetKycProviderCount(); count != 0 {
+		t.Fatalf("provider count mismatch before the fork: have %d, want 0", count)
+	}
+	// The last provider can't be removed even without a configured minimum
+	if err := call(&params.ChainConfig{KycMinProvidersBlock: big.NewInt(0)}, p1, propose(p1, vm.KycProposalRemoveProvider)); err != vm.ErrKycProviderMinimum {
+		t.Fatalf("last provider removal error mismatch: have %v, want %v", err, vm.ErrKycProviderMinimum)
+	}
+	if err := call(chainConfig, p1, propose(p2, vm.KycProposalAddProvider)); err != nil {
+		t.Fatalf("failed to add provider: %v", err)
+	}
+	if err := call(chainConfig, p1, propose(p2, vm.KycProposalAddProvider)); err != vm.ErrKycProviderExists {
+		t.Fatalf("duplicate add error mismatch: have %v, want %v", err, vm.ErrKycProviderExists)
+	}
+	if statedb.AddKycProvider(p2) {
+		t.Fatalf("added provider twice directly")
+	}
+	// Vote a third provider in, then try again
+	if err := call(chainConfig, p1, propose(p3, vm.KycProposalAddProvider)); err != nil {
+		t.Fatalf("failed to propose provider: %v", err)
+	}
+	if err := call(chainConfig, p2, yea); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	if err := call(chainConfig, p2, propose(p3, vm.KycProposalAddProvider)); err != vm.ErrKycProviderExists {
+		t.Fatalf("duplicate proposal error mismatch: have %v, want %v", err, vm.ErrKycProviderExists)
+	}
+	if have, want := statedb.GetKycProviderList(), []common.Address{p1, p2, p3}; !reflect.DeepEqual(have, want) {
+		t.Fatalf("provider list mismatch: have %x, want %x", have, want)
+	}
+	// The next proposal must count every provider exactly once
+	if err := call(chainConfig, p3, propose(p4, vm.KycProposalAddProvider)); err != nil {
+		t.Fatalf("failed to propose provider: %v", err)
+	}
+	if _, _, total, _, yes, _ := statedb.GetKycProviderProposol(1); total.Uint64() != 3 || yes.Uint64() != 1 {
+		t.Fatalf("vote totals mismatch: have %d/%d, want 1/3", yes, total)
+	}
+	if err := call(chainConfig, p1, yea); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	// Removals are fine down to the configured minimum only
+	if err := call(chainConfig, p1, propose(p4, vm.KycProposalRemoveProvider)); err != nil {
+		t.Fatalf("failed to propose removal: %v", err)
+	}
+	for _, voter := range []common.Address{p2, p3} {
+		if err := call(chainConfig, voter, yea); err != nil {
+			t.Fatalf("failed to vote: %v", err)
+		}
+	}
+	if err := call(chainConfig, p1, propose(p3, vm.KycProposalRemoveProvider)); err != nil {
+		t.Fatalf("failed to propose removal: %v", err)
+	}
+	if err := call(chainConfig, p2, yea); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	if err := call(chainConfig, p1, propose(p2, vm.KycProposalRemoveProvider)); err != vm.ErrKycProviderMinimum {
+		t.Errorf("removal below minimum error mismatch: have %v, want %v", err, vm.ErrKycProviderMinimum)
+	}
+	if have, want := statedb.GetKycProviderList(), []common.Address{p1, p2}; !reflect.DeepEqual(have, want) {
+		t.Errorf("provider list mismatch: have %x, want %x", have, want)
+	}
+}
+
+// Tests that overlapping provider proposals are voted on and decided on their
+// own, whichever of them resolves first, and that the queue is capped while
+// expired proposals make room for new ones.
+func TestKycProposalQueue(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		p1, p2, p3, p4 = common.HexToAddress("0x0101"), common.HexToAddress("0x0102"), common.HexToAddress("0x0103"), common.HexToAddress("0x0104")
+		c1, c2         = common.HexToAddress("0x0201"), common.HexToAddress("0x0202")
+		blockTime      = big.NewInt(1000000)
+		queued         = &params.ChainConfig{ChainId: big.NewInt(1), KycProposalQueueBlock: big.NewInt(0), KycZoneProposalBlock: big.NewInt(0)}
+	)
+	for _, provider := range []common.Address{p1, p2, p3, p4} {
+		statedb.AddKycProvider(provider)
+	}
+	call := func(origin common.Address, input []byte) ([]byte, error) {
+		ret, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: queued, State: statedb, Origin: origin, Time: blockTime, GasLimit: 1000000})
+		return ret, err
+	}
+	propose := func(origin common.Address, subject common.Address, pt uint64) (uint64, error) {
+		ptb := make([]byte, 8)
+		binary.BigEndian.PutUint64(ptb, pt)
+		ret, err := call(origin, kycInput(vm.KycMethodProviderVoteProposal, subject.Bytes(), ptb))
+		if err != nil {
+			return 0, err
+		}
+		return new(big.Int).SetBytes(ret).Uint64(), nil
+	}
+	vote := func(origin common.Address, id uint64, nay byte) {
+		idb := make([]byte, 8)
+		binary.BigEndian.PutUint64(idb, id)
+		if _, err := call(origin, kycInput(vm.KycMethodVote, []byte{0, nay}, idb)); err != nil {
+			t.Fatalf("%x failed to vote on proposal %d: %v", origin, id, err)
+		}
+	}
+	// Two additions, the younger one passing first
+	id0, err := propose(p1, c1, vm.KycProposalAddProvider)
+	if err != nil || id0 != 0 {
+		t.Fatalf("first proposal mismatch: have %d/%v, want 0/nil", id0, err)
+	}
+	id1, err := propose(p2, c2, vm.KycProposalAddProvider)
+	if err != nil || id1 != 1 {
+		t.Fatalf("second proposal mismatch: have %d/%v, want 1/nil", id1, err)
+	}
+	vote(p3, id1, 0)
+	vote(p4, id1, 0)
+	if !statedb.KycProviderExists(c2) || statedb.KycProviderExists(c1) {
+		t.Fatalf("younger proposal not decided on its own")
+	}
+	if ids := statedb.GetKycProviderProposolIds(); !reflect.DeepEqual(ids, []uint64{id0}) {
+		t.Fatalf("pending proposals mismatch: have %v, want %v", ids, []uint64{id0})
+	}
+	vote(p2, id0, 0)
+	vote(p3, id0, 0)
+	if !statedb.KycProviderExists(c1) {
+		t.Fatalf("older proposal not passed")
+	}
+	if ids := statedb.GetKycProviderProposolIds(); len(ids) != 0 {
+		t.Fatalf("decided proposals left pending: %v", ids)
+	}
+	// A removal and a zone restriction, the younger one rejected first
+	id2, err := propose(p1, c2, vm.KycProposalRemoveProvider)
+	if err != nil {
+		t.Fatalf("failed to propose removal: %v", err)
+	}
+	id3, err := propose(p2, vm.KycZonePairAddress(10, 20), vm.KycProposalRestrictZones)
+	if err != nil {
+		t.Fatalf("failed to propose zone restriction: %v", err)
+	}
+	for _, voter := range []common.Address{p3, p4, c1} {
+		vote(voter, id3, 1)
+	}
+	if statedb.IsKycZoneRestricted(10, 20) {
+		t.Fatalf("rejected zone restriction applied")
+	}
+	if ids := statedb.GetKycProviderProposolIds(); !reflect.DeepEqual(ids, []uint64{id2}) {
+		t.Fatalf("pending proposals mismatch: have %v, want %v", ids, []uint64{id2})
+	}
+	for _, voter := range []common.Address{p2, p3, p4} {
+		vote(voter, id2, 0)
+	}
+	if statedb.KycProviderExists(c2) {
+		t.Fatalf("older removal not passed")
+	}
+	// The queue is capped until the pending proposals expire
+	for i := uint32(0); i < vm.KycMaxProposals; i++ {
+		if _, err := propose(p1, vm.KycZonePairAddress(i, i+1), vm.KycProposalRestrictZones); err != nil {
+			t.Fatalf("failed to queue proposal %d: %v", i, err)
+		}
+	}
+	if _, err := propose(p1, vm.KycZonePairAddress(100, 101), vm.KycProposalRestrictZones); err != vm.ErrKycProposalsFull {
+		t.Fatalf("full queue error mismatch: have %v, want %v", err, vm.ErrKycProposalsFull)
+	}
+	blockTime = new(big.Int).Add(blockTime, big.NewInt(86400))
+	if _, err := propose(p1, vm.KycZonePairAddress(100, 101), vm.KycProposalRestrictZones); err != nil {
+		t.Fatalf("failed to propose after expiry: %v", err)
+	}
+	if ids := statedb.GetKycProviderProposolIds(); len(ids) != 1 {
+		t.Errorf("expired proposals not cleaned up: %v", ids)
+	}
+}
+
+// Tests that before the proposal queue fork only a single provider proposal is
+// open at a time and votes ignore the proposal id, while the queue takes over
+// from the fork block on.
+func TestKycProposalQueueFork(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		p1, p2, p3, p4 = common.HexToAddress("0x0101"), common.HexToAddress("0x0102"), common.HexToAddress("0x0103"), common.HexToAddress("0x0104")
+		c1, c2         = common.HexToAddress("0x0201"), common.HexToAddress("0x0202")
+		config         = &params.ChainConfig{ChainId: big.NewInt(1), KycProposalQueueBlock: big.NewInt(10)}
+	)
+	for _, provider := range []common.Address{p1, p2, p3, p4} {
+		statedb.AddKycProvider(provider)
+	}
+	call := func(number int64, origin common.Address, input []byte) ([]byte, error) {
+		ret, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: config, State: statedb, Origin: origin, BlockNumber: big.NewInt(number), Time: big.NewInt(1000000), GasLimit: 1000000})
+		return ret, err
+	}
+	propose := func(subject common.Address) []byte {
+		ptb := make([]byte, 8)
+		binary.BigEndian.PutUint64(ptb, vm.KycProposalAddProvider)
+		return kycInput(vm.KycMethodProviderVoteProposal, subject.Bytes(), ptb)
+	}
+	vote := func(id uint64) []byte {
+		idb := make([]byte, 8)
+		binary.BigEndian.PutUint64(idb, id)
+		return kycInput(vm.KycMethodVote, []byte{0, 0}, idb)
+	}
+	// Before the fork a second proposal waits for the first one to be decided
+	if _, err := call(5, p1, propose(c1)); err != nil {
+		t.Fatalf("failed to propose provider: %v", err)
+	}
+	if _, err := call(5, p2, propose(c2)); err != vm.ErrKycProposalPending {
+		t.Fatalf("second proposal error mismatch: have %v, want %v", err, vm.ErrKycProposalPending)
+	}
+	if head, tail := statedb.GetKycProviderProposolRange(); head != 0 || tail != 1 {
+		t.Fatalf("proposal range mismatch: have %d-%d, want 0-1", head, tail)
+	}
+	for _, voter := range []common.Address{p2, p3} {
+		if _, err := call(5, voter, vote(7)); err != nil {
+			t.Fatalf("failed to vote: %v", err)
+		}
+	}
+	if !statedb.KycProviderExists(c1) {
+		t.Fatalf("single proposal not passed")
+	}
+	if ids := statedb.GetKycProviderProposolIds(); len(ids) != 0 {
+		t.Fatalf("decided proposal left pending: %v", ids)
+	}
+	// From the fork on proposals are queued
+	if _, err := call(10, p1, propose(c2)); err != nil {
+		t.Fatalf("failed to propose provider: %v", err)
+	}
+	ret, err := call(10, p2, propose(common.HexToAddress("0x0203")))
+	if err != nil {
+		t.Fatalf("failed to queue second proposal: %v", err)
+	}
+	if id := new(big.Int).SetBytes(ret).Uint64(); id != 1 {
+		t.Fatalf("queued proposal id mismatch: have %d, want 1", id)
+	}
+	if ids := statedb.GetKycProviderProposolIds(); !reflect.DeepEqual(ids, []uint64{0, 1}) {
+		t.Fatalf("pending proposals mismatch: have %v, want [0 1]", ids)
+	}
+}
+
+// Tests that adding and removing single producer votes ends up with the same
+// producer weights as a full vote for the equivalent list, and that incremental
+// votes respect the vote cap and don't count a producer twice. Before the vote
+// change fork there are no incremental votes.
+func TestDposVoteIncremental(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	producers := make([]common.Address, vm.DposMaxVotes+1)
+	for i := range producers {
+		producers[i] = common.BigToAddress(big.NewInt(int64(0x0100 + i)))
+		statedb.RegisterProducer(&producers[i], "https://producer.example")
+	}
+	voter := common.HexToAddress("0x0201")
+	statedb.SetVoterStaking(&voter, new(big.Int).Mul(big.NewInt(100), big.NewInt(params.WON)))
+
+	vote := func(producers ...common.Address) []byte {
+		var args []byte
+		for _, producer := range producers {
+			args = append(args, producer.Bytes()...)
+		}
+		return kycInput(vm.DposMethodProdsVote, args)
+	}
+	chainConfig := &params.ChainConfig{ChainId: big.NewInt(1), DposVoteChangeBlock: big.NewInt(1)}
+	number := big.NewInt(1)
+	call := func(statedb *state.StateDB, time int64, input []byte) error {
+		_, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: chainConfig, State: statedb, Origin: voter, BlockNumber: number, Time: big.NewInt(time), GasLimit: 1000000})
+		return err
+	}
+	// Vote for a few producers, then amend the votes after the vote weight grew
+	then, now := int64(1534154327), int64(1534154327+60*86400)
+	if err := call(statedb, then, vote(producers[0], producers[1], producers[2])); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	incremental, full := statedb.Copy(), statedb.Copy()
+
+	number = big.NewInt(0)
+	for _, method := range []uint32{vm.DposMethodAddVote, vm.DposMethodRemoveVote} {
+		if err := call(statedb.Copy(), now, kycInput(method, producers[1].Bytes())); err != vm.ErrKycUnknownMethod {
+			t.Fatalf("pre-fork vote change error mismatch: have %v, want %v", err, vm.ErrKycUnknownMethod)
+		}
+	}
+	number = big.NewInt(1)
+
+	for i, input := range [][]byte{
+		kycInput(vm.DposMethodRemoveVote, producers[1].Bytes()),
+		kycInput(vm.DposMethodAddVote, producers[3].Bytes()),
+		kycInput(vm.DposMethodAddVote, producers[3].Bytes()),    // duplicate, ignored
+		kycInput(vm.DposMethodRemoveVote, producers[1].Bytes()), // missing, ignored
+	} {
+		if err := call(incremental, now, input); err != nil {
+			t.Fatalf("vote change %d failed: %v", i, err)
+		}
+	}
+	if err := call(full, now, vote(producers[0], producers[2], producers[3])); err != nil {
+		t.Fatalf("failed to revote: %v", err)
+	}
+	if have, want := incremental.GetVoterProducers(&voter), full.GetVoterProducers(&voter); !reflect.DeepEqual(have, want) {
+		t.Errorf("voted producers mismatch: have %x, want %x", have, want)
+	}
+	if have, want := incremental.GetDposVoterLastVoteWeight(&voter), full.GetDposVoterLastVoteWeight(&voter); have.Cmp(want) != 0 {
+		t.Errorf("vote weight mismatch: have %v, want %v", have, want)
+	}
+	for i := 0; i < 4; i++ {
+		have, want := incremental.GetProducerInfo(&producers[i]).TotalVotes, full.GetProducerInfo(&producers[i]).TotalVotes
+		if have.Cmp(want) != 0 {
+			t.Errorf("producer %d: votes mismatch: have %v, want %v", i, have, want)
+		}
+	}
+	// Votes for unknown producers and beyond the cap are rejected
+	if err := call(incremental, now, kycInput(vm.DposMethodAddVote, common.HexToAddress("0x0301").Bytes())); err != vm.ErrDposInvalidProducer {
+		t.Errorf("unknown producer error mismatch: have %v, want %v", err, vm.ErrDposInvalidProducer)
+	}
+	if err := call(incremental, now, kycInput(vm.DposMethodAddVote, producers[0].Bytes()[:10])); err != vm.ErrKycInvalidInput {
+		t.Errorf("truncated vote error mismatch: have %v, want %v", err, vm.ErrKycInvalidInput)
+	}
+	if err := call(incremental, now, vote(producers[:vm.DposMaxVotes]...)); err != nil {
+		t.Fatalf("failed to vote for the maximum of producers: %v", err)
+	}
+	if err := call(incremental, now, kycInput(vm.DposMethodAddVote, producers[vm.DposMaxVotes].Bytes())); err != vm.ErrDposTooManyVotes {
+		t.Errorf("vote cap error mismatch: have %v, want %v", err, vm.ErrDposTooManyVotes)
+	}
+	if votes := incremental.GetProducerInfo(&producers[vm.DposMaxVotes]).TotalVotes; votes.Sign() != 0 {
+		t.Errorf("producer beyond the cap gained votes: %v", votes)
+	}
+}
+
+// Tests that a full vote for more producers than allowed is rejected without
+// touching the previous vote or the weights of any producer, and that chains
+// may configure a lower limit, from the vote limit fork on.
+func TestDposVoteTooMany(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	producers := make([]common.Address, vm.DposMaxVotes+1)
+	for i := range producers {
+		producers[i] = common.BigToAddress(big.NewInt(int64(0x0100 + i)))
+		statedb.RegisterProducer(&producers[i], "https://producer.example")
+	}
+	voter := common.HexToAddress("0x0201")
+	statedb.SetVoterStaking(&voter, new(big.Int).Mul(big.NewInt(100), big.NewInt(params.WON)))
+
+	vote := func(config *params.ChainConfig, producers ...common.Address) error {
+		var args []byte
+		for _, producer := range producers {
+			args = append(args, producer.Bytes()...)
+		}
+		_, _, err := Call(vm.KycContractAddress, kycInput(vm.DposMethodProdsVote, args), &Config{ChainConfig: config, State: statedb, Origin: voter, Time: big.NewInt(1534154327), GasLimit: 10000000})
+		return err
+	}
+	limited := &params.ChainConfig{ChainId: big.NewInt(1), DposVoteLimitBlock: big.NewInt(0)}
+	if err := vote(limited, producers[0], producers[1]); err != nil {
+		t.Fatalf("failed to vote: %v", err)
+	}
+	votes := make([]*big.Int, len(producers))
+	for i := range producers {
+		votes[i] = statedb.GetProducerInfo(&producers[i]).TotalVotes
+	}
+	check := func(name string) {
+		if have, want := statedb.GetVoterProducers(&voter), producers[:2]; !reflect.DeepEqual(have, want) {
+			t.Errorf("%s: voted producers mismatch: have %x, want %x", name, have, want)
+		}
+		for i := range producers {
+			if have := statedb.GetProducerInfo(&producers[i]).TotalVotes; have.Cmp(votes[i]) != 0 {
+				t.Errorf("%s: producer %d: votes mismatch: have %v, want %v", name, i, have, votes[i])
+			}
+		}
+	}
+	if err := vote(limited, producers...); err != vm.ErrDposTooManyVotes {
+		t.Errorf("vote cap error mismatch: have %v, want %v", err, vm.ErrDposTooManyVotes)
+	}
+	check("default limit")
+
+	config := &params.ChainConfig{ChainId: big.NewInt(1), DposVoteLimitBlock: big.NewInt(0), Dpos: &params.DposConfig{MaxVotes: 2}}
+	if err := vote(config, producers[:3]...); err != vm.ErrDposTooManyVotes {
+		t.Errorf("configured cap error mismatch: have %v, want %v", err, vm.ErrDposTooManyVotes)
+	}
+	check("configured limit")
+
+	// Before the fork the oversized vote goes through, storing nothing
+	if err := vote(&params.ChainConfig{ChainId: big.NewInt(1)}, producers...); err != nil {
+		t.Errorf("pre-fork oversized vote failed: %v", err)
+	}
+	if have, want := statedb.GetVoterProducers(&voter), producers[:2]; !reflect.DeepEqual(have, want) {
+		t.Errorf("pre-fork voted producers mismatch: have %x, want %x", have, want)
+	}
+
+	if err := vote(config, producers[2], producers[3]); err != nil {
+		t.Errorf("failed to vote within the configured limit: %v", err)
+	}
+}
+
+// Tests that delegating votes to a proxy casts the weight of the delegators on
+// the producers of the proxy, and that the producer weights stay consistent with
+// the stakes as they change on either side of the delegations, as proxies change
+// their votes, and as delegations are moved, revoked or released.
+func TestDposProxyVoting(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	statedb.SetDposTotalActivatedStake(vm.DposActivatedStakeThreshold)
+
+	producers := make([]common.Address, 4)
+	for i := range producers {
+		producers[i] = common.BigToAddress(big.NewInt(int64(0x0100 + i)))
+		statedb.RegisterProducer(&producers[i], "https://producer.example")
+	}
+	voters := make([]common.Address, 4)
+	for i := range voters {
+		voters[i] = common.BigToAddress(big.NewInt(int64(0x0200 + i)))
+		statedb.SetVoterStaking(&voters[i], new(big.Int).Mul(big.NewInt(int64(100*(i+1))), big.NewInt(params.WON)))
+	}
+	proxy, other, alice, bob := voters[0], voters[1], voters[2], voters[3]
+
+	time := int64(1534154327)
+	chainConfig := &params.ChainConfig{ChainId: big.NewInt(1), DposVoteChangeBlock: big.NewInt(0), DposProxyBlock: big.NewInt(1)}
+	number := big.NewInt(1)
+	call := func(from common.Address, input []byte) error {
+		_, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: chainConfig, State: statedb, Origin: from, BlockNumber: number, Time: big.NewInt(time), GasLimit: 1000000})
+		return err
+	}
+	vote := func(producers ...common.Address) []byte {
+		var args []byte
+		for _, producer := range producers {
+			args = append(args, producer.Bytes()...)
+		}
+		return kycInput(vm.DposMethodProdsVote, args)
+	}
+	stake := func(method uint32, won int64) []byte {
+		return kycInput(method, common.BigToHash(new(big.Int).Mul(big.NewInt(won), big.NewInt(params.WON))).Bytes())
+	}
+	// check recomputes the producer weights and the proxy weights from the votes
+	// and delegations of every voter, and compares them with the tracked ones
+	check := func(step string) {
+		votes := make(map[common.Address]*big.Int)
+		delegated := make(map[common.Address]*big.Int)
+		for _, voter := range voters {
+			weight := statedb.GetDposVoterLastVoteWeight(&voter)
+			caster := voter
+			if proxy := statedb.GetVoterProxy(&voter); proxy != (common.Address{}) {
+				if pbs := statedb.GetVoterProducers(&voter); len(pbs) != 0 {
+					t.Errorf("%s: delegator %x votes for producers: %x", step, voter, pbs)
+				}
+				if delegated[proxy] == nil {
+					delegated[proxy] = new(big.Int)
+				}
+				delegated[proxy].Add(delegated[proxy], weight)
+				caster = proxy
+			}
+			for _, pb := range statedb.GetVoterProducers(&caster) {
+				if votes[pb] == nil {
+					votes[pb] = new(big.Int)
+				}
+				votes[pb].Add(votes[pb], weight)
+			}
+		}
+		for i, pb := range producers {
+			want := votes[pb]
+			if want == nil {
+				want = new(big.Int)
+			}
+			if have := statedb.GetProducerInfo(&pb).TotalVotes; have.Cmp(want) != 0 {
+				t.Errorf("%s: producer %d: votes mismatch: have %v, want %v", step, i, have, want)
+			}
+		}
+		for i, voter := range voters {
+			want := delegated[voter]
+			if want == nil {
+				want = new(big.Int)
+			}
+			if have := statedb.GetDposProxyWeight(&voter); have.Cmp(want) != 0 {
+				t.Errorf("%s: voter %d: delegated weight mismatch: have %v, want %v", step, i, have, want)
+			}
+		}
+	}
+	steps := []struct {
+		step  string
+		from  common.Address
+		input []byte
+		err   error
+	}{
+		{"proxy registration", proxy, kycInput(vm.DposMethodRegProxy), nil},
+		{"other proxy registration", other, kycInput(vm.DposMethodRegProxy, []byte{1}), nil},
+		{"proxy vote", proxy, vote(producers[0], producers[1]), nil},
+		{"other proxy vote", other, vote(producers[2]), nil},
+		{"self vote before delegating", alice, vote(producers[3]), nil},
+		{"delegation", alice, kycInput(vm.DposMethodSetProxy, proxy.Bytes()), nil},
+		{"second delegation", bob, kycInput(vm.DposMethodSetProxy, proxy.Bytes()), nil},
+		{"delegation to a non proxy", bob, kycInput(vm.DposMethodSetProxy, producers[0].Bytes()), vm.ErrDposNotProxy},
+		{"delegation by a proxy", other, kycInput(vm.DposMethodSetProxy, proxy.Bytes()), vm.ErrDposProxyChain},
+		{"proxy registration by a delegator", alice, kycInput(vm.DposMethodRegProxy), vm.ErrDposProxyChain},
+		{"delegator stake decrease", alice, stake(vm.DposMethodSubStake, 50), nil},
+		{"proxy stake decrease", proxy, stake(vm.DposMethodSubStake, 30), nil},
+		{"proxy vote change", proxy, vote(producers[1], producers[2]), nil},
+		{"proxy vote addition", proxy, kycInput(vm.DposMethodAddVote, producers[3].Bytes()), nil},
+		{"proxy vote removal", proxy, kycInput(vm.DposMethodRemoveVote, producers[1].Bytes()), nil},
+		{"delegator stake increase", bob, stake(vm.DposMethodAddStake, 0), vm.ErrDposInvalidStake},
+		{"delegator stake restore", alice, stake(vm.DposMethodAddStake, 50), nil},
+		{"proxy stake restore", proxy, stake(vm.DposMethodAddStake, 30), nil},
+		{"redelegation", alice, kycInput(vm.DposMethodSetProxy, other.Bytes()), nil},
+		{"self vote of a delegator", bob, vote(producers[0]), nil},
+		{"delegation again", bob, kycInput(vm.DposMethodSetProxy, proxy.Bytes()), nil},
+		{"revocation", bob, kycInput(vm.DposMethodSetProxy), nil},
+		{"single vote of a delegator", alice, kycInput(vm.DposMethodAddVote, producers[1].Bytes()), nil},
+		{"delegation after a single vote", alice, kycInput(vm.DposMethodSetProxy, other.Bytes()), nil},
+		{"delegation before unregistering", bob, kycInput(vm.DposMethodSetProxy, proxy.Bytes()), nil},
+		{"proxy unregistration", proxy, kycInput(vm.DposMethodRegProxy, []byte{0}), nil},
+		{"other proxy unregistration", other, kycInput(vm.DposMethodRegProxy, []byte{0}), nil},
+	}
+	// Before the fork there are no proxies
+	number = big.NewInt(0)
+	for _, input := range [][]byte{kycInput(vm.DposMethodRegProxy), kycInput(vm.DposMethodSetProxy, proxy.Bytes())} {
+		if err := call(proxy, input); err != vm.ErrKycUnknownMethod {
+			t.Fatalf("pre-fork proxy error mismatch: have %v, want %v", err, vm.ErrKycUnknownMethod)
+		}
+	}
+	if statedb.IsDposProxy(&proxy) {
+		t.Fatalf("proxy registered before the fork")
+	}
+	number = big.NewInt(1)
+
+	for _, step := range steps {
+		// Let the vote weights grow between the steps
+		time += 7 * 86400
+		if err := call(step.from, step.input); err != step.err {
+			t.Fatalf("%s: error mismatch: have %v, want %v", step.step, err, step.err)
+		}
+		check(step.step)
+	}
+	// Every delegation got released along with the proxies
+	for i, voter := range voters {
+		if proxy := statedb.GetVoterProxy(&voter); proxy != (common.Address{}) {
+			t.Errorf("voter %d: delegation not released: %x", i, proxy)
+		}
+		if statedb.IsDposProxy(&voter) {
+			t.Errorf("voter %d: proxy not unregistered", i)
+		}
+	}
+	if delegators := statedb.GetDposProxyDelegators(&proxy); len(delegators) != 0 {
+		t.Errorf("delegators left after unregistering: %x", delegators)
+	}
+}
+
+// Tests that producers may declare their location from the location fork on,
+// and that accounts other than producers and unknown locations are rejected.
+func TestDposSetLocation(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	producer, voter := common.HexToAddress("0x0101"), common.HexToAddress("0x0201")
+	statedb.RegisterProducer(&producer, "https://producer.example")
+
+	chainConfig := &params.ChainConfig{ChainId: big.NewInt(1), DposLocationBlock: big.NewInt(1)}
+	call := func(from common.Address, number int64, loc uint16) error {
+		input := make([]byte, 2)
+		binary.BigEndian.PutUint16(input, loc)
+		_, _, err := Call(vm.KycContractAddress, kycInput(vm.DposMethodSetLocation, input), &Config{ChainConfig: chainConfig, State: statedb, Origin: from, BlockNumber: big.NewInt(number), GasLimit: 100000})
+		return err
+	}
+	if err := call(producer, 0, 156); err != vm.ErrKycUnknownMethod {
+		t.Fatalf("pre-fork location error mismatch: have %v, want %v", err, vm.ErrKycUnknownMethod)
+	}
+	if loc := statedb.GetProducerInfo(&producer).Location; loc != 0 {
+		t.Fatalf("location set before the fork: %d", loc)
+	}
+	if err := call(producer, 1, 156); err != nil {
+		t.Fatalf("failed to set location: %v", err)
+	}
+	if loc := statedb.GetProducerInfo(&producer).Location; loc != 156 {
+		t.Errorf("location mismatch: have %d, want 156", loc)
+	}
+	if err := call(voter, 1, 156); err != vm.ErrDposInvalidProducer {
+		t.Errorf("non producer error mismatch: have %v, want %v", err, vm.ErrDposInvalidProducer)
+	}
+	if err := call(producer, 1, uint16(common.MaxProducerLocation)+1); err != vm.ErrKycInvalidInput {
+		t.Errorf("unknown location error mismatch: have %v, want %v", err, vm.ErrKycInvalidInput)
+	}
+}
+
+// Tests that a configured minimum self-stake keeps understaked accounts from
+// registering as producers, deactivates producers decreasing their stake below
+// it, and lets them register again once topped up.
+func TestDposMinProducerStake(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	statedb.SetDposTotalActivatedStake(vm.DposActivatedStakeThreshold)
+
+	won := func(n int64) *big.Int { return new(big.Int).Mul(big.NewInt(n), big.NewInt(params.WON)) }
+	minimum := won(1000)
+	chainConfig := &params.ChainConfig{ChainId: big.NewInt(1), Dpos: &params.DposConfig{MinProducerStake: minimum}}
+
+	producer := common.HexToAddress("0x0101")
+	call := func(config *params.ChainConfig, input []byte) error {
+		_, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: config, State: statedb, Origin: producer, Time: big.NewInt(1534154327), GasLimit: 1000000})
+		return err
+	}
+	register := kycInput(vm.DposMethodRegProds, []byte("https://producer.example"))
+	stake := func(method uint32, value *big.Int) []byte {
+		return kycInput(method, common.BigToHash(value).Bytes())
+	}
+	active := func() bool {
+		info := statedb.GetProducerInfo(&producer)
+		return info != nil && info.IsActive
+	}
+	// Without enough self-stake the registration is rejected, unless unconfigured
+	statedb.SetVoterStaking(&producer, won(999))
+	if err := call(chainConfig, register); err != vm.ErrDposProducerStake {
+		t.Fatalf("understaked registration error mismatch: have %v, want %v", err, vm.ErrDposProducerStake)
+	}
+	if info := statedb.GetProducerInfo(&producer); info != nil {
+		t.Fatalf("understaked producer registered: %v", info)
+	}
+	if err := call(&params.ChainConfig{ChainId: big.NewInt(1), Dpos: &params.DposConfig{}}, register); err != nil || !active() {
+		t.Fatalf("registration without minimum failed: %v", err)
+	}
+	statedb.UpdateProducerActive(&producer, false)
+
+	// Meeting the minimum reactivates the producer
+	statedb.SetVoterStaking(&producer, minimum)
+	if err := call(chainConfig, register); err != nil {
+		t.Fatalf("failed to register: %v", err)
+	}
+	if !active() {
+		t.Fatalf("producer not active after registering")
+	}
+	// Decreasing the stake while staying above the minimum keeps it active
+	statedb.SetVoterStaking(&producer, won(1500))
+	if err := call(chainConfig, stake(vm.DposMethodSubStake, won(500))); err != nil {
+		t.Fatalf("failed to decrease stake: %v", err)
+	}
+	if !active() {
+		t.Fatalf("producer at the minimum deactivated")
+	}
+	// Falling below it deactivates the producer, unless unconfigured
+	if err := call(nil, stake(vm.DposMethodSubStake, won(1))); err != nil {
+		t.Fatalf("failed to decrease stake: %v", err)
+	}
+	if !active() {
+		t.Fatalf("producer deactivated without a minimum")
+	}
+	statedb.SetDposTopProducerElectedDone(common.Big1)
+	if err := call(chainConfig, stake(vm.DposMethodSubStake, won(1))); err != nil {
+		t.Fatalf("failed to decrease stake: %v", err)
+	}
+	if active() {
+		t.Fatalf("understaked producer still active")
+	}
+	if statedb.GetDposTopProducerElectedDone().Sign() != 0 {
+		t.Errorf("deactivation didn't trigger a new election")
+	}
+	// Topping up alone doesn't reactivate, registering again does
+	if err := call(chainConfig, stake(vm.DposMethodAddStake, won(2))); err != nil {
+		t.Fatalf("failed to top up the stake: %v", err)
+	}
+	if active() {
+		t.Fatalf("producer reactivated without registering")
+	}
+	if err := call(chainConfig, register); err != nil {
+		t.Fatalf("failed to register again: %v", err)
+	}
+	if !active() {
+		t.Fatalf("producer not reactivated after topping up")
+	}
+}
+
+// Tests that registering a producer takes the configured registration fee from
+// its balance, escrowing it until the producer deregisters or burning it, and
+// that registrations the balance can't cover are rejected.
+func TestDposRegistrationFee(t *testing.T) {
+	fee := new(big.Int).Mul(big.NewInt(10), big.NewInt(params.WON))
+	register := kycInput(vm.DposMethodRegProds, []byte("https://producer.example"))
+	unregister := kycInput(vm.DposMethodRmvProds)
+
+	for _, burn := range []bool{false, true} {
+		db, _ := wondb.NewMemDatabase()
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+		statedb.CreateAccount(vm.KycContractAddress)
+
+		chainConfig := &params.ChainConfig{ChainId: big.NewInt(1), Dpos: &params.DposConfig{RegistrationFee: fee, BurnRegistrationFee: burn}}
+		call := func(from common.Address, input []byte) error {
+			_, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: chainConfig, State: statedb, Origin: from, Time: big.NewInt(1000), GasLimit: 100000})
+			return err
+		}
+		poor, producer := common.HexToAddress("0x0101"), common.HexToAddress("0x0102")
+		statedb.AddBalance(poor, new(big.Int).Sub(fee, common.Big1))
+		statedb.AddBalance(producer, new(big.Int).Mul(fee, common.Big2))
+
+		// The fee has to be covered by the balance of the producer
+		if err := call(poor, register); err != vm.ErrDposProducerFee {
+			t.Fatalf("burn %v: insufficient fee error mismatch: have %v, want %v", burn, err, vm.ErrDposProducerFee)
+		}
+		if info := statedb.GetProducerInfo(&poor); info != nil {
+			t.Fatalf("burn %v: producer registered without paying the fee", burn)
+		}
+		// Registering takes the fee once, updating the registration doesn't
+		for i := 0; i < 2; i++ {
+			if err := call(producer, register); err != nil {
+				t.Fatalf("burn %v: registration %d failed: %v", burn, i, err)
+			}
+		}
+		if balance := statedb.GetBalance(producer); balance.Cmp(fee) != 0 {
+			t.Errorf("burn %v: balance mismatch after registering: have %v, want %v", burn, balance, fee)
+		}
+		escrow := fee
+		if burn {
+			escrow = new(big.Int)
+		}
+		if have := statedb.GetProducerRegistrationFee(&producer); have.Cmp(escrow) != 0 {
+			t.Errorf("burn %v: escrowed fee mismatch: have %v, want %v", burn, have, escrow)
+		}
+		if have := statedb.GetBalance(vm.KycContractAddress); have.Cmp(escrow) != 0 {
+			t.Errorf("burn %v: contract balance mismatch: have %v, want %v", burn, have, escrow)
+		}
+		// Deregistering refunds the escrowed fee, burned fees are gone
+		if err := call(producer, unregister); err != nil {
+			t.Fatalf("burn %v: failed to deregister: %v", burn, err)
+		}
+		if info := statedb.GetProducerInfo(&producer); info == nil || info.IsActive {
+			t.Fatalf("burn %v: producer still active after deregistering", burn)
+		}
+		refunded := new(big.Int).Add(fee, escrow)
+		if balance := statedb.GetBalance(producer); balance.Cmp(refunded) != 0 {
+			t.Errorf("burn %v: balance mismatch after deregistering: have %v, want %v", burn, balance, refunded)
+		}
+		if have := statedb.GetProducerRegistrationFee(&producer); have.Sign() != 0 {
+			t.Errorf("burn %v: escrowed fee left after deregistering: %v", burn, have)
+		}
+		if have := statedb.GetBalance(vm.KycContractAddress); have.Sign() != 0 {
+			t.Errorf("burn %v: contract balance left after deregistering: %v", burn, have)
+		}
+	}
+}
+
+// Tests that producers can hand the sealing of their blocks over to a signing key
+// of their own, rotate it and take it back, but never share it with another
+// producer nor hand it to one, including the key replaced in an earlier epoch.
+func TestDposSigningKey(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	producer, other, stranger := common.HexToAddress("0x0101"), common.HexToAddress("0x0102"), common.HexToAddress("0x0103")
+	first, second, third := common.HexToAddress("0x0201"), common.HexToAddress("0x0202"), common.HexToAddress("0x0203")
+	for _, pb := range []common.Address{producer, other} {
+		pb := pb
+		statedb.RegisterProducer(&pb, "https://producer.example")
+	}
+	chainConfig := &params.ChainConfig{ChainId: big.NewInt(1), DposSigningKeyBlock: big.NewInt(0), Dpos: &params.DposConfig{Epoch: 100}}
+	call := func(from common.Address, input []byte, number uint64) error {
+		_, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: chainConfig, State: statedb, Origin: from, BlockNumber: new(big.Int).SetUint64(number), Time: big.NewInt(1000), GasLimit: 100000})
+		return err
+	}
+	// Before the fork producers seal with their own key only
+	legacy := &params.ChainConfig{ChainId: big.NewInt(1), Dpos: chainConfig.Dpos}
+	if _, _, err := Call(vm.KycContractAddress, kycInput(vm.DposMethodSetSigningKey, first.Bytes()), &Config{ChainConfig: legacy, State: statedb, Origin: producer, Time: big.NewInt(1000), GasLimit: 100000}); err != vm.ErrKycUnknownMethod {
+		t.Fatalf("pre-fork signing key error mismatch: have %v, want %v", err, vm.ErrKycUnknownMethod)
+	}
+	steps := []struct {
+		step  string
+		from  common.Address
+		input []byte
+		err   error
+		key   common.Address // Signing key of producer after the step
+	}{
+		{"non-producer key", stranger, kycInput(vm.DposMethodSetSigningKey, first.Bytes()), vm.ErrDposInvalidProducer, common.Address{}},
+		{"key", producer, kycInput(vm.DposMethodSetSigningKey, first.Bytes()), nil, first},
+		{"same key again", producer, kycInput(vm.DposMethodSetSigningKey, first.Bytes()), nil, first},
+		{"key of another producer", other, kycInput(vm.DposMethodSetSigningKey, first.Bytes()), vm.ErrDposSigningKeyTaken, first},
+		{"producer as key", other, kycInput(vm.DposMethodSetSigningKey, producer.Bytes()), vm.ErrDposSigningKeyTaken, first},
+		{"key registering as producer", first, kycInput(vm.DposMethodRegProds, []byte("https://producer.example")), vm.ErrDposSigningKeyTaken, first},
+		{"truncated key", producer, kycInput(vm.DposMethodSetSigningKey, second.Bytes()[:10]), vm.ErrKycInvalidInput, first},
+		{"rotation", producer, kycInput(vm.DposMethodSetSigningKey, second.Bytes()), nil, second},
+		{"released key", other, kycInput(vm.DposMethodSetSigningKey, first.Bytes()), nil, second},
+		{"own key", producer, kycInput(vm.DposMethodSetSigningKey, producer.Bytes()), nil, common.Address{}},
+		{"rotation again", producer, kycInput(vm.DposMethodSetSigningKey, second.Bytes()), nil, second},
+		{"revocation", producer, kycInput(vm.DposMethodSetSigningKey), nil, common.Address{}},
+	}
+	for _, step := range steps {
+		if err := call(step.from, step.input, 0); err != step.err {
+			t.Fatalf("%s: error mismatch: have %v, want %v", step.step, err, step.err)
+		}
+		if key := statedb.GetProducerSigningKey(&producer); key != step.key {
+			t.Fatalf("%s: signing key mismatch: have %x, want %x", step.step, key, step.key)
+		}
+		if step.key != (common.Address{}) {
+			if owner := statedb.GetSigningKeyProducer(step.key); owner != producer {
+				t.Fatalf("%s: signing key owner mismatch: have %x, want %x", step.step, owner, producer)
+			}
+		}
+	}
+	// The keys given up are free again, the ones in use are not
+	if owner := statedb.GetSigningKeyProducer(second); owner != (common.Address{}) {
+		t.Errorf("revoked signing key still owned by %x", owner)
+	}
+	if owner := statedb.GetSigningKeyProducer(first); owner != other {
+		t.Errorf("signing key owner mismatch: have %x, want %x", owner, other)
+	}
+	// Rotating in a later epoch keeps the replaced key reserved until the next one
+	rotations := []struct {
+		step   string
+		from   common.Address
+		key    common.Address
+		number uint64
+		err    error
+	}{
+		{"key in later epoch", producer, second, 100, nil},
+		{"rotation in later epoch", producer, third, 200, nil},
+		{"previous key of another producer", other, second, 250, vm.ErrDposSigningKeyTaken},
+		{"own key in later epoch", producer, producer, 300, nil},
+		{"released previous key", other, second, 300, nil},
+	}
+	for _, step := range rotations {
+		if err := call(step.from, kycInput(vm.DposMethodSetSigningKey, step.key.Bytes()), step.number); err != step.err {
+			t.Fatalf("%s: error mismatch: have %v, want %v", step.step, err, step.err)
+		}
+	}
+	for key, owner := range map[common.Address]common.Address{first: other, second: other, third: producer} {
+		if have := statedb.GetSigningKeyProducer(key); have != owner {
+			t.Errorf("signing key %x owner mismatch: have %x, want %x", key, have, owner)
+		}
+	}
+	if previous := statedb.GetProducerPrevSigningKey(&producer); previous != third {
+		t.Errorf("previous signing key mismatch: have %x, want %x", previous, third)
+	}
+}
+
+// Tests that matured refunds of the voters that opted in are paid out in the
+// order requested, at most the configured number of queue entries per block,
+// and that a refund is paid out once, whether claimed or paid out first.
+func TestDposAutoRefund(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	statedb.SetDposTotalActivatedStake(vm.DposActivatedStakeThreshold)
+
+	chainConfig := &params.ChainConfig{ChainId: big.NewInt(1), DposStakeLogBlock: big.NewInt(0), DposAutoRefundBlock: big.NewInt(0), Dpos: &params.DposConfig{AutoRefundsPerBlock: 2}}
+	call := func(from common.Address, time uint64, input []byte) error {
+		_, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: chainConfig, State: statedb, Origin: from, Time: new(big.Int).SetUint64(time), GasLimit: 1000000})
+		return err
+	}
+	stake := func(method uint32, value int64) []byte {
+		return kycInput(method, common.BigToHash(big.NewInt(value)).Bytes())
+	}
+	payouts := 0
+	payout := func(time uint64) []common.Address {
+		payouts++
+		statedb.Prepare(common.BigToHash(big.NewInt(int64(payouts))), common.Hash{}, 0)
+		vm.DposPayoutRefunds(statedb, chainConfig, &types.Header{Number: big.NewInt(1), Time: new(big.Int).SetUint64(time)})
+
+		var paid []common.Address
+		for _, log := range statedb.GetLogs(common.BigToHash(big.NewInt(int64(payouts)))) {
+			if log.Topics[0] != vm.DposStakeRefundedTopic || new(big.Int).SetBytes(log.Data).Int64() != 100 {
+				t.Fatalf("payout %d: invalid log: %v", payouts, log)
+			}
+			paid = append(paid, common.BytesToAddress(log.Topics[1].Bytes()))
+		}
+		return paid
+	}
+	// Before the fork nobody may opt in
+	if _, _, err := Call(vm.KycContractAddress, kycInput(vm.DposMethodSetAutoRefund), &Config{State: statedb.Copy(), Origin: common.HexToAddress("0x0a"), GasLimit: 1000000}); err != vm.ErrKycUnknownMethod {
+		t.Fatalf("pre-fork opt in error mismatch: have %v, want %v", err, vm.ErrKycUnknownMethod)
+	}
+	// Stake for every voter, all but d opting in, and request the refunds
+	a, b, c, d, e := common.HexToAddress("0x0a"), common.HexToAddress("0x0b"), common.HexToAddress("0x0c"), common.HexToAddress("0x0d"), common.HexToAddress("0x0e")
+	for i, voter := range []common.Address{a, b, c, d, e} {
+		statedb.AddBalance(voter, big.NewInt(200))
+		if err := call(voter, 1000, stake(vm.DposMethodAddStake, 200)); err != nil {
+			t.Fatalf("voter %x: failed to stake: %v", voter, err)
+		}
+		if voter != d {
+			if err := call(voter, 1000, kycInput(vm.DposMethodSetAutoRefund)); err != nil {
+				t.Fatalf("voter %x: failed to opt in: %v", voter, err)
+			}
+		}
+		if err := call(voter, 2000+uint64(i), stake(vm.DposMethodSubStake, 100)); err != nil {
+			t.Fatalf("voter %x: failed to request refund: %v", voter, err)
+		}
+	}
+	if queue := statedb.GetDposRefundQueue(); !reflect.DeepEqual(queue, []common.Address{a, b, c, e}) {
+		t.Fatalf("refund queue mismatch: have %x", queue)
+	}
+	// Restaking the refund withdraws it from the queue, requesting it again
+	// restarts the lock, moving the voter to the end
+	statedb.AddBalance(a, big.NewInt(100))
+	if err := call(a, 2010, stake(vm.DposMethodAddStake, 200)); err != nil {
+		t.Fatalf("failed to restake: %v", err)
+	}
+	if queue := statedb.GetDposRefundQueue(); !reflect.DeepEqual(queue, []common.Address{b, c, e}) {
+		t.Fatalf("refund queue mismatch after cancelling refund: have %x", queue)
+	}
+	if err := call(a, 2010, stake(vm.DposMethodSubStake, 100)); err != nil {
+		t.Fatalf("failed to request refund again: %v", err)
+	}
+	if queue := statedb.GetDposRefundQueue(); !reflect.DeepEqual(queue, []common.Address{b, c, e, a}) {
+		t.Fatalf("refund queue mismatch after requesting again: have %x", queue)
+	}
+	// Nothing is paid out before the head of the queue matured
+	if paid := payout(2001 + vm.DposRefundDelay); len(paid) != 0 {
+		t.Fatalf("immature refunds paid out: %x", paid)
+	}
+	// A refund claimed first leaves a stale entry counting against the cap
+	if err := call(b, 2002+vm.DposRefundDelay, kycInput(vm.DposMethodRefund)); err != nil {
+		t.Fatalf("failed to claim refund: %v", err)
+	}
+	if paid := payout(2004 + vm.DposRefundDelay + 1); !reflect.DeepEqual(paid, []common.Address{c}) {
+		t.Fatalf("first payout mismatch: have %x", paid)
+	}
+	// The cap isn't reached, but a is the first not matured
+	if paid := payout(2004 + vm.DposRefundDelay + 1); !reflect.DeepEqual(paid, []common.Address{e}) {
+		t.Fatalf("second payout mismatch: have %x", paid)
+	}
+	if paid := payout(2010 + vm.DposRefundDelay + 1); !reflect.DeepEqual(paid, []common.Address{a}) {
+		t.Fatalf("third payout mismatch: have %x", paid)
+	}
+	if queue := statedb.GetDposRefundQueue(); len(queue) != 0 {
+		t.Fatalf("refund queue not drained: %x", queue)
+	}
+	// A claim after the payout finds nothing left, d has to claim itself
+	if err := call(c, 2010+vm.DposRefundDelay+1, kycInput(vm.DposMethodRefund)); err != nil {
+		t.Fatalf("failed to claim paid out refund: %v", err)
+	}
+	for voter, want := range map[common.Address]int64{a: 100, b: 100, c: 100, d: 0, e: 100} {
+		if balance := statedb.GetBalance(voter); balance.Int64() != want {
+			t.Errorf("voter %x: balance mismatch: have %v, want %v", voter, balance, want)
+		}
+	}
+	if refund, _ := statedb.GetRefundRequestInfo(&d); refund.Int64() != 100 {
+		t.Errorf("refund of opted out voter mismatch: have %v, want 100", refund)
+	}
+}
+
+// Tests that the slots of the KYC contract touched by two staking transactions
+// of different voters only conflict on the global staking counters.
+func TestDposStakeTouchedKycSlots(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	statedb.CreateAccount(vm.KycContractAddress)
+
+	voters := []common.Address{common.HexToAddress("0x0a"), common.HexToAddress("0x0b")}
+	for i, voter := range voters {
+		statedb.AddBalance(voter, big.NewInt(100))
+		statedb.Prepare(common.BigToHash(big.NewInt(int64(i+1))), common.Hash{}, i)
+
+		input := kycInput(vm.DposMethodAddStake, common.BigToHash(big.NewInt(100)).Bytes())
+		if _, _, err := Call(vm.KycContractAddress, input, &Config{State: statedb, Origin: voter, GasLimit: 1000000}); err != nil {
+			t.Fatalf("voter %d: failed to stake: %v", i, err)
+		}
+	}
+	touched := func(txIndex int) (map[common.Hash]bool, map[common.Hash]bool) {
+		reads, writes := statedb.TouchedKycSlots(txIndex)
+		r, w := make(map[common.Hash]bool), make(map[common.Hash]bool)
+		for _, key := range reads {
+			r[key] = true
+		}
+		for _, key := range writes {
+			r[key], w[key] = true, true
+		}
+		return r, w
+	}
+	touched0, written0 := touched(0)
+	touched1, written1 := touched(1)
+
+	// Every record of a voter is only touched by its own transaction
+	for i, voter := range voters {
+		staking := common.AddressToHashWithPrefix(&voter, 0x70)
+		if _, written := touched(i); !written[staking] {
+			t.Errorf("voter %d: staking slot not written", i)
+		}
+		if other, _ := touched(1 - i); other[staking] {
+			t.Errorf("voter %d: staking slot touched by the other voter", i)
+		}
+	}
+	conflicts := make(map[common.Hash]bool)
+	for key := range written0 {
+		if touched1[key] {
+			conflicts[key] = true
+		}
+	}
+	for key := range written1 {
+		if touched0[key] {
+			conflicts[key] = true
+		}
+	}
+	// The total activated stake and the election flag are bumped by both
+	want := map[common.Hash]bool{
+		common.BigToHash(big.NewInt(100)): true,
+		common.BigToHash(big.NewInt(105)): true,
+	}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("conflict set mismatch: have %v, want %v", conflicts, want)
+	}
+	// Transactions that never reached the contract touched nothing
+	if reads, writes := statedb.TouchedKycSlots(2); reads != nil || writes != nil {
+		t.Errorf("untouched transaction has slots: reads %x, writes %x", reads, writes)
+	}
+}
+
+// The metrics package enables itself by peeking at the command line, accept its
+// flag so that the metrics may be tested.
+var _ = flag.Bool(metrics.MetricsEnabledFlag, false, "Enable metrics collection")
+
+// Tests that executing the KYC contract and the DPoS elections are accounted
+// for in the metrics registry.
+func TestKycMetrics(t *testing.T) {
+	if !metrics.Enabled {
+		// Metrics can only be enabled on startup, rerun the test with them on
+		out, err := exec.Command(os.Args[0], "-test.run=^TestKycMetrics$", "--"+metrics.MetricsEnabledFlag).CombinedOutput()
+		if err != nil {
+			t.Fatalf("metrics enabled run failed: %v\n%s", err, out)
+		}
+		return
+	}
+	count := func(name string) int64 {
+		switch m := metrics.DefaultRegistry.Get(name).(type) {
+		case metrics.Meter:
+			return m.Count()
+		case metrics.Timer:
+			return m.Count()
+		}
+		t.Fatalf("metric %s not registered", name)
+		return 0
+	}
+	names := []string{"won/vm/kyc/exec_time", "won/vm/kyc/provider_scans", "won/vm/dpos/stake_ops", "won/vm/dpos/elections"}
+	before := make(map[string]int64)
+	for _, name := range names {
+		before[name] = count(name)
+	}
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		provider = common.HexToAddress("0x0101")
+		voter    = common.HexToAddress("0x0201")
+	)
+	statedb.AddKycProvider(provider)
+	statedb.AddBalance(voter, big.NewInt(100))
+
+	info := make([]byte, 8)
+	binary.BigEndian.PutUint32(info[0:4], 1)
+	if _, _, err := Call(vm.KycContractAddress, kycInput(vm.KycMethodSet, voter.Bytes(), info), &Config{State: statedb, Origin: provider, GasLimit: 100000}); err != nil {
+		t.Fatalf("failed to set kyc info: %v", err)
+	}
+	input := kycInput(vm.DposMethodAddStake, common.BigToHash(big.NewInt(100)).Bytes())
+	if _, _, err := Call(vm.KycContractAddress, input, &Config{State: statedb, Origin: voter, GasLimit: 1000000}); err != nil {
+		t.Fatalf("failed to stake: %v", err)
+	}
+	statedb.SetDposTotalActivatedStake(vm.DposActivatedStakeThreshold)
+	statedb.GetProducerTopList(nil, nil)
+
+	// Every account validated scans the providers, so only expect some scans
+	want := map[string]int64{
+		"won/vm/kyc/exec_time":  2,
+		"won/vm/dpos/stake_ops": 1,
+		"won/vm/dpos/elections": 1,
+	}
+	for _, name := range names {
+		have := count(name) - before[name]
+		if want, ok := want[name]; ok && have != want {
+			t.Errorf("metric %s: count mismatch: have %d, want %d", name, have, want)
+		}
+		if have == 0 {
+			t.Errorf("metric %s: not updated", name)
+		}
+	}
+}
+
+// Tests that value sent to the KYC precompile is only accepted along with the
+// staking methods, failing unknown methods, governance methods and bare
+// transfers without moving the value, once the call restriction fork is active.
+func TestKycValueTransfer(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		provider = common.HexToAddress("0x0101")
+		voter    = common.HexToAddress("0x0201")
+		value    = big.NewInt(1000)
+		config   = &params.ChainConfig{ChainId: big.NewInt(1), KycCallRestrictionBlock: big.NewInt(10), KycThresholdQueryBlock: big.NewInt(0)}
+	)
+	statedb.AddKycProvider(provider)
+	statedb.AddBalance(provider, big.NewInt(params.WON))
+	statedb.AddBalance(voter, big.NewInt(params.WON))
+
+	number := int64(10)
+	call := func(origin common.Address, value *big.Int, input []byte) error {
+		_, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: config, State: statedb, Origin: origin, Value: value, BlockNumber: big.NewInt(number), Time: big.NewInt(1534154327), GasLimit: 100000})
+		return err
+	}
+	setKyc := kycInput(vm.KycMethodSet, voter.Bytes(), []byte{0, 0, 0, 1}, []byte{0, 0, 0, 0})
+
+	tests := []struct {
+		origin common.Address
+		value  *big.Int
+		input  []byte
+		err    error
+	}{
+		// Governance methods only go through without value
+		{provider, value, setKyc, vm.ErrKycValueTransfer},
+		{provider, nil, setKyc, nil},
+		{voter, value, kycInput(vm.DposMethodRefund), vm.ErrKycValueTransfer},
+		// Unknown methods fail regardless of any value
+		{voter, value, kycInput(0xff), vm.ErrKycUnknownMethod},
+		{voter, nil, kycInput(0xff), vm.ErrKycUnknownMethod},
+		{voter, value, kycInput(vm.KycMethodGetLevelThresholds), vm.ErrKycValueTransfer},
+		// Bare transfers are rejected, empty calls are no-ops
+		{voter, value, nil, vm.ErrKycValueTransfer},
+		{voter, value, []byte{0}, vm.ErrKycValueTransfer},
+		{voter, nil, nil, nil},
+		// Staking methods accept value, failing on their own terms only
+		{voter, value, kycInput(vm.DposMethodSubStake, common.BigToHash(value).Bytes()), vm.ErrDposStakeInactive},
+	}
+	for i, tt := range tests {
+		balance := statedb.GetBalance(vm.KycContractAddress)
+		if err := call(tt.origin, tt.value, tt.input); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+		if have := statedb.GetBalance(vm.KycContractAddress); have.Cmp(balance) != 0 {
+			t.Errorf("test %d: precompile balance changed: have %v, want %v", i, have, balance)
+		}
+	}
+	if level := statedb.GetKycLevel(voter, 0); level != 1 {
+		t.Errorf("KYC level mismatch: have %d, want 1", level)
+	}
+	// Before the fork the value is accepted along with any known method
+	number = 9
+	for i, input := range [][]byte{nil, setKyc} {
+		balance := statedb.GetBalance(vm.KycContractAddress)
+		if err := call(provider, value, input); err != nil {
+			t.Errorf("pre-fork test %d: failed to send value: %v", i, err)
+		}
+		if have, want := statedb.GetBalance(vm.KycContractAddress), new(big.Int).Add(balance, value); have.Cmp(want) != 0 {
+			t.Errorf("pre-fork test %d: precompile balance mismatch: have %v, want %v", i, have, want)
+		}
+	}
+}
+
+// kycProxyCode returns the code of a contract calling the KYC precompile with
+// its own input through op, returning whether the call succeeded.
+func kycProxyCode(op vm.OpCode) []byte {
+	code := []byte{
+		byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.CALLDATACOPY),
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.CALLDATASIZE), byte(vm.PUSH1), 0,
+	}
+	if op == vm.CALL || op == vm.CALLCODE {
+		code = append(code, byte(vm.PUSH1), 0)
+	}
+	return append(code,
+		byte(vm.PUSH1), 9, byte(vm.PUSH2), 0xff, 0xff, byte(op),
+		byte(vm.PUSH1), 0, byte(vm.MSTORE), byte(vm.PUSH1), 32, byte(vm.PUSH1), 0, byte(vm.RETURN),
+	)
+}
+
+// Tests that governance methods of the KYC precompile only execute when called
+// directly by the sender of the transaction, not through any kind of call made
+// by a contract on its behalf, while the read methods stay open to contracts.
+// Before the call restriction fork only callers with code are refused.
+func TestKycContractCaller(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		provider = common.HexToAddress("0x0101")
+		subject  = common.HexToAddress("0x0201")
+		proxy    = common.HexToAddress("0x0301")
+	)
+	statedb.AddKycProvider(provider)
+
+	restricted := &params.ChainConfig{ChainId: big.NewInt(1), KycCallRestrictionBlock: big.NewInt(0), KycThresholdQueryBlock: big.NewInt(0)}
+	config := &Config{ChainConfig: restricted, State: statedb, Origin: provider, Time: big.NewInt(1534154327), GasLimit: 1000000}
+	setKyc := kycInput(vm.KycMethodSet, subject.Bytes(), []byte{0, 0, 0, 1}, []byte{0, 0, 0, 0})
+
+	for _, op := range []vm.OpCode{vm.CALL, vm.CALLCODE, vm.DELEGATECALL, vm.STATICCALL} {
+		statedb.SetCode(proxy, kycProxyCode(op))
+
+		ret, _, err := Call(proxy, setKyc, config)
+		if err != nil {
+			t.Fatalf("%v: failed to call proxy: %v", op, err)
+		}
+		if new(big.Int).SetBytes(ret).Sign() != 0 {
+			t.Errorf("%v: governance call through contract succeeded", op)
+		}
+		if level := statedb.GetKycLevel(subject, 0); level != 0 {
+			t.Errorf("%v: KYC level set through contract: have %d, want 0", op, level)
+		}
+		ret, _, err = Call(proxy, kycInput(vm.KycMethodGetLevelThresholds), config)
+		if err != nil || new(big.Int).SetBytes(ret).Sign() == 0 {
+			t.Errorf("%v: read call through contract failed: %v", op, err)
+		}
+	}
+	// Constructors have no code yet, but aren't the origin either
+	register := kycInput(vm.DposMethodRegProds, []byte("https://producer.example"))
+	init := []byte{
+		byte(vm.PUSH1), byte(len(register)), byte(vm.PUSH1), 25, byte(vm.PUSH1), 0, byte(vm.CODECOPY),
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), byte(len(register)), byte(vm.PUSH1), 0, byte(vm.PUSH1), 0,
+		byte(vm.PUSH1), 9, byte(vm.PUSH2), 0xff, 0xff, byte(vm.CALL), byte(vm.POP), byte(vm.STOP),
+	}
+	_, created, _, err := Create(append(init, register...), config)
+	if err != nil {
+		t.Fatalf("failed to run constructor: %v", err)
+	}
+	if info := statedb.GetProducerInfo(&created); info != nil {
+		t.Errorf("producer registered by constructor: %v", info)
+	}
+	// The provider itself still may
+	if _, _, err := Call(vm.KycContractAddress, setKyc, config); err != nil {
+		t.Fatalf("failed to set KYC directly: %v", err)
+	}
+	if level := statedb.GetKycLevel(subject, 0); level != 1 {
+		t.Errorf("KYC level mismatch: have %d, want 1", level)
+	}
+	// Before the fork contracts are told apart by their code only, which
+	// constructors don't have yet
+	config.ChainConfig = &params.ChainConfig{ChainId: big.NewInt(1)}
+	config.Origin = common.HexToAddress("0x0102")
+	if _, created, _, err = Create(append(init, register...), config); err != nil {
+		t.Fatalf("failed to run constructor: %v", err)
+	}
+	if info := statedb.GetProducerInfo(&created); info == nil {
+		t.Errorf("pre-fork constructor failed to register producer")
+	}
+}
+
+// Tests that the KYC precompile refuses to modify the state inside a static
+// call from the call restriction fork on, failing with a write protection
+// error, while its reads still work.
+func TestKycStaticCall(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		voter  = common.HexToAddress("0x0101")
+		proxy  = common.HexToAddress("0x0301")
+		logger = vm.NewStructLogger(nil)
+	)
+	statedb.SetCode(proxy, kycProxyCode(vm.STATICCALL))
+	statedb.AddBalance(voter, big.NewInt(params.WON))
+
+	restricted := &params.ChainConfig{ChainId: big.NewInt(1), KycCallRestrictionBlock: big.NewInt(0), KycThresholdQueryBlock: big.NewInt(0), KycProviderInfoBlock: big.NewInt(0)}
+	config := &Config{ChainConfig: restricted, State: statedb, Origin: voter, Time: big.NewInt(1534154327), GasLimit: 1000000, EVMConfig: vm.Config{PrecompileTracer: logger}}
+	tests := []struct {
+		input []byte
+		err   error
+	}{
+		{kycInput(vm.DposMethodAddStake, common.BigToHash(big.NewInt(1000)).Bytes()), vm.ErrWriteProtection},
+		{kycInput(vm.DposMethodRegProds, []byte("https://producer.example")), vm.ErrWriteProtection},
+		{kycInput(vm.KycMethodGetLevelThresholds), nil},
+		{kycInput(vm.KycMethodGetProviderInfo, voter.Bytes()), nil},
+	}
+	for i, tt := range tests {
+		ret, _, err := Call(proxy, tt.input, config)
+		if err != nil {
+			t.Fatalf("test %d: failed to call proxy: %v", i, err)
+		}
+		if success := new(big.Int).SetBytes(ret).Sign() != 0; success != (tt.err == nil) {
+			t.Errorf("test %d: static call success mismatch: have %v, want %v", i, success, tt.err == nil)
+		}
+		logs := logger.PrecompileLogs()
+		if have := logs[len(logs)-1].Err; have != tt.err {
+			t.Errorf("test %d: precompile error mismatch: have %v, want %v", i, have, tt.err)
+		}
+	}
+	if stake := statedb.GetVoterStaking(&voter); stake.Sign() != 0 {
+		t.Errorf("stake added in static call: %v", stake)
+	}
+	// Before the fork a constructor, lacking code, may change the state even
+	// in a static call
+	register := kycInput(vm.DposMethodRegProds, []byte("https://producer.example"))
+	init := []byte{
+		byte(vm.PUSH1), byte(len(register)), byte(vm.PUSH1), 23, byte(vm.PUSH1), 0, byte(vm.CODECOPY),
+		byte(vm.PUSH1), 0, byte(vm.PUSH1), 0, byte(vm.PUSH1), byte(len(register)), byte(vm.PUSH1), 0,
+		byte(vm.PUSH1), 9, byte(vm.PUSH2), 0xff, 0xff, byte(vm.STATICCALL), byte(vm.POP), byte(vm.STOP),
+	}
+	config.ChainConfig = &params.ChainConfig{ChainId: big.NewInt(1)}
+	_, created, _, err := Create(append(init, register...), config)
+	if err != nil {
+		t.Fatalf("failed to run constructor: %v", err)
+	}
+	if info := statedb.GetProducerInfo(&created); info == nil {
+		t.Errorf("pre-fork static call failed to register producer")
+	}
+}
+
+// Tests that calls of the KYC precompile bound to a chain are rejected before
+// the binding fork and when replayed on another chain, while unbound calls keep
+// working.
+func TestKycChainBinding(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		producer = common.HexToAddress("0x0101")
+		forked   = &params.ChainConfig{ChainId: big.NewInt(1), KycChainBindingBlock: big.NewInt(10)}
+	)
+	statedb.CreateAccount(vm.KycContractAddress)
+
+	call := func(number int64, input []byte) error {
+		_, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: forked, State: statedb, Origin: producer, BlockNumber: big.NewInt(number), Time: big.NewInt(1534154327), GasLimit: 1000000})
+		return err
+	}
+	register := kycInput(vm.DposMethodRegProds, []byte("https://producer.example"))
+	unregister := kycInput(vm.DposMethodRmvProds)
+
+	tests := []struct {
+		number int64
+		input  []byte
+		err    error
+	}{
+		// Bound calls are unknown before the fork
+		{9, vm.BindKycInput(register, big.NewInt(1)), vm.ErrKycUnknownMethod},
+		// Calls replayed from another chain are rejected
+		{10, vm.BindKycInput(register, big.NewInt(2)), vm.ErrKycChainMismatch},
+		{10, vm.BindKycInput(register, big.NewInt(1)), nil},
+		// Unbound calls keep working, truncated bound calls are unknown
+		{10, unregister, nil},
+		{10, vm.BindKycInput(unregister, big.NewInt(1))[:35], vm.ErrKycUnknownMethod},
+	}
+	for i, tt := range tests {
+		if err := call(tt.number, tt.input); err != tt.err {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.err)
+		}
+	}
+	if info := statedb.GetProducerInfo(&producer); info == nil || info.Url != "https://producer.example" || info.IsActive {
+		t.Errorf("producer info mismatch: have %+v", info)
+	}
+}
+
+// Tests that the blake2b compression precompile only exists from the Blake2F
+// fork on, calls before it hitting an empty account.
+func TestBlake2FFork(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	// Compress the single block of "abc", yielding its BLAKE2b-512 hash
+	input := make([]byte, 213)
+	binary.BigEndian.PutUint32(input, 12)
+	for i, word := range blake2b.IV {
+		if i == 0 {
+			word ^= 0x01010040
+		}
+		binary.LittleEndian.PutUint64(input[4+i*8:], word)
+	}
+	copy(input[68:], "abc")
+	input[196], input[212] = 3, 1
+
+	want := common.Hex2Bytes("ba80a53f981c4d0d6a2797b69f12f6e94c212f14685ac4b74b12bb6fdbffa2d1" +
+		"7d87c5392aab792dc252d5de4533cc9518d38aa8dbf1925ab92386edd4009923")
+	config := &params.ChainConfig{ChainId: big.NewInt(1), Blake2FBlock: big.NewInt(10)}
+
+	for _, number := range []int64{9, 10} {
+		ret, _, err := Call(vm.Blake2FContractAddress, input, &Config{ChainConfig: config, State: statedb, BlockNumber: big.NewInt(number), GasLimit: 100000})
+		if err != nil {
+			t.Fatalf("block %d: failed to call precompile: %v", number, err)
+		}
+		if forked := number >= 10; forked != bytes.Equal(ret, want) {
+			t.Errorf("block %d: output mismatch: have %x, forked %v", number, ret, forked)
+		}
+	}
+}
+
+// Tests that value sent to the address of a precompile before the fork that
+// activates it is a plain transfer, and runs the precompile from then on.
+func TestPrecompileActivation(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		sender = common.HexToAddress("0x0101")
+		config = &params.ChainConfig{ChainId: big.NewInt(1), Blake2FBlock: big.NewInt(10)}
+		input  = make([]byte, 213) // zero rounds over a zero state
+	)
+	statedb.AddBalance(sender, big.NewInt(params.WON))
+
+	for i, number := range []int64{9, 10} {
+		ret, gas, err := Call(vm.Blake2FContractAddress, input, &Config{ChainConfig: config, State: statedb, Origin: sender, Value: big.NewInt(1), BlockNumber: big.NewInt(number), GasLimit: 100000})
+		if err != nil {
+			t.Fatalf("block %d: failed to call precompile: %v", number, err)
+		}
+		if forked := number >= 10; forked != (len(ret) == 64) {
+			t.Errorf("block %d: output mismatch: have %x, forked %v", number, ret, forked)
+		}
+		if gas != 100000 {
+			t.Errorf("block %d: gas mismatch: have %d, want %d", number, gas, 100000)
+		}
+		if balance := statedb.GetBalance(vm.Blake2FContractAddress); balance.Cmp(big.NewInt(int64(i+1))) != 0 {
+			t.Errorf("block %d: value not transferred: have %v, want %d", number, balance, i+1)
+		}
+	}
+}
+
+// Tests that removing a provider revokes its attestations once the revocation
+// fork is active, attestations issued before the fork included, while before it
+// they come back along with the provider. Revocation proposals invalidate the
+// attestations of a provider without removing it.
+func TestKycRevocation(t *testing.T) {
+	var (
+		p1, p2, p3 = common.HexToAddress("0x0101"), common.HexToAddress("0x0102"), common.HexToAddress("0x0103")
+		user       = common.HexToAddress("0x0201")
+		legacy     = common.HexToAddress("0x0202")
+		revocation = &params.ChainConfig{ChainId: big.NewInt(1), KycRevocationBlock: big.NewInt(0)}
+	)
+	newState := func() *state.StateDB {
+		db, _ := wondb.NewMemDatabase()
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+		for _, provider := range []common.Address{p1, p2, p3} {
+			statedb.AddKycProvider(provider)
+		}
+		return statedb
+	}
+	call := func(statedb *state.StateDB, config *params.ChainConfig, origin common.Address, input []byte) error {
+		_, _, err := Call(vm.KycContractAddress, input, &Config{ChainConfig: config, State: statedb, Origin: origin, Time: big.NewInt(1000), GasLimit: 100000})
+		return err
+	}
+	attest := func(address common.Address, level uint32) []byte {
+		args := make([]byte, 8)
+		binary.BigEndian.PutUint32(args, level)
+		return kycInput(vm.KycMethodSet, address.Bytes(), args)
+	}
+	propose := func(subject common.Address, pt uint64) []byte {
+		ptb := make([]byte, 8)
+		binary.BigEndian.PutUint64(ptb, pt)
+		return kycInput(vm.KycMethodProviderVoteProposal, subject.Bytes(), ptb)
+	}
+	// pass proposes pt for subject by p2 and has p3 second it
+	pass := func(statedb *state.StateDB, config *params.ChainConfig, subject common.Address, pt uint64) {
+		if err := call(statedb, config, p2, propose(subject, pt)); err != nil {
+			t.Fatalf("failed to propose %d for %x: %v", pt, subject, err)
+		}
+		if err := call(statedb, config, p3, kycInput(vm.KycMethodVote, []byte{0, 0})); err != nil {
+			t.Fatalf("failed to vote: %v", err)
+		}
+	}
+
+	// Without revocation, the attestations of a provider voted back in are valid again
+	statedb := newState()
+	if err := call(statedb, nil, p1, attest(user, 2)); err != nil {
+		t.Fatalf("attestation failed: %v", err)
+	}
+	pass(statedb, nil, p1, vm.KycProposalRemoveProvider)
+	if level := statedb.GetKycLevel(user, 1000); level != 0 {
+		t.Errorf("level of removed provider mismatch: have %d, want 0", level)
+	}
+	pass(statedb, nil, p1, vm.KycProposalAddProvider)
+	if level := statedb.GetKycLevel(user, 1000); level != 2 {
+		t.Errorf("level of re-added provider mismatch: have %d, want 2", level)
+	}
+	if err := call(statedb, nil, p2, propose(p1, vm.KycProposalRevokeProvider)); err != vm.ErrKycInvalidProposal {
+		t.Errorf("pre-fork revocation error mismatch: have %v, want %v", err, vm.ErrKycInvalidProposal)
+	}
+
+	// With revocation, removal invalidates them for good, pre-fork ones included
+	statedb = newState()
+	if err := call(statedb, nil, p1, attest(legacy, 1)); err != nil {
+		t.Fatalf("legacy attestation failed: %v", err)
+	}
+	if err := call(statedb, revocation, p1, attest(user, 2)); err != nil {
+		t.Fatalf("attestation failed: %v", err)
+	}
+	pass(statedb, revocation, p1, vm.KycProposalRemoveProvider)
+	pass(statedb, revocation, p1, vm.KycProposalAddProvider)
+	for _, addr := range []common.Address{user, legacy} {
+		if level, provider := statedb.GetKycLevel(addr, 1000), statedb.GetKycProvider(addr); level != 0 || provider != (common.Address{}) {
+			t.Errorf("revoked attestation of %x still valid: level %d, provider %x", addr, level, provider)
+		}
+	}
+	if level := statedb.GetKycLevel(p1, 1000); level == 0 {
+		t.Errorf("re-added provider lost its own attestation")
+	}
+	// Another provider may take the address over, and the provider may attest it anew
+	if err := call(statedb, revocation, p2, attest(legacy, 3)); err != nil {
+		t.Fatalf("attestation by another provider failed: %v", err)
+	}
+	if err := call(statedb, revocation, p1, attest(user, 4)); err != nil {
+		t.Fatalf("fresh attestation failed: %v", err)
+	}
+	if level := statedb.GetKycLevel(user, 1000); level != 4 {
+		t.Errorf("fresh attestation level mismatch: have %d, want 4", level)
+	}
+
+	// Revocation proposals keep the provider but drop its attestations
+	pass(statedb, revocation, p1, vm.KycProposalRevokeProvider)
+	if level := statedb.GetKycLevel(user, 1000); level != 0 {
+		t.Errorf("level after revocation mismatch: have %d, want 0", level)
+	}
+	if level := statedb.GetKycLevel(legacy, 1000); level != 3 {
+		t.Errorf("level attested by another provider mismatch: have %d, want 3", level)
+	}
+	if !statedb.KycProviderExists(p1) || statedb.GetKycLevel(p1, 1000) == 0 {
+		t.Errorf("revoked provider lost its office or its own attestation")
+	}
+	if epoch := statedb.GetKycProviderEpoch(p1); epoch != 2 {
+		t.Errorf("provider epoch mismatch: have %d, want 2", epoch)
+	}
+}
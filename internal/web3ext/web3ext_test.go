@@ -0,0 +1,81 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package web3ext
+
+import (
+	"context"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode"
+
+	"github.com/worldopennetwork/go-won/internal/wonapi"
+)
+
+// methodRegexp matches the name, call, parameter count and optional input
+// formatters of a method declared by an extension.
+var methodRegexp = regexp.MustCompile(`name: '([\w.]+)',\s*call: '(\w+)',\s*params: (\d+)(?:,\s*inputFormatter: \[([^\]]*)\])?`)
+
+// Tests that the won.kyc and won.dpos console methods call RPC methods the node
+// serves, with their number of arguments.
+func TestKycDposMethods(t *testing.T) {
+	// Collect the arities of the methods served in the won namespace
+	served := make(map[string]int)
+	for _, service := range []interface{}{wonapi.NewPublicBlockChainAPI(nil), wonapi.NewPublicTransactionPoolAPI(nil, nil)} {
+		typ := reflect.TypeOf(service)
+		for i := 0; i < typ.NumMethod(); i++ {
+			method := typ.Method(i)
+			args := method.Type.NumIn() - 1
+			if args > 0 && method.Type.In(1) == reflect.TypeOf((*context.Context)(nil)).Elem() {
+				args--
+			}
+			name := []rune(method.Name)
+			name[0] = unicode.ToLower(name[0])
+			served["won_"+string(name)] = args
+		}
+	}
+	found := 0
+	for _, match := range methodRegexp.FindAllStringSubmatch(Modules["won"], -1) {
+		name, call := match[1], match[2]
+		if !strings.HasPrefix(name, "kyc.") && !strings.HasPrefix(name, "dpos.") {
+			continue
+		}
+		found++
+
+		params, _ := strconv.Atoi(match[3])
+		args, ok := served[call]
+		if !ok {
+			t.Errorf("%s: calls unserved method %s", name, call)
+			continue
+		}
+		if params != args {
+			t.Errorf("%s: parameter count mismatch: have %d, want %d", name, params, args)
+		}
+		formatters := 0
+		if match[4] != "" {
+			formatters = len(strings.Split(match[4], ","))
+		}
+		if formatters != params {
+			t.Errorf("%s: input formatter count mismatch: have %d, want %d", name, formatters, params)
+		}
+	}
+	if found == 0 {
+		t.Fatalf("no kyc or dpos methods found")
+	}
+}
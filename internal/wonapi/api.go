@@ -37,8 +37,10 @@ import (
 	"github.com/worldopennetwork/go-won/common/math"
 	"github.com/worldopennetwork/go-won/consensus/ethash"
 	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/state"
 	"github.com/worldopennetwork/go-won/core/types"
 	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/core/vm/kycabi"
 	"github.com/worldopennetwork/go-won/crypto"
 	"github.com/worldopennetwork/go-won/log"
 	"github.com/worldopennetwork/go-won/p2p"
@@ -502,67 +504,267 @@ func (s *PublicBlockChainAPI) GetBalance(ctx context.Context, address common.Add
 }
 
 func (s *PublicBlockChainAPI) GetKycInfo(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (map[string]interface{}, error) {
-	state, _, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
 	if state == nil || err != nil {
 		return nil, err
 	}
-	lv := state.GetKycLevel(address)
+	lv := state.GetKycLevel(address, header.Time.Uint64())
 	zz := state.GetKycZone(address)
 	ss := state.GetKycProvider(address)
+	ex := state.GetKycExpiry(address)
 
 	fields := map[string]interface{}{
-		"level":    lv,
-		"zone":     zz,
-		"provider": ss,
+		"level":     lv,
+		"zone":      zz,
+		"provider":  ss,
+		"expiresAt": hexutil.Uint64(ex),
+	}
+	if pending := state.GetKycPendingAttestation(address); pending != nil && pending.Deadline > header.Time.Uint64() {
+		fields["pending"] = pending
 	}
 
 	return fields, nil
 }
 
-func (s *PublicBlockChainAPI) GetKycProposal(ctx context.Context) (map[string]interface{}, error) {
+// GetKycLevelThresholds returns the KYC levels the chain requires for large
+// transfers, ordered by amount.
+func (s *PublicBlockChainAPI) GetKycLevelThresholds(ctx context.Context) []params.KycLevelThreshold {
+	return s.b.ChainConfig().KycLevelThresholds()
+}
 
-	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+// GetKycHistory returns up to count of the retained KYC level and zone changes
+// of address, oldest first, skipping the first start of them.
+func (s *PublicBlockChainAPI) GetKycHistory(ctx context.Context, address common.Address, start hexutil.Uint64, count hexutil.Uint64, blockNr rpc.BlockNumber) ([]common.KycHistoryEntry, error) {
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
 	if state == nil || err != nil {
 		return nil, err
 	}
+	return state.GetKycHistory(address, uint64(start), uint64(count)), state.Error()
+}
+
+// KycStorageResult is a storage slot of the KYC contract along with its Merkle
+// proof.
+type KycStorageResult struct {
+	Key   common.Hash     `json:"key"`
+	Value common.Hash     `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// KycProofResult is the KYC info of an account along with the Merkle proofs it
+// can be verified with against the state root: the proof of the account itself,
+// holding the level, zone and provider, and the proofs of the KYC contract
+// account and of the slots of its storage the info depends on.
+type KycProofResult struct {
+	Address         common.Address     `json:"address"`
+	Level           uint32             `json:"level"`
+	Zone            uint32             `json:"zone"`
+	Provider        common.Address     `json:"provider"`
+	ExpiresAt       hexutil.Uint64     `json:"expiresAt"`
+	AccountProof    []hexutil.Bytes    `json:"accountProof"`
+	KycAccountProof []hexutil.Bytes    `json:"kycAccountProof"`
+	StorageProof    []KycStorageResult `json:"storageProof"`
+}
+
+// GetKycProof returns the KYC info of address at the given block along with the
+// Merkle proofs of the state it was read from.
+func (s *PublicBlockChainAPI) GetKycProof(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (*KycProofResult, error) {
+	statedb, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
+	if statedb == nil || err != nil {
+		return nil, err
+	}
+	result := &KycProofResult{
+		Address:      address,
+		Level:        statedb.GetKycLevel(address, header.Time.Uint64()),
+		Zone:         statedb.GetKycZone(address),
+		Provider:     statedb.GetKycProvider(address),
+		ExpiresAt:    hexutil.Uint64(statedb.GetKycExpiry(address)),
+		StorageProof: make([]KycStorageResult, 0),
+	}
+	if result.AccountProof, err = kycProof(statedb.GetProof(address)); err != nil {
+		return nil, err
+	}
+	if result.KycAccountProof, err = kycProof(statedb.GetProof(vm.KycContractAddress)); err != nil {
+		return nil, err
+	}
+	// Without any KYC contract storage, every slot is proven empty by the account proof
+	if !statedb.Exist(vm.KycContractAddress) {
+		return result, statedb.Error()
+	}
+	keys := []common.Hash{
+		state.KycContractCreatorKey(address),
+		state.KycExpiryKey(address),
+		state.KycProviderCountKey(),
+	}
+	for i, provider := range statedb.GetKycProviderList() {
+		if provider == result.Provider {
+			keys = append(keys, state.KycProviderKey(int64(i)))
+		}
+	}
+	for _, key := range keys {
+		proof, err := kycProof(statedb.GetStorageProof(vm.KycContractAddress, key))
+		if err != nil {
+			return nil, err
+		}
+		result.StorageProof = append(result.StorageProof, KycStorageResult{
+			Key:   key,
+			Value: statedb.GetState(vm.KycContractAddress, key),
+			Proof: proof,
+		})
+	}
+	return result, statedb.Error()
+}
 
-	hvAddr, hvTime, hvVoteTotal, hvType, iVoted, iVotedNo := state.GetKycProviderProposol()
+// kycProof converts the nodes of a Merkle proof for json output.
+func kycProof(nodes [][]byte, err error) ([]hexutil.Bytes, error) {
+	if err != nil {
+		return nil, err
+	}
+	proof := make([]hexutil.Bytes, len(nodes))
+	for i, node := range nodes {
+		proof[i] = node
+	}
+	return proof, nil
+}
 
-	if hvAddr == common.BytesToAddress([]byte{0}) {
-		return nil, nil
+// GetKycProposal returns the oldest KYC provider proposal still open for votes
+// at the given block, or the latest one if omitted, along with its tally. The
+// result is null if no proposal is open.
+func (s *PublicBlockChainAPI) GetKycProposal(ctx context.Context, blockNr *rpc.BlockNumber) (map[string]interface{}, error) {
+	proposals, err := s.GetKycProposals(ctx, blockNr)
+	if len(proposals) == 0 || err != nil {
+		return nil, err
 	}
+	return proposals[0], nil
+}
 
-	fields := map[string]interface{}{
-		"candicate": hvAddr,
-		"startTime": hvTime.Int64(),
-		"VoteTotal": hvVoteTotal.Int64(),
-		"VoteType":  hvType.Int64(),
-		"VotedYes":  iVoted.Int64(),
-		"VotedNo":   iVotedNo.Int64(),
+// GetKycProposals returns the KYC provider proposals open for votes at the given
+// block, or the latest one if omitted, oldest first.
+func (s *PublicBlockChainAPI) GetKycProposals(ctx context.Context, blockNr *rpc.BlockNumber) ([]map[string]interface{}, error) {
+	proposals := make([]map[string]interface{}, 0)
+
+	number := rpc.LatestBlockNumber
+	if blockNr != nil {
+		number = *blockNr
+	}
+	state, header, err := s.b.StateAndHeaderByNumber(ctx, number)
+	if state == nil || err != nil {
+		return proposals, err
 	}
+	num, den := s.b.ChainConfig().KycQuorum()
 
-	return fields, nil
-}
+	for _, id := range state.GetKycProviderProposolIds() {
+		hvAddr, hvTime, hvVoteTotal, hvType, iVoted, iVotedNo := state.GetKycProviderProposol(id)
 
-func (s *PublicBlockChainAPI) GetKycProviderList(ctx context.Context) ([]common.Address, error) {
+		// Expired proposals linger until the next one is made, skip them
+		expiresAt := hvTime.Uint64() + vm.KycProposalLifetime
+		if hvAddr == common.BytesToAddress([]byte{0}) || expiresAt <= header.Time.Uint64() {
+			continue
+		}
+		proposals = append(proposals, map[string]interface{}{
+			"id":           hexutil.Uint64(id),
+			"candidate":    hvAddr,
+			"proposalType": hexutil.Uint64(hvType.Uint64()),
+			"startTime":    hexutil.Uint64(hvTime.Uint64()),
+			"totalVoters":  hexutil.Uint64(hvVoteTotal.Uint64()),
+			"yesVotes":     hexutil.Uint64(iVoted.Uint64()),
+			"noVotes":      hexutil.Uint64(iVotedNo.Uint64()),
+			"expiresAt":    hexutil.Uint64(expiresAt),
+			"passed":       iVoted.Uint64()*den > hvVoteTotal.Uint64()*num,
+		})
+	}
+	return proposals, state.Error()
+}
+
+// GetKycProviderList returns the KYC providers at the given block, or the latest
+// one if omitted.
+func (s *PublicBlockChainAPI) GetKycProviderList(ctx context.Context, blockNr *rpc.BlockNumber) ([]common.Address, error) {
 	addresses := make([]common.Address, 0)
 
-	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+	number := rpc.LatestBlockNumber
+	if blockNr != nil {
+		number = *blockNr
+	}
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, number)
 	if state == nil || err != nil {
 		return addresses, err
 	}
 
-	return state.GetKycProviderList(), nil
+	return state.GetKycProviderList(), state.Error()
+}
+
+// GetKycProviderCount returns the number of KYC providers at the given block, or
+// the latest one if omitted.
+func (s *PublicBlockChainAPI) GetKycProviderCount(ctx context.Context, blockNr *rpc.BlockNumber) (hexutil.Uint64, error) {
+	number := rpc.LatestBlockNumber
+	if blockNr != nil {
+		number = *blockNr
+	}
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, number)
+	if state == nil || err != nil {
+		return 0, err
+	}
+	return hexutil.Uint64(state.GetKycProviderCount()), state.Error()
 }
 
-//for dpos
-func (s *PublicBlockChainAPI) GetDposProducerList(ctx context.Context, startPos int64, number int64) ([]common.Address, error) {
+// GetKycProviders returns the KYC providers at the given block, or the latest
+// one if omitted, along with the metadata they were registered with.
+func (s *PublicBlockChainAPI) GetKycProviders(ctx context.Context, blockNr *rpc.BlockNumber) ([]*common.KycProviderInfo, error) {
+	providers := make([]*common.KycProviderInfo, 0)
 
+	number := rpc.LatestBlockNumber
+	if blockNr != nil {
+		number = *blockNr
+	}
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, number)
+	if state == nil || err != nil {
+		return providers, err
+	}
+	for _, addr := range state.GetKycProviderList() {
+		providers = append(providers, state.GetKycProviderInfo(addr))
+	}
+	return providers, state.Error()
+}
+
+// GetStakingStats returns the staking economics of the DPoS network at the given
+// block, or the latest one if omitted.
+func (s *PublicBlockChainAPI) GetStakingStats(ctx context.Context, blockNr *rpc.BlockNumber) (map[string]interface{}, error) {
 	if s.b.ChainConfig().Dpos == nil {
 		return nil, fmt.Errorf("This not a DPOS network")
 	}
+	number := rpc.LatestBlockNumber
+	if blockNr != nil {
+		number = *blockNr
+	}
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, number)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	producers := state.GetDposProducerCount()
 
-	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+	fields := map[string]interface{}{
+		"totalActivatedStake":     (*hexutil.Big)(state.GetDposTotalActivatedStake()),
+		"activationThreshold":     (*hexutil.Big)(vm.DposActivatedStakeThreshold),
+		"activationTime":          hexutil.Uint64(state.GetDposThreshActivatedStakeTime().Uint64()),
+		"totalProducerVoteWeight": (*hexutil.Big)(state.GetDposTotalProducerWeight()),
+		"producerCount":           hexutil.Uint64(producers.Uint64()),
+		"activeProducerCount":     hexutil.Uint64(len(state.GetProducerList(0, producers.Int64()))),
+		"lastScheduleUpdateTime":  hexutil.Uint64(state.GetDposLastProducerScheduleUpdateTime().Uint64()),
+	}
+	return fields, state.Error()
+}
+
+// GetDposProducerList returns up to number active block producers at the given
+// block, or the latest one if omitted, starting at startPos of the producer list.
+func (s *PublicBlockChainAPI) GetDposProducerList(ctx context.Context, startPos int64, number int64, blockNr *rpc.BlockNumber) ([]common.Address, error) {
+
+	if s.b.ChainConfig().Dpos == nil {
+		return nil, fmt.Errorf("This not a DPOS network")
+	}
+	block := rpc.LatestBlockNumber
+	if blockNr != nil {
+		block = *blockNr
+	}
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, block)
 	if state == nil || err != nil {
 		return nil, err
 	}
@@ -573,14 +775,18 @@ func (s *PublicBlockChainAPI) GetDposProducerList(ctx context.Context, startPos
 
 }
 
-//
-func (s *PublicBlockChainAPI) GetDposVoterInfo(ctx context.Context, voter common.Address) (map[string]interface{}, error) {
+// GetDposVoterInfo returns the stake of voter and the producers it voted for at
+// the given block, or the latest one if omitted.
+func (s *PublicBlockChainAPI) GetDposVoterInfo(ctx context.Context, voter common.Address, blockNr *rpc.BlockNumber) (map[string]interface{}, error) {
 
 	if s.b.ChainConfig().Dpos == nil {
 		return nil, fmt.Errorf("This not a DPOS network")
 	}
-
-	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+	number := rpc.LatestBlockNumber
+	if blockNr != nil {
+		number = *blockNr
+	}
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, number)
 	if state == nil || err != nil {
 		return nil, err
 	}
@@ -592,13 +798,26 @@ func (s *PublicBlockChainAPI) GetDposVoterInfo(ctx context.Context, voter common
 		"staking":   staking,
 		"producers": producers,
 	}
+	// Delegators vote through their proxy, proxies with the weight delegated to them
+	if proxy := state.GetVoterProxy(&voter); proxy != (common.Address{}) {
+		fields["proxy"] = proxy
+	}
+	if state.IsDposProxy(&voter) {
+		fields["delegatedWeight"] = (*hexutil.Big)(state.GetDposProxyWeight(&voter))
+	}
 
 	return fields, nil
 
 }
 
-func (s *PublicBlockChainAPI) GetDposProducerInfo(ctx context.Context, pb common.Address) (map[string]interface{}, error) {
-	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+// GetDposProducerInfo returns the registration of producer pb at the given block,
+// or the latest one if omitted.
+func (s *PublicBlockChainAPI) GetDposProducerInfo(ctx context.Context, pb common.Address, blockNr *rpc.BlockNumber) (map[string]interface{}, error) {
+	number := rpc.LatestBlockNumber
+	if blockNr != nil {
+		number = *blockNr
+	}
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, number)
 	if state == nil || err != nil {
 		return nil, err
 	}
@@ -613,19 +832,35 @@ func (s *PublicBlockChainAPI) GetDposProducerInfo(ctx context.Context, pb common
 		"url":        info.Url,
 		"totalVotes": info.TotalVotes,
 		"isActive":   info.IsActive,
+		"location":   info.Location,
+		"signingKey": pb,
+	}
+	if key := state.GetProducerSigningKey(&pb); key != (common.Address{}) {
+		fields["signingKey"] = key
+	}
+	if key := state.GetProducerPrevSigningKey(&pb); key != (common.Address{}) {
+		fields["prevSigningKey"] = key
+	}
+	if number := state.GetProducerSigningKeyBlock(&pb); number != 0 {
+		fields["signingKeyBlock"] = hexutil.Uint64(number)
 	}
 
 	return fields, nil
 
 }
 
-func (s *PublicBlockChainAPI) GetDposRefundInfo(ctx context.Context, pb common.Address) (map[string]interface{}, error) {
+// GetDposRefundInfo returns the pending stake refund of pb at the given block, or
+// the latest one if omitted.
+func (s *PublicBlockChainAPI) GetDposRefundInfo(ctx context.Context, pb common.Address, blockNr *rpc.BlockNumber) (map[string]interface{}, error) {
 
 	if s.b.ChainConfig().Dpos == nil {
 		return nil, fmt.Errorf("This not a DPOS network")
 	}
-
-	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+	number := rpc.LatestBlockNumber
+	if blockNr != nil {
+		number = *blockNr
+	}
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, number)
 	if state == nil || err != nil {
 		return nil, err
 	}
@@ -640,6 +875,42 @@ func (s *PublicBlockChainAPI) GetDposRefundInfo(ctx context.Context, pb common.A
 	return fields, nil
 }
 
+// GetRefundInfo returns the pending stake refund of addr at the given block, or
+// the latest one if omitted: the amount, when it was requested, the earliest
+// block time it can be claimed at, whether a block at the time of the given one
+// could claim it, the input of the transaction claiming it and whether it will
+// be paid out without one.
+func (s *PublicBlockChainAPI) GetRefundInfo(ctx context.Context, addr common.Address, blockNr *rpc.BlockNumber) (map[string]interface{}, error) {
+	if s.b.ChainConfig().Dpos == nil {
+		return nil, fmt.Errorf("This not a DPOS network")
+	}
+	number := rpc.LatestBlockNumber
+	if blockNr != nil {
+		number = *blockNr
+	}
+	state, header, err := s.b.StateAndHeaderByNumber(ctx, number)
+	if state == nil || err != nil {
+		return nil, err
+	}
+	amount, requestTime := state.GetRefundRequestInfo(&addr)
+
+	fields := map[string]interface{}{
+		"amount":       (*hexutil.Big)(amount),
+		"requestedAt":  hexutil.Uint64(requestTime.Uint64()),
+		"matureAt":     nil,
+		"claimableNow": false,
+		"claimInput":   hexutil.Bytes((&kycabi.Refund{}).Pack()),
+		"autoRefund":   state.GetDposAutoRefund(&addr),
+	}
+	if amount.Sign() > 0 {
+		matureAt := requestTime.Uint64() + vm.DposRefundDelay + 1
+
+		fields["matureAt"] = hexutil.Uint64(matureAt)
+		fields["claimableNow"] = header.Time.Uint64() >= matureAt
+	}
+	return fields, state.Error()
+}
+
 // GetBlockByNumber returns the requested block. When blockNr is -1 the chain head is returned. When fullTx is true all
 // transactions in the block are returned in full detail, otherwise only the transaction hash is returned.
 func (s *PublicBlockChainAPI) GetBlockByNumber(ctx context.Context, blockNr rpc.BlockNumber, fullTx bool) (map[string]interface{}, error) {
@@ -747,14 +1018,109 @@ type CallArgs struct {
 	GasPrice hexutil.Big     `json:"gasPrice"`
 	Value    hexutil.Big     `json:"value"`
 	Data     hexutil.Bytes   `json:"data"`
+
+	// Strict executes the call on the real balance of the sender rather than a
+	// limitless one, so that it fails same as a transaction would on transfers
+	// and stakes beyond it. The sender also has to afford the gas then.
+	Strict bool `json:"strict"`
+}
+
+// kycErrorCode is the JSON-RPC error code of calls rejected by the KYC checks.
+const kycErrorCode = -32010
+
+// kycCallError is the JSON-RPC error returned for calls rejected by the KYC
+// checks, carrying the offending account as error data if it's known.
+type kycCallError struct {
+	err error
+}
+
+func (e *kycCallError) Error() string  { return e.err.Error() }
+func (e *kycCallError) ErrorCode() int { return kycErrorCode }
+
+func (e *kycCallError) ErrorData() interface{} {
+	if err, ok := e.err.(*core.KycError); ok {
+		return map[string]interface{}{"address": err.Address, "recipient": err.Recipient}
+	}
+	return nil
 }
 
-func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, vmCfg vm.Config, timeout time.Duration) ([]byte, uint64, bool, error) {
+// precompileErrorCode is the JSON-RPC error code of calls failed by the KYC
+// precompile.
+const precompileErrorCode = -32011
+
+// precompileReasons maps the errors of the KYC precompile to the reason codes
+// reported to the user.
+var precompileReasons = map[error]string{
+	vm.ErrKycUnknownMethod:        "KYC_UNKNOWN_METHOD",
+	vm.ErrKycValueTransfer:        "KYC_VALUE_TRANSFER",
+	vm.ErrKycChainMismatch:        "KYC_CHAIN_MISMATCH",
+	vm.ErrKycInvalidInput:         "KYC_INVALID_INPUT",
+	vm.ErrKycContractCaller:       "KYC_CONTRACT_CALLER",
+	vm.ErrKycNotProvider:          "KYC_NOT_PROVIDER",
+	vm.ErrKycOtherProvider:        "KYC_OTHER_PROVIDER",
+	vm.ErrKycNoPendingAttestation: "KYC_NO_PENDING_ATTESTATION",
+	vm.ErrKycSameProvider:         "KYC_SAME_PROVIDER",
+	vm.ErrKycAttestationMismatch:  "KYC_ATTESTATION_MISMATCH",
+	vm.ErrKycProviderExists:       "KYC_PROVIDER_EXISTS",
+	vm.ErrKycProviderMinimum:      "KYC_PROVIDER_MINIMUM",
+	vm.ErrKycProposalsFull:        "KYC_PROPOSALS_FULL",
+	vm.ErrKycInvalidProposal:      "KYC_INVALID_PROPOSAL",
+	vm.ErrKycProposalPending:      "KYC_PROPOSAL_PENDING",
+	vm.ErrKycUnknownProposal:      "KYC_UNKNOWN_PROPOSAL",
+	vm.ErrKycProposalClosed:       "KYC_PROPOSAL_CLOSED",
+	vm.ErrKycAlreadyVoted:         "KYC_ALREADY_VOTED",
+	vm.ErrKycNotProposer:          "KYC_NOT_PROPOSER",
+	vm.ErrDposInvalidStake:        "STAKE_INVALID",
+	vm.ErrDposStakeInactive:       "STAKE_NOT_ACTIVATED",
+	vm.ErrDposStakeBelowRefund:    "STAKE_BELOW_REFUND",
+	vm.ErrDposInsufficientStake:   "STAKE_INSUFFICIENT_BALANCE",
+	vm.ErrDposRefundNotDue:        "REFUND_NOT_DUE",
+	vm.ErrDposInsufficientRefund:  "REFUND_INSUFFICIENT_STAKE",
+	vm.ErrDposInvalidProducer:     "VOTE_INVALID_PRODUCER",
+	vm.ErrDposTooManyVotes:        "VOTE_TOO_MANY_PRODUCERS",
+	vm.ErrDposNotProxy:            "PROXY_NOT_REGISTERED",
+	vm.ErrDposProxyChain:          "PROXY_CHAIN",
+	vm.ErrDposProducerStake:       "PRODUCER_INSUFFICIENT_STAKE",
+	vm.ErrDposProducerFee:         "PRODUCER_INSUFFICIENT_FEE",
+	vm.ErrDposSigningKeyTaken:     "SIGNING_KEY_TAKEN",
+}
+
+// precompileCallError is the JSON-RPC error returned for calls failed by the
+// KYC precompile, carrying the reason code of the failure as error data.
+type precompileCallError struct {
+	err    error
+	reason string
+}
+
+func (e *precompileCallError) Error() string  { return e.err.Error() }
+func (e *precompileCallError) ErrorCode() int { return precompileErrorCode }
+
+func (e *precompileCallError) ErrorData() interface{} {
+	return map[string]interface{}{"reason": e.reason}
+}
+
+// callError converts the reason of a failed call into the error to return to
+// the user, if it is to be returned as an error at all.
+func callError(args CallArgs, reason error) error {
+	if _, ok := reason.(*core.KycError); ok || reason == core.ErrKycValidationFailed {
+		return &kycCallError{reason}
+	}
+	if args.To != nil && *args.To == vm.KycContractAddress {
+		if code, ok := precompileReasons[reason]; ok {
+			return &precompileCallError{reason, code}
+		}
+	}
+	return nil
+}
+
+// doCall executes the call on top of the requested block, returning the result,
+// the gas used and the reason of the failure if the execution failed.
+func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber, vmCfg vm.Config, timeout time.Duration) ([]byte, uint64, error, error) {
 	defer func(start time.Time) { log.Debug("Executing EVM call finished", "runtime", time.Since(start)) }(time.Now())
 
 	state, header, err := s.b.StateAndHeaderByNumber(ctx, blockNr)
 	if state == nil || err != nil {
-		return nil, 0, false, err
+		return nil, 0, nil, err
 	}
 	// Set sender address or use a default if none specified
 	addr := args.From
@@ -769,6 +1135,9 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	gas, gasPrice := uint64(args.Gas), args.GasPrice.ToInt()
 	if gas == 0 {
 		gas = math.MaxUint64 / 2
+		if args.Strict {
+			gas = header.GasLimit // the sender pays for it
+		}
 	}
 	if gasPrice.Sign() == 0 {
 		gasPrice = new(big.Int).SetUint64(uint64(params.GasPrice))
@@ -794,9 +1163,9 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	defer cancel()
 
 	// Get a new instance of the EVM.
-	evm, vmError, err := s.b.GetEVM(ctx, msg, state, header, vmCfg)
+	evm, vmError, err := s.b.GetEVM(ctx, msg, state, header, vmCfg, args.Strict)
 	if err != nil {
-		return nil, 0, false, err
+		return nil, 0, nil, err
 	}
 	// Wait for the context to be done and cancel the evm. Even if the
 	// EVM has finished, cancelling may be done (repeatedly)
@@ -808,17 +1177,20 @@ func (s *PublicBlockChainAPI) doCall(ctx context.Context, args CallArgs, blockNr
 	// Setup the gas pool (also for unmetered requests)
 	// and apply the message.
 	gp := new(core.GasPool).AddGas(math.MaxUint64)
-	res, gas, failed, err := core.ApplyMessage(evm, msg, gp)
+	res, gas, reason, err := core.ApplyMessageWithReason(evm, msg, gp)
 	if err := vmError(); err != nil {
-		return nil, 0, false, err
+		return nil, 0, nil, err
 	}
-	return res, gas, failed, err
+	return res, gas, reason, err
 }
 
 // Call executes the given transaction on the state for the given block number.
 // It doesn't make and changes in the state/blockchain and is useful to execute and retrieve values.
 func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr rpc.BlockNumber) (hexutil.Bytes, error) {
-	result, _, _, err := s.doCall(ctx, args, blockNr, vm.Config{}, 5*time.Second)
+	result, _, reason, err := s.doCall(ctx, args, blockNr, vm.Config{}, 5*time.Second)
+	if err == nil {
+		err = callError(args, reason)
+	}
 	return (hexutil.Bytes)(result), err
 }
 
@@ -827,9 +1199,8 @@ func (s *PublicBlockChainAPI) Call(ctx context.Context, args CallArgs, blockNr r
 func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (hexutil.Uint64, error) {
 	// Binary search the gas requirement, as it may be higher than the amount used
 	var (
-		lo  uint64 = params.TxGas - 1
-		hi  uint64
-		cap uint64
+		lo uint64 = params.TxGas - 1
+		hi uint64
 	)
 	if uint64(args.Gas) >= params.TxGas {
 		hi = uint64(args.Gas)
@@ -841,18 +1212,51 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (h
 		}
 		hi = block.GasLimit()
 	}
-	cap = hi
-
+	// Calls of a precompile active in the pending block fail on less gas than it
+	// requires on top of the transaction, no need to search below that
+	if args.To != nil {
+		header, err := s.b.HeaderByNumber(ctx, rpc.PendingBlockNumber)
+		if err != nil {
+			return 0, err
+		}
+		if p := vm.ActivePrecompiles(header.Number, s.b.ChainConfig())[*args.To]; p != nil {
+			if floor := params.TxGas + p.RequiredGas(args.Data) - 1; floor > lo {
+				lo = floor
+			}
+		}
+	}
 	// Create a helper to check if a gas allowance results in an executable transaction
+	var (
+		failure error
+		outcome []byte
+	)
+	precompile := args.To != nil && *args.To == vm.KycContractAddress
 	executable := func(gas uint64) bool {
 		args.Gas = hexutil.Uint64(gas)
 
-		_, _, failed, err := s.doCall(ctx, args, rpc.PendingBlockNumber, vm.Config{}, 0)
-		if err != nil || failed {
+		res, _, reason, err := s.doCall(ctx, args, rpc.PendingBlockNumber, vm.Config{}, 0)
+		if err != nil || reason != nil {
+			failure = callError(args, reason)
 			return false
 		}
+		// The KYC precompile may do part of the work on a lower allowance, like a
+		// batch only setting the entries it can pay for, which has to be the same
+		// as on the highest one
+		if precompile && outcome != nil && !bytes.Equal(res, outcome) {
+			return false
+		}
+		if outcome == nil {
+			outcome = append([]byte{}, res...)
+		}
 		return true
 	}
+	// Reject the transaction as invalid if it fails even at the highest allowance
+	if !executable(hi) {
+		if failure != nil {
+			return 0, failure
+		}
+		return 0, fmt.Errorf("gas required exceeds allowance or always failing transaction")
+	}
 	// Execute the binary search and hone in on an executable gas limit
 	for lo+1 < hi {
 		mid := (hi + lo) / 2
@@ -862,12 +1266,6 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (h
 			hi = mid
 		}
 	}
-	// Reject the transaction as invalid if it still fails at the highest allowance
-	if hi == cap {
-		if !executable(hi) {
-			return 0, fmt.Errorf("gas required exceeds allowance or always failing transaction")
-		}
-	}
 	return hexutil.Uint64(hi), nil
 }
 
@@ -875,10 +1273,12 @@ func (s *PublicBlockChainAPI) EstimateGas(ctx context.Context, args CallArgs) (h
 // while replaying a transaction in debug mode as well as transaction
 // execution status, the amount of gas used and the return value
 type ExecutionResult struct {
-	Gas         uint64         `json:"gas"`
-	Failed      bool           `json:"failed"`
-	ReturnValue string         `json:"returnValue"`
-	StructLogs  []StructLogRes `json:"structLogs"`
+	Gas         uint64             `json:"gas"`
+	Failed      bool               `json:"failed"`
+	Error       string             `json:"error,omitempty"`
+	ReturnValue string             `json:"returnValue"`
+	StructLogs  []StructLogRes     `json:"structLogs"`
+	Precompile  []PrecompileLogRes `json:"precompile,omitempty"`
 }
 
 // StructLogRes stores a structured log emitted by the EVM while replaying a
@@ -932,6 +1332,42 @@ func FormatLogs(logs []vm.StructLog) []StructLogRes {
 	return formatted
 }
 
+// PrecompileLogRes stores a call into the KYC precompile made while replaying a
+// transaction in debug mode, with the arguments decoded if the input is valid.
+type PrecompileLogRes struct {
+	Caller  common.Address    `json:"caller"`
+	Method  string            `json:"method"`
+	Args    kycabi.Call       `json:"args,omitempty"`
+	Input   hexutil.Bytes     `json:"input"`
+	Depth   int               `json:"depth"`
+	Error   string            `json:"error,omitempty"`
+	Storage map[string]string `json:"storage"`
+}
+
+// FormatPrecompileLogs formats the captured KYC precompile calls for json output
+func FormatPrecompileLogs(logs []vm.PrecompileLog) []PrecompileLogRes {
+	formatted := make([]PrecompileLogRes, len(logs))
+	for index, trace := range logs {
+		formatted[index] = PrecompileLogRes{
+			Caller:  trace.Caller,
+			Method:  trace.Method,
+			Input:   trace.Input,
+			Depth:   trace.Depth,
+			Storage: make(map[string]string),
+		}
+		if call, err := kycabi.Decode(trace.Input); err == nil {
+			formatted[index].Args = call
+		}
+		if trace.Err != nil {
+			formatted[index].Error = trace.Err.Error()
+		}
+		for key, value := range trace.Storage {
+			formatted[index].Storage[fmt.Sprintf("%x", key)] = fmt.Sprintf("%x", value)
+		}
+	}
+	return formatted
+}
+
 // rpcOutputBlock converts the given block to the RPC output which depends on fullTx. If inclTx is true transactions are
 // returned. When fullTx is true the returned block contains full transaction details, otherwise it will only contain
 // transaction hashes.
@@ -1006,6 +1442,9 @@ type RPCTransaction struct {
 	V                *hexutil.Big    `json:"v"`
 	R                *hexutil.Big    `json:"r"`
 	S                *hexutil.Big    `json:"s"`
+
+	// DecodedInput is the meaning of the input of calls of the KYC precompile
+	DecodedInput *kycabi.Decoded `json:"decodedInput,omitempty"`
 }
 
 // newRPCTransaction returns a transaction that will serialize to the RPC
@@ -1031,6 +1470,9 @@ func newRPCTransaction(tx *types.Transaction, blockHash common.Hash, blockNumber
 		R:        (*hexutil.Big)(r),
 		S:        (*hexutil.Big)(s),
 	}
+	if to := tx.To(); to != nil && *to == vm.KycContractAddress && len(tx.Data()) > 0 {
+		result.DecodedInput = kycabi.Describe(tx.Data())
+	}
 	if blockHash != (common.Hash{}) {
 		result.BlockHash = blockHash
 		result.BlockNumber = (*hexutil.Big)(new(big.Int).SetUint64(blockNumber))
@@ -1217,6 +1659,9 @@ func (s *PublicTransactionPoolAPI) GetTransactionReceipt(ctx context.Context, ha
 	if receipt.Logs == nil {
 		fields["logs"] = [][]*types.Log{}
 	}
+	if receipt.KycError != types.KycErrorNone {
+		fields["kycError"] = hexutil.Uint(receipt.KycError)
+	}
 	// If the ContractAddress is 20 0x0 bytes, assume it is not a contract creation
 	if receipt.ContractAddress != (common.Address{}) {
 		fields["contractAddress"] = receipt.ContractAddress
@@ -1262,8 +1707,14 @@ func (args *SendTxArgs) setDefaults(ctx context.Context, b Backend) error {
 		*(*uint64)(args.Gas) = 90000
 	}
 
-	fixedPrice := b.FixedPrice()
-	if fixedPrice.Int64() > 0 {
+	if args.GasPrice == nil && args.To != nil && *args.To == vm.KycContractAddress {
+		// Calls of the KYC precompile are priced by the governance policy
+		price, err := b.SuggestPriceFor(ctx, types.NewTransaction(0, *args.To, nil, 0, nil, args.input()))
+		if err != nil {
+			return err
+		}
+		args.GasPrice = (*hexutil.Big)(price)
+	} else if fixedPrice := b.FixedPrice(); fixedPrice.Int64() > 0 {
 		args.GasPrice = (*hexutil.Big)(fixedPrice)
 	}
 
@@ -1290,26 +1741,25 @@ func (args *SendTxArgs) setDefaults(ctx context.Context, b Backend) error {
 	}
 	if args.To == nil {
 		// Contract creation
-		var input []byte
-		if args.Data != nil {
-			input = *args.Data
-		} else if args.Input != nil {
-			input = *args.Input
-		}
-		if len(input) == 0 {
+		if len(args.input()) == 0 {
 			return errors.New(`contract creation without any data provided`)
 		}
 	}
 	return nil
 }
 
-func (args *SendTxArgs) toTransaction() *types.Transaction {
-	var input []byte
+// input returns the data of the transaction, preferring "data" over "input".
+func (args *SendTxArgs) input() []byte {
 	if args.Data != nil {
-		input = *args.Data
+		return *args.Data
 	} else if args.Input != nil {
-		input = *args.Input
+		return *args.Input
 	}
+	return nil
+}
+
+func (args *SendTxArgs) toTransaction() *types.Transaction {
+	input := args.input()
 	if args.To == nil {
 		return types.NewContractCreation(uint64(*args.Nonce), (*big.Int)(args.Value), uint64(*args.Gas), (*big.Int)(args.GasPrice), input)
 	}
@@ -1372,7 +1822,9 @@ func (s *PublicTransactionPoolAPI) SendTransaction(ctx context.Context, args Sen
 	return submitTransaction(ctx, s.b, signed)
 }
 
-func (s *PublicTransactionPoolAPI) SetKycForAddress(ctx context.Context, from common.Address, address common.Address, level uint32, zone uint32) (common.Hash, error) {
+// SetKycForAddress sends a transaction setting the KYC level and zone of
+// address, expiring at the optional expiresAt time.
+func (s *PublicTransactionPoolAPI) SetKycForAddress(ctx context.Context, from common.Address, address common.Address, level uint32, zone uint32, expiresAt *hexutil.Uint64) (common.Hash, error) {
 	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
 
 	if state == nil || err != nil {
@@ -1395,7 +1847,7 @@ func (s *PublicTransactionPoolAPI) SetKycForAddress(ctx context.Context, from co
 	//yBytes := y.Bytes()
 	//copy(ret[1+2*byteLen-len(yBytes):], yBytes)
 	//
-	inputv := make([]byte, 4+20+4+4)
+	inputv := make([]byte, 4+20+4+4+8)
 	input := (hexutil.Bytes)(inputv)
 
 	//inputv[0]=1;//set kyc
@@ -1403,13 +1855,44 @@ func (s *PublicTransactionPoolAPI) SetKycForAddress(ctx context.Context, from co
 	copy(inputv[4:], address.Bytes())
 	binary.BigEndian.PutUint32(inputv[24:], level)
 	binary.BigEndian.PutUint32(inputv[28:], zone)
+	if expiresAt != nil {
+		binary.BigEndian.PutUint64(inputv[32:], uint64(*expiresAt))
+	}
 
 	args.Input = &input
 
-	return s.SendTransaction(ctx, args)
+	return s.sendKycTransaction(ctx, args)
+}
+
+// ConfirmKycForAddress sends a transaction confirming the KYC attestation
+// pending for address, which must match the level, zone and expiry given.
+func (s *PublicTransactionPoolAPI) ConfirmKycForAddress(ctx context.Context, from common.Address, address common.Address, level uint32, zone uint32, expiresAt *hexutil.Uint64) (common.Hash, error) {
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+	if state == nil || err != nil {
+		return common.Hash{}, err
+	}
+
+	var args = SendTxArgs{}
+	args.To = &vm.KycContractAddress
+	args.From = from
+	args.setDefaults(ctx, s.b)
+
+	inputv := make([]byte, 4+20+4+4+8)
+	input := (hexutil.Bytes)(inputv)
+	binary.BigEndian.PutUint32(inputv[0:], vm.KycMethodConfirm)
+	copy(inputv[4:], address.Bytes())
+	binary.BigEndian.PutUint32(inputv[24:], level)
+	binary.BigEndian.PutUint32(inputv[28:], zone)
+	if expiresAt != nil {
+		binary.BigEndian.PutUint64(inputv[32:], uint64(*expiresAt))
+	}
+	args.Input = &input
+	return s.sendKycTransaction(ctx, args)
 }
 
-func (s *PublicTransactionPoolAPI) MakeKycProviderModifyProposal(ctx context.Context, from common.Address, addr common.Address, pt uint64) (common.Hash, error) {
+// MakeKycProviderModifyProposal proposes a change of the KYC providers or zone
+// policy. Proposals adding a provider may carry the metadata of the provider.
+func (s *PublicTransactionPoolAPI) MakeKycProviderModifyProposal(ctx context.Context, from common.Address, addr common.Address, pt uint64, info *common.KycProviderInfo) (common.Hash, error) {
 
 	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
 
@@ -1421,16 +1904,28 @@ func (s *PublicTransactionPoolAPI) MakeKycProviderModifyProposal(ctx context.Con
 	args.To = &vm.KycContractAddress
 	args.From = from
 	args.setDefaults(ctx, s.b)
-	inputv := make([]byte, 4+20+8)
+	var blob []byte
+	if info != nil {
+		if blob, err = rlp.EncodeToBytes(info); err != nil {
+			return common.Hash{}, err
+		}
+		if len(blob) > vm.KycProviderInfoMaxSize {
+			return common.Hash{}, fmt.Errorf("provider metadata too large: %d > %d bytes", len(blob), vm.KycProviderInfoMaxSize)
+		}
+	}
+	inputv := make([]byte, 4+20+8+len(blob))
 	input := (hexutil.Bytes)(inputv)
 	binary.BigEndian.PutUint32(inputv[0:], vm.KycMethodProviderVoteProposal)
 	copy(inputv[4:], addr.Bytes())
 	binary.BigEndian.PutUint64(inputv[24:], pt)
+	copy(inputv[32:], blob)
 	args.Input = &input
-	return s.SendTransaction(ctx, args)
+	return s.sendKycTransaction(ctx, args)
 }
 
-func (s *PublicTransactionPoolAPI) VoteForKycProvider(ctx context.Context, from common.Address, nay uint16) (common.Hash, error) {
+// VoteForKycProvider votes on the KYC provider proposal id, or on the oldest
+// pending one if no id is given.
+func (s *PublicTransactionPoolAPI) VoteForKycProvider(ctx context.Context, from common.Address, nay uint16, id *hexutil.Uint64) (common.Hash, error) {
 
 	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
 
@@ -1442,12 +1937,41 @@ func (s *PublicTransactionPoolAPI) VoteForKycProvider(ctx context.Context, from
 	args.To = &vm.KycContractAddress
 	args.From = from
 	args.setDefaults(ctx, s.b)
-	inputv := make([]byte, 4+2)
-	input := (hexutil.Bytes)(inputv)
+	inputv := make([]byte, 4+2, 4+2+8)
 	binary.BigEndian.PutUint32(inputv[0:], vm.KycMethodVote)
 	binary.BigEndian.PutUint16(inputv[4:], nay)
+	if id != nil {
+		inputv = inputv[:4+2+8]
+		binary.BigEndian.PutUint64(inputv[6:], uint64(*id))
+	}
+	input := (hexutil.Bytes)(inputv)
 	args.Input = &input
-	return s.SendTransaction(ctx, args)
+	return s.sendKycTransaction(ctx, args)
+}
+
+// CancelKycProviderProposal withdraws the KYC provider proposal id, or the
+// oldest pending one if no id is given.
+func (s *PublicTransactionPoolAPI) CancelKycProviderProposal(ctx context.Context, from common.Address, id *hexutil.Uint64) (common.Hash, error) {
+
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.LatestBlockNumber)
+
+	if state == nil || err != nil {
+		return common.Hash{}, err
+	}
+
+	var args = SendTxArgs{}
+	args.To = &vm.KycContractAddress
+	args.From = from
+	args.setDefaults(ctx, s.b)
+	inputv := make([]byte, 4, 4+8)
+	binary.BigEndian.PutUint32(inputv[0:], vm.KycMethodCancelProposal)
+	if id != nil {
+		inputv = inputv[:4+8]
+		binary.BigEndian.PutUint64(inputv[4:], uint64(*id))
+	}
+	input := (hexutil.Bytes)(inputv)
+	args.Input = &input
+	return s.sendKycTransaction(ctx, args)
 }
 
 //for  dpos
@@ -1471,7 +1995,7 @@ func (s *PublicTransactionPoolAPI) DposRegisterProducer(ctx context.Context, pb
 	binary.BigEndian.PutUint32(inputv[0:], vm.DposMethodRegProds)
 	copy(inputv[4:], vb)
 	args.Input = &input
-	return s.SendTransaction(ctx, args)
+	return s.sendKycTransaction(ctx, args)
 }
 
 func (s *PublicTransactionPoolAPI) DposUnRegisterProducer(ctx context.Context, pb common.Address) (common.Hash, error) {
@@ -1498,7 +2022,7 @@ func (s *PublicTransactionPoolAPI) DposUnRegisterProducer(ctx context.Context, p
 	input := (hexutil.Bytes)(inputv)
 	binary.BigEndian.PutUint32(inputv[0:], vm.DposMethodRmvProds)
 	args.Input = &input
-	return s.SendTransaction(ctx, args)
+	return s.sendKycTransaction(ctx, args)
 }
 
 func (s *PublicTransactionPoolAPI) DposIncreaseStake(ctx context.Context, from common.Address, value *hexutil.Big) (common.Hash, error) {
@@ -1534,7 +2058,7 @@ func (s *PublicTransactionPoolAPI) DposIncreaseStake(ctx context.Context, from c
 	copy(inputv[4:], common.BigToHash(bValue).Bytes())
 	args.Input = &input
 
-	return s.SendTransaction(ctx, args)
+	return s.sendKycTransaction(ctx, args)
 }
 
 func (s *PublicTransactionPoolAPI) DposDecreaseStake(ctx context.Context, from common.Address, value *hexutil.Big) (common.Hash, error) {
@@ -1570,7 +2094,7 @@ func (s *PublicTransactionPoolAPI) DposDecreaseStake(ctx context.Context, from c
 	copy(inputv[4:], common.BigToHash(bValue).Bytes())
 	args.Input = &input
 
-	return s.SendTransaction(ctx, args)
+	return s.sendKycTransaction(ctx, args)
 }
 
 func (s *PublicTransactionPoolAPI) DposVoteForProducer(ctx context.Context, from common.Address, tos []common.Address) (common.Hash, error) {
@@ -1598,7 +2122,64 @@ func (s *PublicTransactionPoolAPI) DposVoteForProducer(ctx context.Context, from
 
 	args.Input = &input
 
-	return s.SendTransaction(ctx, args)
+	return s.sendKycTransaction(ctx, args)
+}
+
+// DposAddVote adds a vote of from for producer, keeping the other producers it
+// votes for.
+func (s *PublicTransactionPoolAPI) DposAddVote(ctx context.Context, from common.Address, producer common.Address) (common.Hash, error) {
+	return s.dposChangeVote(ctx, from, &kycabi.AddVote{Producer: producer})
+}
+
+// DposRemoveVote withdraws the vote of from for producer, keeping the other
+// producers it votes for.
+func (s *PublicTransactionPoolAPI) DposRemoveVote(ctx context.Context, from common.Address, producer common.Address) (common.Hash, error) {
+	return s.dposChangeVote(ctx, from, &kycabi.RemoveVote{Producer: producer})
+}
+
+// DposRegisterProxy registers from as a vote proxy others may delegate their
+// votes to, or unregisters it.
+func (s *PublicTransactionPoolAPI) DposRegisterProxy(ctx context.Context, from common.Address, unregister bool) (common.Hash, error) {
+	return s.dposChangeVote(ctx, from, &kycabi.RegisterProxy{Unregister: unregister})
+}
+
+// DposSetProxy delegates the votes of from to proxy, replacing the producers it
+// votes for. The zero address revokes the delegation.
+func (s *PublicTransactionPoolAPI) DposSetProxy(ctx context.Context, from common.Address, proxy common.Address) (common.Hash, error) {
+	return s.dposChangeVote(ctx, from, &kycabi.SetProxy{Proxy: proxy})
+}
+
+// DposSetLocation sets the country or region the producer from operates from,
+// an ISO 3166-1 numeric code.
+func (s *PublicTransactionPoolAPI) DposSetLocation(ctx context.Context, from common.Address, location common.ProducerLocation) (common.Hash, error) {
+	if location > common.MaxProducerLocation {
+		return common.Hash{}, fmt.Errorf("invalid ISO 3166-1 numeric code %d", location)
+	}
+	return s.dposChangeVote(ctx, from, &kycabi.SetLocation{Location: location})
+}
+
+// DposSetAutoRefund opts from in or out of having its matured refunds paid out
+// at the end of a block without claiming them.
+func (s *PublicTransactionPoolAPI) DposSetAutoRefund(ctx context.Context, from common.Address, enable bool) (common.Hash, error) {
+	return s.dposChangeVote(ctx, from, &kycabi.SetAutoRefund{Disable: !enable})
+}
+
+// DposSetSigningKey hands the sealing of the blocks of the producer from over to
+// key, from the next producer list checkpoint on. The zero address restores the
+// own key of the producer.
+func (s *PublicTransactionPoolAPI) DposSetSigningKey(ctx context.Context, from common.Address, key common.Address) (common.Hash, error) {
+	return s.dposChangeVote(ctx, from, &kycabi.SetSigningKey{Key: key})
+}
+
+// dposChangeVote sends a transaction from from making the given change to its votes.
+func (s *PublicTransactionPoolAPI) dposChangeVote(ctx context.Context, from common.Address, call kycabi.Call) (common.Hash, error) {
+	if s.b.ChainConfig().Dpos == nil {
+		return common.Hash{}, fmt.Errorf("This not a DPOS network")
+	}
+	input := hexutil.Bytes(call.Pack())
+
+	args := SendTxArgs{From: from, To: &vm.KycContractAddress, Input: &input}
+	return s.sendKycTransaction(ctx, args)
 }
 
 func (s *PublicTransactionPoolAPI) DposRefund(ctx context.Context, from common.Address) (common.Hash, error) {
@@ -1618,8 +2199,8 @@ func (s *PublicTransactionPoolAPI) DposRefund(ctx context.Context, from common.A
 		return common.Hash{}, errors.New(`stake is less or equal zero`)
 	}
 
-	if requestTime.Int64()+86400*3 > time.Now().Unix() {
-		days := float64(requestTime.Int64()+86400*3-time.Now().Unix()) / float64(86400)
+	if requestTime.Int64()+vm.DposRefundDelay > time.Now().Unix() {
+		days := float64(requestTime.Int64()+vm.DposRefundDelay-time.Now().Unix()) / float64(86400)
 		return common.Hash{}, errors.New(fmt.Sprintf(`stake can not be refund within 3 days, %f days left.`, days))
 	}
 
@@ -1634,6 +2215,20 @@ func (s *PublicTransactionPoolAPI) DposRefund(ctx context.Context, from common.A
 
 	args.Input = &input
 
+	return s.sendKycTransaction(ctx, args)
+}
+
+// sendKycTransaction sends a transaction calling the KYC precompile, bound to
+// the chain once the network allows it.
+func (s *PublicTransactionPoolAPI) sendKycTransaction(ctx context.Context, args SendTxArgs) (common.Hash, error) {
+	config := s.b.ChainConfig()
+	next := new(big.Int).Add(s.b.CurrentBlock().Number(), common.Big1)
+
+	if args.Input != nil && len(*args.Input) >= 4 && config.IsKycChainBinding(next) {
+		input := hexutil.Bytes(vm.BindKycInput(*args.Input, config.ChainId))
+		args.Input = &input
+		args.Gas = nil // estimated again for the bound input
+	}
 	return s.SendTransaction(ctx, args)
 }
 
@@ -0,0 +1,786 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-ethereum library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package wonapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"math/big"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/common/hexutil"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/core/vm/kycabi"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rlp"
+	"github.com/worldopennetwork/go-won/rpc"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// testBackend is a Backend serving calls on top of a single in-memory state. Any
+// method not needed to execute calls panics.
+type testBackend struct {
+	Backend
+	config  *params.ChainConfig // chain config to report, params.TestChainConfig if nil
+	statedb *state.StateDB
+	header  *types.Header
+}
+
+func (b *testBackend) ChainConfig() *params.ChainConfig {
+	if b.config != nil {
+		return b.config
+	}
+	return params.TestChainConfig
+}
+func (b *testBackend) FixedPrice() *big.Int { return new(big.Int) }
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
+	return b.header, nil
+}
+
+func (b *testBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	return b.statedb.Copy(), b.header, nil
+}
+
+func (b *testBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmCfg vm.Config, strict bool) (*vm.EVM, func() error, error) {
+	context := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		GetHash:     func(uint64) common.Hash { return common.Hash{} },
+		Origin:      msg.From(),
+		GasPrice:    msg.GasPrice(),
+		BlockNumber: header.Number,
+		Time:        header.Time,
+		Difficulty:  header.Difficulty,
+		GasLimit:    header.GasLimit,
+	}
+	return vm.NewEVM(context, state, b.ChainConfig(), vmCfg), func() error { return nil }, nil
+}
+
+// newTesterKycAPI creates a blockchain API on top of a state with a registered
+// KYC provider, verifying the given accounts, and funding the sender.
+func newTesterKycAPI(t *testing.T, sender common.Address, verified ...common.Address) *rpc.Client {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	provider := common.Address{0xff}
+	statedb.AddKycProvider(provider)
+	for _, addr := range verified {
+		statedb.SetKycProvider(addr, provider)
+		statedb.SetKycLevel(addr, 1)
+	}
+	statedb.AddBalance(sender, new(big.Int).Mul(big.NewInt(params.WON), big.NewInt(1000)))
+
+	backend := &testBackend{
+		statedb: statedb,
+		header:  &types.Header{Number: big.NewInt(1), Time: big.NewInt(1), Difficulty: big.NewInt(1), GasLimit: 8000000},
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("won", NewPublicBlockChainAPI(backend)); err != nil {
+		t.Fatalf("failed to register API: %v", err)
+	}
+	return rpc.DialInProc(server)
+}
+
+// Tests that calls and gas estimations rejected by the KYC checks return a
+// structured error naming the account that is not KYC verified.
+func TestCallKycRejection(t *testing.T) {
+	sender, recipient := common.Address{0x01}, common.Address{0x02}
+
+	tests := []struct {
+		verified []common.Address
+		failure  *core.KycError
+	}{
+		{nil, &core.KycError{Address: sender}},
+		{[]common.Address{sender}, &core.KycError{Address: recipient, Recipient: true}},
+		{[]common.Address{recipient}, &core.KycError{Address: sender}},
+		{[]common.Address{sender, recipient}, nil},
+	}
+	for i, tt := range tests {
+		client := newTesterKycAPI(t, sender, tt.verified...)
+
+		args := map[string]interface{}{
+			"from":  sender,
+			"to":    recipient,
+			"value": (*hexutil.Big)(big.NewInt(params.WON)),
+			"gas":   hexutil.Uint64(100000),
+		}
+		for _, method := range []string{"won_call", "won_estimateGas"} {
+			var result interface{}
+
+			params := []interface{}{args}
+			if method == "won_call" {
+				params = append(params, "latest")
+			}
+			err := client.Call(&result, method, params...)
+			if tt.failure == nil {
+				if err != nil {
+					t.Errorf("test %d: %s: failed to execute verified call: %v", i, method, err)
+				}
+				continue
+			}
+			if err == nil {
+				t.Errorf("test %d: %s: unverified call succeeded", i, method)
+				continue
+			}
+			if have := err.Error(); have != tt.failure.Error() {
+				t.Errorf("test %d: %s: error message mismatch: have %q, want %q", i, method, have, tt.failure.Error())
+			}
+			if have := err.(rpc.Error).ErrorCode(); have != kycErrorCode {
+				t.Errorf("test %d: %s: error code mismatch: have %d, want %d", i, method, have, kycErrorCode)
+			}
+			want := map[string]interface{}{"address": tt.failure.Address.Hex(), "recipient": tt.failure.Recipient}
+			if have := err.(rpc.DataError).ErrorData(); !reflect.DeepEqual(have, want) {
+				t.Errorf("test %d: %s: error data mismatch: have %v, want %v", i, method, have, want)
+			}
+		}
+		client.Close()
+	}
+}
+
+// Tests that calls and gas estimations failed by the KYC precompile return a
+// structured error carrying the reason code of the failure.
+func TestCallPrecompileFailure(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	provider, user := common.Address{0xff}, common.Address{0x01}
+	statedb.AddKycProvider(provider)
+	statedb.SetKycProvider(user, provider)
+	statedb.SetKycLevel(user, 1)
+	for _, addr := range []common.Address{provider, user} {
+		statedb.AddBalance(addr, new(big.Int).Mul(big.NewInt(params.WON), big.NewInt(1000)))
+	}
+	config := *params.TestChainConfig
+	config.KycProposalCancelBlock = big.NewInt(0)
+	config.KycSetBatchBlock = big.NewInt(0)
+	config.KycThresholdQueryBlock = big.NewInt(0)
+	config.KycProviderInfoBlock = big.NewInt(0)
+	backend := &testBackend{
+		config:  &config,
+		statedb: statedb,
+		header:  &types.Header{Number: big.NewInt(1), Time: big.NewInt(1), Difficulty: big.NewInt(1), GasLimit: 8000000},
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("won", NewPublicBlockChainAPI(backend)); err != nil {
+		t.Fatalf("failed to register API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	tests := []struct {
+		from      common.Address
+		data      []byte
+		activated bool
+		reason    string
+	}{
+		{user, (&kycabi.SetKyc{Address: user, Level: 2}).Pack(), false, "KYC_NOT_PROVIDER"},
+		{provider, (&kycabi.SetKyc{Address: user, Level: 2}).Pack()[:24], false, "KYC_INVALID_INPUT"},
+		{provider, (&kycabi.CancelProposal{}).Pack(), false, "KYC_UNKNOWN_PROPOSAL"},
+		{provider, []byte{0xff, 0xff, 0xff, 0xff}, false, "KYC_UNKNOWN_METHOD"},
+		{user, (&kycabi.AddStake{Value: new(big.Int)}).Pack(), false, "STAKE_INVALID"},
+		{user, (&kycabi.SubStake{Value: big.NewInt(1)}).Pack(), false, "STAKE_NOT_ACTIVATED"},
+		{user, (&kycabi.SubStake{Value: big.NewInt(1)}).Pack(), true, "STAKE_BELOW_REFUND"},
+		{user, (&kycabi.Refund{}).Pack(), false, "REFUND_NOT_DUE"},
+	}
+	for i, tt := range tests {
+		if tt.activated {
+			statedb.SetDposTotalActivatedStake(vm.DposActivatedStakeThreshold)
+		} else {
+			statedb.SetDposTotalActivatedStake(new(big.Int))
+		}
+		args := map[string]interface{}{
+			"from": tt.from,
+			"to":   vm.KycContractAddress,
+			"data": hexutil.Bytes(tt.data),
+			"gas":  hexutil.Uint64(100000),
+		}
+		for _, method := range []string{"won_call", "won_estimateGas"} {
+			var result interface{}
+
+			params := []interface{}{args}
+			if method == "won_call" {
+				params = append(params, "latest")
+			}
+			err := client.Call(&result, method, params...)
+			if err == nil {
+				t.Errorf("test %d: %s: failing call succeeded", i, method)
+				continue
+			}
+			if have := err.(rpc.Error).ErrorCode(); have != precompileErrorCode {
+				t.Errorf("test %d: %s: error code mismatch: have %d, want %d", i, method, have, precompileErrorCode)
+			}
+			want := map[string]interface{}{"reason": tt.reason}
+			if have := err.(rpc.DataError).ErrorData(); !reflect.DeepEqual(have, want) {
+				t.Errorf("test %d: %s: error data mismatch: have %v, want %v", i, method, have, want)
+			}
+		}
+	}
+}
+
+// Tests that the open KYC provider proposal is reported along with its tally,
+// and that there is none to report once it expired.
+func TestGetKycProposal(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	providers := []common.Address{{0xf1}, {0xf2}, {0xf3}, {0xf4}}
+	for _, provider := range providers {
+		statedb.AddKycProvider(provider)
+	}
+	candidate := common.Address{0x01}
+	id, _ := statedb.SetKycProviderProposol(candidate, big.NewInt(1000), big.NewInt(vm.KycProposalAddProvider))
+	statedb.SetVoteForKycProviderProposol(id, providers[0], 0)
+	statedb.SetVoteForKycProviderProposol(id, providers[1], 1)
+
+	backend := &testBackend{
+		statedb: statedb,
+		header:  &types.Header{Number: big.NewInt(1), Time: big.NewInt(2000), Difficulty: big.NewInt(1), GasLimit: 8000000},
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("won", NewPublicBlockChainAPI(backend)); err != nil {
+		t.Fatalf("failed to register API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	var proposal map[string]interface{}
+	if err := client.Call(&proposal, "won_getKycProposal", "0x1"); err != nil {
+		t.Fatalf("failed to retrieve proposal: %v", err)
+	}
+	want := map[string]interface{}{
+		"id":           "0x0",
+		"candidate":    strings.ToLower(candidate.Hex()),
+		"proposalType": "0x1",
+		"startTime":    hexutil.EncodeUint64(1000),
+		"totalVoters":  "0x4",
+		"yesVotes":     "0x1",
+		"noVotes":      "0x1",
+		"expiresAt":    hexutil.EncodeUint64(1000 + vm.KycProposalLifetime),
+		"passed":       false,
+	}
+	if !reflect.DeepEqual(proposal, want) {
+		t.Errorf("proposal mismatch:\nhave %v\nwant %v", proposal, want)
+	}
+	// Once the voting window closed, there's no proposal to report
+	backend.header.Time = big.NewInt(1000 + vm.KycProposalLifetime)
+
+	proposal = nil
+	if err := client.Call(&proposal, "won_getKycProposal", "latest"); err != nil {
+		t.Fatalf("failed to retrieve expired proposal: %v", err)
+	}
+	if proposal != nil {
+		t.Errorf("expired proposal reported: %v", proposal)
+	}
+}
+
+// historyBackend is a Backend serving the state of every block from a list.
+type historyBackend struct {
+	testBackend
+	states []*state.StateDB
+}
+
+func (b *historyBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	number := int64(blockNr)
+	if blockNr == rpc.LatestBlockNumber || blockNr == rpc.PendingBlockNumber {
+		number = int64(len(b.states) - 1)
+	}
+	if number >= int64(len(b.states)) {
+		return nil, nil, nil
+	}
+	return b.states[number].Copy(), &types.Header{Number: big.NewInt(number)}, nil
+}
+
+// Tests that the KYC providers are reported as of the requested block, as an
+// empty list rather than null where there are none.
+func TestGetKycProviderList(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		first  = common.Address{0xf1}
+		second = common.Address{0xf2}
+		third  = common.Address{0xf3}
+	)
+	// Change the provider set block by block, keeping the state of each block
+	backend := new(historyBackend)
+	for _, change := range []func(){
+		func() {},
+		func() { statedb.AddKycProvider(first) },
+		func() {
+			statedb.AddKycProvider(second)
+			statedb.AddKycProvider(third)
+			info, _ := rlp.EncodeToBytes(&common.KycProviderInfo{Name: "Second"})
+			statedb.SetKycProviderInfo(second, info)
+		},
+		func() { statedb.RemoveKycProvider(second) },
+	} {
+		change()
+		root, _ := statedb.Commit(true)
+		statedb, _ = state.New(root, statedb.Database())
+		backend.states = append(backend.states, statedb.Copy())
+	}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("won", NewPublicBlockChainAPI(backend)); err != nil {
+		t.Fatalf("failed to register API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	tests := []struct {
+		number string
+		want   []common.Address
+	}{
+		{"0x0", []common.Address{}},
+		{"0x1", []common.Address{first}},
+		{"0x2", []common.Address{first, second, third}},
+		{"0x3", []common.Address{first, third}},
+		{"latest", []common.Address{first, third}},
+	}
+	for _, tt := range tests {
+		var raw json.RawMessage
+		if err := client.Call(&raw, "won_getKycProviderList", tt.number); err != nil {
+			t.Fatalf("block %s: failed to retrieve providers: %v", tt.number, err)
+		}
+		var providers []common.Address
+		if err := json.Unmarshal(raw, &providers); err != nil || providers == nil || !reflect.DeepEqual(providers, tt.want) {
+			t.Errorf("block %s: provider list mismatch: have %s, want %x", tt.number, raw, tt.want)
+		}
+		var count hexutil.Uint64
+		if err := client.Call(&count, "won_getKycProviderCount", tt.number); err != nil || int(count) != len(tt.want) {
+			t.Errorf("block %s: provider count mismatch: have %d (%v), want %d", tt.number, count, err, len(tt.want))
+		}
+		var infos []*common.KycProviderInfo
+		if err := client.Call(&infos, "won_getKycProviders", tt.number); err != nil || len(infos) != len(tt.want) {
+			t.Fatalf("block %s: provider info count mismatch: have %d (%v), want %d", tt.number, len(infos), err, len(tt.want))
+		}
+		for i, info := range infos {
+			if info.Address != tt.want[i] {
+				t.Errorf("block %s, provider %d: info address mismatch: have %x, want %x", tt.number, i, info.Address, tt.want[i])
+			}
+			if name := map[common.Address]string{second: "Second"}[info.Address]; info.Name != name {
+				t.Errorf("block %s, provider %d: info name mismatch: have %q, want %q", tt.number, i, info.Name, name)
+			}
+		}
+	}
+}
+
+// Tests that the staking stats aggregate the individual DPoS getters.
+func TestGetStakingStats(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	producers := []common.Address{{0x01}, {0x02}, {0x03}}
+	for _, producer := range producers {
+		producer := producer
+		statedb.RegisterProducer(&producer, "https://producer.example")
+	}
+	statedb.UpdateProducerActive(&producers[1], false)
+	statedb.SetDposTotalActivatedStake(big.NewInt(1000))
+	statedb.SetDposThreshActivatedStakeTime(big.NewInt(2000))
+	statedb.SetDposTotalProducerWeight(big.NewInt(3000))
+	statedb.SetDposLastProducerScheduleUpdateTime(big.NewInt(4000))
+
+	config := *params.TestChainConfig
+	config.Clique, config.Dpos = nil, &params.DposConfig{Period: 15}
+	backend := &testBackend{
+		config:  &config,
+		statedb: statedb,
+		header:  &types.Header{Number: big.NewInt(1), Time: big.NewInt(5000), Difficulty: big.NewInt(1), GasLimit: 8000000},
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("won", NewPublicBlockChainAPI(backend)); err != nil {
+		t.Fatalf("failed to register API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	var stats map[string]interface{}
+	if err := client.Call(&stats, "won_getStakingStats", "latest"); err != nil {
+		t.Fatalf("failed to retrieve staking stats: %v", err)
+	}
+	want := map[string]interface{}{
+		"totalActivatedStake":     hexutil.EncodeBig(statedb.GetDposTotalActivatedStake()),
+		"activationThreshold":     hexutil.EncodeBig(vm.DposActivatedStakeThreshold),
+		"activationTime":          hexutil.EncodeBig(statedb.GetDposThreshActivatedStakeTime()),
+		"totalProducerVoteWeight": hexutil.EncodeBig(statedb.GetDposTotalProducerWeight()),
+		"producerCount":           hexutil.EncodeBig(statedb.GetDposProducerCount()),
+		"activeProducerCount":     hexutil.EncodeUint64(uint64(len(statedb.GetProducerList(0, 3)))),
+		"lastScheduleUpdateTime":  hexutil.EncodeBig(statedb.GetDposLastProducerScheduleUpdateTime()),
+	}
+	if !reflect.DeepEqual(stats, want) {
+		t.Errorf("staking stats mismatch:\nhave %v\nwant %v", stats, want)
+	}
+	if have := stats["activeProducerCount"]; have != "0x2" {
+		t.Errorf("active producer count mismatch: have %v, want 0x2", have)
+	}
+	// Networks without DPoS have no staking to report
+	backend.config = nil
+	if err := client.Call(&stats, "won_getStakingStats", "latest"); err == nil {
+		t.Errorf("staking stats reported without DPoS")
+	}
+}
+
+// Tests that the refund info reports the maturity of a pending refund relative
+// to the queried block, flipping to claimable exactly once the lock expired.
+func TestGetRefundInfo(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	requester, idle := common.Address{0x01}, common.Address{0x02}
+	statedb.SetRefundRequestInfo(&requester, big.NewInt(1000), big.NewInt(5000))
+	statedb.SetDposAutoRefund(&requester, true)
+
+	config := *params.TestChainConfig
+	config.Clique, config.Dpos = nil, &params.DposConfig{Period: 15}
+	backend := &testBackend{
+		config:  &config,
+		statedb: statedb,
+		header:  &types.Header{Number: big.NewInt(1), Difficulty: big.NewInt(1), GasLimit: 8000000},
+	}
+	server := rpc.NewServer()
+	if err := server.RegisterName("won", NewPublicBlockChainAPI(backend)); err != nil {
+		t.Fatalf("failed to register API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	claim := hexutil.Encode((&kycabi.Refund{}).Pack())
+	tests := []struct {
+		addr      common.Address
+		time      int64
+		claimable bool
+	}{
+		{requester, 5000, false},
+		{requester, 5000 + vm.DposRefundDelay, false},
+		{requester, 5000 + vm.DposRefundDelay + 1, true},
+		{idle, 5000 + vm.DposRefundDelay + 1, false},
+	}
+	for i, tt := range tests {
+		backend.header.Time = big.NewInt(tt.time)
+
+		var info map[string]interface{}
+		if err := client.Call(&info, "won_getRefundInfo", tt.addr, "latest"); err != nil {
+			t.Fatalf("test %d: failed to retrieve refund info: %v", i, err)
+		}
+		want := map[string]interface{}{
+			"amount":       "0x0",
+			"requestedAt":  "0x0",
+			"matureAt":     nil,
+			"claimableNow": tt.claimable,
+			"claimInput":   claim,
+			"autoRefund":   tt.addr == requester,
+		}
+		if tt.addr == requester {
+			want["amount"] = hexutil.EncodeUint64(1000)
+			want["requestedAt"] = hexutil.EncodeUint64(5000)
+			want["matureAt"] = hexutil.EncodeUint64(5000 + vm.DposRefundDelay + 1)
+		}
+		if !reflect.DeepEqual(info, want) {
+			t.Errorf("test %d: refund info mismatch:\nhave %v\nwant %v", i, info, want)
+		}
+	}
+	// Networks without DPoS have no refunds to report
+	backend.config = nil
+	var info map[string]interface{}
+	if err := client.Call(&info, "won_getRefundInfo", requester, "latest"); err == nil {
+		t.Errorf("refund info reported without DPoS")
+	}
+}
+
+// priceBackend is a Backend with a fixed gas price pricing the KYC governance
+// calls apart. Any method not needed to fill in transactions panics.
+type priceBackend struct {
+	Backend
+	fixed, governance *big.Int
+}
+
+func (b *priceBackend) FixedPrice() *big.Int { return b.fixed }
+
+func (b *priceBackend) SuggestPriceFor(ctx context.Context, tx *types.Transaction) (*big.Int, error) {
+	return b.governance, nil
+}
+
+func (b *priceBackend) GetPoolNonce(ctx context.Context, addr common.Address) (uint64, error) {
+	return 0, nil
+}
+
+// Tests that unpriced calls of the KYC precompile are filled in with the price
+// of the governance policy, and all others with the fixed price.
+func TestSetDefaultsGovernancePrice(t *testing.T) {
+	var (
+		backend   = &priceBackend{fixed: big.NewInt(10), governance: new(big.Int)}
+		kyc       = vm.KycContractAddress
+		recipient = common.Address{0x01}
+		input     = hexutil.Bytes(kycabi.NewTx(0, 0, nil, &kycabi.RegisterProducer{URL: "won://producer"}).Data())
+	)
+	tests := []struct {
+		to       *common.Address
+		gasPrice *hexutil.Big
+		want     *big.Int
+	}{
+		{&kyc, nil, backend.governance},
+		{&kyc, (*hexutil.Big)(big.NewInt(5)), backend.fixed},
+		{&recipient, nil, backend.fixed},
+	}
+	for i, tt := range tests {
+		args := &SendTxArgs{To: tt.to, GasPrice: tt.gasPrice, Data: &input}
+		if err := args.setDefaults(context.Background(), backend); err != nil {
+			t.Fatalf("test %d: failed to fill in defaults: %v", i, err)
+		}
+		if have := args.GasPrice.ToInt(); have.Cmp(tt.want) != 0 {
+			t.Errorf("test %d: gas price mismatch: have %v, want %v", i, have, tt.want)
+		}
+	}
+}
+
+// Tests that the gas estimate of every method of the KYC precompile is what the
+// call uses, that the call succeeds with the same outcome on the estimate and
+// not on any less, and that failing calls are reported with their reason rather
+// than as running out of gas.
+func TestEstimateGasPrecompile(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	var (
+		providers = []common.Address{{0xf1}, {0xf2}, {0xf3}, {0xf4}}
+		user      = common.Address{0x01}
+		voter     = common.Address{0x02}
+		refunder  = common.Address{0x03}
+		proxy     = common.Address{0x04}
+		candidate = common.Address{0x05}
+		funds     = new(big.Int).Mul(big.NewInt(params.WON), big.NewInt(1000))
+		stake     = new(big.Int).Mul(big.NewInt(params.WON), big.NewInt(100))
+		now       = int64(vm.DposRefundDelay + 1000)
+	)
+	verify := func(addr common.Address) {
+		statedb.SetKycProvider(addr, providers[0])
+		statedb.SetKycLevel(addr, 1)
+		statedb.AddBalance(addr, funds)
+	}
+	for _, provider := range providers {
+		statedb.AddKycProvider(provider)
+		statedb.AddBalance(provider, funds)
+	}
+	for _, addr := range []common.Address{user, voter, refunder, proxy} {
+		verify(addr)
+	}
+	// A full slate of producers, the first one voted for
+	producers := make([]common.Address, 30)
+	for i := range producers {
+		producers[i] = common.BigToAddress(big.NewInt(int64(0x1000 + i)))
+		verify(producers[i])
+		statedb.RegisterProducer(&producers[i], "https://producer.example")
+		statedb.UpdateProducerActive(&producers[i], true)
+	}
+	statedb.SetDposTotalActivatedStake(vm.DposActivatedStakeThreshold)
+	statedb.SetVoterStaking(&voter, stake)
+	statedb.SetVoterProducers(&voter, producers[:1])
+	statedb.SetRefundRequestInfo(&refunder, stake, big.NewInt(1))
+	statedb.AddBalance(vm.KycContractAddress, new(big.Int).Mul(stake, big.NewInt(2)))
+
+	// A proxy with delegators to release, and an open provider proposal
+	statedb.SetDposProxy(&proxy, true)
+	for i := 0; i < 10; i++ {
+		delegator := common.BigToAddress(big.NewInt(int64(0x2000 + i)))
+		verify(delegator)
+		statedb.SetVoterProxy(&delegator, proxy)
+	}
+	id, _ := statedb.SetKycProviderProposol(candidate, big.NewInt(now), big.NewInt(vm.KycProposalAddProvider))
+	statedb.SetVoteForKycProviderProposol(id, providers[0], 0)
+
+	config := *params.TestChainConfig
+	config.KycProposalQueueBlock = big.NewInt(0)
+	config.KycProposalCancelBlock = big.NewInt(0)
+	config.KycSetBatchBlock = big.NewInt(0)
+	config.KycThresholdQueryBlock = big.NewInt(0)
+	config.KycProviderInfoBlock = big.NewInt(0)
+	config.DposVoteChangeBlock = big.NewInt(0)
+	config.DposProxyBlock = big.NewInt(0)
+	config.DposLocationBlock = big.NewInt(0)
+	config.DposAutoRefundBlock = big.NewInt(0)
+	config.DposSigningKeyBlock = big.NewInt(0)
+	backend := &testBackend{
+		config:  &config,
+		statedb: statedb,
+		header:  &types.Header{Number: big.NewInt(1), Time: big.NewInt(now), Difficulty: big.NewInt(1), GasLimit: 8000000},
+	}
+	api := NewPublicBlockChainAPI(backend)
+
+	batch := new(kycabi.SetKycBatch)
+	for i := 0; i < 20; i++ {
+		batch.Entries = append(batch.Entries, kycabi.SetKyc{Address: common.BigToAddress(big.NewInt(int64(0x3000 + i))), Level: 1})
+	}
+	tests := []struct {
+		from   common.Address
+		data   []byte
+		reason string
+	}{
+		{providers[0], (&kycabi.SetKyc{Address: user, Level: 2}).Pack(), ""},
+		{providers[1], (&kycabi.Proposal{Subject: common.Address{0x06}, Type: vm.KycProposalAddProvider}).Pack(), ""},
+		{providers[1], (&kycabi.ProposalVote{}).Pack(), ""},
+		{user, (&kycabi.RegisterProducer{URL: "https://user.example"}).Pack(), ""},
+		{producers[0], (&kycabi.UnregisterProducer{}).Pack(), ""},
+		{voter, (&kycabi.AddStake{Value: big.NewInt(params.WON)}).Pack(), ""},
+		{voter, (&kycabi.SubStake{Value: big.NewInt(params.WON)}).Pack(), ""},
+		{voter, (&kycabi.VoteProducers{Producers: producers}).Pack(), ""},
+		{refunder, (&kycabi.Refund{}).Pack(), ""},
+		{providers[0], (&kycabi.CancelProposal{}).Pack(), ""},
+		{providers[0], batch.Pack(), ""},
+		{user, []byte{0, 0, 0, vm.KycMethodGetLevelThresholds}, ""},
+		{user, append([]byte{0, 0, 0, vm.KycMethodGetProviderInfo}, providers[0].Bytes()...), ""},
+		{voter, (&kycabi.AddVote{Producer: producers[1]}).Pack(), ""},
+		{voter, (&kycabi.RemoveVote{Producer: producers[0]}).Pack(), ""},
+		{proxy, (&kycabi.RegisterProxy{Unregister: true}).Pack(), ""},
+		{voter, (&kycabi.SetProxy{Proxy: proxy}).Pack(), ""},
+		{producers[0], (&kycabi.SetLocation{Location: 840}).Pack(), ""},
+		{refunder, (&kycabi.SetAutoRefund{}).Pack(), ""},
+
+		// Failures are reported with their reason, whatever the allowance
+		{providers[2], (&kycabi.CancelProposal{}).Pack(), "KYC_NOT_PROPOSER"},
+		{voter, (&kycabi.AddVote{Producer: user}).Pack(), "VOTE_INVALID_PRODUCER"},
+		{voter, (&kycabi.SetProxy{Proxy: user}).Pack(), "PROXY_NOT_REGISTERED"},
+		{user, (&kycabi.SubStake{Value: big.NewInt(1)}).Pack(), "STAKE_BELOW_REFUND"},
+	}
+	ctx := context.Background()
+	for i, tt := range tests {
+		args := CallArgs{
+			From: tt.from,
+			To:   &vm.KycContractAddress,
+			Gas:  hexutil.Uint64(backend.header.GasLimit),
+			Data: tt.data,
+		}
+		estimate, err := api.EstimateGas(ctx, args)
+		if tt.reason != "" {
+			if err == nil {
+				t.Errorf("test %d: failing call estimated at %d", i, estimate)
+				continue
+			}
+			want := map[string]interface{}{"reason": tt.reason}
+			if have := err.(rpc.DataError).ErrorData(); !reflect.DeepEqual(have, want) {
+				t.Errorf("test %d: error data mismatch: have %v, want %v", i, have, want)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: failed to estimate gas: %v", i, err)
+			continue
+		}
+		// Execute the call on the full allowance, the estimate and less
+		call := func(gas uint64) ([]byte, uint64, error) {
+			args.Gas = hexutil.Uint64(gas)
+			res, used, reason, err := api.doCall(ctx, args, rpc.PendingBlockNumber, vm.Config{}, 0)
+			if err == nil && reason != nil {
+				err = reason
+			}
+			return res, used, err
+		}
+		want, used, err := call(backend.header.GasLimit)
+		if err != nil {
+			t.Errorf("test %d: failed to execute call: %v", i, err)
+			continue
+		}
+		if margin := used / 100; uint64(estimate) < used || uint64(estimate) > used+margin {
+			t.Errorf("test %d: estimate off the gas used: have %d, want %d", i, estimate, used)
+		}
+		if have, _, err := call(uint64(estimate)); err != nil || !bytes.Equal(have, want) {
+			t.Errorf("test %d: call on the estimate mismatch: have %x (%v), want %x", i, have, err, want)
+		}
+		if have, _, err := call(uint64(estimate) - 1); err == nil && bytes.Equal(have, want) {
+			t.Errorf("test %d: call below the estimate succeeded", i)
+		}
+	}
+}
+
+// Tests that transactions calling the KYC precompile are marshalled along with
+// the decoded method and arguments of their input.
+func TestRPCTransactionDecodedInput(t *testing.T) {
+	id := uint64(3)
+	tests := []struct {
+		input []byte
+		want  string
+	}{
+		{(&kycabi.SetKyc{Address: common.Address{1}, Level: 2, Zone: 3, ExpiresAt: 4}).Pack(),
+			`{"method":"setKyc","params":{"address":"0x0100000000000000000000000000000000000000","level":2,"zone":3,"expiresAt":4}}`},
+		{(&kycabi.SetKycBatch{Entries: []kycabi.SetKyc{{Address: common.Address{1}, Level: 2}}}).Pack(),
+			`{"method":"setKycBatch","params":{"entries":[{"address":"0x0100000000000000000000000000000000000000","level":2,"zone":0,"expiresAt":0}]}}`},
+		{mustPackProposal(t, common.Address{1}, 1, &common.KycProviderInfo{Name: "provider"}),
+			`{"method":"proposal","params":{"subject":"0x0100000000000000000000000000000000000000","type":1,"info":{"address":"0x0000000000000000000000000000000000000000","name":"provider","jurisdiction":"","url":""}}}`},
+		{(&kycabi.ProposalVote{Nay: true, ID: &id}).Pack(), `{"method":"vote","params":{"nay":true,"id":3}}`},
+		{(&kycabi.CancelProposal{}).Pack(), `{"method":"cancelProposal","params":{"id":null}}`},
+		{(&kycabi.RegisterProducer{URL: "http://producer"}).Pack(), `{"method":"registerProducer","params":{"url":"http://producer"}}`},
+		{(&kycabi.UnregisterProducer{}).Pack(), `{"method":"unregisterProducer","params":{}}`},
+		{(&kycabi.AddStake{Value: big.NewInt(1000)}).Pack(), `{"method":"addStake","params":{"value":1000}}`},
+		{(&kycabi.SubStake{Value: big.NewInt(1000)}).Pack(), `{"method":"subStake","params":{"value":1000}}`},
+		{(&kycabi.VoteProducers{Producers: []common.Address{{1}}}).Pack(),
+			`{"method":"voteProducers","params":{"producers":["0x0100000000000000000000000000000000000000"]}}`},
+		{(&kycabi.Refund{}).Pack(), `{"method":"refund","params":{}}`},
+		{(&kycabi.AddVote{Producer: common.Address{1}}).Pack(), `{"method":"addVote","params":{"producer":"0x0100000000000000000000000000000000000000"}}`},
+		{(&kycabi.RemoveVote{Producer: common.Address{1}}).Pack(), `{"method":"removeVote","params":{"producer":"0x0100000000000000000000000000000000000000"}}`},
+		{(&kycabi.RegisterProxy{Unregister: true}).Pack(), `{"method":"registerProxy","params":{"unregister":true}}`},
+		{(&kycabi.SetProxy{Proxy: common.Address{1}}).Pack(), `{"method":"setProxy","params":{"proxy":"0x0100000000000000000000000000000000000000"}}`},
+		{(&kycabi.SetLocation{Location: 276}).Pack(), `{"method":"setLocation","params":{"location":276}}`},
+		{(&kycabi.SetAutoRefund{Disable: true}).Pack(), `{"method":"setAutoRefund","params":{"disable":true}}`},
+		{(&kycabi.SetSigningKey{Key: common.Address{1}}).Pack(), `{"method":"setSigningKey","params":{"key":"0x0100000000000000000000000000000000000000"}}`},
+
+		// Read methods carry no decodable call, unknown or short ids no method
+		{[]byte{0, 0, 0, vm.KycMethodGetLevelThresholds}, `{"method":"getLevelThresholds"}`},
+		{[]byte{0, 0, 0, vm.KycMethodGetProviderInfo}, `{"method":"getProviderInfo"}`},
+		{[]byte{0, 0, 0, 0xff}, `{"method":"unknown"}`},
+		{[]byte{0xff}, `{"method":"unknown"}`},
+	}
+	for i, tt := range tests {
+		tx := types.NewTransaction(0, vm.KycContractAddress, new(big.Int), 0, new(big.Int), tt.input)
+		blob, err := json.Marshal(newRPCPendingTransaction(tx))
+		if err != nil {
+			t.Fatalf("test %d: failed to marshal transaction: %v", i, err)
+		}
+		var fields map[string]json.RawMessage
+		if err := json.Unmarshal(blob, &fields); err != nil {
+			t.Fatalf("test %d: failed to unmarshal transaction: %v", i, err)
+		}
+		if have := string(fields["decodedInput"]); have != tt.want {
+			t.Errorf("test %d: decoded input mismatch:\nhave %s\nwant %s", i, have, tt.want)
+		}
+	}
+	// Transactions not calling the precompile carry no decoded input
+	for _, tx := range []*types.Transaction{
+		types.NewTransaction(0, common.Address{1}, new(big.Int), 0, new(big.Int), (&kycabi.Refund{}).Pack()),
+		types.NewTransaction(0, vm.KycContractAddress, big.NewInt(1), 0, new(big.Int), nil),
+	} {
+		blob, _ := json.Marshal(newRPCPendingTransaction(tx))
+		if bytes.Contains(blob, []byte("decodedInput")) {
+			t.Errorf("transaction to %x with input %x decoded: %s", tx.To(), tx.Data(), blob)
+		}
+	}
+}
+
+func mustPackProposal(t *testing.T, subject common.Address, pt uint64, info *common.KycProviderInfo) []byte {
+	input, err := kycabi.PackProposal(subject, pt, info)
+	if err != nil {
+		t.Fatalf("failed to pack proposal: %v", err)
+	}
+	return input
+}
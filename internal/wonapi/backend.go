@@ -41,6 +41,7 @@ type Backend interface {
 	Downloader() *downloader.Downloader
 	ProtocolVersion() int
 	SuggestPrice(ctx context.Context) (*big.Int, error)
+	SuggestPriceFor(ctx context.Context, tx *types.Transaction) (*big.Int, error)
 	FixedPrice() *big.Int
 	ChainDb() wondb.Database
 	EventMux() *event.TypeMux
@@ -54,7 +55,7 @@ type Backend interface {
 	GetBlock(ctx context.Context, blockHash common.Hash) (*types.Block, error)
 	GetReceipts(ctx context.Context, blockHash common.Hash) (types.Receipts, error)
 	GetTd(blockHash common.Hash) *big.Int
-	GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmCfg vm.Config) (*vm.EVM, func() error, error)
+	GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmCfg vm.Config, strict bool) (*vm.EVM, func() error, error)
 	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
 	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
 	SubscribeChainSideEvent(ch chan<- core.ChainSideEvent) event.Subscription
@@ -74,7 +75,7 @@ type Backend interface {
 
 func GetAPIs(apiBackend Backend) []rpc.API {
 	nonceLock := new(AddrLocker)
-	return []rpc.API{
+	apis := []rpc.API{
 		{
 			Namespace: "won",
 			Version:   "1.0",
@@ -116,4 +117,12 @@ func GetAPIs(apiBackend Backend) []rpc.API {
 			Public:    false,
 		},
 	}
+	if IsDevNetwork(apiBackend.ChainConfig()) {
+		apis = append(apis, rpc.API{
+			Namespace: "admin",
+			Version:   "1.0",
+			Service:   NewPrivateDevAPI(apiBackend, nonceLock),
+		})
+	}
+	return apis
 }
@@ -0,0 +1,89 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package wonapi
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rpc"
+)
+
+var (
+	// errNotDevNetwork is returned if a developer network only method is called
+	// on any other network.
+	errNotDevNetwork = errors.New("not a developer network")
+
+	// errNoLocalProvider is returned if none of the local accounts is a KYC
+	// provider able to sign a governance transaction.
+	errNoLocalProvider = errors.New("no local KYC provider account")
+)
+
+// IsDevNetwork reports whether config marks a single node developer network.
+// The public networks never are, whatever their config says.
+func IsDevNetwork(config *params.ChainConfig) bool {
+	if !config.Developer || config.ChainId == nil {
+		return false
+	}
+	for _, public := range []*params.ChainConfig{params.MainnetChainConfig, params.TestnetChainConfig, params.BetanetChainConfig} {
+		if config.ChainId.Cmp(public.ChainId) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// PrivateDevAPI provides the methods of the admin namespace that are only
+// available on developer networks, to bootstrap their KYC bookkeeping.
+type PrivateDevAPI struct {
+	b   Backend
+	txs *PublicTransactionPoolAPI
+}
+
+// NewPrivateDevAPI creates a new developer network API.
+func NewPrivateDevAPI(b Backend, nonceLock *AddrLocker) *PrivateDevAPI {
+	return &PrivateDevAPI{b: b, txs: NewPublicTransactionPoolAPI(b, nonceLock)}
+}
+
+// AddKycProviderDev sends a governance transaction adding provider to the KYC
+// providers, signed by the first unlocked local account that is a provider
+// itself. While the chain counts less than two providers, the provider is added
+// as soon as the transaction is mined, otherwise it opens a proposal.
+func (s *PrivateDevAPI) AddKycProviderDev(ctx context.Context, provider common.Address, info *common.KycProviderInfo) (common.Hash, error) {
+	if !IsDevNetwork(s.b.ChainConfig()) {
+		return common.Hash{}, errNotDevNetwork
+	}
+	state, _, err := s.b.StateAndHeaderByNumber(ctx, rpc.PendingBlockNumber)
+	if state == nil || err != nil {
+		return common.Hash{}, err
+	}
+	if state.KycProviderExists(provider) {
+		return common.Hash{}, fmt.Errorf("%x is already a KYC provider", provider)
+	}
+	for _, wallet := range s.b.AccountManager().Wallets() {
+		for _, account := range wallet.Accounts() {
+			if state.KycProviderExists(account.Address) {
+				return s.txs.MakeKycProviderModifyProposal(ctx, account.Address, provider, vm.KycProposalAddProvider, info)
+			}
+		}
+	}
+	return common.Hash{}, errNoLocalProvider
+}
@@ -0,0 +1,182 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/common/hexutil"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/internal/wonapi"
+	"github.com/worldopennetwork/go-won/light"
+	"github.com/worldopennetwork/go-won/rpc"
+)
+
+// PublicKycAPI serves the KYC and DPoS state queries of the won namespace to
+// light clients. The KYC contract storage the queries read is retrieved in a
+// few batches of merkle proofs beforehand, instead of one proof per slot read.
+type PublicKycAPI struct {
+	b   wonapi.Backend
+	odr light.OdrBackend
+	api *wonapi.PublicBlockChainAPI
+}
+
+// NewPublicKycAPI creates a new KYC and DPoS state API of a light client.
+func NewPublicKycAPI(b wonapi.Backend, odr light.OdrBackend) *PublicKycAPI {
+	return &PublicKycAPI{b: b, odr: odr, api: wonapi.NewPublicBlockChainAPI(b)}
+}
+
+// header retrieves the header of the given block, or of the latest one if omitted.
+func (api *PublicKycAPI) header(ctx context.Context, blockNr *rpc.BlockNumber) (*types.Header, error) {
+	number := rpc.LatestBlockNumber
+	if blockNr != nil {
+		number = *blockNr
+	}
+	return api.b.HeaderByNumber(ctx, number)
+}
+
+// headerNumber returns the number of header to read its state at.
+func headerNumber(header *types.Header) *rpc.BlockNumber {
+	number := rpc.BlockNumber(header.Number.Int64())
+	return &number
+}
+
+// retrieve ensures the given slots of the KYC contract are available locally in
+// the state of header, returning that state.
+func (api *PublicKycAPI) retrieve(ctx context.Context, header *types.Header, keys ...common.Hash) (*state.StateDB, error) {
+	if err := light.RetrieveStorage(ctx, api.odr, header, vm.KycContractAddress, keys); err != nil {
+		return nil, err
+	}
+	return light.NewState(ctx, header, api.odr), nil
+}
+
+// retrieveProviders ensures the KYC provider list is available locally in the
+// state of header.
+func (api *PublicKycAPI) retrieveProviders(ctx context.Context, header *types.Header) error {
+	statedb, err := api.retrieve(ctx, header, state.KycProviderCountKey())
+	if err != nil {
+		return err
+	}
+	keys := make([]common.Hash, statedb.GetKycProviderCount())
+	for i := range keys {
+		keys[i] = state.KycProviderKey(int64(i))
+	}
+	_, err = api.retrieve(ctx, header, keys...)
+	return err
+}
+
+// GetKycInfo returns the KYC info of address at the given block.
+func (api *PublicKycAPI) GetKycInfo(ctx context.Context, address common.Address, blockNr rpc.BlockNumber) (map[string]interface{}, error) {
+	header, err := api.b.HeaderByNumber(ctx, blockNr)
+	if header == nil || err != nil {
+		return nil, err
+	}
+	if err := api.retrieveProviders(ctx, header); err != nil {
+		return nil, err
+	}
+	// Contracts inherit the KYC info of their creator
+	statedb, err := api.retrieve(ctx, header, state.KycContractCreatorKey(address), state.KycExpiryKey(address))
+	if err != nil {
+		return nil, err
+	}
+	if creator := statedb.GetContractCreator(address); creator != address {
+		if _, err := api.retrieve(ctx, header, state.KycExpiryKey(creator)); err != nil {
+			return nil, err
+		}
+	}
+	return api.api.GetKycInfo(ctx, address, rpc.BlockNumber(header.Number.Int64()))
+}
+
+// GetKycProviderList returns the KYC providers at the given block, or the latest
+// one if omitted.
+func (api *PublicKycAPI) GetKycProviderList(ctx context.Context, blockNr *rpc.BlockNumber) ([]common.Address, error) {
+	header, err := api.header(ctx, blockNr)
+	if header == nil || err != nil {
+		return make([]common.Address, 0), err
+	}
+	if err := api.retrieveProviders(ctx, header); err != nil {
+		return nil, err
+	}
+	return api.api.GetKycProviderList(ctx, headerNumber(header))
+}
+
+// GetKycProviderCount returns the number of KYC providers at the given block, or
+// the latest one if omitted.
+func (api *PublicKycAPI) GetKycProviderCount(ctx context.Context, blockNr *rpc.BlockNumber) (hexutil.Uint64, error) {
+	header, err := api.header(ctx, blockNr)
+	if header == nil || err != nil {
+		return 0, err
+	}
+	if _, err := api.retrieve(ctx, header, state.KycProviderCountKey()); err != nil {
+		return 0, err
+	}
+	return api.api.GetKycProviderCount(ctx, headerNumber(header))
+}
+
+// GetDposProducerList returns up to number active block producers at the given
+// block, or the latest one if omitted, starting at startPos of the producer list.
+func (api *PublicKycAPI) GetDposProducerList(ctx context.Context, startPos int64, number int64, blockNr *rpc.BlockNumber) ([]common.Address, error) {
+	if api.b.ChainConfig().Dpos == nil || startPos < 0 || number <= 0 {
+		return api.api.GetDposProducerList(ctx, startPos, number, blockNr)
+	}
+	header, err := api.header(ctx, blockNr)
+	if header == nil || err != nil {
+		return nil, err
+	}
+	statedb, err := api.retrieve(ctx, header, state.DposProducerCountKey())
+	if err != nil {
+		return nil, err
+	}
+	count := statedb.GetDposProducerCount().Int64()
+
+	var keys []common.Hash
+	for i := startPos; i < count; i++ {
+		keys = append(keys, state.DposProducerKey(i))
+	}
+	if statedb, err = api.retrieve(ctx, header, keys...); err != nil {
+		return nil, err
+	}
+	// Inactive producers are skipped, so the records of all of them are needed
+	keys = keys[:0]
+	for i := startPos; i < count; i++ {
+		producer := common.BytesToAddress(statedb.GetState(vm.KycContractAddress, state.DposProducerKey(i)).Bytes())
+		keys = append(keys, state.DposProducerInfoKeys(producer)...)
+	}
+	if _, err := api.retrieve(ctx, header, keys...); err != nil {
+		return nil, err
+	}
+	return api.api.GetDposProducerList(ctx, startPos, number, headerNumber(header))
+}
+
+// GetDposVoterInfo returns the stake of voter and the producers it voted for at
+// the given block, or the latest one if omitted.
+func (api *PublicKycAPI) GetDposVoterInfo(ctx context.Context, voter common.Address, blockNr *rpc.BlockNumber) (map[string]interface{}, error) {
+	if api.b.ChainConfig().Dpos == nil {
+		return api.api.GetDposVoterInfo(ctx, voter, blockNr)
+	}
+	header, err := api.header(ctx, blockNr)
+	if header == nil || err != nil {
+		return nil, err
+	}
+	if _, err := api.retrieve(ctx, header, state.DposVoterKeys(voter)...); err != nil {
+		return nil, err
+	}
+	return api.api.GetDposVoterInfo(ctx, voter, headerNumber(header))
+}
@@ -95,8 +95,10 @@ func (b *LesApiBackend) GetTd(blockHash common.Hash) *big.Int {
 	return b.won.blockchain.GetTdByHash(blockHash)
 }
 
-func (b *LesApiBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmCfg vm.Config) (*vm.EVM, func() error, error) {
-	state.SetBalance(msg.From(), math.MaxBig256)
+func (b *LesApiBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmCfg vm.Config, strict bool) (*vm.EVM, func() error, error) {
+	if !strict {
+		state.SetBalance(msg.From(), math.MaxBig256)
+	}
 	context := core.NewEVMContext(msg, header, b.won.blockchain, nil)
 	return vm.NewEVM(context, state, b.won.chainConfig, vmCfg), state.Error, nil
 }
@@ -165,6 +167,10 @@ func (b *LesApiBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	return b.gpo.SuggestPrice(ctx)
 }
 
+func (b *LesApiBackend) SuggestPriceFor(ctx context.Context, tx *types.Transaction) (*big.Int, error) {
+	return b.gpo.SuggestPriceFor(ctx, tx)
+}
+
 func (b *LesApiBackend) FixedPrice() *big.Int {
 	return b.gpo.FixedPrice()
 }
@@ -0,0 +1,154 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package les
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/internal/wonapi"
+	"github.com/worldopennetwork/go-won/light"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rpc"
+	"github.com/worldopennetwork/go-won/won"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// countingOdr is a light.OdrBackend counting the storage retrievals it serves.
+type countingOdr struct {
+	*LesOdr
+
+	lock    sync.Mutex
+	batches int // number of batched storage requests
+	slots   int // number of storage slots retrieved one by one
+}
+
+func (odr *countingOdr) Retrieve(ctx context.Context, req light.OdrRequest) error {
+	odr.lock.Lock()
+	switch req := req.(type) {
+	case *light.StorageRequest:
+		odr.batches++
+	case *light.TrieRequest:
+		if len(req.Id.AccKey) > 0 {
+			odr.slots++
+		}
+	}
+	odr.lock.Unlock()
+	return odr.LesOdr.Retrieve(ctx, req)
+}
+
+// lightKycBackend is the wonapi.Backend of a light chain of a DPoS network. Any
+// method not needed by the KYC and DPoS state queries panics.
+type lightKycBackend struct {
+	wonapi.Backend
+	config *params.ChainConfig
+	chain  *light.LightChain
+	odr    light.OdrBackend
+}
+
+func (b *lightKycBackend) ChainConfig() *params.ChainConfig { return b.config }
+
+func (b *lightKycBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
+	return b.chain.CurrentHeader(), nil
+}
+
+func (b *lightKycBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	header := b.chain.CurrentHeader()
+	return light.NewState(ctx, header, b.odr), header, nil
+}
+
+// Tests that a light client retrieves the producer list and the voter records
+// over the light protocol in a few batches, rather than slot by slot.
+func TestKycApiProducerListLes1(t *testing.T) { testKycApiProducerList(t, 1) }
+
+func TestKycApiProducerListLes2(t *testing.T) { testKycApiProducerList(t, 2) }
+
+func testKycApiProducerList(t *testing.T, protocol int) {
+	// Assemble the test environment
+	peers := newPeerSet()
+	dist := newRequestDistributor(peers, make(chan struct{}))
+	rm := newRetrieveManager(peers, dist, nil)
+	db, _ := wondb.NewMemDatabase()
+	ldb, _ := wondb.NewMemDatabase()
+	odr := &countingOdr{LesOdr: NewLesOdr(ldb, light.NewChtIndexer(db, true), light.NewBloomTrieIndexer(db, true), won.NewBloomIndexer(db, light.BloomTrieFrequency), rm)}
+	pm := newTestProtocolManagerMust(t, false, 4, testChainGen, nil, nil, db)
+	lpm := newTestProtocolManagerMust(t, true, 0, nil, peers, odr.LesOdr, ldb)
+	_, err1, lpeer, err2 := newTestPeerPair("peer", protocol, pm, lpm)
+	select {
+	case <-time.After(time.Millisecond * 100):
+	case err := <-err1:
+		t.Fatalf("peer 1 handshake error: %v", err)
+	case err := <-err2:
+		t.Fatalf("peer 1 handshake error: %v", err)
+	}
+	lpm.synchronise(lpeer)
+
+	lpeer.lock.Lock()
+	lpeer.hasBlock = func(common.Hash, uint64) bool { return true }
+	lpeer.lock.Unlock()
+
+	config := *params.TestChainConfig
+	config.Dpos = &params.DposConfig{}
+	api := NewPublicKycAPI(&lightKycBackend{config: &config, chain: lpm.blockchain.(*light.LightChain), odr: odr}, odr)
+
+	// Retrieve the producer list and compare it with the one of the server
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	producers, err := api.GetDposProducerList(ctx, 0, 10, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve producer list: %v", err)
+	}
+	statedb, _ := pm.blockchain.(*core.BlockChain).State()
+	if want := statedb.GetProducerList(0, 10); !reflect.DeepEqual(producers, want) || len(producers) != len(testProducers) {
+		t.Fatalf("producer list mismatch: have %x, want %x", producers, want)
+	}
+	if odr.batches == 0 || odr.batches > 3 || odr.slots != 0 {
+		t.Errorf("retrieval count mismatch: have %d batches and %d slots, want at most 3 batches and no slots", odr.batches, odr.slots)
+	}
+	batches := odr.batches
+	// Retrieve the record of a voter in a single batch
+	voter := testProducers[1].Address
+	info, err := api.GetDposVoterInfo(ctx, voter, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve voter info: %v", err)
+	}
+	if stake := info["staking"].(*big.Int); stake.Cmp(testProducers[1].Stake) != 0 {
+		t.Errorf("voter stake mismatch: have %v, want %v", stake, testProducers[1].Stake)
+	}
+	if votes := info["producers"].([]common.Address); !reflect.DeepEqual(votes, []common.Address{voter}) {
+		t.Errorf("voter votes mismatch: have %x, want %x", votes, voter)
+	}
+	if odr.batches > batches+1 || odr.slots != 0 {
+		t.Errorf("retrieval count mismatch: have %d batches and %d slots, want at most %d batches and no slots", odr.batches, odr.slots, batches+1)
+	}
+	// Without a server, the data already retrieved is still served
+	peers.Unregister(lpeer.id)
+	time.Sleep(time.Millisecond * 10) // ensure that all peerSetNotify callbacks are executed
+
+	if cached, err := api.GetDposProducerList(ctx, 0, 10, nil); err != nil || !reflect.DeepEqual(cached, producers) {
+		t.Errorf("cached producer list mismatch: have %x (%v), want %x", cached, err, producers)
+	}
+}
@@ -192,6 +192,11 @@ func (s *LightEthereum) APIs() []rpc.API {
 			Version:   "1.0",
 			Service:   filters.NewPublicFilterAPI(s.ApiBackend, true),
 			Public:    true,
+		}, {
+			Namespace: "won",
+			Version:   "1.0",
+			Service:   NewPublicKycAPI(s.ApiBackend, s.odr),
+			Public:    true,
 		}, {
 			Namespace: "net",
 			Version:   "1.0",
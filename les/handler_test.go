@@ -17,6 +17,7 @@
 package les
 
 import (
+	"context"
 	"encoding/binary"
 	"math/big"
 	"math/rand"
@@ -26,13 +27,17 @@ import (
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/consensus/ethash"
 	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/state"
 	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
 	"github.com/worldopennetwork/go-won/crypto"
 	"github.com/worldopennetwork/go-won/light"
 	"github.com/worldopennetwork/go-won/p2p"
+	"github.com/worldopennetwork/go-won/p2p/discover"
 	"github.com/worldopennetwork/go-won/params"
 	"github.com/worldopennetwork/go-won/rlp"
 	"github.com/worldopennetwork/go-won/trie"
+	"github.com/worldopennetwork/go-won/won"
 	"github.com/worldopennetwork/go-won/won/downloader"
 	"github.com/worldopennetwork/go-won/wondb"
 )
@@ -578,3 +583,152 @@ func TestTransactionStatusLes2(t *testing.T) {
 	test(tx1, false, txStatus{Status: core.TxStatusPending})
 	test(tx2, false, txStatus{Status: core.TxStatusPending})
 }
+
+// Tests that clients learn from the handshake whether a server serves the KYC
+// and DPoS storage proofs in batches, and only send it such requests if so.
+func TestKycStateHandshakeLes1(t *testing.T) { testKycStateHandshake(t, 1) }
+func TestKycStateHandshakeLes2(t *testing.T) { testKycStateHandshake(t, 2) }
+
+func testKycStateHandshake(t *testing.T, protocol int) {
+	peers := newPeerSet()
+	rm := newRetrieveManager(peers, newRequestDistributor(peers, make(chan struct{})), nil)
+	db, _ := wondb.NewMemDatabase()
+	ldb, _ := wondb.NewMemDatabase()
+	odr := NewLesOdr(ldb, light.NewChtIndexer(db, true), light.NewBloomTrieIndexer(db, true), won.NewBloomIndexer(db, light.BloomTrieFrequency), rm)
+	pm := newTestProtocolManagerMust(t, false, 0, nil, nil, nil, db)
+	lpm := newTestProtocolManagerMust(t, true, 0, nil, peers, odr, ldb)
+
+	var (
+		genesis = pm.blockchain.Genesis()
+		head    = pm.blockchain.CurrentHeader()
+		td      = pm.blockchain.GetTd(head.Hash(), head.Number.Uint64())
+	)
+	// A current server advertises the batched proofs
+	_, err1, server, err2 := newTestPeerPair("server", protocol, pm, lpm)
+	select {
+	case <-time.After(time.Millisecond * 100):
+	case err := <-err1:
+		t.Fatalf("server handshake error: %v", err)
+	case err := <-err2:
+		t.Fatalf("server handshake error: %v", err)
+	}
+	if !server.ServesKycState() {
+		t.Errorf("server not advertising batched KYC state proofs")
+	}
+	// A server predating them doesn't, but is still accepted
+	app, net := p2p.MsgPipe()
+	defer app.Close()
+
+	old := lpm.newPeer(protocol, NetworkId, p2p.NewPeer(discover.NodeID{0x01}, "old", nil), net)
+	errc := make(chan error, 1)
+	go func() { errc <- old.Handshake(td, head.Hash(), head.Number.Uint64(), genesis.Hash(), nil) }()
+
+	msg, err := app.ReadMsg()
+	if err != nil {
+		t.Fatalf("status recv: %v", err)
+	}
+	msg.Discard()
+
+	var status keyValueList
+	status = status.add("protocolVersion", uint64(protocol))
+	status = status.add("networkId", uint64(NetworkId))
+	status = status.add("headTd", td)
+	status = status.add("headHash", head.Hash())
+	status = status.add("headNum", head.Number.Uint64())
+	status = status.add("genesisHash", genesis.Hash())
+	status = status.add("serveHeaders", nil)
+	status = status.add("serveChainSince", uint64(0))
+	status = status.add("serveStateSince", uint64(0))
+	status = status.add("txRelay", nil)
+	status = status.add("flowControl/BL", testBufLimit)
+	status = status.add("flowControl/MRR", uint64(1))
+	status = status.add("flowControl/MRC", testRCL())
+	if err := p2p.Send(app, StatusMsg, status); err != nil {
+		t.Fatalf("status send: %v", err)
+	}
+	if err := <-errc; err != nil {
+		t.Fatalf("old server handshake error: %v", err)
+	}
+	if old.ServesKycState() {
+		t.Errorf("old server reported to serve batched KYC state proofs")
+	}
+	// Batched requests only go to the servers able to answer them
+	old.hasBlock = func(common.Hash, uint64) bool { return true }
+	server.lock.Lock()
+	server.hasBlock = func(common.Hash, uint64) bool { return true }
+	server.lock.Unlock()
+
+	req := &StorageRequest{Id: light.StateTrieID(head), Keys: [][]byte{crypto.Keccak256(common.Hash{}.Bytes())}}
+	if !req.CanSend(server) {
+		t.Errorf("batched request not sendable to current server")
+	}
+	if req.CanSend(old) {
+		t.Errorf("batched request sendable to old server")
+	}
+	mixed := newPeerSet()
+	mixed.Register(old)
+	if mixed.KycStateServed() {
+		t.Errorf("batched KYC state proofs reported served by old server only")
+	}
+	mixed.Register(server)
+	if !mixed.KycStateServed() {
+		t.Errorf("batched KYC state proofs not reported served with a current server")
+	}
+}
+
+// Tests that clients connected only to servers predating the batched KYC and
+// DPoS storage proofs still retrieve the storage, slot by slot.
+func TestKycStateFallbackLes1(t *testing.T) { testKycStateFallback(t, 1) }
+func TestKycStateFallbackLes2(t *testing.T) { testKycStateFallback(t, 2) }
+
+func testKycStateFallback(t *testing.T, protocol int) {
+	peers := newPeerSet()
+	dist := newRequestDistributor(peers, make(chan struct{}))
+	rm := newRetrieveManager(peers, dist, nil)
+	db, _ := wondb.NewMemDatabase()
+	ldb, _ := wondb.NewMemDatabase()
+	odr := NewLesOdr(ldb, light.NewChtIndexer(db, true), light.NewBloomTrieIndexer(db, true), won.NewBloomIndexer(db, light.BloomTrieFrequency), rm)
+	pm := newTestProtocolManagerMust(t, false, 4, testChainGen, nil, nil, db)
+	lpm := newTestProtocolManagerMust(t, true, 0, nil, peers, odr, ldb)
+	_, err1, lpeer, err2 := newTestPeerPair("peer", protocol, pm, lpm)
+	select {
+	case <-time.After(time.Millisecond * 100):
+	case err := <-err1:
+		t.Fatalf("peer 1 handshake error: %v", err)
+	case err := <-err2:
+		t.Fatalf("peer 1 handshake error: %v", err)
+	}
+	lpm.synchronise(lpeer)
+
+	// Pretend the server predates the batched proofs
+	lpeer.lock.Lock()
+	lpeer.hasBlock = func(common.Hash, uint64) bool { return true }
+	lpeer.serveKycState = false
+	lpeer.lock.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	header := lpm.blockchain.(*light.LightChain).CurrentHeader()
+	keys := []common.Hash{state.DposProducerCountKey()}
+	for i := range testProducers {
+		keys = append(keys, state.DposProducerKey(int64(i)))
+	}
+	if err := light.RetrieveStorage(ctx, odr, header, vm.KycContractAddress, keys); err != nil {
+		t.Fatalf("failed to retrieve storage: %v", err)
+	}
+	// All slots must be available locally, even without any server
+	peers.Unregister(lpeer.id)
+	time.Sleep(time.Millisecond * 10) // ensure that all peerSetNotify callbacks are executed
+
+	have := light.NewState(ctx, header, odr)
+	want, _ := pm.blockchain.(*core.BlockChain).State()
+	for _, key := range keys {
+		if h, w := have.GetState(vm.KycContractAddress, key), want.GetState(vm.KycContractAddress, key); h != w {
+			t.Errorf("slot %x mismatch: have %x, want %x", key, h, w)
+		}
+	}
+	if err := have.Error(); err != nil {
+		t.Errorf("failed to read retrieved storage: %v", err)
+	}
+}
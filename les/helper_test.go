@@ -60,6 +60,13 @@ var (
 	testEventEmitterAddr common.Address
 
 	testBufLimit = uint64(100)
+
+	// testProducers are the block producers registered in the genesis block.
+	testProducers = []core.GenesisProducer{
+		{Address: common.Address{0xf1}, URL: "won://producer1", Stake: big.NewInt(params.WON)},
+		{Address: common.Address{0xf2}, URL: "won://producer2", Stake: big.NewInt(2 * params.WON)},
+		{Address: common.Address{0xf3}, URL: "won://producer3", Stake: big.NewInt(3 * params.WON)},
+	}
 )
 
 /*
@@ -142,7 +149,13 @@ func newTestProtocolManager(lightSync bool, blocks int, generator func(int, *cor
 		engine = ethash.NewFaker()
 		gspec  = core.Genesis{
 			Config: params.TestChainConfig,
-			Alloc:  core.GenesisAlloc{testBankAddress: {Balance: testBankFunds}},
+			Alloc: core.GenesisAlloc{
+				testBankAddress:          {Balance: testBankFunds},
+				testProducers[0].Address: {Balance: testProducers[0].Stake},
+				testProducers[1].Address: {Balance: testProducers[1].Stake},
+				testProducers[2].Address: {Balance: testProducers[2].Stake},
+			},
+			Producers: testProducers,
 		}
 		genesis = gspec.MustCommit(db)
 		chain   BlockChain
@@ -304,6 +317,7 @@ func (p *testPeer) handshake(t *testing.T, td *big.Int, head common.Hash, headNu
 	expList = expList.add("serveChainSince", uint64(0))
 	expList = expList.add("serveStateSince", uint64(0))
 	expList = expList.add("txRelay", nil)
+	expList = expList.add("serveKycState", nil)
 	expList = expList.add("flowControl/BL", testBufLimit)
 	expList = expList.add("flowControl/MRR", uint64(1))
 	expList = expList.add("flowControl/MRC", testRCL())
@@ -89,6 +89,10 @@ type Msg struct {
 // Retrieve tries to fetch an object from the LES network.
 // If the network retrieval was successful, it stores the object in local db.
 func (odr *LesOdr) Retrieve(ctx context.Context, req light.OdrRequest) (err error) {
+	// Without servers of batched storage proofs, fall back to retrieving slot by slot
+	if req, ok := req.(*light.StorageRequest); ok && !odr.retriever.peers.KycStateServed() {
+		return odr.retrieveSlots(ctx, req)
+	}
 	lreq := LesRequest(req)
 
 	reqID := genReqID()
@@ -116,3 +120,18 @@ func (odr *LesOdr) Retrieve(ctx context.Context, req light.OdrRequest) (err erro
 	}
 	return
 }
+
+// retrieveSlots retrieves the storage slots of a batched request one by one, for
+// servers not serving batched storage proofs.
+func (odr *LesOdr) retrieveSlots(ctx context.Context, req *light.StorageRequest) error {
+	proof := light.NewNodeSet()
+	for _, key := range req.Keys {
+		r := &light.TrieRequest{Id: req.Id, Key: key}
+		if err := odr.Retrieve(ctx, r); err != nil {
+			return err
+		}
+		r.Proof.Store(proof)
+	}
+	req.Proof = proof
+	return nil
+}
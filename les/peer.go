@@ -72,6 +72,8 @@ type peer struct {
 	hasBlock       func(common.Hash, uint64) bool
 	responseErrors int
 
+	serveKycState bool // Whether the server serves batched KYC/DPoS storage proofs
+
 	fcClient       *flowcontrol.ClientNode // nil if the peer is server only
 	fcServer       *flowcontrol.ServerNode // nil if the peer is client only
 	fcServerParams *flowcontrol.ServerParams
@@ -182,6 +184,14 @@ func (p *peer) HasBlock(hash common.Hash, number uint64) bool {
 	return hasBlock != nil && hasBlock(hash, number)
 }
 
+// ServesKycState checks if the server serves the storage proofs of the KYC and
+// DPoS state in batches.
+func (p *peer) ServesKycState() bool {
+	p.lock.RLock()
+	defer p.lock.RUnlock()
+	return p.serveKycState
+}
+
 // SendAnnounce announces the availability of a number of blocks through
 // a hash notification.
 func (p *peer) SendAnnounce(request announceData) error {
@@ -409,6 +419,7 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 		send = send.add("serveChainSince", uint64(0))
 		send = send.add("serveStateSince", uint64(0))
 		send = send.add("txRelay", nil)
+		send = send.add("serveKycState", nil)
 		send = send.add("flowControl/BL", server.defParams.BufLimit)
 		send = send.add("flowControl/MRR", server.defParams.MinRecharge)
 		list := server.fcCostStats.getCurrentList()
@@ -475,6 +486,8 @@ func (p *peer) Handshake(td *big.Int, head common.Hash, headNum uint64, genesis
 		if recv.get("txRelay", nil) != nil {
 			return errResp(ErrUselessPeer, "peer cannot relay transactions")
 		}
+		// Servers predating the batched KYC/DPoS proofs are still useful, if slower
+		p.serveKycState = recv.get("serveKycState", nil) == nil
 		params := &flowcontrol.ServerParams{}
 		if err := recv.get("flowControl/BL", &params.BufLimit); err != nil {
 			return err
@@ -633,6 +646,20 @@ func (ps *peerSet) BestPeer() *peer {
 	return bestPeer
 }
 
+// KycStateServed checks if any of the known peers serves the storage proofs of
+// the KYC and DPoS state in batches.
+func (ps *peerSet) KycStateServed() bool {
+	ps.lock.RLock()
+	defer ps.lock.RUnlock()
+
+	for _, p := range ps.peers {
+		if p.ServesKycState() {
+			return true
+		}
+	}
+	return false
+}
+
 // AllPeers returns all peers in a list
 func (ps *peerSet) AllPeers() []*peer {
 	ps.lock.RLock()
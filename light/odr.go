@@ -89,6 +89,20 @@ func (req *TrieRequest) StoreResult(db wondb.Database) {
 	req.Proof.Store(db)
 }
 
+// StorageRequest is the ODR request type for retrieving several entries of the
+// same storage trie at once, proven by a single batch of merkle proofs
+type StorageRequest struct {
+	OdrRequest
+	Id    *TrieID  // references storage trie of the account
+	Keys  [][]byte // hashed trie keys of the storage slots
+	Proof *NodeSet
+}
+
+// StoreResult stores the retrieved data in local database
+func (req *StorageRequest) StoreResult(db wondb.Database) {
+	req.Proof.Store(db)
+}
+
 // CodeRequest is the ODR request type for retrieving contract code
 type CodeRequest struct {
 	OdrRequest
@@ -22,13 +22,19 @@ import (
 
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/state"
 	"github.com/worldopennetwork/go-won/core/types"
 	"github.com/worldopennetwork/go-won/crypto"
 	"github.com/worldopennetwork/go-won/rlp"
+	"github.com/worldopennetwork/go-won/trie"
 )
 
 var sha3_nil = crypto.Keccak256Hash(nil)
 
+// storageBatchSize is the maximum number of storage slots retrieved by a single
+// request, matching the number of proofs a LES server serves at once.
+const storageBatchSize = 64
+
 func GetHeaderByNumber(ctx context.Context, odr OdrBackend, number uint64) (*types.Header, error) {
 	db := odr.Database()
 	hash := core.GetCanonicalHash(db, number)
@@ -229,3 +235,45 @@ func GetBloomBits(ctx context.Context, odr OdrBackend, bitIdx uint, sectionIdxLi
 		return result, nil
 	}
 }
+
+// RetrieveStorage ensures the storage slots keys of the account addr are known
+// locally in the state of the given header, so reading them doesn't retrieve
+// the slots one by one. The missing slots are retrieved in batches.
+func RetrieveStorage(ctx context.Context, odr OdrBackend, header *types.Header, addr common.Address, keys []common.Hash) error {
+	id := StateTrieID(header)
+	accounts := &odrTrie{db: &odrDatabase{ctx, id, odr}, id: id}
+
+	enc, err := accounts.TryGet(addr[:])
+	if err != nil || len(enc) == 0 {
+		return err // a missing account has no storage to retrieve
+	}
+	var account state.Account
+	if err := rlp.DecodeBytes(enc, &account); err != nil {
+		return err
+	}
+	// Collect the slots whose proofs are not available yet
+	var missing [][]byte
+
+	local, _ := trie.New(account.Root, trie.NewDatabase(odr.Database()))
+	for _, key := range keys {
+		hashed := crypto.Keccak256(key[:])
+		if local != nil {
+			if _, err := local.TryGet(hashed); err == nil {
+				continue
+			}
+		}
+		missing = append(missing, hashed)
+	}
+	storage := StorageTrieID(id, crypto.Keccak256Hash(addr[:]), account.Root)
+	for len(missing) > 0 {
+		batch := missing
+		if len(batch) > storageBatchSize {
+			batch = batch[:storageBatchSize]
+		}
+		if err := odr.Retrieve(ctx, &StorageRequest{Id: storage, Keys: batch}); err != nil {
+			return err
+		}
+		missing = missing[len(batch):]
+	}
+	return nil
+}
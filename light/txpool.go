@@ -20,6 +20,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"math/big"
 	"sync"
 	"time"
 
@@ -69,7 +70,7 @@ type TxPool struct {
 	mined        map[common.Hash][]*types.Transaction // mined transactions by block hash
 	clearIdx     uint64                               // earliest block nr that can contain mined tx info
 
-	homestead bool
+	gasTable params.GasTable // Gas prices of the next block
 }
 
 // TxRelayBackend provides an interface to the mechanism that forwards transacions
@@ -103,6 +104,7 @@ func NewTxPool(config *params.ChainConfig, chain *LightChain, relay TxRelayBacke
 		chainDb:     chain.Odr().Database(),
 		head:        chain.CurrentHeader().Hash(),
 		clearIdx:    chain.CurrentHeader().Number.Uint64(),
+		gasTable:    config.GasTable(new(big.Int).Add(chain.CurrentHeader().Number, big.NewInt(1))),
 	}
 	// Subscribe events from blockchain
 	pool.chainHeadSub = pool.chain.SubscribeChainHeadEvent(pool.chainHeadCh)
@@ -310,7 +312,7 @@ func (pool *TxPool) setNewHead(head *types.Header) {
 	txc, _ := pool.reorgOnNewHead(ctx, head)
 	m, r := txc.getLists()
 	pool.relay.NewHead(pool.head, m, r)
-	pool.homestead = true //pool.config.IsHomestead(head.Number)
+	pool.gasTable = pool.config.GasTable(new(big.Int).Add(head.Number, big.NewInt(1)))
 	pool.signer = types.MakeSigner(pool.config, head.Number)
 }
 
@@ -388,8 +390,9 @@ func (pool *TxPool) validateTx(ctx context.Context, tx *types.Transaction) error
 		toAddr = *pto
 	}
 
-	if !currentState.TxKycValidate(from, toAddr, tx.Cost()) {
-		return core.ErrTxKycValidateFailed
+	next := new(big.Int).Add(header.Number, big.NewInt(1))
+	if !currentState.TxKycValidate(from, toAddr, tx.Cost(), next, header.Time.Uint64(), pool.config) {
+		return core.ErrKycRequired
 	}
 
 	//for transfer
@@ -404,15 +407,16 @@ func (pool *TxPool) validateTx(ctx context.Context, tx *types.Transaction) error
 			addressTo := common.BytesToAddress(tx.Data()[16:36])
 			hs := common.BytesToHash(tx.Data()[36:])
 			tokenCost := hs.Big()
-			if !currentState.TxKycValidate(from, addressTo, tokenCost) {
-				return core.ErrTxKycValidateFailed
+			if !currentState.TxKycValidate(from, addressTo, tokenCost, next, header.Time.Uint64(), pool.config) {
+				return core.ErrKycRequired
 			}
 		}
 	}
 
-	//check for dpos inc/dec stake the value is in input data
-	if tx.To() != nil && (*tx.To() == vm.KycContractAddress) && len(tx.Data()) == 36 {
-		input := tx.Data()
+	//check for dpos inc/dec stake the value is in input data, chain bound calls
+	//by their arguments alone
+	input, _ := vm.SplitKycInput(tx.Data())
+	if tx.To() != nil && (*tx.To() == vm.KycContractAddress) && len(input) == 36 {
 		funcid := binary.BigEndian.Uint32(input[0:4])
 		value := common.BytesToHash(input[4:]).Big()
 
@@ -429,8 +433,7 @@ func (pool *TxPool) validateTx(ctx context.Context, tx *types.Transaction) error
 			}
 		}
 
-	} else if tx.To() != nil && (*tx.To() == vm.KycContractAddress) && len(tx.Data()) == 32 {
-		input := tx.Data()
+	} else if tx.To() != nil && (*tx.To() == vm.KycContractAddress) && len(input) >= 32 {
 		funcid := binary.BigEndian.Uint32(input[0:4])
 		address := common.BytesToAddress(input[4:24])
 
@@ -443,8 +446,7 @@ func (pool *TxPool) validateTx(ctx context.Context, tx *types.Transaction) error
 		if pd := currentState.GetKycProvider(address); funcid == vm.KycMethodSet && pd != (common.Address{}) && pd != from {
 			return core.ErrKycConflict
 		}
-	} else if tx.To() != nil && (*tx.To() == vm.KycContractAddress) && len(tx.Data()) == 6 {
-		input := tx.Data()
+	} else if tx.To() != nil && (*tx.To() == vm.KycContractAddress) && len(input) >= 6 {
 		funcid := binary.BigEndian.Uint32(input[0:4])
 
 		if funcid == vm.KycMethodVote && currentState.IsContractAddress(from) {
@@ -453,7 +455,7 @@ func (pool *TxPool) validateTx(ctx context.Context, tx *types.Transaction) error
 	}
 
 	// Should supply enough intrinsic gas
-	gas, err := core.IntrinsicGas(tx.Data(), tx.To() == nil, pool.homestead)
+	gas, err := core.IntrinsicGas(tx.Data(), tx.To() == nil, pool.gasTable)
 	if err != nil {
 		return err
 	}
@@ -20,6 +20,7 @@ package miner
 import (
 	"fmt"
 	"sync/atomic"
+	"time"
 
 	"github.com/worldopennetwork/go-won/accounts"
 	"github.com/worldopennetwork/go-won/common"
@@ -124,6 +125,27 @@ func (self *Miner) Stop() {
 	atomic.StoreInt32(&self.shouldStart, 0)
 }
 
+// gracefulSealer is implemented by the consensus engines able to finish the turn
+// of the local producer before sealing stops.
+type gracefulSealer interface {
+	StopSealingGracefully() <-chan struct{}
+}
+
+// StopGraceful stops mining once the local producer sealed the blocks of its
+// current turn, or once timeout passed at the latest, so that stopping doesn't
+// make it miss a slot. Engines not scheduling producer turns stop right away.
+func (self *Miner) StopGraceful(timeout time.Duration) {
+	if sealer, ok := self.engine.(gracefulSealer); ok && self.Mining() {
+		log.Info("Waiting for the producer turn to end", "timeout", common.PrettyDuration(timeout))
+		select {
+		case <-sealer.StopSealingGracefully():
+		case <-time.After(timeout):
+			log.Warn("Producer turn not over, stopping anyway")
+		}
+	}
+	self.Stop()
+}
+
 func (self *Miner) Register(agent Agent) {
 	if self.Mining() {
 		agent.Start()
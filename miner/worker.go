@@ -520,6 +520,10 @@ func (self *worker) commitNewWorkIternal() bool {
 		log.Error("Failed to finalize block for sealing", "err", err)
 		return false
 	}
+	if err := work.state.Error(); err != nil {
+		log.Error("Failed to compute state for sealing", "err", err)
+		return false
+	}
 	// We only care about logging if we're actually mining.
 	if atomic.LoadInt32(&self.mining) == 1 {
 		log.Info("Commit new mining work", "number", work.Block.Number(), "txs", work.tcount, "uncles", len(uncles), "elapsed", common.PrettyDuration(time.Since(tstart)))
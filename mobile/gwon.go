@@ -23,11 +23,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"path/filepath"
+	"sync"
 
 	"github.com/worldopennetwork/go-won/core"
 	"github.com/worldopennetwork/go-won/les"
 	"github.com/worldopennetwork/go-won/node"
 	"github.com/worldopennetwork/go-won/p2p"
+	"github.com/worldopennetwork/go-won/p2p/discover"
 	"github.com/worldopennetwork/go-won/p2p/nat"
 	"github.com/worldopennetwork/go-won/params"
 	whisper "github.com/worldopennetwork/go-won/whisper/whisperv6"
@@ -52,6 +54,11 @@ type NodeConfig struct {
 	// WorldOpenNetworkEnabled specifies whether the node should run the WorldOpenNetwork protocol.
 	WorldOpenNetworkEnabled bool
 
+	// SyncMode is the way the WorldOpenNetwork protocol synchronises the chain: "light"
+	// runs a light client, "fast" and "full" run a full node, which can also serve the
+	// KYC and DPoS state. An empty mode is equivalent to "light".
+	SyncMode string
+
 	// WorldOpenNetworkNetworkID is the network identifier used by the WorldOpenNetwork protocol to
 	// decide if remote peers should be accepted or not.
 	WorldOpenNetworkNetworkID int64 // uint64 in truth, but Java can't handle that...
@@ -80,6 +87,7 @@ var defaultNodeConfig = &NodeConfig{
 	BootstrapNodes:                FoundationBootnodes(),
 	MaxPeers:                      25,
 	WorldOpenNetworkEnabled:       true,
+	SyncMode:                      "light",
 	WorldOpenNetworkNetworkID:     1,
 	WorldOpenNetworkDatabaseCache: 16,
 }
@@ -93,6 +101,9 @@ func NewNodeConfig() *NodeConfig {
 // Node represents a Gwon WorldOpenNetwork node instance.
 type Node struct {
 	node *node.Node
+
+	client     *wonclient.Client // RPC client attached on first use by the KYC and DPoS accessors
+	clientLock sync.Mutex
 }
 
 // NewNode creates and configures a new Gwon node.
@@ -107,6 +118,13 @@ func NewNode(datadir string, config *NodeConfig) (stack *Node, _ error) {
 	if config.BootstrapNodes == nil || config.BootstrapNodes.Size() == 0 {
 		config.BootstrapNodes = defaultNodeConfig.BootstrapNodes
 	}
+	if config.SyncMode == "" {
+		config.SyncMode = defaultNodeConfig.SyncMode
+	}
+	var syncMode downloader.SyncMode
+	if err := syncMode.UnmarshalText([]byte(config.SyncMode)); err != nil {
+		return nil, err
+	}
 	// Create the empty networking stack
 	nodeConf := &node.Config{
 		Name:        clientIdentifier,
@@ -122,6 +140,24 @@ func NewNode(datadir string, config *NodeConfig) (stack *Node, _ error) {
 			MaxPeers:         config.MaxPeers,
 		},
 	}
+	// Full nodes find their peers through the regular discovery protocol, seeded
+	// with the mainnet bootnodes unless custom ones were given
+	if syncMode != downloader.LightSync {
+		nodeConf.P2P.NoDiscovery = false
+		if config.BootstrapNodes == defaultNodeConfig.BootstrapNodes {
+			for _, url := range params.MainnetBootnodes {
+				nodeConf.P2P.BootstrapNodes = append(nodeConf.P2P.BootstrapNodes, discover.MustParseNode(url))
+			}
+		} else {
+			for _, enode := range config.BootstrapNodes.nodes {
+				bootnode, err := discover.ParseNode(enode.String())
+				if err != nil {
+					return nil, fmt.Errorf("invalid bootstrap node: %v", err)
+				}
+				nodeConf.P2P.BootstrapNodes = append(nodeConf.P2P.BootstrapNodes, bootnode)
+			}
+		}
+	}
 	rawStack, err := node.New(nodeConf)
 	if err != nil {
 		return nil, err
@@ -146,21 +182,28 @@ func NewNode(datadir string, config *NodeConfig) (stack *Node, _ error) {
 	if config.WorldOpenNetworkEnabled {
 		ethConf := won.DefaultConfig
 		ethConf.Genesis = genesis
-		ethConf.SyncMode = downloader.LightSync
+		ethConf.SyncMode = syncMode
 		ethConf.NetworkId = uint64(config.WorldOpenNetworkNetworkID)
 		ethConf.DatabaseCache = config.WorldOpenNetworkDatabaseCache
 		if err := rawStack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
-			return les.New(ctx, &ethConf)
+			if syncMode == downloader.LightSync {
+				return les.New(ctx, &ethConf)
+			}
+			return won.New(ctx, &ethConf)
 		}); err != nil {
 			return nil, fmt.Errorf("ethereum init: %v", err)
 		}
 		// If netstats reporting is requested, do it
 		if config.WorldOpenNetworkNetStats != "" {
 			if err := rawStack.Register(func(ctx *node.ServiceContext) (node.Service, error) {
-				var lesServ *les.LightEthereum
+				var (
+					fullServ *won.WorldOpenNetwork
+					lesServ  *les.LightEthereum
+				)
+				ctx.Service(&fullServ)
 				ctx.Service(&lesServ)
 
-				return wonstats.New(config.WorldOpenNetworkNetStats, nil, lesServ)
+				return wonstats.New(config.WorldOpenNetworkNetStats, fullServ, lesServ)
 			}); err != nil {
 				return nil, fmt.Errorf("netstats init: %v", err)
 			}
@@ -174,7 +217,7 @@ func NewNode(datadir string, config *NodeConfig) (stack *Node, _ error) {
 			return nil, fmt.Errorf("whisper init: %v", err)
 		}
 	}
-	return &Node{rawStack}, nil
+	return &Node{node: rawStack}, nil
 }
 
 // Start creates a live P2P node and starts running it.
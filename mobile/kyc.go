@@ -0,0 +1,208 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+// Contains the KYC and DPoS accessors of the node.
+
+package gwon
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/big"
+
+	"github.com/worldopennetwork/go-won"
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/common/hexutil"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/core/vm/kycabi"
+	"github.com/worldopennetwork/go-won/rlp"
+	"github.com/worldopennetwork/go-won/wonclient"
+)
+
+// wonClient returns the RPC client attached to the node, attaching it on first
+// use. The node must be running.
+func (n *Node) wonClient() (*wonclient.Client, error) {
+	n.clientLock.Lock()
+	defer n.clientLock.Unlock()
+
+	if n.client == nil {
+		rpc, err := n.node.Attach()
+		if err != nil {
+			return nil, err
+		}
+		n.client = wonclient.NewClient(rpc)
+	}
+	return n.client, nil
+}
+
+// parseAddress parses a hex encoded address, rejecting anything else.
+func parseAddress(address string) (common.Address, error) {
+	if !common.IsHexAddress(address) {
+		return common.Address{}, fmt.Errorf("invalid address %q", address)
+	}
+	return common.HexToAddress(address), nil
+}
+
+// parseAmount parses a decimal amount of wei.
+func parseAmount(amount string) (*big.Int, error) {
+	value, ok := new(big.Int).SetString(amount, 10)
+	if !ok || value.Sign() <= 0 {
+		return nil, fmt.Errorf("invalid amount %q", amount)
+	}
+	return value, nil
+}
+
+// GetKycLevel returns the KYC level of the hex encoded address at the latest
+// known block.
+func (n *Node) GetKycLevel(address string) (int64, error) {
+	status, err := n.kycStatus(address)
+	if err != nil {
+		return 0, err
+	}
+	return int64(status.Level), nil
+}
+
+// GetKycProvider returns the hex encoded address of the KYC provider which
+// verified the hex encoded address, the zero address if none did.
+func (n *Node) GetKycProvider(address string) (string, error) {
+	status, err := n.kycStatus(address)
+	if err != nil {
+		return "", err
+	}
+	return status.Provider.Hex(), nil
+}
+
+func (n *Node) kycStatus(address string) (*wonclient.KycStatus, error) {
+	addr, err := parseAddress(address)
+	if err != nil {
+		return nil, err
+	}
+	client, err := n.wonClient()
+	if err != nil {
+		return nil, err
+	}
+	return client.KycStatusAt(context.Background(), addr, nil)
+}
+
+// GetProducerCount returns the number of active block producers.
+func (n *Node) GetProducerCount() (int64, error) {
+	client, err := n.wonClient()
+	if err != nil {
+		return 0, err
+	}
+	producers, err := client.ProducerList(context.Background(), 0, math.MaxInt64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(producers)), nil
+}
+
+// GetProducerInfoJSON returns the registration of the block producer at the hex
+// encoded address as a JSON object with the fields address, url, totalVotes (a
+// decimal string), isActive and location (an ISO 3166-1 numeric code).
+func (n *Node) GetProducerInfoJSON(address string) (string, error) {
+	addr, err := parseAddress(address)
+	if err != nil {
+		return "", err
+	}
+	client, err := n.wonClient()
+	if err != nil {
+		return "", err
+	}
+	info, err := client.ProducerInfo(context.Background(), addr)
+	if err != nil {
+		return "", err
+	}
+	blob, err := json.Marshal(map[string]interface{}{
+		"address":    info.Address,
+		"url":        info.URL,
+		"totalVotes": info.TotalVotes.String(),
+		"isActive":   info.Active,
+		"location":   info.Location,
+	})
+	return string(blob), err
+}
+
+// BuildAddStakeTx returns the hex encoded RLP of an unsigned transaction from
+// the hex encoded address staking the decimal amount of wei. The nonce, gas price
+// and gas limit are filled in from the pending state of the node.
+func (n *Node) BuildAddStakeTx(from string, amount string) (string, error) {
+	value, err := parseAmount(amount)
+	if err != nil {
+		return "", err
+	}
+	return n.buildKycTx(from, &kycabi.AddStake{Value: value})
+}
+
+// BuildSubStakeTx returns the hex encoded RLP of an unsigned transaction from
+// the hex encoded address requesting a refund of the decimal amount of wei of
+// its stake, see BuildAddStakeTx.
+func (n *Node) BuildSubStakeTx(from string, amount string) (string, error) {
+	value, err := parseAmount(amount)
+	if err != nil {
+		return "", err
+	}
+	return n.buildKycTx(from, &kycabi.SubStake{Value: value})
+}
+
+// BuildVoteTx returns the hex encoded RLP of an unsigned transaction from the
+// hex encoded address voting for the given producers, see BuildAddStakeTx.
+func (n *Node) BuildVoteTx(from string, producers *Addresses) (string, error) {
+	if producers == nil {
+		producers = NewAddressesEmpty()
+	}
+	return n.buildKycTx(from, &kycabi.VoteProducers{Producers: producers.addresses})
+}
+
+// buildKycTx assembles an unsigned transaction making the given precompile call.
+func (n *Node) buildKycTx(from string, call kycabi.Call) (string, error) {
+	sender, err := parseAddress(from)
+	if err != nil {
+		return "", err
+	}
+	client, err := n.wonClient()
+	if err != nil {
+		return "", err
+	}
+	ctx := context.Background()
+
+	nonce, err := client.PendingNonceAt(ctx, sender)
+	if err != nil {
+		return "", err
+	}
+	gasPrice, err := client.SuggestGasPrice(ctx)
+	if err != nil {
+		return "", err
+	}
+	input := call.Pack()
+	gas, err := client.EstimateGas(ctx, ethereum.CallMsg{From: sender, To: &vm.KycContractAddress, Data: input})
+	if err != nil {
+		return "", err
+	}
+	return encodeTx(types.NewTransaction(nonce, vm.KycContractAddress, new(big.Int), gas, gasPrice, input))
+}
+
+// encodeTx returns the hex encoded RLP of tx.
+func encodeTx(tx *types.Transaction) (string, error) {
+	blob, err := rlp.EncodeToBytes(tx)
+	if err != nil {
+		return "", err
+	}
+	return hexutil.Encode(blob), nil
+}
@@ -0,0 +1,158 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package gwon
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/p2p/discover"
+	"github.com/worldopennetwork/go-won/won"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// bindable reports whether gomobile can bind the given parameter or result type:
+// basic numbers, booleans, strings, byte slices and pointers to the structs and
+// interfaces of this package.
+func bindable(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Bool, reflect.String, reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64, reflect.Float32, reflect.Float64:
+		return true
+	case reflect.Slice:
+		return typ.Elem().Kind() == reflect.Uint8
+	case reflect.Ptr:
+		return typ.Elem().Kind() == reflect.Struct && typ.Elem().PkgPath() == reflect.TypeOf(Node{}).PkgPath()
+	case reflect.Interface:
+		return typ.PkgPath() == reflect.TypeOf(Node{}).PkgPath()
+	}
+	return false
+}
+
+// Tests that the methods of the node satisfy the gomobile type restrictions, so
+// the KYC and DPoS accessors are reachable from Java and ObjC.
+func TestNodeBindable(t *testing.T) {
+	typ := reflect.TypeOf(&Node{})
+	for i := 0; i < typ.NumMethod(); i++ {
+		method := typ.Method(i)
+		for j := 1; j < method.Type.NumIn(); j++ {
+			if in := method.Type.In(j); !bindable(in) {
+				t.Errorf("%s: parameter %d of type %v not bindable", method.Name, j, in)
+			}
+		}
+		switch out := method.Type.NumOut(); {
+		case out > 2:
+			t.Errorf("%s: too many results: %d", method.Name, out)
+		case out == 2 && method.Type.Out(1) != errorType:
+			t.Errorf("%s: second result %v is not an error", method.Name, method.Type.Out(1))
+		}
+		if out := method.Type.NumOut(); out > 0 && method.Type.Out(0) != errorType && !bindable(method.Type.Out(0)) {
+			t.Errorf("%s: result of type %v not bindable", method.Name, method.Type.Out(0))
+		}
+	}
+}
+
+// Tests that malformed arguments are rejected before reaching the node.
+func TestKycArgumentValidation(t *testing.T) {
+	n := new(Node)
+	if _, err := n.GetKycLevel("0x01"); err == nil {
+		t.Errorf("short address accepted")
+	}
+	if _, err := n.GetProducerInfoJSON("not an address"); err == nil {
+		t.Errorf("malformed address accepted")
+	}
+	for _, amount := range []string{"", "0", "-1", "0x10", "1.5"} {
+		if _, err := n.BuildAddStakeTx("0x0000000000000000000000000000000000000001", amount); err == nil {
+			t.Errorf("amount %q accepted", amount)
+		}
+	}
+}
+
+// Tests that a fast-sync node runs a full WorldOpenNetwork service, serving the
+// KYC state of its chain.
+func TestFastSyncNodeKyc(t *testing.T) {
+	datadir, err := ioutil.TempDir("", "gwon-fastsync-")
+	if err != nil {
+		t.Fatalf("failed to create temporary datadir: %v", err)
+	}
+	defer os.RemoveAll(datadir)
+
+	provider := common.HexToAddress("0x00000000000000000000000000000000000000f1")
+	genesis := core.DeveloperGenesisBlock(15, common.Address{})
+	genesis.KycProviders = []common.Address{provider}
+	blob, err := json.Marshal(genesis)
+	if err != nil {
+		t.Fatalf("failed to encode genesis: %v", err)
+	}
+	// Keep discovery local, there is nobody to sync with anyway
+	key, _ := crypto.GenerateKey()
+	bootnode, err := NewEnode(fmt.Sprintf("enode://%x@127.0.0.1:30303", discover.PubkeyID(&key.PublicKey).Bytes()))
+	if err != nil {
+		t.Fatalf("failed to create bootnode: %v", err)
+	}
+	config := NewNodeConfig()
+	config.SyncMode = "fast"
+	config.BootstrapNodes = NewEnodesEmpty()
+	config.BootstrapNodes.Append(bootnode)
+	config.WorldOpenNetworkGenesis = string(blob)
+	config.WorldOpenNetworkNetworkID = 1337
+
+	node, err := NewNode(datadir, config)
+	if err != nil {
+		t.Fatalf("failed to create node: %v", err)
+	}
+	if err := node.Start(); err != nil {
+		t.Fatalf("failed to start node: %v", err)
+	}
+	defer node.Stop()
+
+	var full *won.WorldOpenNetwork
+	if err := node.node.Service(&full); err != nil {
+		t.Fatalf("full WorldOpenNetwork service not running: %v", err)
+	}
+	// The genesis provider attests itself
+	if level, err := node.GetKycLevel(provider.Hex()); err != nil || level != 99999999 {
+		t.Errorf("KYC level mismatch: have %d/%v, want 99999999", level, err)
+	}
+	if verifier, err := node.GetKycProvider(provider.Hex()); err != nil || verifier != provider.Hex() {
+		t.Errorf("KYC provider mismatch: have %s/%v, want %s", verifier, err, provider.Hex())
+	}
+	client, err := node.GetEthereumClient()
+	if err != nil {
+		t.Fatalf("failed to attach client: %v", err)
+	}
+	head, err := client.GetBlockByNumber(NewContext(), -1)
+	if err != nil || head.GetNumber() != 0 {
+		t.Errorf("head block mismatch: have %v/%v, want genesis", head, err)
+	}
+}
+
+// Tests that unknown sync modes are rejected.
+func TestNodeSyncMode(t *testing.T) {
+	config := NewNodeConfig()
+	config.SyncMode = "snap"
+	if _, err := NewNode("", config); err == nil {
+		t.Errorf("unknown sync mode accepted")
+	}
+}
@@ -19,6 +19,7 @@ package params
 import (
 	"fmt"
 	"math/big"
+	"sort"
 
 	"github.com/worldopennetwork/go-won/common"
 )
@@ -74,7 +75,8 @@ var (
 		//	EIP158Block:         big.NewInt(3),
 		//	ByzantiumBlock:      big.NewInt(4),
 		//	ConstantinopleBlock: nil,
-		Clique: &CliqueConfig{Period: 0, Epoch: 30000},
+		Clique:    &CliqueConfig{Period: 0, Epoch: 30000},
+		Developer: true,
 	}
 
 	TestChainConfig = &ChainConfig{
@@ -191,11 +193,45 @@ type ChainConfig struct {
 	//ByzantiumBlock      *big.Int `json:"byzantiumBlock,omitempty"`      // Byzantium switch block (nil = no fork, 0 = already on byzantium)
 	//ConstantinopleBlock *big.Int `json:"constantinopleBlock,omitempty"` // Constantinople switch block (nil = no fork, 0 = already activated)
 
-	CheckForTokenKycBlock *big.Int `json:"checkforTokonKycBlock,omitempty"`
+	CheckForTokenKycBlock       *big.Int `json:"checkforTokonKycBlock,omitempty"`
+	KycReceiptBlock             *big.Int `json:"kycReceiptBlock,omitempty"`             // KYC failure codes in receipts switch block (nil = no fork, 0 = already activated)
+	KycChainBindingBlock        *big.Int `json:"kycChainBindingBlock,omitempty"`        // Chain bound KYC precompile calls switch block (nil = no fork, 0 = already activated)
+	Blake2FBlock                *big.Int `json:"blake2fBlock,omitempty"`                // Blake2b compression and batch ecrecover precompiles switch block (nil = no fork, 0 = already activated)
+	KycDualAttestationBlock     *big.Int `json:"kycDualAttestationBlock,omitempty"`     // Attestations confirmed by a second provider switch block (nil = no fork, 0 = already activated)
+	KycRevocationBlock          *big.Int `json:"kycRevocationBlock,omitempty"`          // Provider scoped attestation revocation switch block (nil = no fork, 0 = already activated)
+	KycPrecompileWhitelistBlock *big.Int `json:"kycPrecompileWhitelistBlock,omitempty"` // Explicit KYC exemption of precompiles switch block (nil = no fork, 0 = already activated)
+	DposCheckpointBlock         *big.Int `json:"dposCheckpointBlock,omitempty"`         // Dpos producer lists checkpointed in epoch headers only switch block (nil = no fork, 0 = already activated)
+	DposSlotAlignmentBlock      *big.Int `json:"dposSlotAlignmentBlock,omitempty"`      // Dpos block timestamps aligned to slot boundaries switch block (nil = no fork, 0 = already activated)
+	KycProposalQueueBlock       *big.Int `json:"kycProposalQueueBlock,omitempty"`       // Several concurrently open KYC provider proposals switch block (nil = no fork, 0 = already activated)
+	KycCallRestrictionBlock     *big.Int `json:"kycCallRestrictionBlock,omitempty"`     // Restricted calls of the KYC precompile switch block (nil = no fork, 0 = already activated)
+	DposVoteLimitBlock          *big.Int `json:"dposVoteLimitBlock,omitempty"`          // Rejected votes for too many producers switch block (nil = no fork, 0 = already activated)
+	KycProposalCancelBlock      *big.Int `json:"kycProposalCancelBlock,omitempty"`      // Cancellation of KYC provider proposals switch block (nil = no fork, 0 = already activated)
+	KycHistoryBlock             *big.Int `json:"kycHistoryBlock,omitempty"`             // Recorded history of KYC changes switch block (nil = no fork, 0 = already activated)
+	KycExpiryBlock              *big.Int `json:"kycExpiryBlock,omitempty"`              // Expiring KYC attestations switch block (nil = no fork, 0 = already activated)
+	KycSetBatchBlock            *big.Int `json:"kycSetBatchBlock,omitempty"`            // Batched KYC attestations switch block (nil = no fork, 0 = already activated)
+	KycContractCreatorBlock     *big.Int `json:"kycContractCreatorBlock,omitempty"`     // Contract creators recorded in the KYC contract switch block (nil = no fork, 0 = already activated)
+	KycZoneProposalBlock        *big.Int `json:"kycZoneProposalBlock,omitempty"`        // Zone restricting KYC provider proposals switch block (nil = no fork, 0 = already activated)
+	KycThresholdQueryBlock      *big.Int `json:"kycThresholdQueryBlock,omitempty"`      // Readable KYC level thresholds switch block (nil = no fork, 0 = already activated)
+	KycProviderInfoBlock        *big.Int `json:"kycProviderInfoBlock,omitempty"`        // KYC provider metadata switch block (nil = no fork, 0 = already activated)
+	KycMinProvidersBlock        *big.Int `json:"kycMinProvidersBlock,omitempty"`        // Minimum number of KYC providers switch block (nil = no fork, 0 = already activated)
+	DposStakeLogBlock           *big.Int `json:"dposStakeLogBlock,omitempty"`           // Dpos staking change logs switch block (nil = no fork, 0 = already activated)
+	DposGasLimitBlock           *big.Int `json:"dposGasLimitBlock,omitempty"`           // Dpos enforced gas limit switch block (nil = no fork, 0 = already activated)
+	DposElectionOrderBlock      *big.Int `json:"dposElectionOrderBlock,omitempty"`      // Dpos election ties broken by address switch block (nil = no fork, 0 = already activated)
+	DposVoteChangeBlock         *big.Int `json:"dposVoteChangeBlock,omitempty"`         // Dpos single vote changes switch block (nil = no fork, 0 = already activated)
+	DposProxyBlock              *big.Int `json:"dposProxyBlock,omitempty"`              // Dpos vote proxies switch block (nil = no fork, 0 = already activated)
+	DposLocationBlock           *big.Int `json:"dposLocationBlock,omitempty"`           // Dpos producer locations switch block (nil = no fork, 0 = already activated)
+	DposAutoRefundBlock         *big.Int `json:"dposAutoRefundBlock,omitempty"`         // Dpos automatic refunds switch block (nil = no fork, 0 = already activated)
+	DposSigningKeyBlock         *big.Int `json:"dposSigningKeyBlock,omitempty"`         // Dpos producer signing keys switch block (nil = no fork, 0 = already activated)
+
+	GasRepricings []GasRepricing `json:"gasRepricings,omitempty"` // Gas price changes, in ascending block order
+
+	Developer bool `json:"developer,omitempty"` // Whether this is a single node developer network
 	// Various consensus engines
 	Ethash *EthashConfig `json:"ethash,omitempty"`
 	Clique *CliqueConfig `json:"clique,omitempty"`
 	Dpos   *DposConfig   `json:"dpos,omitempty"`
+
+	Kyc *KycConfig `json:"kyc,omitempty"`
 }
 
 // EthashConfig is the consensus engine configs for proof-of-work based sealing.
@@ -217,6 +253,20 @@ type DposConfig struct {
 	Epoch             uint64 `json:"epoch"`  // Epoch length to reset votes and checkpoint
 	MaxDposConfirm    uint64 `json:"maxDposConfirm"`
 	ProducerRepetions uint64 `json:"producerRepetions"`
+	EvidenceRetention uint64 `json:"evidenceRetention,omitempty"` // Number of blocks to retain double-sign evidence for
+	SnapshotRetention uint64 `json:"snapshotRetention,omitempty"` // Number of blocks to retain persisted snapshots for
+	GasLimit          uint64 `json:"gasLimit,omitempty"`          // Block gas limit to enforce (0 = miner chosen)
+	GasLimitVoting    bool   `json:"gasLimitVoting,omitempty"`    // Whether producers may move the gas limit within the bound divisor
+	RegionShuffle     bool   `json:"regionShuffle,omitempty"`     // Whether to keep the turns of producers of the same region apart
+
+	MinProducerStake    *big.Int `json:"minProducerStake,omitempty"`    // Minimum self-stake of an active producer (nil = none)
+	RegistrationFee     *big.Int `json:"registrationFee,omitempty"`     // Fee taken from producers when registering (nil = none)
+	BurnRegistrationFee bool     `json:"burnRegistrationFee,omitempty"` // Whether to burn the fee instead of escrowing it until deregistration
+
+	AutoRefundsPerBlock uint64 `json:"autoRefundsPerBlock,omitempty"` // Refund queue entries processed per block (0 = default)
+	KeyRotationGrace    uint64 `json:"keyRotationGrace,omitempty"`    // Blocks after a checkpoint the replaced signing keys still seal for (0 = none)
+	ClockSkew           uint64 `json:"clockSkew,omitempty"`           // Seconds block timestamps may run ahead of the local clock (0 = none)
+	MaxVotes            uint64 `json:"maxVotes,omitempty"`            // Producers a voter may vote for at once (0 = MaxDposVotes)
 }
 
 // String implements the stringer interface, returning the consensus engine details.
@@ -229,6 +279,206 @@ func (c *DposConfig) String() string {
 	return "dpos"
 }
 
+// KycConfig is the governance configuration of the KYC provider registry. A
+// provider proposal passes once its yes votes exceed the quorum fraction of all
+// providers, which defaults to a simple majority.
+type KycConfig struct {
+	QuorumNumerator   uint64 `json:"quorumNumerator"`
+	QuorumDenominator uint64 `json:"quorumDenominator"`
+	HistoryDepth      uint64 `json:"historyDepth,omitempty"`    // Number of KYC changes to retain per address
+	MinProviders      uint64 `json:"minProviders,omitempty"`    // Number of providers that can't be removed
+	PendingLifetime   uint64 `json:"pendingLifetime,omitempty"` // Seconds an attestation awaits its confirmation by a second provider
+
+	LevelThresholds   []KycLevelThreshold `json:"levelThresholds,omitempty"`   // Levels required for large transfers
+	ExemptPrecompiles []common.Address    `json:"exemptPrecompiles,omitempty"` // Precompiles exempt from KYC checks after the whitelist fork
+}
+
+// KycLevelThreshold requires both parties of a transfer of at least Amount to
+// be verified with at least Level.
+type KycLevelThreshold struct {
+	Amount *big.Int `json:"amount"`
+	Level  uint32   `json:"level"`
+}
+
+// DefaultKycHistoryDepth is the number of KYC changes retained per address if
+// the chain doesn't configure it.
+const DefaultKycHistoryDepth = 32
+
+// MaxKycHistoryDepth is the most KYC changes a chain may retain per address,
+// keeping the storage slots of the history of an address clear of the others.
+const MaxKycHistoryDepth = 1024
+
+// DefaultKycPendingLifetime is the number of seconds an attestation awaits its
+// confirmation by a second provider if the chain doesn't configure it.
+const DefaultKycPendingLifetime = 7 * 86400
+
+// KycExemptPrecompiles returns the precompiles transfers from and to which skip
+// the KYC checks once the precompile whitelist fork is active. The KYC contract
+// is exempt regardless.
+func (c *ChainConfig) KycExemptPrecompiles() []common.Address {
+	if c == nil || c.Kyc == nil {
+		return nil
+	}
+	return c.Kyc.ExemptPrecompiles
+}
+
+// KycQuorum returns the fraction of the providers whose yes votes a provider
+// proposal must exceed to pass.
+func (c *ChainConfig) KycQuorum() (uint64, uint64) {
+	if c == nil || c.Kyc == nil || c.Kyc.QuorumDenominator == 0 || c.Kyc.QuorumNumerator >= c.Kyc.QuorumDenominator {
+		return 1, 2
+	}
+	return c.Kyc.QuorumNumerator, c.Kyc.QuorumDenominator
+}
+
+// KycMinProviders returns the number of KYC providers proposals may not remove,
+// which is at least one: without providers, anyone acts as a provider.
+func (c *ChainConfig) KycMinProviders() int64 {
+	if c == nil || c.Kyc == nil || c.Kyc.MinProviders == 0 {
+		return 1
+	}
+	return int64(c.Kyc.MinProviders)
+}
+
+// DposMinProducerStake returns the minimum stake a producer needs to register
+// and stay active, zero if there is none.
+func (c *ChainConfig) DposMinProducerStake() *big.Int {
+	if c == nil || c.Dpos == nil || c.Dpos.MinProducerStake == nil {
+		return new(big.Int)
+	}
+	return c.Dpos.MinProducerStake
+}
+
+// DposRegistrationFee returns the fee producers pay when registering, zero if
+// there is none.
+func (c *ChainConfig) DposRegistrationFee() *big.Int {
+	if c == nil || c.Dpos == nil || c.Dpos.RegistrationFee == nil {
+		return new(big.Int)
+	}
+	return c.Dpos.RegistrationFee
+}
+
+// DposGasLimit returns the block gas limit the dpos producers enforce, zero if
+// the miners choose it, and whether producers may move it within the bound divisor.
+func (c *ChainConfig) DposGasLimit() (uint64, bool) {
+	if c == nil || c.Dpos == nil {
+		return 0, false
+	}
+	return c.Dpos.GasLimit, c.Dpos.GasLimitVoting
+}
+
+// DposBurnRegistrationFee returns whether the registration fees of producers are
+// burnt instead of escrowed until they deregister.
+func (c *ChainConfig) DposBurnRegistrationFee() bool {
+	return c != nil && c.Dpos != nil && c.Dpos.BurnRegistrationFee
+}
+
+// DposRegionShuffle returns whether the turns of producers of the same region
+// are kept apart.
+func (c *ChainConfig) DposRegionShuffle() bool {
+	return c != nil && c.Dpos != nil && c.Dpos.RegionShuffle
+}
+
+// DefaultDposEpoch is the number of blocks between dpos checkpoints if the chain
+// doesn't configure it.
+const DefaultDposEpoch = 30000
+
+// DposEpoch returns the number of blocks between dpos checkpoints, which elect
+// the producers and rotate their signing keys.
+func (c *ChainConfig) DposEpoch() uint64 {
+	if c == nil || c.Dpos == nil || c.Dpos.Epoch == 0 {
+		return DefaultDposEpoch
+	}
+	return c.Dpos.Epoch
+}
+
+// DefaultDposAutoRefundsPerBlock is the number of refund queue entries processed
+// per block if the chain doesn't configure it.
+const DefaultDposAutoRefundsPerBlock = 16
+
+// DposAutoRefundsPerBlock returns the number of refund queue entries processed
+// per block, bounding the work of paying out matured refunds automatically.
+func (c *ChainConfig) DposAutoRefundsPerBlock() uint64 {
+	if c == nil || c.Dpos == nil || c.Dpos.AutoRefundsPerBlock == 0 {
+		return DefaultDposAutoRefundsPerBlock
+	}
+	return c.Dpos.AutoRefundsPerBlock
+}
+
+// MaxDposVotes is the most producers a voter may vote for at once, bounded by
+// the storage slots the KYC contract reserves for the votes of a voter.
+const MaxDposVotes = 30
+
+// DposMaxVotes returns the number of producers a voter may vote for at once.
+// Chains may lower the limit, but not raise it beyond MaxDposVotes.
+func (c *ChainConfig) DposMaxVotes() int {
+	if c == nil || c.Dpos == nil || c.Dpos.MaxVotes == 0 || c.Dpos.MaxVotes > MaxDposVotes {
+		return MaxDposVotes
+	}
+	return int(c.Dpos.MaxVotes)
+}
+
+// KycHistoryDepth returns the number of KYC changes retained per address.
+func (c *ChainConfig) KycHistoryDepth() uint64 {
+	if c == nil || c.Kyc == nil || c.Kyc.HistoryDepth == 0 {
+		return DefaultKycHistoryDepth
+	}
+	return c.Kyc.HistoryDepth
+}
+
+// CheckConfig returns an error if the chain is configured with parameters out of
+// the range they may take.
+func (c *ChainConfig) CheckConfig() error {
+	if c == nil || c.Kyc == nil {
+		return nil
+	}
+	if c.Kyc.HistoryDepth > MaxKycHistoryDepth {
+		return fmt.Errorf("KYC history depth %d exceeds the maximum of %d", c.Kyc.HistoryDepth, MaxKycHistoryDepth)
+	}
+	return nil
+}
+
+// KycPendingLifetime returns the number of seconds an attestation awaits its
+// confirmation by a second provider before it lapses.
+func (c *ChainConfig) KycPendingLifetime() uint64 {
+	if c == nil || c.Kyc == nil || c.Kyc.PendingLifetime == 0 {
+		return DefaultKycPendingLifetime
+	}
+	return c.Kyc.PendingLifetime
+}
+
+// KycRequiredLevel returns the KYC level both parties of a transfer of amount
+// need, which is 1 unless a level threshold requires more.
+func (c *ChainConfig) KycRequiredLevel(amount *big.Int) uint32 {
+	level := uint32(1)
+	if c == nil || c.Kyc == nil {
+		return level
+	}
+	for _, threshold := range c.Kyc.LevelThresholds {
+		if threshold.Amount != nil && amount.Cmp(threshold.Amount) >= 0 && threshold.Level > level {
+			level = threshold.Level
+		}
+	}
+	return level
+}
+
+// KycLevelThresholds returns the configured level thresholds ordered by amount.
+func (c *ChainConfig) KycLevelThresholds() []KycLevelThreshold {
+	thresholds := make([]KycLevelThreshold, 0)
+	if c == nil || c.Kyc == nil {
+		return thresholds
+	}
+	for _, threshold := range c.Kyc.LevelThresholds {
+		if threshold.Amount != nil {
+			thresholds = append(thresholds, threshold)
+		}
+	}
+	sort.SliceStable(thresholds, func(i, j int) bool {
+		return thresholds[i].Amount.Cmp(thresholds[j].Amount) < 0
+	})
+	return thresholds
+}
+
 // String implements the fmt.Stringer interface.
 func (c *ChainConfig) String() string {
 	var engine interface{}
@@ -286,13 +536,216 @@ func (c *ChainConfig) String() string {
 //	return isForked(c.ConstantinopleBlock, num)
 //}
 
-// GasTable returns the gas table corresponding to the current phase (homestead or homestead reprice).
+// IsKycReceipt returns whether num is either equal to the KYC receipt fork block
+// or greater, from which on receipts carry the KYC failure code of transactions.
+func (c *ChainConfig) IsKycReceipt(num *big.Int) bool {
+	return isForked(c.KycReceiptBlock, num)
+}
+
+// IsKycChainBinding returns whether num is either equal to the KYC chain binding
+// fork block or greater, from which on calls of the KYC precompile may be bound
+// to the chain to keep them from being replayed on other networks.
+func (c *ChainConfig) IsKycChainBinding(num *big.Int) bool {
+	return isForked(c.KycChainBindingBlock, num)
+}
+
+// IsBlake2F returns whether num is either equal to the Blake2F fork block or
+// greater, from which on the EIP-152 blake2b compression and the batch ecrecover
+// precompiles are active.
+func (c *ChainConfig) IsBlake2F(num *big.Int) bool {
+	return isForked(c.Blake2FBlock, num)
+}
+
+// IsKycDualAttestation returns whether num is either equal to the KYC dual
+// attestation fork block or greater, from which on attestations only take effect
+// once a second provider confirms them.
+func (c *ChainConfig) IsKycDualAttestation(num *big.Int) bool {
+	return isForked(c.KycDualAttestationBlock, num)
+}
+
+// IsKycRevocation returns whether num is either equal to the KYC revocation fork
+// block or greater, from which on removing a provider, or voting to revoke its
+// attestations, invalidates every attestation it issued before.
+func (c *ChainConfig) IsKycRevocation(num *big.Int) bool {
+	return isForked(c.KycRevocationBlock, num)
+}
+
+// IsKycPrecompileWhitelist returns whether num is either equal to the KYC
+// precompile whitelist fork block or greater, from which on only the KYC
+// contract and the precompiles listed in the KYC config are exempt from the KYC
+// checks of transfers, instead of every active precompile.
+func (c *ChainConfig) IsKycPrecompileWhitelist(num *big.Int) bool {
+	return isForked(c.KycPrecompileWhitelistBlock, num)
+}
+
+// IsDposCheckpoint returns whether num is either equal to the dpos checkpoint
+// fork block or greater, from which on the elected producer list is only
+// carried in epoch headers, checked against the state of their parent, instead
+// of in every header.
+func (c *ChainConfig) IsDposCheckpoint(num *big.Int) bool {
+	return isForked(c.DposCheckpointBlock, num)
+}
+
+// IsDposSlotAlignment returns whether num is either equal to the dpos slot
+// alignment fork block or greater, from which on block timestamps need to fall
+// on the start of a slot, a whole number of block periods after their parent.
+func (c *ChainConfig) IsDposSlotAlignment(num *big.Int) bool {
+	return isForked(c.DposSlotAlignmentBlock, num)
+}
+
+// IsKycProposalQueue returns whether num is either equal to the KYC proposal
+// queue fork block or greater, from which on several provider proposals may be
+// open at once, each voted on by its id, instead of a single one at a time.
+func (c *ChainConfig) IsKycProposalQueue(num *big.Int) bool {
+	return isForked(c.KycProposalQueueBlock, num)
+}
+
+// IsKycCallRestriction returns whether num is either equal to the KYC call
+// restriction fork block or greater, from which on the KYC precompile rejects
+// unknown methods as well as value sent along anything but the staking methods,
+// bare transfers included, and only runs the state changing methods if called
+// by the sender of the transaction directly, outside of static calls.
+func (c *ChainConfig) IsKycCallRestriction(num *big.Int) bool {
+	return isForked(c.KycCallRestrictionBlock, num)
+}
+
+// IsDposVoteLimit returns whether num is either equal to the dpos vote limit fork
+// block or greater, from which on votes for more producers than DposMaxVotes
+// fail, instead of being dropped after the previous vote was already revoked.
+func (c *ChainConfig) IsDposVoteLimit(num *big.Int) bool {
+	return isForked(c.DposVoteLimitBlock, num)
+}
+
+// IsKycProposalCancel returns whether num is either equal to the KYC proposal
+// cancel fork block or greater, from which on provider proposals may be
+// withdrawn by their proposer, or cleaned up by any provider once expired.
+func (c *ChainConfig) IsKycProposalCancel(num *big.Int) bool {
+	return isForked(c.KycProposalCancelBlock, num)
+}
+
+// IsKycHistory returns whether num is either equal to the KYC history fork block
+// or greater, from which on every change of the KYC info of an address is
+// recorded in its history, charging for the storage it takes.
+func (c *ChainConfig) IsKycHistory(num *big.Int) bool {
+	return isForked(c.KycHistoryBlock, num)
+}
+
+// IsKycExpiry returns whether num is either equal to the KYC expiry fork block or
+// greater, from which on attestations may carry the time they expire at, after
+// which the address counts as unverified until a provider renews it.
+func (c *ChainConfig) IsKycExpiry(num *big.Int) bool {
+	return isForked(c.KycExpiryBlock, num)
+}
+
+// IsKycSetBatch returns whether num is either equal to the KYC set batch fork block
+// or greater, from which on providers may set the KYC info of several addresses
+// in one call.
+func (c *ChainConfig) IsKycSetBatch(num *big.Int) bool {
+	return isForked(c.KycSetBatchBlock, num)
+}
+
+// IsKycContractCreator returns whether num is either equal to the KYC contract
+// creator fork block or greater, from which on the human account behind a new
+// contract is recorded in the storage of the KYC contract, instead of the KYC
+// info of its creator being copied onto the contract.
+func (c *ChainConfig) IsKycContractCreator(num *big.Int) bool {
+	return isForked(c.KycContractCreatorBlock, num)
+}
+
+// IsKycZoneProposal returns whether num is either equal to the KYC zone proposal
+// fork block or greater, from which on providers may propose to restrict transfers
+// between a pair of zones, or to allow them again.
+func (c *ChainConfig) IsKycZoneProposal(num *big.Int) bool {
+	return isForked(c.KycZoneProposalBlock, num)
+}
+
+// IsKycThresholdQuery returns whether num is either equal to the KYC threshold
+// query fork block or greater, from which on the KYC level thresholds of the chain
+// may be read through the KYC precompile.
+func (c *ChainConfig) IsKycThresholdQuery(num *big.Int) bool {
+	return isForked(c.KycThresholdQueryBlock, num)
+}
+
+// IsKycProviderInfo returns whether num is either equal to the KYC provider info
+// fork block or greater, from which on proposals to add a provider may carry its
+// metadata, which anyone may read through the KYC precompile.
+func (c *ChainConfig) IsKycProviderInfo(num *big.Int) bool {
+	return isForked(c.KycProviderInfoBlock, num)
+}
+
+// IsKycMinProviders returns whether num is either equal to the KYC min providers
+// fork block or greater, from which on proposals may not remove providers below
+// KycMinProviders.
+func (c *ChainConfig) IsKycMinProviders(num *big.Int) bool {
+	return isForked(c.KycMinProvidersBlock, num)
+}
+
+// IsDposStakeLog returns whether num is either equal to the dpos stake log fork
+// block or greater, from which on staking changes emit logs.
+func (c *ChainConfig) IsDposStakeLog(num *big.Int) bool {
+	return isForked(c.DposStakeLogBlock, num)
+}
+
+// IsDposGasLimit returns whether num is either equal to the dpos gas limit fork
+// block or greater, from which on the producers enforce the configured gas limit
+// policy.
+func (c *ChainConfig) IsDposGasLimit(num *big.Int) bool {
+	return isForked(c.DposGasLimitBlock, num)
+}
+
+// IsDposElectionOrder returns whether num is either equal to the dpos election
+// order fork block or greater, from which on producers with equal votes are
+// elected by ascending address.
+func (c *ChainConfig) IsDposElectionOrder(num *big.Int) bool {
+	return isForked(c.DposElectionOrderBlock, num)
+}
+
+// IsDposVoteChange returns whether num is either equal to the dpos vote change
+// fork block or greater, from which on voters may add or remove a single vote.
+func (c *ChainConfig) IsDposVoteChange(num *big.Int) bool {
+	return isForked(c.DposVoteChangeBlock, num)
+}
+
+// IsDposProxy returns whether num is either equal to the dpos proxy fork block
+// or greater, from which on voters may register as proxies and delegate their
+// votes to them.
+func (c *ChainConfig) IsDposProxy(num *big.Int) bool {
+	return isForked(c.DposProxyBlock, num)
+}
+
+// IsDposLocation returns whether num is either equal to the dpos location fork
+// block or greater, from which on producers may declare their location.
+func (c *ChainConfig) IsDposLocation(num *big.Int) bool {
+	return isForked(c.DposLocationBlock, num)
+}
+
+// IsDposAutoRefund returns whether num is either equal to the dpos auto refund
+// fork block or greater, from which on voters may opt in to having their matured
+// refunds paid out at the end of a block.
+func (c *ChainConfig) IsDposAutoRefund(num *big.Int) bool {
+	return isForked(c.DposAutoRefundBlock, num)
+}
+
+// IsDposSigningKey returns whether num is either equal to the dpos signing key
+// fork block or greater, from which on producers may seal with a key of their own.
+func (c *ChainConfig) IsDposSigningKey(num *big.Int) bool {
+	return isForked(c.DposSigningKeyBlock, num)
+}
+
+// GasTable returns the gas table in effect at block num: the one of the last gas
+// repricing scheduled at or before num, or the homestead one if there is none.
 //
 // The returned GasTable's fields shouldn't, under any circumstances, be changed.
 func (c *ChainConfig) GasTable(num *big.Int) GasTable {
-	//if num == nil {
+	if num == nil {
+		return GasTableHomestead
+	}
+	for i := len(c.GasRepricings) - 1; i >= 0; i-- {
+		if isForked(c.GasRepricings[i].Block, num) {
+			return c.GasRepricings[i].Table
+		}
+	}
 	return GasTableHomestead
-	//}
 	//switch {
 	//case c.IsEIP158(num):
 	//	return GasTableEIP158
@@ -349,6 +802,239 @@ func (c *ChainConfig) checkCompatible(newcfg *ChainConfig, head *big.Int) *Confi
 	//if isForkIncompatible(c.ConstantinopleBlock, newcfg.ConstantinopleBlock, head) {
 	//	return newCompatError("Constantinople fork block", c.ConstantinopleBlock, newcfg.ConstantinopleBlock)
 	//}
+	if isForkIncompatible(c.KycReceiptBlock, newcfg.KycReceiptBlock, head) {
+		return newCompatError("KYC receipt fork block", c.KycReceiptBlock, newcfg.KycReceiptBlock)
+	}
+	if isForkIncompatible(c.KycChainBindingBlock, newcfg.KycChainBindingBlock, head) {
+		return newCompatError("KYC chain binding fork block", c.KycChainBindingBlock, newcfg.KycChainBindingBlock)
+	}
+	if isForkIncompatible(c.Blake2FBlock, newcfg.Blake2FBlock, head) {
+		return newCompatError("Blake2F fork block", c.Blake2FBlock, newcfg.Blake2FBlock)
+	}
+	if isForkIncompatible(c.KycDualAttestationBlock, newcfg.KycDualAttestationBlock, head) {
+		return newCompatError("KYC dual attestation fork block", c.KycDualAttestationBlock, newcfg.KycDualAttestationBlock)
+	}
+	if isForkIncompatible(c.KycRevocationBlock, newcfg.KycRevocationBlock, head) {
+		return newCompatError("KYC revocation fork block", c.KycRevocationBlock, newcfg.KycRevocationBlock)
+	}
+	if isForkIncompatible(c.KycPrecompileWhitelistBlock, newcfg.KycPrecompileWhitelistBlock, head) {
+		return newCompatError("KYC precompile whitelist fork block", c.KycPrecompileWhitelistBlock, newcfg.KycPrecompileWhitelistBlock)
+	}
+	if isForkIncompatible(c.DposCheckpointBlock, newcfg.DposCheckpointBlock, head) {
+		return newCompatError("dpos checkpoint fork block", c.DposCheckpointBlock, newcfg.DposCheckpointBlock)
+	}
+	if isForkIncompatible(c.DposSlotAlignmentBlock, newcfg.DposSlotAlignmentBlock, head) {
+		return newCompatError("dpos slot alignment fork block", c.DposSlotAlignmentBlock, newcfg.DposSlotAlignmentBlock)
+	}
+	if isForkIncompatible(c.KycProposalQueueBlock, newcfg.KycProposalQueueBlock, head) {
+		return newCompatError("KYC proposal queue fork block", c.KycProposalQueueBlock, newcfg.KycProposalQueueBlock)
+	}
+	if isForkIncompatible(c.KycCallRestrictionBlock, newcfg.KycCallRestrictionBlock, head) {
+		return newCompatError("KYC call restriction fork block", c.KycCallRestrictionBlock, newcfg.KycCallRestrictionBlock)
+	}
+	if isForkIncompatible(c.DposVoteLimitBlock, newcfg.DposVoteLimitBlock, head) {
+		return newCompatError("dpos vote limit fork block", c.DposVoteLimitBlock, newcfg.DposVoteLimitBlock)
+	}
+	if isForkIncompatible(c.KycProposalCancelBlock, newcfg.KycProposalCancelBlock, head) {
+		return newCompatError("KYC proposal cancel fork block", c.KycProposalCancelBlock, newcfg.KycProposalCancelBlock)
+	}
+	if isForkIncompatible(c.KycHistoryBlock, newcfg.KycHistoryBlock, head) {
+		return newCompatError("KYC history fork block", c.KycHistoryBlock, newcfg.KycHistoryBlock)
+	}
+	if isForkIncompatible(c.KycExpiryBlock, newcfg.KycExpiryBlock, head) {
+		return newCompatError("KYC expiry fork block", c.KycExpiryBlock, newcfg.KycExpiryBlock)
+	}
+	if isForkIncompatible(c.KycSetBatchBlock, newcfg.KycSetBatchBlock, head) {
+		return newCompatError("KYC set batch fork block", c.KycSetBatchBlock, newcfg.KycSetBatchBlock)
+	}
+	if isForkIncompatible(c.KycContractCreatorBlock, newcfg.KycContractCreatorBlock, head) {
+		return newCompatError("KYC contract creator fork block", c.KycContractCreatorBlock, newcfg.KycContractCreatorBlock)
+	}
+	if isForkIncompatible(c.KycZoneProposalBlock, newcfg.KycZoneProposalBlock, head) {
+		return newCompatError("KYC zone proposal fork block", c.KycZoneProposalBlock, newcfg.KycZoneProposalBlock)
+	}
+	if isForkIncompatible(c.KycThresholdQueryBlock, newcfg.KycThresholdQueryBlock, head) {
+		return newCompatError("KYC threshold query fork block", c.KycThresholdQueryBlock, newcfg.KycThresholdQueryBlock)
+	}
+	if isForkIncompatible(c.KycProviderInfoBlock, newcfg.KycProviderInfoBlock, head) {
+		return newCompatError("KYC provider info fork block", c.KycProviderInfoBlock, newcfg.KycProviderInfoBlock)
+	}
+	if isForkIncompatible(c.KycMinProvidersBlock, newcfg.KycMinProvidersBlock, head) {
+		return newCompatError("KYC min providers fork block", c.KycMinProvidersBlock, newcfg.KycMinProvidersBlock)
+	}
+	if isForkIncompatible(c.DposStakeLogBlock, newcfg.DposStakeLogBlock, head) {
+		return newCompatError("dpos stake log fork block", c.DposStakeLogBlock, newcfg.DposStakeLogBlock)
+	}
+	if isForkIncompatible(c.DposGasLimitBlock, newcfg.DposGasLimitBlock, head) {
+		return newCompatError("dpos gas limit fork block", c.DposGasLimitBlock, newcfg.DposGasLimitBlock)
+	}
+	if isForkIncompatible(c.DposElectionOrderBlock, newcfg.DposElectionOrderBlock, head) {
+		return newCompatError("dpos election order fork block", c.DposElectionOrderBlock, newcfg.DposElectionOrderBlock)
+	}
+	if isForkIncompatible(c.DposVoteChangeBlock, newcfg.DposVoteChangeBlock, head) {
+		return newCompatError("dpos vote change fork block", c.DposVoteChangeBlock, newcfg.DposVoteChangeBlock)
+	}
+	if isForkIncompatible(c.DposProxyBlock, newcfg.DposProxyBlock, head) {
+		return newCompatError("dpos proxy fork block", c.DposProxyBlock, newcfg.DposProxyBlock)
+	}
+	if isForkIncompatible(c.DposLocationBlock, newcfg.DposLocationBlock, head) {
+		return newCompatError("dpos location fork block", c.DposLocationBlock, newcfg.DposLocationBlock)
+	}
+	if isForkIncompatible(c.DposAutoRefundBlock, newcfg.DposAutoRefundBlock, head) {
+		return newCompatError("dpos auto refund fork block", c.DposAutoRefundBlock, newcfg.DposAutoRefundBlock)
+	}
+	if isForkIncompatible(c.DposSigningKeyBlock, newcfg.DposSigningKeyBlock, head) {
+		return newCompatError("dpos signing key fork block", c.DposSigningKeyBlock, newcfg.DposSigningKeyBlock)
+	}
+	// The KYC and dpos parameters apply from genesis on, so changing them
+	// invalidates every block processed under the old ones
+	if head.Sign() > 0 {
+		storedNum, storedDen := c.KycQuorum()
+		nextNum, nextDen := newcfg.KycQuorum()
+		if storedNum != nextNum {
+			return newParamCompatError("KYC quorum numerator", storedNum, nextNum)
+		}
+		if storedDen != nextDen {
+			return newParamCompatError("KYC quorum denominator", storedDen, nextDen)
+		}
+		// the history is only recorded from its fork on, which is scheduled
+		// alike in both configs by now
+		if c.IsKycHistory(head) {
+			if stored, next := c.KycHistoryDepth(), newcfg.KycHistoryDepth(); stored != next {
+				err := newParamCompatError("KYC history depth", stored, next)
+				if c.KycHistoryBlock.Sign() > 0 {
+					err.RewindTo = c.KycHistoryBlock.Uint64() - 1
+				}
+				return err
+			}
+		}
+		// the minimum only holds from its fork on, which is scheduled alike in
+		// both configs by now
+		if c.IsKycMinProviders(head) {
+			if stored, next := c.KycMinProviders(), newcfg.KycMinProviders(); stored != next {
+				err := newParamCompatError("KYC min providers", uint64(stored), uint64(next))
+				if c.KycMinProvidersBlock.Sign() > 0 {
+					err.RewindTo = c.KycMinProvidersBlock.Uint64() - 1
+				}
+				return err
+			}
+		}
+		// attestations only await confirmation from the dual attestation fork
+		// on, which is scheduled alike in both configs by now
+		if c.IsKycDualAttestation(head) {
+			if stored, next := c.KycPendingLifetime(), newcfg.KycPendingLifetime(); stored != next {
+				err := newParamCompatError("KYC pending lifetime", stored, next)
+				if c.KycDualAttestationBlock.Sign() > 0 {
+					err.RewindTo = c.KycDualAttestationBlock.Uint64() - 1
+				}
+				return err
+			}
+		}
+		if err := checkThresholdsCompatible(c.KycLevelThresholds(), newcfg.KycLevelThresholds()); err != nil {
+			return err
+		}
+		// precompiles are only exempt from the whitelist fork on, which is
+		// scheduled alike in both configs by now
+		if c.IsKycPrecompileWhitelist(head) {
+			if err := checkExemptPrecompilesCompatible(c.KycExemptPrecompiles(), newcfg.KycExemptPrecompiles()); err != nil {
+				if c.KycPrecompileWhitelistBlock.Sign() > 0 {
+					err.RewindTo = c.KycPrecompileWhitelistBlock.Uint64() - 1
+				}
+				return err
+			}
+		}
+		if stored, next := c.DposMaxVotes(), newcfg.DposMaxVotes(); stored != next {
+			return newParamCompatError("dpos max votes", uint64(stored), uint64(next))
+		}
+		if stored, next := c.DposMinProducerStake(), newcfg.DposMinProducerStake(); stored.Cmp(next) != 0 {
+			return &ConfigCompatError{What: "dpos min producer stake", StoredConfig: new(big.Int).Set(stored), NewConfig: new(big.Int).Set(next)}
+		}
+		if stored, next := c.DposRegistrationFee(), newcfg.DposRegistrationFee(); stored.Cmp(next) != 0 {
+			return &ConfigCompatError{What: "dpos registration fee", StoredConfig: new(big.Int).Set(stored), NewConfig: new(big.Int).Set(next)}
+		}
+		if stored, next := c.DposBurnRegistrationFee(), newcfg.DposBurnRegistrationFee(); stored != next {
+			return newParamCompatError("dpos registration fee burning", flagParam(stored), flagParam(next))
+		}
+		if stored, next := c.DposRegionShuffle(), newcfg.DposRegionShuffle(); stored != next {
+			return newParamCompatError("dpos region shuffle", flagParam(stored), flagParam(next))
+		}
+		// refunds are only paid out from their fork on, which is scheduled
+		// alike in both configs by now
+		if c.IsDposAutoRefund(head) {
+			if stored, next := c.DposAutoRefundsPerBlock(), newcfg.DposAutoRefundsPerBlock(); stored != next {
+				err := newParamCompatError("dpos auto refunds per block", stored, next)
+				if c.DposAutoRefundBlock.Sign() > 0 {
+					err.RewindTo = c.DposAutoRefundBlock.Uint64() - 1
+				}
+				return err
+			}
+		}
+		// the gas limit policy is only enforced from its fork on, which is
+		// scheduled alike in both configs by now
+		if c.IsDposGasLimit(head) {
+			storedLimit, storedVoting := c.DposGasLimit()
+			nextLimit, nextVoting := newcfg.DposGasLimit()
+
+			var err *ConfigCompatError
+			if storedLimit != nextLimit {
+				err = newParamCompatError("dpos gas limit", storedLimit, nextLimit)
+			} else if storedVoting != nextVoting {
+				err = newParamCompatError("dpos gas limit voting", flagParam(storedVoting), flagParam(nextVoting))
+			}
+			if err != nil {
+				if c.DposGasLimitBlock.Sign() > 0 {
+					err.RewindTo = c.DposGasLimitBlock.Uint64() - 1
+				}
+				return err
+			}
+		}
+	}
+	for i := 0; i < len(c.GasRepricings) || i < len(newcfg.GasRepricings); i++ {
+		var stored, next GasRepricing
+		if i < len(c.GasRepricings) {
+			stored = c.GasRepricings[i]
+		}
+		if i < len(newcfg.GasRepricings) {
+			next = newcfg.GasRepricings[i]
+		}
+		if isForkIncompatible(stored.Block, next.Block, head) {
+			return newCompatError("gas repricing block", stored.Block, next.Block)
+		}
+		if isForked(stored.Block, head) && stored.Table != next.Table {
+			return newCompatError("gas repricing table", stored.Block, next.Block)
+		}
+	}
+	return nil
+}
+
+// checkThresholdsCompatible returns the error for the first KYC level threshold
+// that differs between the stored and the new ones.
+func checkThresholdsCompatible(stored, next []KycLevelThreshold) *ConfigCompatError {
+	if len(stored) != len(next) {
+		return newParamCompatError("KYC level threshold count", uint64(len(stored)), uint64(len(next)))
+	}
+	for i := range stored {
+		if stored[i].Amount.Cmp(next[i].Amount) != 0 {
+			return &ConfigCompatError{What: "KYC level threshold amount", StoredConfig: new(big.Int).Set(stored[i].Amount), NewConfig: new(big.Int).Set(next[i].Amount)}
+		}
+		if stored[i].Level != next[i].Level {
+			return newParamCompatError("KYC level threshold level", uint64(stored[i].Level), uint64(next[i].Level))
+		}
+	}
+	return nil
+}
+
+// checkExemptPrecompilesCompatible returns the error for the first precompile
+// exempt from KYC checks that differs between the stored and the new ones.
+func checkExemptPrecompilesCompatible(stored, next []common.Address) *ConfigCompatError {
+	if len(stored) != len(next) {
+		return newParamCompatError("KYC exempt precompile count", uint64(len(stored)), uint64(len(next)))
+	}
+	for i := range stored {
+		if stored[i] != next[i] {
+			return &ConfigCompatError{What: "KYC exempt precompile", StoredConfig: stored[i].Big(), NewConfig: next[i].Big()}
+		}
+	}
 	return nil
 }
 
@@ -403,6 +1089,21 @@ func newCompatError(what string, storedblock, newblock *big.Int) *ConfigCompatEr
 	return err
 }
 
+// newParamCompatError returns the error for a parameter changed on a chain
+// that was processed under the stored one since genesis.
+func newParamCompatError(what string, stored, next uint64) *ConfigCompatError {
+	return &ConfigCompatError{What: what, StoredConfig: new(big.Int).SetUint64(stored), NewConfig: new(big.Int).SetUint64(next)}
+}
+
+// flagParam converts a boolean parameter into the number compatibility errors
+// report it as.
+func flagParam(flag bool) uint64 {
+	if flag {
+		return 1
+	}
+	return 0
+}
+
 func (err *ConfigCompatError) Error() string {
 	return fmt.Sprintf("mismatching %s in database (have %d, want %d, rewindto %d)", err.What, err.StoredConfig, err.NewConfig, err.RewindTo)
 }
@@ -20,6 +20,8 @@ import (
 	"math/big"
 	"reflect"
 	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
 )
 
 func TestCheckCompatible(t *testing.T) {
@@ -79,3 +81,244 @@ func TestCheckCompatible(t *testing.T) {
 		}
 	}
 }
+
+// Tests that changing the KYC and dpos parameters is incompatible with a chain
+// past the block they apply from, rewinding it to before that one.
+func TestCheckCompatibleParams(t *testing.T) {
+	tests := []struct {
+		stored, new *ChainConfig
+		head        uint64
+		wantErr     *ConfigCompatError
+	}{
+		{stored: &ChainConfig{}, new: &ChainConfig{Kyc: &KycConfig{QuorumNumerator: 1, QuorumDenominator: 2}}, head: 10},
+		{stored: &ChainConfig{}, new: &ChainConfig{Kyc: &KycConfig{QuorumNumerator: 2, QuorumDenominator: 3}}, head: 0},
+		{
+			stored: &ChainConfig{},
+			new:    &ChainConfig{Kyc: &KycConfig{QuorumNumerator: 2, QuorumDenominator: 3}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "KYC quorum numerator",
+				StoredConfig: big.NewInt(1),
+				NewConfig:    big.NewInt(2),
+				RewindTo:     0,
+			},
+		},
+		{
+			stored: &ChainConfig{Kyc: &KycConfig{QuorumNumerator: 1, QuorumDenominator: 3}},
+			new:    &ChainConfig{},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "KYC quorum denominator",
+				StoredConfig: big.NewInt(3),
+				NewConfig:    big.NewInt(2),
+				RewindTo:     0,
+			},
+		},
+		{stored: &ChainConfig{}, new: &ChainConfig{Kyc: &KycConfig{HistoryDepth: DefaultKycHistoryDepth}}, head: 10},
+		{stored: &ChainConfig{}, new: &ChainConfig{Kyc: &KycConfig{HistoryDepth: 8}}, head: 10},
+		{
+			stored: &ChainConfig{KycHistoryBlock: big.NewInt(5)},
+			new:    &ChainConfig{KycHistoryBlock: big.NewInt(5), Kyc: &KycConfig{HistoryDepth: 8}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "KYC history depth",
+				StoredConfig: big.NewInt(DefaultKycHistoryDepth),
+				NewConfig:    big.NewInt(8),
+				RewindTo:     4,
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{RegionShuffle: true}},
+			new:    &ChainConfig{Dpos: &DposConfig{}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "dpos region shuffle",
+				StoredConfig: big.NewInt(1),
+				NewConfig:    big.NewInt(0),
+			},
+		},
+		{
+			stored: &ChainConfig{},
+			new:    &ChainConfig{Dpos: &DposConfig{MinProducerStake: big.NewInt(1000)}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "dpos min producer stake",
+				StoredConfig: big.NewInt(0),
+				NewConfig:    big.NewInt(1000),
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{RegistrationFee: big.NewInt(100)}},
+			new:    &ChainConfig{Dpos: &DposConfig{RegistrationFee: big.NewInt(200)}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "dpos registration fee",
+				StoredConfig: big.NewInt(100),
+				NewConfig:    big.NewInt(200),
+			},
+		},
+		{
+			stored: &ChainConfig{Dpos: &DposConfig{RegistrationFee: big.NewInt(100)}},
+			new:    &ChainConfig{Dpos: &DposConfig{RegistrationFee: big.NewInt(100), BurnRegistrationFee: true}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "dpos registration fee burning",
+				StoredConfig: big.NewInt(0),
+				NewConfig:    big.NewInt(1),
+			},
+		},
+		{stored: &ChainConfig{}, new: &ChainConfig{Dpos: &DposConfig{AutoRefundsPerBlock: 4}}, head: 10},
+		{
+			stored: &ChainConfig{DposAutoRefundBlock: big.NewInt(5)},
+			new:    &ChainConfig{DposAutoRefundBlock: big.NewInt(5), Dpos: &DposConfig{AutoRefundsPerBlock: 4}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "dpos auto refunds per block",
+				StoredConfig: big.NewInt(DefaultDposAutoRefundsPerBlock),
+				NewConfig:    big.NewInt(4),
+				RewindTo:     4,
+			},
+		},
+		{stored: &ChainConfig{}, new: &ChainConfig{Kyc: &KycConfig{ExemptPrecompiles: []common.Address{{0x09}}}}, head: 10},
+		{
+			stored: &ChainConfig{KycPrecompileWhitelistBlock: big.NewInt(5), Kyc: &KycConfig{ExemptPrecompiles: []common.Address{{0x09}}}},
+			new:    &ChainConfig{KycPrecompileWhitelistBlock: big.NewInt(5), Kyc: &KycConfig{ExemptPrecompiles: []common.Address{{0x09}, {0x0a}}}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "KYC exempt precompile count",
+				StoredConfig: big.NewInt(1),
+				NewConfig:    big.NewInt(2),
+				RewindTo:     4,
+			},
+		},
+		{
+			stored: &ChainConfig{KycPrecompileWhitelistBlock: big.NewInt(0), Kyc: &KycConfig{ExemptPrecompiles: []common.Address{{0x09}}}},
+			new:    &ChainConfig{KycPrecompileWhitelistBlock: big.NewInt(0), Kyc: &KycConfig{ExemptPrecompiles: []common.Address{{0x0a}}}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "KYC exempt precompile",
+				StoredConfig: common.Address{0x09}.Big(),
+				NewConfig:    common.Address{0x0a}.Big(),
+			},
+		},
+		{stored: &ChainConfig{}, new: &ChainConfig{Dpos: &DposConfig{GasLimit: 8000000}}, head: 10},
+		{
+			stored: &ChainConfig{DposGasLimitBlock: big.NewInt(5), Dpos: &DposConfig{GasLimit: 8000000}},
+			new:    &ChainConfig{DposGasLimitBlock: big.NewInt(5), Dpos: &DposConfig{GasLimit: 9000000}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "dpos gas limit",
+				StoredConfig: big.NewInt(8000000),
+				NewConfig:    big.NewInt(9000000),
+				RewindTo:     4,
+			},
+		},
+		{
+			stored: &ChainConfig{DposGasLimitBlock: big.NewInt(0), Dpos: &DposConfig{GasLimit: 8000000}},
+			new:    &ChainConfig{DposGasLimitBlock: big.NewInt(0), Dpos: &DposConfig{GasLimit: 8000000, GasLimitVoting: true}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "dpos gas limit voting",
+				StoredConfig: big.NewInt(0),
+				NewConfig:    big.NewInt(1),
+			},
+		},
+		{stored: &ChainConfig{}, new: &ChainConfig{Kyc: &KycConfig{MinProviders: 3}}, head: 10},
+		{
+			stored: &ChainConfig{KycMinProvidersBlock: big.NewInt(5)},
+			new:    &ChainConfig{KycMinProvidersBlock: big.NewInt(5), Kyc: &KycConfig{MinProviders: 3}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "KYC min providers",
+				StoredConfig: big.NewInt(1),
+				NewConfig:    big.NewInt(3),
+				RewindTo:     4,
+			},
+		},
+		{stored: &ChainConfig{}, new: &ChainConfig{Kyc: &KycConfig{PendingLifetime: 100}}, head: 10},
+		{
+			stored: &ChainConfig{KycDualAttestationBlock: big.NewInt(5)},
+			new:    &ChainConfig{KycDualAttestationBlock: big.NewInt(5), Kyc: &KycConfig{PendingLifetime: 100}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "KYC pending lifetime",
+				StoredConfig: big.NewInt(DefaultKycPendingLifetime),
+				NewConfig:    big.NewInt(100),
+				RewindTo:     4,
+			},
+		},
+		{
+			stored: &ChainConfig{Kyc: &KycConfig{LevelThresholds: []KycLevelThreshold{{Amount: big.NewInt(1000), Level: 2}, {Amount: nil, Level: 3}}}},
+			new:    &ChainConfig{Kyc: &KycConfig{LevelThresholds: []KycLevelThreshold{{Amount: big.NewInt(1000), Level: 2}}}},
+			head:   10,
+		},
+		{
+			stored: &ChainConfig{},
+			new:    &ChainConfig{Kyc: &KycConfig{LevelThresholds: []KycLevelThreshold{{Amount: big.NewInt(1000), Level: 2}}}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "KYC level threshold count",
+				StoredConfig: big.NewInt(0),
+				NewConfig:    big.NewInt(1),
+				RewindTo:     0,
+			},
+		},
+		{
+			stored: &ChainConfig{Kyc: &KycConfig{LevelThresholds: []KycLevelThreshold{{Amount: big.NewInt(1000), Level: 2}}}},
+			new:    &ChainConfig{Kyc: &KycConfig{LevelThresholds: []KycLevelThreshold{{Amount: big.NewInt(2000), Level: 2}}}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "KYC level threshold amount",
+				StoredConfig: big.NewInt(1000),
+				NewConfig:    big.NewInt(2000),
+				RewindTo:     0,
+			},
+		},
+		{
+			stored: &ChainConfig{Kyc: &KycConfig{LevelThresholds: []KycLevelThreshold{{Amount: big.NewInt(1000), Level: 2}}}},
+			new:    &ChainConfig{Kyc: &KycConfig{LevelThresholds: []KycLevelThreshold{{Amount: big.NewInt(1000), Level: 3}}}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "KYC level threshold level",
+				StoredConfig: big.NewInt(2),
+				NewConfig:    big.NewInt(3),
+				RewindTo:     0,
+			},
+		},
+		{stored: &ChainConfig{Dpos: &DposConfig{MaxVotes: 40}}, new: &ChainConfig{}, head: 10},
+		{
+			stored: &ChainConfig{},
+			new:    &ChainConfig{Dpos: &DposConfig{MaxVotes: 20}},
+			head:   10,
+			wantErr: &ConfigCompatError{
+				What:         "dpos max votes",
+				StoredConfig: big.NewInt(MaxDposVotes),
+				NewConfig:    big.NewInt(20),
+				RewindTo:     0,
+			},
+		},
+	}
+	for i, tt := range tests {
+		if err := tt.stored.CheckCompatible(tt.new, tt.head); !reflect.DeepEqual(err, tt.wantErr) {
+			t.Errorf("test %d: error mismatch: have %v, want %v", i, err, tt.wantErr)
+		}
+	}
+}
+
+// Tests that parameters out of their range are rejected.
+func TestCheckConfig(t *testing.T) {
+	tests := []struct {
+		config *ChainConfig
+		valid  bool
+	}{
+		{nil, true},
+		{&ChainConfig{}, true},
+		{&ChainConfig{Kyc: &KycConfig{HistoryDepth: MaxKycHistoryDepth}}, true},
+		{&ChainConfig{Kyc: &KycConfig{HistoryDepth: MaxKycHistoryDepth + 1}}, false},
+	}
+	for i, tt := range tests {
+		if err := tt.config.CheckConfig(); (err == nil) != tt.valid {
+			t.Errorf("test %d: validity mismatch: have %v, want valid %v", i, err, tt.valid)
+		}
+	}
+}
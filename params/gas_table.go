@@ -16,22 +16,57 @@
 
 package params
 
+import "math/big"
+
+// GasTable is the set of gas prices in effect for a block, covering the prices
+// this network changed relative to the protocol defaults. A chain switches to
+// another table at the block a gas repricing is scheduled for.
 type GasTable struct {
-	ExtcodeSize uint64
-	ExtcodeCopy uint64
-	Balance     uint64
-	SLoad       uint64
-	Calls       uint64
-	Suicide     uint64
+	ExtcodeSize uint64 `json:"extcodeSize"`
+	ExtcodeCopy uint64 `json:"extcodeCopy"`
+	Balance     uint64 `json:"balance"`
+	SLoad       uint64 `json:"sload"`
+	Calls       uint64 `json:"calls"`
+	Suicide     uint64 `json:"suicide"`
 
-	ExpByte uint64
+	ExpByte uint64 `json:"expByte"`
 
 	// CreateBySuicide occurs when the
 	// refunded account is one that does
 	// not exist. This logic is similar
 	// to call. May be left nil. Nil means
 	// not charged.
-	CreateBySuicide uint64
+	CreateBySuicide uint64 `json:"createBySuicide"`
+
+	Tx                 uint64 `json:"tx"`                 // Per transaction not creating a contract
+	TxContractCreation uint64 `json:"txContractCreation"` // Per transaction that creates a contract
+	TxDataZero         uint64 `json:"txDataZero"`         // Per zero byte of transaction data
+	TxDataNonZero      uint64 `json:"txDataNonZero"`      // Per non-zero byte of transaction data
+
+	SstoreSet    uint64 `json:"sstoreSet"`    // Per SSTORE setting a zero slot
+	SstoreReset  uint64 `json:"sstoreReset"`  // Per SSTORE leaving the zeroness of a slot
+	SstoreClear  uint64 `json:"sstoreClear"`  // Per SSTORE clearing a slot
+	SstoreRefund uint64 `json:"sstoreRefund"` // Refunded per SSTORE clearing a slot
+
+	Log      uint64 `json:"log"`      // Per LOG* operation
+	LogData  uint64 `json:"logData"`  // Per byte of LOG* data
+	LogTopic uint64 `json:"logTopic"` // Per LOG* topic
+	Sha3     uint64 `json:"sha3"`     // Per SHA3 operation
+	Sha3Word uint64 `json:"sha3Word"` // Per word of SHA3 data
+
+	CallValueTransfer uint64 `json:"callValueTransfer"` // Per CALL transferring value
+	CallNewAccount    uint64 `json:"callNewAccount"`    // Per CALL creating its destination
+	CallStipend       uint64 `json:"callStipend"`       // Given to the callee of a CALL transferring value
+	Create            uint64 `json:"create"`            // Per CREATE operation
+	CreateData        uint64 `json:"createData"`        // Per byte of code deployed
+	SuicideRefund     uint64 `json:"suicideRefund"`     // Refunded per SUICIDE operation
+}
+
+// GasRepricing schedules the gas prices of a chain to switch to Table at Block.
+// The table replaces the previous one entirely, so it has to list every price.
+type GasRepricing struct {
+	Block *big.Int `json:"block"`
+	Table GasTable `json:"table"`
 }
 
 var (
@@ -45,6 +80,29 @@ var (
 		Calls:       2,
 		Suicide:     0,
 		ExpByte:     2,
+
+		Tx:                 TxGas,
+		TxContractCreation: TxGasContractCreation,
+		TxDataZero:         TxDataZeroGas,
+		TxDataNonZero:      TxDataNonZeroGas,
+
+		SstoreSet:    SstoreSetGas,
+		SstoreReset:  SstoreResetGas,
+		SstoreClear:  SstoreClearGas,
+		SstoreRefund: SstoreRefundGas,
+
+		Log:      LogGas,
+		LogData:  LogDataGas,
+		LogTopic: LogTopicGas,
+		Sha3:     Sha3Gas,
+		Sha3Word: Sha3WordGas,
+
+		CallValueTransfer: CallValueTransferGas,
+		CallNewAccount:    CallNewAccountGas,
+		CallStipend:       CallStipend,
+		Create:            CreateGas,
+		CreateData:        CreateDataGas,
+		SuicideRefund:     SuicideRefundGas,
 	}
 
 	// GasTableHomestead contain the gas re-prices for
@@ -59,6 +117,29 @@ var (
 		ExpByte:     2,
 
 		CreateBySuicide: 5,
+
+		Tx:                 TxGas,
+		TxContractCreation: TxGasContractCreation,
+		TxDataZero:         TxDataZeroGas,
+		TxDataNonZero:      TxDataNonZeroGas,
+
+		SstoreSet:    SstoreSetGas,
+		SstoreReset:  SstoreResetGas,
+		SstoreClear:  SstoreClearGas,
+		SstoreRefund: SstoreRefundGas,
+
+		Log:      LogGas,
+		LogData:  LogDataGas,
+		LogTopic: LogTopicGas,
+		Sha3:     Sha3Gas,
+		Sha3Word: Sha3WordGas,
+
+		CallValueTransfer: CallValueTransferGas,
+		CallNewAccount:    CallNewAccountGas,
+		CallStipend:       CallStipend,
+		Create:            CreateGas,
+		CreateData:        CreateDataGas,
+		SuicideRefund:     SuicideRefundGas,
 	}
 
 	GasTableEIP158 = GasTable{
@@ -71,6 +152,29 @@ var (
 		ExpByte:     2,
 
 		CreateBySuicide: 5,
+
+		Tx:                 TxGas,
+		TxContractCreation: TxGasContractCreation,
+		TxDataZero:         TxDataZeroGas,
+		TxDataNonZero:      TxDataNonZeroGas,
+
+		SstoreSet:    SstoreSetGas,
+		SstoreReset:  SstoreResetGas,
+		SstoreClear:  SstoreClearGas,
+		SstoreRefund: SstoreRefundGas,
+
+		Log:      LogGas,
+		LogData:  LogDataGas,
+		LogTopic: LogTopicGas,
+		Sha3:     Sha3Gas,
+		Sha3Word: Sha3WordGas,
+
+		CallValueTransfer: CallValueTransferGas,
+		CallNewAccount:    CallNewAccountGas,
+		CallStipend:       CallStipend,
+		Create:            CreateGas,
+		CreateData:        CreateDataGas,
+		SuicideRefund:     SuicideRefundGas,
 	}
 
 	GasPrice = 10 * Wei
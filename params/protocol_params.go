@@ -65,18 +65,21 @@ const (
 
 	// Precompiled contract gas prices
 
-	EcrecoverGas            uint64 = 3  // Elliptic curve sender recovery gas price
-	Sha256BaseGas           uint64 = 3  // Base price for a SHA256 operation
-	Sha256PerWordGas        uint64 = 2  // Per-word price for a SHA256 operation
-	Ripemd160BaseGas        uint64 = 6  // Base price for a RIPEMD160 operation
-	Ripemd160PerWordGas     uint64 = 2  // Per-word price for a RIPEMD160 operation
-	IdentityBaseGas         uint64 = 2  // Base price for a data copy operation
-	IdentityPerWordGas      uint64 = 3  // Per-work price for a data copy operation
-	ModExpQuadCoeffDiv      uint64 = 20 // Divisor for the quadratic particle of the big int modular exponentiation
-	Bn256AddGas             uint64 = 1  // Gas needed for an elliptic curve addition
-	Bn256ScalarMulGas       uint64 = 1  // Gas needed for an elliptic curve scalar multiplication
-	Bn256PairingBaseGas     uint64 = 1  // Base price for an elliptic curve pairing check
-	Bn256PairingPerPointGas uint64 = 2  // Per-point price for an elliptic curve pairing check
+	EcrecoverGas            uint64 = 3    // Elliptic curve sender recovery gas price
+	Sha256BaseGas           uint64 = 3    // Base price for a SHA256 operation
+	Sha256PerWordGas        uint64 = 2    // Per-word price for a SHA256 operation
+	Ripemd160BaseGas        uint64 = 6    // Base price for a RIPEMD160 operation
+	Ripemd160PerWordGas     uint64 = 2    // Per-word price for a RIPEMD160 operation
+	IdentityBaseGas         uint64 = 2    // Base price for a data copy operation
+	IdentityPerWordGas      uint64 = 3    // Per-work price for a data copy operation
+	ModExpQuadCoeffDiv      uint64 = 20   // Divisor for the quadratic particle of the big int modular exponentiation
+	Bn256AddGas             uint64 = 1    // Gas needed for an elliptic curve addition
+	Bn256ScalarMulGas       uint64 = 1    // Gas needed for an elliptic curve scalar multiplication
+	Bn256PairingBaseGas     uint64 = 1    // Base price for an elliptic curve pairing check
+	Bn256PairingPerPointGas uint64 = 2    // Per-point price for an elliptic curve pairing check
+	Blake2FRoundsPerGas     uint64 = 1000 // Rounds of a blake2b compression charged per gas
+	EcrecoverBatchBaseGas   uint64 = 1    // Base price for a batch of elliptic curve sender recoveries
+	EcrecoverBatchPerSigGas uint64 = 2    // Per-signature price for a batch of elliptic curve sender recoveries
 )
 
 var (
@@ -96,6 +96,10 @@ func (err *jsonError) ErrorCode() int {
 	return err.Code
 }
 
+func (err *jsonError) ErrorData() interface{} {
+	return err.Data
+}
+
 // NewCodec creates a new RPC server codec with support for JSON-RPC 2.0 based
 // on explicitly given encoding and decoding methods.
 func NewCodec(rwc io.ReadWriteCloser, encode, decode func(v interface{}) error) ServerCodec {
@@ -284,13 +288,19 @@ func (c *jsonCodec) ParseRequestArguments(argTypes []reflect.Type, params interf
 // given types. It returns the parsed values or an error when the args could not be
 // parsed. Missing optional arguments are returned as reflect.Zero values.
 func parsePositionalArguments(rawArgs json.RawMessage, types []reflect.Type) ([]reflect.Value, Error) {
-	// Read beginning of the args array.
+	// Read beginning of the args array. The params may also be omitted or null if
+	// all arguments are optional, our own client sending null if there are none.
 	dec := json.NewDecoder(bytes.NewReader(rawArgs))
-	if tok, _ := dec.Token(); tok != json.Delim('[') {
+	args := make([]reflect.Value, 0, len(types))
+
+	tok, err := dec.Token()
+	switch {
+	case err == io.EOF || (err == nil && tok == nil):
+		return parseMissingArguments(args, types)
+	case tok != json.Delim('['):
 		return nil, &invalidParamsError{"non-array args"}
 	}
 	// Read args.
-	args := make([]reflect.Value, 0, len(types))
 	for i := 0; dec.More(); i++ {
 		if i >= len(types) {
 			return nil, &invalidParamsError{fmt.Sprintf("too many arguments, want at most %d", len(types))}
@@ -308,7 +318,12 @@ func parsePositionalArguments(rawArgs json.RawMessage, types []reflect.Type) ([]
 	if _, err := dec.Token(); err != nil {
 		return nil, &invalidParamsError{err.Error()}
 	}
-	// Set any missing args to nil.
+	return parseMissingArguments(args, types)
+}
+
+// parseMissingArguments sets the arguments missing from the parsed ones to nil,
+// returning an error if any of them is required.
+func parseMissingArguments(args []reflect.Value, types []reflect.Type) ([]reflect.Value, Error) {
 	for i := len(args); i < len(types); i++ {
 		if types[i].Kind() != reflect.Ptr {
 			return nil, &invalidParamsError{fmt.Sprintf("missing value for required argument %d", i)}
@@ -123,6 +123,8 @@ func TestJSONRequestParamsParsing(t *testing.T) {
 		{`[null]`, []reflect.Type{intPtrT}, []reflect.Value{intPtrV}},
 		{`[null,"abc"]`, []reflect.Type{intPtrT, stringT, intPtrT}, []reflect.Value{intPtrV, stringV, intPtrV}},
 		{`[null,"abc",null]`, []reflect.Type{intPtrT, stringT, intPtrT}, []reflect.Value{intPtrV, stringV, intPtrV}},
+		{`null`, []reflect.Type{intPtrT}, []reflect.Value{intPtrV}},
+		{``, []reflect.Type{intPtrT}, []reflect.Value{intPtrV}},
 	}
 
 	codec := jsonCodec{}
@@ -175,4 +177,10 @@ func TestJSONRequestParamsParsing(t *testing.T) {
 			t.Errorf("expected test %d - %s to fail", i, test.input)
 		}
 	}
+	// Omitted params are only accepted if all arguments are optional
+	for _, input := range []string{``, `null`, `{}`} {
+		if _, err := codec.ParseRequestArguments([]reflect.Type{intT}, json.RawMessage(input)); err == nil {
+			t.Errorf("expected %q to fail for a required argument", input)
+		}
+	}
 }
@@ -19,23 +19,28 @@ package won
 import (
 	"compress/gzip"
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"math/big"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/common/hexutil"
 	"github.com/worldopennetwork/go-won/core"
 	"github.com/worldopennetwork/go-won/core/state"
 	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
 	"github.com/worldopennetwork/go-won/log"
 	"github.com/worldopennetwork/go-won/miner"
 	"github.com/worldopennetwork/go-won/params"
 	"github.com/worldopennetwork/go-won/rlp"
 	"github.com/worldopennetwork/go-won/rpc"
 	"github.com/worldopennetwork/go-won/trie"
+	"github.com/worldopennetwork/go-won/wondb"
 )
 
 // PublicWorldOpenNetworkAPI provides an API to access WorldOpenNetwork full node-related
@@ -169,6 +174,18 @@ func (api *PrivateMinerAPI) Stop() bool {
 	return true
 }
 
+// StopGraceful stops the miner once the wonbase sealed the blocks of its current
+// producer turn, waiting at most the given number of seconds. If timeout is nil
+// the shutdown timeout of the node is used.
+func (api *PrivateMinerAPI) StopGraceful(timeout *int) bool {
+	wait := api.e.config.ProducerStopTimeout
+	if timeout != nil {
+		wait = time.Duration(*timeout) * time.Second
+	}
+	api.e.miner.StopGraceful(wait)
+	return api.Stop()
+}
+
 // SetExtra sets the extra data string that is included when this miner mines a block.
 func (api *PrivateMinerAPI) SetExtra(extra string) (bool, error) {
 	if err := api.e.Miner().SetExtra([]byte(extra)); err != nil {
@@ -193,6 +210,16 @@ func (api *PrivateMinerAPI) SetWonbase(wonbase common.Address) bool {
 	return true
 }
 
+// ProducerStatus diagnoses whether the wonbase is able to produce blocks on a
+// dpos chain, being a registered, active and elected producer.
+func (api *PrivateMinerAPI) ProducerStatus() (*ProducerStatus, error) {
+	eb, err := api.e.Wonbase()
+	if err != nil {
+		return nil, fmt.Errorf("wonbase missing: %v", err)
+	}
+	return api.e.producerStatus(eb)
+}
+
 // GetHashrate returns the current hashrate of the miner.
 func (api *PrivateMinerAPI) GetHashrate() uint64 {
 	return uint64(api.e.miner.HashRate())
@@ -291,6 +318,55 @@ func (api *PrivateAdminAPI) ImportChain(file string) (bool, error) {
 	return true, nil
 }
 
+// ExportKycDpos exports the KYC/dpos registry at a given block into a local
+// file, as a JSON snapshot the genesis of a new network can import.
+func (api *PrivateAdminAPI) ExportKycDpos(file string, blockNr rpc.BlockNumber) (bool, error) {
+	var block *types.Block
+	if blockNr == rpc.LatestBlockNumber || blockNr == rpc.PendingBlockNumber {
+		block = api.won.blockchain.CurrentBlock()
+	} else {
+		block = api.won.blockchain.GetBlockByNumber(uint64(blockNr))
+	}
+	if block == nil {
+		return false, fmt.Errorf("block #%d not found", blockNr)
+	}
+	stateDb, err := api.won.BlockChain().StateAt(block.Root())
+	if err != nil {
+		return false, err
+	}
+	registry, err := stateDb.ExportKycDpos()
+	if err != nil {
+		return false, err
+	}
+	out, err := json.MarshalIndent(registry, "", "  ")
+	if err != nil {
+		return false, err
+	}
+	if err := ioutil.WriteFile(file, out, 0644); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// ImportKycDpos checks that the KYC/dpos registry snapshot in a local file can
+// be imported into a genesis, replaying it into an empty state.
+func (api *PrivateAdminAPI) ImportKycDpos(file string) (bool, error) {
+	blob, err := ioutil.ReadFile(file)
+	if err != nil {
+		return false, err
+	}
+	registry := new(state.KycDposRegistry)
+	if err := json.Unmarshal(blob, registry); err != nil {
+		return false, fmt.Errorf("failed to parse registry: %v", err)
+	}
+	db, _ := wondb.NewMemDatabase()
+	stateDb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	if err := stateDb.ImportKycDpos(registry); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
 // PublicDebugAPI is the collection of WorldOpenNetwork full node APIs exposed
 // over the public debugging endpoint.
 type PublicDebugAPI struct {
@@ -328,6 +404,29 @@ func (api *PublicDebugAPI) DumpBlock(blockNr rpc.BlockNumber) (state.Dump, error
 	return stateDb.RawDump(), nil
 }
 
+// DumpKycDpos retrieves the decoded KYC and dpos pseudo-contract state at a
+// given block.
+func (api *PublicDebugAPI) DumpKycDpos(blockNr rpc.BlockNumber) (state.KycDposDump, error) {
+	if blockNr == rpc.PendingBlockNumber {
+		_, stateDb := api.won.miner.Pending()
+		return stateDb.DumpKycDpos(), nil
+	}
+	var block *types.Block
+	if blockNr == rpc.LatestBlockNumber {
+		block = api.won.blockchain.CurrentBlock()
+	} else {
+		block = api.won.blockchain.GetBlockByNumber(uint64(blockNr))
+	}
+	if block == nil {
+		return state.KycDposDump{}, fmt.Errorf("block #%d not found", blockNr)
+	}
+	stateDb, err := api.won.BlockChain().StateAt(block.Root())
+	if err != nil {
+		return state.KycDposDump{}, err
+	}
+	return stateDb.DumpKycDpos(), nil
+}
+
 // PrivateDebugAPI is the collection of WorldOpenNetwork full node APIs exposed over
 // the private debugging endpoint.
 type PrivateDebugAPI struct {
@@ -379,6 +478,44 @@ func (api *PrivateDebugAPI) StorageRangeAt(ctx context.Context, blockHash common
 	return storageRangeAt(st, keyStart, maxResult)
 }
 
+// KycStorageRange pages through the raw storage slots of the KYC pseudo-contract
+// at the given block, or at the pending one, starting from the hashed key
+// keyStart. Slot keys are resolved through the preimage store where known, and
+// the next key to continue from is returned unless the last slot was reached.
+func (api *PrivateDebugAPI) KycStorageRange(blockNr rpc.BlockNumber, keyStart hexutil.Bytes, maxResult int) (StorageRangeResult, error) {
+	var statedb *state.StateDB
+	if blockNr == rpc.PendingBlockNumber {
+		_, statedb = api.won.miner.Pending()
+	} else {
+		var block *types.Block
+		if blockNr == rpc.LatestBlockNumber {
+			block = api.won.blockchain.CurrentBlock()
+		} else {
+			block = api.won.blockchain.GetBlockByNumber(uint64(blockNr))
+		}
+		if block == nil {
+			return StorageRangeResult{}, fmt.Errorf("block #%d not found", blockNr)
+		}
+		var err error
+		if statedb, err = api.won.BlockChain().StateAt(block.Root()); err != nil {
+			return StorageRangeResult{}, err
+		}
+	}
+	return kycStorageRange(statedb, keyStart, maxResult)
+}
+
+// kycStorageRange returns up to maxResult slots of the KYC pseudo-contract
+// storage from start on. The storage trie is a copy with the cached changes of
+// statedb folded in, the same slots ForEachStorage visits, so statedb itself is
+// left untouched.
+func kycStorageRange(statedb *state.StateDB, start []byte, maxResult int) (StorageRangeResult, error) {
+	st := statedb.StorageTrie(vm.KycContractAddress)
+	if st == nil {
+		return StorageRangeResult{Storage: storageMap{}}, nil
+	}
+	return storageRangeAt(st, start, maxResult)
+}
+
 func storageRangeAt(st state.Trie, start []byte, maxResult int) (StorageRangeResult, error) {
 	it := trie.NewIterator(st.NodeIterator(start))
 	result := StorageRangeResult{Storage: storageMap{}}
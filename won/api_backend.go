@@ -120,8 +120,13 @@ func (b *EthApiBackend) GetTd(blockHash common.Hash) *big.Int {
 	return b.won.blockchain.GetTdByHash(blockHash)
 }
 
-func (b *EthApiBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmCfg vm.Config) (*vm.EVM, func() error, error) {
-	state.SetBalance(msg.From(), math.MaxBig256)
+// GetEVM returns an EVM to simulate msg on top of state with. Unless strict,
+// the sender is given a limitless balance so that the call never runs out of
+// funds, hiding the failures of transfers and stakes beyond its real balance.
+func (b *EthApiBackend) GetEVM(ctx context.Context, msg core.Message, state *state.StateDB, header *types.Header, vmCfg vm.Config, strict bool) (*vm.EVM, func() error, error) {
+	if !strict {
+		state.SetBalance(msg.From(), math.MaxBig256)
+	}
 	vmError := func() error { return nil }
 
 	context := core.NewEVMContext(msg, header, b.won.BlockChain(), nil)
@@ -196,6 +201,10 @@ func (b *EthApiBackend) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	return b.gpo.SuggestPrice(ctx)
 }
 
+func (b *EthApiBackend) SuggestPriceFor(ctx context.Context, tx *types.Transaction) (*big.Int, error) {
+	return b.gpo.SuggestPriceFor(ctx, tx)
+}
+
 func (b *EthApiBackend) FixedPrice() *big.Int {
 	return b.gpo.FixedPrice()
 }
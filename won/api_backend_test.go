@@ -0,0 +1,203 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package won
+
+import (
+	"context"
+	"math/big"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/worldopennetwork/go-won/accounts"
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/common/hexutil"
+	"github.com/worldopennetwork/go-won/consensus/ethash"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/core/vm/kycabi"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/event"
+	"github.com/worldopennetwork/go-won/internal/wonapi"
+	"github.com/worldopennetwork/go-won/miner"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rpc"
+	"github.com/worldopennetwork/go-won/won/gasprice"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// Tests that the KYC state queries honor the pending block, reflecting pooled
+// KYC transactions not mined yet, without mutating the pending state of the
+// miner when reading it.
+func TestPendingKycState(t *testing.T) {
+	var (
+		key, _    = crypto.GenerateKey()
+		provider  = crypto.PubkeyToAddress(key.PublicKey)
+		verified  = common.Address{0x01}
+		untouched = common.Address{0x02}
+		config    = &params.ChainConfig{ChainId: big.NewInt(1)}
+		db, _     = wondb.NewMemDatabase()
+	)
+	genesis := &core.Genesis{
+		Config: config,
+		Alloc: core.GenesisAlloc{
+			provider: {Balance: big.NewInt(params.WON)},
+			vm.KycContractAddress: {
+				Balance: new(big.Int),
+				Storage: map[common.Hash]common.Hash{
+					state.KycProviderCountKey(): common.BigToHash(big.NewInt(1)),
+					state.KycProviderKey(0):     provider.Hash(),
+				},
+			},
+		},
+	}
+	genesis.MustCommit(db)
+
+	engine := ethash.NewFaker()
+	blockchain, _ := core.NewBlockChain(db, nil, config, engine, vm.Config{})
+	defer blockchain.Stop()
+
+	poolConfig := core.DefaultTxPoolConfig
+	poolConfig.Journal = ""
+
+	won := &WorldOpenNetwork{
+		chainConfig:    config,
+		chainDb:        db,
+		blockchain:     blockchain,
+		txPool:         core.NewTxPool(poolConfig, config, blockchain),
+		eventMux:       new(event.TypeMux),
+		engine:         engine,
+		accountManager: accounts.NewManager(),
+	}
+	defer won.txPool.Stop()
+	won.miner = miner.New(won, config, won.eventMux, engine)
+	defer won.miner.Stop()
+
+	api := wonapi.NewPublicBlockChainAPI(&EthApiBackend{won: won})
+
+	tx, _ := types.SignTx(kycabi.NewSetKycTx(0, 100000, big.NewInt(int64(params.GasPrice)), verified, 2, 3, 0), types.MakeSigner(config, common.Big1), key)
+	if err := won.txPool.AddLocal(tx); err != nil {
+		t.Fatalf("failed to add KYC transaction: %v", err)
+	}
+	// Wait for the miner to apply the transaction to its pending block
+	ctx := context.Background()
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		info, err := api.GetKycInfo(ctx, verified, rpc.PendingBlockNumber)
+		if err != nil {
+			t.Fatalf("failed to retrieve pending KYC info: %v", err)
+		}
+		if info["level"] == uint32(2) && info["zone"] == uint32(3) && info["provider"] == provider {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatalf("pending KYC info mismatch: have %v", info)
+		}
+	}
+	// The latest block doesn't know about the transaction yet
+	info, err := api.GetKycInfo(ctx, verified, rpc.LatestBlockNumber)
+	if err != nil {
+		t.Fatalf("failed to retrieve latest KYC info: %v", err)
+	}
+	if info["level"] != uint32(0) || info["provider"] != (common.Address{}) {
+		t.Errorf("latest KYC info mismatch: have %v", info)
+	}
+	// Reading accounts from the pending state leaves the miner's one untouched
+	if _, err := api.GetKycInfo(ctx, untouched, rpc.PendingBlockNumber); err != nil {
+		t.Fatalf("failed to retrieve pending KYC info: %v", err)
+	}
+	if _, pending := won.miner.Pending(); pending.Exist(untouched) {
+		t.Errorf("pending state mutated by read")
+	}
+	pending := rpc.PendingBlockNumber
+	providers, err := api.GetKycProviderList(ctx, &pending)
+	if err != nil || len(providers) != 1 || providers[0] != provider {
+		t.Errorf("pending provider list mismatch: have %x (%v), want %x", providers, err, provider)
+	}
+}
+
+// Tests that strict calls simulate stakes on the real balance of the sender,
+// failing beyond it, while the default calls keep giving a limitless balance.
+func TestStrictCall(t *testing.T) {
+	var (
+		provider = common.Address{0xff}
+		user     = common.Address{0x01}
+		config   = &params.ChainConfig{ChainId: big.NewInt(1)}
+		db, _    = wondb.NewMemDatabase()
+	)
+	genesis := &core.Genesis{
+		Config: config,
+		Alloc:  core.GenesisAlloc{user: {Balance: big.NewInt(params.WON)}},
+		KycDpos: &state.KycDposRegistry{
+			Providers:    []common.Address{provider},
+			Attestations: map[common.Address]*state.KycAttestation{user: {Level: 1, Provider: provider}},
+		},
+	}
+	genesis.MustCommit(db)
+
+	blockchain, _ := core.NewBlockChain(db, nil, config, ethash.NewFaker(), vm.Config{})
+	defer blockchain.Stop()
+
+	won := &WorldOpenNetwork{chainConfig: config, chainDb: db, blockchain: blockchain}
+	backend := &EthApiBackend{won: won}
+	backend.gpo = gasprice.NewOracle(backend, gasprice.Config{Blocks: 1})
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("won", wonapi.NewPublicBlockChainAPI(backend)); err != nil {
+		t.Fatalf("failed to register API: %v", err)
+	}
+	client := rpc.DialInProc(server)
+	defer client.Close()
+
+	// Stake way more than the balance of the user
+	stake := new(big.Int).Mul(big.NewInt(params.WON), big.NewInt(100))
+	for _, strict := range []bool{false, true} {
+		args := map[string]interface{}{
+			"from":   user,
+			"to":     vm.KycContractAddress,
+			"data":   hexutil.Bytes((&kycabi.AddStake{Value: stake}).Pack()),
+			"gas":    hexutil.Uint64(100000),
+			"strict": strict,
+		}
+		var result hexutil.Bytes
+		err := client.Call(&result, "won_call", args, "latest")
+		switch {
+		case !strict && err != nil:
+			t.Errorf("legacy call failed: %v", err)
+		case strict && err == nil:
+			t.Errorf("strict call staking beyond the balance succeeded")
+		case strict:
+			want := map[string]interface{}{"reason": "STAKE_INSUFFICIENT_BALANCE"}
+			if have := err.(rpc.DataError).ErrorData(); !reflect.DeepEqual(have, want) {
+				t.Errorf("strict call error data mismatch: have %v, want %v", have, want)
+			}
+		}
+	}
+	// A stake within the balance goes through in strict mode too
+	args := map[string]interface{}{
+		"from":   user,
+		"to":     vm.KycContractAddress,
+		"data":   hexutil.Bytes((&kycabi.AddStake{Value: big.NewInt(params.WON / 2)}).Pack()),
+		"gas":    hexutil.Uint64(100000),
+		"strict": true,
+	}
+	var result hexutil.Bytes
+	if err := client.Call(&result, "won_call", args, "latest"); err != nil {
+		t.Errorf("strict call staking within the balance failed: %v", err)
+	}
+}
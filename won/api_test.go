@@ -23,6 +23,7 @@ import (
 	"github.com/davecgh/go-spew/spew"
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/vm"
 	"github.com/worldopennetwork/go-won/wondb"
 )
 
@@ -89,3 +90,69 @@ func TestStorageRangeAt(t *testing.T) {
 		}
 	}
 }
+
+// Tests that paging through the KYC pseudo-contract storage yields every slot
+// exactly once, committed and cached changes alike, without touching the state.
+func TestKycStorageRange(t *testing.T) {
+	populate := func() *state.StateDB {
+		db, _ := wondb.NewMemDatabase()
+		statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+		for i := byte(1); i <= 5; i++ {
+			statedb.AddKycProvider(common.Address{i})
+		}
+		statedb.SetKycExpiry(common.Address{0x10}, 1000)
+		root, _ := statedb.Commit(false)
+		statedb, _ = state.New(root, statedb.Database())
+
+		// Overwrite and clear committed slots, and add new ones on top
+		statedb.RemoveKycProvider(common.Address{2})
+		statedb.SetKycExpiry(common.Address{0x10}, 2000)
+		statedb.SetKycExpiry(common.Address{0x11}, 3000)
+		statedb.SetKycZoneRestricted(1, 2, true)
+		return statedb
+	}
+	statedb, untouched := populate(), populate()
+
+	want := make(map[common.Hash]common.Hash)
+	statedb.ForEachStorage(vm.KycContractAddress, func(key, value common.Hash) bool {
+		if value != (common.Hash{}) {
+			want[key] = value
+		}
+		return true
+	})
+
+	have := make(map[common.Hash]common.Hash)
+	var start []byte
+	for pages := 0; ; pages++ {
+		if pages > len(want) {
+			t.Fatalf("paging doesn't terminate")
+		}
+		result, err := kycStorageRange(statedb, start, 3)
+		if err != nil {
+			t.Fatalf("failed to page storage: %v", err)
+		}
+		if len(result.Storage) > 3 {
+			t.Fatalf("page too large: have %d slots, want at most 3", len(result.Storage))
+		}
+		for hash, entry := range result.Storage {
+			if entry.Key == nil {
+				t.Fatalf("missing preimage of slot %x", hash)
+			}
+			if _, dup := have[*entry.Key]; dup {
+				t.Fatalf("slot %x returned twice", *entry.Key)
+			}
+			have[*entry.Key] = entry.Value
+		}
+		if result.NextKey == nil {
+			break
+		}
+		start = result.NextKey.Bytes()
+	}
+	if !reflect.DeepEqual(have, want) {
+		t.Errorf("storage mismatch:\nhave %s\nwant %s", dumper.Sdump(have), dumper.Sdump(want))
+	}
+	if statedb.IntermediateRoot(false) != untouched.IntermediateRoot(false) {
+		t.Errorf("paging modified the state")
+	}
+}
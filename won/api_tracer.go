@@ -586,21 +586,30 @@ func (api *PrivateDebugAPI) traceTx(ctx context.Context, message core.Message, v
 		tracer = vm.NewStructLogger(config.LogConfig)
 	}
 	// Run the transaction with tracing enabled.
-	vmenv := vm.NewEVM(vmctx, statedb, api.config, vm.Config{Debug: true, Tracer: tracer})
+	cfg := vm.Config{Debug: true, Tracer: tracer}
+	if logger, ok := tracer.(*vm.StructLogger); ok {
+		cfg.PrecompileTracer = logger
+	}
+	vmenv := vm.NewEVM(vmctx, statedb, api.config, cfg)
 
-	ret, gas, failed, err := core.ApplyMessage(vmenv, message, new(core.GasPool).AddGas(message.Gas()))
+	ret, gas, reason, err := core.ApplyMessageWithReason(vmenv, message, new(core.GasPool).AddGas(message.Gas()))
 	if err != nil {
 		return nil, fmt.Errorf("tracing failed: %v", err)
 	}
 	// Depending on the tracer type, format and return the output
 	switch tracer := tracer.(type) {
 	case *vm.StructLogger:
-		return &wonapi.ExecutionResult{
+		result := &wonapi.ExecutionResult{
 			Gas:         gas,
-			Failed:      failed,
+			Failed:      reason != nil,
 			ReturnValue: fmt.Sprintf("%x", ret),
 			StructLogs:  wonapi.FormatLogs(tracer.StructLogs()),
-		}, nil
+			Precompile:  wonapi.FormatPrecompileLogs(tracer.PrecompileLogs()),
+		}
+		if reason != nil {
+			result.Error = reason.Error()
+		}
+		return result, nil
 
 	case *tracers.Tracer:
 		return tracer.GetResult()
@@ -0,0 +1,106 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package won
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/core/vm/kycabi"
+	"github.com/worldopennetwork/go-won/internal/wonapi"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// Tests that tracing a staking transaction reports the call into the KYC
+// precompile along with the storage slots it wrote.
+func TestTracePrecompile(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+
+	provider, sender := common.Address{0xff}, common.Address{0x01}
+	statedb.AddKycProvider(provider)
+	statedb.SetKycProvider(sender, provider)
+	statedb.SetKycLevel(sender, 1)
+	statedb.AddBalance(sender, new(big.Int).Mul(big.NewInt(params.WON), big.NewInt(1000)))
+
+	stake := big.NewInt(params.WON)
+	tx := kycabi.NewAddStakeTx(0, 100000, big.NewInt(1), stake)
+	msg := types.NewMessage(sender, tx.To(), tx.Nonce(), tx.Value(), tx.Gas(), tx.GasPrice(), tx.Data(), false)
+
+	vmctx := vm.Context{
+		CanTransfer: core.CanTransfer,
+		Transfer:    core.Transfer,
+		GetHash:     func(uint64) common.Hash { return common.Hash{} },
+		Origin:      sender,
+		GasPrice:    tx.GasPrice(),
+		BlockNumber: big.NewInt(1),
+		Time:        big.NewInt(1000),
+		Difficulty:  big.NewInt(1),
+		GasLimit:    8000000,
+	}
+	api := &PrivateDebugAPI{config: params.TestChainConfig}
+	res, err := api.traceTx(context.Background(), msg, vmctx, statedb, nil)
+	if err != nil {
+		t.Fatalf("failed to trace transaction: %v", err)
+	}
+	result := res.(*wonapi.ExecutionResult)
+	if result.Failed {
+		t.Fatalf("traced transaction failed: %s", result.Error)
+	}
+	if len(result.Precompile) != 1 {
+		t.Fatalf("precompile call count mismatch: have %d, want 1", len(result.Precompile))
+	}
+	call := result.Precompile[0]
+	if call.Caller != sender || call.Method != "addStake" || call.Depth != 1 {
+		t.Errorf("precompile call mismatch: have %x/%s/%d, want %x/addStake/1", call.Caller, call.Method, call.Depth, sender)
+	}
+	if want := (&kycabi.AddStake{Value: stake}); !reflect.DeepEqual(call.Args, kycabi.Call(want)) {
+		t.Errorf("precompile arguments mismatch: have %+v, want %+v", call.Args, want)
+	}
+	// Every write reported must be in the resulting state, the stake included
+	staked := false
+	for key, value := range call.Storage {
+		if have := fmt.Sprintf("%x", statedb.GetState(vm.KycContractAddress, common.HexToHash(key))); have != value {
+			t.Errorf("storage slot %s mismatch: have %s, want %s", key, value, have)
+		}
+		if common.HexToHash(value).Big().Cmp(stake) == 0 {
+			staked = true
+		}
+	}
+	if !staked {
+		t.Errorf("stake write missing from storage changes: %v", call.Storage)
+	}
+	// Tracers not interested in the precompile calls are unaffected
+	code := "{count: 0, step: function() { this.count++ }, fault: function() {}, result: function() { return this.count }}"
+	res, err = api.traceTx(context.Background(), msg, vmctx, statedb.Copy(), &TraceConfig{Tracer: &code})
+	if err != nil {
+		t.Fatalf("failed to trace transaction with JavaScript tracer: %v", err)
+	}
+	if have := string(res.(json.RawMessage)); have != "0" {
+		t.Errorf("JavaScript tracer result mismatch: have %s, want 0", have)
+	}
+}
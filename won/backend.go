@@ -39,6 +39,7 @@ import (
 	"github.com/worldopennetwork/go-won/event"
 	"github.com/worldopennetwork/go-won/internal/wonapi"
 	"github.com/worldopennetwork/go-won/log"
+	"github.com/worldopennetwork/go-won/metrics"
 	"github.com/worldopennetwork/go-won/miner"
 	"github.com/worldopennetwork/go-won/node"
 	"github.com/worldopennetwork/go-won/p2p"
@@ -83,7 +84,11 @@ type WorldOpenNetwork struct {
 	bloomRequests chan chan *bloombits.Retrieval // Channel receiving bloom data retrieval requests
 	bloomIndexer  *core.ChainIndexer             // Bloom indexer operating during block imports
 
+	scheduleIndexer *core.ChainIndexer // Producer schedule indexer of dpos chains
+	scheduleEpoch   uint64             // Number of blocks per producer schedule section
+
 	ApiBackend *EthApiBackend
+	govSender  *GovernanceSender // Sender of the KYC precompile calls of the node itself
 
 	miner    *miner.Miner
 	gasPrice *big.Int
@@ -147,8 +152,12 @@ func New(ctx *node.ServiceContext, config *Config) (*WorldOpenNetwork, error) {
 	}
 	var (
 		vmConfig    = vm.Config{EnablePreimageRecording: config.EnablePreimageRecording}
-		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout}
+		cacheConfig = &core.CacheConfig{Disabled: config.NoPruning, TrieNodeLimit: config.TrieCache, TrieTimeLimit: config.TrieTimeout, KycFlat: config.KycFlatStorage}
 	)
+	// Keep the epoch boundary states the producer schedule indexer works on
+	if engine, ok := won.engine.(*dpos.Dpos); ok {
+		cacheConfig.EpochLength, cacheConfig.EpochRetention = engine.Epoch(), config.KycRetentionEpochs
+	}
 	won.blockchain, err = core.NewBlockChain(chainDb, cacheConfig, won.chainConfig, won.engine, vmConfig)
 	if err != nil {
 		return nil, err
@@ -166,6 +175,11 @@ func New(ctx *node.ServiceContext, config *Config) (*WorldOpenNetwork, error) {
 	}
 	won.bloomIndexer.Start(won.blockchain)
 
+	if engine, ok := won.engine.(*dpos.Dpos); ok {
+		won.scheduleIndexer, won.scheduleEpoch = NewProducerScheduleIndexer(chainDb, engine.Epoch()), engine.Epoch()
+		won.scheduleIndexer.Start(won.blockchain)
+	}
+
 	if config.TxPool.Journal != "" {
 		config.TxPool.Journal = ctx.ResolvePath(config.TxPool.Journal)
 	}
@@ -174,6 +188,7 @@ func New(ctx *node.ServiceContext, config *Config) (*WorldOpenNetwork, error) {
 	if won.protocolManager, err = NewProtocolManager(won.chainConfig, config.SyncMode, config.NetworkId, won.eventMux, won.txPool, won.engine, won.blockchain, chainDb); err != nil {
 		return nil, err
 	}
+	won.protocolManager.downloader.SkipPivotVerify(config.SkipPivotVerify)
 	won.miner = miner.New(won, won.chainConfig, won.EventMux(), won.engine)
 	won.miner.SetExtra(makeExtraData(config.ExtraData))
 
@@ -183,6 +198,7 @@ func New(ctx *node.ServiceContext, config *Config) (*WorldOpenNetwork, error) {
 		gpoParams.Default = config.GasPrice
 	}
 	won.ApiBackend.gpo = gasprice.NewOracle(won.ApiBackend, gpoParams)
+	won.govSender = NewGovernanceSender(won.chainConfig, won.blockchain, won.txPool, won.accountManager, won.Wonbase, won.ApiBackend.SuggestPriceFor)
 
 	return won, nil
 }
@@ -261,6 +277,15 @@ func (s *WorldOpenNetwork) APIs() []rpc.API {
 	// Append any APIs exposed explicitly by the consensus engine
 	apis = append(apis, s.engine.APIs(s.BlockChain())...)
 
+	if s.scheduleIndexer != nil {
+		apis = append(apis, rpc.API{
+			Namespace: "won",
+			Version:   "1.0",
+			Service:   NewPublicScheduleAPI(s.blockchain, s.chainDb, s.scheduleIndexer, s.scheduleEpoch),
+			Public:    true,
+		})
+	}
+
 	// Append all the local APIs and return
 	return append(apis, []rpc.API{
 		{
@@ -354,12 +379,35 @@ func (s *WorldOpenNetwork) StartMining(local bool) error {
 	}
 
 	if dpos, ok := s.engine.(*dpos.Dpos); ok {
-		wallet, err := s.accountManager.Find(accounts.Account{Address: eb})
+		// The blocks of the wonbase may be sealed by a signing key of their own,
+		// registered on-chain, keeping the funds of the wonbase off the node
+		sealer := eb
+		if s.config.Sealer != (common.Address{}) {
+			sealer = s.config.Sealer
+		}
+		wallet, err := s.accountManager.Find(accounts.Account{Address: sealer})
 		if wallet == nil || err != nil {
-			log.Error("Wonbase account unavailable locally", "err", err)
+			log.Error("Sealer account unavailable locally", "sealer", sealer, "err", err)
 			return fmt.Errorf("signer missing: %v", err)
 		}
-		dpos.Authorize(eb, wallet.SignHash)
+		// Sealing with a wonbase outside of the producer schedule only produces
+		// unauthorized signer errors, so tell the operator early
+		status, err := s.producerStatus(eb)
+		if err != nil {
+			log.Error("Cannot check wonbase producer status", "err", err)
+			return fmt.Errorf("producer status unavailable: %v", err)
+		}
+		if err := status.err(); err != nil {
+			if s.config.StrictProducer {
+				log.Error("Wonbase cannot produce blocks", "address", eb, "err", err)
+				return err
+			}
+			log.Warn("Wonbase cannot produce blocks", "address", eb, "registered", status.Registered, "active", status.Active, "scheduled", status.Scheduled)
+		}
+		if status.SigningKey != sealer {
+			log.Warn("Sealer is not the registered signing key of the wonbase", "wonbase", eb, "sealer", sealer, "registered", status.SigningKey)
+		}
+		dpos.AuthorizeSealer(eb, sealer, wallet.SignHash)
 	}
 
 	if clique, ok := s.engine.(*clique.Clique); ok {
@@ -396,6 +444,10 @@ func (s *WorldOpenNetwork) EthVersion() int                    { return int(s.pr
 func (s *WorldOpenNetwork) NetVersion() uint64                 { return s.networkId }
 func (s *WorldOpenNetwork) Downloader() *downloader.Downloader { return s.protocolManager.downloader }
 
+// GovernanceSender returns the sender of the KYC precompile calls the node makes
+// from the wonbase.
+func (s *WorldOpenNetwork) GovernanceSender() *GovernanceSender { return s.govSender }
+
 // Protocols implements node.Service, returning all the currently configured
 // network protocols to start.
 func (s *WorldOpenNetwork) Protocols() []p2p.Protocol {
@@ -411,6 +463,15 @@ func (s *WorldOpenNetwork) Start(srvr *p2p.Server) error {
 	// Start the bloom bits servicing goroutines
 	s.startBloomHandlers()
 
+	// Track the staking economics if anyone is interested
+	if metrics.Enabled && s.chainConfig.Dpos != nil {
+		go s.dposMetricsLoop()
+	}
+	// Keep the cached producer schedules off the branches reorged away
+	if engine, ok := s.engine.(*dpos.Dpos); ok && s.scheduleIndexer != nil {
+		go s.scheduleReorgLoop(engine)
+	}
+
 	// Start the RPC service
 	s.netRPCService = wonapi.NewPublicNetAPI(srvr, s.NetVersion())
 
@@ -433,10 +494,17 @@ func (s *WorldOpenNetwork) Start(srvr *p2p.Server) error {
 // Stop implements node.Service, terminating all internal goroutines used by the
 // WorldOpenNetwork protocol.
 func (s *WorldOpenNetwork) Stop() error {
+	// Let a producer seal the rest of its turn while the chain is still running
+	if s.config.ProducerStopTimeout > 0 {
+		s.miner.StopGraceful(s.config.ProducerStopTimeout)
+	}
 	if s.stopDbUpgrade != nil {
 		s.stopDbUpgrade()
 	}
 	s.bloomIndexer.Close()
+	if s.scheduleIndexer != nil {
+		s.scheduleIndexer.Close()
+	}
 	s.blockchain.Stop()
 	s.protocolManager.Stop()
 	if s.lesServer != nil {
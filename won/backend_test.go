@@ -0,0 +1,134 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package won
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/worldopennetwork/go-won/accounts/keystore"
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/internal/wonapi"
+	"github.com/worldopennetwork/go-won/node"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rpc"
+)
+
+// newDevNode starts a networkless node on a developer genesis seeded with a
+// fresh unlocked developer account, returning a client attached to it.
+func newDevNode(t *testing.T, override func(*Config)) (*node.Node, *rpc.Client, common.Address) {
+	workspace, err := ioutil.TempDir("", "won-dev-tester-")
+	if err != nil {
+		t.Fatalf("failed to create temporary datadir: %v", err)
+	}
+	stack, err := node.New(&node.Config{DataDir: workspace, UseLightweightKDF: true, Name: "won-dev-tester"})
+	if err != nil {
+		os.RemoveAll(workspace)
+		t.Fatalf("failed to create node: %v", err)
+	}
+	ks := stack.AccountManager().Backends(keystore.KeyStoreType)[0].(*keystore.KeyStore)
+	developer, err := ks.NewAccount("")
+	if err != nil {
+		t.Fatalf("failed to create developer account: %v", err)
+	}
+	if err := ks.Unlock(developer, ""); err != nil {
+		t.Fatalf("failed to unlock developer account: %v", err)
+	}
+	conf := DefaultConfig
+	conf.Genesis = core.DeveloperGenesisBlock(0, developer.Address)
+	if override != nil {
+		override(&conf)
+	}
+	if err := stack.Register(func(ctx *node.ServiceContext) (node.Service, error) { return New(ctx, &conf) }); err != nil {
+		t.Fatalf("failed to register WorldOpenNetwork protocol: %v", err)
+	}
+	if err := stack.Start(); err != nil {
+		t.Fatalf("failed to start test stack: %v", err)
+	}
+	client, err := stack.Attach()
+	if err != nil {
+		t.Fatalf("failed to attach to node: %v", err)
+	}
+	return stack, client, developer.Address
+}
+
+// Tests that a developer network bootstraps its developer account as the KYC
+// provider, which the admin API adds further providers with.
+func TestAddKycProviderDev(t *testing.T) {
+	stack, client, developer := newDevNode(t, nil)
+	defer os.RemoveAll(stack.DataDir())
+	defer stack.Stop()
+
+	var providers []common.Address
+	if err := client.Call(&providers, "won_getKycProviderList"); err != nil {
+		t.Fatalf("failed to retrieve KYC providers: %v", err)
+	}
+	if len(providers) != 1 || providers[0] != developer {
+		t.Fatalf("genesis KYC providers mismatch: have %x, want [%x]", providers, developer)
+	}
+	provider := common.Address{0x01}
+
+	var hash common.Hash
+	if err := client.Call(&hash, "admin_addKycProviderDev", provider, nil); err != nil {
+		t.Fatalf("failed to add KYC provider: %v", err)
+	}
+	// The miner applies the pooled transaction to the pending block
+	for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+		if err := client.Call(&providers, "won_getKycProviderList", "pending"); err != nil {
+			t.Fatalf("failed to retrieve pending KYC providers: %v", err)
+		}
+		if len(providers) == 2 && providers[1] == provider {
+			break
+		}
+		if time.Since(start) > time.Second {
+			t.Fatalf("pending KYC providers mismatch: have %x, want [%x %x]", providers, developer, provider)
+		}
+	}
+	if err := client.Call(&hash, "admin_addKycProviderDev", provider, nil); err == nil {
+		t.Errorf("existing provider added again")
+	}
+}
+
+// Tests that the developer network admin API is only served on developer
+// networks, which never share the chain ID of a public network.
+func TestAddKycProviderDevRestricted(t *testing.T) {
+	stack, client, _ := newDevNode(t, func(conf *Config) {
+		config := *conf.Genesis.Config
+		config.Developer = false
+		conf.Genesis.Config = &config
+	})
+	defer os.RemoveAll(stack.DataDir())
+	defer stack.Stop()
+
+	var hash common.Hash
+	if err := client.Call(&hash, "admin_addKycProviderDev", common.Address{0x01}, nil); err == nil {
+		t.Errorf("developer API served on a non-developer network")
+	}
+	for _, public := range []*params.ChainConfig{params.MainnetChainConfig, params.TestnetChainConfig, params.BetanetChainConfig} {
+		config := *params.DevChainConfig
+		config.ChainId = public.ChainId
+		if wonapi.IsDevNetwork(&config) {
+			t.Errorf("chain %v: public network treated as developer network", public.ChainId)
+		}
+	}
+	if !wonapi.IsDevNetwork(params.DevChainConfig) {
+		t.Errorf("developer network not recognized")
+	}
+}
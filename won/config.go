@@ -50,11 +50,16 @@ var DefaultConfig = Config{
 	TrieTimeout:   5 * time.Minute,
 	GasPrice:      big.NewInt(10 * params.Wei),
 
+	KycRetentionEpochs: 2,
+
+	ProducerStopTimeout: 10 * time.Second,
+
 	TxPool: core.DefaultTxPoolConfig,
 	GPO: gasprice.Config{
 		Blocks:        20,
 		Percentile:    60,
 		FixedGasPrice: 10,
+		Governance:    gasprice.GovernanceFixed,
 	},
 }
 
@@ -84,6 +89,9 @@ type Config struct {
 	SyncMode  downloader.SyncMode
 	NoPruning bool
 
+	// Skips the KYC/DPoS invariant checks of the fast sync pivot state
+	SkipPivotVerify bool `toml:",omitempty"`
+
 	// Light client options
 	LightServ  int `toml:",omitempty"` // Maximum percentage of time allowed for serving LES requests
 	LightPeers int `toml:",omitempty"` // Maximum number of LES client peers
@@ -95,12 +103,29 @@ type Config struct {
 	TrieCache          int
 	TrieTimeout        time.Duration
 
+	// Keeps a flat copy of the KYC contract storage in the database, sparing
+	// the trie lookups of the provider and producer checks
+	KycFlatStorage bool `toml:",omitempty"`
+
+	// Number of recent dpos epochs whose boundary states, along with the KYC
+	// contract storage read by the indexers, are kept from pruning
+	KycRetentionEpochs uint64 `toml:",omitempty"`
+
 	// Mining-related options
 	Wonbase      common.Address `toml:",omitempty"`
 	MinerThreads int            `toml:",omitempty"`
 	ExtraData    []byte         `toml:",omitempty"`
 	GasPrice     *big.Int
 
+	// Refuses to start mining with a wonbase not scheduled to produce dpos blocks
+	StrictProducer bool `toml:",omitempty"`
+
+	// Signing key sealing the dpos blocks of the wonbase, if not the wonbase itself
+	Sealer common.Address `toml:",omitempty"`
+
+	// Maximum time to wait on shutdown for the turn of a producer to end (0 = none)
+	ProducerStopTimeout time.Duration `toml:",omitempty"`
+
 	// Ethash options
 	Ethash ethash.Config
 
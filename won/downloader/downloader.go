@@ -28,6 +28,7 @@ import (
 	ethereum "github.com/worldopennetwork/go-won"
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/state"
 	"github.com/worldopennetwork/go-won/core/types"
 	"github.com/worldopennetwork/go-won/event"
 	"github.com/worldopennetwork/go-won/log"
@@ -90,6 +91,7 @@ var (
 	errCancelContentProcessing = errors.New("content processing canceled (requested)")
 	errNoSyncActive            = errors.New("no sync active")
 	errTooOld                  = errors.New("peer doesn't speak recent enough protocol version (need version >= 62)")
+	errInvalidPivotState       = errors.New("synced pivot state violates the KYC/DPoS invariants")
 )
 
 type Downloader struct {
@@ -100,6 +102,8 @@ type Downloader struct {
 	peers   *peerSet // Set of active peers from which download can proceed
 	stateDB wondb.Database
 
+	skipPivotVerify bool // Whether to skip the KYC/DPoS invariant checks of the pivot state
+
 	rttEstimate   uint64 // Round trip time to target for download requests
 	rttConfidence uint64 // Confidence in the estimated RTT (unit: millionths to allow atomic ops)
 
@@ -267,6 +271,13 @@ func (d *Downloader) Synchronising() bool {
 	return atomic.LoadInt32(&d.synchronising) > 0
 }
 
+// SkipPivotVerify sets whether fast sync commits the pivot block without first
+// checking the KYC/DPoS invariants of its state. It must be called before the
+// first sync cycle is started.
+func (d *Downloader) SkipPivotVerify(skip bool) {
+	d.skipPivotVerify = skip
+}
+
 // RegisterPeer injects a new download peer into the set of block source to be
 // used for fetching hashes and blocks from.
 func (d *Downloader) RegisterPeer(id string, version int, peer Peer) error {
@@ -1436,6 +1447,9 @@ func (d *Downloader) processFastSyncContent(latest *types.Header) error {
 				if stateSync.err != nil {
 					return stateSync.err
 				}
+				if err := d.verifyPivotState(P.Header); err != nil {
+					return err
+				}
 				if err := d.commitPivotBlock(P); err != nil {
 					return err
 				}
@@ -1501,6 +1515,24 @@ func (d *Downloader) commitFastSyncData(results []*fetchResult, stateSync *state
 	return nil
 }
 
+// verifyPivotState checks the KYC/DPoS invariants of the state synced for the
+// pivot block, as a state inconsistent there would only surface once the chain
+// is being processed on top of it.
+func (d *Downloader) verifyPivotState(header *types.Header) error {
+	if d.skipPivotVerify {
+		return nil
+	}
+	statedb, err := state.New(header.Root, state.NewDatabase(d.stateDB))
+	if err != nil {
+		return err
+	}
+	if err := statedb.VerifyKycDpos(); err != nil {
+		log.Error("Fast sync pivot state invalid", "number", header.Number, "hash", header.Hash(), "root", header.Root, "err", err)
+		return fmt.Errorf("%v: pivot block #%d [%x…]: %v", errInvalidPivotState, header.Number, header.Hash().Bytes()[:4], err)
+	}
+	return nil
+}
+
 func (d *Downloader) commitPivotBlock(result *fetchResult) error {
 	block := types.NewBlockWithHeader(result.Header).WithBody(result.Transactions, result.Uncles)
 	log.Debug("Committing fast sync pivot as new head", "number", block.Number(), "hash", block.Hash())
@@ -20,6 +20,7 @@ import (
 	"errors"
 	"fmt"
 	"math/big"
+	"strings"
 	"sync"
 	"sync/atomic"
 	"testing"
@@ -28,7 +29,9 @@ import (
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/consensus/ethash"
 	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/state"
 	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
 	"github.com/worldopennetwork/go-won/crypto"
 	"github.com/worldopennetwork/go-won/wondb"
 	"github.com/worldopennetwork/go-won/event"
@@ -75,8 +78,18 @@ type downloadTester struct {
 
 // newTester creates a new downloader test mocker.
 func newTester() *downloadTester {
+	return newTesterWithAlloc(nil)
+}
+
+// newTesterWithAlloc creates a new downloader test mocker whose genesis block
+// allocates the given accounts beside the funded test account.
+func newTesterWithAlloc(alloc core.GenesisAlloc) *downloadTester {
 	testdb, _ := wondb.NewMemDatabase()
-	genesis := core.GenesisBlockForTesting(testdb, testAddress, big.NewInt(1000000000))
+	genesisAlloc := core.GenesisAlloc{testAddress: {Balance: big.NewInt(1000000000)}}
+	for addr, account := range alloc {
+		genesisAlloc[addr] = account
+	}
+	genesis := (&core.Genesis{Alloc: genesisAlloc}).MustCommit(testdb)
 
 	tester := &downloadTester{
 		genesis:           genesis,
@@ -1753,3 +1766,44 @@ func testDeliverHeadersHang(t *testing.T, protocol int, mode SyncMode) {
 		tester.downloader.peers.peers["peer"].peer.(*floodingTestPeer).pend.Wait()
 	}
 }
+
+// Tests that fast sync refuses to commit a pivot block whose state violates the
+// KYC/DPoS invariants, unless the checks are skipped.
+func TestFastSyncPivotVerify63(t *testing.T) { testFastSyncPivotVerify(t, 63) }
+func TestFastSyncPivotVerify64(t *testing.T) { testFastSyncPivotVerify(t, 64) }
+
+func testFastSyncPivotVerify(t *testing.T, protocol int) {
+	t.Parallel()
+
+	// Count one more KYC provider than the contract storage holds
+	alloc := core.GenesisAlloc{
+		vm.KycContractAddress: {
+			Balance: new(big.Int),
+			Storage: map[common.Hash]common.Hash{
+				state.KycProviderCountKey(): common.BigToHash(big.NewInt(2)),
+				state.KycProviderKey(0):     testAddress.Hash(),
+			},
+		},
+	}
+	for _, skip := range []bool{false, true} {
+		tester := newTesterWithAlloc(alloc)
+		tester.downloader.SkipPivotVerify(skip)
+
+		targetBlocks := blockCacheItems - 15
+		hashes, headers, blocks, receipts := tester.makeChain(targetBlocks, 0, tester.genesis, nil, false)
+		tester.newPeer("peer", protocol, hashes, headers, blocks, receipts)
+
+		err := tester.sync("peer", nil, FastSync)
+		switch {
+		case skip && err != nil:
+			t.Errorf("skipped checks: failed to synchronise blocks: %v", err)
+		case !skip && (err == nil || !strings.Contains(err.Error(), errInvalidPivotState.Error())):
+			t.Errorf("sync error mismatch: have %v, want %v", err, errInvalidPivotState)
+		case !skip:
+			if head := tester.CurrentBlock().NumberU64(); head != 0 {
+				t.Errorf("pivot committed despite its invalid state: head block #%d", head)
+			}
+		}
+		tester.terminate()
+	}
+}
@@ -229,6 +229,44 @@ func (api *PublicFilterAPI) NewHeads(ctx context.Context) (*rpc.Subscription, er
 	return rpcSub, nil
 }
 
+// ProducerSchedule is the ordered list of DPoS producers signing blocks from the
+// block that set it on.
+type ProducerSchedule struct {
+	Number  *hexutil.Big     `json:"number"`
+	Signers []common.Address `json:"signers"`
+}
+
+// ProducerSchedule send a notification each time a new chain head changes the
+// DPoS producer schedule.
+func (api *PublicFilterAPI) ProducerSchedule(ctx context.Context) (*rpc.Subscription, error) {
+	notifier, supported := rpc.NotifierFromContext(ctx)
+	if !supported {
+		return &rpc.Subscription{}, rpc.ErrNotificationsUnsupported
+	}
+
+	rpcSub := notifier.CreateSubscription()
+
+	go func() {
+		schedules := make(chan *ProducerSchedule)
+		schedulesSub := api.events.SubscribeProducerSchedule(schedules)
+
+		for {
+			select {
+			case s := <-schedules:
+				notifier.Notify(rpcSub.ID, s)
+			case <-rpcSub.Err():
+				schedulesSub.Unsubscribe()
+				return
+			case <-notifier.Closed():
+				schedulesSub.Unsubscribe()
+				return
+			}
+		}
+	}()
+
+	return rpcSub, nil
+}
+
 // Logs creates a subscription that fires for all new log that match the given filter criteria.
 func (api *PublicFilterAPI) Logs(ctx context.Context, crit FilterCriteria) (*rpc.Subscription, error) {
 	notifier, supported := rpc.NotifierFromContext(ctx)
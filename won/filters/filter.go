@@ -24,13 +24,16 @@ import (
 	"github.com/worldopennetwork/go-won/core"
 	"github.com/worldopennetwork/go-won/core/bloombits"
 	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
 	"github.com/worldopennetwork/go-won/wondb"
 	"github.com/worldopennetwork/go-won/event"
+	"github.com/worldopennetwork/go-won/params"
 	"github.com/worldopennetwork/go-won/rpc"
 )
 
 type Backend interface {
 	ChainDb() wondb.Database
+	ChainConfig() *params.ChainConfig
 	EventMux() *event.TypeMux
 	HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error)
 	GetReceipts(ctx context.Context, blockHash common.Hash) (types.Receipts, error)
@@ -38,6 +41,7 @@ type Backend interface {
 
 	SubscribeTxPreEvent(chan<- core.TxPreEvent) event.Subscription
 	SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subscription
+	SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription
 	SubscribeRemovedLogsEvent(ch chan<- core.RemovedLogsEvent) event.Subscription
 	SubscribeLogsEvent(ch chan<- []*types.Log) event.Subscription
 
@@ -92,6 +96,35 @@ func New(backend Backend, begin, end int64, addresses []common.Address, topics [
 	}
 }
 
+// NewKycFilter creates a new filter over the logs of the KYC batches set by the
+// given providers, or by any provider if none are given.
+func NewKycFilter(backend Backend, begin, end int64, providers []common.Address) *Filter {
+	topics := [][]common.Hash{{vm.KycSetBatchTopic}}
+	if len(providers) > 0 {
+		topics = append(topics, addressTopics(providers))
+	}
+	return New(backend, begin, end, []common.Address{vm.KycContractAddress}, topics)
+}
+
+// NewDposFilter creates a new filter over the logs of the stake added, subtracted
+// and refunded by the given voters, or by any voter if none are given.
+func NewDposFilter(backend Backend, begin, end int64, voters []common.Address) *Filter {
+	topics := [][]common.Hash{{vm.DposStakeAddedTopic, vm.DposStakeSubtractedTopic, vm.DposStakeRefundedTopic}}
+	if len(voters) > 0 {
+		topics = append(topics, addressTopics(voters))
+	}
+	return New(backend, begin, end, []common.Address{vm.KycContractAddress}, topics)
+}
+
+// addressTopics returns the topics addresses are logged as by the KYC precompile.
+func addressTopics(addrs []common.Address) []common.Hash {
+	topics := make([]common.Hash, len(addrs))
+	for i, addr := range addrs {
+		topics[i] = addr.Hash()
+	}
+	return topics
+}
+
 // Logs searches the blockchain for matching log entries, returning all from the
 // first block that contains matches, updating the start of the filter accordingly.
 func (f *Filter) Logs(ctx context.Context) ([]*types.Log, error) {
@@ -27,6 +27,8 @@ import (
 
 	ethereum "github.com/worldopennetwork/go-won"
 	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/common/hexutil"
+	"github.com/worldopennetwork/go-won/consensus/dpos"
 	"github.com/worldopennetwork/go-won/core"
 	"github.com/worldopennetwork/go-won/core/types"
 	"github.com/worldopennetwork/go-won/event"
@@ -51,6 +53,9 @@ const (
 	PendingTransactionsSubscription
 	// BlocksSubscription queries hashes for blocks that are imported
 	BlocksSubscription
+	// ProducerScheduleSubscription queries the DPoS producer schedules set by
+	// new chain heads
+	ProducerScheduleSubscription
 	// LastSubscription keeps track of the last index
 	LastIndexSubscription
 )
@@ -66,6 +71,8 @@ const (
 	logsChanSize = 10
 	// chainEvChanSize is the size of channel listening to ChainEvent.
 	chainEvChanSize = 10
+	// chainHeadChanSize is the size of channel listening to ChainHeadEvent.
+	chainHeadChanSize = 10
 )
 
 var (
@@ -80,6 +87,7 @@ type subscription struct {
 	logs      chan []*types.Log
 	hashes    chan common.Hash
 	headers   chan *types.Header
+	schedules chan *ProducerSchedule
 	installed chan struct{} // closed when the filter is installed
 	err       chan error    // closed when the filter is uninstalled
 }
@@ -91,6 +99,7 @@ type EventSystem struct {
 	backend   Backend
 	lightMode bool
 	lastHead  *types.Header
+	schedule  []common.Address   // producer schedule set by the last chain head
 	install   chan *subscription // install filter for event notification
 	uninstall chan *subscription // remove filter for event notification
 }
@@ -143,6 +152,7 @@ func (sub *Subscription) Unsubscribe() {
 			case <-sub.f.logs:
 			case <-sub.f.hashes:
 			case <-sub.f.headers:
+			case <-sub.f.schedules:
 			}
 		}
 
@@ -210,6 +220,7 @@ func (es *EventSystem) subscribeMinedPendingLogs(crit ethereum.FilterQuery, logs
 		logs:      logs,
 		hashes:    make(chan common.Hash),
 		headers:   make(chan *types.Header),
+		schedules: make(chan *ProducerSchedule),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -227,6 +238,7 @@ func (es *EventSystem) subscribeLogs(crit ethereum.FilterQuery, logs chan []*typ
 		logs:      logs,
 		hashes:    make(chan common.Hash),
 		headers:   make(chan *types.Header),
+		schedules: make(chan *ProducerSchedule),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -244,6 +256,7 @@ func (es *EventSystem) subscribePendingLogs(crit ethereum.FilterQuery, logs chan
 		logs:      logs,
 		hashes:    make(chan common.Hash),
 		headers:   make(chan *types.Header),
+		schedules: make(chan *ProducerSchedule),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -260,6 +273,7 @@ func (es *EventSystem) SubscribeNewHeads(headers chan *types.Header) *Subscripti
 		logs:      make(chan []*types.Log),
 		hashes:    make(chan common.Hash),
 		headers:   headers,
+		schedules: make(chan *ProducerSchedule),
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -276,6 +290,24 @@ func (es *EventSystem) SubscribePendingTxEvents(hashes chan common.Hash) *Subscr
 		logs:      make(chan []*types.Log),
 		hashes:    hashes,
 		headers:   make(chan *types.Header),
+		schedules: make(chan *ProducerSchedule),
+		installed: make(chan struct{}),
+		err:       make(chan error),
+	}
+	return es.subscribe(sub)
+}
+
+// SubscribeProducerSchedule creates a subscription that writes the DPoS producer
+// schedule each time a new chain head changes it.
+func (es *EventSystem) SubscribeProducerSchedule(schedules chan *ProducerSchedule) *Subscription {
+	sub := &subscription{
+		id:        rpc.NewID(),
+		typ:       ProducerScheduleSubscription,
+		created:   time.Now(),
+		logs:      make(chan []*types.Log),
+		hashes:    make(chan common.Hash),
+		headers:   make(chan *types.Header),
+		schedules: schedules,
 		installed: make(chan struct{}),
 		err:       make(chan error),
 	}
@@ -333,7 +365,42 @@ func (es *EventSystem) broadcast(filters filterIndex, ev interface{}) {
 				}
 			})
 		}
+	case core.ChainHeadEvent:
+		if schedule := es.scheduleNewHead(e.Block.Header()); schedule != nil {
+			for _, f := range filters[ProducerScheduleSubscription] {
+				f.schedules <- schedule
+			}
+		}
+	}
+}
+
+// scheduleNewHead compares the producer schedule checkpointed in a new chain
+// head with the one of the previous heads, returning it if it changed.
+func (es *EventSystem) scheduleNewHead(header *types.Header) *ProducerSchedule {
+	if es.backend.ChainConfig().Dpos == nil {
+		return nil
+	}
+	// Only epoch heads carry a schedule, all others keep the current one
+	signers := dpos.CheckpointSigners(header)
+	if len(signers) == 0 || schedulesEqual(es.schedule, signers) {
+		return nil
+	}
+	es.schedule = signers
+	return &ProducerSchedule{Number: (*hexutil.Big)(header.Number), Signers: signers}
+}
+
+// schedulesEqual reports whether two producer schedules are identical, order
+// included.
+func schedulesEqual(a, b []common.Address) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
 	}
+	return true
 }
 
 func (es *EventSystem) lightFilterNewHead(newHeader *types.Header, callBack func(*types.Header, bool)) {
@@ -426,6 +493,9 @@ func (es *EventSystem) eventLoop() {
 		// Subscribe ChainEvent
 		chainEvCh  = make(chan core.ChainEvent, chainEvChanSize)
 		chainEvSub = es.backend.SubscribeChainEvent(chainEvCh)
+		// Subscribe ChainHeadEvent
+		chainHeadCh  = make(chan core.ChainHeadEvent, chainHeadChanSize)
+		chainHeadSub = es.backend.SubscribeChainHeadEvent(chainHeadCh)
 	)
 
 	// Unsubscribe all events
@@ -434,6 +504,7 @@ func (es *EventSystem) eventLoop() {
 	defer rmLogsSub.Unsubscribe()
 	defer logsSub.Unsubscribe()
 	defer chainEvSub.Unsubscribe()
+	defer chainHeadSub.Unsubscribe()
 
 	for i := UnknownSubscription; i < LastIndexSubscription; i++ {
 		index[i] = make(map[rpc.ID]*subscription)
@@ -456,6 +527,8 @@ func (es *EventSystem) eventLoop() {
 			es.broadcast(index, ev)
 		case ev := <-chainEvCh:
 			es.broadcast(index, ev)
+		case ev := <-chainHeadCh:
+			es.broadcast(index, ev)
 
 		case f := <-es.install:
 			if f.typ == MinedAndPendingLogsSubscription {
@@ -485,6 +558,8 @@ func (es *EventSystem) eventLoop() {
 			return
 		case <-chainEvSub.Err():
 			return
+		case <-chainHeadSub.Err():
+			return
 		}
 	}
 }
@@ -27,6 +27,7 @@ import (
 
 	ethereum "github.com/worldopennetwork/go-won"
 	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/common/hexutil"
 	"github.com/worldopennetwork/go-won/consensus/ethash"
 	"github.com/worldopennetwork/go-won/core"
 	"github.com/worldopennetwork/go-won/core/bloombits"
@@ -45,12 +46,21 @@ type testBackend struct {
 	rmLogsFeed *event.Feed
 	logsFeed   *event.Feed
 	chainFeed  *event.Feed
+	headFeed   *event.Feed
+	config     *params.ChainConfig
 }
 
 func (b *testBackend) ChainDb() wondb.Database {
 	return b.db
 }
 
+func (b *testBackend) ChainConfig() *params.ChainConfig {
+	if b.config == nil {
+		return params.TestChainConfig
+	}
+	return b.config
+}
+
 func (b *testBackend) EventMux() *event.TypeMux {
 	return b.mux
 }
@@ -100,6 +110,10 @@ func (b *testBackend) SubscribeChainEvent(ch chan<- core.ChainEvent) event.Subsc
 	return b.chainFeed.Subscribe(ch)
 }
 
+func (b *testBackend) SubscribeChainHeadEvent(ch chan<- core.ChainHeadEvent) event.Subscription {
+	return b.headFeed.Subscribe(ch)
+}
+
 func (b *testBackend) BloomStatus() (uint64, uint64) {
 	return params.BloomBitsBlocks, b.sections
 }
@@ -146,7 +160,7 @@ func TestBlockSubscription(t *testing.T) {
 		rmLogsFeed  = new(event.Feed)
 		logsFeed    = new(event.Feed)
 		chainFeed   = new(event.Feed)
-		backend     = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend     = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), nil}
 		api         = NewPublicFilterAPI(backend, false)
 		genesis     = new(core.Genesis).MustCommit(db)
 		chain, _    = core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 10, func(i int, gen *core.BlockGen) {})
@@ -192,6 +206,82 @@ func TestBlockSubscription(t *testing.T) {
 	<-sub1.Err()
 }
 
+// TestProducerScheduleSubscription tests that a producer schedule subscription
+// only fires for the chain heads changing the schedule checkpointed in epoch
+// headers, in order.
+func TestProducerScheduleSubscription(t *testing.T) {
+	t.Parallel()
+
+	var (
+		mux      = new(event.TypeMux)
+		db, _    = wondb.NewMemDatabase()
+		headFeed = new(event.Feed)
+		config   = &params.ChainConfig{ChainId: big.NewInt(1), Dpos: &params.DposConfig{Period: 1, Epoch: 2}}
+		backend  = &testBackend{mux, db, 0, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), headFeed, config}
+		api      = NewPublicFilterAPI(backend, false)
+
+		first  = []common.Address{{0x01}, {0x02}}
+		second = []common.Address{{0x02}, {0x01}, {0x03}}
+	)
+	// Heads 2 and 4 checkpoint the same schedule, head 6 changes it
+	schedules := [][]common.Address{nil, nil, first, nil, first, nil, second, nil}
+
+	heads := make([]core.ChainHeadEvent, len(schedules))
+	for i, signers := range schedules {
+		extra := make([]byte, 32)
+		for _, signer := range signers {
+			extra = append(extra, signer[:]...)
+		}
+		extra = append(extra, make([]byte, 65)...)
+		heads[i] = core.ChainHeadEvent{Block: types.NewBlockWithHeader(&types.Header{Number: big.NewInt(int64(i)), Extra: extra})}
+	}
+	want := []ProducerSchedule{
+		{Number: (*hexutil.Big)(big.NewInt(2)), Signers: first},
+		{Number: (*hexutil.Big)(big.NewInt(6)), Signers: second},
+	}
+
+	ch := make(chan *ProducerSchedule)
+	sub := api.events.SubscribeProducerSchedule(ch)
+
+	go func() {
+		for _, e := range heads {
+			headFeed.Send(e)
+		}
+	}()
+	for i := range want {
+		select {
+		case have := <-ch:
+			if !reflect.DeepEqual(*have, want[i]) {
+				t.Errorf("schedule %d mismatch: have %v/%x, want %v/%x", i, have.Number, have.Signers, want[i].Number, want[i].Signers)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("schedule %d timeout", i)
+		}
+	}
+	select {
+	case have := <-ch:
+		t.Errorf("unexpected schedule: %v/%x", have.Number, have.Signers)
+	case <-time.After(100 * time.Millisecond):
+	}
+	sub.Unsubscribe()
+
+	// Chains without DPoS never report a schedule
+	var (
+		ethashFeed    = new(event.Feed)
+		ethashBackend = &testBackend{mux, db, 0, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), ethashFeed, nil}
+		ethashAPI     = NewPublicFilterAPI(ethashBackend, false)
+	)
+	sub = ethashAPI.events.SubscribeProducerSchedule(ch)
+	defer sub.Unsubscribe()
+
+	ethashFeed.Send(heads[2])
+	select {
+	case have := <-ch:
+		t.Errorf("unexpected schedule on non-DPoS chain: %v/%x", have.Number, have.Signers)
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
 // TestPendingTxFilter tests whether pending tx filters retrieve all pending transactions that are posted to the event mux.
 func TestPendingTxFilter(t *testing.T) {
 	t.Parallel()
@@ -203,7 +293,7 @@ func TestPendingTxFilter(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), nil}
 		api        = NewPublicFilterAPI(backend, false)
 
 		transactions = []*types.Transaction{
@@ -266,7 +356,7 @@ func TestLogFilterCreation(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), nil}
 		api        = NewPublicFilterAPI(backend, false)
 
 		testCases = []struct {
@@ -315,7 +405,7 @@ func TestInvalidLogFilterCreation(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), nil}
 		api        = NewPublicFilterAPI(backend, false)
 	)
 
@@ -345,7 +435,7 @@ func TestLogFilter(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), nil}
 		api        = NewPublicFilterAPI(backend, false)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
@@ -464,7 +554,7 @@ func TestPendingLogsSubscription(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), nil}
 		api        = NewPublicFilterAPI(backend, false)
 
 		firstAddr      = common.HexToAddress("0x1111111111111111111111111111111111111111")
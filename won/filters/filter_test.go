@@ -18,19 +18,25 @@ package filters
 
 import (
 	"context"
+	"crypto/ecdsa"
 	"io/ioutil"
 	"math/big"
 	"os"
 	"testing"
 
 	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/common/bitutil"
 	"github.com/worldopennetwork/go-won/consensus/ethash"
 	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/bloombits"
 	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/core/vm/kycabi"
 	"github.com/worldopennetwork/go-won/crypto"
 	"github.com/worldopennetwork/go-won/wondb"
 	"github.com/worldopennetwork/go-won/event"
 	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rpc"
 )
 
 func makeReceipt(addr common.Address) *types.Receipt {
@@ -56,7 +62,7 @@ func BenchmarkFilters(b *testing.B) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), nil}
 		key1, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
 		addr1      = crypto.PubkeyToAddress(key1.PublicKey)
 		addr2      = common.BytesToAddress([]byte("jeff"))
@@ -121,7 +127,7 @@ func TestFilters(t *testing.T) {
 		rmLogsFeed = new(event.Feed)
 		logsFeed   = new(event.Feed)
 		chainFeed  = new(event.Feed)
-		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed}
+		backend    = &testBackend{mux, db, 0, txFeed, rmLogsFeed, logsFeed, chainFeed, new(event.Feed), nil}
 		key1, _    = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
 		addr       = crypto.PubkeyToAddress(key1.PublicKey)
 
@@ -241,3 +247,154 @@ func TestFilters(t *testing.T) {
 		t.Error("expected 0 log, got", len(logs))
 	}
 }
+
+// sectionBackend is a testBackend serving the bloombits of its chain in sections
+// of a custom size, counting the headers the filters look up.
+type sectionBackend struct {
+	*testBackend
+	size    uint64
+	lookups int
+}
+
+func (b *sectionBackend) HeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*types.Header, error) {
+	b.lookups++
+	return b.testBackend.HeaderByNumber(ctx, blockNr)
+}
+
+func (b *sectionBackend) BloomStatus() (uint64, uint64) {
+	return b.size, b.sections
+}
+
+func (b *sectionBackend) ServiceFilter(ctx context.Context, session *bloombits.MatcherSession) {
+	requests := make(chan chan *bloombits.Retrieval)
+
+	go session.Multiplex(16, 0, requests)
+	go func() {
+		for {
+			select {
+			case <-ctx.Done():
+				return
+
+			case request := <-requests:
+				task := <-request
+
+				task.Bitsets = make([][]byte, len(task.Sections))
+				for i, section := range task.Sections {
+					head := core.GetCanonicalHash(b.db, (section+1)*b.size-1)
+					blob, _ := core.GetBloomBits(b.db, task.Bit, section, head)
+					task.Bitsets[i], _ = bitutil.DecompressBytes(blob, int(b.size/8))
+				}
+				request <- task
+			}
+		}
+	}()
+}
+
+// Tests that the stake added by voters is logged by the DPoS precompile into the
+// bloom of the blocks from the stake log fork on, and that the bloombits index finds it without scanning
+// every block.
+func TestDposFilter(t *testing.T) {
+	const (
+		sectionSize = 128
+		sections    = 3
+	)
+	var (
+		db, _   = wondb.NewMemDatabase()
+		key1, _ = crypto.HexToECDSA("b71c71a67e1177ad4e901695e1b4b9ee17ae16c6668d313eac2f96dbcda3f291")
+		key2, _ = crypto.HexToECDSA("8a1f9a8f95be41cd7ccb6168179afb4504aefe388d1e14474d32c45c72ce7b7a")
+		voter1  = crypto.PubkeyToAddress(key1.PublicKey)
+		voter2  = crypto.PubkeyToAddress(key2.PublicKey)
+		funds   = new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.WON))
+		stake   = big.NewInt(params.WON)
+		signer  = types.NewEIP155Signer(params.TestChainConfig.ChainId)
+
+		backend = &sectionBackend{
+			testBackend: &testBackend{new(event.TypeMux), db, sections, new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), new(event.Feed), nil},
+			size:        sectionSize,
+		}
+	)
+	// The producer locks up its stake in the precompile, bringing it into existence.
+	// Staking is only logged from block 100 on.
+	config := *params.TestChainConfig
+	config.DposStakeLogBlock = big.NewInt(100)
+
+	gspec := &core.Genesis{
+		Config:    &config,
+		Alloc:     core.GenesisAlloc{voter1: {Balance: funds}, voter2: {Balance: funds}, common.Address{0xff}: {Balance: stake}},
+		Producers: []core.GenesisProducer{{Address: common.Address{0xff}, Stake: stake}},
+	}
+	genesis := gspec.MustCommit(db)
+
+	// Stake in a few blocks of every section, as well as past the last one
+	stakes := map[int]*ecdsa.PrivateKey{10: key1, 100: key2, 200: key1, 300: key2, 350: key1, 400: key1}
+	chain, receipts := core.GenerateChain(gspec.Config, genesis, ethash.NewFaker(), db, 420, func(i int, gen *core.BlockGen) {
+		if key, ok := stakes[int(gen.Number().Uint64())]; ok {
+			tx, _ := types.SignTx(kycabi.NewAddStakeTx(gen.TxNonce(crypto.PubkeyToAddress(key.PublicKey)), 100000, big.NewInt(1), stake), signer, key)
+			gen.AddTx(tx)
+		}
+	})
+	for i, block := range chain {
+		core.WriteBlock(db, block)
+		if err := core.WriteCanonicalHash(db, block.Hash(), block.NumberU64()); err != nil {
+			t.Fatalf("failed to insert block number: %v", err)
+		}
+		if err := core.WriteHeadBlockHash(db, block.Hash()); err != nil {
+			t.Fatalf("failed to insert block number: %v", err)
+		}
+		if err := core.WriteBlockReceipts(db, block.Hash(), block.NumberU64(), receipts[i]); err != nil {
+			t.Fatal("error writing block receipts:", err)
+		}
+		if _, ok := stakes[int(block.NumberU64())]; ok {
+			if len(receipts[i]) != 1 || receipts[i][0].Status != types.ReceiptStatusSuccessful {
+				t.Fatalf("block %d: staking transaction failed", block.NumberU64())
+			}
+			logged := types.BloomLookup(block.Bloom(), vm.KycContractAddress) && types.BloomLookup(block.Bloom(), vm.DposStakeAddedTopic)
+			if want := block.NumberU64() >= 100; logged != want {
+				t.Errorf("block %d: staking log in bloom mismatch: have %v, want %v", block.NumberU64(), logged, want)
+			}
+		}
+	}
+	// Index the sections the same way the bloom indexer does
+	for section := uint64(0); section < sections; section++ {
+		gen, _ := bloombits.NewGenerator(sectionSize)
+		for i := uint64(0); i < sectionSize; i++ {
+			number := section*sectionSize + i
+			header := core.GetHeader(db, core.GetCanonicalHash(db, number), number)
+			gen.AddBloom(uint(i), header.Bloom)
+		}
+		head := core.GetCanonicalHash(db, (section+1)*sectionSize-1)
+		for i := 0; i < types.BloomBitLength; i++ {
+			bits, _ := gen.Bitset(uint(i))
+			core.WriteBloomBits(db, uint(i), section, head, bitutil.CompressBytes(bits))
+		}
+	}
+	// Filter the stake added by the first voter
+	logs, err := NewDposFilter(backend, 0, -1, []common.Address{voter1}).Logs(context.Background())
+	if err != nil {
+		t.Fatalf("failed to filter logs: %v", err)
+	}
+	want := []uint64{200, 350, 400}
+	if len(logs) != len(want) {
+		t.Fatalf("log count mismatch: have %d, want %d", len(logs), len(want))
+	}
+	for i, log := range logs {
+		if log.BlockNumber != want[i] || log.Address != vm.KycContractAddress || log.Topics[0] != vm.DposStakeAddedTopic || log.Topics[1] != voter1.Hash() {
+			t.Errorf("log %d mismatch: have block %d topics %x, want block %d", i, log.BlockNumber, log.Topics, want[i])
+		}
+		if new(big.Int).SetBytes(log.Data).Cmp(stake) != 0 {
+			t.Errorf("log %d stake mismatch: have %x, want %v", i, log.Data, stake)
+		}
+	}
+	// The indexed sections must have been matched, not scanned block by block
+	if unindexed := len(chain) + 1 - sections*sectionSize; backend.lookups > unindexed+len(want)+10 {
+		t.Errorf("too many header lookups: have %d, want at most %d", backend.lookups, unindexed+len(want)+10)
+	}
+	// KYC batches are filtered apart from the stakes
+	logs, err = NewKycFilter(backend, 0, -1, nil).Logs(context.Background())
+	if err != nil {
+		t.Fatalf("failed to filter logs: %v", err)
+	}
+	if len(logs) != 0 {
+		t.Errorf("KYC log count mismatch: have %d, want 0", len(logs))
+	}
+}
@@ -18,12 +18,14 @@ package gasprice
 
 import (
 	"context"
+	"encoding/binary"
 	"math/big"
 	"sort"
 	"sync"
 
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
 	"github.com/worldopennetwork/go-won/internal/wonapi"
 	"github.com/worldopennetwork/go-won/params"
 	"github.com/worldopennetwork/go-won/rpc"
@@ -31,10 +33,31 @@ import (
 
 var maxPrice = big.NewInt(500 * params.Shannon)
 
+// Gas price policies of the KYC governance transactions.
+const (
+	GovernanceMarket = "market" // priced like any other transaction
+	GovernanceFixed  = "fixed"  // priced at the fixed gas price
+	GovernanceFree   = "free"   // priced at zero
+)
+
+// governanceMethods are the methods of the KYC precompile governing the chain:
+// provider attestations and proposals, and producer registration.
+var governanceMethods = map[uint32]bool{
+	vm.KycMethodSet:                  true,
+	vm.KycMethodSetBatch:             true,
+	vm.KycMethodConfirm:              true,
+	vm.KycMethodProviderVoteProposal: true,
+	vm.KycMethodVote:                 true,
+	vm.KycMethodCancelProposal:       true,
+	vm.DposMethodRegProds:            true,
+	vm.DposMethodRmvProds:            true,
+}
+
 type Config struct {
 	Blocks        int
 	Percentile    int
 	FixedGasPrice int
+	Governance    string   // gas price policy of the KYC governance transactions
 	Default       *big.Int `toml:",omitempty"`
 }
 
@@ -50,6 +73,7 @@ type Oracle struct {
 	checkBlocks, maxEmpty, maxBlocks int
 	percentile                       int
 	fixedGasPrice                    int
+	governance                       string
 }
 
 // NewOracle returns a new oracle.
@@ -65,6 +89,10 @@ func NewOracle(backend wonapi.Backend, params Config) *Oracle {
 	if percent > 100 {
 		percent = 100
 	}
+	governance := params.Governance
+	if governance != GovernanceFixed && governance != GovernanceFree {
+		governance = GovernanceMarket
+	}
 	return &Oracle{
 		backend:       backend,
 		lastPrice:     params.Default,
@@ -73,6 +101,7 @@ func NewOracle(backend wonapi.Backend, params Config) *Oracle {
 		maxBlocks:     blocks * 5,
 		percentile:    percent,
 		fixedGasPrice: params.FixedGasPrice,
+		governance:    governance,
 	}
 }
 
@@ -85,6 +114,34 @@ func (gpo *Oracle) FixedPrice() *big.Int {
 	return new(big.Int).Set(gasPrice)
 }
 
+// SuggestPriceFor returns the recommended gas price of tx. KYC governance
+// transactions are priced by the governance policy of the oracle, all others
+// at the suggested price.
+func (gpo *Oracle) SuggestPriceFor(ctx context.Context, tx *types.Transaction) (*big.Int, error) {
+	if IsGovernanceTx(tx) {
+		switch gpo.governance {
+		case GovernanceFixed:
+			return gpo.FixedPrice(), nil
+		case GovernanceFree:
+			return new(big.Int), nil
+		}
+	}
+	return gpo.SuggestPrice(ctx)
+}
+
+// IsGovernanceTx reports whether tx calls a governance method of the KYC
+// precompile.
+func IsGovernanceTx(tx *types.Transaction) bool {
+	if to := tx.To(); to == nil || *to != vm.KycContractAddress {
+		return false
+	}
+	data, _ := vm.SplitKycInput(tx.Data())
+	if len(data) < 4 {
+		return false
+	}
+	return governanceMethods[binary.BigEndian.Uint32(data[:4])]
+}
+
 // SuggestPrice returns the recommended gas price.
 func (gpo *Oracle) SuggestPrice(ctx context.Context) (*big.Int, error) {
 	gpo.cacheLock.RLock()
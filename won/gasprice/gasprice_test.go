@@ -0,0 +1,101 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package gasprice
+
+import (
+	"context"
+	"math/big"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/core/vm/kycabi"
+	"github.com/worldopennetwork/go-won/internal/wonapi"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rpc"
+)
+
+// testBackend is a wonapi.Backend of a chain holding only its genesis block, so
+// the oracle always suggests its default price. Any other method panics.
+type testBackend struct {
+	wonapi.Backend
+}
+
+func (b *testBackend) ChainConfig() *params.ChainConfig { return params.TestChainConfig }
+
+func (b *testBackend) HeaderByNumber(ctx context.Context, number rpc.BlockNumber) (*types.Header, error) {
+	return &types.Header{Number: new(big.Int)}, nil
+}
+
+// Tests that KYC governance transactions are priced by the governance policy of
+// the oracle, and all other transactions at the suggested price.
+func TestSuggestPriceFor(t *testing.T) {
+	var (
+		market = big.NewInt(1000)
+		fixed  = big.NewInt(10)
+		free   = new(big.Int)
+
+		setKyc   = kycabi.NewSetKycTx(0, 100000, nil, common.Address{0x01}, 1, 1, 0)
+		register = kycabi.NewTx(0, 100000, nil, &kycabi.RegisterProducer{URL: "won://producer"})
+		stake    = kycabi.NewAddStakeTx(0, 100000, nil, big.NewInt(params.WON))
+		transfer = types.NewTransaction(0, common.Address{0x01}, big.NewInt(1), 21000, nil, nil)
+	)
+	tests := []struct {
+		governance string
+		tx         *types.Transaction
+		want       *big.Int
+	}{
+		{GovernanceFixed, setKyc, fixed},
+		{GovernanceFixed, register, fixed},
+		{GovernanceFixed, stake, market},
+		{GovernanceFixed, transfer, market},
+		{GovernanceFree, setKyc, free},
+		{GovernanceFree, register, free},
+		{GovernanceFree, stake, market},
+		{GovernanceFree, transfer, market},
+		{GovernanceMarket, setKyc, market},
+		{GovernanceMarket, transfer, market},
+	}
+	for i, tt := range tests {
+		gpo := NewOracle(&testBackend{}, Config{Blocks: 20, Percentile: 60, FixedGasPrice: 10, Governance: tt.governance, Default: market})
+
+		price, err := gpo.SuggestPriceFor(context.Background(), tt.tx)
+		if err != nil {
+			t.Fatalf("test %d: failed to suggest price: %v", i, err)
+		}
+		if price.Cmp(tt.want) != 0 {
+			t.Errorf("test %d (%s): price mismatch: have %v, want %v", i, tt.governance, price, tt.want)
+		}
+	}
+}
+
+// Tests that the governance transactions are priced like any other unless the
+// config asks for a known policy.
+func TestGovernanceDefaults(t *testing.T) {
+	for _, governance := range []string{"", "unknown"} {
+		if gpo := NewOracle(&testBackend{}, Config{Governance: governance}); gpo.governance != GovernanceMarket {
+			t.Errorf("policy %q: have %q, want %q", governance, gpo.governance, GovernanceMarket)
+		}
+	}
+	if IsGovernanceTx(types.NewTransaction(0, common.Address{0x01}, nil, 0, nil, kycabi.NewTx(0, 0, nil, &kycabi.UnregisterProducer{}).Data())) {
+		t.Errorf("governance input to another contract reported as governance")
+	}
+	if IsGovernanceTx(types.NewTransaction(0, vm.KycContractAddress, nil, 0, nil, nil)) {
+		t.Errorf("plain transfer to the precompile reported as governance")
+	}
+}
@@ -4,6 +4,7 @@ package won
 
 import (
 	"math/big"
+	"time"
 
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/common/hexutil"
@@ -20,15 +21,21 @@ func (c Config) MarshalTOML() (interface{}, error) {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               uint64
 		SyncMode                downloader.SyncMode
+		SkipPivotVerify         bool `toml:",omitempty"`
 		LightServ               int  `toml:",omitempty"`
 		LightPeers              int  `toml:",omitempty"`
 		SkipBcVersionCheck      bool `toml:"-"`
 		DatabaseHandles         int  `toml:"-"`
 		DatabaseCache           int
+		KycFlatStorage          bool           `toml:",omitempty"`
+		KycRetentionEpochs      uint64         `toml:",omitempty"`
 		Wonbase                 common.Address `toml:",omitempty"`
 		MinerThreads            int            `toml:",omitempty"`
 		ExtraData               hexutil.Bytes  `toml:",omitempty"`
 		GasPrice                *big.Int
+		StrictProducer          bool           `toml:",omitempty"`
+		Sealer                  common.Address `toml:",omitempty"`
+		ProducerStopTimeout     time.Duration  `toml:",omitempty"`
 		Ethash                  ethash.Config
 		TxPool                  core.TxPoolConfig
 		GPO                     gasprice.Config
@@ -39,15 +46,21 @@ func (c Config) MarshalTOML() (interface{}, error) {
 	enc.Genesis = c.Genesis
 	enc.NetworkId = c.NetworkId
 	enc.SyncMode = c.SyncMode
+	enc.SkipPivotVerify = c.SkipPivotVerify
 	enc.LightServ = c.LightServ
 	enc.LightPeers = c.LightPeers
 	enc.SkipBcVersionCheck = c.SkipBcVersionCheck
 	enc.DatabaseHandles = c.DatabaseHandles
 	enc.DatabaseCache = c.DatabaseCache
+	enc.KycFlatStorage = c.KycFlatStorage
+	enc.KycRetentionEpochs = c.KycRetentionEpochs
 	enc.Wonbase = c.Wonbase
 	enc.MinerThreads = c.MinerThreads
 	enc.ExtraData = c.ExtraData
 	enc.GasPrice = c.GasPrice
+	enc.StrictProducer = c.StrictProducer
+	enc.Sealer = c.Sealer
+	enc.ProducerStopTimeout = c.ProducerStopTimeout
 	enc.Ethash = c.Ethash
 	enc.TxPool = c.TxPool
 	enc.GPO = c.GPO
@@ -61,15 +74,21 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 		Genesis                 *core.Genesis `toml:",omitempty"`
 		NetworkId               *uint64
 		SyncMode                *downloader.SyncMode
+		SkipPivotVerify         *bool `toml:",omitempty"`
 		LightServ               *int  `toml:",omitempty"`
 		LightPeers              *int  `toml:",omitempty"`
 		SkipBcVersionCheck      *bool `toml:"-"`
 		DatabaseHandles         *int  `toml:"-"`
 		DatabaseCache           *int
+		KycFlatStorage          *bool           `toml:",omitempty"`
+		KycRetentionEpochs      *uint64         `toml:",omitempty"`
 		Wonbase                 *common.Address `toml:",omitempty"`
 		MinerThreads            *int            `toml:",omitempty"`
 		ExtraData               *hexutil.Bytes  `toml:",omitempty"`
 		GasPrice                *big.Int
+		StrictProducer          *bool           `toml:",omitempty"`
+		Sealer                  *common.Address `toml:",omitempty"`
+		ProducerStopTimeout     *time.Duration  `toml:",omitempty"`
 		Ethash                  *ethash.Config
 		TxPool                  *core.TxPoolConfig
 		GPO                     *gasprice.Config
@@ -89,6 +108,9 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.SyncMode != nil {
 		c.SyncMode = *dec.SyncMode
 	}
+	if dec.SkipPivotVerify != nil {
+		c.SkipPivotVerify = *dec.SkipPivotVerify
+	}
 	if dec.LightServ != nil {
 		c.LightServ = *dec.LightServ
 	}
@@ -104,6 +126,12 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.DatabaseCache != nil {
 		c.DatabaseCache = *dec.DatabaseCache
 	}
+	if dec.KycFlatStorage != nil {
+		c.KycFlatStorage = *dec.KycFlatStorage
+	}
+	if dec.KycRetentionEpochs != nil {
+		c.KycRetentionEpochs = *dec.KycRetentionEpochs
+	}
 	if dec.Wonbase != nil {
 		c.Wonbase = *dec.Wonbase
 	}
@@ -116,6 +144,15 @@ func (c *Config) UnmarshalTOML(unmarshal func(interface{}) error) error {
 	if dec.GasPrice != nil {
 		c.GasPrice = dec.GasPrice
 	}
+	if dec.StrictProducer != nil {
+		c.StrictProducer = *dec.StrictProducer
+	}
+	if dec.Sealer != nil {
+		c.Sealer = *dec.Sealer
+	}
+	if dec.ProducerStopTimeout != nil {
+		c.ProducerStopTimeout = *dec.ProducerStopTimeout
+	}
 	if dec.Ethash != nil {
 		c.Ethash = *dec.Ethash
 	}
@@ -0,0 +1,143 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package won
+
+import (
+	"context"
+	"encoding/binary"
+	"math/big"
+	"sync"
+
+	"github.com/worldopennetwork/go-won/accounts"
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/log"
+	"github.com/worldopennetwork/go-won/params"
+)
+
+const (
+	// governanceTxGas is the gas allowed for executing a governance transaction
+	// on top of its intrinsic gas, enough for the largest KYC batches and for
+	// releasing a couple hundred proxy delegators. Unused gas is refunded.
+	governanceTxGas = 1000000
+
+	// governanceTxRetries is the number of times a governance transaction is
+	// resubmitted with a later nonce when its nonce was taken meanwhile.
+	governanceTxRetries = 3
+)
+
+// governanceChain is the part of the blockchain the governance sender prices
+// transactions by.
+type governanceChain interface {
+	CurrentHeader() *types.Header
+}
+
+// governanceTxPool is the part of the transaction pool the governance sender
+// submits through.
+type governanceTxPool interface {
+	State() *state.ManagedState
+	AddLocal(tx *types.Transaction) error
+}
+
+// GovernanceSender signs calls of the KYC precompile with the wonbase and
+// submits them to the local transaction pool, for the features of the node
+// acting on its own behalf.
+type GovernanceSender struct {
+	config  *params.ChainConfig
+	chain   governanceChain
+	pool    governanceTxPool
+	am      *accounts.Manager
+	wonbase func() (common.Address, error)
+	price   func(ctx context.Context, tx *types.Transaction) (*big.Int, error)
+
+	lock sync.Mutex // Serialises the nonces of the transactions sent
+}
+
+// NewGovernanceSender creates a sender signing with the wallet of the account
+// returned by wonbase, at the gas price returned by price.
+func NewGovernanceSender(config *params.ChainConfig, chain governanceChain, pool governanceTxPool, am *accounts.Manager, wonbase func() (common.Address, error), price func(ctx context.Context, tx *types.Transaction) (*big.Int, error)) *GovernanceSender {
+	return &GovernanceSender{
+		config:  config,
+		chain:   chain,
+		pool:    pool,
+		am:      am,
+		wonbase: wonbase,
+		price:   price,
+	}
+}
+
+// SendGovernanceTx calls the method funcid of the KYC precompile with payload as
+// its arguments from the wonbase, whose wallet needs to be unlocked. The nonce
+// is the next one of the pool, moving on to the following ones if it turns out
+// to be taken by a transaction sent meanwhile.
+func (s *GovernanceSender) SendGovernanceTx(funcid uint32, payload []byte) (common.Hash, error) {
+	from, err := s.wonbase()
+	if err != nil {
+		return common.Hash{}, err
+	}
+	account := accounts.Account{Address: from}
+	wallet, err := s.am.Find(account)
+	if err != nil {
+		return common.Hash{}, err
+	}
+	input := make([]byte, 4+len(payload))
+	binary.BigEndian.PutUint32(input, funcid)
+	copy(input[4:], payload)
+
+	number := s.chain.CurrentHeader().Number
+	if s.config.IsKycChainBinding(new(big.Int).Add(number, common.Big1)) {
+		input = vm.BindKycInput(input, s.config.ChainId)
+	}
+	gas, err := core.IntrinsicGas(input, false, s.config.GasTable(number))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	gas += governanceTxGas
+
+	price, err := s.price(context.Background(), types.NewTransaction(0, vm.KycContractAddress, new(big.Int), gas, nil, input))
+	if err != nil {
+		return common.Hash{}, err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	nonce := s.pool.State().GetNonce(from)
+	for i := 0; ; i++ {
+		tx := types.NewTransaction(nonce, vm.KycContractAddress, new(big.Int), gas, price, input)
+		signed, err := wallet.SignTx(account, tx, s.config.ChainId)
+		if err != nil {
+			return common.Hash{}, err
+		}
+		err = s.pool.AddLocal(signed)
+		if err == nil {
+			log.Info("Submitted governance transaction", "fullhash", signed.Hash().Hex(), "method", funcid, "nonce", nonce)
+			return signed.Hash(), nil
+		}
+		if (err != core.ErrNonceTooLow && err != core.ErrReplaceUnderpriced) || i == governanceTxRetries {
+			return common.Hash{}, err
+		}
+		log.Debug("Governance transaction nonce taken, retrying", "nonce", nonce, "err", err)
+		if next := s.pool.State().GetNonce(from); next > nonce {
+			nonce = next
+		} else {
+			nonce++
+		}
+	}
+}
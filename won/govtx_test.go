@@ -0,0 +1,160 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package won
+
+import (
+	"bytes"
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/accounts"
+	"github.com/worldopennetwork/go-won/accounts/keystore"
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// governanceTestChain is a chain stuck at the genesis.
+type governanceTestChain struct{}
+
+func (governanceTestChain) CurrentHeader() *types.Header { return &types.Header{Number: new(big.Int)} }
+
+// governanceTestPool is a transaction pool whose nonces of from below taken are
+// used by transactions sent behind the back of its state, which catches up on
+// the first conflict if reveal is set.
+type governanceTestPool struct {
+	state  *state.ManagedState
+	from   common.Address
+	taken  uint64
+	reveal bool
+	txs    []*types.Transaction
+}
+
+func newGovernanceTestPool(from common.Address, nonce, taken uint64, reveal bool) *governanceTestPool {
+	db, _ := wondb.NewMemDatabase()
+	statedb, _ := state.New(common.Hash{}, state.NewDatabase(db))
+	statedb.SetNonce(from, nonce)
+
+	return &governanceTestPool{state: state.ManageState(statedb), from: from, taken: taken, reveal: reveal}
+}
+
+func (p *governanceTestPool) State() *state.ManagedState { return p.state }
+
+func (p *governanceTestPool) AddLocal(tx *types.Transaction) error {
+	if tx.Nonce() < p.taken {
+		if p.reveal {
+			p.state.SetNonce(p.from, p.taken)
+		}
+		return core.ErrNonceTooLow
+	}
+	p.txs = append(p.txs, tx)
+	return nil
+}
+
+// Tests that governance transactions are signed by the wonbase with the nonce of
+// the pool, skipping over the nonces taken meanwhile a limited number of times.
+func TestSendGovernanceTx(t *testing.T) {
+	keydir, err := ioutil.TempDir("", "won-govtx-keystore-")
+	if err != nil {
+		t.Fatalf("failed to create temporary keystore: %v", err)
+	}
+	defer os.RemoveAll(keydir)
+
+	ks := keystore.NewKeyStore(keydir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.NewAccount("")
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	am := accounts.NewManager(ks)
+	defer am.Close()
+
+	var (
+		config  = params.TestChainConfig
+		signer  = types.NewEIP155Signer(config.ChainId)
+		price   = big.NewInt(7)
+		payload = (&common.Address{0x01}).Bytes()
+		wonbase = func() (common.Address, error) { return account.Address, nil }
+		pricer  = func(ctx context.Context, tx *types.Transaction) (*big.Int, error) { return price, nil }
+	)
+	tests := []struct {
+		nonce, taken uint64
+		reveal       bool
+		locked       bool
+		want         uint64
+		fail         bool
+	}{
+		{nonce: 5, want: 5},
+		{nonce: 5, taken: 7, want: 7},
+		{nonce: 5, taken: 20, reveal: true, want: 20},
+		{nonce: 5, taken: 5 + governanceTxRetries + 1, fail: true},
+		{nonce: 5, locked: true, fail: true},
+	}
+	for i, tt := range tests {
+		if tt.locked {
+			ks.Lock(account.Address)
+		} else if err := ks.Unlock(account, ""); err != nil {
+			t.Fatalf("failed to unlock account: %v", err)
+		}
+		pool := newGovernanceTestPool(account.Address, tt.nonce, tt.taken, tt.reveal)
+		sender := NewGovernanceSender(config, governanceTestChain{}, pool, am, wonbase, pricer)
+
+		hash, err := sender.SendGovernanceTx(vm.DposMethodRefund, payload)
+		if tt.fail {
+			if err == nil {
+				t.Errorf("test %d: sending succeeded", i)
+			}
+			if len(pool.txs) > 0 {
+				t.Errorf("test %d: transaction pooled on failure", i)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("test %d: failed to send: %v", i, err)
+			continue
+		}
+		if len(pool.txs) != 1 {
+			t.Fatalf("test %d: pooled transaction count mismatch: have %d, want 1", i, len(pool.txs))
+		}
+		tx := pool.txs[0]
+		if tx.Hash() != hash {
+			t.Errorf("test %d: hash mismatch: have %x, want %x", i, hash, tx.Hash())
+		}
+		if from, err := types.Sender(signer, tx); err != nil || from != account.Address {
+			t.Errorf("test %d: sender mismatch: have %x (%v), want %x", i, from, err, account.Address)
+		}
+		if tx.Nonce() != tt.want {
+			t.Errorf("test %d: nonce mismatch: have %d, want %d", i, tx.Nonce(), tt.want)
+		}
+		if *tx.To() != vm.KycContractAddress || tx.Value().Sign() != 0 || tx.GasPrice().Cmp(price) != 0 {
+			t.Errorf("test %d: transaction mismatch: to %x, value %v, price %v", i, tx.To(), tx.Value(), tx.GasPrice())
+		}
+		want := append([]byte{0, 0, 0, vm.DposMethodRefund}, payload...)
+		if !bytes.Equal(tx.Data(), want) {
+			t.Errorf("test %d: input mismatch: have %x, want %x", i, tx.Data(), want)
+		}
+		if intrinsic, _ := core.IntrinsicGas(want, false, config.GasTable(common.Big0)); tx.Gas() != intrinsic+governanceTxGas {
+			t.Errorf("test %d: gas mismatch: have %d, want %d", i, tx.Gas(), intrinsic+governanceTxGas)
+		}
+	}
+}
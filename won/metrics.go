@@ -17,8 +17,13 @@
 package won
 
 import (
+	"math/big"
+
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/state"
 	"github.com/worldopennetwork/go-won/metrics"
 	"github.com/worldopennetwork/go-won/p2p"
+	"github.com/worldopennetwork/go-won/params"
 )
 
 var (
@@ -56,6 +61,11 @@ var (
 	miscOutTrafficMeter       = metrics.NewRegisteredMeter("won/misc/out/traffic", nil)
 )
 
+var (
+	dposTotalStakeGauge      = metrics.NewRegisteredGauge("won/dpos/totalstake", nil) // in whole WON
+	dposActiveProducersGauge = metrics.NewRegisteredGauge("won/dpos/producers/active", nil)
+)
+
 // meteredMsgReadWriter is a wrapper around a p2p.MsgReadWriter, capable of
 // accumulating the above defined metrics based on the data stream contents.
 type meteredMsgReadWriter struct {
@@ -137,3 +147,39 @@ func (rw *meteredMsgReadWriter) WriteMsg(msg p2p.Msg) error {
 	// Send the packet to the p2p layer
 	return rw.MsgReadWriter.WriteMsg(msg)
 }
+
+// dposMetricsLoop keeps the staking gauges up to date with the state of the
+// chain head until the service is shut down.
+func (s *WorldOpenNetwork) dposMetricsLoop() {
+	heads := make(chan core.ChainHeadEvent, 10)
+	sub := s.blockchain.SubscribeChainHeadEvent(heads)
+	defer sub.Unsubscribe()
+
+	if statedb, err := s.blockchain.State(); err == nil {
+		updateDposMetrics(statedb)
+	}
+	for {
+		select {
+		case head := <-heads:
+			statedb, err := s.blockchain.StateAt(head.Block.Root())
+			if err != nil {
+				continue
+			}
+			updateDposMetrics(statedb)
+
+		case <-sub.Err():
+			return
+		case <-s.shutdownChan:
+			return
+		}
+	}
+}
+
+// updateDposMetrics updates the staking gauges from the given state.
+func updateDposMetrics(statedb *state.StateDB) {
+	stake := new(big.Int).Div(statedb.GetDposTotalActivatedStake(), big.NewInt(params.WON))
+	dposTotalStakeGauge.Update(stake.Int64())
+
+	producers := statedb.GetProducerList(0, statedb.GetDposProducerCount().Int64())
+	dposActiveProducersGauge.Update(int64(len(producers)))
+}
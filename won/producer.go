@@ -0,0 +1,98 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package won
+
+import (
+	"errors"
+	"math/big"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/consensus/dpos"
+)
+
+var (
+	// errNotDpos is returned if the producer status is requested on a chain not
+	// sealed by the dpos engine.
+	errNotDpos = errors.New("not a dpos chain")
+
+	errProducerUnregistered = errors.New("wonbase is not a registered producer")
+	errProducerInactive     = errors.New("wonbase is not an active producer")
+	errProducerUnscheduled  = errors.New("wonbase is not in the elected producer schedule")
+)
+
+// ProducerStatus is the diagnosis of whether an address is able to seal blocks
+// on a dpos chain at the current head.
+type ProducerStatus struct {
+	Address    common.Address `json:"address"`
+	Registered bool           `json:"registered"`        // Whether the address is a registered producer
+	Active     bool           `json:"active"`            // Whether the producer registration is active
+	Votes      *big.Int       `json:"votes"`             // Total votes the producer was elected with
+	Scheduled  bool           `json:"scheduled"`         // Whether the address is in the signer schedule
+	SigningKey common.Address `json:"signingKey"`        // Key registered to seal the blocks of the producer
+	Warning    string         `json:"warning,omitempty"` // Reason the address can't produce, if any
+}
+
+// err returns the first reason the producer can't seal blocks, or nil if it can.
+func (s *ProducerStatus) err() error {
+	switch {
+	case !s.Registered:
+		return errProducerUnregistered
+	case !s.Active:
+		return errProducerInactive
+	case !s.Scheduled:
+		return errProducerUnscheduled
+	}
+	return nil
+}
+
+// producerStatus diagnoses whether producer is able to seal the blocks following
+// the current head, checking both its registration and the signer schedule.
+func (s *WorldOpenNetwork) producerStatus(producer common.Address) (*ProducerStatus, error) {
+	engine, ok := s.engine.(*dpos.Dpos)
+	if !ok {
+		return nil, errNotDpos
+	}
+	statedb, err := s.blockchain.State()
+	if err != nil {
+		return nil, err
+	}
+	status := &ProducerStatus{Address: producer, Votes: new(big.Int), SigningKey: producer}
+	if key := statedb.GetProducerSigningKey(&producer); key != (common.Address{}) {
+		status.SigningKey = key
+	}
+	if info := statedb.GetProducerInfo(&producer); info != nil {
+		status.Registered = true
+		status.Active = info.IsActive
+		if info.TotalVotes != nil {
+			status.Votes = info.TotalVotes
+		}
+	}
+	signers, err := engine.Signers(s.blockchain, s.blockchain.CurrentHeader())
+	if err != nil {
+		return nil, err
+	}
+	for _, signer := range signers {
+		if signer == producer {
+			status.Scheduled = true
+			break
+		}
+	}
+	if err := status.err(); err != nil {
+		status.Warning = err.Error()
+	}
+	return status, nil
+}
@@ -0,0 +1,99 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package won
+
+import (
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/params"
+)
+
+// dposDevConfig switches the developer genesis of conf over to the dpos engine,
+// checkpointing signer as the only scheduled producer.
+func dposDevConfig(conf *Config, signer common.Address) {
+	config := *conf.Genesis.Config
+	config.Clique = nil
+	config.Dpos = &params.DposConfig{Period: 1, Epoch: 30000, ProducerRepetions: 1}
+	conf.Genesis.Config = &config
+	conf.Genesis.ExtraData = append(append(make([]byte, 32), signer[:]...), make([]byte, 65)...)
+}
+
+// Tests that a wonbase registered as an elected producer is reported as able to
+// produce blocks, and starts mining even in strict mode.
+func TestProducerStatusRegistered(t *testing.T) {
+	var wonbase common.Address
+	stack, client, developer := newDevNode(t, func(conf *Config) {
+		// The developer account is only known once the genesis is assembled
+		wonbase = conf.Genesis.KycProviders[0]
+		dposDevConfig(conf, wonbase)
+		conf.Genesis.Producers = []core.GenesisProducer{{Address: wonbase, URL: "won://developer", Stake: big.NewInt(params.WON)}}
+		conf.StrictProducer = true
+	})
+	defer os.RemoveAll(stack.DataDir())
+	defer stack.Stop()
+
+	var status ProducerStatus
+	if err := client.Call(&status, "miner_producerStatus"); err != nil {
+		t.Fatalf("failed to retrieve producer status: %v", err)
+	}
+	if status.Address != developer || !status.Registered || !status.Active || !status.Scheduled || status.Warning != "" {
+		t.Fatalf("producer status mismatch: have %+v, want registered, active and scheduled %x", status, developer)
+	}
+	if status.Votes == nil || status.Votes.Sign() <= 0 {
+		t.Errorf("producer votes mismatch: have %v, want positive", status.Votes)
+	}
+	if err := client.Call(nil, "miner_start", 1); err != nil {
+		t.Errorf("failed to start mining with an elected wonbase: %v", err)
+	}
+	client.Call(nil, "miner_stop")
+}
+
+// Tests that a wonbase neither registered nor elected is diagnosed as such, and
+// only refused to mine in strict mode.
+func TestProducerStatusUnregistered(t *testing.T) {
+	for _, strict := range []bool{false, true} {
+		stack, client, developer := newDevNode(t, func(conf *Config) {
+			dposDevConfig(conf, common.Address{0xf1})
+			conf.StrictProducer = strict
+		})
+		var status ProducerStatus
+		if err := client.Call(&status, "miner_producerStatus"); err != nil {
+			t.Fatalf("strict %v: failed to retrieve producer status: %v", strict, err)
+		}
+		if status.Address != developer || status.Registered || status.Active || status.Scheduled {
+			t.Errorf("strict %v: producer status mismatch: have %+v, want unregistered and unscheduled %x", strict, status, developer)
+		}
+		if status.Warning != errProducerUnregistered.Error() {
+			t.Errorf("strict %v: producer warning mismatch: have %q, want %q", strict, status.Warning, errProducerUnregistered)
+		}
+		err := client.Call(nil, "miner_start", 1)
+		switch {
+		case strict && err == nil:
+			t.Errorf("strict %v: mining started with an unregistered wonbase", strict)
+		case !strict && err != nil:
+			t.Errorf("strict %v: failed to start mining: %v", strict, err)
+		}
+		client.Call(nil, "miner_stop")
+
+		stack.Stop()
+		os.RemoveAll(stack.DataDir())
+	}
+}
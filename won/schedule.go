@@ -0,0 +1,158 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package won
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/consensus/dpos"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/rpc"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+const (
+	// scheduleConfirms is the number of confirmation blocks before a schedule
+	// section is considered probably final and its schedule is indexed.
+	scheduleConfirms = 256
+
+	// scheduleThrottling is the time to wait between processing two consecutive
+	// index sections. It's useful during chain upgrades to prevent disk overload.
+	scheduleThrottling = 100 * time.Millisecond
+)
+
+// ProducerScheduleIndexer implements a core.ChainIndexer, recording the producer
+// schedule checkpointed at the start of every dpos epoch, one epoch per section.
+type ProducerScheduleIndexer struct {
+	size uint64         // section size, the epoch length of the dpos engine
+	db   wondb.Database // database instance to write index data into
+
+	section  uint64           // Section is the section number being processed currently
+	head     common.Hash      // Head is the hash of the last header processed
+	schedule []common.Address // Schedule checkpointed in the section being processed
+}
+
+// NewProducerScheduleIndexer returns a chain indexer that records the producer
+// schedule of every epoch of the canonical chain.
+func NewProducerScheduleIndexer(db wondb.Database, epoch uint64) *core.ChainIndexer {
+	backend := &ProducerScheduleIndexer{
+		db:   db,
+		size: epoch,
+	}
+	table := wondb.NewTable(db, string(core.ScheduleIndexPrefix))
+
+	return core.NewChainIndexer(db, table, backend, epoch, scheduleConfirms, scheduleThrottling, "schedule")
+}
+
+// Reset implements core.ChainIndexerBackend, starting a new schedule section.
+func (b *ProducerScheduleIndexer) Reset(section uint64, lastSectionHead common.Hash) error {
+	b.section, b.head, b.schedule = section, common.Hash{}, nil
+	return nil
+}
+
+// Process implements core.ChainIndexerBackend, picking up the schedule of the
+// section from its first header, the epoch checkpoint.
+func (b *ProducerScheduleIndexer) Process(header *types.Header) {
+	if header.Number.Uint64()%b.size == 0 {
+		b.schedule = dpos.CheckpointSigners(header)
+	}
+	b.head = header.Hash()
+}
+
+// Commit implements core.ChainIndexerBackend, writing the schedule of the
+// section out into the database.
+func (b *ProducerScheduleIndexer) Commit() error {
+	batch := b.db.NewBatch()
+	core.WriteProducerSchedule(batch, b.section, b.head, b.schedule)
+	return batch.Write()
+}
+
+// scheduleReorgLoop drops the schedules cached by the dpos engine and indexed by
+// the schedule indexer for the blocks reported as side blocks, the ones moved off
+// the canonical chain by a reorg included, until the node shuts down.
+func (s *WorldOpenNetwork) scheduleReorgLoop(engine *dpos.Dpos) {
+	sides := make(chan core.ChainSideEvent, 10)
+	sub := s.blockchain.SubscribeChainSideEvent(sides)
+	defer sub.Unsubscribe()
+
+	for {
+		select {
+		case side := <-sides:
+			discardSchedule(s.chainDb, engine, s.scheduleEpoch, side.Block)
+
+		case <-sub.Err():
+			return
+		case <-s.shutdownChan:
+			return
+		}
+	}
+}
+
+// discardSchedule drops the schedules cached for a block off the canonical chain:
+// the election the engine ran on top of it, and the schedule indexed for the
+// section it is the head of, if any.
+func discardSchedule(db wondb.Database, engine *dpos.Dpos, epoch uint64, block *types.Block) {
+	engine.Reorged(block.Hash())
+	if number := block.NumberU64(); number%epoch == epoch-1 {
+		core.DeleteProducerSchedule(db, number/epoch, block.Hash())
+	}
+}
+
+// PublicScheduleAPI provides the producer schedules of the past dpos epochs.
+type PublicScheduleAPI struct {
+	chain   *core.BlockChain
+	db      wondb.Database
+	indexer *core.ChainIndexer
+	epoch   uint64
+}
+
+// NewPublicScheduleAPI creates a new producer schedule API reading the schedules
+// of the sections processed by indexer.
+func NewPublicScheduleAPI(chain *core.BlockChain, db wondb.Database, indexer *core.ChainIndexer, epoch uint64) *PublicScheduleAPI {
+	return &PublicScheduleAPI{chain: chain, db: db, indexer: indexer, epoch: epoch}
+}
+
+// GetProducerScheduleAt returns the producers scheduled to sign the given block.
+// Past epochs are served from the schedule index, the ones not indexed yet from
+// the epoch checkpoint in the chain.
+func (api *PublicScheduleAPI) GetProducerScheduleAt(blockNr rpc.BlockNumber) ([]common.Address, error) {
+	var header *types.Header
+	if blockNr == rpc.LatestBlockNumber || blockNr == rpc.PendingBlockNumber {
+		header = api.chain.CurrentBlock().Header()
+	} else {
+		header = api.chain.GetHeaderByNumber(uint64(blockNr))
+	}
+	if header == nil {
+		return nil, fmt.Errorf("block #%d not found", blockNr)
+	}
+	section := header.Number.Uint64() / api.epoch
+
+	if sections, _, _ := api.indexer.Sections(); section < sections {
+		head := core.GetCanonicalHash(api.db, (section+1)*api.epoch-1)
+		if schedule, err := core.GetProducerSchedule(api.db, section, head); err == nil {
+			return schedule, nil
+		}
+	}
+	checkpoint := api.chain.GetHeaderByNumber(section * api.epoch)
+	if checkpoint == nil {
+		return nil, fmt.Errorf("checkpoint #%d not found", section*api.epoch)
+	}
+	return dpos.CheckpointSigners(checkpoint), nil
+}
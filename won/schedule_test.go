@@ -0,0 +1,161 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package won
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/consensus/dpos"
+	"github.com/worldopennetwork/go-won/consensus/ethash"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rpc"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// checkpointExtra assembles the extra-data of a dpos epoch header carrying the
+// given producer schedule.
+func checkpointExtra(schedule []common.Address) []byte {
+	extra := make([]byte, 32)
+	for _, producer := range schedule {
+		extra = append(extra, producer[:]...)
+	}
+	return append(extra, make([]byte, 65)...)
+}
+
+// Tests that the producer schedule of past epochs is served from the schedule
+// index, that of the current epoch from the chain, and that the index follows
+// reorgs.
+func TestProducerScheduleIndex(t *testing.T) {
+	const epoch = 4
+
+	var (
+		first  = []common.Address{{0x01}, {0x02}, {0x03}}
+		second = []common.Address{{0x02}, {0x04}}
+		third  = []common.Address{{0x05}}
+		forked = []common.Address{{0x06}, {0x07}}
+
+		db, _   = wondb.NewMemDatabase()
+		genesis = (&core.Genesis{ExtraData: checkpointExtra(first)}).MustCommit(db)
+	)
+	// Change the schedule in the middle of the chain, leaving the last epoch
+	// unindexed
+	schedules := map[int][]common.Address{epoch: first, 2 * epoch: second, 3 * epoch: third}
+	blocks, _ := core.GenerateChain(params.TestChainConfig, genesis, ethash.NewFaker(), db, 3*epoch+2, func(i int, b *core.BlockGen) {
+		if schedule, ok := schedules[i+1]; ok {
+			b.SetExtra(checkpointExtra(schedule))
+		}
+	})
+	chain, _ := core.NewBlockChain(db, nil, params.TestChainConfig, ethash.NewFullFaker(), vm.Config{})
+	defer chain.Stop()
+
+	if _, err := chain.InsertChain(blocks); err != nil {
+		t.Fatalf("failed to insert chain: %v", err)
+	}
+	table := wondb.NewTable(db, string(core.ScheduleIndexPrefix))
+	indexer := core.NewChainIndexer(db, table, &ProducerScheduleIndexer{db: db, size: epoch}, epoch, 0, 0, "schedule")
+	indexer.Start(chain)
+	defer indexer.Close()
+
+	api := NewPublicScheduleAPI(chain, db, indexer, epoch)
+	waitSchedule(t, api, 2*epoch+1, second)
+
+	if sections, _, _ := indexer.Sections(); sections != 3 {
+		t.Fatalf("indexed section count mismatch: have %d, want %d", sections, 3)
+	}
+	for section, want := range [][]common.Address{first, first, second} {
+		head := core.GetCanonicalHash(db, uint64(section+1)*epoch-1)
+		if schedule, err := core.GetProducerSchedule(db, uint64(section), head); err != nil || !reflect.DeepEqual(schedule, want) {
+			t.Errorf("section %d: indexed schedule mismatch: have %x (%v), want %x", section, schedule, err, want)
+		}
+	}
+	tests := []struct {
+		number rpc.BlockNumber
+		want   []common.Address
+	}{
+		{0, first},
+		{epoch - 1, first},
+		{epoch + 1, first},
+		{2*epoch - 1, first},
+		{2 * epoch, second},
+		{3*epoch - 1, second},
+		{3*epoch + 1, third},
+		{rpc.LatestBlockNumber, third},
+	}
+	for _, tt := range tests {
+		schedule, err := api.GetProducerScheduleAt(tt.number)
+		if err != nil {
+			t.Errorf("block %d: failed to retrieve schedule: %v", tt.number, err)
+			continue
+		}
+		if !reflect.DeepEqual(schedule, tt.want) {
+			t.Errorf("block %d: schedule mismatch: have %x, want %x", tt.number, schedule, tt.want)
+		}
+	}
+	if _, err := api.GetProducerScheduleAt(100); err == nil {
+		t.Errorf("schedule of unknown block returned")
+	}
+	// Reorg to a longer chain checkpointing another second schedule, and check
+	// that the affected section is reindexed
+	fork, _ := core.GenerateChain(params.TestChainConfig, blocks[epoch-1], ethash.NewFaker(), db, 3*epoch, func(i int, b *core.BlockGen) {
+		if i+1+epoch == 2*epoch {
+			b.SetExtra(checkpointExtra(forked))
+		}
+		b.SetCoinbase(common.Address{0xff})
+	})
+	if _, err := chain.InsertChain(fork); err != nil {
+		t.Fatalf("failed to insert fork: %v", err)
+	}
+	waitSchedule(t, api, 2*epoch+1, forked)
+
+	if schedule, err := api.GetProducerScheduleAt(epoch + 1); err != nil || !reflect.DeepEqual(schedule, first) {
+		t.Errorf("schedule before the fork mismatch: have %x (%v), want %x", schedule, err, first)
+	}
+	// Drop the schedules indexed on the reorged blocks as their side events do
+	engine := dpos.New(&params.DposConfig{Epoch: epoch}, db)
+	for _, block := range blocks[epoch:] {
+		discardSchedule(db, engine, epoch, block)
+	}
+	for section := uint64(1); section < 3; section++ {
+		if _, err := core.GetProducerSchedule(db, section, blocks[(section+1)*epoch-1].Hash()); err == nil {
+			t.Errorf("section %d: schedule of reorged head still indexed", section)
+		}
+	}
+	waitSchedule(t, api, 2*epoch+1, forked)
+}
+
+// waitSchedule waits until the schedule of a block is the expected one and is
+// indexed, failing the test after a while.
+func waitSchedule(t *testing.T, api *PublicScheduleAPI, number rpc.BlockNumber, want []common.Address) {
+	section := uint64(number) / api.epoch
+	for i := 0; ; i++ {
+		schedule, err := api.GetProducerScheduleAt(number)
+
+		head := core.GetCanonicalHash(api.db, (section+1)*api.epoch-1)
+		if indexed, _ := core.GetProducerSchedule(api.db, section, head); err == nil && reflect.DeepEqual(schedule, want) && reflect.DeepEqual(indexed, want) {
+			return
+		}
+		if i == 100 {
+			t.Fatalf("block %d: schedule mismatch: have %x (%v), want %x indexed", number, schedule, err, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -0,0 +1,186 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package wonclient
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math/big"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/common/hexutil"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/crypto"
+	"github.com/worldopennetwork/go-won/rlp"
+	"github.com/worldopennetwork/go-won/trie"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// errKycProofContract is returned when verifying the KYC proof of a contract,
+// whose KYC info is that of its creator.
+var errKycProofContract = errors.New("KYC proofs of contract accounts are not supported")
+
+// KycStorageProof is a storage slot of the KYC contract along with its Merkle
+// proof.
+type KycStorageProof struct {
+	Key   common.Hash     `json:"key"`
+	Value common.Hash     `json:"value"`
+	Proof []hexutil.Bytes `json:"proof"`
+}
+
+// KycProof is the KYC info of an account as claimed by a node, along with the
+// Merkle proofs to verify it with against the state root of a block.
+type KycProof struct {
+	Address         common.Address    `json:"address"`
+	Level           uint32            `json:"level"`
+	Zone            uint32            `json:"zone"`
+	Provider        common.Address    `json:"provider"`
+	ExpiresAt       hexutil.Uint64    `json:"expiresAt"`
+	AccountProof    []hexutil.Bytes   `json:"accountProof"`
+	KycAccountProof []hexutil.Bytes   `json:"kycAccountProof"`
+	StorageProof    []KycStorageProof `json:"storageProof"`
+}
+
+// KycProofAt returns the KYC info of the given account along with its Merkle proofs.
+// The block number can be nil, in which case the proof is taken from the latest known block.
+// Use VerifyKycProof to check the proof against the header of the block.
+func (ec *Client) KycProofAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*KycProof, error) {
+	var result KycProof
+	err := ec.c.CallContext(ctx, &result, "won_getKycProof", account, toBlockNumArg(blockNumber))
+	return &result, err
+}
+
+// VerifyKycProof checks proof against the state root of header, returning the
+// KYC status of the account at the time of the block. It fails if the proofs
+// are invalid or don't back the KYC info claimed along with them.
+func VerifyKycProof(header *types.Header, proof *KycProof) (*KycStatus, error) {
+	account, _, err := verifyAccountProof(header.Root, proof.Address, proof.AccountProof)
+	if err != nil {
+		return nil, fmt.Errorf("invalid account proof: %v", err)
+	}
+	if len(account.CodeHash) > 0 && !bytes.Equal(account.CodeHash, crypto.Keccak256(nil)) {
+		return nil, errKycProofContract
+	}
+	kyc, exists, err := verifyAccountProof(header.Root, vm.KycContractAddress, proof.KycAccountProof)
+	if err != nil {
+		return nil, fmt.Errorf("invalid KYC contract proof: %v", err)
+	}
+	// Verify the storage slots the KYC info depends on, all empty without the contract
+	slots := make(map[common.Hash]KycStorageProof)
+	for _, slot := range proof.StorageProof {
+		slots[slot.Key] = slot
+	}
+	storage := func(key common.Hash) (common.Hash, error) {
+		if !exists {
+			return common.Hash{}, nil
+		}
+		slot, ok := slots[key]
+		if !ok {
+			return common.Hash{}, fmt.Errorf("missing proof of KYC contract slot %x", key)
+		}
+		enc, err := verifyProof(kyc.Root, key.Bytes(), slot.Proof)
+		if err != nil {
+			return common.Hash{}, fmt.Errorf("invalid proof of KYC contract slot %x: %v", key, err)
+		}
+		var value common.Hash
+		if enc != nil {
+			_, content, _, err := rlp.Split(enc)
+			if err != nil {
+				return common.Hash{}, fmt.Errorf("invalid KYC contract slot %x: %v", key, err)
+			}
+			value = common.BytesToHash(content)
+		}
+		if value != slot.Value {
+			return common.Hash{}, fmt.Errorf("KYC contract slot %x mismatch: have %x, proven %x", key, slot.Value, value)
+		}
+		return value, nil
+	}
+	creator, err := storage(state.KycContractCreatorKey(proof.Address))
+	if err != nil {
+		return nil, err
+	}
+	if creator != (common.Hash{}) {
+		return nil, errKycProofContract
+	}
+	expiry, err := storage(state.KycExpiryKey(proof.Address))
+	if err != nil {
+		return nil, err
+	}
+	count, err := storage(state.KycProviderCountKey())
+	if err != nil {
+		return nil, err
+	}
+	// Anyone is a provider without any, otherwise its membership must be proven
+	valid := count == (common.Hash{})
+	for key := range slots {
+		index := new(big.Int).Sub(key.Big(), state.KycProviderKey(0).Big())
+		if index.Sign() < 0 || index.Cmp(count.Big()) >= 0 {
+			continue
+		}
+		provider, err := storage(key)
+		if err != nil {
+			return nil, err
+		}
+		if common.BytesToAddress(provider.Bytes()) == account.KycProvider {
+			valid = true
+		}
+	}
+	status := &KycStatus{ExpiresAt: expiry.Big().Uint64()}
+	if valid {
+		status.Provider = account.KycProvider
+	}
+	if status.Provider != (common.Address{}) && proof.Address != (common.Address{}) {
+		status.Zone = account.KycZone
+		if status.ExpiresAt == 0 || header.Time.Uint64() < status.ExpiresAt {
+			status.Level = account.KycLevel
+		}
+	}
+	claimed := KycStatus{Level: proof.Level, Zone: proof.Zone, Provider: proof.Provider, ExpiresAt: uint64(proof.ExpiresAt)}
+	if *status != claimed {
+		return nil, fmt.Errorf("claimed KYC status %+v doesn't match proven %+v", claimed, *status)
+	}
+	return status, nil
+}
+
+// verifyAccountProof checks the proof of the account of addr against the state
+// root, returning the account and whether it exists.
+func verifyAccountProof(root common.Hash, addr common.Address, proof []hexutil.Bytes) (*state.Account, bool, error) {
+	enc, err := verifyProof(root, addr.Bytes(), proof)
+	if err != nil || enc == nil {
+		return new(state.Account), false, err
+	}
+	account := new(state.Account)
+	if err := rlp.DecodeBytes(enc, account); err != nil {
+		return nil, false, err
+	}
+	return account, true, nil
+}
+
+// verifyProof checks the Merkle proof of key in the secure trie with the given
+// root, returning the value proven, or nil if it's proven absent.
+func verifyProof(root common.Hash, key []byte, proof []hexutil.Bytes) ([]byte, error) {
+	db, _ := wondb.NewMemDatabase()
+	for _, node := range proof {
+		db.Put(crypto.Keccak256(node), node)
+	}
+	value, err, _ := trie.VerifyProof(root, crypto.Keccak256(key), db)
+	return value, err
+}
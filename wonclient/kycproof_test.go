@@ -0,0 +1,177 @@
+// Copyright 2018 The go-won Authors
+// This file is part of the go-won library.
+//
+// The go-won library is free software: you can redistribute it and/or modify
+// it under the terms of the GNU Lesser General Public License as published by
+// the Free Software Foundation, either version 3 of the License, or
+// (at your option) any later version.
+//
+// The go-won library is distributed in the hope that it will be useful,
+// but WITHOUT ANY WARRANTY; without even the implied warranty of
+// MERCHANTABILITY or FITNESS FOR A PARTICULAR PURPOSE. See the
+// GNU Lesser General Public License for more details.
+//
+// You should have received a copy of the GNU Lesser General Public License
+// along with the go-won library. If not, see <http://www.gnu.org/licenses/>.
+
+package wonclient
+
+import (
+	"context"
+	"math/big"
+	"os"
+	"testing"
+
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core/state"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/internal/wonapi"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/rpc"
+	"github.com/worldopennetwork/go-won/wondb"
+)
+
+// proofBackend serves the blockchain API from a single committed state.
+type proofBackend struct {
+	wonapi.Backend
+	db     state.Database
+	header *types.Header
+}
+
+func (b *proofBackend) ChainConfig() *params.ChainConfig { return params.TestChainConfig }
+
+func (b *proofBackend) StateAndHeaderByNumber(ctx context.Context, blockNr rpc.BlockNumber) (*state.StateDB, *types.Header, error) {
+	statedb, err := state.New(b.header.Root, b.db)
+	return statedb, b.header, err
+}
+
+// Tests that KYC proofs of a committed state verify against its root, and that
+// tampering with them is detected.
+func TestKycProofRoundTrip(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	sdb := state.NewDatabase(db)
+	statedb, _ := state.New(common.Hash{}, sdb)
+
+	var (
+		providers = []common.Address{{0xf1}, {0xf2}}
+		user      = common.Address{0x01}
+		lapsed    = common.Address{0x02}
+		stranger  = common.Address{0x03}
+	)
+	for _, provider := range providers {
+		statedb.AddKycProvider(provider)
+	}
+	statedb.SetKycProvider(user, providers[1])
+	statedb.SetKycLevel(user, 2)
+	statedb.SetKycZone(user, 3)
+	statedb.SetKycExpiry(user, 5000)
+
+	statedb.SetKycProvider(lapsed, common.Address{0xf3})
+	statedb.SetKycLevel(lapsed, 2)
+
+	root, err := statedb.Commit(true)
+	if err != nil {
+		t.Fatalf("failed to commit state: %v", err)
+	}
+	backend := &proofBackend{db: sdb, header: &types.Header{Number: big.NewInt(1), Root: root, Time: big.NewInt(1000)}}
+
+	server := rpc.NewServer()
+	if err := server.RegisterName("won", wonapi.NewPublicBlockChainAPI(backend)); err != nil {
+		t.Fatalf("failed to register API: %v", err)
+	}
+	rpcClient := rpc.DialInProc(server)
+	defer rpcClient.Close()
+	client := NewClient(rpcClient)
+
+	tests := []struct {
+		account common.Address
+		time    int64
+		status  KycStatus
+	}{
+		{user, 1000, KycStatus{Level: 2, Zone: 3, Provider: providers[1], ExpiresAt: 5000}},
+		{user, 5000, KycStatus{Zone: 3, Provider: providers[1], ExpiresAt: 5000}},
+		{lapsed, 1000, KycStatus{}},
+		{stranger, 1000, KycStatus{}},
+		{providers[0], 1000, KycStatus{}},
+	}
+	for i, tt := range tests {
+		backend.header.Time = big.NewInt(tt.time)
+
+		proof, err := client.KycProofAt(context.Background(), tt.account, nil)
+		if err != nil {
+			t.Fatalf("test %d: failed to retrieve proof: %v", i, err)
+		}
+		status, err := VerifyKycProof(backend.header, proof)
+		if err != nil {
+			t.Errorf("test %d: failed to verify proof: %v", i, err)
+			continue
+		}
+		if *status != tt.status {
+			t.Errorf("test %d: proven status mismatch: have %+v, want %+v", i, status, tt.status)
+		}
+	}
+	// Tamper with the proof of the verified user in all the ways it matters
+	backend.header.Time = big.NewInt(1000)
+
+	tampers := []func(*KycProof){
+		func(proof *KycProof) { proof.Level++ },
+		func(proof *KycProof) { proof.Provider = providers[0] },
+		func(proof *KycProof) { proof.ExpiresAt = 0 },
+		func(proof *KycProof) { proof.AccountProof = proof.AccountProof[1:] },
+		func(proof *KycProof) { proof.StorageProof = proof.StorageProof[:len(proof.StorageProof)-1] },
+		func(proof *KycProof) { proof.StorageProof[1].Value = common.Hash{} },
+	}
+	for i, tamper := range tampers {
+		proof, err := client.KycProofAt(context.Background(), user, nil)
+		if err != nil {
+			t.Fatalf("tamper %d: failed to retrieve proof: %v", i, err)
+		}
+		tamper(proof)
+		if status, err := VerifyKycProof(backend.header, proof); err == nil {
+			t.Errorf("tamper %d: tampered proof verified: %+v", i, status)
+		}
+	}
+	proof, err := client.KycProofAt(context.Background(), user, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve proof: %v", err)
+	}
+	if status, err := VerifyKycProof(&types.Header{Root: common.Hash{0x01}, Time: big.NewInt(1000)}, proof); err == nil {
+		t.Errorf("proof verified against foreign root: %+v", status)
+	}
+}
+
+// Tests that the KYC proofs of a live node verify against its block headers.
+func TestKycProofLiveNode(t *testing.T) {
+	var (
+		provider = common.HexToAddress("0x00000000000000000000000000000000000000f1")
+		producer = common.HexToAddress("0x00000000000000000000000000000000000000f2")
+		stake    = new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.WON))
+		ctx      = context.Background()
+	)
+	stack, client := newTestNode(t, provider, producer, stake, nil)
+	defer os.RemoveAll(stack.DataDir())
+	defer stack.Stop()
+
+	header, err := client.HeaderByNumber(ctx, big.NewInt(0))
+	if err != nil {
+		t.Fatalf("failed to retrieve genesis header: %v", err)
+	}
+	// Only the provider is attested in genesis, by itself
+	want := map[common.Address]KycStatus{
+		provider: {Level: 99999999, Zone: 99999999, Provider: provider},
+	}
+	for _, account := range []common.Address{provider, producer, {0x01}} {
+		proof, err := client.KycProofAt(ctx, account, big.NewInt(0))
+		if err != nil {
+			t.Fatalf("failed to retrieve proof of %x: %v", account, err)
+		}
+		status, err := VerifyKycProof(header, proof)
+		if err != nil {
+			t.Errorf("failed to verify proof of %x: %v", account, err)
+			continue
+		}
+		if *status != want[account] {
+			t.Errorf("account %x status mismatch: have %+v, want %+v", account, status, want[account])
+		}
+	}
+}
@@ -25,9 +25,12 @@ import (
 	"math/big"
 
 	"github.com/worldopennetwork/go-won"
+	"github.com/worldopennetwork/go-won/accounts"
 	"github.com/worldopennetwork/go-won/common"
 	"github.com/worldopennetwork/go-won/common/hexutil"
 	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm"
+	"github.com/worldopennetwork/go-won/core/vm/kycabi"
 	"github.com/worldopennetwork/go-won/rlp"
 	"github.com/worldopennetwork/go-won/rpc"
 )
@@ -58,7 +61,7 @@ func NewClient(c *rpc.Client) *Client {
 // Note that loading full blocks requires two requests. Use HeaderByHash
 // if you don't need all transactions or uncle headers.
 func (ec *Client) BlockByHash(ctx context.Context, hash common.Hash) (*types.Block, error) {
-	return ec.getBlock(ctx, "eth_getBlockByHash", hash, true)
+	return ec.getBlock(ctx, "won_getBlockByHash", hash, true)
 }
 
 // BlockByNumber returns a block from the current canonical chain. If number is nil, the
@@ -67,7 +70,7 @@ func (ec *Client) BlockByHash(ctx context.Context, hash common.Hash) (*types.Blo
 // Note that loading full blocks requires two requests. Use HeaderByNumber
 // if you don't need all transactions or uncle headers.
 func (ec *Client) BlockByNumber(ctx context.Context, number *big.Int) (*types.Block, error) {
-	return ec.getBlock(ctx, "eth_getBlockByNumber", toBlockNumArg(number), true)
+	return ec.getBlock(ctx, "won_getBlockByNumber", toBlockNumArg(number), true)
 }
 
 type rpcBlock struct {
@@ -113,7 +116,7 @@ func (ec *Client) getBlock(ctx context.Context, method string, args ...interface
 		reqs := make([]rpc.BatchElem, len(body.UncleHashes))
 		for i := range reqs {
 			reqs[i] = rpc.BatchElem{
-				Method: "eth_getUncleByBlockHashAndIndex",
+				Method: "won_getUncleByBlockHashAndIndex",
 				Args:   []interface{}{body.Hash, hexutil.EncodeUint64(uint64(i))},
 				Result: &uncles[i],
 			}
@@ -142,7 +145,7 @@ func (ec *Client) getBlock(ctx context.Context, method string, args ...interface
 // HeaderByHash returns the block header with the given hash.
 func (ec *Client) HeaderByHash(ctx context.Context, hash common.Hash) (*types.Header, error) {
 	var head *types.Header
-	err := ec.c.CallContext(ctx, &head, "eth_getBlockByHash", hash, false)
+	err := ec.c.CallContext(ctx, &head, "won_getBlockByHash", hash, false)
 	if err == nil && head == nil {
 		err = ethereum.NotFound
 	}
@@ -153,7 +156,7 @@ func (ec *Client) HeaderByHash(ctx context.Context, hash common.Hash) (*types.He
 // nil, the latest known header is returned.
 func (ec *Client) HeaderByNumber(ctx context.Context, number *big.Int) (*types.Header, error) {
 	var head *types.Header
-	err := ec.c.CallContext(ctx, &head, "eth_getBlockByNumber", toBlockNumArg(number), false)
+	err := ec.c.CallContext(ctx, &head, "won_getBlockByNumber", toBlockNumArg(number), false)
 	if err == nil && head == nil {
 		err = ethereum.NotFound
 	}
@@ -181,7 +184,7 @@ func (tx *rpcTransaction) UnmarshalJSON(msg []byte) error {
 // TransactionByHash returns the transaction with the given hash.
 func (ec *Client) TransactionByHash(ctx context.Context, hash common.Hash) (tx *types.Transaction, isPending bool, err error) {
 	var json *rpcTransaction
-	err = ec.c.CallContext(ctx, &json, "eth_getTransactionByHash", hash)
+	err = ec.c.CallContext(ctx, &json, "won_getTransactionByHash", hash)
 	if err != nil {
 		return nil, false, err
 	} else if json == nil {
@@ -476,6 +479,203 @@ func (ec *Client) SendTransaction(ctx context.Context, tx *types.Transaction) er
 	return ec.c.CallContext(ctx, nil, "won_sendRawTransaction", common.ToHex(data))
 }
 
+// KYC and DPoS
+
+// KycStatus is the KYC attestation of an account.
+type KycStatus struct {
+	Level     uint32
+	Zone      uint32
+	Provider  common.Address
+	ExpiresAt uint64 // Unix time the attestation lapses at, zero if it never does
+}
+
+// ProducerInfo is the registration of a DPoS block producer.
+type ProducerInfo struct {
+	Address    common.Address          `json:"address"`
+	URL        string                  `json:"url"`
+	TotalVotes *big.Int                `json:"totalVotes"`
+	Active     bool                    `json:"isActive"`
+	Location   common.ProducerLocation `json:"location"` // ISO 3166-1 numeric code, zero if unknown
+}
+
+// VoterInfo is the stake of a DPoS voter and the producers it votes for.
+type VoterInfo struct {
+	Staking   *big.Int         `json:"staking"`
+	Producers []common.Address `json:"producers"`
+}
+
+// RefundInfo is the pending stake refund of a DPoS voter.
+type RefundInfo struct {
+	Stake       *big.Int `json:"stake"`
+	RequestTime *big.Int `json:"requestTime"`
+}
+
+// KycStatusAt returns the KYC status of the given account.
+// The block number can be nil, in which case the status is taken from the latest known block.
+func (ec *Client) KycStatusAt(ctx context.Context, account common.Address, blockNumber *big.Int) (*KycStatus, error) {
+	var result struct {
+		Level     uint32         `json:"level"`
+		Zone      uint32         `json:"zone"`
+		Provider  common.Address `json:"provider"`
+		ExpiresAt hexutil.Uint64 `json:"expiresAt"`
+	}
+	if err := ec.c.CallContext(ctx, &result, "won_getKycInfo", account, toBlockNumArg(blockNumber)); err != nil {
+		return nil, err
+	}
+	return &KycStatus{
+		Level:     result.Level,
+		Zone:      result.Zone,
+		Provider:  result.Provider,
+		ExpiresAt: uint64(result.ExpiresAt),
+	}, nil
+}
+
+// KycProviderList returns the current KYC providers.
+func (ec *Client) KycProviderList(ctx context.Context) ([]common.Address, error) {
+	var result []common.Address
+	err := ec.c.CallContext(ctx, &result, "won_getKycProviderList")
+	return result, err
+}
+
+// ProducerList returns up to count of the registered block producers, skipping
+// the first start of them.
+func (ec *Client) ProducerList(ctx context.Context, start, count int64) ([]common.Address, error) {
+	var result []common.Address
+	err := ec.c.CallContext(ctx, &result, "won_getDposProducerList", start, count)
+	return result, err
+}
+
+// ProducerInfo returns the registration of the given block producer.
+// If the producer is not registered, the returned error is NotFound.
+func (ec *Client) ProducerInfo(ctx context.Context, producer common.Address) (*ProducerInfo, error) {
+	var info *ProducerInfo
+	err := ec.c.CallContext(ctx, &info, "won_getDposProducerInfo", producer)
+	if err == nil && info == nil {
+		err = ethereum.NotFound
+	}
+	return info, err
+}
+
+// VoterInfo returns the stake and votes of the given account.
+func (ec *Client) VoterInfo(ctx context.Context, voter common.Address) (*VoterInfo, error) {
+	var info *VoterInfo
+	if err := ec.c.CallContext(ctx, &info, "won_getDposVoterInfo", voter); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// RefundInfo returns the stake refund the given account requested.
+func (ec *Client) RefundInfo(ctx context.Context, voter common.Address) (*RefundInfo, error) {
+	var info *RefundInfo
+	if err := ec.c.CallContext(ctx, &info, "won_getDposRefundInfo", voter); err != nil {
+		return nil, err
+	}
+	return info, nil
+}
+
+// SendKycCall signs a transaction making the given KYC precompile call from
+// account with wallet and injects it into the pending pool. The nonce, gas price
+// and gas limit of the transaction are filled in from the pending state of the
+// backend, chainID is the chain the transaction is signed for.
+func (ec *Client) SendKycCall(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int, call kycabi.Call) (*types.Transaction, error) {
+	nonce, err := ec.PendingNonceAt(ctx, account.Address)
+	if err != nil {
+		return nil, err
+	}
+	gasPrice, err := ec.SuggestGasPrice(ctx)
+	if err != nil {
+		return nil, err
+	}
+	input := call.Pack()
+	gas, err := ec.EstimateGas(ctx, ethereum.CallMsg{From: account.Address, To: &vm.KycContractAddress, Data: input})
+	if err != nil {
+		return nil, err
+	}
+	tx := types.NewTransaction(nonce, vm.KycContractAddress, new(big.Int), gas, gasPrice, input)
+	signed, err := wallet.SignTx(account, tx, chainID)
+	if err != nil {
+		return nil, err
+	}
+	return signed, ec.SendTransaction(ctx, signed)
+}
+
+// SendSetKyc sets the KYC info of address with a transaction from the provider
+// account, see SendKycCall.
+func (ec *Client) SendSetKyc(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int, address common.Address, level, zone uint32, expiresAt uint64) (*types.Transaction, error) {
+	return ec.SendKycCall(ctx, wallet, account, chainID, &kycabi.SetKyc{Address: address, Level: level, Zone: zone, ExpiresAt: expiresAt})
+}
+
+// SendRegisterProducer registers account as a block producer, see SendKycCall.
+func (ec *Client) SendRegisterProducer(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int, url string) (*types.Transaction, error) {
+	return ec.SendKycCall(ctx, wallet, account, chainID, &kycabi.RegisterProducer{URL: url})
+}
+
+// SendAddStake stakes value of the balance of account, see SendKycCall.
+func (ec *Client) SendAddStake(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int, value *big.Int) (*types.Transaction, error) {
+	return ec.SendKycCall(ctx, wallet, account, chainID, &kycabi.AddStake{Value: value})
+}
+
+// SendSubStake requests a refund of value of the stake of account, see
+// SendKycCall.
+func (ec *Client) SendSubStake(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int, value *big.Int) (*types.Transaction, error) {
+	return ec.SendKycCall(ctx, wallet, account, chainID, &kycabi.SubStake{Value: value})
+}
+
+// SendVoteProducers votes for producers with the stake of account, see
+// SendKycCall.
+func (ec *Client) SendVoteProducers(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int, producers []common.Address) (*types.Transaction, error) {
+	return ec.SendKycCall(ctx, wallet, account, chainID, &kycabi.VoteProducers{Producers: producers})
+}
+
+// SendAddVote adds a vote of account for producer, keeping its other votes, see
+// SendKycCall.
+func (ec *Client) SendAddVote(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int, producer common.Address) (*types.Transaction, error) {
+	return ec.SendKycCall(ctx, wallet, account, chainID, &kycabi.AddVote{Producer: producer})
+}
+
+// SendRemoveVote withdraws the vote of account for producer, keeping its other
+// votes, see SendKycCall.
+func (ec *Client) SendRemoveVote(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int, producer common.Address) (*types.Transaction, error) {
+	return ec.SendKycCall(ctx, wallet, account, chainID, &kycabi.RemoveVote{Producer: producer})
+}
+
+// SendRegisterProxy registers account as a vote proxy others may delegate their
+// votes to, or unregisters it, see SendKycCall.
+func (ec *Client) SendRegisterProxy(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int, unregister bool) (*types.Transaction, error) {
+	return ec.SendKycCall(ctx, wallet, account, chainID, &kycabi.RegisterProxy{Unregister: unregister})
+}
+
+// SendSetProxy delegates the votes of account to proxy, or revokes the
+// delegation if proxy is the zero address, see SendKycCall.
+func (ec *Client) SendSetProxy(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int, proxy common.Address) (*types.Transaction, error) {
+	return ec.SendKycCall(ctx, wallet, account, chainID, &kycabi.SetProxy{Proxy: proxy})
+}
+
+// SendSetLocation sets the country or region account, a block producer, operates
+// from, see SendKycCall.
+func (ec *Client) SendSetLocation(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int, location common.ProducerLocation) (*types.Transaction, error) {
+	return ec.SendKycCall(ctx, wallet, account, chainID, &kycabi.SetLocation{Location: location})
+}
+
+// SendSetAutoRefund opts account in or out of having its matured refunds paid
+// out automatically, see SendKycCall.
+func (ec *Client) SendSetAutoRefund(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int, enable bool) (*types.Transaction, error) {
+	return ec.SendKycCall(ctx, wallet, account, chainID, &kycabi.SetAutoRefund{Disable: !enable})
+}
+
+// SendSetSigningKey hands the sealing of the blocks of account, a block producer,
+// over to key, or restores its own key if key is the zero address, see
+// SendKycCall.
+func (ec *Client) SendSetSigningKey(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int, key common.Address) (*types.Transaction, error) {
+	return ec.SendKycCall(ctx, wallet, account, chainID, &kycabi.SetSigningKey{Key: key})
+}
+
+// SendRefund pays out the stake refund requested by account, see SendKycCall.
+func (ec *Client) SendRefund(ctx context.Context, wallet accounts.Wallet, account accounts.Account, chainID *big.Int) (*types.Transaction, error) {
+	return ec.SendKycCall(ctx, wallet, account, chainID, &kycabi.Refund{})
+}
+
 func toCallArg(msg ethereum.CallMsg) interface{} {
 	arg := map[string]interface{}{
 		"from": msg.From,
@@ -16,7 +16,24 @@
 
 package wonclient
 
-import "github.com/worldopennetwork/go-won"
+import (
+	"context"
+	"io/ioutil"
+	"math/big"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/worldopennetwork/go-won"
+	"github.com/worldopennetwork/go-won/accounts/keystore"
+	"github.com/worldopennetwork/go-won/common"
+	"github.com/worldopennetwork/go-won/core"
+	"github.com/worldopennetwork/go-won/core/types"
+	"github.com/worldopennetwork/go-won/core/vm/kycabi"
+	"github.com/worldopennetwork/go-won/node"
+	"github.com/worldopennetwork/go-won/params"
+	"github.com/worldopennetwork/go-won/won"
+)
 
 // Verify that Client implements the ethereum interfaces.
 var (
@@ -32,3 +49,158 @@ var (
 	// _ = ethereum.PendingStateEventer(&Client{})
 	_ = ethereum.PendingContractCaller(&Client{})
 )
+
+// newTestNode starts a networkless node running a DPoS chain with the given KYC
+// provider and producer in its genesis, returning a client attached to it.
+func newTestNode(t *testing.T, provider, producer common.Address, stake *big.Int, genesisOverride func(*core.Genesis)) (*node.Node, *Client) {
+	workspace, err := ioutil.TempDir("", "wonclient-tester-")
+	if err != nil {
+		t.Fatalf("failed to create temporary datadir: %v", err)
+	}
+	stack, err := node.New(&node.Config{DataDir: workspace, UseLightweightKDF: true, Name: "wonclient-tester"})
+	if err != nil {
+		os.RemoveAll(workspace)
+		t.Fatalf("failed to create node: %v", err)
+	}
+	genesis := core.DeveloperGenesisBlock(15, common.Address{})
+	config := *genesis.Config
+	config.Clique, config.Dpos = nil, &params.DposConfig{Period: 15}
+	genesis.Config = &config
+	genesis.KycProviders = []common.Address{provider}
+	genesis.Producers = []core.GenesisProducer{{Address: producer, URL: "https://producer.example", Stake: stake}}
+	genesis.Alloc[producer] = core.GenesisAccount{Balance: stake}
+	if genesisOverride != nil {
+		genesisOverride(genesis)
+	}
+
+	conf := won.DefaultConfig
+	conf.Genesis = genesis
+	if err = stack.Register(func(ctx *node.ServiceContext) (node.Service, error) { return won.New(ctx, &conf) }); err != nil {
+		t.Fatalf("failed to register WorldOpenNetwork protocol: %v", err)
+	}
+	if err = stack.Start(); err != nil {
+		t.Fatalf("failed to start test stack: %v", err)
+	}
+	rpcClient, err := stack.Attach()
+	if err != nil {
+		t.Fatalf("failed to attach to node: %v", err)
+	}
+	return stack, NewClient(rpcClient)
+}
+
+// Tests that the KYC and DPoS accessors decode the state of a live node.
+func TestKycDposAccessors(t *testing.T) {
+	var (
+		provider = common.HexToAddress("0x00000000000000000000000000000000000000f1")
+		producer = common.HexToAddress("0x00000000000000000000000000000000000000f2")
+		stake    = new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.WON))
+		ctx      = context.Background()
+	)
+	stack, client := newTestNode(t, provider, producer, stake, nil)
+	defer os.RemoveAll(stack.DataDir())
+	defer stack.Stop()
+
+	providers, err := client.KycProviderList(ctx)
+	if err != nil {
+		t.Fatalf("failed to retrieve KYC providers: %v", err)
+	}
+	if len(providers) != 1 || providers[0] != provider {
+		t.Errorf("KYC providers mismatch: have %x, want [%x]", providers, provider)
+	}
+	status, err := client.KycStatusAt(ctx, common.Address{0x01}, nil)
+	if err != nil {
+		t.Fatalf("failed to retrieve KYC status: %v", err)
+	}
+	if (*status != KycStatus{}) {
+		t.Errorf("unattested KYC status mismatch: have %+v, want zero", status)
+	}
+	producers, err := client.ProducerList(ctx, 0, 10)
+	if err != nil {
+		t.Fatalf("failed to retrieve producers: %v", err)
+	}
+	if len(producers) != 1 || producers[0] != producer {
+		t.Errorf("producers mismatch: have %x, want [%x]", producers, producer)
+	}
+	info, err := client.ProducerInfo(ctx, producer)
+	if err != nil {
+		t.Fatalf("failed to retrieve producer info: %v", err)
+	}
+	if info.Address != producer || info.URL != "https://producer.example" || !info.Active || info.TotalVotes.Sign() <= 0 {
+		t.Errorf("producer info mismatch: have %+v", info)
+	}
+	if _, err := client.ProducerInfo(ctx, provider); err != ethereum.NotFound {
+		t.Errorf("unknown producer error mismatch: have %v, want %v", err, ethereum.NotFound)
+	}
+	voter, err := client.VoterInfo(ctx, producer)
+	if err != nil {
+		t.Fatalf("failed to retrieve voter info: %v", err)
+	}
+	if voter.Staking.Cmp(stake) != 0 || len(voter.Producers) != 1 || voter.Producers[0] != producer {
+		t.Errorf("voter info mismatch: have %+v, want staking %v for [%x]", voter, stake, producer)
+	}
+	refund, err := client.RefundInfo(ctx, producer)
+	if err != nil {
+		t.Fatalf("failed to retrieve refund info: %v", err)
+	}
+	if refund.Stake.Sign() != 0 || refund.RequestTime.Sign() != 0 {
+		t.Errorf("refund info mismatch: have %+v, want none", refund)
+	}
+}
+
+// Tests that precompile calls are signed with the wallet and land in the pool.
+func TestSendKycCall(t *testing.T) {
+	keydir, err := ioutil.TempDir("", "wonclient-keystore-")
+	if err != nil {
+		t.Fatalf("failed to create temporary keystore: %v", err)
+	}
+	defer os.RemoveAll(keydir)
+
+	ks := keystore.NewKeyStore(keydir, keystore.LightScryptN, keystore.LightScryptP)
+	account, err := ks.NewAccount("")
+	if err != nil {
+		t.Fatalf("failed to create account: %v", err)
+	}
+	if err := ks.Unlock(account, ""); err != nil {
+		t.Fatalf("failed to unlock account: %v", err)
+	}
+	wallet := ks.Wallets()[0]
+
+	var (
+		producer = common.HexToAddress("0x00000000000000000000000000000000000000f2")
+		stake    = new(big.Int).Mul(big.NewInt(1000), big.NewInt(params.WON))
+		ctx      = context.Background()
+		chainID  *big.Int
+	)
+	stack, client := newTestNode(t, account.Address, producer, stake, func(genesis *core.Genesis) {
+		genesis.Alloc[account.Address] = core.GenesisAccount{Balance: new(big.Int).Mul(stake, big.NewInt(2))}
+		chainID = genesis.Config.ChainId
+	})
+	defer os.RemoveAll(stack.DataDir())
+	defer stack.Stop()
+
+	user := common.HexToAddress("0x00000000000000000000000000000000000000f3")
+	tx, err := client.SendSetKyc(ctx, wallet, account, chainID, user, 2, 3, 5000)
+	if err != nil {
+		t.Fatalf("failed to send KYC transaction: %v", err)
+	}
+	pooled, pending, err := client.TransactionByHash(ctx, tx.Hash())
+	if err != nil {
+		t.Fatalf("failed to retrieve KYC transaction: %v", err)
+	}
+	if !pending {
+		t.Errorf("KYC transaction not pending")
+	}
+	if sender, err := types.Sender(types.NewEIP155Signer(chainID), pooled); err != nil || sender != account.Address {
+		t.Errorf("KYC transaction sender mismatch: have %x/%v, want %x", sender, err, account.Address)
+	}
+	call, err := kycabi.DecodeTx(pooled)
+	if err != nil {
+		t.Fatalf("failed to decode KYC transaction: %v", err)
+	}
+	if want := (&kycabi.SetKyc{Address: user, Level: 2, Zone: 3, ExpiresAt: 5000}); !reflect.DeepEqual(call, want) {
+		t.Errorf("KYC call mismatch: have %+v, want %+v", call, want)
+	}
+	if nonce, err := client.PendingNonceAt(ctx, account.Address); err != nil || nonce != 1 {
+		t.Errorf("pending nonce mismatch: have %d/%v, want 1", nonce, err)
+	}
+}
@@ -190,3 +190,40 @@ func testParallelPutGet(db wondb.Database, t *testing.T) {
 	}
 	pending.Wait()
 }
+
+func TestLDB_BatchDelete(t *testing.T) {
+	db, remove := newTestLDB()
+	defer remove()
+	testBatchDelete(db, t)
+}
+
+func TestMemoryDB_BatchDelete(t *testing.T) {
+	db, _ := wondb.NewMemDatabase()
+	testBatchDelete(db, t)
+}
+
+func testBatchDelete(db wondb.Database, t *testing.T) {
+	if err := db.Put([]byte("a"), []byte("1")); err != nil {
+		t.Fatalf("put failed: %v", err)
+	}
+	batch := db.NewBatch()
+	batch.Delete([]byte("a"))
+	batch.Put([]byte("b"), []byte("2"))
+	batch.Put([]byte("c"), []byte("3"))
+	batch.Delete([]byte("c"))
+
+	if ok, _ := db.Has([]byte("b")); ok {
+		t.Fatalf("batch written before Write")
+	}
+	if ok, _ := db.Has([]byte("a")); !ok {
+		t.Fatalf("batch deletion applied before Write")
+	}
+	if err := batch.Write(); err != nil {
+		t.Fatalf("batch write failed: %v", err)
+	}
+	for key, want := range map[string]bool{"a": false, "b": true, "c": false} {
+		if have, _ := db.Has([]byte(key)); have != want {
+			t.Errorf("key %q: presence mismatch: have %v, want %v", key, have, want)
+		}
+	}
+}